@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"pingdisco.com/pingdisco/internal/ad"
+	"pingdisco.com/pingdisco/internal/device"
+	"pingdisco.com/pingdisco/internal/timefmt"
+)
+
+// adOptions are the flags reaching the Active Directory domain the devices
+// found are reconciled with.
+type adOptions struct {
+	url, user, password, base, ca *string
+}
+
+func adFlags(fs *flag.FlagSet) adOptions {
+	return adOptions{
+		url:      fs.String("ad", os.Getenv("PINGDISCO_AD"), "reconcile the devices found with the computer accounts of this Active Directory domain controller, e.g. ldaps://dc01.corp.example"),
+		user:     fs.String("ad-user", os.Getenv("PINGDISCO_AD_USER"), "domain account to read the computer accounts as, e.g. scanner@corp.example"),
+		password: fs.String("ad-password", os.Getenv("PINGDISCO_AD_PASSWORD"), "password of --ad-user (default $PINGDISCO_AD_PASSWORD)"),
+		base:     fs.String("ad-base", "", "only reconcile the computer accounts below this DN, e.g. OU=Office,DC=corp,DC=example (default: the whole domain)"),
+		ca:       fs.String("ad-ca", "", "PEM file of the certificate authority that issued the domain controller's certificate, such as the enterprise CA (default: the system's)"),
+	}
+}
+
+// loadComputers returns the computer accounts of the domain with the
+// addresses of their DNS names.
+func (o adOptions) loadComputers() ([]ad.Computer, error) {
+	cfg := ad.Config{URL: *o.url, User: *o.user, Password: *o.password, Base: *o.base}
+	if *o.ca != "" {
+		pem, err := os.ReadFile(*o.ca)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%s: no PEM certificate", *o.ca)
+		}
+		cfg.TLS = &tls.Config{RootCAs: pool}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	computers, err := ad.Computers(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	ad.Resolve(ctx, computers)
+	return computers, nil
+}
+
+// printADReport compares the devices found with the computer accounts of
+// the domain.
+func printADReport(computers []ad.Computer, devices []*device.Device, subnets []*net.IPNet) {
+	report := ad.Compare(computers, devices, subnets)
+
+	fmt.Println("\nActive Directory:")
+	fmt.Println("-----------------")
+	for _, c := range report.Offline {
+		desc := []string{c.Addresses[0].String()}
+		if c.DNSName != "" {
+			desc = append([]string{c.DNSName}, desc...)
+		}
+		line := fmt.Sprintf("  Offline: %s (%s)", c.Name, strings.Join(desc, ", "))
+		if c.OS != "" {
+			line += ", " + c.OS
+		}
+		if !c.LastLogon.IsZero() {
+			line += ", last logon " + timefmt.Format(c.LastLogon)
+		}
+		fmt.Println(line)
+	}
+	for _, d := range report.NoAccount {
+		name := d.Hostname()
+		if name == "" {
+			name = "(no hostname)"
+		}
+		fmt.Printf("  No account: %s (%s), %s\n", d.IP(), describeMAC(d), name)
+	}
+
+	summary := fmt.Sprintf("  %d of %s online", report.Online, count(len(computers), "computer account"))
+	var rest []string
+	if n := len(report.Offline); n > 0 {
+		rest = append(rest, fmt.Sprintf("%d offline", n))
+	}
+	if report.Elsewhere > 0 {
+		rest = append(rest, fmt.Sprintf("%d on other subnets", report.Elsewhere))
+	}
+	if report.Unresolved > 0 {
+		rest = append(rest, fmt.Sprintf("%d without a DNS address", report.Unresolved))
+	}
+	if report.Disabled > 0 {
+		rest = append(rest, fmt.Sprintf("%d disabled", report.Disabled))
+	}
+	if len(rest) > 0 {
+		summary += "; " + strings.Join(rest, ", ")
+	}
+	fmt.Println(summary)
+}
@@ -0,0 +1,431 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"pingdisco.com/pingdisco/internal/agent"
+	"pingdisco.com/pingdisco/internal/experiments"
+	"pingdisco.com/pingdisco/internal/inventory"
+	"pingdisco.com/pingdisco/internal/numfmt"
+	"pingdisco.com/pingdisco/internal/scanner"
+	"pingdisco.com/pingdisco/internal/targets"
+	"pingdisco.com/pingdisco/internal/telemetry"
+	"pingdisco.com/pingdisco/internal/timefmt"
+)
+
+// agentOptions are the flags of agent and agent enroll.
+type agentOptions struct {
+	server        *string
+	joinToken     *string
+	name          *string
+	state         *string
+	caFingerprint *string
+	otlpEndpoint  *string
+}
+
+// agentFlags declares the flags of agent and agent enroll.
+func agentFlags(fs *flag.FlagSet) agentOptions {
+	interfaceFlags(fs)
+	return agentOptions{
+		server:        fs.String("server", "", "URL of the pingdisco server"),
+		joinToken:     fs.String("join-token", os.Getenv("PINGDISCO_JOIN_TOKEN"), "join token used for the first registration"),
+		name:          fs.String("name", "", "agent name shown on the server (default: hostname)"),
+		state:         fs.String("state", defaultStatePath("agent.json"), "file holding the agent identity; certificates are kept next to it"),
+		caFingerprint: fs.String("ca-fingerprint", "", "SHA-256 fingerprint of the server CA, trusted on first contact over https"),
+		otlpEndpoint:  fs.String("otlp-endpoint", "", "export traces and metrics of each scan to this OpenTelemetry collector (default $OTEL_EXPORTER_OTLP_ENDPOINT)"),
+	}
+}
+
+func runAgent(args []string) {
+	enroll := len(args) > 0 && args[0] == "enroll"
+	if enroll {
+		args = args[1:]
+	}
+
+	fs := newFlagSet("agent")
+	opts := agentFlags(fs)
+	fs.Parse(args)
+
+	if *opts.server == "" {
+		fmt.Println("Error: --server is required")
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	a := &agent.Agent{
+		Client:        agent.NewClient(*opts.server),
+		JoinToken:     *opts.joinToken,
+		Name:          *opts.name,
+		Version:       version,
+		StatePath:     *opts.state,
+		CAFingerprint: *opts.caFingerprint,
+		Subnets:       localSubnets,
+		Scan:          tracedAgentScan(telemetry.FromEnv(*opts.otlpEndpoint, "pingdisco-agent", version)),
+		Logf:          log.Printf,
+	}
+
+	var err error
+	if enroll {
+		err = a.Enroll(ctx)
+	} else {
+		go watchInterfaces(ctx, a.Rescan)
+		err = a.Run(ctx)
+	}
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// agentsFlags declares the flags of agents.
+func agentsFlags(fs *flag.FlagSet) (server, adminToken, caCert *string) {
+	displayFlags(fs)
+	return adminFlags(fs)
+}
+
+func runAgents(args []string) {
+	if len(args) > 0 {
+		switch args[0] {
+		case "config":
+			runAgentsConfig(args[1:])
+			return
+		case "devices":
+			runAgentsDevices(args[1:])
+			return
+		case "asymmetry":
+			runAgentsAsymmetry(args[1:])
+			return
+		}
+	}
+
+	fs := newFlagSet("agents")
+	server, adminToken, caCert := agentsFlags(fs)
+	fs.Parse(args)
+
+	agents, err := adminClient(*server, *caCert).ListAgents(context.Background(), *adminToken)
+	if err != nil {
+		fmt.Printf("Error listing agents: %v\n", err)
+		os.Exit(1)
+	}
+
+	if len(agents) == 0 {
+		fmt.Println("No agents registered")
+		return
+	}
+
+	now := time.Now()
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tID\tVERSION\tSTATUS\tLAST CONTACT\tDEVICES\tSUBNETS")
+	for _, a := range agents {
+		status := "offline"
+		if a.Online(now, agent.DefaultHeartbeatInterval) {
+			status = "online"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s (%s ago)\t%d\t%v\n",
+			a.Name, a.ID, a.Version, status, timefmt.Format(a.LastSeen), now.Sub(a.LastSeen).Round(time.Second), a.Devices, a.Subnets)
+	}
+	tw.Flush()
+}
+
+// agentsConfigOptions are the flags of agents config.
+type agentsConfigOptions struct {
+	server        *string
+	adminToken    *string
+	caCert        *string
+	interval      *time.Duration
+	targets       *string
+	timeout       *time.Duration
+	count         *int
+	downAfter     *int
+	upAfter       *int
+	spread        *bool
+	inventoryPath *string
+	experimental  *string
+}
+
+// agentsConfigFlags declares the flags of agents config.
+func agentsConfigFlags(fs *flag.FlagSet) agentsConfigOptions {
+	opts := agentsConfigOptions{
+		interval:      fs.Duration("scan-interval", 0, "time between scheduled scans (0 disables them)"),
+		targets:       fs.String("targets", "", "comma-separated CIDRs to scan (empty: the agent's own subnets)"),
+		timeout:       fs.Duration("probe-timeout", 0, "per-probe timeout"),
+		count:         fs.Int("probe-count", 0, "probes sent to each host"),
+		downAfter:     fs.Int("down-after", 0, "consecutive scans a device must be missing before it is removed"),
+		upAfter:       fs.Int("up-after", 0, "consecutive scans a removed device must answer before it is added back"),
+		spread:        fs.Bool("spread", false, "spread the probes of each scan evenly across the scan interval instead of sending them in a burst"),
+		inventoryPath: fs.String("inventory", "", "inventory file whose per-device probe overrides are pushed to the agent"),
+		experimental:  fs.String("experimental", "", "comma-separated experimental discovery methods the agent enables, or all"),
+	}
+	opts.server, opts.adminToken, opts.caCert = adminFlags(fs)
+	return opts
+}
+
+func runAgentsConfig(args []string) {
+	fs := newFlagSet("agents config")
+	opts := agentsConfigFlags(fs)
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	target := fs.Arg(0)
+
+	ctx := context.Background()
+	client := adminClient(*opts.server, *opts.caCert)
+
+	cfg, err := client.GetConfig(ctx, *opts.adminToken, target)
+	if err != nil {
+		fmt.Printf("Error fetching configuration: %v\n", err)
+		os.Exit(1)
+	}
+
+	changed := false
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "scan-interval":
+			cfg.ScanInterval = *opts.interval
+		case "targets":
+			cfg.Targets = splitList(*opts.targets)
+		case "probe-timeout":
+			cfg.Probe.Timeout = *opts.timeout
+		case "probe-count":
+			cfg.Probe.Count = *opts.count
+		case "down-after":
+			cfg.Probe.DownAfter = *opts.downAfter
+		case "up-after":
+			cfg.Probe.UpAfter = *opts.upAfter
+		case "spread":
+			cfg.Probe.Spread = *opts.spread
+		case "experimental":
+			cfg.Experiments = parseExperiments(*opts.experimental).Names()
+		case "inventory":
+			inv, err := inventory.Load(*opts.inventoryPath)
+			if err != nil {
+				fmt.Printf("Error loading inventory: %v\n", err)
+				os.Exit(1)
+			}
+			cfg.Devices = cfg.Devices[:0]
+			for _, d := range inv.Sorted() {
+				cfg.Devices = append(cfg.Devices, *d)
+			}
+		default:
+			return
+		}
+		changed = true
+	})
+
+	if changed {
+		cfg, err = client.PutConfig(ctx, *opts.adminToken, target, cfg)
+		if err != nil {
+			fmt.Printf("Error updating configuration: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	fmt.Printf("Configuration for %s (version %d):\n", target, cfg.Version)
+	fmt.Printf("  Scan interval: %s\n", cfg.ScanInterval)
+	fmt.Printf("  Targets:       %v\n", cfg.Targets)
+	fmt.Printf("  Probe timeout: %s\n", cfg.Probe.Timeout)
+	fmt.Printf("  Probe count:   %d\n", cfg.Probe.Count)
+	fmt.Printf("  Down after:    %d\n", max(cfg.Probe.DownAfter, 1))
+	fmt.Printf("  Up after:      %d\n", max(cfg.Probe.UpAfter, 1))
+	fmt.Printf("  Spread probes: %v\n", cfg.Probe.Spread)
+	fmt.Printf("  Overrides:     %d devices\n", len(cfg.Devices))
+	fmt.Printf("  Experimental:  %v\n", cfg.Experiments)
+}
+
+func runAgentsDevices(args []string) {
+	fs := newFlagSet("agents devices")
+	server, adminToken, caCert := adminFlags(fs)
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	devices, err := adminClient(*server, *caCert).Devices(context.Background(), *adminToken, fs.Arg(0))
+	if err != nil {
+		fmt.Printf("Error fetching devices: %v\n", err)
+		os.Exit(1)
+	}
+
+	for _, d := range devices {
+		hostname := d.Hostname
+		if hostname == "" {
+			hostname = "(no hostname)"
+		}
+		fmt.Printf("  %-15s - %s\n", d.IP, hostname)
+	}
+	fmt.Printf("\nTotal devices: %d\n", len(devices))
+}
+
+func runAgentsAsymmetry(args []string) {
+	fs := newFlagSet("agents asymmetry")
+	server, adminToken, caCert := adminFlags(fs)
+	fs.Parse(args)
+
+	result, err := adminClient(*server, *caCert).Asymmetries(context.Background(), *adminToken)
+	if err != nil {
+		fmt.Printf("Error comparing agents: %v\n", err)
+		os.Exit(1)
+	}
+
+	if len(result) == 0 {
+		fmt.Println("All agents with overlapping coverage see the same devices")
+		return
+	}
+
+	fmt.Println("Devices reachable from only some vantage points:")
+	fmt.Println("------------------------------------------------")
+	for _, a := range result {
+		name := a.Hostname
+		if name == "" {
+			name = "(no hostname)"
+		}
+		fmt.Printf("  %-15s - %s\n", a.IP, name)
+		fmt.Printf("      reachable from:   %s\n", strings.Join(a.ReachableFrom, ", "))
+		fmt.Printf("      unreachable from: %s\n", strings.Join(a.UnreachableFrom, ", "))
+	}
+	fmt.Println("\nAsymmetries usually mean VLAN ACLs, firewall rules or Wi-Fi client isolation.")
+}
+
+func adminFlags(fs *flag.FlagSet) (server, adminToken, caCert *string) {
+	server = fs.String("server", "http://localhost:7450", "URL of the pingdisco server")
+	adminToken = fs.String("admin-token", os.Getenv("PINGDISCO_ADMIN_TOKEN"), "server admin token, given to serve with --admin-token")
+	caCert = fs.String("ca-cert", "", "CA certificate to verify an https server with")
+	return server, adminToken, caCert
+}
+
+func adminClient(server, caCert string) *agent.Client {
+	client := agent.NewClient(server)
+	if caCert != "" {
+		if err := client.TrustCA(caCert); err != nil {
+			fmt.Printf("Error loading CA certificate: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	return client
+}
+
+// tracedAgentScan returns agentScan recording into tracer, which is
+// flushed after every scan.
+func tracedAgentScan(tracer *telemetry.Tracer) func(context.Context, agent.Config) ([]agent.Device, error) {
+	return func(ctx context.Context, cfg agent.Config) ([]agent.Device, error) {
+		ctx, span := tracer.Start(ctx, "scan")
+		devices, err := agentScan(ctx, cfg, tracer)
+		span.SetAttr("devices", len(devices))
+		span.Fail(err)
+		span.End()
+		if err := tracer.Flush(ctx); err != nil {
+			log.Printf("exporting telemetry: %v", err)
+		}
+		return devices, err
+	}
+}
+
+func agentScan(ctx context.Context, cfg agent.Config, tracer *telemetry.Tracer) ([]agent.Device, error) {
+	var source targets.Source = targets.CIDRs(cfg.Targets)
+	if len(cfg.Targets) == 0 {
+		interfaces, err := getNetworkInterfaces()
+		if err != nil {
+			return nil, err
+		}
+		source = interfaceSource(interfaces)
+	}
+
+	probe := scanner.DefaultProbe
+	if cfg.Probe.Timeout > 0 {
+		probe.Timeout = cfg.Probe.Timeout
+	}
+	if cfg.Probe.Count > 0 {
+		probe.Count = cfg.Probe.Count
+	}
+
+	inv := inventory.New()
+	for i := range cfg.Devices {
+		inv.Put(&cfg.Devices[i])
+	}
+	sc := &scanner.Scanner{Probe: probe, Inventory: inv, Tracer: tracer, Experiments: experiments.New(cfg.Experiments...)}
+	if cfg.Probe.Spread {
+		sc.Spread = spreadWindow(cfg.ScanInterval)
+	}
+
+	found, err := sc.Run(ctx, source)
+	if err != nil {
+		return nil, err
+	}
+
+	devices := make([]agent.Device, 0, len(found))
+	for _, d := range found {
+		devices = append(devices, agent.Device{
+			IP:       d.IP().String(),
+			Hostname: d.Hostname(),
+			Online:   d.Online,
+		})
+	}
+
+	return devices, nil
+}
+
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func localSubnets() []string {
+	interfaces, err := getNetworkInterfaces()
+	if err != nil {
+		return nil
+	}
+
+	subnets := make([]string, 0, len(interfaces))
+	for _, iface := range interfaces {
+		network := &net.IPNet{IP: iface.IP.Mask(iface.IPNet.Mask), Mask: iface.IPNet.Mask}
+		subnets = append(subnets, network.String())
+	}
+	return subnets
+}
+
+func defaultStatePath(name string) string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return name
+	}
+	return filepath.Join(dir, "pingdisco", name)
+}
+
+// displayFlags adds --tz, --rtt-unit and --number-format: the zone
+// timestamps are printed in, the unit of round-trip times and the locale
+// of other numbers.
+func displayFlags(fs *flag.FlagSet) {
+	fs.Func("tz", "time `zone` to print timestamps in: local, UTC or a name such as Europe/Berlin (default $PINGDISCO_TZ or local)", timefmt.SetZone)
+	fs.Func("rtt-unit", "`unit` to print round-trip times in: ms or us (default $PINGDISCO_RTT_UNIT or ms)", numfmt.SetRTTUnit)
+	fs.Func("number-format", "`locale` to group digits and mark decimals for: plain, auto (from $LANG) or a language such as en, de or fr_CH (default $PINGDISCO_NUMBER_FORMAT or plain)", numfmt.SetNumberFormat)
+}
+
+func envOr(name, fallback string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return fallback
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"pingdisco.com/pingdisco/internal/device"
+	"pingdisco.com/pingdisco/internal/hysteresis"
+	"pingdisco.com/pingdisco/internal/maintenance"
+	"pingdisco.com/pingdisco/internal/notify"
+	"pingdisco.com/pingdisco/internal/store"
+	"pingdisco.com/pingdisco/internal/timeline"
+)
+
+// notifyOptions are the notifier flags shared by watch and scan --watch.
+type notifyOptions struct {
+	webhook, format, command, config *string
+}
+
+func notifyFlags(fs *flag.FlagSet) *notifyOptions {
+	return &notifyOptions{
+		webhook: fs.String("notify-webhook", "", "URL to POST every state change to, as a JSON event or in --notify-format"),
+		format:  fs.String("notify-format", notify.FormatJSON, "message format of --notify-webhook: "+strings.Join(notify.Formats, ", ")),
+		command: fs.String("notify-exec", "", "shell command to run on every state change"),
+		config:  fs.String("notify-config", "", "JSON file of notifiers with quiet hours, rate limits and digests"),
+	}
+}
+
+// build creates the notifiers the flags describe.
+func (o *notifyOptions) build() (notify.Multi, error) {
+	var notifiers notify.Multi
+	if *o.webhook != "" {
+		if err := notify.CheckFormat(*o.format); err != nil {
+			return nil, err
+		}
+		notifiers = append(notifiers, &notify.Webhook{URL: *o.webhook, Format: *o.format})
+	}
+	if *o.command != "" {
+		notifiers = append(notifiers, &notify.Command{Command: *o.command})
+	}
+	if *o.config != "" {
+		cfgs, err := notify.LoadConfig(*o.config)
+		if err != nil {
+			return nil, err
+		}
+		for _, cfg := range cfgs {
+			n, err := cfg.Build(func(err error) { log.Printf("notification failed: %v", err) })
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", *o.config, err)
+			}
+			notifiers = append(notifiers, n)
+		}
+	}
+	return notifiers, nil
+}
+
+// scanAlerts notifies about the scans of scan --watch: devices joining the
+// network for the first time, coming online, going offline, and addresses
+// taken over by another MAC address, followed by the diff of the scan as a
+// whole. Devices coming online and going offline are debounced the way
+// watch debounces hosts, and not alerted during maintenance windows.
+type scanAlerts struct {
+	notifiers notify.Multi
+	known     *knownDevices
+	tracker   timeline.Tracker
+	// previous holds when the latest scan of each network, by SSID,
+	// started.
+	previous map[string]time.Time
+	// hysteresis debounces the state of each device, keyed by SSID and
+	// device ID, over consecutive scans.
+	hysteresis hysteresis.Tracker
+	// missing holds the devices of each network that left and have been
+	// missing from every scan covering them since, until they are
+	// declared offline or come back.
+	missing map[string]map[string]*device.Device
+	// schedule holds the maintenance windows during which no device is
+	// alerted as coming online or going offline.
+	schedule maintenance.Schedule
+	// diagnose returns the probable cause of a device going offline, or
+	// ""; nil leaves it out.
+	diagnose func(ctx context.Context, d *device.Device) string
+
+	// queue holds the alerts of each scan until deliver sends them; done
+	// is closed once it has sent the last.
+	queue chan []pendingAlert
+	done  chan struct{}
+}
+
+// newScanAlerts returns scanAlerts sending to notifiers as scans come in.
+// Call close once the last scan has been added.
+func newScanAlerts(notifiers notify.Multi, known *knownDevices) *scanAlerts {
+	a := &scanAlerts{notifiers: notifiers, known: known, queue: make(chan []pendingAlert, 16), done: make(chan struct{})}
+	go a.deliver()
+	return a
+}
+
+// deliver sends the alerts of each scan in the order of the scans, without
+// holding up the next one. Its context is not cancelled by Ctrl-C, so the
+// alerts of the last scan still go out.
+func (a *scanAlerts) deliver() {
+	defer close(a.done)
+	ctx := context.Background()
+	for evs := range a.queue {
+		for _, s := range evs {
+			if s.ev.Type == notify.DeviceOffline && a.diagnose != nil {
+				if hint := a.diagnose(ctx, s.device); hint != "" {
+					s.ev.Message += ", probable cause: " + hint
+				}
+			}
+			if err := a.notifiers.Notify(ctx, s.ev); err != nil {
+				log.Printf("notification failed: %v", err)
+			}
+		}
+	}
+}
+
+// close sends the alerts still queued and closes the notifiers, delivering
+// what they hold back.
+func (a *scanAlerts) close() {
+	close(a.queue)
+	<-a.done
+	closeNotifiers(a.notifiers)
+}
+
+// pendingAlert is an event and the device it is about, if any, to
+// diagnose before sending it if the device went offline.
+type pendingAlert struct {
+	ev     notify.Event
+	device *device.Device
+}
+
+// update compares scan with the scans before it and sends the events.
+func (a *scanAlerts) update(scan store.Scan) {
+	f := a.tracker.Add(scan)
+	from, ok := a.previous[scan.SSID]
+	if a.previous == nil {
+		a.previous = make(map[string]time.Time)
+		a.missing = make(map[string]map[string]*device.Device)
+	}
+	a.previous[scan.SSID] = scan.StartedAt
+	joined := a.known.add(scan.SSID, scan.Devices)
+	if len(joined) > 0 {
+		if err := a.known.save(); err != nil {
+			log.Printf("saving known devices: %v", err)
+		}
+	}
+
+	var evs []pendingAlert
+	isNew := make(map[string]bool, len(joined))
+	for _, d := range joined {
+		isNew[d.ID()] = true
+		evs = append(evs, pendingAlert{deviceEvent(notify.DeviceNew, d, describeNewDevice(d), f), d})
+	}
+
+	missing := a.missing[scan.SSID]
+	if missing == nil {
+		missing = make(map[string]*device.Device)
+		a.missing[scan.SSID] = missing
+	}
+	conflicts := addressConflicts(f.Changes)
+	for _, c := range f.Changes {
+		if _, ok := conflicts[c.Device]; ok {
+			continue
+		}
+		switch c.Kind {
+		case timeline.Appeared:
+			// Known from an earlier run but not seen in this one yet: it starts
+			// out offline, so that it comes online after --up-after scans.
+			if !isNew[c.Device.ID()] {
+				a.hysteresis.Observe(scan.SSID+"/"+c.Device.ID(), false)
+			}
+		case timeline.Left:
+			missing[c.Device.ID()] = c.Device
+		}
+	}
+
+	var changed []pendingAlert
+	for _, d := range scan.Devices {
+		delete(missing, d.ID())
+		up, ok := a.hysteresis.Observe(scan.SSID+"/"+d.ID(), true)
+		if _, conflict := conflicts[d]; ok && up && !conflict {
+			changed = append(changed, pendingAlert{deviceEvent(notify.DeviceOnline, d, describeAlerted(d)+" is online", f), d})
+		}
+	}
+	for id, d := range missing {
+		if !timeline.Covers(scan.Targets, d.IP()) {
+			continue
+		}
+		if up, ok := a.hysteresis.Observe(scan.SSID+"/"+id, false); ok && !up {
+			delete(missing, id)
+			changed = append(changed, pendingAlert{deviceEvent(notify.DeviceOffline, d, describeAlerted(d)+" went offline", f), d})
+		}
+	}
+	sort.Slice(changed, func(i, j int) bool {
+		return bytes.Compare(changed[i].device.IP(), changed[j].device.IP()) < 0
+	})
+	for _, s := range changed {
+		var names []string
+		if name := s.device.Hostname(); name != "" {
+			names = append(names, name)
+		}
+		if a.schedule.Match(s.device.IP(), names, f.At) != nil {
+			// Planned work: the scan diff still records it.
+			continue
+		}
+		evs = append(evs, s)
+	}
+
+	var replaced []*device.Device
+	for d, prev := range conflicts {
+		if prev != nil {
+			replaced = append(replaced, d)
+		}
+	}
+	sort.Slice(replaced, func(i, j int) bool {
+		return bytes.Compare(replaced[i].IP(), replaced[j].IP()) < 0
+	})
+	for _, d := range replaced {
+		prev := conflicts[d]
+		msg := fmt.Sprintf("Address conflict: %s now answers from MAC %s, not %s", describeAlerted(d), d.MAC, prev.MAC)
+		if name := prev.Hostname(); name != "" && name != d.Hostname() {
+			msg += " (" + name + ")"
+		}
+		ev := deviceEvent(notify.AddressConflict, d, msg, f)
+		ev.Previous = alertDevice(prev)
+		evs = append(evs, pendingAlert{ev, d})
+	}
+	if ok && len(f.Changes) > 0 {
+		evs = append(evs, pendingAlert{ev: notify.Event{
+			Type:    notify.ScanChanged,
+			Time:    f.At,
+			Message: "Network changed: " + summarizeChanges(f.Changes),
+			Diff:    newDiff(store.Scan{StartedAt: from}, scan, f.Changes),
+		}})
+	}
+	if len(evs) > 0 {
+		a.queue <- evs
+	}
+}
+
+// addressConflicts pairs the devices found at the address of a device with
+// another MAC address that left in the same frame with that device. Both
+// are keys, so their online and offline events can be left out; the one
+// that left maps to nil.
+func addressConflicts(changes []timeline.Change) map[*device.Device]*device.Device {
+	left := make(map[string]*device.Device)
+	for _, c := range changes {
+		if c.Kind == timeline.Left && c.Device.MAC != nil {
+			left[c.Device.IP().String()] = c.Device
+		}
+	}
+	conflicts := make(map[*device.Device]*device.Device)
+	for _, c := range changes {
+		if c.Kind == timeline.Left || c.Device.MAC == nil {
+			continue
+		}
+		prev := left[c.Device.IP().String()]
+		if prev == nil || prev.MAC.String() == c.Device.MAC.String() {
+			continue
+		}
+		conflicts[c.Device] = prev
+		conflicts[prev] = nil
+	}
+	return conflicts
+}
+
+func deviceEvent(typ string, d *device.Device, msg string, f timeline.Frame) notify.Event {
+	return notify.Event{Type: typ, Host: d.IP().String(), Time: f.At, Message: msg, Device: alertDevice(d)}
+}
+
+func alertDevice(d *device.Device) *notify.Device {
+	nd := &notify.Device{IP: d.IP().String(), Hostname: d.Hostname()}
+	if d.MAC != nil {
+		nd.MAC = d.MAC.String()
+	}
+	return nd
+}
+
+// newDiff describes the changes from scan from to scan to for webhooks and
+// the API.
+func newDiff(from, to store.Scan, changes []timeline.Change) *notify.Diff {
+	diff := &notify.Diff{
+		From:    notify.DiffScan{ID: from.ID, StartedAt: from.StartedAt},
+		To:      notify.DiffScan{ID: to.ID, StartedAt: to.StartedAt},
+		Changes: make([]notify.Change, 0, len(changes)),
+	}
+	for _, c := range changes {
+		nc := notify.Change{Kind: c.Kind, Device: alertDevice(c.Device), PreviousHostname: c.FromName}
+		if c.From != nil {
+			nc.PreviousIP = c.From.String()
+		}
+		if c.FromMAC != nil {
+			nc.PreviousMAC = c.FromMAC.String()
+		}
+		diff.Changes = append(diff.Changes, nc)
+	}
+	return diff
+}
+
+// describeAlerted names d in a notification, e.g. "192.168.1.40 (nas.lan)".
+func describeAlerted(d *device.Device) string {
+	if name := d.Hostname(); name != "" {
+		return d.IP().String() + " (" + name + ")"
+	}
+	return d.IP().String()
+}
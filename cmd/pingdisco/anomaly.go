@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"pingdisco.com/pingdisco/internal/anomaly"
+	"pingdisco.com/pingdisco/internal/inventory"
+	"pingdisco.com/pingdisco/internal/netops"
+	"pingdisco.com/pingdisco/internal/scanner"
+	"pingdisco.com/pingdisco/internal/timefmt"
+)
+
+// sweepAnomalies scans the local subnets every interval until ctx is done
+// and passes what det finds unusual in each sweep to report. A sweep also
+// runs as soon as an interface comes or goes. With spread,
+// the probes of each sweep are spread across the interval. The detector
+// state is saved after every sweep, so what it learnt survives restarts.
+// Hours of the day are those of the --tz zone.
+func sweepAnomalies(ctx context.Context, interval time.Duration, spread bool, ops *netops.Ops, inv func() *inventory.Inventory, det *anomaly.Detector, report func(anomaly.Anomaly)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	changed := interfaceChanges(ctx)
+
+	for {
+		interfaces, err := getNetworkInterfaces()
+		if err != nil {
+			log.Printf("sweep: %v", err)
+		} else {
+			sc := &scanner.Scanner{Probe: scanner.DefaultProbe, Inventory: inv(), Ops: ops}
+			if spread {
+				sc.Spread = spreadWindow(interval)
+			}
+			devices, err := sc.Run(ctx, interfaceSource(interfaces))
+			switch {
+			case ctx.Err() != nil:
+				return
+			case err != nil:
+				log.Printf("sweep: %v", err)
+			default:
+				for _, a := range det.Observe(time.Now().In(timefmt.Zone()), devices) {
+					report(a)
+				}
+				if err := det.Save(); err != nil {
+					log.Printf("saving anomaly baseline: %v", err)
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-changed:
+			ticker.Reset(interval)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"pingdisco.com/pingdisco/internal/store"
+	"pingdisco.com/pingdisco/internal/timefmt"
+	"pingdisco.com/pingdisco/internal/timeline"
+)
+
+// baselineCommandOptions are the flags of baseline show and baseline save.
+type baselineCommandOptions struct {
+	path *string
+	prof *string
+	// url is only set for save.
+	url *string
+}
+
+// baselineCommandFlags declares the flags of baseline sub.
+func baselineCommandFlags(fs *flag.FlagSet, sub string) baselineCommandOptions {
+	displayFlags(fs)
+	iconsFlag(fs)
+	opts := baselineCommandOptions{
+		path: baselineFlag(fs),
+		prof: profileFlag(fs),
+	}
+	if sub == "save" {
+		opts.url = fs.String("store", defaultStore(), "store holding saved scans, e.g. sqlite:scans.db or bolt:scans.bolt")
+	}
+	return opts
+}
+
+// runBaseline keeps a saved scan as the baseline diff compares later scans
+// with: the devices that belong on the network.
+func runBaseline(args []string) {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		args = append([]string{"show"}, args...)
+	}
+	if args[0] != "show" && args[0] != "save" {
+		fmt.Printf("Error: unknown baseline command %q; use show or save\n", args[0])
+		os.Exit(2)
+	}
+
+	fs := newFlagSet("baseline " + args[0])
+	opts := baselineCommandFlags(fs, args[0])
+	fs.Parse(args[1:])
+	selectProfile(fs, *opts.prof)
+
+	if args[0] == "show" {
+		base, err := loadBaseline(*opts.path)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Baseline: scan %d, %s, %s\n", base.ID, timefmt.Format(base.StartedAt), count(len(base.Devices), "device"))
+		if base.SSID != "" {
+			fmt.Printf("Wi-Fi: %s\n", describeWiFi(base.SSID, base.BSSID))
+		}
+		displayDevices(base.Devices)
+		return
+	}
+
+	if fs.NArg() > 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	st, err := store.Open(*opts.url)
+	if err != nil {
+		fmt.Printf("Error opening store: %v\n", err)
+		os.Exit(1)
+	}
+	defer st.Close()
+
+	scan, err := loadScan(context.Background(), st, fs.Arg(0))
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := saveBaseline(*opts.path, scan); err != nil {
+		fmt.Printf("Error saving baseline: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Baseline set to scan %d, %s, with %s, in %s\n", scan.ID, timefmt.Format(scan.StartedAt), count(len(scan.Devices), "device"), *opts.path)
+}
+
+// diffOptions are the flags of diff.
+type diffOptions struct {
+	url  *string
+	path *string
+	prof *string
+}
+
+// diffFlags declares the flags of diff.
+func diffFlags(fs *flag.FlagSet) diffOptions {
+	displayFlags(fs)
+	iconsFlag(fs)
+	return diffOptions{
+		url:  fs.String("store", defaultStore(), "store holding saved scans, e.g. sqlite:scans.db or bolt:scans.bolt"),
+		path: baselineFlag(fs),
+		prof: profileFlag(fs),
+	}
+}
+
+// runDiff compares a saved scan with the baseline, or two saved scans
+// with each other, and exits with status 1 if they differ.
+func runDiff(args []string) {
+	fs := newFlagSet("diff")
+	opts := diffFlags(fs)
+	fs.Parse(args)
+	selectProfile(fs, *opts.prof)
+
+	if fs.NArg() > 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	st, err := store.Open(*opts.url)
+	if err != nil {
+		fmt.Printf("Error opening store: %v\n", err)
+		os.Exit(1)
+	}
+	defer st.Close()
+	ctx := context.Background()
+
+	var base store.Scan
+	baseName := "the baseline"
+	if fs.NArg() == 2 {
+		base, err = loadScan(ctx, st, fs.Arg(0))
+		baseName = fmt.Sprintf("scan %d", base.ID)
+	} else {
+		base, err = loadBaseline(*opts.path)
+	}
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	id := ""
+	if fs.NArg() > 0 {
+		id = fs.Arg(fs.NArg() - 1)
+	}
+	scan, err := loadScan(ctx, st, id)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if base.SSID != scan.SSID {
+		fmt.Printf("Warning: %s was taken on %s, scan %d on %s\n", baseName, describeNetwork(base.SSID), scan.ID, describeNetwork(scan.SSID))
+	}
+	changes := timeline.Compare(base, scan)
+	fmt.Printf("Scan %d, %s, against %s, %s:\n", scan.ID, timefmt.Format(scan.StartedAt), baseName, timefmt.Format(base.StartedAt))
+	if len(changes) == 0 {
+		fmt.Println("  no differences")
+		return
+	}
+	for _, c := range changes {
+		fmt.Printf("  %s\n", formatChange(c))
+	}
+	fmt.Printf("\n%s\n", summarizeChanges(changes))
+	os.Exit(1)
+}
+
+// summarizeChanges counts changes by kind, e.g. "2 new, 1 missing".
+func summarizeChanges(changes []timeline.Change) string {
+	kinds := []struct{ kind, label string }{
+		{timeline.Appeared, "new"},
+		{timeline.Returned, "back"},
+		{timeline.Left, "missing"},
+		{timeline.Replaced, "with another MAC address"},
+		{timeline.Moved, "moved"},
+		{timeline.Renamed, "renamed"},
+	}
+	var parts []string
+	for _, k := range kinds {
+		n := 0
+		for _, c := range changes {
+			if c.Kind == k.kind {
+				n++
+			}
+		}
+		if n > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", n, k.label))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+func describeNetwork(ssid string) string {
+	if ssid == "" {
+		return "a wired network"
+	}
+	return ssid
+}
+
+// baselineFlag adds --baseline, the file keeping the baseline scan.
+func baselineFlag(fs *flag.FlagSet) *string {
+	return fs.String("baseline", defaultStatePath("baseline.json"), "file keeping the baseline scan diff compares with")
+}
+
+// loadBaseline reads the baseline scan kept at path.
+func loadBaseline(path string) (store.Scan, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store.Scan{}, errors.New("no baseline saved; save one with pingdisco baseline save")
+	}
+	if err != nil {
+		return store.Scan{}, err
+	}
+	var scan store.Scan
+	if err := json.Unmarshal(data, &scan); err != nil {
+		return store.Scan{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return scan, nil
+}
+
+// saveBaseline keeps scan at path, replacing the previous baseline.
+func saveBaseline(path string, scan store.Scan) error {
+	data, err := json.MarshalIndent(scan, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
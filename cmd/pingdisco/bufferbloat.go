@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"runtime"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"pingdisco.com/pingdisco/internal/netops"
+	"pingdisco.com/pingdisco/internal/numfmt"
+)
+
+const defaultLoadURL = "https://speed.cloudflare.com/__down?bytes=100000000"
+
+// bufferbloatOptions are the flags of bufferbloat.
+type bufferbloatOptions struct {
+	target   *string
+	loadURL  *string
+	streams  *int
+	duration *time.Duration
+}
+
+// bufferbloatFlags declares the flags of bufferbloat.
+func bufferbloatFlags(fs *flag.FlagSet) bufferbloatOptions {
+	return bufferbloatOptions{
+		target:   fs.String("target", "", "host to measure latency to (default: the gateway)"),
+		loadURL:  fs.String("load-url", defaultLoadURL, "URL downloaded repeatedly to generate load"),
+		streams:  fs.Int("streams", 4, "parallel downloads while loaded"),
+		duration: fs.Duration("duration", 10*time.Second, "length of each phase"),
+	}
+}
+
+// runBufferbloat compares the gateway round-trip time on an idle link with
+// the round-trip time while downloads saturate it. A large increase means
+// queues upstream are oversized, which is what makes a network "feel slow"
+// even when throughput is fine.
+func runBufferbloat(args []string) {
+	fs := newFlagSet("bufferbloat")
+	opts := bufferbloatFlags(fs)
+	fs.Parse(args)
+
+	host := *opts.target
+	if host == "" {
+		gw := defaultGateway()
+		if gw == nil {
+			fmt.Println("Error: no default gateway, pass --target")
+			os.Exit(1)
+		}
+		host = gw.String()
+	}
+
+	fmt.Printf("Measuring latency to %s, idle for %s...\n", host, *opts.duration)
+	idle := sampleRTT(host, *opts.duration)
+	if len(idle) == 0 {
+		fmt.Printf("Error: %s did not answer ping\n", host)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Measuring latency under load (%d downloads) for %s...\n", *opts.streams, *opts.duration)
+	ctx, cancel := context.WithCancel(context.Background())
+	var received atomic.Int64
+	var loadErr atomic.Value
+	var wg sync.WaitGroup
+	for i := 0; i < *opts.streams; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := generateLoad(ctx, *opts.loadURL, &received); err != nil {
+				loadErr.Store(err)
+			}
+		}()
+	}
+	start := time.Now()
+	loaded := sampleRTT(host, *opts.duration)
+	cancel()
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	fmt.Println()
+	fmt.Printf("  %-7s %8s %8s %8s\n", "", "median", "p95", "samples")
+	printRTT("idle", idle)
+	printRTT("loaded", loaded)
+
+	mbps := float64(received.Load()) * 8 / elapsed.Seconds() / 1e6
+	fmt.Printf("\nLoad throughput: %.1f Mbit/s\n", mbps)
+	if err, ok := loadErr.Load().(error); ok && received.Load() == 0 {
+		fmt.Printf("Warning: load generation failed: %v\n", err)
+		return
+	}
+	if len(loaded) == 0 {
+		fmt.Println("No replies under load: the link is saturated to the point of dropping every probe.")
+		return
+	}
+
+	increase := percentile(loaded, 50) - percentile(idle, 50)
+	fmt.Printf("Latency increase under load: %s (%s)\n", numfmt.RTT(increase), bloatGrade(increase))
+}
+
+func printRTT(label string, rtts []time.Duration) {
+	if len(rtts) == 0 {
+		fmt.Printf("  %-7s %8s %8s %8d\n", label, "-", "-", 0)
+		return
+	}
+	fmt.Printf("  %-7s %8s %8s %8s\n", label,
+		numfmt.RTT(percentile(rtts, 50)), numfmt.RTT(percentile(rtts, 95)), numfmt.Int(len(rtts)))
+}
+
+// bloatGrade follows the thresholds commonly used by bufferbloat tests.
+func bloatGrade(increase time.Duration) string {
+	switch {
+	case increase < 5*time.Millisecond:
+		return "A, no noticeable bufferbloat"
+	case increase < 30*time.Millisecond:
+		return "B, mild bufferbloat"
+	case increase < 60*time.Millisecond:
+		return "C, calls and games will suffer under load"
+	case increase < 200*time.Millisecond:
+		return "D, severe bufferbloat"
+	default:
+		return "F, the link is unusable for interactive traffic under load"
+	}
+}
+
+// sampleRTT pings host five times a second for d and returns the reply times.
+func sampleRTT(host string, d time.Duration) []time.Duration {
+	count := max(int(d/(200*time.Millisecond)), 1)
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("ping", "-n", strconv.Itoa(count), "-w", "1000", host)
+	} else {
+		deadline := strconv.FormatInt(int64(d/time.Second)+2, 10)
+		cmd = exec.Command("ping", "-c", strconv.Itoa(count), "-i", "0.2", "-w", deadline, host)
+	}
+	out, _ := cmd.Output()
+
+	var rtts []time.Duration
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		m := netops.ReplyTime.FindSubmatch(line)
+		if m == nil || bytes.Contains(line, []byte("DUP!")) {
+			continue
+		}
+		if ms, err := strconv.ParseFloat(string(m[1]), 64); err == nil {
+			rtts = append(rtts, time.Duration(ms*float64(time.Millisecond)))
+		}
+	}
+
+	return rtts
+}
+
+func percentile(rtts []time.Duration, p int) time.Duration {
+	sorted := append([]time.Duration(nil), rtts...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted[(len(sorted)-1)*p/100]
+}
+
+// generateLoad downloads url over and over until ctx is done, adding the
+// bytes received to total.
+func generateLoad(ctx context.Context, url string, total *atomic.Int64) error {
+	buf := make([]byte, 64<<10)
+	for ctx.Err() == nil {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		for {
+			n, err := resp.Body.Read(buf)
+			total.Add(int64(n))
+			if err != nil {
+				break
+			}
+		}
+		resp.Body.Close()
+	}
+	return nil
+}
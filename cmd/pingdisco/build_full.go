@@ -0,0 +1,39 @@
+//go:build !minimal
+
+package main
+
+import "flag"
+
+// buildFlavor names the feature set compiled in; see build_minimal.go.
+const buildFlavor = "full"
+
+func serverCommands() []*command {
+	return []*command{
+		{
+			name:    "serve",
+			aliases: []string{"server"},
+			summary: "run the central server for remote agents",
+			usage:   "[flags]",
+			description: "Accepts registrations from agents presenting the join token, pushes their configuration with each heartbeat " +
+				"and keeps the inventories they upload. With --tls-dir agents authenticate with client certificates.",
+			examples: []example{
+				{"", "pingdisco serve --listen :7450 --join-token s3cret"},
+				{"serve over mutual TLS", "pingdisco serve --tls-dir /etc/pingdisco/tls --join-token s3cret"},
+			},
+			flags: func(fs *flag.FlagSet) { serveFlags(fs) },
+			run:   runServer,
+			subcommands: []*command{
+				{
+					name:        "tls-init",
+					summary:     "create the server CA and certificate",
+					usage:       "[flags]",
+					description: "Creates the CA that issues agent certificates and a server certificate for the given names, and prints the CA fingerprint agents pin on first contact.",
+					examples: []example{
+						{"", "pingdisco serve tls-init --dir /etc/pingdisco/tls --hostname central.example.com"},
+					},
+					flags: func(fs *flag.FlagSet) { serveTLSInitFlags(fs) },
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,12 @@
+//go:build minimal
+
+package main
+
+// buildFlavor is "minimal" for the CLI-only build made with -tags minimal
+// for routers and other small devices: no agent server, no SQLite store
+// and no web UI (see web_minimal.go).
+const buildFlavor = "minimal"
+
+func serverCommands() []*command {
+	return nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os/exec"
+	"runtime"
+	"time"
+
+	"pingdisco.com/pingdisco/internal/netops"
+	"pingdisco.com/pingdisco/internal/scanner"
+)
+
+// capability is a probe method or data source a scan may or may not be
+// able to use on this system. Scans report them so that differences in
+// coverage between runs, say with and without root, can be explained.
+type capability struct {
+	name   string
+	ok     bool
+	detail string
+}
+
+// detectCapabilities checks what the scan can use before it starts.
+func detectCapabilities(ops *netops.Ops, snmpRouter string, external bool) []capability {
+	var caps []capability
+
+	native := ""
+	if p, ok := ops.Pinger.(*netops.ICMPPinger); ok {
+		native = p.Method()
+	}
+	path, lookErr := exec.LookPath("ping")
+	switch {
+	case native != "" && scanner.Ping(context.Background(), ops, "127.0.0.1", scanner.DefaultProbe):
+		caps = append(caps, capability{"icmp echo", true, "native, " + native})
+	case native != "":
+		caps = append(caps, capability{"icmp echo", false, "no reply from 127.0.0.1 over the " + native})
+	case lookErr != nil:
+		caps = append(caps, capability{"icmp echo", false, "no ICMP socket and no ping command; only devices with a TCP probe in the inventory are found"})
+	case !scanner.Ping(context.Background(), ops, "127.0.0.1", scanner.DefaultProbe):
+		caps = append(caps, capability{"icmp echo", false, path + " gets no reply from 127.0.0.1; it may need elevated privileges"})
+	default:
+		caps = append(caps, capability{"icmp echo", true, "using " + path})
+	}
+
+	if err := rawICMP(); err != nil {
+		caps = append(caps, capability{"raw sockets", false, err.Error()})
+	} else {
+		caps = append(caps, capability{"raw sockets", true, "privileged ICMP available"})
+	}
+
+	if neighbors, err := ops.Neighbors.Neighbors(); err != nil {
+		caps = append(caps, capability{"neighbor table", false, "unreadable, MAC addresses will be missing: " + err.Error()})
+	} else {
+		caps = append(caps, capability{"neighbor table", true, fmt.Sprintf("%d entries", len(neighbors))})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if _, err := ops.Resolver.LookupAddr(ctx, "127.0.0.1"); err != nil {
+		caps = append(caps, capability{"reverse dns", false, "lookups fail, hostnames will be missing"})
+	} else {
+		caps = append(caps, capability{"reverse dns", true, "system resolver"})
+	}
+
+	if snmpRouter == "" {
+		caps = append(caps, capability{"snmp", false, "not configured (--snmp-router)"})
+	} else {
+		caps = append(caps, capability{"snmp", true, "ARP and routing tables of " + snmpRouter})
+	}
+
+	if external {
+		caps = append(caps, capability{"external services", true, "public IP and ISP lookup"})
+	} else {
+		caps = append(caps, capability{"external services", false, "disabled by --no-external"})
+	}
+	return caps
+}
+
+// rawICMP reports why a raw ICMP socket cannot be opened, if it cannot.
+func rawICMP() error {
+	conn, err := net.ListenPacket("ip4:icmp", "0.0.0.0")
+	if err == nil {
+		conn.Close()
+		return nil
+	}
+
+	switch runtime.GOOS {
+	case "linux":
+		return fmt.Errorf("no CAP_NET_RAW; probing over unprivileged ICMP sockets or the ping command")
+	case "windows":
+		return fmt.Errorf("not running as administrator; probing through the ping command")
+	default:
+		return fmt.Errorf("not running as root; probing through the ping command")
+	}
+}
+
+func printCapabilities(caps []capability) {
+	fmt.Println("\nCapabilities used:")
+	fmt.Println("------------------")
+	for _, c := range caps {
+		status := "yes"
+		if !c.ok {
+			status = "no"
+		}
+		fmt.Printf("  %-3s %-18s %s\n", status, c.name, c.detail)
+	}
+}
@@ -0,0 +1,766 @@
+package main
+
+//go:generate go run -tags tray . __man ../../docs/man
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"text/tabwriter"
+)
+
+// command describes a pingdisco subcommand. Help output, shell completion
+// and the man pages are all generated from these definitions. Commands
+// parse their own flags from args, which excludes the command name.
+type command struct {
+	name    string
+	aliases []string
+	summary string
+	// usage is the synopsis after the command name, e.g. "[flags] <ip>".
+	usage       string
+	description string
+	examples    []example
+	// flags declares the flags of the command on fs. run declares its
+	// flags with the same function, and help, completion and the man
+	// pages call it on a flag set of their own. Nil if the command has
+	// none.
+	flags func(fs *flag.FlagSet)
+	run   func(args []string)
+	// subcommands are dispatched by run on the first argument; their run
+	// is nil.
+	subcommands []*command
+	// argValues are completed for the first argument.
+	argValues []string
+	hidden    bool
+}
+
+type example struct {
+	comment string
+	command string
+}
+
+// commands lists the subcommands in the order help shows them. Running
+// pingdisco without a command, or with flags only, runs scan.
+var commands []*command
+
+func init() {
+	commands = []*command{
+		{
+			name:    "scan",
+			summary: "discover devices on the local and routed subnets",
+			usage:   "[flags] [target...]",
+			description: "Detects the active network interfaces, pings every address of their subnets and lists the devices that answer " +
+				"with their reverse DNS name, inventory label and MAC address. Other private subnets in the routing table are listed " +
+				"afterwards and scanned too with --routed. Targets given as arguments or in --targets-file are scanned instead of the " +
+				"local subnets: subnets (10.0.0.0/24), ranges (192.168.1.10-50 or 192.168.1.10-192.168.2.20), addresses and host names. " +
+				"With --proxy, targets are probed over TCP through a SOCKS5 proxy or SSH jump host. With --watch, rescans and " +
+				"prints what changed, notifying about new devices, outages and address conflicts; with --tui, shows the devices " +
+				"in a live table to sort, filter and drill into. " +
+				"The command name can be left out before targets.",
+			examples: []example{
+				{"scan the subnets of all interfaces", "pingdisco"},
+				{"include routed subnets and save the result", "pingdisco scan --routed --store sqlite:scans.db"},
+				{"scan a remote subnet, a range and a host", "pingdisco 10.0.0.0/24 192.168.1.10-50 host.example.com"},
+				{"sweep a /16 without the progress line on stderr", "pingdisco scan --progress=false 10.0.0.0/16"},
+				{"scan the targets listed in a file", "pingdisco scan --targets-file branch-offices.txt"},
+				{"find the hosts of a remote subnet through an SSH jump host", "pingdisco scan --proxy ssh://admin@bastion 10.20.0.0/24"},
+				{"skip Docker bridges and VPN tunnels", "pingdisco scan --exclude-interface 'docker*,veth*,tun*'"},
+				{"seed hosts and subnets from the router's ARP and routing tables", "pingdisco scan --snmp-router 192.168.1.1"},
+				{"name switches and routers from their SNMP system group", "pingdisco scan --snmp --snmp-community monitoring"},
+				{"measure latency, jitter and loss to every host", "pingdisco scan --count 10"},
+				{"list the open ssh, web and remote desktop ports of every host", "pingdisco scan --ports 22,80,443,3389"},
+				{"rescan every minute and print what changed", "pingdisco scan --watch --interval 1m"},
+				{"post new devices, outages and address conflicts to Slack", "pingdisco scan --watch --notify-webhook https://hooks.slack.com/services/T000/B000/XXXX --notify-format slack"},
+				{"browse the devices in a live table, sorted and filtered from the keyboard", "pingdisco scan --tui"},
+				{"show the devices found on a live web dashboard", "pingdisco scan --serve :8080"},
+				{"export device up and latency metrics to Prometheus", "pingdisco scan --metrics-listen :9155"},
+				{"grade each device's connection quality as it changes", "pingdisco scan --watch --count 5"},
+				{"probe silent hosts more before calling them offline on busy Wi-Fi", "pingdisco scan --assumed-loss 30"},
+				{"give sleepy IoT devices longer and more chances to answer", "pingdisco scan --timeout 3s --retries 3 --probe-interval 2s"},
+				{"keep every probe and its outcome for two weeks of forensic review", "pingdisco scan --watch --probe-log ~/.local/state/pingdisco/probes"},
+				{"finish within 30 seconds, leaving out what does not fit", "pingdisco scan --deadline 30s --output json"},
+				{"look for duplicate and late echo replies", "pingdisco scan --echo-stats 5"},
+				{"also find phones and IoT devices that drop ping", "sudo pingdisco scan --arp"},
+				{"confirm each device by two signals and mark the rest", "sudo pingdisco scan --audit --arp"},
+				{"also find IPv6 hosts on each link", "pingdisco scan --ipv6"},
+				{"scan without asking Tailscale and ZeroTier for their peers", "pingdisco scan --overlay=false"},
+				{"find and identify UPnP TVs, media servers and routers", "pingdisco scan --ssdp"},
+				{"name the machines of a Windows domain without flooding its domain controller", "pingdisco scan --rdns-rate 20 10.10.0.0/16"},
+				{"list domain machines that are offline and devices without a computer account", "pingdisco scan --ad ldaps://dc01.corp.example --ad-user scanner@corp.example"},
+				{"show which gateways the devices of routed subnets sit behind", "sudo pingdisco scan --routed --topology"},
+				{"sweep slowly enough not to trip intrusion detection", "pingdisco scan --routed --rate 50"},
+				{"devices as JSON for jq", "pingdisco scan --output json | jq -r '.devices[].ip'"},
+				{"scan without keeping it in the history", "pingdisco scan --store \"\""},
+				{"save the scan with a note of what changed", "pingdisco scan --store sqlite:scans.db --note \"after switch firmware upgrade\""},
+			},
+			flags: func(fs *flag.FlagSet) { scanFlags(fs) },
+			run:   runScan,
+		},
+		{
+			name:    "watch",
+			aliases: []string{"presence"},
+			summary: "probe selected hosts continuously and notify on state changes",
+			usage:   "[flags] [host...]",
+			description: "Probes each host every --interval and reports when it goes offline or comes back, after --down-after missed " +
+				"or --up-after answered probes, with the probable cause of a host going offline. Service checks of known devices " +
+				"run on every cycle. Notifications go to webhooks, Slack, Discord, ntfy or commands, and are held back during " +
+				"maintenance windows. " +
+				"Edits to the hosts file, notifier configuration, maintenance windows and inventory are applied without a " +
+				"restart, also on SIGHUP. With --sweep, also scans the local subnets regularly, learns when devices are " +
+				"usually online and how many, and notifies about devices online at unusual hours, bursts of never-seen MAC addresses and device count spikes.",
+			examples: []example{
+				{"notify a webhook when the phone comes and goes", "pingdisco watch --notify-webhook https://hooks.example.com/pd phone.lan"},
+				{"push to an ntfy topic when the phone comes and goes", "pingdisco watch --notify-webhook https://ntfy.sh/my-lan-alerts --notify-format ntfy phone.lan"},
+				{"alert without guessing why a host went offline", "pingdisco watch --diagnose=false --notify-webhook https://hooks.example.com/pd nas.lan"},
+				{"log state changes through a command", "pingdisco watch --notify-exec 'logger \"$PINGDISCO_MESSAGE\"' garage.lan"},
+				{"report unusual activity on the whole network", "pingdisco watch --sweep 5m --notify-config notifiers.json"},
+			},
+			flags: func(fs *flag.FlagSet) { watchFlags(fs) },
+			run:   runPresence,
+		},
+	}
+	// The tray needs -tags tray, server features are left out of minimal
+	// builds.
+	commands = append(commands, trayCommands()...)
+	commands = append(commands, serverCommands()...)
+	commands = append(commands, []*command{
+		{
+			name:        "agent",
+			summary:     "scan a remote site and report to the central server",
+			usage:       "[flags]",
+			description: "Registers with the server once, then scans on the schedule the server sets and uploads the changes since its last acknowledged sync.",
+			examples: []example{
+				{"", "pingdisco agent --server http://central:7450 --join-token s3cret --name branch-office"},
+			},
+			flags: func(fs *flag.FlagSet) { agentFlags(fs) },
+			run:   runAgent,
+			subcommands: []*command{
+				{
+					name:        "enroll",
+					summary:     "obtain or rotate the agent's client certificate",
+					usage:       "[flags]",
+					description: "Registers with a TLS server, trusting its CA if the fingerprint matches, and stores the issued client certificate next to the agent state.",
+					examples: []example{
+						{"", "pingdisco agent enroll --server https://central.example.com:7450 --join-token s3cret --ca-fingerprint <fingerprint>"},
+					},
+					flags: func(fs *flag.FlagSet) { agentFlags(fs) },
+				},
+			},
+		},
+		{
+			name:        "agents",
+			summary:     "list and configure agents on the central server",
+			usage:       "[flags]",
+			description: "Lists the registered agents with their version, last contact and covered subnets.",
+			examples: []example{
+				{"", "pingdisco agents --server http://central:7450 --admin-token adm1n"},
+			},
+			flags: func(fs *flag.FlagSet) { agentsFlags(fs) },
+			run:   runAgents,
+			subcommands: []*command{
+				{
+					name:        "config",
+					summary:     "set the scan schedule, targets and probe settings of an agent",
+					usage:       "[flags] <agent|default>",
+					description: "Only the flags given are changed. The default configuration applies to agents without one of their own.",
+					examples: []example{
+						{"", "pingdisco agents config --admin-token adm1n --scan-interval 15m default"},
+						{"", "pingdisco agents config --admin-token adm1n --targets 10.1.0.0/24,10.1.1.0/24 branch-office"},
+						{"", "pingdisco agents config --admin-token adm1n --spread default"},
+					},
+					flags: func(fs *flag.FlagSet) { agentsConfigFlags(fs) },
+				},
+				{
+					name:    "devices",
+					summary: "list the inventory synced by an agent",
+					usage:   "[flags] <agent>",
+					flags:   func(fs *flag.FlagSet) { adminFlags(fs) },
+				},
+				{
+					name:        "asymmetry",
+					summary:     "list devices only some agents can reach",
+					usage:       "[flags]",
+					description: "Compares agents covering the same subnet. Devices seen by only some of them usually point at VLAN ACLs, firewall rules or Wi-Fi client isolation.",
+					flags:       func(fs *flag.FlagSet) { adminFlags(fs) },
+				},
+			},
+		},
+		{
+			name:    "remote",
+			summary: "scan from another host over SSH",
+			usage:   "--ssh [user@]host [flags]",
+			description: "Runs discovery on another machine, such as the router, and shows the results here. In agent mode this " +
+				"binary, or --binary, is copied to a temporary file on the remote host, run and deleted again; in shell mode the " +
+				"remote host's own ping (busybox on OpenWrt) and ARP table are used. Auto picks agent mode when the remote platform " +
+				"matches this binary. Nothing is left installed. Authentication is whatever ssh uses.",
+			examples: []example{
+				{"scan every VLAN of an OpenWrt router with its busybox tools", "pingdisco remote --ssh root@192.168.1.1"},
+				{"use a pingdisco binary built for the router", "pingdisco remote --ssh root@router --binary ./pingdisco-linux-mipsle"},
+				{"", "pingdisco remote --ssh admin@gw --ssh-option Port=2222 --targets 10.20.0.0/24"},
+			},
+			flags: func(fs *flag.FlagSet) { remoteFlags(fs) },
+			run:   runRemote,
+		},
+		{
+			name:    "history",
+			aliases: []string{"scans"},
+			summary: "list saved scans, show one or the history of a device",
+			usage:   "[export] [flags] [scan-id [device] | device]",
+			description: "Scans are saved to the history database in the configuration directory unless --store names another. " +
+				"With a device alone (IP address, MAC address or name), shows when it was first and last seen, the share of " +
+				"scans since that found it and at which hours of the day it is usually online. " +
+				"With a scan and a device, shows everything the scan learnt about it, including " +
+				"where its hostname, vendor, OS and type came from and how far each can be trusted. With --note, attaches a note " +
+				"to a saved scan, so changes in the results can be matched with what happened on the network.",
+			examples: []example{
+				{"", "pingdisco history"},
+				{"", "pingdisco history 12"},
+				{"", "pingdisco history 12 192.168.1.10"},
+				{"when the NAS is usually online", "pingdisco history nas.lan"},
+				{"", "pingdisco history --store sqlite:scans.db"},
+				{"note what happened before scan 12", "pingdisco history --store sqlite:scans.db --note \"replaced the access point\" 12"},
+			},
+			flags: func(fs *flag.FlagSet) { historyFlags(fs) },
+			run:   runScans,
+			subcommands: []*command{
+				{
+					name:    "export",
+					summary: "write the devices of every saved scan as CSV or JSON",
+					usage:   "[flags]",
+					description: "Writes one row per device and scan, oldest scan first, with whether the device was online and its " +
+						"round-trip time, so presence and latency can be analyzed over time in a spreadsheet or other tools. " +
+						"With --format json, writes the scans with their targets and notes instead.",
+					examples: []example{
+						{"the last week as CSV", "pingdisco history export --store sqlite:scans.db --since 7d > history.csv"},
+						{"every scan of one device", "pingdisco history export --store sqlite:scans.db --device nas --format json"},
+					},
+					flags: func(fs *flag.FlagSet) { historyExportFlags(fs) },
+				},
+			},
+		},
+		{
+			name:    "timeline",
+			summary: "play back saved scans to see how the network changed",
+			usage:   "[flags]",
+			description: "Steps through the saved scans, oldest first, and lists the devices that appeared for the first time, came " +
+				"back, left or moved to another address in each, with the notes attached to the scans. With --device, shows when " +
+				"one device was first seen and every stretch it was online. With --format html, writes a page with a slider over " +
+				"the snapshots. With --churn, sums up which devices changed address and how long addresses were kept, to spot " +
+				"short DHCP leases. Save scans regularly, e.g. hourly from cron, to have something to play back.",
+			examples: []example{
+				{"", "pingdisco timeline --store sqlite:scans.db --since 14d"},
+				{"when did this device first show up?", "pingdisco timeline --store sqlite:scans.db --device 3c:22:fb:12:34:56"},
+				{"", "pingdisco timeline --store sqlite:scans.db --format html > timeline.html"},
+				{"which devices keep changing address?", "pingdisco timeline --churn --since 7d"},
+			},
+			flags: func(fs *flag.FlagSet) { timelineFlags(fs) },
+			run:   runTimeline,
+		},
+		{
+			name:        "export",
+			summary:     "write a saved scan as JSON or an HTML report",
+			usage:       "[flags] [scan-id]",
+			description: "Writes the given scan, or the latest one, with its devices in the versioned JSON device format, or as an HTML page with an icon of each device's type.",
+			examples: []example{
+				{"", "pingdisco export --store sqlite:scans.db 12 > scan-12.json"},
+				{"", "pingdisco export --store sqlite:scans.db --format html > network.html"},
+			},
+			flags: func(fs *flag.FlagSet) { exportFlags(fs) },
+			run:   runExport,
+		},
+		{
+			name:    "baseline",
+			summary: "keep a saved scan as the devices that belong on the network",
+			usage:   "[show|save] [flags]",
+			description: "The baseline is the scan diff compares later scans with. It is kept per network profile, so a laptop " +
+				"has one for each network it visits.",
+			flags: func(fs *flag.FlagSet) { baselineCommandFlags(fs, "show") },
+			run:   runBaseline,
+			subcommands: []*command{
+				{name: "show", summary: "list the devices of the baseline", usage: "[flags]", flags: func(fs *flag.FlagSet) { baselineCommandFlags(fs, "show") }},
+				{
+					name:    "save",
+					summary: "make a saved scan the baseline",
+					usage:   "[flags] [scan-id]",
+					examples: []example{
+						{"make the latest scan the baseline", "pingdisco baseline save"},
+						{"", "pingdisco baseline save 12"},
+					},
+					flags: func(fs *flag.FlagSet) { baselineCommandFlags(fs, "save") },
+				},
+			},
+		},
+		{
+			name:    "diff",
+			summary: "compare a saved scan with the baseline or another scan",
+			usage:   "[flags] [scan-id | old-scan-id new-scan-id]",
+			description: "Lists the devices of the given or latest scan that are new (+), missing (-), answer at a known address " +
+				"with another MAC address (!), moved to another address (>) or answer under another hostname (~), compared " +
+				"with the baseline or, given two scans, the older one. Exits with status 1 if there are differences, so a " +
+				"scan from cron can alert about rogue devices.",
+			examples: []example{
+				{"", "pingdisco scan && pingdisco diff"},
+				{"", "pingdisco diff 12 40"},
+				{"mail the differences after each nightly scan", "pingdisco scan >/dev/null && pingdisco diff > changes.txt || mail -s 'network changed' admin < changes.txt"},
+			},
+			flags: func(fs *flag.FlagSet) { diffFlags(fs) },
+			run:   runDiff,
+		},
+		{
+			name:        "label",
+			summary:     "name a device in the inventory",
+			usage:       "[flags] <ip> <name>",
+			description: "The label is shown next to the device in scan results. An empty name removes it.",
+			examples: []example{
+				{"", "pingdisco label 192.168.1.10 nas"},
+				{"remove the label", "pingdisco label 192.168.1.10 ''"},
+			},
+			flags: func(fs *flag.FlagSet) { labelFlags(fs) },
+			run:   runLabel,
+		},
+		{
+			name:    "open",
+			summary: "list or open ssh, web and remote desktop shortcuts to a device",
+			usage:   "[flags] <host> [ssh|http|https|rdp]",
+			description: "Tries the ssh, http, https and rdp ports of the host and lists a URL for each that answers. With a shortcut name, " +
+				"opens it with the program registered for the scheme: the browser, a terminal or the remote desktop client.",
+			examples: []example{
+				{"", "pingdisco open 192.168.1.10"},
+				{"open the web interface of the printer", "pingdisco open printer.lan http"},
+			},
+			flags: func(fs *flag.FlagSet) { openFlags(fs) },
+			run:   runOpen,
+		},
+		{
+			name:    "wake",
+			summary: "wake sleeping hosts with Wake-on-LAN",
+			usage:   "[flags] <mac|host>...",
+			description: "Broadcasts a Wake-on-LAN magic packet for each host. A host given by name or address is woken at the MAC " +
+				"address the inventory or the latest saved scan that saw it has for it, on the broadcast address of the local subnet " +
+				"it was last seen on. With --wait, pings each host until it answers.",
+			examples: []example{
+				{"", "pingdisco wake 3c:7c:3f:1e:22:9a"},
+				{"wake the NAS at the MAC address learnt by earlier scans and wait until it is up", "pingdisco wake --wait 2m nas.lan"},
+				{"wake a host on another subnet through a router forwarding directed broadcasts", "pingdisco wake --broadcast 192.168.20.255 desktop.lan"},
+			},
+			flags: func(fs *flag.FlagSet) { wakeFlags(fs) },
+			run:   runWake,
+		},
+		{
+			name:        "inventory",
+			summary:     "manage known devices and their probe overrides",
+			usage:       "[list|set|rm] [flags]",
+			description: "The inventory records how each known device is probed, which hostname it should have and its service checks. Scans, watch and agents honour it.",
+			flags:       func(fs *flag.FlagSet) { inventoryFlags(fs, "list") },
+			run:         runInventory,
+			subcommands: []*command{
+				{name: "list", summary: "list known devices", usage: "[flags]", flags: func(fs *flag.FlagSet) { inventoryFlags(fs, "list") }},
+				{
+					name:        "set",
+					summary:     "add or change a known device",
+					usage:       "[flags] <ip>",
+					description: "Only the flags given are changed; --check replaces all service checks of the device.",
+					examples: []example{
+						{"probe a NAS that ignores ping over TCP", "pingdisco inventory set --name nas --probe tcp --port 443 --timeout 2s 192.168.1.10"},
+						{"", "pingdisco inventory set --expect-hostname printer.lan --check http:/health 192.168.1.20"},
+					},
+					flags: func(fs *flag.FlagSet) { inventoryFlags(fs, "set") },
+				},
+				{name: "rm", summary: "forget a known device", usage: "[flags] <ip>", flags: func(fs *flag.FlagSet) { inventoryFlags(fs, "rm") }},
+			},
+		},
+		{
+			name:    "profile",
+			summary: "keep labels, known devices and alert settings per network",
+			usage:   "[list|add|remove] [flags]",
+			description: "A profile is recognised by the SSID of the Wi-Fi network or the MAC address of the default gateway, and " +
+				"keeps its own inventory, known devices, anomaly baseline and, when present, notifiers.json and maintenance.json " +
+				"in a directory of its own. Commands using these files pick the profile matching the current network unless " +
+				"--profile names one or none, or the files are given with their own flags.",
+			run: runProfile,
+			subcommands: []*command{
+				{name: "list", summary: "list the profiles and mark the one matching the current network", usage: "[flags]"},
+				{
+					name:    "add",
+					summary: "add or replace a profile",
+					usage:   "[flags] <name>",
+					examples: []example{
+						{"a profile for the network the laptop is on now", "pingdisco profile add --current home"},
+						{"", "pingdisco profile add --ssid CorpWiFi,CorpGuest --gateway-mac 00:11:22:33:44:55 office"},
+					},
+					flags: func(fs *flag.FlagSet) { profileCommandFlags(fs, "add") },
+				},
+				{name: "remove", summary: "remove a profile, keeping its files", usage: "[flags] <name>"},
+			},
+		},
+		{
+			name:    "import",
+			summary: "add known devices from a CSV asset list",
+			usage:   "[flags] <file.csv>",
+			description: "Reads a CSV file with a header row naming the columns. An IP address column is required; MAC address, name, " +
+				"hostname, owner and location columns are used when present, under common headings such as \"IP Address\" or " +
+				"\"Asset Name\". Devices already in the inventory are updated with the values given, keeping their probe " +
+				"overrides and checks. Rows without a valid address are reported and skipped. Use - to read standard input.",
+			examples: []example{
+				{"", "pingdisco import assets.csv"},
+				{"check an export first", "pingdisco import --dry-run assets.csv"},
+			},
+			flags: func(fs *flag.FlagSet) { importFlags(fs) },
+			run:   runImport,
+		},
+		{
+			name:        "floorplan",
+			summary:     "pin known devices on a floor plan and render it with their status",
+			usage:       "[list|image|pin|unpin|render] [flags]",
+			description: "Keeps a floor plan image next to the inventory and a position on it for each pinned device.",
+			flags:       func(fs *flag.FlagSet) { floorPlanFlags(fs, "list") },
+			run:         runFloorPlan,
+			subcommands: []*command{
+				{name: "list", summary: "show the floor plan image and pinned devices", usage: "[flags]", flags: func(fs *flag.FlagSet) { floorPlanFlags(fs, "list") }},
+				{
+					name:    "image",
+					summary: "set the floor plan image",
+					usage:   "[flags] <file>",
+					examples: []example{
+						{"", "pingdisco floorplan image office.png"},
+					},
+					flags: func(fs *flag.FlagSet) { floorPlanFlags(fs, "image") },
+				},
+				{
+					name:        "pin",
+					summary:     "place a device on the floor plan",
+					usage:       "[flags] <ip> <x> <y>",
+					description: "X and Y are percentages of the image width and height from its top left corner; clicking the rendered plan shows them.",
+					examples: []example{
+						{"", "pingdisco floorplan pin 192.168.1.20 12.5 40"},
+					},
+					flags: func(fs *flag.FlagSet) { floorPlanFlags(fs, "pin") },
+				},
+				{name: "unpin", summary: "take a device off the floor plan", usage: "[flags] <ip>", flags: func(fs *flag.FlagSet) { floorPlanFlags(fs, "unpin") }},
+				{
+					name:        "render",
+					summary:     "write the floor plan as an HTML page",
+					usage:       "[flags] [scan-id]",
+					description: "With --store, pins are green for devices found by the given or latest scan and red for the others, and devices found but not pinned are listed.",
+					examples: []example{
+						{"", "pingdisco floorplan render --store sqlite:scans.db > office.html"},
+					},
+					flags: func(fs *flag.FlagSet) { floorPlanFlags(fs, "render") },
+				},
+			},
+		},
+		{
+			name:        "checks",
+			summary:     "run the service checks of known devices",
+			usage:       "[flags]",
+			description: "Runs every check in the inventory once and exits with status 1 if any fails.",
+			flags:       func(fs *flag.FlagSet) { checksFlags(fs) },
+			run:         runChecks,
+		},
+		{
+			name:    "maintenance",
+			summary: "list maintenance windows",
+			usage:   "[flags]",
+			examples: []example{
+				{"", "pingdisco maintenance --file windows.json"},
+			},
+			flags: func(fs *flag.FlagSet) { maintenanceFlags(fs) },
+			run:   runMaintenance,
+		},
+		{
+			name:    "upstream",
+			summary: "show the gateway WAN address, public IP and NAT layers",
+			usage:   "[flags]",
+			description: "Asks the gateway for its WAN address over UPnP, looks up the public address and traces the first hops, " +
+				"reporting double NAT and carrier-grade NAT.",
+			flags: func(fs *flag.FlagSet) { upstreamFlags(fs) },
+			run:   runUpstream,
+		},
+		{
+			name:    "triage",
+			summary: "find out whether the gateway, internet, DNS or HTTP is failing",
+			usage:   "[flags]",
+			description: "Pings the gateway and public anycast resolvers, resolves a name through the system resolver and directly, " +
+				"fetches a URL, checks for a captive portal and names the most likely culprit. Exits with status 1 if any step failed.",
+			examples: []example{
+				{"", "pingdisco triage --name intranet.example.com --url https://intranet.example.com/"},
+			},
+			flags: func(fs *flag.FlagSet) { triageFlags(fs) },
+			run:   runTriage,
+		},
+		{
+			name:        "bufferbloat",
+			summary:     "measure latency under load",
+			usage:       "[flags]",
+			description: "Compares the round-trip time to the gateway on an idle link and while parallel downloads saturate it, and grades the increase from A to F.",
+			examples: []example{
+				{"", "pingdisco bufferbloat --streams 8 --duration 20s"},
+			},
+			flags: func(fs *flag.FlagSet) { bufferbloatFlags(fs) },
+			run:   runBufferbloat,
+		},
+		{
+			name:        "doctor",
+			summary:     "check that this system can run scans",
+			usage:       "[flags]",
+			description: "Checks for the ping command and its privileges, usable interfaces, a default route or NAT64 on IPv6-only networks, the neighbor table, reverse DNS and the reverse zones of the local subnets, and writable state files. Exits with status 1 if a scan cannot work.",
+			flags:       func(fs *flag.FlagSet) { doctorFlags(fs) },
+			run:         runDoctor,
+		},
+		{
+			name:    "experiments",
+			summary: "list experimental discovery methods",
+			usage:   "[flags]",
+			description: "Experimental probes and enrichers are off by default. Enable them for one run with --experimental on scan, " +
+				"for every run with PINGDISCO_EXPERIMENTAL, or for agents with agents config --experimental.",
+			examples: []example{
+				{"", "pingdisco scan --experimental silent-hosts"},
+			},
+			flags: func(fs *flag.FlagSet) { experimentalFlag(fs) },
+			run:   runExperiments,
+		},
+		{
+			name:    "self-update",
+			summary: "replace this binary with the latest release",
+			usage:   "[flags]",
+			description: "Fetches the release feed, verifies its Ed25519 signature, downloads the binary for this platform, checks it " +
+				"against the SHA-256 checksum in the feed and replaces the running binary in place.",
+			examples: []example{
+				{"see whether a newer release exists", "pingdisco self-update --check"},
+				{"", "sudo pingdisco self-update"},
+			},
+			flags: func(fs *flag.FlagSet) { selfUpdateFlags(fs) },
+			run:   runSelfUpdate,
+		},
+		{
+			name:        "completion",
+			summary:     "print a shell completion script for bash, zsh, fish or powershell",
+			usage:       strings.Join(completionShells, "|"),
+			description: "Completes commands, subcommands and flags, and the values of flags naming an interface or a network profile.",
+			examples: []example{
+				{"bash or zsh", "source <(pingdisco completion bash)"},
+				{"fish", "pingdisco completion fish > ~/.config/fish/completions/pingdisco.fish"},
+				{"PowerShell", "pingdisco completion powershell | Out-String | Invoke-Expression"},
+			},
+			run:       runCompletion,
+			argValues: completionShells,
+		},
+		{name: "version", summary: "print the version", usage: "", run: runVersion},
+		{name: "help", summary: "list commands or show the flags of one", usage: "[command [subcommand]]", run: runHelp},
+		{name: "__complete", run: runComplete, hidden: true},
+		{name: "__man", run: runMan, hidden: true},
+		{name: "__remote-scan", run: runRemoteScan, hidden: true},
+	}...)
+	// The soak test harness is only built with -tags soak.
+	commands = append(commands, soakCommands()...)
+}
+
+func lookupCommand(name string) *command {
+	return findCommand(commands, name)
+}
+
+func findCommand(list []*command, name string) *command {
+	for _, c := range list {
+		if c.name == name {
+			return c
+		}
+		for _, a := range c.aliases {
+			if a == name {
+				return c
+			}
+		}
+	}
+	return nil
+}
+
+// resolveCommand returns the command and subcommand named by a flag set
+// name such as "agents config". sub is nil for top-level commands.
+func resolveCommand(name string) (c, sub *command) {
+	words := strings.Fields(name)
+	if len(words) == 0 {
+		return nil, nil
+	}
+	c = lookupCommand(words[0])
+	if c != nil && len(words) > 1 {
+		sub = findCommand(c.subcommands, words[1])
+	}
+	return c, sub
+}
+
+// newFlagSet returns the flag set of the command called name, with usage
+// output generated from its definition.
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() {
+		c, sub := resolveCommand(name)
+		if c == nil {
+			fs.PrintDefaults()
+			return
+		}
+		printUsage(fs.Output(), c, sub, fs)
+	}
+	return fs
+}
+
+// parseInterspersed parses args with fs and returns the positional
+// arguments, which may come before, between or after the flags, as in
+// "pingdisco 10.0.0.0/24 --arp". Arguments after "--" are all positional.
+func parseInterspersed(fs *flag.FlagSet, args []string) []string {
+	var positional []string
+	for {
+		fs.Parse(args)
+		rest := fs.Args()
+		if len(rest) == 0 {
+			return positional
+		}
+		if i := len(args) - len(rest) - 1; i >= 0 && args[i] == "--" {
+			return append(positional, rest...)
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+}
+
+// commandFlags returns the flags of c, or of its subcommand sub, or nil if
+// it has none.
+func commandFlags(c, sub *command) *flag.FlagSet {
+	d, name := c, c.name
+	if sub != nil {
+		d, name = sub, c.name+" "+sub.name
+	}
+	if d.flags == nil {
+		return nil
+	}
+
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	d.flags(fs)
+	return fs
+}
+
+// printUsage writes the help of c, or of its subcommand sub: synopsis,
+// description, subcommands, flags and examples.
+func printUsage(w io.Writer, c, sub *command, fs *flag.FlagSet) {
+	path, d := "pingdisco "+c.name, c
+	if sub != nil {
+		path, d = path+" "+sub.name, sub
+	}
+
+	fmt.Fprintln(w, "Usage: "+strings.TrimSpace(path+" "+d.usage))
+	if d.description != "" {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, wrap(d.description, 78))
+	}
+
+	if sub == nil && len(c.subcommands) > 0 {
+		fmt.Fprintln(w, "\nSubcommands:")
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		for _, s := range c.subcommands {
+			fmt.Fprintf(tw, "  %s\t%s\n", s.name, s.summary)
+		}
+		tw.Flush()
+	}
+
+	hasFlags := false
+	fs.VisitAll(func(*flag.Flag) { hasFlags = true })
+	if hasFlags {
+		fmt.Fprintln(w, "\nFlags:")
+		fs.SetOutput(w)
+		fs.PrintDefaults()
+	}
+
+	if len(d.examples) > 0 {
+		fmt.Fprintln(w, "\nExamples:")
+		for _, e := range d.examples {
+			if e.comment != "" {
+				fmt.Fprintf(w, "  # %s\n", e.comment)
+			}
+			fmt.Fprintf(w, "  %s\n", e.command)
+		}
+	}
+}
+
+// wrap breaks text into lines of at most width characters.
+func wrap(text string, width int) string {
+	var b strings.Builder
+	n := 0
+	for _, word := range strings.Fields(text) {
+		if n > 0 && n+1+len(word) > width {
+			b.WriteByte('\n')
+			n = 0
+		} else if n > 0 {
+			b.WriteByte(' ')
+			n++
+		}
+		b.WriteString(word)
+		n += len(word)
+	}
+	return b.String()
+}
+
+func printCommands(w io.Writer) {
+	fmt.Fprintln(w, "Usage: pingdisco [command] [flags] [args]")
+	fmt.Fprintln(w, "\nCommands:")
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, c := range commands {
+		if c.hidden {
+			continue
+		}
+		name := c.name
+		if len(c.aliases) > 0 {
+			name += " (" + strings.Join(c.aliases, ", ") + ")"
+		}
+		fmt.Fprintf(tw, "  %s\t%s\n", name, c.summary)
+	}
+	tw.Flush()
+	fmt.Fprintln(w, "\nWithout a command, pingdisco runs scan. Use \"pingdisco help <command>\" for its flags and examples.")
+}
+
+func runHelp(args []string) {
+	if len(args) == 0 {
+		printCommands(os.Stdout)
+		return
+	}
+
+	c := lookupCommand(args[0])
+	if c == nil || c.hidden || c.name == "help" {
+		fmt.Printf("Error: unknown command %q\n", args[0])
+		os.Exit(2)
+	}
+
+	var sub *command
+	if len(args) > 1 {
+		if sub = findCommand(c.subcommands, args[1]); sub == nil {
+			fmt.Printf("Error: unknown command %q\n", strings.Join(args[:2], " "))
+			os.Exit(2)
+		}
+	}
+
+	fs := commandFlags(c, sub)
+	if fs == nil {
+		fs = flag.NewFlagSet(c.name, flag.ContinueOnError)
+	}
+	printUsage(os.Stdout, c, sub, fs)
+}
+
+// buildVersion returns version, falling back to the module version recorded
+// by go install when the binary was not built with -ldflags.
+func buildVersion() string {
+	if version != "dev" {
+		return version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+	return version
+}
+
+func runVersion(args []string) {
+	fs := newFlagSet("version")
+	fs.Parse(args)
+
+	fmt.Printf("pingdisco %s (%s %s/%s, %s build)\n", buildVersion(), runtime.Version(), runtime.GOOS, runtime.GOARCH, buildFlavor)
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var completionShells = []string{"bash", "zsh", "fish", "powershell"}
+
+// completionScripts call the hidden __complete command with the words
+// typed after pingdisco, the last one being the word under the cursor.
+var completionScripts = map[string]string{
+	"bash": `# pingdisco bash completion
+_pingdisco() {
+    local IFS=$'\n'
+    COMPREPLY=($(compgen -W "$(pingdisco __complete "${COMP_WORDS[@]:1:COMP_CWORD}" 2>/dev/null)" -- "${COMP_WORDS[COMP_CWORD]}"))
+}
+complete -o default -F _pingdisco pingdisco
+`,
+	"zsh": `#compdef pingdisco
+_pingdisco() {
+    local -a candidates
+    candidates=("${(@f)$(pingdisco __complete "${(@)words[2,CURRENT]}" 2>/dev/null)}")
+    if [[ -n "${candidates[1]}" ]]; then
+        compadd -a candidates
+    else
+        _files
+    fi
+}
+compdef _pingdisco pingdisco
+`,
+	"fish": `# pingdisco fish completion
+function __pingdisco_complete
+    set -l tokens (commandline -opc) (commandline -ct)
+    pingdisco __complete $tokens[2..-1] 2>/dev/null
+end
+complete -c pingdisco -a '(__pingdisco_complete)'
+`,
+	"powershell": `# pingdisco PowerShell completion
+Register-ArgumentCompleter -Native -CommandName pingdisco -ScriptBlock {
+    param($wordToComplete, $commandAst, $cursorPosition)
+    $words = @($commandAst.CommandElements | Select-Object -Skip 1 | ForEach-Object { $_.ToString() })
+    if ($wordToComplete -eq '') { $words += '' }
+    pingdisco __complete @words 2>$null | Where-Object { $_ -like "$wordToComplete*" } | ForEach-Object {
+        [System.Management.Automation.CompletionResult]::new($_, $_, 'ParameterValue', $_)
+    }
+}
+`,
+}
+
+func runCompletion(args []string) {
+	fs := newFlagSet("completion")
+	fs.Parse(args)
+
+	script, ok := completionScripts[fs.Arg(0)]
+	if fs.NArg() != 1 || !ok {
+		fs.Usage()
+		os.Exit(2)
+	}
+	fmt.Print(script)
+}
+
+func runComplete(args []string) {
+	for _, c := range completeArgs(args) {
+		fmt.Println(c)
+	}
+}
+
+// valueCompleters complete the values of flags whose name contains the
+// key.
+var valueCompleters = map[string]func() []string{
+	"interface": interfaceNames,
+	"profile":   profileNames,
+}
+
+// completeArgs returns the candidates for the last of words, the words
+// typed after pingdisco. The shell filters them by prefix.
+func completeArgs(words []string) []string {
+	cur := ""
+	if len(words) > 0 {
+		cur, words = words[len(words)-1], words[:len(words)-1]
+	}
+
+	c := lookupCommand("scan")
+	if len(words) > 0 && !strings.HasPrefix(words[0], "-") {
+		if c = lookupCommand(words[0]); c == nil {
+			return nil
+		}
+		words = words[1:]
+	} else if !strings.HasPrefix(cur, "-") && len(words) == 0 {
+		var names []string
+		for _, c := range commands {
+			if !c.hidden {
+				names = append(names, c.name)
+			}
+		}
+		return names
+	}
+
+	if c.name == "help" {
+		if len(words) > 0 {
+			return nil
+		}
+		var names []string
+		for _, c := range commands {
+			if !c.hidden && c.name != "help" {
+				names = append(names, c.name)
+			}
+		}
+		return names
+	}
+
+	var sub *command
+	if len(words) > 0 {
+		sub = findCommand(c.subcommands, words[0])
+	}
+
+	if len(words) == 0 && !strings.HasPrefix(cur, "-") {
+		if len(c.argValues) > 0 {
+			return c.argValues
+		}
+		if len(c.subcommands) > 0 {
+			var names []string
+			for _, s := range c.subcommands {
+				names = append(names, s.name)
+			}
+			return names
+		}
+	}
+
+	fs := commandFlags(c, sub)
+	if fs == nil {
+		return nil
+	}
+
+	if name, value, ok := strings.Cut(cur, "="); ok && strings.HasPrefix(name, "-") {
+		var values []string
+		for _, v := range flagValues(fs, name) {
+			if strings.HasPrefix(v, value) {
+				values = append(values, name+"="+v)
+			}
+		}
+		return values
+	}
+	if strings.HasPrefix(cur, "-") {
+		var names []string
+		fs.VisitAll(func(f *flag.Flag) {
+			names = append(names, "--"+f.Name)
+		})
+		return names
+	}
+	if len(words) > 0 {
+		return flagValues(fs, words[len(words)-1])
+	}
+	return nil
+}
+
+// flagValues returns the known values of the flag named by arg, such as
+// "--interface", or nil.
+func flagValues(fs *flag.FlagSet, arg string) []string {
+	name := strings.TrimLeft(arg, "-")
+	if !strings.HasPrefix(arg, "-") || strings.Contains(name, "=") || fs.Lookup(name) == nil {
+		return nil
+	}
+
+	keys := make([]string, 0, len(valueCompleters))
+	for k := range valueCompleters {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if strings.Contains(name, k) {
+			return valueCompleters[k]()
+		}
+	}
+	return nil
+}
+
+func interfaceNames() []string {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil
+	}
+
+	var names []string
+	for _, iface := range ifaces {
+		names = append(names, iface.Name)
+	}
+	return names
+}
+
+// profileNames lists the network profiles saved in the profiles directory.
+func profileNames() []string {
+	paths, _ := filepath.Glob(filepath.Join(defaultStatePath("profiles"), "*.json"))
+
+	var names []string
+	for _, p := range paths {
+		names = append(names, strings.TrimSuffix(filepath.Base(p), ".json"))
+	}
+	return names
+}
@@ -0,0 +1,483 @@
+//go:build !minimal
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"pingdisco.com/pingdisco/internal/clipboard"
+	"pingdisco.com/pingdisco/internal/device"
+	"pingdisco.com/pingdisco/internal/icon"
+	"pingdisco.com/pingdisco/internal/numfmt"
+	"pingdisco.com/pingdisco/internal/shortcut"
+	"pingdisco.com/pingdisco/internal/store"
+	"pingdisco.com/pingdisco/internal/timefmt"
+	"pingdisco.com/pingdisco/internal/timeline"
+)
+
+// dashboard serves a live view of the devices found by scan --serve: a
+// page of device tiles, green while online and grey once a scan misses
+// them, redrawn from server-sent events as each scan completes.
+type dashboard struct {
+	mu      sync.Mutex
+	devices map[string]*dashboardDevice
+	scans   int
+	updated time.Time
+	// state is the JSON of the latest update, sent to clients as they
+	// connect.
+	state   []byte
+	clients map[chan []byte]bool
+	// storeURL is where the scans are saved, for /api/diff; "" if they
+	// are not.
+	storeURL string
+}
+
+// dashboardDevice is a device as the page shows it.
+type dashboardDevice struct {
+	deviceOutput
+	// Icon is the SVG picture of the device's type, a constant of this
+	// program.
+	Icon     string `json:"icon"`
+	IconName string `json:"icon_name"`
+	LastSeen string `json:"last_seen"`
+	// RTT is the round-trip time in the display unit of --rtt-unit, or ""
+	// if it was not measured.
+	RTT string `json:"rtt,omitempty"`
+	// Copy is what the page offers to copy of the device.
+	Copy []clipboard.Item `json:"copy"`
+
+	ip net.IP
+}
+
+func newDashboard(storeURL string) *dashboard {
+	return &dashboard{devices: make(map[string]*dashboardDevice), clients: make(map[chan []byte]bool), storeURL: storeURL}
+}
+
+// serveDashboard serves the dashboard of scan --serve on addr until ctx is
+// done, and returns the hook that shows each completed scan on it.
+func serveDashboard(ctx context.Context, addr, storeURL string) (func(store.Scan), error) {
+	db := newDashboard(storeURL)
+	if err := serveHTTP(ctx, db.handler(), addr); err != nil {
+		return nil, err
+	}
+	fmt.Printf("\nDashboard: %s\n", localURL(addr))
+	return db.update, nil
+}
+
+// update records a completed scan and pushes the new state to the open
+// pages. Devices seen before but not by this scan are kept as offline.
+func (db *dashboard) update(scan store.Scan) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for _, d := range db.devices {
+		d.Online = false
+	}
+	for _, d := range scan.Devices {
+		i := icon.For(d)
+		dd := &dashboardDevice{
+			deviceOutput: newDeviceOutput(d),
+			Icon:         i.SVG,
+			IconName:     i.Name,
+			LastSeen:     timefmt.Format(scan.StartedAt),
+			Copy:         clipboard.Items(d),
+			ip:           d.IP(),
+		}
+		if rtt := duration(d, device.AttrRTT); rtt > 0 {
+			dd.RTT = numfmt.RTT(rtt)
+		}
+		db.devices[d.ID()] = dd
+	}
+	db.scans++
+	db.updated = time.Now()
+
+	db.state = db.encode()
+	for c := range db.clients {
+		// A client still busy with the previous state skips to this
+		// one.
+		select {
+		case <-c:
+		default:
+		}
+		c <- db.state
+	}
+}
+
+// encode returns the JSON of the current state. db.mu must be held.
+func (db *dashboard) encode() []byte {
+	devices := make([]*dashboardDevice, 0, len(db.devices))
+	for _, d := range db.devices {
+		devices = append(devices, d)
+	}
+	slices.SortFunc(devices, func(a, b *dashboardDevice) int {
+		return bytes.Compare(a.ip.To16(), b.ip.To16())
+	})
+	online := 0
+	for _, d := range devices {
+		if d.Online {
+			online++
+		}
+	}
+
+	state := struct {
+		UpdatedAt string             `json:"updated_at"`
+		Scans     int                `json:"scans"`
+		Online    int                `json:"online"`
+		Devices   []*dashboardDevice `json:"devices"`
+	}{timefmt.Format(db.updated), db.scans, online, devices}
+	b, _ := json.Marshal(state)
+	return b
+}
+
+func (db *dashboard) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		io.WriteString(w, dashboardPage)
+	})
+	mux.HandleFunc("/devices", func(w http.ResponseWriter, r *http.Request) {
+		db.mu.Lock()
+		state := db.encode()
+		db.mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(state)
+	})
+	mux.HandleFunc("/events", db.serveEvents)
+	mux.HandleFunc("GET /api/diff", db.serveDiff)
+	mux.HandleFunc("GET /api/shortcuts", db.serveShortcuts)
+	return mux
+}
+
+// serveDiff compares two saved scans, given by ID as from and to, and
+// sends what changed as JSON. Without to, the latest scan is compared.
+func (db *dashboard) serveDiff(w http.ResponseWriter, r *http.Request) {
+	if db.storeURL == "" {
+		http.Error(w, "scans are not saved; serve with --store", http.StatusNotFound)
+		return
+	}
+	from := r.URL.Query().Get("from")
+	if from == "" {
+		http.Error(w, "from: scan ID missing", http.StatusBadRequest)
+		return
+	}
+	st, err := store.Open(db.storeURL)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer st.Close()
+
+	base, err := loadScan(r.Context(), st, from)
+	if err != nil {
+		http.Error(w, "from: "+err.Error(), http.StatusNotFound)
+		return
+	}
+	scan, err := loadScan(r.Context(), st, r.URL.Query().Get("to"))
+	if err != nil {
+		http.Error(w, "to: "+err.Error(), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newDiff(base, scan, timeline.Compare(base, scan)))
+}
+
+// serveShortcuts tries the shortcut ports of a device on the page, given
+// by address as ip, and sends those that answer as JSON. Other addresses
+// are refused, so the dashboard cannot be used to probe the network.
+func (db *dashboard) serveShortcuts(w http.ResponseWriter, r *http.Request) {
+	ip := net.ParseIP(r.URL.Query().Get("ip"))
+	known := false
+	db.mu.Lock()
+	for _, d := range db.devices {
+		known = known || d.ip.Equal(ip)
+	}
+	db.mu.Unlock()
+	if ip == nil || !known {
+		http.Error(w, "ip: not a device on the dashboard", http.StatusNotFound)
+		return
+	}
+	found := shortcut.Detect(r.Context(), ip, shortcut.DefaultTimeout)
+	if found == nil {
+		found = []shortcut.Shortcut{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(found)
+}
+
+// serveEvents streams the state to a page as server-sent events, the
+// current one first, until the page is closed.
+func (db *dashboard) serveEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	c := make(chan []byte, 1)
+	db.mu.Lock()
+	if db.state != nil {
+		c <- db.state
+	}
+	db.clients[c] = true
+	db.mu.Unlock()
+	defer func() {
+		db.mu.Lock()
+		delete(db.clients, c)
+		db.mu.Unlock()
+	}()
+
+	// A comment every so often keeps proxies from closing an idle
+	// stream between slow scans.
+	keepalive := time.NewTicker(30 * time.Second)
+	defer keepalive.Stop()
+	fmt.Fprint(w, ": connected\n\n")
+	flusher.Flush()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case state := <-c:
+			fmt.Fprintf(w, "data: %s\n\n", state)
+		case <-keepalive.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+		}
+		flusher.Flush()
+	}
+}
+
+// serveHTTP serves h on addr until ctx is done. It returns once the
+// server is listening, or with the error that kept it from listening.
+func serveHTTP(ctx context.Context, h http.Handler, addr string) error {
+	// Requests share ctx, so open event streams end with it instead of
+	// holding up the shutdown.
+	srv := &http.Server{Addr: addr, Handler: h, BaseContext: func(net.Listener) context.Context { return ctx }}
+	errc := make(chan error, 1)
+	go func() { errc <- srv.ListenAndServe() }()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-time.After(100 * time.Millisecond):
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+	go func() {
+		if err := <-errc; err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("serving %s: %v", addr, err)
+		}
+	}()
+	return nil
+}
+
+// localURL returns the address of what is served on addr, as a browser
+// on this machine would open it.
+func localURL(addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "http://" + addr + "/"
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "localhost"
+	}
+	return "http://" + net.JoinHostPort(host, port) + "/"
+}
+
+// dashboardPage draws the tiles from the events, and the details of the
+// device whose tile was clicked with the ways of reaching it. Scan data is
+// only ever set as text.
+const dashboardPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>pingdisco</title>
+<style>
+body { font-family: system-ui, sans-serif; margin: 2em; color: #222; }
+#status { color: #666; }
+#grid { display: grid; grid-template-columns: repeat(auto-fill, minmax(13em, 1fr)); gap: .8em; }
+.tile { border: 1px solid #ddd; border-left: 6px solid #3a9a4a; border-radius: 6px; padding: .6em .8em; }
+.tile.offline { border-left-color: #bbb; color: #888; }
+.tile .icon { color: #2a6db0; float: right; }
+.tile.offline .icon { color: #bbb; }
+.name { font-weight: 600; overflow-wrap: anywhere; }
+.addr { font-family: ui-monospace, monospace; }
+.meta { font-size: .85em; color: #666; }
+.tile { cursor: pointer; }
+.tile.selected { outline: 2px solid #2a6db0; }
+#detail { border: 1px solid #ddd; border-radius: 6px; padding: .6em .8em; margin-bottom: 1em; }
+#detail button { margin: .4em .4em 0 0; }
+#detail a { margin-right: 1em; }
+</style>
+</head>
+<body>
+<h1>Network</h1>
+<p id="status">Waiting for the first scan…</p>
+<section id="detail" hidden></section>
+<div id="grid"></div>
+<script>
+const grid = document.getElementById("grid");
+const statusLine = document.getElementById("status");
+const detail = document.getElementById("detail");
+// selected is the address of the device whose details are shown, latest
+// the state they are shown from.
+let selected = null;
+let latest = null;
+// shortcuts holds the ways of reaching each device, null while the server
+// tries its ports.
+const shortcuts = {};
+
+function line(cls, text) {
+  const el = document.createElement("div");
+  el.className = cls;
+  el.textContent = text;
+  return el;
+}
+
+// copy puts text on the clipboard. Pages opened over plain HTTP from
+// another machine may not use the clipboard API and fall back to a
+// selected text area.
+function copy(text, button) {
+  const done = () => {
+    button.textContent = "Copied";
+    setTimeout(showDetail, 1500);
+  };
+  if (navigator.clipboard && window.isSecureContext) {
+    navigator.clipboard.writeText(text).then(done);
+    return;
+  }
+  const area = document.createElement("textarea");
+  area.value = text;
+  document.body.append(area);
+  area.select();
+  document.execCommand("copy");
+  area.remove();
+  done();
+}
+
+function loadShortcuts(ip) {
+  shortcuts[ip] = null;
+  fetch("api/shortcuts?ip=" + encodeURIComponent(ip))
+    .then(r => r.ok ? r.json() : [])
+    .then(found => {
+      shortcuts[ip] = found;
+      showDetail();
+    });
+}
+
+function showDetail() {
+  const d = latest && latest.devices.find(d => d.ip == selected);
+  detail.hidden = !d;
+  if (!d) {
+    return;
+  }
+  const state = d.online ? "online" : "offline, last seen " + d.last_seen;
+  detail.replaceChildren(line("name", (d.name || d.hostname || "unnamed") + " · " + state), line("addr", d.ip));
+  const facts = [d.mac, d.vendor, d.type, d.rtt, d.quality ? "quality " + d.quality : ""];
+  detail.append(line("meta", facts.filter(Boolean).join(" · ")));
+  for (const item of d.copy) {
+    const button = document.createElement("button");
+    button.textContent = "Copy " + item.label;
+    button.title = item.text;
+    button.onclick = () => copy(item.text, button);
+    detail.append(button);
+  }
+  const found = shortcuts[d.ip];
+  if (!found) {
+    detail.append(line("meta", "Trying the ssh, web and remote desktop ports…"));
+    return;
+  }
+  const open = document.createElement("div");
+  open.className = "meta";
+  open.textContent = found.length ? "Open (o opens the first): " : "No ssh, web or remote desktop port open.";
+  found.forEach((s, i) => {
+    const a = document.createElement("a");
+    a.href = s.url;
+    a.textContent = (i + 1) + " " + s.url;
+    if (s.name.startsWith("http")) {
+      a.target = "_blank";
+      a.rel = "noopener";
+    }
+    open.append(a);
+  });
+  detail.append(open);
+}
+
+function render(state) {
+  latest = state;
+  const offline = state.devices.length - state.online;
+  statusLine.textContent = state.online + " online, " + offline + " offline after " +
+    state.scans + (state.scans == 1 ? " scan" : " scans") + ", updated " + state.updated_at;
+  grid.replaceChildren(...state.devices.map(d => {
+    const tile = document.createElement("div");
+    tile.className = d.online ? "tile" : "tile offline";
+    if (d.ip == selected) {
+      tile.classList.add("selected");
+    }
+    tile.onclick = () => {
+      selected = selected == d.ip ? null : d.ip;
+      if (selected) {
+        loadShortcuts(selected);
+      }
+      render(latest);
+    };
+    const icon = document.createElement("span");
+    icon.className = "icon";
+    icon.title = d.icon_name;
+    icon.innerHTML = d.icon; // a constant of the program, not scan data
+    tile.append(icon, line("name", d.name || d.hostname || "unnamed"), line("addr", d.ip));
+    const meta = [d.vendor, d.type, d.rtt, d.quality ? "quality " + d.quality : ""];
+    tile.append(line("meta", meta.filter(Boolean).join(" · ")));
+    if (!d.online) {
+      tile.append(line("meta", "last seen " + d.last_seen));
+    }
+    return tile;
+  }));
+  showDetail();
+}
+
+// With a device shown, o or its number opens one of its shortcuts and Esc
+// closes it.
+document.addEventListener("keydown", e => {
+  if (!selected || e.ctrlKey || e.metaKey || e.altKey) {
+    return;
+  }
+  if (e.key == "Escape") {
+    selected = null;
+    render(latest);
+    return;
+  }
+  const i = e.key == "o" ? 0 : "123456789".indexOf(e.key);
+  const links = detail.querySelectorAll("a");
+  if (i >= 0 && i < links.length) {
+    links[i].click();
+  }
+});
+
+const events = new EventSource("events");
+events.onmessage = e => render(JSON.parse(e.data));
+events.onerror = () => { statusLine.textContent = "Disconnected, retrying…"; };
+</script>
+</body>
+</html>
+`
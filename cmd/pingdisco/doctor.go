@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"pingdisco.com/pingdisco/internal/inventory"
+	"pingdisco.com/pingdisco/internal/localdns"
+	"pingdisco.com/pingdisco/internal/nat64"
+	"pingdisco.com/pingdisco/internal/netinfo"
+	"pingdisco.com/pingdisco/internal/netops"
+	"pingdisco.com/pingdisco/internal/scanner"
+	"pingdisco.com/pingdisco/internal/store"
+)
+
+// doctorCheck is one prerequisite of a scan. Warnings degrade the results
+// of a scan but do not prevent it.
+type doctorCheck struct {
+	name string
+	run  func() (detail string, err error)
+	warn bool
+}
+
+// doctorOptions are the flags of doctor.
+type doctorOptions struct {
+	inventoryPath *string
+	storeURL      *string
+}
+
+// doctorFlags declares the flags of doctor.
+func doctorFlags(fs *flag.FlagSet) doctorOptions {
+	return doctorOptions{
+		inventoryPath: fs.String("inventory", defaultStatePath("inventory.json"), "inventory of known devices"),
+		storeURL:      fs.String("store", defaultStore(), "store to check, if scans are saved"),
+	}
+}
+
+func runDoctor(args []string) {
+	fs := newFlagSet("doctor")
+	opts := doctorFlags(fs)
+	fs.Parse(args)
+
+	ops := netops.System()
+
+	checks := []doctorCheck{
+		{name: "ping", run: func() (string, error) {
+			p, ok := ops.Pinger.(*netops.ICMPPinger)
+			if ok && p.Err() == nil {
+				return "native ICMP over a " + p.Method(), nil
+			}
+			path, err := exec.LookPath("ping")
+			if err != nil && ok {
+				return "", fmt.Errorf("%v, and no ping command to fall back to", p.Err())
+			}
+			return path, err
+		}},
+		{name: "loopback", run: func() (string, error) {
+			if !scanner.Ping(context.Background(), ops, "127.0.0.1", scanner.DefaultProbe) {
+				return "", fmt.Errorf("no echo reply from 127.0.0.1; pinging may need elevated privileges")
+			}
+			return "echo reply from 127.0.0.1", nil
+		}},
+		{name: "raw-icmp", warn: true, run: func() (string, error) {
+			if err := rawICMP(); err != nil {
+				return "", err
+			}
+			return "privileged ICMP available", nil
+		}},
+		{name: "interfaces", run: func() (string, error) {
+			interfaces, err := getNetworkInterfaces()
+			if err != nil {
+				return "", err
+			}
+			if len(interfaces) == 0 {
+				return "", fmt.Errorf("no active IPv4 interface")
+			}
+			var names []string
+			for _, iface := range interfaces {
+				names = append(names, fmt.Sprintf("%s %s", iface.Name, iface.IPNet))
+			}
+			return fmt.Sprint(names), nil
+		}},
+		{name: "gateway", warn: true, run: func() (string, error) {
+			if gw := defaultGateway(); gw != nil {
+				return gw.String(), nil
+			}
+			return "", fmt.Errorf("no default route")
+		}},
+		{name: "nat64", warn: true, run: func() (string, error) {
+			prefix, err := detectNAT64()
+			switch {
+			case errors.Is(err, nat64.ErrNoDNS64):
+				return "", errors.New("IPv6-only network without DNS64, IPv4 hosts are unreachable")
+			case err != nil:
+				return "", err
+			case prefix.Valid():
+				return "IPv6-only network, IPv4 hosts are reached through " + prefix.String(), nil
+			default:
+				return "not needed, IPv4 default route present", nil
+			}
+		}},
+		{name: "arp", warn: true, run: func() (string, error) {
+			neighbors, err := netinfo.Neighbors()
+			if err != nil {
+				return "", fmt.Errorf("neighbor table unreadable, MAC addresses will be missing: %w", err)
+			}
+			return fmt.Sprintf("%d entries", len(neighbors)), nil
+		}},
+		{name: "dns", warn: true, run: func() (string, error) {
+			ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+			defer cancel()
+			if _, err := net.DefaultResolver.LookupAddr(ctx, "127.0.0.1"); err != nil {
+				return "", fmt.Errorf("reverse lookups fail, hostnames will be missing: %w", err)
+			}
+			return "reverse lookups work", nil
+		}},
+		{name: "ptr-zones", warn: true, run: func() (string, error) {
+			servers, err := netinfo.Nameservers()
+			if err != nil {
+				return "", fmt.Errorf("DNS servers unknown, reverse zones cannot be found: %w", err)
+			}
+			interfaces, err := getNetworkInterfaces()
+			if err != nil {
+				return "", err
+			}
+			zones := reverseZones(&localdns.ZoneResolver{Resolvers: servers}, interfaces)
+			if len(zones) == 0 {
+				return "none found, names come from the system resolver", nil
+			}
+			return strings.Join(zones, ", "), nil
+		}},
+		{name: "state", run: func() (string, error) {
+			dir := filepath.Dir(*opts.inventoryPath)
+			if err := os.MkdirAll(dir, 0o755); err != nil {
+				return "", err
+			}
+			f, err := os.CreateTemp(dir, ".doctor-*")
+			if err != nil {
+				return "", err
+			}
+			f.Close()
+			os.Remove(f.Name())
+			return dir + " is writable", nil
+		}},
+		{name: "inventory", run: func() (string, error) {
+			inv, err := inventory.Load(*opts.inventoryPath)
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("%d known devices", len(inv.Devices)), nil
+		}},
+	}
+	if *opts.storeURL != "" {
+		checks = append(checks, doctorCheck{name: "store", run: func() (string, error) {
+			st, err := store.Open(*opts.storeURL)
+			if err != nil {
+				return "", err
+			}
+			defer st.Close()
+			scans, err := st.Scans(context.Background(), 0)
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("%d saved scans", len(scans)), nil
+		}})
+	}
+
+	failed := 0
+	for _, c := range checks {
+		status := "OK"
+		detail, err := c.run()
+		if err != nil {
+			detail = err.Error()
+			status = "WARN"
+			if !c.warn {
+				status = "FAIL"
+				failed++
+			}
+		}
+		fmt.Printf("  %-4s %-10s %s\n", status, c.name, detail)
+	}
+
+	if failed > 0 {
+		fmt.Printf("\n%d problem(s) will prevent scans from working\n", failed)
+		os.Exit(1)
+	}
+}
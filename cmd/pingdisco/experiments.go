@@ -0,0 +1,44 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"pingdisco.com/pingdisco/internal/experiments"
+)
+
+// experimentalFlag adds the --experimental flag to fs.
+func experimentalFlag(fs *flag.FlagSet) *string {
+	return fs.String("experimental", os.Getenv("PINGDISCO_EXPERIMENTAL"), "comma-separated experimental discovery methods to enable, or all (see pingdisco experiments)")
+}
+
+// parseExperiments parses the value of --experimental, exiting on unknown
+// names.
+func parseExperiments(list string) experiments.Set {
+	set, err := experiments.Parse(list)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(2)
+	}
+	return set
+}
+
+func runExperiments(args []string) {
+	fs := newFlagSet("experiments")
+	enabled := experimentalFlag(fs)
+	fs.Parse(args)
+
+	set := parseExperiments(*enabled)
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tENABLED\tDESCRIPTION")
+	for _, e := range experiments.All {
+		on := "no"
+		if set.Enabled(e.Name) {
+			on = "yes"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", e.Name, on, e.Description)
+	}
+	tw.Flush()
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"pingdisco.com/pingdisco/internal/inventory"
+	"pingdisco.com/pingdisco/internal/store"
+)
+
+// floorPlanTypes are the image formats browsers show that a floor plan can
+// be in.
+var floorPlanTypes = []string{".png", ".jpg", ".jpeg", ".gif", ".svg", ".webp"}
+
+// floorPlanOptions are the flags of the floorplan subcommands.
+type floorPlanOptions struct {
+	path *string
+	prof *string
+	// storeURL is only set for render.
+	storeURL *string
+}
+
+// floorPlanFlags declares the flags of floorplan sub.
+func floorPlanFlags(fs *flag.FlagSet, sub string) floorPlanOptions {
+	opts := floorPlanOptions{
+		path: fs.String("inventory", defaultStatePath("inventory.json"), "inventory file; the floor plan image is kept next to it"),
+		prof: profileFlag(fs),
+	}
+	if sub == "render" {
+		opts.storeURL = fs.String("store", os.Getenv("PINGDISCO_STORE"), "store to take the online status from, e.g. sqlite:scans.db (default: no status)")
+	}
+	return opts
+}
+
+func runFloorPlan(args []string) {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		args = append([]string{"list"}, args...)
+	}
+
+	fs := newFlagSet("floorplan " + args[0])
+	opts := floorPlanFlags(fs, args[0])
+	fs.Parse(args[1:])
+	selectProfile(fs, *opts.prof)
+
+	inv, err := inventory.Load(*opts.path)
+	if err != nil {
+		fmt.Printf("Error loading inventory: %v\n", err)
+		os.Exit(1)
+	}
+
+	switch args[0] {
+	case "list":
+		image := floorPlanImage(*opts.path)
+		if image == "" {
+			image = "none (add one with pingdisco floorplan image)"
+		}
+		fmt.Printf("Floor plan: %s\n\n", image)
+		pinned := 0
+		for _, d := range inv.Sorted() {
+			if d.Pin != nil {
+				fmt.Printf("  %-15s %5.1f%% %5.1f%%  %s\n", d.IP, d.Pin.X, d.Pin.Y, d.Name)
+				pinned++
+			}
+		}
+		fmt.Printf("\nPinned devices: %d\n", pinned)
+		return
+
+	case "image":
+		if fs.NArg() != 1 {
+			fs.Usage()
+			os.Exit(2)
+		}
+		dest, err := setFloorPlanImage(*opts.path, fs.Arg(0))
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Floor plan saved as %s\n", dest)
+		return
+
+	case "pin":
+		if fs.NArg() != 3 {
+			fs.Usage()
+			os.Exit(2)
+		}
+		x, errX := strconv.ParseFloat(strings.TrimSuffix(fs.Arg(1), "%"), 64)
+		y, errY := strconv.ParseFloat(strings.TrimSuffix(fs.Arg(2), "%"), 64)
+		if errX != nil || errY != nil || x < 0 || x > 100 || y < 0 || y > 100 {
+			fmt.Println("Error: x and y are percentages of the image width and height, from 0 to 100")
+			os.Exit(2)
+		}
+		d := inv.Lookup(fs.Arg(0))
+		if d == nil {
+			d = &inventory.Device{IP: fs.Arg(0)}
+		}
+		d.Pin = &inventory.Pin{X: x, Y: y}
+		if err := inv.Put(d); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "unpin":
+		if fs.NArg() != 1 {
+			fs.Usage()
+			os.Exit(2)
+		}
+		if d := inv.Lookup(fs.Arg(0)); d != nil {
+			d.Pin = nil
+		}
+
+	case "render":
+		if fs.NArg() > 1 {
+			fs.Usage()
+			os.Exit(2)
+		}
+		image := floorPlanImage(*opts.path)
+		if image == "" {
+			fmt.Println("Error: no floor plan image; add one with pingdisco floorplan image <file>")
+			os.Exit(1)
+		}
+
+		var scan *store.Scan
+		if *opts.storeURL != "" {
+			st, err := store.Open(*opts.storeURL)
+			if err != nil {
+				fmt.Printf("Error opening store: %v\n", err)
+				os.Exit(1)
+			}
+			s, err := loadScan(context.Background(), st, fs.Arg(0))
+			st.Close()
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			scan = &s
+		}
+
+		if err := writeFloorPlan(os.Stdout, image, inv, scan); err != nil {
+			fmt.Printf("Error writing floor plan: %v\n", err)
+			if errors.Is(err, errNotInBuild) {
+				os.Exit(2)
+			}
+			os.Exit(1)
+		}
+		return
+
+	default:
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	if err := inv.Save(*opts.path); err != nil {
+		fmt.Printf("Error saving inventory: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// floorPlanImage returns the floor plan image kept next to the inventory
+// at invPath, or "".
+func floorPlanImage(invPath string) string {
+	for _, ext := range floorPlanTypes {
+		p := filepath.Join(filepath.Dir(invPath), "floorplan"+ext)
+		if _, err := os.Stat(p); err == nil {
+			return p
+		}
+	}
+	return ""
+}
+
+// setFloorPlanImage copies src next to the inventory at invPath,
+// replacing any previous floor plan.
+func setFloorPlanImage(invPath, src string) (string, error) {
+	ext := strings.ToLower(filepath.Ext(src))
+	supported := false
+	for _, t := range floorPlanTypes {
+		supported = supported || t == ext
+	}
+	if !supported {
+		return "", fmt.Errorf("%s: floor plans can be %s images", src, strings.Join(floorPlanTypes, ", "))
+	}
+
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(invPath), 0o755); err != nil {
+		return "", err
+	}
+	for _, t := range floorPlanTypes {
+		os.Remove(filepath.Join(filepath.Dir(invPath), "floorplan"+t))
+	}
+	dest := filepath.Join(filepath.Dir(invPath), "floorplan"+ext)
+	return dest, os.WriteFile(dest, data, 0o644)
+}
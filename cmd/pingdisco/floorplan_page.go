@@ -0,0 +1,146 @@
+//go:build !minimal
+
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"pingdisco.com/pingdisco/internal/device"
+	"pingdisco.com/pingdisco/internal/icon"
+	"pingdisco.com/pingdisco/internal/inventory"
+	"pingdisco.com/pingdisco/internal/store"
+	"pingdisco.com/pingdisco/internal/timefmt"
+)
+
+var floorPlanTemplate = template.Must(template.New("floorplan").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Floor plan - pingdisco</title>
+<style>
+body { font-family: system-ui, sans-serif; margin: 2em; color: #222; }
+.plan { position: relative; display: inline-block; max-width: 100%; cursor: crosshair; }
+.plan img { display: block; max-width: 100%; }
+.pin { position: absolute; transform: translate(-50%, -50%); text-align: center; font-size: 12px; cursor: default; }
+.pin .dot { display: inline-flex; align-items: center; justify-content: center; width: 30px; height: 30px; border-radius: 50%; border: 3px solid; background: #fff; }
+.pin .dot svg { width: 18px; height: 18px; }
+.pin .label { display: block; background: rgba(255,255,255,.85); padding: 0 3px; white-space: nowrap; }
+.online .dot { border-color: #2e9e44; color: #2e9e44; }
+.offline .dot { border-color: #d0342c; color: #d0342c; }
+.unknown .dot { border-color: #999; color: #999; }
+#hint { font-family: ui-monospace, monospace; margin: 1em 0; min-height: 1.2em; }
+</style>
+</head>
+<body>
+<h1>Floor plan</h1>
+<p>{{if .Scan}}Status from scan {{.Scan}}: {{.Online}} of {{len .Pins}} pinned devices online.{{else}}No scan given; status unknown.{{end}}
+Click the plan to get the command that pins a device there.</p>
+<div class="plan" id="plan">
+<img src="{{.Image}}" alt="floor plan">
+{{- range .Pins}}
+<div class="pin {{.Status}}" style="left: {{.X}}%; top: {{.Y}}%" title="{{.Name}} ({{.IP}}): {{.Status}}">
+<span class="dot">{{.Icon}}</span>
+<span class="label">{{.Name}}</span>
+</div>
+{{- end}}
+</div>
+<div id="hint"></div>
+{{- if .Unplaced}}
+<h2>Online but not on the plan</h2>
+<ul>
+{{- range .Unplaced}}
+<li>{{.}}</li>
+{{- end}}
+</ul>
+{{- end}}
+<script>
+document.getElementById("plan").addEventListener("click", function (e) {
+	if (e.target.tagName !== "IMG") return;
+	var r = e.target.getBoundingClientRect();
+	var x = ((e.clientX - r.left) / r.width * 100).toFixed(1);
+	var y = ((e.clientY - r.top) / r.height * 100).toFixed(1);
+	document.getElementById("hint").textContent = "pingdisco floorplan pin <device> " + x + " " + y;
+});
+</script>
+</body>
+</html>
+`))
+
+type floorPlanPin struct {
+	IP, Name, Status string
+	X, Y             float64
+	Icon             template.HTML
+}
+
+// writeFloorPlan writes the floor plan image with the pinned devices of
+// inv on it as a self-contained HTML page. With a scan, each pin shows
+// whether the device was found, and devices found but not pinned are
+// listed below.
+func writeFloorPlan(w io.Writer, image string, inv *inventory.Inventory, scan *store.Scan) error {
+	data, err := os.ReadFile(image)
+	if err != nil {
+		return err
+	}
+	ext := filepath.Ext(image)
+	typ := mime.TypeByExtension(ext)
+	if ext == ".svg" {
+		typ = "image/svg+xml"
+	}
+
+	page := struct {
+		Image    template.URL
+		Scan     string
+		Online   int
+		Pins     []floorPlanPin
+		Unplaced []string
+	}{Image: template.URL("data:" + typ + ";base64," + base64.StdEncoding.EncodeToString(data))}
+
+	var found []*device.Device
+	if scan != nil {
+		page.Scan = fmt.Sprintf("%d (%s)", scan.ID, timefmt.Format(scan.StartedAt))
+		found = scan.Devices
+	}
+
+	placed := make(map[*device.Device]bool)
+	for _, known := range inv.Sorted() {
+		if known.Pin == nil {
+			continue
+		}
+		pin := floorPlanPin{IP: known.IP, Name: known.Name, X: known.Pin.X, Y: known.Pin.Y, Status: "unknown", Icon: template.HTML(icon.Unknown.SVG)}
+		if scan != nil {
+			pin.Status = "offline"
+			d := findDevice(found, known.IP)
+			if d == nil && known.MAC != "" {
+				d = findDevice(found, known.MAC)
+			}
+			if d != nil {
+				pin.Status = "online"
+				pin.Icon = template.HTML(icon.For(d).SVG)
+				placed[d] = true
+				page.Online++
+				if pin.Name == "" {
+					pin.Name = d.Hostname()
+				}
+			}
+		}
+		if pin.Name == "" {
+			pin.Name = known.IP
+		}
+		page.Pins = append(page.Pins, pin)
+	}
+
+	for _, d := range found {
+		if !placed[d] {
+			page.Unplaced = append(page.Unplaced, strings.TrimSpace(d.IP().String()+" "+d.Hostname()))
+		}
+	}
+
+	return floorPlanTemplate.Execute(w, page)
+}
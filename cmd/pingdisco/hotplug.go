@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net"
+	"time"
+
+	"pingdisco.com/pingdisco/internal/ifwatch"
+)
+
+// hotplugInterval is how often long-running commands check for interfaces
+// coming and going.
+const hotplugInterval = 5 * time.Second
+
+// watchInterfaces logs the local subnets appearing and disappearing until
+// ctx is done and calls changed after each change, so the caller can scan
+// the new subnets without waiting for its next scheduled scan. Scans list
+// the interfaces afresh each time, so subnets that went away are dropped
+// from them by themselves.
+func watchInterfaces(ctx context.Context, changed func()) {
+	for c := range ifwatch.Watch(ctx, hotplugInterval, interfaceSubnets) {
+		for _, s := range c.Added {
+			log.Printf("interface %s is up on %s, scanning it", s.Interface, s.Network)
+		}
+		for _, s := range c.Removed {
+			log.Printf("interface %s left %s, no longer scanning it", s.Interface, s.Network)
+		}
+		changed()
+	}
+}
+
+// interfaceChanges runs watchInterfaces and returns a channel that receives
+// a value once the local subnets changed since the caller last received.
+func interfaceChanges(ctx context.Context) <-chan struct{} {
+	changes := make(chan struct{}, 1)
+	go watchInterfaces(ctx, func() {
+		select {
+		case changes <- struct{}{}:
+		default:
+		}
+	})
+	return changes
+}
+
+// interfaceSubnets returns the subnets scans of the local interfaces cover.
+func interfaceSubnets() ([]ifwatch.Subnet, error) {
+	interfaces, err := getNetworkInterfaces()
+	if err != nil {
+		return nil, err
+	}
+	subnets := make([]ifwatch.Subnet, 0, len(interfaces))
+	for _, iface := range interfaces {
+		network := &net.IPNet{IP: iface.IP.Mask(iface.IPNet.Mask), Mask: iface.IPNet.Mask}
+		subnets = append(subnets, ifwatch.Subnet{Interface: iface.Name, Network: network})
+	}
+	return subnets, nil
+}
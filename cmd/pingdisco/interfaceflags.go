@@ -0,0 +1,70 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// interfaceFilter holds the name patterns of --interface and
+// --exclude-interface, in the syntax of path.Match. getNetworkInterfaces
+// and getIPv6Interfaces leave out the interfaces they rule out.
+var interfaceFilter struct {
+	include, exclude []string
+}
+
+// interfaceFlags adds --interface and --exclude-interface.
+func interfaceFlags(fs *flag.FlagSet) {
+	fs.Func("interface", "only scan the interfaces matching these comma-separated `names`, which may contain wildcards such as eth*", func(s string) error {
+		patterns, err := interfacePatterns(s)
+		interfaceFilter.include = append(interfaceFilter.include, patterns...)
+		return err
+	})
+	fs.Func("exclude-interface", "do not scan the interfaces matching these comma-separated `names`, such as docker0,veth*", func(s string) error {
+		patterns, err := interfacePatterns(s)
+		interfaceFilter.exclude = append(interfaceFilter.exclude, patterns...)
+		return err
+	})
+}
+
+func interfacePatterns(s string) ([]string, error) {
+	patterns := splitList(s)
+	for _, p := range patterns {
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q", p)
+		}
+	}
+	return patterns, nil
+}
+
+// interfaceSelected reports whether the interface called name is to be
+// scanned.
+func interfaceSelected(name string) bool {
+	if len(interfaceFilter.include) > 0 && !matchesAny(interfaceFilter.include, name) {
+		return false
+	}
+	return !matchesAny(interfaceFilter.exclude, name)
+}
+
+func matchesAny(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// describeInterfaceFilter says which interfaces the flags select, for
+// errors about none matching.
+func describeInterfaceFilter() string {
+	var parts []string
+	if len(interfaceFilter.include) > 0 {
+		parts = append(parts, "--interface "+strings.Join(interfaceFilter.include, ","))
+	}
+	if len(interfaceFilter.exclude) > 0 {
+		parts = append(parts, "--exclude-interface "+strings.Join(interfaceFilter.exclude, ","))
+	}
+	return strings.Join(parts, " and ")
+}
@@ -0,0 +1,384 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"pingdisco.com/pingdisco/internal/checks"
+	"pingdisco.com/pingdisco/internal/inventory"
+	"pingdisco.com/pingdisco/internal/numfmt"
+)
+
+// inventoryOptions are the flags of the inventory subcommands. All but
+// path and prof are only set for set.
+type inventoryOptions struct {
+	path, prof           *string
+	name, expect, method *string
+	mac, owner, location *string
+	port                 *int
+	timeout              *time.Duration
+	newChecks            *[]checks.Check
+	clearChecks          *bool
+}
+
+// inventoryFlags declares the flags of inventory sub.
+func inventoryFlags(fs *flag.FlagSet, sub string) inventoryOptions {
+	opts := inventoryOptions{
+		path: fs.String("inventory", defaultStatePath("inventory.json"), "inventory file"),
+		prof: profileFlag(fs),
+	}
+	if sub == "set" {
+		opts.name = fs.String("name", "", "device name")
+		opts.expect = fs.String("expect-hostname", "", "hostname reverse DNS should return")
+		opts.mac = fs.String("mac", "", "MAC address of the device")
+		opts.owner = fs.String("owner", "", "who the device belongs to")
+		opts.location = fs.String("location", "", "where the device is")
+		opts.method = fs.String("probe", "", "probe method: icmp or tcp")
+		opts.port = fs.Int("port", 0, "port for tcp probes")
+		opts.timeout = fs.Duration("timeout", 0, "probe timeout")
+		newChecks := new([]checks.Check)
+		fs.Func("check", "service check as http:URL, tcp:PORT or dns:NAME (repeatable; replaces existing checks)", func(s string) error {
+			c, err := checks.Parse(s)
+			if err != nil {
+				return err
+			}
+			*newChecks = append(*newChecks, c)
+			return nil
+		})
+		opts.newChecks = newChecks
+		opts.clearChecks = fs.Bool("clear-checks", false, "remove all service checks")
+	}
+	return opts
+}
+
+func runInventory(args []string) {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		args = append([]string{"list"}, args...)
+	}
+
+	fs := newFlagSet("inventory " + args[0])
+	opts := inventoryFlags(fs, args[0])
+	fs.Parse(args[1:])
+	selectProfile(fs, *opts.prof)
+
+	inv, err := inventory.Load(*opts.path)
+	if err != nil {
+		fmt.Printf("Error loading inventory: %v\n", err)
+		os.Exit(1)
+	}
+
+	switch args[0] {
+	case "list":
+		for _, d := range inv.Sorted() {
+			fmt.Printf("  %-15s %s\n", d.IP, describeInventoryDevice(d))
+		}
+		fmt.Printf("\nTotal known devices: %d\n", len(inv.Devices))
+		return
+
+	case "set":
+		if fs.NArg() != 1 {
+			fs.Usage()
+			os.Exit(2)
+		}
+
+		d := inv.Lookup(fs.Arg(0))
+		if d == nil {
+			d = &inventory.Device{IP: fs.Arg(0)}
+		}
+
+		if *opts.clearChecks {
+			d.Checks = nil
+		}
+		if *opts.newChecks != nil {
+			d.Checks = *opts.newChecks
+		}
+
+		fs.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "name":
+				d.Name = *opts.name
+			case "expect-hostname":
+				d.ExpectedHostname = *opts.expect
+			case "mac":
+				d.MAC = *opts.mac
+			case "owner":
+				d.Owner = *opts.owner
+			case "location":
+				d.Location = *opts.location
+			case "probe", "port", "timeout":
+				if d.Probe == nil {
+					d.Probe = &inventory.Probe{}
+				}
+				switch f.Name {
+				case "probe":
+					d.Probe.Method = *opts.method
+				case "port":
+					d.Probe.Port = *opts.port
+				case "timeout":
+					d.Probe.Timeout = inventory.Duration(*opts.timeout)
+				}
+			}
+		})
+
+		if err := inv.Put(d); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "rm":
+		if fs.NArg() != 1 {
+			fs.Usage()
+			os.Exit(2)
+		}
+		delete(inv.Devices, fs.Arg(0))
+
+	default:
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	if err := inv.Save(*opts.path); err != nil {
+		fmt.Printf("Error saving inventory: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// labelOptions are the flags of label.
+type labelOptions struct {
+	path *string
+	prof *string
+}
+
+// labelFlags declares the flags of label.
+func labelFlags(fs *flag.FlagSet) labelOptions {
+	return labelOptions{
+		path: fs.String("inventory", defaultStatePath("inventory.json"), "inventory file"),
+		prof: profileFlag(fs),
+	}
+}
+
+// runLabel names a device in the inventory, a shortcut for inventory set
+// --name.
+func runLabel(args []string) {
+	fs := newFlagSet("label")
+	opts := labelFlags(fs)
+	fs.Parse(args)
+	selectProfile(fs, *opts.prof)
+
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	inv, err := inventory.Load(*opts.path)
+	if err != nil {
+		fmt.Printf("Error loading inventory: %v\n", err)
+		os.Exit(1)
+	}
+
+	d := inv.Lookup(fs.Arg(0))
+	if d == nil {
+		d = &inventory.Device{IP: fs.Arg(0)}
+	}
+	d.Name = fs.Arg(1)
+
+	if err := inv.Put(d); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := inv.Save(*opts.path); err != nil {
+		fmt.Printf("Error saving inventory: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// importOptions are the flags of import.
+type importOptions struct {
+	path   *string
+	prof   *string
+	dryRun *bool
+}
+
+// importFlags declares the flags of import.
+func importFlags(fs *flag.FlagSet) importOptions {
+	return importOptions{
+		path:   fs.String("inventory", defaultStatePath("inventory.json"), "inventory file"),
+		prof:   profileFlag(fs),
+		dryRun: fs.Bool("dry-run", false, "report what would be imported without saving"),
+	}
+}
+
+// runImport seeds the inventory from a CSV asset list.
+func runImport(args []string) {
+	fs := newFlagSet("import")
+	opts := importFlags(fs)
+	fs.Parse(args)
+	selectProfile(fs, *opts.prof)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	in := os.Stdin
+	if fs.Arg(0) != "-" {
+		f, err := os.Open(fs.Arg(0))
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		in = f
+	}
+
+	result, err := inventory.ReadCSV(in)
+	if err != nil {
+		fmt.Printf("Error reading %s: %v\n", fs.Arg(0), err)
+		os.Exit(1)
+	}
+	if len(result.Ignored) > 0 {
+		fmt.Printf("Ignoring columns: %s\n", strings.Join(result.Ignored, ", "))
+	}
+	for _, e := range result.Skipped {
+		fmt.Printf("Skipping %v\n", e)
+	}
+
+	inv, err := inventory.Load(*opts.path)
+	if err != nil {
+		fmt.Printf("Error loading inventory: %v\n", err)
+		os.Exit(1)
+	}
+
+	added, updated := 0, 0
+	for _, d := range result.Devices {
+		isNew, err := inv.Merge(d)
+		if err != nil {
+			fmt.Printf("Skipping %s: %v\n", d.IP, err)
+			continue
+		}
+		if isNew {
+			added++
+		} else {
+			updated++
+		}
+	}
+
+	fmt.Printf("%d devices added, %d updated, %d rows skipped\n", added, updated, len(result.Skipped))
+	if *opts.dryRun {
+		return
+	}
+	if err := inv.Save(*opts.path); err != nil {
+		fmt.Printf("Error saving inventory: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func describeInventoryDevice(d *inventory.Device) string {
+	desc := d.Name
+	if desc == "" {
+		desc = "(unnamed)"
+	}
+	if d.MAC != "" {
+		desc += " mac=" + d.MAC
+	}
+	if d.Owner != "" {
+		desc += fmt.Sprintf(" owner=%q", d.Owner)
+	}
+	if d.Location != "" {
+		desc += fmt.Sprintf(" location=%q", d.Location)
+	}
+	if d.ExpectedHostname != "" {
+		desc += " expects " + d.ExpectedHostname
+	}
+	if p := d.Probe; p != nil {
+		method := p.Method
+		if method == "" {
+			method = inventory.ProbeICMP
+		}
+		desc += " probe=" + method
+		if p.Port > 0 {
+			desc += ":" + strconv.Itoa(p.Port)
+		}
+		if p.Timeout > 0 {
+			desc += " timeout=" + time.Duration(p.Timeout).String()
+		}
+	}
+	for _, c := range d.Checks {
+		desc += " check=" + c.String()
+	}
+	return desc
+}
+
+// checksOptions are the flags of checks.
+type checksOptions struct {
+	path *string
+	prof *string
+}
+
+// checksFlags declares the flags of checks.
+func checksFlags(fs *flag.FlagSet) checksOptions {
+	return checksOptions{
+		path: fs.String("inventory", defaultStatePath("inventory.json"), "inventory file"),
+		prof: profileFlag(fs),
+	}
+}
+
+func runChecks(args []string) {
+	fs := newFlagSet("checks")
+	opts := checksFlags(fs)
+	fs.Parse(args)
+	selectProfile(fs, *opts.prof)
+
+	inv, err := inventory.Load(*opts.path)
+	if err != nil {
+		fmt.Printf("Error loading inventory: %v\n", err)
+		os.Exit(1)
+	}
+
+	type job struct {
+		device *inventory.Device
+		result checks.Result
+	}
+	var jobs []*job
+	for _, d := range inv.Sorted() {
+		for _, c := range d.Checks {
+			jobs = append(jobs, &job{device: d, result: checks.Result{Check: c}})
+		}
+	}
+	if len(jobs) == 0 {
+		fmt.Println("No service checks configured")
+		return
+	}
+
+	var wg sync.WaitGroup
+	for _, j := range jobs {
+		wg.Add(1)
+		go func(j *job) {
+			defer wg.Done()
+			j.result = checks.Run(context.Background(), j.device.IP, j.result.Check)
+		}(j)
+	}
+	wg.Wait()
+
+	failed := 0
+	for _, j := range jobs {
+		status := "PASS"
+		if !j.result.OK {
+			status = "FAIL"
+			failed++
+		}
+		fmt.Printf("  %-4s %-15s %-24s %9s  %s\n", status, j.device.IP, j.result.Check,
+			numfmt.RTT(j.result.Latency), j.result.Detail)
+	}
+
+	fmt.Printf("\n%d of %d checks passed\n", len(jobs)-failed, len(jobs))
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
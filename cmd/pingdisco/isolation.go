@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"pingdisco.com/pingdisco/internal/device"
+	"pingdisco.com/pingdisco/internal/netinfo"
+	"pingdisco.com/pingdisco/internal/netops"
+	"pingdisco.com/pingdisco/internal/targets"
+)
+
+// explainScan looks for reasons why a scan found nothing but this host and
+// its gateway, most commonly Wi-Fi client isolation, and returns an
+// explanation or "" when the result needs none.
+func explainScan(neighbors netops.NeighborTable, g targets.Group, devices []*device.Device) string {
+	gateway := netinfo.GatewayFor(g.Interface)
+
+	gatewayUp := false
+	for _, d := range devices {
+		switch {
+		case d.IP().Equal(g.Local):
+		case gateway != nil && d.IP().Equal(gateway):
+			gatewayUp = true
+		default:
+			return ""
+		}
+	}
+
+	var silent []string
+	for _, n := range netops.NeighborsOn(neighbors, g.Subnet) {
+		if n.Interface != "" && n.Interface != g.Interface {
+			continue
+		}
+		if gateway != nil && n.IP.Equal(gateway) {
+			gatewayUp = gatewayUp || n.Complete
+			continue
+		}
+		if n.Complete && !n.IP.Equal(g.Local) {
+			silent = append(silent, n.IP.String())
+		}
+	}
+
+	wireless := netinfo.IsWireless(g.Interface)
+
+	switch {
+	case wireless && gatewayUp && len(silent) == 0:
+		return fmt.Sprintf("Only the gateway (%s) answered. This Wi-Fi network appears to enforce client\n"+
+			"isolation: other clients cannot be reached from this device, so the network\n"+
+			"is not necessarily empty.", gateway)
+	case wireless && gatewayUp:
+		return fmt.Sprintf("%d hosts are known to ARP but did not answer ping (%s).\n"+
+			"This Wi-Fi network is likely isolating clients from each other, or the\n"+
+			"hosts block ICMP echo.", len(silent), summarizeIPs(silent))
+	case len(silent) > 0:
+		return fmt.Sprintf("%d hosts answered ARP but not ping (%s); they are\n"+
+			"present but probably block ICMP echo. Scan with --arp to include them.", len(silent), summarizeIPs(silent))
+	}
+
+	return ""
+}
+
+func summarizeIPs(ips []string) string {
+	const shown = 5
+	if len(ips) <= shown {
+		return strings.Join(ips, ", ")
+	}
+	return strings.Join(ips[:shown], ", ") + fmt.Sprintf(" and %d more", len(ips)-shown)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"runtime/debug"
+
+	"pingdisco.com/pingdisco/internal/device"
+	"pingdisco.com/pingdisco/internal/events"
+	"pingdisco.com/pingdisco/internal/scanner"
+)
+
+// Settings of --low-memory, sized for routers with 64 MB of RAM or less.
+const (
+	// lowMemoryWorkers bounds the ping processes running at once; each
+	// one costs far more than the scanner itself.
+	lowMemoryWorkers = 8
+	// lowMemoryLimit is the soft limit of the Go heap.
+	lowMemoryLimit = 16 << 20
+)
+
+// enableLowMemory makes sc stream its results instead of collecting them,
+// limits concurrent probes and makes the garbage collector keep the heap
+// small at the cost of CPU time.
+func enableLowMemory(sc *scanner.Scanner) {
+	sc.Workers = lowMemoryWorkers
+	sc.Stream = true
+	debug.SetGCPercent(20)
+	debug.SetMemoryLimit(lowMemoryLimit)
+}
+
+// streamDevices prints each device once, as soon as it has been enriched,
+// and only the count when its group finishes.
+func streamDevices(bus *events.Bus) {
+	printed := make(map[*device.Device]bool)
+	bus.On(events.DeviceEnriched, func(e events.Event) {
+		if printed[e.Device] {
+			return
+		}
+		printed[e.Device] = true
+		fmt.Println(formatDevice(e.Device))
+	})
+	bus.On(events.ScanFinished, func(e events.Event) {
+		for _, d := range e.Devices {
+			delete(printed, d)
+		}
+		fmt.Printf("\nTotal online devices: %d\n", len(e.Devices))
+	})
+}
@@ -1,44 +1,760 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"log"
 	"net"
 	"os"
-	"os/exec"
+	"os/signal"
 	"runtime"
+	"slices"
 	"sort"
-	"sync"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"pingdisco.com/pingdisco/internal/ad"
+	"pingdisco.com/pingdisco/internal/device"
+	"pingdisco.com/pingdisco/internal/dhcp"
+	"pingdisco.com/pingdisco/internal/diagnose"
+	"pingdisco.com/pingdisco/internal/events"
+	"pingdisco.com/pingdisco/internal/hysteresis"
+	"pingdisco.com/pingdisco/internal/icon"
+	"pingdisco.com/pingdisco/internal/inventory"
+	"pingdisco.com/pingdisco/internal/localdns"
+	"pingdisco.com/pingdisco/internal/maintenance"
+	"pingdisco.com/pingdisco/internal/netinfo"
+	"pingdisco.com/pingdisco/internal/netops"
+	"pingdisco.com/pingdisco/internal/numfmt"
+	"pingdisco.com/pingdisco/internal/oui"
+	"pingdisco.com/pingdisco/internal/overlay"
+	"pingdisco.com/pingdisco/internal/portscan"
+	"pingdisco.com/pingdisco/internal/proxy"
+	"pingdisco.com/pingdisco/internal/scanner"
+	"pingdisco.com/pingdisco/internal/snmp"
+	"pingdisco.com/pingdisco/internal/store"
+	"pingdisco.com/pingdisco/internal/targets"
+	"pingdisco.com/pingdisco/internal/telemetry"
+	"pingdisco.com/pingdisco/internal/term"
+	"pingdisco.com/pingdisco/internal/timefmt"
+	"pingdisco.com/pingdisco/internal/upstream"
 )
 
 type NetworkInterface struct {
-	Name   string
-	IPNet  *net.IPNet
-	IP     net.IP
+	Name  string
+	IPNet *net.IPNet
+	IP    net.IP
 }
 
-type Device struct {
-	IP       net.IP
-	Online   bool
-	Hostname string
-}
+var version = "dev"
+
+// errNotInBuild is returned by features left out of this build by its
+// build tags.
+var errNotInBuild = errors.New("not in this build")
 
 func main() {
+	args := os.Args[1:]
+
+	name := "scan"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	} else if len(args) > 0 && (args[0] == "--version" || args[0] == "-version") {
+		name, args = "version", args[1:]
+	}
+
+	if err := timefmt.SetZone(os.Getenv("PINGDISCO_TZ")); err != nil {
+		fmt.Printf("Error: PINGDISCO_TZ: %v\n", err)
+		os.Exit(2)
+	}
+	if err := numfmt.SetRTTUnit(os.Getenv("PINGDISCO_RTT_UNIT")); err != nil {
+		fmt.Printf("Error: PINGDISCO_RTT_UNIT: %v\n", err)
+		os.Exit(2)
+	}
+	if err := numfmt.SetNumberFormat(os.Getenv("PINGDISCO_NUMBER_FORMAT")); err != nil {
+		fmt.Printf("Error: PINGDISCO_NUMBER_FORMAT: %v\n", err)
+		os.Exit(2)
+	}
+	log.SetFlags(0)
+	log.SetOutput(timefmt.LogWriter{W: os.Stderr})
+
+	c := lookupCommand(name)
+	if c == nil && strings.ContainsAny(name, "./:") {
+		// "pingdisco 10.0.0.0/24" scans the targets given.
+		c, args = lookupCommand("scan"), append([]string{name}, args...)
+	}
+	if c == nil {
+		fmt.Printf("Error: unknown command %q\n\n", name)
+		printCommands(os.Stdout)
+		os.Exit(2)
+	}
+	c.run(args)
+}
+
+// scanOptions are the flags of scan.
+type scanOptions struct {
+	inventoryPath    *string
+	prof             *string
+	offline          *scanner.OfflinePolicy
+	probeLogOpts     probeLogOptions
+	timeout          *time.Duration
+	samples          *int
+	portList         *string
+	topPorts         *int
+	echoCount        *int
+	withUpstream     *bool
+	upstreamOpts     *upstream.Options
+	arp              *bool
+	withSSDP         *bool
+	concurrency      *int
+	deadline         *time.Duration
+	rate             *int
+	ipv6             *bool
+	routed           *bool
+	ptrZones         *bool
+	rdnsRate         *int
+	withOverlay      *bool
+	targetsFile      *string
+	large            *bool
+	proxyURL         *string
+	proxyPorts       *string
+	snmpRouter       *string
+	withTopology     *bool
+	audit            *bool
+	withSNMP         *bool
+	snmpCreds        *snmpCredentials
+	storeURL         *string
+	note             *string
+	noExternal       *bool
+	adOpts           adOptions
+	reservationsPath *string
+	otlpEndpoint     *string
+	experimental     *string
+	output           *string
+	watch            *bool
+	interval         *time.Duration
+	serve            *string
+	notifyOpts       *notifyOptions
+	knownPath        *string
+	downAfter        *int
+	upAfter          *int
+	diagnoseOffline  *bool
+	maintenanceFile  *string
+	showProgress     *autoBool
+	tuiMode          *bool
+	metricsListen    *string
+	lowMemory        *bool
+}
+
+// scanFlags declares the flags of scan.
+func scanFlags(fs *flag.FlagSet) scanOptions {
+	interfaceFlags(fs)
+	iconsFlag(fs)
+	displayFlags(fs)
+	progressFlag := new(autoBool)
+	fs.Var(progressFlag, "progress", "show the hosts probed, responses so far and time left on stderr while scanning: true, false, or auto for when stderr is a terminal")
+	return scanOptions{
+		inventoryPath:    fs.String("inventory", defaultStatePath("inventory.json"), "inventory of known devices and their probe overrides"),
+		prof:             profileFlag(fs),
+		offline:          offlineFlags(fs),
+		probeLogOpts:     probeLogFlags(fs),
+		timeout:          fs.Duration("timeout", scanner.DefaultProbe.Timeout, "how long to wait for the answer to each probe; raise it for slow links and sleepy IoT devices"),
+		samples:          fs.Int("count", 0, "time N echo requests to each responding host and report min/avg/max round-trip time, jitter and loss"),
+		portList:         fs.String("ports", "", "try these TCP ports on each responding host and list the open ones, e.g. 22,80,443,8000-8100"),
+		topPorts:         fs.Int("top-ports", 0, "try the N most commonly open TCP ports (at most 100) on each responding host"),
+		echoCount:        fs.Int("echo-stats", 0, "send N extra echo requests to each responding host and report duplicate and late replies"),
+		withUpstream:     fs.Bool("upstream", false, "append the upstream topology (gateway WAN address, public IP, NAT layers) to the report"),
+		upstreamOpts:     upstreamFlags(fs),
+		arp:              fs.Bool("arp", false, "also send ARP requests on directly attached subnets, finding hosts that drop ping"),
+		withSSDP:         fs.Bool("ssdp", false, "also search directly attached subnets for UPnP devices over SSDP and read their name, maker and model"),
+		concurrency:      fs.Int("concurrency", scanner.DefaultWorkers, "probe at most N hosts at once (default 8 with --low-memory)"),
+		deadline:         fs.Duration("deadline", 0, "aim to finish the scan within this time, e.g. 30s, leaving out retries and enrichment as it runs short and reporting what was left out (0: no limit)"),
+		rate:             fs.Int("rate", 0, "probe at most N hosts per second, to stay below intrusion detection thresholds (0: unlimited, slower on weak links)"),
+		ipv6:             fs.Bool("ipv6", false, "also find IPv6 hosts on each interface by multicast ping and the NDP neighbor table"),
+		routed:           fs.Bool("routed", false, "also scan other private subnets found in the routing table"),
+		ptrZones:         fs.Bool("ptr-zones", true, "look up the names of private addresses at the DNS server holding their reverse zone, such as an Active Directory domain controller, found from the system's DNS servers"),
+		rdnsRate:         fs.Int("rdns-rate", localdns.DefaultRate, "send at most N reverse DNS queries per second to the server of a reverse zone (with --ptr-zones)"),
+		withOverlay:      fs.Bool("overlay", true, "ask the local Tailscale and ZeroTier clients for their peers, naming them, and scan the Tailscale peers too"),
+		targetsFile:      fs.String("targets-file", "", "scan the subnets, ranges, addresses and host names in this file, one per line, instead of the local subnets"),
+		large:            fs.Bool("large", false, fmt.Sprintf("scan subnets and ranges given as targets with more than %d addresses, such as a /8, which takes hours and a lot of memory", targets.MaxAddresses)),
+		proxyURL:         fs.String("proxy", "", "probe over TCP through this SOCKS5 proxy or SSH jump host, e.g. socks5://10.0.0.1:1080 or ssh://admin@bastion, to scan a remote subnet that cannot be pinged (needs explicit targets)"),
+		proxyPorts:       fs.String("proxy-ports", "22,80,135,443,445,3389,8080", "TCP ports tried on each host with --proxy; a host is up if one accepts or refuses the connection"),
+		snmpRouter:       fs.String("snmp-router", "", "router to read ARP and routing tables from over SNMP, seeding hosts and subnets to scan"),
+		withTopology:     fs.Bool("topology", false, "trace the route to each device beyond the local subnets, up to --max-hops, and report which gateways the devices sit behind"),
+		audit:            fs.Bool("audit", false, "confirm each device by a second, independent signal (ARP, ICMP or TCP) and mark those seen by one only, which a middlebox may have answered for"),
+		withSNMP:         fs.Bool("snmp", false, "also ask each responding host over SNMP for its name, description, location and interface count, labelling network gear"),
+		snmpCreds:        snmpFlags(fs),
+		storeURL:         fs.String("store", defaultStore(), "save the scan to this store, e.g. sqlite:scans.db, bolt:scans.bolt or memory: (\"\" to keep no history)"),
+		note:             fs.String("note", "", "note saved with the scan, e.g. \"after switch firmware upgrade\" (with --store)"),
+		noExternal:       fs.Bool("no-external", false, "do not contact external services for the public IP and ISP header or the captive portal check"),
+		adOpts:           adFlags(fs),
+		reservationsPath: fs.String("reservations", "", "compare the devices found with the DHCP reservations in this file (dnsmasq, ISC dhcpd, OpenWrt or CSV)"),
+		otlpEndpoint:     fs.String("otlp-endpoint", "", "export traces and metrics of the scan phases to this OpenTelemetry collector, e.g. http://localhost:4318 (default $OTEL_EXPORTER_OTLP_ENDPOINT)"),
+		experimental:     experimentalFlag(fs),
+		output:           fs.String("output", outputTable, "output format: table, json or csv; json and csv results alone go to stdout, everything else to stderr"),
+		watch:            fs.Bool("watch", false, "keep scanning every --interval and print the devices that came online, went offline or changed hostname"),
+		interval:         fs.Duration("interval", time.Minute, "time between scans with --watch"),
+		serve:            fs.String("serve", "", "serve a live dashboard of the devices found on this address, e.g. :8080, rescanning every --interval (implies --watch)"),
+		notifyOpts:       notifyFlags(fs),
+		knownPath:        fs.String("known", defaultStatePath("known-devices.json"), "file remembering the devices seen so far, to notify about new ones with --watch"),
+		downAfter:        fs.Int("down-after", 2, "consecutive scans a device must be missing from before --watch alerts that it went offline"),
+		upAfter:          fs.Int("up-after", 1, "consecutive scans a device must be found in before --watch alerts that it is online again"),
+		diagnoseOffline:  fs.Bool("diagnose", true, "check why a device went offline and add the probable cause to the --watch alert"),
+		maintenanceFile:  fs.String("maintenance", "", "JSON file of maintenance windows during which --watch does not alert about devices going offline or coming online"),
+		tuiMode:          fs.Bool("tui", false, "show the devices in a live table, sortable and filterable, rescanning every --interval (implies --watch)"),
+		metricsListen:    fs.String("metrics-listen", "", "serve Prometheus metrics of the devices found on this address, e.g. :9155, rescanning every --interval (implies --watch)"),
+		lowMemory:        fs.Bool("low-memory", os.Getenv("PINGDISCO_LOW_MEMORY") != "", "for routers and other small devices: probe few hosts at once, print devices as they are found and keep no history"),
+		showProgress:     progressFlag,
+	}
+}
+
+func runScan(args []string) {
+	fs := newFlagSet("scan")
+	opts := scanFlags(fs)
+	usage := fs.Usage
+	fs.Usage = func() {
+		usage()
+		fmt.Fprintln(fs.Output())
+		printCommands(fs.Output())
+	}
+	targetArgs := parseInterspersed(fs, args)
+	explicit := len(targetArgs) > 0 || *opts.targetsFile != ""
+
+	if *opts.output != outputTable && *opts.output != outputJSON && *opts.output != outputCSV {
+		fmt.Printf("Error: unknown output format %q; use table, json or csv\n", *opts.output)
+		os.Exit(2)
+	}
+	if *opts.concurrency < 1 {
+		fmt.Println("Error: --concurrency must be at least 1")
+		os.Exit(2)
+	}
+	if *opts.rate < 0 {
+		fmt.Println("Error: --rate must not be negative")
+		os.Exit(2)
+	}
+	if *opts.deadline < 0 {
+		fmt.Println("Error: --deadline must not be negative")
+		os.Exit(2)
+	}
+	if *opts.samples < 0 {
+		fmt.Println("Error: --count must not be negative")
+		os.Exit(2)
+	}
+	if *opts.portList != "" && *opts.topPorts != 0 {
+		fmt.Println("Error: --ports and --top-ports cannot be combined")
+		os.Exit(2)
+	}
+	var snmpClient *snmp.Client
+	if *opts.withSNMP {
+		var err error
+		if snmpClient, err = opts.snmpCreds.client(""); err != nil {
+			fmt.Printf("Error: --snmp: %v\n", err)
+			os.Exit(2)
+		}
+		// Most hosts run no agent; do not wait long for them.
+		snmpClient.Timeout = time.Second
+	}
+	var ports []int
+	if *opts.portList != "" {
+		var err error
+		if ports, err = portscan.Parse(*opts.portList); err != nil {
+			fmt.Printf("Error: --ports: %v\n", err)
+			os.Exit(2)
+		}
+	} else if *opts.topPorts != 0 {
+		var err error
+		if ports, err = portscan.Top(*opts.topPorts); err != nil {
+			fmt.Printf("Error: --top-ports: %v\n", err)
+			os.Exit(2)
+		}
+	}
+	var tcpPorts []int
+	if *opts.proxyURL != "" {
+		if !explicit {
+			fmt.Println("Error: --proxy needs targets to scan, e.g. pingdisco scan --proxy ssh://bastion 10.20.0.0/24")
+			os.Exit(2)
+		}
+		if *opts.arp || *opts.ipv6 || *opts.withSSDP || *opts.withSNMP || *opts.withTopology || *opts.echoCount > 0 || *opts.samples > 0 {
+			fmt.Println("Error: --proxy carries TCP alone; it cannot be combined with --arp, --ipv6, --ssdp, --snmp, --topology, --echo-stats or --count")
+			os.Exit(2)
+		}
+		var err error
+		if tcpPorts, err = portscan.Parse(*opts.proxyPorts); err != nil {
+			fmt.Printf("Error: --proxy-ports: %v\n", err)
+			os.Exit(2)
+		}
+	}
+	if *opts.timeout <= 0 {
+		fmt.Println("Error: --timeout must be positive")
+		os.Exit(2)
+	}
+	if err := targets.CIDRs(targetArgs).Validate(); errors.Is(err, targets.ErrTooLarge) && !*opts.large {
+		fmt.Printf("Error: %v\nPass --large to scan it anyway.\n", err)
+		os.Exit(2)
+	}
+	if *opts.lowMemory && *opts.output != outputTable {
+		fmt.Println("Error: --output is not available with --low-memory")
+		os.Exit(2)
+	}
+	if *opts.serve != "" || *opts.metricsListen != "" || *opts.tuiMode {
+		*opts.watch = true
+	}
+	if *opts.watch && *opts.interval <= 0 {
+		fmt.Println("Error: --interval must be positive")
+		os.Exit(2)
+	}
+	if *opts.watch && (*opts.output != outputTable || *opts.lowMemory) {
+		fmt.Println("Error: --watch is not available with --output or --low-memory")
+		os.Exit(2)
+	}
+	if *opts.withTopology && *opts.watch {
+		fmt.Println("Error: --topology is not available with --watch")
+		os.Exit(2)
+	}
+	if *opts.withTopology && (opts.upstreamOpts.MaxHops < 1 || opts.upstreamOpts.MaxHops > 255) {
+		fmt.Println("Error: --max-hops must be between 1 and 255")
+		os.Exit(2)
+	}
+	if *opts.tuiMode && (!term.IsTerminal(os.Stdin) || !term.IsTerminal(os.Stdout)) {
+		fmt.Println("Error: --tui needs a terminal")
+		os.Exit(2)
+	}
+	notifySet := false
+	fs.Visit(func(f *flag.Flag) { notifySet = notifySet || strings.HasPrefix(f.Name, "notify-") })
+	if notifySet && !*opts.watch {
+		fmt.Println("Error: --notify-webhook, --notify-exec and --notify-config need --watch")
+		os.Exit(2)
+	}
+	// Machine-readable results get stdout to themselves so they can be
+	// piped; progress, notes and errors go to stderr.
+	results := os.Stdout
+	if *opts.output != outputTable {
+		os.Stdout = os.Stderr
+	}
+	selectProfile(fs, *opts.prof)
+
+	if *opts.lowMemory {
+		storeSet := false
+		fs.Visit(func(f *flag.Flag) { storeSet = storeSet || f.Name == "store" })
+		if storeSet && *opts.storeURL != "" {
+			fmt.Println("Error: --store is not available with --low-memory")
+			os.Exit(2)
+		}
+		*opts.storeURL = ""
+	}
+	if *opts.note != "" && *opts.storeURL == "" {
+		fmt.Println("Error: --note needs --store")
+		os.Exit(2)
+	}
+	if *opts.lowMemory && *opts.reservationsPath != "" {
+		fmt.Println("Error: --reservations is not available with --low-memory")
+		os.Exit(2)
+	}
+
+	var reservations []dhcp.Reservation
+	if *opts.reservationsPath != "" {
+		var err error
+		reservations, err = dhcp.Load(*opts.reservationsPath)
+		if err != nil {
+			fmt.Printf("Error loading DHCP reservations: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	probe := scanner.DefaultProbe
+	probe.Timeout = *opts.timeout
+	probe.Offline = *opts.offline
+	probe.EchoStats = *opts.echoCount
+	probe.Samples = *opts.samples
+	probe.Ports = ports
+	probeLog, err := opts.probeLogOpts.open()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer probeLog.Close()
+	probe.Log = probeLog
+	exp := parseExperiments(*opts.experimental)
+
+	inv, err := inventory.Load(*opts.inventoryPath)
+	if err != nil {
+		fmt.Printf("Error loading inventory: %v\n", err)
+		os.Exit(1)
+	}
+
+	ops := netops.System()
+	caps := detectCapabilities(ops, *opts.snmpRouter, !*opts.noExternal)
+
 	fmt.Println("Network Visualization Tool")
 	fmt.Println("==========================")
 
+	var portal upstream.Portal
+	if !*opts.noExternal {
+		printPublicIP(opts.upstreamOpts.PublicIPURL)
+		portal = checkCaptivePortal(opts.upstreamOpts.CaptivePortalURL)
+	}
+
 	interfaces, err := getNetworkInterfaces()
 	if err != nil {
 		fmt.Printf("Error getting network interfaces: %v\n", err)
 		os.Exit(1)
 	}
+	if len(interfaces) == 0 && !explicit && describeInterfaceFilter() != "" {
+		fmt.Printf("Error: no active interface matches %s\n", describeInterfaceFilter())
+		os.Exit(1)
+	}
+	if *opts.ptrZones {
+		if zr := useReverseZones(ops, *opts.rdnsRate); zr != nil && !explicit {
+			for _, zone := range reverseZones(zr, interfaces) {
+				fmt.Printf("\nReverse DNS: %s\n", zone)
+			}
+		}
+	}
+	adaptToNAT64(ops)
+	if len(interfaces) == 0 && !explicit && !*opts.ipv6 {
+		// An IPv6-only network leaves nothing to sweep over IPv4.
+		fmt.Println("\nNo IPv4 interfaces: finding the hosts of the IPv6 links instead (--ipv6)")
+		*opts.ipv6 = true
+	}
+
+	var seed *snmpSeed
+	if *opts.snmpRouter != "" {
+		seed, err = loadSNMPSeed(*opts.snmpRouter, opts.snmpCreds)
+		if err != nil {
+			fmt.Printf("Error reading router tables: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("\nSNMP: %d ARP entries and %d subnets from %s\n", len(seed.hosts), len(seed.subnets), seed.router)
+	}
+
+	var computers []ad.Computer
+	if *opts.adOpts.url != "" {
+		computers, err = opts.adOpts.loadComputers()
+		if err != nil {
+			fmt.Printf("Error reading Active Directory: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("\nActive Directory: %s from %s\n", count(len(computers), "computer account"), *opts.adOpts.url)
+	}
+
+	tracer := telemetry.FromEnv(*opts.otlpEndpoint, "pingdisco", version)
+	// Ctrl-C stops probing and shows what was found so far; a second one
+	// kills the process.
+	sigCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	context.AfterFunc(sigCtx, stop)
+	ctx, span := tracer.Start(sigCtx, "scan")
+
+	if *opts.proxyURL != "" {
+		// Only TCP crosses the proxy: hosts are found by connecting to
+		// them, and nothing is asked of the local links.
+		dialer, err := proxy.Open(sigCtx, *opts.proxyURL)
+		if err != nil {
+			fmt.Printf("Error opening proxy: %v\n", err)
+			os.Exit(1)
+		}
+		ops.Dialer = dialer
+		ops.Pinger = netops.TCPPinger{Dialer: dialer, Ports: tcpPorts}
+		ops.ARP, ops.Local, ops.NDP, ops.Links = nil, nil, nil, nil
+		fmt.Printf("\nProxy: %s, probing TCP ports %s\n", proxy.Redacted(*opts.proxyURL), portscan.Format(tcpPorts))
+	}
+
+	var overlays *overlay.Directory
+	if *opts.withOverlay && *opts.proxyURL == "" {
+		overlays = overlay.Load(ctx, ops.Runner)
+	}
 
-	for _, iface := range interfaces {
-		fmt.Printf("\nInterface: %s (%s)\n", iface.Name, iface.IP.String())
-		fmt.Printf("Network: %s\n", iface.IPNet.String())
+	sc := &scanner.Scanner{Probe: probe, Inventory: inv, Ops: ops, Bus: events.New(), Tracer: tracer, Experiments: exp, ARP: *opts.arp, SSDP: *opts.withSSDP, SNMP: snmpClient, Workers: *opts.concurrency, Rate: *opts.rate, Budget: *opts.deadline, Audit: *opts.audit, Overlay: overlays}
+	if names := exp.Names(); len(names) > 0 {
+		fmt.Printf("\nExperimental: %s\n", strings.Join(names, ", "))
+	}
+	// Subscribed first, the progress line is cleared before any other
+	// handler prints.
+	var prog *progress
+	if opts.showProgress.Get(func() bool { return term.IsTerminal(os.Stderr) }) && !*opts.tuiMode {
+		prog = showProgress(sc.Bus, os.Stderr, *opts.lowMemory)
+	}
+	// wifi is the network of the first Wi-Fi interface scanned, recorded
+	// with the scan so scans of different networks are kept apart.
+	var wifi netinfo.WiFi
+	sc.Bus.On(events.ScanStarted, func(e events.Event) {
+		fmt.Printf("\n%s\n", e.Group.Name)
+		if desc := overlays.Describe(e.Group.Interface); desc != "" {
+			fmt.Printf("Overlay: %s\n", desc)
+		}
+		if e.Group.Interface != "" && wifi.SSID == "" {
+			if wifi = netinfo.WiFiOf(e.Group.Interface); wifi.SSID != "" {
+				fmt.Printf("Wi-Fi: %s\n", describeWiFi(wifi.SSID, wifi.BSSID))
+			}
+		}
 		fmt.Println("Scanning for devices...")
+		if e.Pace > 0 {
+			fmt.Printf("Probing %s: %s\n", describePace(e.Pace), e.PaceReason)
+		}
+	})
+	sc.Bus.On(events.ScanSkipped, func(e events.Event) {
+		fmt.Printf("\n%s\n", e.Group.Name)
+		fmt.Printf("Skipped: %s\n", e.Group.Skip)
+	})
+	if *opts.lowMemory {
+		enableLowMemory(sc)
+		streamDevices(sc.Bus)
+		fs.Visit(func(f *flag.Flag) {
+			if f.Name == "concurrency" {
+				sc.Workers = *opts.concurrency
+			}
+		})
+	}
+	// dual holds the hosts listed under IPv4 that the IPv6 group being
+	// scanned found as well.
+	var dual []*device.Device
+	sc.Bus.On(events.DeviceEnriched, func(e events.Event) {
+		if e.Group.IPv6() && e.Device.DualStack() && !slices.Contains(dual, e.Device) {
+			dual = append(dual, e.Device)
+		}
+	})
+	var scanned []*net.IPNet
+	var scannedTargets []string
+	sc.Bus.On(events.ScanFinished, func(e events.Event) {
+		if !*opts.lowMemory && *opts.output == outputTable {
+			if len(e.Devices) > 0 || len(dual) == 0 {
+				displayDevices(e.Devices)
+			}
+			if len(dual) > 0 {
+				displayDualStack(dual)
+			}
+		}
+		dual = nil
+		if e.Group.Subnet != nil {
+			scanned = append(scanned, e.Group.Subnet)
+			scannedTargets = append(scannedTargets, e.Group.Subnet.String())
+		} else {
+			scannedTargets = append(scannedTargets, e.Group.Name)
+		}
+		if e.Group.Interface == "" || e.Group.IPv6() {
+			return
+		}
+		if note := explainScan(sc.Ops.Neighbors, e.Group, e.Devices); note != "" {
+			fmt.Printf("\nNote: %s\n", note)
+		}
+	})
+
+	// With --watch, each scan is saved as it completes instead.
+	var save func()
+	if *opts.storeURL != "" && !*opts.watch {
+		save = recordScan(sc, *opts.storeURL, *opts.note, &wifi)
+	}
+
+	sources := []targets.Source{interfaceSource(interfaces)}
+	if *opts.watch {
+		sources = []targets.Source{liveInterfaceSource()}
+	}
+	if explicit {
+		limit := targets.MaxAddresses
+		if *opts.large {
+			limit = 0
+		}
+		sources = []targets.Source{targets.SourceFunc(func(ctx context.Context) ([]targets.Group, error) {
+			return targets.CIDRs(targetArgs).GroupsUpTo(ctx, limit)
+		})}
+		if *opts.targetsFile != "" {
+			sources = append(sources, targets.SourceFunc(func(ctx context.Context) ([]targets.Group, error) {
+				return targets.File(*opts.targetsFile).GroupsUpTo(ctx, limit)
+			}))
+		}
+	}
+	if *opts.ipv6 {
+		v6, err := getIPv6Interfaces()
+		if err != nil {
+			fmt.Printf("Error getting IPv6 interface addresses: %v\n", err)
+			os.Exit(1)
+		}
+		sources = append(sources, interfaceSource(v6))
+	}
+	routes := routedSubnets(interfaces)
+	if seed != nil {
+		routes = seed.routes(routes, interfaces)
+	}
+	if *opts.routed || seed != nil {
+		sources = append(sources, routeSource(routes))
+	}
+	if seed != nil {
+		sources = append(sources, seed.hostSource())
+	}
+	if len(overlays.TailscaleHosts()) > 0 && !explicit {
+		sources = append(sources, tailscaleSource(overlays))
+	}
+
+	var alerts *scanAlerts
+	if *opts.watch {
+		notifiers, err := opts.notifyOpts.build()
+		if err != nil {
+			fmt.Printf("Error loading notifiers: %v\n", err)
+			os.Exit(1)
+		}
+		if len(notifiers) > 0 {
+			known, err := loadKnownDevices(*opts.knownPath)
+			if err != nil {
+				fmt.Printf("Error loading known devices: %v\n", err)
+				os.Exit(1)
+			}
+			alerts = newScanAlerts(notifiers, known)
+			alerts.hysteresis = hysteresis.Tracker{DownAfter: *opts.downAfter, UpAfter: *opts.upAfter}
+			if *opts.maintenanceFile != "" {
+				alerts.schedule, err = maintenance.Load(*opts.maintenanceFile)
+				if err != nil {
+					fmt.Printf("Error loading maintenance windows: %v\n", err)
+					os.Exit(1)
+				}
+			}
+			if *opts.diagnoseOffline {
+				checker := diagnose.Checker{Ops: sc.Ops, Timeout: *opts.timeout}
+				alerts.diagnose = func(ctx context.Context, d *device.Device) string {
+					ports := diagnosePorts(inv.Lookup(d.IP().String()))
+					return checker.Diagnose(ctx, diagnose.Target{IP: d.IP(), MAC: d.MAC, Ports: ports}).String()
+				}
+			}
+		}
+	}
+
+	var hooks []func(store.Scan)
+	if *opts.watch && *opts.storeURL != "" {
+		hooks = append(hooks, func(scan store.Scan) {
+			if _, err := saveScan(*opts.storeURL, scan); err != nil {
+				log.Printf("saving scan: %v", err)
+			}
+		})
+	}
+	if *opts.serve != "" {
+		update, err := serveDashboard(sigCtx, *opts.serve, *opts.storeURL)
+		if err != nil {
+			fmt.Printf("Error serving the dashboard: %v\n", err)
+			if errors.Is(err, errNotInBuild) {
+				os.Exit(2)
+			}
+			os.Exit(1)
+		}
+		hooks = append(hooks, update)
+	}
+	if *opts.metricsListen != "" {
+		update, err := serveMetrics(sigCtx, *opts.metricsListen)
+		if err != nil {
+			fmt.Printf("Error serving metrics: %v\n", err)
+			if errors.Is(err, errNotInBuild) {
+				os.Exit(2)
+			}
+			os.Exit(1)
+		}
+		hooks = append(hooks, update)
+	}
+	if alerts != nil {
+		hooks = append(hooks, alerts.update)
+	}
+	if sc.Probe.Log != nil {
+		hooks = append(hooks, func(store.Scan) { sc.Probe.Log.Flush() })
+	}
+	onScan := func(scan store.Scan) {
+		for _, hook := range hooks {
+			hook(scan)
+		}
+	}
+
+	if *opts.tuiMode {
+		// The table runs the scans itself, the first one included.
+		span.End()
+		err := runTUI(sigCtx, sc, sources, *opts.interval, ports, onScan)
+		if alerts != nil {
+			alerts.close()
+		}
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	started := time.Now()
+	devices, err := sc.Run(ctx, sources...)
+	if prog != nil {
+		prog.clear()
+	}
+	sc.Probe.Log.Flush()
+	span.SetAttr("devices", len(devices))
+	span.End()
+	if err := tracer.Flush(context.Background()); err != nil {
+		fmt.Printf("Warning: exporting telemetry: %v\n", err)
+	}
+	interrupted := sigCtx.Err() != nil
+	if err != nil && !interrupted {
+		fmt.Printf("Error scanning: %v\n", err)
+		if errors.Is(err, targets.ErrTooLarge) {
+			fmt.Println("Pass --large to scan it anyway.")
+			os.Exit(2)
+		}
+		os.Exit(1)
+	}
+	if !*opts.routed && seed == nil && !explicit && !interrupted {
+		listRoutes(routes)
+	}
+	// Traced before saving, so that the saved devices carry their place
+	// in the topology.
+	var topoMap *topologyMap
+	if *opts.withTopology && !interrupted {
+		topoMap = traceTopology(sigCtx, devices, interfaces, opts.upstreamOpts.MaxHops, *opts.timeout)
+	}
+	if save != nil && !interrupted {
+		save()
+	}
+	if *opts.output != outputTable {
+		if err := writeScanOutput(results, *opts.output, started, time.Now(), scannedTargets, wifi, devices); err != nil {
+			fmt.Printf("Error writing results: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if interrupted {
+		fmt.Println("\nInterrupted: the results are partial and were not saved.")
+		os.Exit(130)
+	}
+
+	if skipped := sc.Skipped(); len(skipped) > 0 {
+		printSkipped(*opts.deadline, skipped)
+	}
+	if *opts.audit && *opts.output == outputTable {
+		printAudit(devices)
+	}
+
+	if portal.Detected {
+		fmt.Printf("\nWarning: a captive portal was in the way (%s); sign in and scan again if devices are missing.\n", portal.String())
+	}
 
-		devices := scanSubnet(iface.IPNet)
-		displayDevices(devices)
+	if reservations != nil {
+		printReservations(reservations, devices, scanned)
+	}
+	if *opts.adOpts.url != "" {
+		printADReport(computers, devices, scanned)
+	}
+	if topoMap != nil {
+		printTopology(topoMap)
+	}
+
+	if *opts.withUpstream {
+		printUpstream(*opts.upstreamOpts)
+	}
+
+	printCapabilities(caps)
+
+	if *opts.watch {
+		first := store.Scan{StartedAt: started, FinishedAt: time.Now(), Targets: scannedTargets, Note: *opts.note, SSID: wifi.SSID, BSSID: wifi.BSSID, Devices: devices}
+		onScan(first)
+		watchScan(sigCtx, sc, sources, *opts.interval, first, onScan)
+		if alerts != nil {
+			alerts.close()
+		}
 	}
 }
 
@@ -51,7 +767,7 @@ func getNetworkInterfaces() ([]NetworkInterface, error) {
 	}
 
 	for _, iface := range ifaces {
-		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 || !interfaceSelected(iface.Name) {
 			continue
 		}
 
@@ -74,97 +790,325 @@ func getNetworkInterfaces() ([]NetworkInterface, error) {
 	return interfaces, nil
 }
 
-func scanSubnet(ipnet *net.IPNet) []Device {
-	var devices []Device
-	var wg sync.WaitGroup
-	var mu sync.Mutex
+// describeWiFi names a Wi-Fi network by SSID and access point.
+func describeWiFi(ssid, bssid string) string {
+	if bssid == "" {
+		return ssid
+	}
+	return fmt.Sprintf("%s (access point %s)", ssid, bssid)
+}
+
+// describePace says how fast probes a gap apart are sent.
+func describePace(gap time.Duration) string {
+	if gap >= time.Second {
+		return "a host every " + gap.Round(100*time.Millisecond).String()
+	}
+	return fmt.Sprintf("%d hosts/s", time.Second/gap)
+}
+
+// spreadWindow is the part of a scan interval that probes are spread
+// across with --spread. The last fifth is left for the final probes to
+// time out and the results to be processed before the next scan.
+func spreadWindow(interval time.Duration) time.Duration {
+	return interval - interval/5
+}
+
+// getIPv6Interfaces returns the IPv6 addresses of the interfaces that are
+// up, each standing for a prefix on its link. Link-local ones come last, so
+// hosts are listed under their global prefix and their link-local
+// addresses are folded into them.
+func getIPv6Interfaces() ([]NetworkInterface, error) {
+	var interfaces []NetworkInterface
+
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
 
-	ip := ipnet.IP.Mask(ipnet.Mask)
-	for ip := ip.Mask(ipnet.Mask); ipnet.Contains(ip); incrementIP(ip) {
-		if ip[3] == 0 || ip[3] == 255 {
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 || iface.Flags&net.FlagMulticast == 0 || !interfaceSelected(iface.Name) {
 			continue
 		}
 
-		wg.Add(1)
-		go func(targetIP net.IP) {
-			defer wg.Done()
-			online := pingHost(targetIP.String())
-			
-			if online {
-				hostname := resolveHostname(targetIP.String())
-				mu.Lock()
-				devices = append(devices, Device{
-					IP:       make(net.IP, len(targetIP)),
-					Online:   online,
-					Hostname: hostname,
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+
+		for _, addr := range addrs {
+			if ipnet, ok := addr.(*net.IPNet); ok && ipnet.IP.To4() == nil {
+				interfaces = append(interfaces, NetworkInterface{
+					Name:  iface.Name,
+					IPNet: ipnet,
+					IP:    ipnet.IP,
 				})
-				copy(devices[len(devices)-1].IP, targetIP)
-				mu.Unlock()
 			}
-		}(append(net.IP(nil), ip...))
+		}
+	}
+
+	sort.SliceStable(interfaces, func(i, j int) bool {
+		return !interfaces[i].IP.IsLinkLocalUnicast() && interfaces[j].IP.IsLinkLocalUnicast()
+	})
+	return interfaces, nil
+}
+
+func displayDevices(devices []*device.Device) {
+	if len(devices) == 0 {
+		fmt.Println("\nNo online devices found")
+		return
+	}
+
+	fmt.Println("\nOnline devices:")
+	fmt.Println("---------------")
+
+	for _, d := range devices {
+		fmt.Println(formatDevice(d))
 	}
 
-	wg.Wait()
-	
+	fmt.Printf("\nTotal online devices: %s\n", numfmt.Int(len(devices)))
+}
+
+// displayDualStack lists the hosts found over IPv6 that were already
+// listed under IPv4, with the round-trip time of each family.
+func displayDualStack(devices []*device.Device) {
 	sort.Slice(devices, func(i, j int) bool {
-		return devices[i].IP[3] < devices[j].IP[3]
+		return bytes.Compare(devices[i].IP(), devices[j].IP()) < 0
 	})
+	fmt.Println("\nAlso on IPv6 (listed under IPv4 above):")
+	for _, d := range devices {
+		fmt.Println(formatDevice(d))
+	}
+}
+
+// showIcons puts a glyph of the device type in front of each device in
+// lists; set by --icons.
+var showIcons bool
 
-	return devices
+func iconsFlag(fs *flag.FlagSet) {
+	fs.BoolVar(&showIcons, "icons", unicodeTerminal(), "show an icon of the device type in device lists (default: on UTF-8 terminals)")
 }
 
-func incrementIP(ip net.IP) {
-	for j := len(ip) - 1; j >= 0; j-- {
-		ip[j]++
-		if ip[j] > 0 {
-			break
+// unicodeTerminal reports whether stdout is a terminal likely to show
+// emoji.
+func unicodeTerminal() bool {
+	if info, err := os.Stdout.Stat(); err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return false
+	}
+	if runtime.GOOS == "windows" {
+		// The legacy console cannot draw them; Windows Terminal can.
+		return os.Getenv("WT_SESSION") != ""
+	}
+	for _, name := range []string{"LC_ALL", "LC_CTYPE", "LANG"} {
+		if v := os.Getenv(name); v != "" {
+			v = strings.ToLower(v)
+			return strings.Contains(v, "utf-8") || strings.Contains(v, "utf8")
 		}
 	}
+	return false
 }
 
-func pingHost(host string) bool {
-	var cmd *exec.Cmd
-	
-	if runtime.GOOS == "windows" {
-		cmd = exec.Command("ping", "-n", "1", "-w", "1000", host)
-	} else {
-		cmd = exec.Command("ping", "-c", "1", "-W", "1", host)
+// formatDevice returns the line of d in the device list.
+func formatDevice(d *device.Device) string {
+	hostname := d.Hostname()
+	if hostname == "" {
+		hostname = "(no hostname)"
+	}
+	if showIcons {
+		if i := icon.For(d); i != icon.Unknown {
+			hostname = i.Glyph + " " + hostname
+		} else {
+			hostname = "   " + hostname
+		}
+	}
+	if label := d.NameFrom(device.SourceInventory); label != "" && label != d.Hostname() {
+		hostname += fmt.Sprintf(" %q", label)
+	}
+	if d.MAC != nil {
+		hostname += "  " + formatMAC(d.MAC)
 	}
-	
-	cmd.Run()
-	return cmd.ProcessState.Success()
+	more := len(d.Addresses) - 1
+	if d.DualStack() {
+		hostname += " [" + formatFamilies(d) + "]"
+		more--
+	}
+	if more > 0 {
+		hostname += fmt.Sprintf(" [+%d addresses]", more)
+	}
+	if expected := d.Get(device.AttrExpectedHostname); expected != "" {
+		hostname += fmt.Sprintf(" [expected %s]", expected)
+	}
+	if latency := formatLatency(d); latency != "" {
+		hostname += " [" + latency + "]"
+	}
+	if grade := d.Get(device.AttrQuality); grade != "" {
+		hostname += " [quality " + grade + "]"
+	}
+	if descr := d.Get(device.AttrSNMPDescr); descr != "" {
+		hostname += " [SNMP " + formatSNMP(d) + "]"
+	}
+	if upnp := strings.TrimSpace(d.Get(device.AttrUPnPManufacturer) + " " + d.Get(device.AttrUPnPModel)); upnp != "" {
+		hostname += " [UPnP " + upnp + "]"
+	}
+	if open := d.Get(device.AttrOpenPorts); open != "" {
+		hostname += " [open " + open + "]"
+	}
+	if dups, late := d.Int(device.AttrEchoDuplicates), d.Int(device.AttrEchoLate); dups > 0 || late > 0 {
+		hostname += fmt.Sprintf(" [%d/%d replies, %d duplicate, %d late]",
+			d.Int(device.AttrEchoReceived), d.Int(device.AttrEchoSent), dups, late)
+	}
+	if shared := d.Int(device.AttrSharedMAC); shared > 0 {
+		hostname += fmt.Sprintf(" [MAC answers for %d addresses: proxy ARP or NAT device]", shared)
+	}
+	switch signals := d.Get(device.AttrAuditSignals); {
+	case signals == "none":
+		hostname += " [unconfirmed]"
+	case signals != "" && !strings.Contains(signals, ","):
+		hostname += " [single signal: " + strings.ToUpper(signals) + "]"
+	}
+	return fmt.Sprintf("  %-15s - %s", d.IP().String(), hostname)
 }
 
-func resolveHostname(ip string) string {
-	names, err := net.LookupAddr(ip)
-	if err != nil || len(names) == 0 {
+// printSkipped lists the work the scan left out to finish within
+// deadline.
+func printSkipped(deadline time.Duration, skipped []scanner.Skip) {
+	parts := make([]string, len(skipped))
+	for i, skip := range skipped {
+		parts[i] = fmt.Sprintf("%s (%s)", skip.What, count(skip.Hosts, "host"))
+	}
+	fmt.Printf("\nNote: to finish within %s the scan left out %s.\n", deadline, strings.Join(parts, ", "))
+	for _, skip := range skipped {
+		if skip.What == scanner.SkipProbes {
+			fmt.Println("Devices at the addresses not probed are missing from the results.")
+		}
+	}
+}
+
+// printAudit sums up how many signals confirmed the devices of an audit.
+func printAudit(devices []*device.Device) {
+	confirmed, single, unchecked := 0, 0, 0
+	for _, d := range devices {
+		signals := d.Get(device.AttrAuditSignals)
+		switch {
+		case signals == "":
+			unchecked++
+		case strings.Contains(signals, ","):
+			confirmed++
+		default:
+			single++
+		}
+	}
+	fmt.Printf("\nAudit: %s confirmed by two or more signals, %d by a single one", count(confirmed, "device"), single)
+	if unchecked > 0 {
+		fmt.Printf(", %d not checked", unchecked)
+	}
+	fmt.Println()
+	if single > 0 {
+		fmt.Println("Devices seen by a single signal may be a firewall, proxy ARP router or other middlebox answering for an absent host.")
+	}
+}
+
+// formatSNMP summarises what the SNMP agent of d said about it.
+func formatSNMP(d *device.Device) string {
+	line := d.Get(device.AttrSNMPDescr)
+	if n := d.Int(device.AttrSNMPInterfaces); n > 0 {
+		line += ", " + count(n, "interface")
+	}
+	if location := d.Get(device.AttrSNMPLocation); location != "" {
+		line += ", in " + location
+	}
+	return line
+}
+
+// formatFamilies shows the IPv6 address of a dual-stack device and how
+// each family answered.
+func formatFamilies(d *device.Device) string {
+	rtt := func(key string) string {
+		if v := duration(d, key); v > 0 {
+			return numfmt.RTT(v)
+		}
+		return "no echo reply"
+	}
+	return fmt.Sprintf("IPv4 %s, IPv6 %s %s", rtt(device.AttrRTT), d.IPv6(), rtt(device.AttrRTT6))
+}
+
+// formatLatency summarises the latency statistics of d measured with
+// --count, or returns "" if there are none.
+func formatLatency(d *device.Device) string {
+	if d.Get(device.AttrLatencySent) == "" {
 		return ""
 	}
-	
-	hostname := names[0]
-	if hostname[len(hostname)-1] == '.' {
-		hostname = hostname[:len(hostname)-1]
+	pct, _ := strconv.ParseFloat(d.Get(device.AttrLatencyLoss), 64)
+	loss := numfmt.Float(pct, 1) + "% loss"
+	if d.Get(device.AttrLatencyAvg) == "" {
+		return loss
 	}
-	
-	return hostname
+	return fmt.Sprintf("rtt %s/%s/%s %s, jitter %s, %s",
+		numfmt.RTTValue(duration(d, device.AttrLatencyMin)), numfmt.RTTValue(duration(d, device.AttrLatencyAvg)),
+		numfmt.RTTValue(duration(d, device.AttrLatencyMax)), numfmt.Unit(), numfmt.RTT(duration(d, device.AttrLatencyJitter)), loss)
 }
 
-func displayDevices(devices []Device) {
-	if len(devices) == 0 {
-		fmt.Println("\nNo online devices found")
-		return
+// formatMAC returns mac followed by the vendor it was assigned to, if
+// known.
+func formatMAC(mac net.HardwareAddr) string {
+	if vendor := oui.Vendor(mac); vendor != "" {
+		return fmt.Sprintf("%s (%s)", mac, vendor)
 	}
-	
-	fmt.Println("\nOnline devices:")
-	fmt.Println("---------------")
-	
-	for _, device := range devices {
-		if device.Hostname != "" {
-			fmt.Printf("  %-15s - %s\n", device.IP.String(), device.Hostname)
-		} else {
-			fmt.Printf("  %-15s - (no hostname)\n", device.IP.String())
+	if oui.Local(mac) {
+		return mac.String() + " (locally administered)"
+	}
+	return mac.String()
+}
+
+// printDeviceDetails shows everything known about d, with the source and
+// confidence of each identification field.
+func printDeviceDetails(d *device.Device) {
+	fmt.Printf("%s\n", d.IP())
+	if i := icon.For(d); i != icon.Unknown {
+		glyph := ""
+		if showIcons {
+			glyph = i.Glyph + " "
+		}
+		fmt.Printf("  Looks like:  %s%s\n", glyph, i.Name)
+	}
+	if d.MAC != nil {
+		fmt.Printf("  MAC:         %s\n", formatMAC(d.MAC))
+	}
+	for _, ip := range d.Addresses[1:] {
+		fmt.Printf("  Also at:     %s\n", ip)
+	}
+	fmt.Printf("  Sources:     %s\n", strings.Join(d.Sources, ", "))
+	fmt.Printf("  First seen:  %s\n", timefmt.Format(d.FirstSeen))
+	fmt.Printf("  Last seen:   %s\n", timefmt.Format(d.LastSeen))
+
+	fmt.Println("\n  Identification:")
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, field := range device.Fields {
+		g := d.Identification(field)
+		if g.Value == "" {
+			fmt.Fprintf(tw, "    %s\t-\n", field)
+			continue
+		}
+		fmt.Fprintf(tw, "    %s\t%s\t%s confidence\tfrom %s\n", field, g.Value, g.Confidence, g.Source)
+	}
+	tw.Flush()
+
+	if len(d.Names) > 1 {
+		fmt.Println("\n  Names:")
+		for _, n := range d.Names {
+			fmt.Printf("    %s (%s)\n", n.Name, n.Source)
+		}
+	}
+
+	var keys []string
+	for _, key := range d.Keys() {
+		if !device.IsIdentKey(key) {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) > 0 {
+		fmt.Println("\n  Attributes:")
+		for _, key := range keys {
+			fmt.Printf("    %s = %s\n", key, d.Get(key))
 		}
 	}
-	
-	fmt.Printf("\nTotal online devices: %d\n", len(devices))
 }
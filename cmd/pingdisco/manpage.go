@@ -0,0 +1,201 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// runMan writes the man pages generated from the command definitions to a
+// directory: pingdisco(1) and one page per command. It is run by go
+// generate.
+func runMan(args []string) {
+	if len(args) != 1 {
+		fmt.Println("Usage: pingdisco __man <dir>")
+		os.Exit(2)
+	}
+	dir := args[0]
+
+	// Defaults taken from the environment or the home directory of
+	// whoever generates the pages do not belong in them.
+	for _, kv := range os.Environ() {
+		if name, _, _ := strings.Cut(kv, "="); strings.HasPrefix(name, "PINGDISCO_") {
+			os.Unsetenv(name)
+		}
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	pages := map[string]string{"pingdisco.1": mainPage()}
+	for _, c := range commands {
+		if c.hidden || c.name == "help" {
+			continue
+		}
+		pages["pingdisco-"+c.name+".1"] = commandPage(c)
+	}
+
+	for name, page := range pages {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(page), 0o644); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+}
+
+func mainPage() string {
+	var b strings.Builder
+	b.WriteString(".TH PINGDISCO 1 \"\" \"pingdisco\" \"User Commands\"\n")
+	b.WriteString(".SH NAME\npingdisco \\- discover devices on local networks\n")
+	b.WriteString(".SH SYNOPSIS\n.B pingdisco\n[\\fIcommand\\fR] [\\fIflags\\fR] [\\fIargs\\fR]\n")
+	b.WriteString(".SH DESCRIPTION\n")
+	b.WriteString(roff("Without a command, pingdisco runs scan. Each command has its own manual page."))
+	b.WriteString(".SH COMMANDS\n")
+
+	var seeAlso []string
+	for _, c := range commands {
+		if c.hidden {
+			continue
+		}
+		b.WriteString(".TP\n.B " + roff(c.name))
+		if len(c.aliases) > 0 {
+			b.WriteString(roff("(also " + strings.Join(c.aliases, ", ") + ")"))
+		}
+		b.WriteString(roff(c.summary))
+		if c.name != "help" {
+			seeAlso = append(seeAlso, ".BR pingdisco-"+c.name+" (1)")
+		}
+	}
+
+	b.WriteString(".SH SEE ALSO\n")
+	b.WriteString(strings.Join(seeAlso, ",\n") + "\n")
+	return b.String()
+}
+
+func commandPage(c *command) string {
+	title := "PINGDISCO-" + strings.ToUpper(c.name)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, ".TH %s 1 \"\" \"pingdisco\" \"User Commands\"\n", title)
+	b.WriteString(".SH NAME\n" + roff("pingdisco-"+c.name+" - "+c.summary))
+
+	b.WriteString(".SH SYNOPSIS\n")
+	b.WriteString(synopsis(c, nil))
+	for _, s := range c.subcommands {
+		b.WriteString(".br\n" + synopsis(c, s))
+	}
+
+	if c.description != "" || len(c.aliases) > 0 {
+		b.WriteString(".SH DESCRIPTION\n")
+		if c.description != "" {
+			b.WriteString(roff(c.description))
+		}
+		if len(c.aliases) > 0 {
+			b.WriteString(".PP\n" + roff("Also available as "+strings.Join(c.aliases, ", ")+"."))
+		}
+	}
+
+	writeFlags(&b, ".SH OPTIONS\n", commandFlags(c, nil))
+	writeExamples(&b, ".SH EXAMPLES\n", c.examples)
+
+	if len(c.subcommands) > 0 {
+		b.WriteString(".SH SUBCOMMANDS\n")
+		for _, s := range c.subcommands {
+			b.WriteString(".SS " + roff(s.name))
+			b.WriteString(roff(s.summary))
+			if s.description != "" {
+				b.WriteString(".PP\n" + roff(s.description))
+			}
+			writeFlags(&b, ".PP\nOptions:\n", commandFlags(c, s))
+			writeExamples(&b, ".PP\nExamples:\n", s.examples)
+		}
+	}
+
+	b.WriteString(".SH SEE ALSO\n.BR pingdisco (1)\n")
+	return b.String()
+}
+
+func synopsis(c, sub *command) string {
+	name, d := c.name, c
+	if sub != nil {
+		name, d = name+" "+sub.name, sub
+	}
+	line := ".B pingdisco " + roff(name)
+	if d.usage != "" {
+		line += roff(d.usage)
+	}
+	return line
+}
+
+func writeFlags(b *strings.Builder, heading string, fs *flag.FlagSet) {
+	if fs == nil {
+		return
+	}
+
+	first := true
+	fs.VisitAll(func(f *flag.Flag) {
+		if first {
+			b.WriteString(heading)
+			first = false
+		}
+
+		kind, usage := flag.UnquoteUsage(f)
+		b.WriteString(".TP\n\\fB\\-\\-" + escapeRoff(f.Name) + "\\fR")
+		if kind != "" {
+			b.WriteString(" \\fI" + escapeRoff(kind) + "\\fR")
+		}
+		b.WriteString("\n")
+
+		if def := manDefault(f.DefValue); def != "" {
+			usage += " (default " + def + ")"
+		}
+		b.WriteString(roff(usage))
+	})
+}
+
+// manDefault returns the default value shown in a man page, or "" for zero
+// values. Paths under the configuration directory are shown relative to
+// it.
+func manDefault(def string) string {
+	switch def {
+	case "", "0", "false", "0s":
+		return ""
+	}
+	if dir := defaultStatePath(""); strings.HasPrefix(def, dir) {
+		def = "$XDG_CONFIG_HOME/pingdisco/" + strings.TrimPrefix(def[len(dir):], string(filepath.Separator))
+	}
+	return def
+}
+
+func writeExamples(b *strings.Builder, heading string, examples []example) {
+	if len(examples) == 0 {
+		return
+	}
+
+	b.WriteString(heading)
+	for _, e := range examples {
+		if e.comment != "" {
+			b.WriteString(".PP\n" + roff(strings.ToUpper(e.comment[:1])+e.comment[1:]+":"))
+		} else {
+			b.WriteString(".PP\n")
+		}
+		b.WriteString(".RS\n.nf\n" + roff(e.command) + ".fi\n.RE\n")
+	}
+}
+
+// roff returns s as a line of roff text.
+func roff(s string) string {
+	s = escapeRoff(s)
+	if strings.HasPrefix(s, ".") || strings.HasPrefix(s, "'") {
+		s = "\\&" + s
+	}
+	return s + "\n"
+}
+
+func escapeRoff(s string) string {
+	return strings.NewReplacer(`\`, `\e`, "-", `\-`).Replace(s)
+}
@@ -0,0 +1,172 @@
+//go:build !minimal
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"pingdisco.com/pingdisco/internal/device"
+	"pingdisco.com/pingdisco/internal/store"
+)
+
+// metricsExporter serves the results of scan --metrics-listen in the
+// Prometheus text format, so a Prometheus server can scrape pingdisco as a
+// LAN exporter. The metrics change as each scan completes, not on scrape.
+type metricsExporter struct {
+	mu      sync.Mutex
+	devices map[string]*metricsDevice
+	scans   int
+	// seconds sums the durations of the scans.
+	seconds  float64
+	lastScan store.Scan
+}
+
+// metricsDevice is a device as its metrics label it. Devices missing from
+// the latest scan stay, with up at 0.
+type metricsDevice struct {
+	ip       net.IP
+	hostname string
+	mac      string
+	up       bool
+	rtt      time.Duration
+	// loss is the share of echo requests lost with --count, or -1.
+	loss float64
+}
+
+func newMetricsExporter() *metricsExporter {
+	return &metricsExporter{devices: make(map[string]*metricsDevice)}
+}
+
+// serveMetrics serves the metrics of scan --metrics-listen on addr until
+// ctx is done, and returns the hook that records each completed scan.
+func serveMetrics(ctx context.Context, addr string) (func(store.Scan), error) {
+	m := newMetricsExporter()
+	if err := serveHTTP(ctx, m.handler(), addr); err != nil {
+		return nil, err
+	}
+	fmt.Printf("\nMetrics: %smetrics\n", localURL(addr))
+	return m.update, nil
+}
+
+// update records a completed scan.
+func (m *metricsExporter) update(scan store.Scan) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, d := range m.devices {
+		d.up, d.rtt, d.loss = false, 0, -1
+	}
+	for _, d := range scan.Devices {
+		md := &metricsDevice{ip: d.IP(), hostname: d.Hostname(), up: true, loss: -1}
+		if d.MAC != nil {
+			md.mac = d.MAC.String()
+		}
+		md.rtt, _ = time.ParseDuration(d.Get(device.AttrRTT))
+		if pct, err := strconv.ParseFloat(d.Get(device.AttrLatencyLoss), 64); err == nil {
+			md.loss = pct / 100
+		}
+		m.devices[d.ID()] = md
+	}
+	m.scans++
+	if !scan.FinishedAt.IsZero() {
+		m.seconds += scan.FinishedAt.Sub(scan.StartedAt).Seconds()
+	}
+	m.lastScan = scan
+}
+
+// write writes the metrics in the Prometheus text exposition format.
+func (m *metricsExporter) write(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	devices := make([]*metricsDevice, 0, len(m.devices))
+	online := 0
+	for _, d := range m.devices {
+		devices = append(devices, d)
+		if d.up {
+			online++
+		}
+	}
+	slices.SortFunc(devices, func(a, b *metricsDevice) int {
+		return bytes.Compare(a.ip.To16(), b.ip.To16())
+	})
+
+	metric(w, "pingdisco_device_up", "gauge", "Whether the device answered the latest scan.")
+	for _, d := range devices {
+		up := 0.0
+		if d.up {
+			up = 1
+		}
+		sample(w, "pingdisco_device_up", d.labels(), up)
+	}
+	metric(w, "pingdisco_device_rtt_seconds", "gauge", "Round-trip time of the probe that found the device in the latest scan.")
+	for _, d := range devices {
+		if d.up && d.rtt > 0 {
+			sample(w, "pingdisco_device_rtt_seconds", d.labels(), d.rtt.Seconds())
+		}
+	}
+	metric(w, "pingdisco_device_loss_ratio", "gauge", "Share of the echo requests of --count the device left unanswered in the latest scan.")
+	for _, d := range devices {
+		if d.up && d.loss >= 0 {
+			sample(w, "pingdisco_device_loss_ratio", d.labels(), d.loss)
+		}
+	}
+
+	metric(w, "pingdisco_devices_online", "gauge", "Devices that answered the latest scan.")
+	sample(w, "pingdisco_devices_online", "", float64(online))
+	metric(w, "pingdisco_scan_duration_seconds", "summary", "Time taken by the scans since pingdisco started.")
+	sample(w, "pingdisco_scan_duration_seconds_sum", "", m.seconds)
+	sample(w, "pingdisco_scan_duration_seconds_count", "", float64(m.scans))
+	if m.scans > 0 {
+		metric(w, "pingdisco_last_scan_timestamp_seconds", "gauge", "When the latest scan started, in seconds since the Unix epoch.")
+		sample(w, "pingdisco_last_scan_timestamp_seconds", "", float64(m.lastScan.StartedAt.UnixMilli())/1000)
+		metric(w, "pingdisco_last_scan_duration_seconds", "gauge", "Time taken by the latest scan.")
+		sample(w, "pingdisco_last_scan_duration_seconds", "", m.lastScan.FinishedAt.Sub(m.lastScan.StartedAt).Seconds())
+	}
+}
+
+func (m *metricsExporter) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		m.write(w)
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintln(w, "pingdisco exporter: metrics are at /metrics")
+	})
+	return mux
+}
+
+func (d *metricsDevice) labels() string {
+	return fmt.Sprintf(`ip="%s",hostname="%s",mac="%s"`, d.ip, escapeLabel(d.hostname), d.mac)
+}
+
+func metric(w io.Writer, name, typ, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+func sample(w io.Writer, name, labels string, v float64) {
+	if labels != "" {
+		name += "{" + labels + "}"
+	}
+	fmt.Fprintf(w, "%s %s\n", name, strconv.FormatFloat(v, 'g', -1, 64))
+}
+
+// escapeLabel escapes a label value as the text format requires.
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"pingdisco.com/pingdisco/internal/nat64"
+	"pingdisco.com/pingdisco/internal/netinfo"
+	"pingdisco.com/pingdisco/internal/netops"
+)
+
+// detectNAT64 returns the NAT64 prefix of an IPv6-only network: one where
+// this host has no IPv4 default route but its resolver synthesizes AAAA
+// records. Networks with IPv4 yield an invalid prefix and a nil error.
+func detectNAT64() (nat64.Prefix, error) {
+	routes, err := netinfo.DefaultRoutes()
+	if err != nil {
+		return nat64.Prefix{}, fmt.Errorf("reading the routing table: %w", err)
+	}
+	if len(routes) > 0 {
+		return nat64.Prefix{}, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	return nat64.Discover(ctx, net.DefaultResolver)
+}
+
+// adaptToNAT64 makes ops ping IPv4 hosts at their synthesized IPv6
+// addresses, and look up their names under the IPv4 address, when the
+// network is IPv6-only behind NAT64. It returns the prefix, invalid if
+// nothing was changed.
+func adaptToNAT64(ops *netops.Ops) nat64.Prefix {
+	prefix, err := detectNAT64()
+	if err != nil || !prefix.Valid() {
+		return nat64.Prefix{}
+	}
+	ops.Pinger = nat64.Pinger{Pinger: ops.Pinger, Prefix: prefix}
+	ops.Resolver = nat64.Resolver{Resolver: ops.Resolver, Prefix: prefix}
+	fmt.Printf("\nNAT64: IPv6-only network, IPv4 hosts are reached through %s\n", prefix)
+	return prefix
+}
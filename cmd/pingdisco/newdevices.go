@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"pingdisco.com/pingdisco/internal/device"
+)
+
+// knownDevices remembers every device ever seen, by device ID, so that a
+// device is reported as new only the first time it joins the network.
+// Devices of Wi-Fi networks are remembered per SSID, so that a laptop
+// joining the office network does not report the whole office as new
+// devices of the home network.
+type knownDevices struct {
+	path string
+	// Seen holds the devices seen without Wi-Fi.
+	Seen     map[string]time.Time            `json:"seen"`
+	Networks map[string]map[string]time.Time `json:"networks,omitempty"`
+}
+
+func loadKnownDevices(path string) (*knownDevices, error) {
+	k := &knownDevices{path: path, Seen: make(map[string]time.Time)}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return k, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, k); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if k.Seen == nil {
+		k.Seen = make(map[string]time.Time)
+	}
+	if k.Networks == nil {
+		k.Networks = make(map[string]map[string]time.Time)
+	}
+	return k, nil
+}
+
+// add records devices found on the Wi-Fi network ssid, or without Wi-Fi
+// for "", and returns those not seen there before. The first scan of a
+// network only establishes its baseline and reports nothing.
+func (k *knownDevices) add(ssid string, devices []*device.Device) []*device.Device {
+	seen := k.Seen
+	if ssid != "" {
+		if seen = k.Networks[ssid]; seen == nil {
+			seen = make(map[string]time.Time)
+			k.Networks[ssid] = seen
+		}
+	}
+	baseline := len(seen) == 0
+
+	var joined []*device.Device
+	for _, d := range devices {
+		if _, ok := seen[d.ID()]; ok {
+			continue
+		}
+		seen[d.ID()] = d.FirstSeen
+		if !baseline {
+			joined = append(joined, d)
+		}
+	}
+	return joined
+}
+
+func (k *knownDevices) save() error {
+	data, err := json.MarshalIndent(k, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(k.path), 0o755); err != nil {
+		return err
+	}
+	tmp := k.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, k.path)
+}
+
+// describeNewDevice is the notification text for a device that joined.
+func describeNewDevice(d *device.Device) string {
+	msg := "New device on the network: " + d.IP().String()
+	if name := d.Hostname(); name != "" {
+		msg += " (" + name + ")"
+	}
+	if d.MAC != nil {
+		msg += ", MAC " + d.MAC.String()
+	}
+	return msg
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"pingdisco.com/pingdisco/internal/shortcut"
+)
+
+// openOptions are the flags of open.
+type openOptions struct {
+	timeout *time.Duration
+}
+
+// openFlags declares the flags of open.
+func openFlags(fs *flag.FlagSet) openOptions {
+	return openOptions{
+		timeout: fs.Duration("timeout", shortcut.DefaultTimeout, "how long to wait for each port"),
+	}
+}
+
+func runOpen(args []string) {
+	fs := newFlagSet("open")
+	opts := openFlags(fs)
+	fs.Parse(args)
+
+	if fs.NArg() < 1 || fs.NArg() > 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	host := fs.Arg(0)
+	ip := resolveHosts([]string{host})[host]
+	if ip == nil {
+		fmt.Printf("Error: cannot resolve %s\n", host)
+		os.Exit(1)
+	}
+
+	found := shortcut.Detect(context.Background(), ip, *opts.timeout)
+
+	if fs.NArg() == 1 {
+		if len(found) == 0 {
+			fmt.Printf("No ssh, web or remote desktop port open on %s\n", ip)
+			return
+		}
+		for _, s := range found {
+			fmt.Printf("  %-6s %s\n", s.Name, s.URL)
+		}
+		return
+	}
+
+	s, ok := shortcut.For(ip, fs.Arg(1))
+	if !ok {
+		fmt.Printf("Error: unknown shortcut %q\n", fs.Arg(1))
+		os.Exit(2)
+	}
+	open := false
+	for _, f := range found {
+		open = open || f.Name == s.Name
+	}
+	if !open {
+		fmt.Printf("Warning: port %d does not answer on %s\n", s.Port, ip)
+	}
+	if err := shortcut.Open(s, ip); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"pingdisco.com/pingdisco/internal/device"
+	"pingdisco.com/pingdisco/internal/netinfo"
+	"pingdisco.com/pingdisco/internal/portscan"
+	"pingdisco.com/pingdisco/internal/timefmt"
+)
+
+// Output formats of scan results.
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+	outputCSV   = "csv"
+)
+
+// scanOutput is the JSON form of scan results written by --output json
+// and history export. ID and Note are only set for saved scans, SSID and
+// BSSID for scans taken on Wi-Fi.
+type scanOutput struct {
+	ID         int64          `json:"id,omitempty"`
+	StartedAt  string         `json:"started_at"`
+	FinishedAt string         `json:"finished_at"`
+	Targets    []string       `json:"targets"`
+	Note       string         `json:"note,omitempty"`
+	SSID       string         `json:"ssid,omitempty"`
+	BSSID      string         `json:"bssid,omitempty"`
+	Devices    []deviceOutput `json:"devices"`
+}
+
+func newScanOutput(started, finished time.Time, scanned []string, devices []*device.Device) scanOutput {
+	out := scanOutput{
+		StartedAt:  timefmt.Format(started),
+		FinishedAt: timefmt.Format(finished),
+		Targets:    scanned,
+		Devices:    []deviceOutput{},
+	}
+	for _, d := range devices {
+		out.Devices = append(out.Devices, newDeviceOutput(d))
+	}
+	return out
+}
+
+type deviceOutput struct {
+	IP string `json:"ip"`
+	// Addresses lists the device's other addresses, such as the IPv6
+	// privacy addresses of a host.
+	Addresses []string `json:"addresses,omitempty"`
+	Hostname  string   `json:"hostname,omitempty"`
+	// Name is the device's label in the inventory.
+	Name   string  `json:"name,omitempty"`
+	MAC    string  `json:"mac,omitempty"`
+	Online bool    `json:"online"`
+	RTTMs  float64 `json:"rtt_ms,omitempty"`
+	// RTTIPv6Ms is the round-trip time of the IPv6 address of a device
+	// found over both IPv4 and IPv6.
+	RTTIPv6Ms float64 `json:"rtt_ipv6_ms,omitempty"`
+	Vendor    string  `json:"vendor,omitempty"`
+	Type      string  `json:"type,omitempty"`
+	// Latency is set when the scan timed several echo requests with
+	// --count.
+	Latency *latencyOutput `json:"latency,omitempty"`
+	// OpenPorts lists the TCP ports that accepted a connection when the
+	// scan tried --ports or --top-ports.
+	OpenPorts []int `json:"open_ports,omitempty"`
+	// UPnP is what the device announced about itself when the scan
+	// searched with --ssdp.
+	UPnP *upnpOutput `json:"upnp,omitempty"`
+	// SNMP is what the device's SNMP agent said about it when the scan
+	// asked with --snmp.
+	SNMP *snmpOutput `json:"snmp,omitempty"`
+	// Quality is the A to F grade of the device's connection, set when
+	// the scan timed several echo requests or repeated with --watch.
+	Quality string `json:"quality,omitempty"`
+	// Topology is where the device sits in the network, set when the
+	// scan traced the routes to the devices with --topology.
+	Topology *topologyOutput `json:"topology,omitempty"`
+}
+
+type upnpOutput struct {
+	FriendlyName string `json:"friendly_name,omitempty"`
+	Manufacturer string `json:"manufacturer,omitempty"`
+	Model        string `json:"model,omitempty"`
+	DeviceType   string `json:"device_type,omitempty"`
+	Server       string `json:"server,omitempty"`
+}
+
+type snmpOutput struct {
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+	Location    string `json:"location,omitempty"`
+	ObjectID    string `json:"object_id,omitempty"`
+	Interfaces  int    `json:"interfaces,omitempty"`
+}
+
+type topologyOutput struct {
+	// Hops is the number of routers between the scanning host and the
+	// device, 0 if it is directly attached; nil if the device did not
+	// answer the trace.
+	Hops    *int   `json:"hops,omitempty"`
+	Gateway string `json:"gateway,omitempty"`
+	// Path lists the routers on the way, nearest first, with "*" for
+	// those that did not answer.
+	Path []string `json:"path,omitempty"`
+}
+
+type latencyOutput struct {
+	Sent     int     `json:"sent"`
+	LossPct  float64 `json:"loss_pct"`
+	MinMs    float64 `json:"min_ms,omitempty"`
+	AvgMs    float64 `json:"avg_ms,omitempty"`
+	MaxMs    float64 `json:"max_ms,omitempty"`
+	JitterMs float64 `json:"jitter_ms,omitempty"`
+}
+
+// duration returns the duration attribute key of d, or zero if it is not
+// set.
+func duration(d *device.Device, key string) time.Duration {
+	v, _ := time.ParseDuration(d.Get(key))
+	return v
+}
+
+// milliseconds returns the duration attribute key of d in milliseconds,
+// or zero if it is not set.
+func milliseconds(d *device.Device, key string) float64 {
+	return float64(duration(d, key).Microseconds()) / 1000
+}
+
+func newDeviceOutput(d *device.Device) deviceOutput {
+	o := deviceOutput{
+		IP:       d.IP().String(),
+		Hostname: d.NetworkName(),
+		Name:     d.NameFrom(device.SourceInventory),
+		Online:   d.Online,
+		Vendor:   d.Identification(device.FieldVendor).Value,
+		Type:     d.Identification(device.FieldType).Value,
+		Quality:  d.Get(device.AttrQuality),
+	}
+	if d.MAC != nil {
+		o.MAC = d.MAC.String()
+	}
+	for _, ip := range d.Addresses[1:] {
+		o.Addresses = append(o.Addresses, ip.String())
+	}
+	o.RTTMs = milliseconds(d, device.AttrRTT)
+	o.RTTIPv6Ms = milliseconds(d, device.AttrRTT6)
+	if sent := d.Int(device.AttrLatencySent); sent > 0 {
+		loss, _ := strconv.ParseFloat(d.Get(device.AttrLatencyLoss), 64)
+		o.Latency = &latencyOutput{
+			Sent:     sent,
+			LossPct:  loss,
+			MinMs:    milliseconds(d, device.AttrLatencyMin),
+			AvgMs:    milliseconds(d, device.AttrLatencyAvg),
+			MaxMs:    milliseconds(d, device.AttrLatencyMax),
+			JitterMs: milliseconds(d, device.AttrLatencyJitter),
+		}
+	}
+	if open := d.Get(device.AttrOpenPorts); open != "" {
+		o.OpenPorts, _ = portscan.Parse(open)
+	}
+	if slices.Contains(d.Sources, device.SourceSSDP) {
+		o.UPnP = &upnpOutput{
+			FriendlyName: d.Get(device.AttrUPnPName),
+			Manufacturer: d.Get(device.AttrUPnPManufacturer),
+			Model:        d.Get(device.AttrUPnPModel),
+			DeviceType:   d.Get(device.AttrUPnPDeviceType),
+			Server:       d.Get(device.AttrUPnPServer),
+		}
+	}
+	if slices.Contains(d.Sources, device.SourceSNMP) {
+		o.SNMP = &snmpOutput{
+			Name:        d.Get(device.AttrSNMPName),
+			Description: d.Get(device.AttrSNMPDescr),
+			Location:    d.Get(device.AttrSNMPLocation),
+			ObjectID:    d.Get(device.AttrSNMPObjectID),
+			Interfaces:  d.Int(device.AttrSNMPInterfaces),
+		}
+	}
+	hops, traced := d.Attributes[device.AttrTopologyHops]
+	if path := d.Get(device.AttrTopologyPath); traced || path != "" {
+		o.Topology = &topologyOutput{Gateway: d.Get(device.AttrTopologyGateway)}
+		if traced {
+			n, _ := strconv.Atoi(hops)
+			o.Topology.Hops = &n
+		}
+		if path != "" {
+			o.Topology.Path = strings.Split(path, ",")
+		}
+	}
+	return o
+}
+
+// csvHeader names the columns of csvRow. Columns are only ever added at
+// the end, so scripts reading them by position keep working.
+var csvHeader = []string{"ip", "hostname", "name", "mac", "online", "rtt_ms", "vendor", "type", "scanned_at",
+	"rtt_min_ms", "rtt_avg_ms", "rtt_max_ms", "jitter_ms", "loss_pct", "open_ports",
+	"rtt_ipv6_ms", "upnp_name", "upnp_manufacturer", "upnp_model",
+	"quality", "snmp_name", "snmp_description", "snmp_location", "snmp_interfaces",
+	"topology_hops", "topology_gateway", "topology_path"}
+
+// csvRow returns the CSV columns of d, found by the scan started at
+// started.
+func csvRow(d *device.Device, started time.Time) []string {
+	o := newDeviceOutput(d)
+	ms := func(v float64) string {
+		if v == 0 {
+			return ""
+		}
+		return strconv.FormatFloat(v, 'f', 3, 64)
+	}
+	row := []string{o.IP, o.Hostname, o.Name, o.MAC, strconv.FormatBool(o.Online), ms(o.RTTMs), o.Vendor, o.Type, timefmt.Format(started)}
+	if l := o.Latency; l != nil {
+		row = append(row, ms(l.MinMs), ms(l.AvgMs), ms(l.MaxMs), ms(l.JitterMs), strconv.FormatFloat(l.LossPct, 'f', 1, 64))
+	} else {
+		row = append(row, "", "", "", "", "")
+	}
+	row = append(row, portscan.Format(o.OpenPorts), ms(o.RTTIPv6Ms))
+	if u := o.UPnP; u != nil {
+		row = append(row, u.FriendlyName, u.Manufacturer, u.Model)
+	} else {
+		row = append(row, "", "", "")
+	}
+	row = append(row, o.Quality)
+	if sn := o.SNMP; sn != nil {
+		interfaces := ""
+		if sn.Interfaces > 0 {
+			interfaces = strconv.Itoa(sn.Interfaces)
+		}
+		row = append(row, sn.Name, sn.Description, sn.Location, interfaces)
+	} else {
+		row = append(row, "", "", "", "")
+	}
+	if t := o.Topology; t != nil {
+		hops := ""
+		if t.Hops != nil {
+			hops = strconv.Itoa(*t.Hops)
+		}
+		return append(row, hops, t.Gateway, strings.Join(t.Path, " "))
+	}
+	return append(row, "", "", "")
+}
+
+// writeScanOutput writes the results of a scan in format, json or csv.
+func writeScanOutput(w io.Writer, format string, started, finished time.Time, scanned []string, wifi netinfo.WiFi, devices []*device.Device) error {
+	if format == outputCSV {
+		cw := csv.NewWriter(w)
+		cw.Write(csvHeader)
+		for _, d := range devices {
+			cw.Write(csvRow(d, started))
+		}
+		cw.Flush()
+		return cw.Error()
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	out := newScanOutput(started, finished, scanned, devices)
+	out.SSID, out.BSSID = wifi.SSID, wifi.BSSID
+	return enc.Encode(out)
+}
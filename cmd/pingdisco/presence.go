@@ -0,0 +1,496 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"pingdisco.com/pingdisco/internal/anomaly"
+	"pingdisco.com/pingdisco/internal/checks"
+	"pingdisco.com/pingdisco/internal/diagnose"
+	"pingdisco.com/pingdisco/internal/inventory"
+	"pingdisco.com/pingdisco/internal/maintenance"
+	"pingdisco.com/pingdisco/internal/netops"
+	"pingdisco.com/pingdisco/internal/notify"
+	"pingdisco.com/pingdisco/internal/presence"
+	"pingdisco.com/pingdisco/internal/scanner"
+	"pingdisco.com/pingdisco/internal/timefmt"
+)
+
+// watchOptions are the flags of watch.
+type watchOptions struct {
+	interval        *time.Duration
+	timeout         *time.Duration
+	downAfter       *int
+	upAfter         *int
+	offline         *scanner.OfflinePolicy
+	probeLogOpts    probeLogOptions
+	diagnoseOffline *bool
+	notifyOpts      *notifyOptions
+	inventoryPath   *string
+	prof            *string
+	maintenanceFile *string
+	hostsFile       *string
+	reloadInterval  *time.Duration
+	sweep           *time.Duration
+	spread          *bool
+	anomalyState    *string
+}
+
+// watchFlags declares the flags of watch.
+func watchFlags(fs *flag.FlagSet) watchOptions {
+	interfaceFlags(fs)
+	displayFlags(fs)
+	return watchOptions{
+		interval:        fs.Duration("interval", 5*time.Second, "time between probes of each host"),
+		timeout:         fs.Duration("timeout", time.Second, "probe timeout"),
+		downAfter:       fs.Int("down-after", 3, "consecutive missed probes before a host is declared offline"),
+		upAfter:         fs.Int("up-after", 1, "consecutive answered probes before a host is declared online again"),
+		offline:         offlineFlags(fs),
+		probeLogOpts:    probeLogFlags(fs),
+		diagnoseOffline: fs.Bool("diagnose", true, "check why a host went offline and add the probable cause to the alert"),
+		notifyOpts:      notifyFlags(fs),
+		inventoryPath:   fs.String("inventory", defaultStatePath("inventory.json"), "inventory of known devices and their probe overrides"),
+		prof:            profileFlag(fs),
+		maintenanceFile: fs.String("maintenance", "", "JSON file of maintenance windows during which alerts are suppressed"),
+		hostsFile:       fs.String("hosts-file", "", "file of further hosts to watch, one per line"),
+		reloadInterval:  fs.Duration("reload-interval", 5*time.Second, "how often to check the configuration files for edits (0: only on SIGHUP)"),
+		sweep:           fs.Duration("sweep", 0, "also scan the local subnets this often and notify about unusual presence patterns, e.g. 5m (0: off)"),
+		spread:          fs.Bool("spread", false, "spread the probes of each --sweep evenly across the interval instead of sending them in a burst"),
+		anomalyState:    fs.String("anomaly-state", defaultStatePath("anomaly.json"), "file keeping what --sweep has learnt is usual for the network"),
+	}
+}
+
+func runPresence(args []string) {
+	fs := newFlagSet("watch")
+	opts := watchFlags(fs)
+	fs.Parse(args)
+
+	if fs.NArg() == 0 && *opts.hostsFile == "" && *opts.sweep == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if *opts.spread && *opts.sweep == 0 {
+		fmt.Println("Error: --spread needs --sweep")
+		os.Exit(2)
+	}
+	if describeInterfaceFilter() != "" && *opts.sweep == 0 {
+		fmt.Println("Error: --interface and --exclude-interface need --sweep")
+		os.Exit(2)
+	}
+	selectProfile(fs, *opts.prof)
+
+	watchedHosts := func() ([]string, error) {
+		if *opts.hostsFile == "" {
+			return fs.Args(), nil
+		}
+		more, err := readHostsFile(*opts.hostsFile)
+		if err != nil {
+			return nil, err
+		}
+		return uniqueHosts(append(fs.Args(), more...)), nil
+	}
+
+	notifiers, err := opts.notifyOpts.build()
+	if err != nil {
+		fmt.Printf("Error loading notifiers: %v\n", err)
+		os.Exit(1)
+	}
+
+	var schedule maintenance.Schedule
+	if *opts.maintenanceFile != "" {
+		schedule, err = maintenance.Load(*opts.maintenanceFile)
+		if err != nil {
+			fmt.Printf("Error loading maintenance windows: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	hosts, err := watchedHosts()
+	if err != nil {
+		fmt.Printf("Error reading hosts: %v\n", err)
+		os.Exit(1)
+	}
+	addrs := resolveHosts(hosts)
+
+	inv, err := inventory.Load(*opts.inventoryPath)
+	if err != nil {
+		fmt.Printf("Error loading inventory: %v\n", err)
+		os.Exit(1)
+	}
+
+	var detector *anomaly.Detector
+	if *opts.sweep > 0 {
+		detector, err = anomaly.Load(*opts.anomalyState)
+		if err != nil {
+			fmt.Printf("Error loading anomaly baseline: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// Everything below may be replaced by a reload while hosts are being
+	// probed, so it is only read under mu. macs holds the MAC address each
+	// host last came online with, for --diagnose.
+	var mu sync.Mutex
+	macs := make(map[string]net.HardwareAddr)
+	current := func() (notify.Multi, maintenance.Schedule, map[string]net.IP) {
+		mu.Lock()
+		defer mu.Unlock()
+		return notifiers, schedule, addrs
+	}
+	lookup := func(host string) *inventory.Device {
+		mu.Lock()
+		defer mu.Unlock()
+		return inv.Lookup(host)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	probeLog, err := opts.probeLogOpts.open()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer probeLog.Close()
+	probe := scanner.Probe{Timeout: *opts.timeout, Count: 1, Offline: *opts.offline, Log: probeLog}
+	ops := netops.System()
+	m := &presence.Monitor{
+		Hosts:     hosts,
+		Interval:  *opts.interval,
+		DownAfter: *opts.downAfter,
+		UpAfter:   *opts.upAfter,
+		Probe: func(ctx context.Context, host string) bool {
+			return scanner.ProbeHost(ctx, ops, host, probe, lookup(host))
+		},
+		OnChange: func(c presence.Change) {
+			notifiers, schedule, addrs := current()
+
+			state := "offline"
+			if c.Online {
+				state = "online"
+				if mac := neighborMAC(ops, addrs[c.Host]); mac != nil {
+					mu.Lock()
+					macs[c.Host] = mac
+					mu.Unlock()
+				}
+			}
+
+			if c.Since.IsZero() {
+				fmt.Printf("%s  %-20s %s\n", timefmt.Format(c.At), c.Host, state)
+				return
+			}
+
+			msg := fmt.Sprintf("%s is %s (was %s for %s)", c.Host, state, previousState(c.Online), c.At.Sub(c.Since).Round(time.Second))
+			if c.Hint != "" {
+				msg += ", probable cause: " + c.Hint
+			}
+			if w := schedule.Match(addrs[c.Host], []string{c.Host}, c.At); w != nil {
+				// Planned work: keep it on record but do not alert.
+				fmt.Printf("%s  %s [maintenance: %s]\n", timefmt.Format(c.At), msg, w.Name)
+				return
+			}
+			fmt.Printf("%s  %s\n", timefmt.Format(c.At), msg)
+
+			if len(notifiers) == 0 {
+				return
+			}
+			ev := notify.Event{Type: notify.DeviceOffline, Host: c.Host, Time: c.At, Message: msg}
+			if c.Online {
+				ev.Type = notify.DeviceOnline
+			}
+			go func() {
+				if err := notifiers.Notify(ctx, ev); err != nil {
+					log.Printf("notification failed: %v", err)
+				}
+			}()
+		},
+	}
+
+	if *opts.diagnoseOffline {
+		checker := diagnose.Checker{Ops: ops, Timeout: *opts.timeout}
+		m.Diagnose = func(ctx context.Context, host string) string {
+			_, _, addrs := current()
+			ip := addrs[host]
+			if ip == nil {
+				return ""
+			}
+			mu.Lock()
+			mac := macs[host]
+			mu.Unlock()
+			d := lookup(host)
+			if mac == nil && d != nil && d.MAC != "" {
+				mac, _ = net.ParseMAC(d.MAC)
+			}
+			return checker.Diagnose(ctx, diagnose.Target{IP: ip, MAC: mac, Ports: diagnosePorts(d)}).String()
+		}
+	}
+
+	m.Checks = hostChecks(inv, hosts)
+	m.OnCheck = func(host string, r checks.Result) {
+		notifiers, schedule, addrs := current()
+
+		state, typ := "failing", notify.CheckFailed
+		if r.OK {
+			state, typ = "passing", notify.CheckPassed
+		}
+		msg := fmt.Sprintf("%s check %s is %s: %s", host, r.Check, state, r.Detail)
+
+		if w := schedule.Match(addrs[host], []string{host}, r.At); w != nil {
+			fmt.Printf("%s  %s [maintenance: %s]\n", timefmt.Format(r.At), msg, w.Name)
+			return
+		}
+		fmt.Printf("%s  %s\n", timefmt.Format(r.At), msg)
+
+		if len(notifiers) > 0 {
+			ev := notify.Event{Type: typ, Host: host, Time: r.At, Message: msg}
+			go func() {
+				if err := notifiers.Notify(ctx, ev); err != nil {
+					log.Printf("notification failed: %v", err)
+				}
+			}()
+		}
+	}
+
+	// Edited files are applied in place: hosts watched before and after a
+	// reload keep their state, and a file that fails to load leaves the
+	// previous configuration in effect.
+	files := newConfigFiles(*opts.notifyOpts.config, *opts.maintenanceFile, *opts.inventoryPath, *opts.hostsFile)
+	go watchConfigFiles(ctx, files, *opts.reloadInterval, func(paths []string) {
+		for _, path := range paths {
+			switch path {
+			case *opts.notifyOpts.config:
+				n, err := opts.notifyOpts.build()
+				if err != nil {
+					log.Printf("reloading notifiers: %v (keeping the previous ones)", err)
+					continue
+				}
+				mu.Lock()
+				old := notifiers
+				notifiers = n
+				mu.Unlock()
+				go closeNotifiers(old)
+				log.Printf("reloaded %d notifiers from %s", len(n), path)
+
+			case *opts.maintenanceFile:
+				s, err := maintenance.Load(path)
+				if err != nil {
+					log.Printf("reloading maintenance windows: %v (keeping the previous ones)", err)
+					continue
+				}
+				mu.Lock()
+				schedule = s
+				mu.Unlock()
+				log.Printf("reloaded %d maintenance windows from %s", len(s), path)
+
+			case *opts.inventoryPath:
+				i, err := inventory.Load(path)
+				if err != nil {
+					log.Printf("reloading inventory: %v (keeping the previous one)", err)
+					continue
+				}
+				mu.Lock()
+				inv = i
+				mu.Unlock()
+				m.SetChecks(hostChecks(i, hosts))
+				log.Printf("reloaded inventory from %s", path)
+
+			case *opts.hostsFile:
+				h, err := watchedHosts()
+				if err != nil {
+					log.Printf("reloading hosts: %v (keeping the previous ones)", err)
+					continue
+				}
+				a := resolveHosts(h)
+				mu.Lock()
+				addrs = a
+				i := inv
+				mu.Unlock()
+				m.SetChecks(hostChecks(i, h))
+				added, removed := m.SetHosts(h)
+				hosts = h
+				log.Printf("reloaded hosts from %s: %d added, %d removed", path, len(added), len(removed))
+			}
+		}
+	})
+
+	if detector != nil {
+		currentInventory := func() *inventory.Inventory {
+			mu.Lock()
+			defer mu.Unlock()
+			return inv
+		}
+		go sweepAnomalies(ctx, *opts.sweep, *opts.spread, ops, currentInventory, detector, func(a anomaly.Anomaly) {
+			notifiers, schedule, _ := current()
+
+			var ip net.IP
+			var names []string
+			host := ""
+			if a.Device != nil {
+				ip, names, host = a.Device.IP(), []string{a.Device.Hostname()}, a.Device.IP().String()
+			}
+			if w := schedule.Match(ip, names, a.At); w != nil {
+				fmt.Printf("%s  unusual: %s [maintenance: %s]\n", timefmt.Format(a.At), a.Message, w.Name)
+				return
+			}
+			fmt.Printf("%s  unusual: %s\n", timefmt.Format(a.At), a.Message)
+
+			if len(notifiers) > 0 {
+				ev := notify.Event{Type: notify.Anomaly, Host: host, Time: a.At, Message: a.Message}
+				go func() {
+					if err := notifiers.Notify(ctx, ev); err != nil {
+						log.Printf("notification failed: %v", err)
+					}
+				}()
+			}
+		})
+		fmt.Printf("Sweeping the local subnets every %s for unusual presence patterns\n", *opts.sweep)
+	}
+
+	fmt.Printf("Watching %d hosts every %s (Ctrl-C to stop, SIGHUP to reload)\n", len(m.Hosts), *opts.interval)
+	m.Run(ctx)
+
+	notifiers, _, _ = current()
+	closeNotifiers(notifiers)
+}
+
+// closeNotifiers delivers what notifiers still hold back.
+func closeNotifiers(notifiers notify.Multi) {
+	closeCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := notifiers.Close(closeCtx); err != nil {
+		log.Printf("delivering held notifications: %v", err)
+	}
+}
+
+// hostChecks returns the inventory checks of the given hosts.
+func hostChecks(inv *inventory.Inventory, hosts []string) map[string][]checks.Check {
+	byHost := make(map[string][]checks.Check)
+	for _, host := range hosts {
+		if d := inv.Lookup(host); d != nil {
+			byHost[host] = d.Checks
+		}
+	}
+	return byHost
+}
+
+// diagnosePorts returns the TCP ports tried on a host that went offline:
+// the port its inventory entry probes, if any, and a few that most
+// servers and appliances listen on.
+func diagnosePorts(d *inventory.Device) []int {
+	ports := []int{22, 80, 443}
+	if d != nil && d.Probe != nil && d.Probe.Port > 0 && !slices.Contains(ports, d.Probe.Port) {
+		ports = append([]int{d.Probe.Port}, ports...)
+	}
+	return ports
+}
+
+// neighborMAC returns the MAC address the neighbor table holds for ip, or
+// nil.
+func neighborMAC(ops *netops.Ops, ip net.IP) net.HardwareAddr {
+	if ip == nil || ops.Neighbors == nil {
+		return nil
+	}
+	table, err := ops.Neighbors.Neighbors()
+	if err != nil {
+		return nil
+	}
+	for _, n := range table {
+		if n.Complete && n.IP.Equal(ip) {
+			return n.MAC
+		}
+	}
+	return nil
+}
+
+// readHostsFile reads one host per line, ignoring blank lines and
+// anything after a #.
+func readHostsFile(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var hosts []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line, _, _ = strings.Cut(line, "#")
+		hosts = append(hosts, strings.Fields(line)...)
+	}
+	return hosts, nil
+}
+
+func uniqueHosts(hosts []string) []string {
+	seen := make(map[string]bool, len(hosts))
+	out := make([]string, 0, len(hosts))
+	for _, host := range hosts {
+		if !seen[host] {
+			seen[host] = true
+			out = append(out, host)
+		}
+	}
+	return out
+}
+
+func resolveHosts(hosts []string) map[string]net.IP {
+	addrs := make(map[string]net.IP, len(hosts))
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			addrs[host] = ip
+			continue
+		}
+		if ips, err := net.LookupIP(host); err == nil && len(ips) > 0 {
+			addrs[host] = ips[0]
+		}
+	}
+	return addrs
+}
+
+// maintenanceOptions are the flags of maintenance.
+type maintenanceOptions struct {
+	file *string
+}
+
+// maintenanceFlags declares the flags of maintenance.
+func maintenanceFlags(fs *flag.FlagSet) maintenanceOptions {
+	displayFlags(fs)
+	return maintenanceOptions{
+		file: fs.String("file", "maintenance.json", "JSON file of maintenance windows"),
+	}
+}
+
+func runMaintenance(args []string) {
+	fs := newFlagSet("maintenance")
+	opts := maintenanceFlags(fs)
+	fs.Parse(args)
+
+	schedule, err := maintenance.Load(*opts.file)
+	if err != nil {
+		fmt.Printf("Error loading maintenance windows: %v\n", err)
+		os.Exit(1)
+	}
+
+	now := time.Now()
+	for _, w := range schedule {
+		status := ""
+		if w.Active(now) {
+			status = " (active now)"
+		}
+		fmt.Printf("%s%s\n  When:    %s\n  Targets: %s\n", w.Name, status, w.String(), strings.Join(w.Targets, ", "))
+	}
+}
+
+func previousState(online bool) string {
+	if online {
+		return "offline"
+	}
+	return "online"
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"pingdisco.com/pingdisco/internal/netinfo"
+	"pingdisco.com/pingdisco/internal/profile"
+)
+
+// Values of --profile besides profile names.
+const (
+	profileAuto = "auto"
+	profileNone = "none"
+)
+
+// profileFiles are the flags whose files belong to the network profile in
+// use, and their names in the profile's directory. Optional files are only
+// used when the profile has them.
+var profileFiles = []struct {
+	flag, file string
+	optional   bool
+}{
+	{"inventory", "inventory.json", false},
+	{"known", "known-devices.json", false},
+	{"anomaly-state", "anomaly.json", false},
+	{"baseline", "baseline.json", false},
+	{"notify-config", "notifiers.json", true},
+	{"maintenance", "maintenance.json", true},
+}
+
+func profilesDir() string {
+	return defaultStatePath("profiles")
+}
+
+func profileFlag(fs *flag.FlagSet) *string {
+	return fs.String("profile", envOr("PINGDISCO_PROFILE", profileAuto), "network `profile` whose inventory, known devices and alert settings to use: a name, auto for the one matching the current network, or none")
+}
+
+// profileSelector points the files of a command to those of the network
+// profile in use.
+type profileSelector struct {
+	fs   *flag.FlagSet
+	name string
+	// explicit holds the flags set on the command line, which profiles
+	// leave alone.
+	explicit map[string]bool
+	active   string
+}
+
+// selectProfile applies the profile chosen with --profile, name, to the
+// flags of fs, which must have been parsed. Errors exit.
+func selectProfile(fs *flag.FlagSet, name string) *profileSelector {
+	s := &profileSelector{fs: fs, name: name, explicit: make(map[string]bool)}
+	fs.Visit(func(f *flag.Flag) { s.explicit[f.Name] = true })
+	if _, err := s.apply(); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(2)
+	}
+	return s
+}
+
+// apply picks the profile again and reports whether it changed. With
+// auto, moving to a network without a profile goes back to the default
+// files.
+func (s *profileSelector) apply() (bool, error) {
+	p, why, err := chooseProfile(s.name)
+	if err != nil {
+		return false, err
+	}
+	name := ""
+	if p != nil {
+		name = p.Name
+	}
+	if name == s.active {
+		return false, nil
+	}
+	s.active = name
+
+	switched := false
+	for _, pf := range profileFiles {
+		f := s.fs.Lookup(pf.flag)
+		if f == nil || s.explicit[pf.flag] {
+			continue
+		}
+		value := f.DefValue
+		if p != nil {
+			path := filepath.Join(p.Dir(profilesDir()), pf.file)
+			if _, err := os.Stat(path); err == nil || !pf.optional {
+				value = path
+			}
+		}
+		f.Value.Set(value)
+		switched = true
+	}
+
+	switch {
+	case !switched:
+	case p != nil:
+		fmt.Fprintf(os.Stderr, "Profile: %s (%s)\n", p.Name, why)
+	default:
+		fmt.Fprintln(os.Stderr, "Profile: none")
+	}
+	return true, nil
+}
+
+// chooseProfile returns the profile called name, or with auto the one
+// matching the current network, and why it was chosen. It returns nil
+// for none and when no profile matches.
+func chooseProfile(name string) (*profile.Profile, string, error) {
+	if name == profileNone {
+		return nil, "", nil
+	}
+	profiles, err := profile.Load(profilesDir())
+	if err != nil {
+		return nil, "", err
+	}
+	if name != profileAuto {
+		p, err := profile.Find(profiles, name)
+		return p, "chosen with --profile", err
+	}
+	if len(profiles) == 0 {
+		return nil, "", nil
+	}
+	p, why := profile.Match(profiles, currentNetwork())
+	return p, "matched " + why, nil
+}
+
+// currentNetwork identifies the network the machine is on by the Wi-Fi
+// networks of its interfaces and the MAC addresses of its default
+// gateways, as far as the neighbor table knows them.
+func currentNetwork() profile.Network {
+	var n profile.Network
+	interfaces, _ := getNetworkInterfaces()
+	seen := make(map[string]bool)
+	for _, iface := range interfaces {
+		if seen[iface.Name] {
+			continue
+		}
+		seen[iface.Name] = true
+		if w := netinfo.WiFiOf(iface.Name); w.SSID != "" {
+			n.SSIDs = append(n.SSIDs, w.SSID)
+		}
+	}
+
+	routes, _ := netinfo.DefaultRoutes()
+	neighbors, _ := netinfo.Neighbors()
+	for _, r := range routes {
+		for _, nb := range neighbors {
+			if nb.Complete && nb.IP.Equal(r.Gateway) {
+				n.GatewayMACs = append(n.GatewayMACs, nb.MAC)
+			}
+		}
+	}
+	return n
+}
+
+// profileCommandOptions are the flags of profile add; the other profile
+// subcommands have none.
+type profileCommandOptions struct {
+	ssids, macs *string
+	current     *bool
+}
+
+// profileCommandFlags declares the flags of profile sub.
+func profileCommandFlags(fs *flag.FlagSet, sub string) profileCommandOptions {
+	var opts profileCommandOptions
+	if sub == "add" {
+		opts.ssids = fs.String("ssid", "", "comma-separated Wi-Fi networks (SSIDs) the profile is for")
+		opts.macs = fs.String("gateway-mac", "", "comma-separated MAC addresses of default gateways the profile is for")
+		opts.current = fs.Bool("current", false, "use the Wi-Fi network and gateway the machine is on now")
+	}
+	return opts
+}
+
+func runProfile(args []string) {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		args = append([]string{"list"}, args...)
+	}
+
+	fs := newFlagSet("profile " + args[0])
+	opts := profileCommandFlags(fs, args[0])
+	fs.Parse(args[1:])
+
+	dir := profilesDir()
+	switch args[0] {
+	case "list":
+		profiles, err := profile.Load(dir)
+		if err != nil {
+			fmt.Printf("Error loading profiles: %v\n", err)
+			os.Exit(1)
+		}
+		if len(profiles) == 0 {
+			fmt.Println("No profiles; add one with pingdisco profile add --current <name>")
+			return
+		}
+		network := currentNetwork()
+		active, _ := profile.Match(profiles, network)
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "\tNAME\tWI-FI\tGATEWAY")
+		for _, p := range profiles {
+			mark := ""
+			if active != nil && active.Name == p.Name {
+				mark = "*"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", mark, p.Name, listOrDash(p.SSIDs), listOrDash(p.GatewayMACs))
+		}
+		tw.Flush()
+		if active != nil {
+			fmt.Printf("\n* matches the current network\n")
+		}
+
+	case "add":
+		if fs.NArg() != 1 {
+			fmt.Println("Error: profile add needs a profile name")
+			os.Exit(2)
+		}
+		p := profile.Profile{Name: fs.Arg(0), SSIDs: splitList(*opts.ssids), GatewayMACs: splitList(*opts.macs)}
+		if *opts.current {
+			n := currentNetwork()
+			p.SSIDs = append(p.SSIDs, n.SSIDs...)
+			for _, mac := range n.GatewayMACs {
+				p.GatewayMACs = append(p.GatewayMACs, mac.String())
+			}
+		}
+		for i, m := range p.GatewayMACs {
+			if hw, err := net.ParseMAC(m); err == nil {
+				p.GatewayMACs[i] = hw.String()
+			}
+		}
+		if err := p.Save(dir); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Profile %s saved for Wi-Fi %s and gateway %s; its files are kept in %s\n", p.Name, listOrDash(p.SSIDs), listOrDash(p.GatewayMACs), p.Dir(dir))
+
+	case "remove":
+		if fs.NArg() != 1 {
+			fmt.Println("Error: profile remove needs a profile name")
+			os.Exit(2)
+		}
+		if err := profile.Remove(dir, fs.Arg(0)); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Profile %s removed; its files are left in %s\n", fs.Arg(0), profile.Profile{Name: fs.Arg(0)}.Dir(dir))
+
+	default:
+		fmt.Printf("Error: unknown profile command %q\n", args[0])
+		os.Exit(2)
+	}
+}
+
+func listOrDash(list []string) string {
+	if len(list) == 0 {
+		return "-"
+	}
+	return strings.Join(list, ", ")
+}
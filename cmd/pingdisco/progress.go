@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"pingdisco.com/pingdisco/internal/events"
+	"pingdisco.com/pingdisco/internal/numfmt"
+)
+
+// progressRedraw is the least time between two redraws of the progress
+// line, so a fast sweep does not spend its time writing to the terminal.
+const progressRedraw = 200 * time.Millisecond
+
+// progressBarWidth is the width of the bar, in characters.
+const progressBarWidth = 20
+
+// autoBool is a boolean flag that defaults to "auto", decided when the
+// flag is read rather than when it is declared, so that its default does
+// not depend on where the usage or man pages are generated. As with a
+// bool flag, giving it without a value sets it to true.
+type autoBool struct {
+	set, value bool
+}
+
+func (b *autoBool) String() string {
+	if b == nil || !b.set {
+		return "auto"
+	}
+	return strconv.FormatBool(b.value)
+}
+
+func (b *autoBool) Set(s string) error {
+	if s == "auto" {
+		*b = autoBool{}
+		return nil
+	}
+	v, err := strconv.ParseBool(s)
+	if err != nil {
+		return fmt.Errorf("want true, false or auto")
+	}
+	*b = autoBool{set: true, value: v}
+	return nil
+}
+
+func (b *autoBool) IsBoolFlag() bool { return true }
+
+// Get returns the value given, or auto when none was.
+func (b *autoBool) Get(auto func() bool) bool {
+	if !b.set {
+		return auto()
+	}
+	return b.value
+}
+
+// progress shows how far a scan has got on one line redrawn in place, e.g.
+// "[#####...............] 12,345/65,534 hosts, 87 responses, about 2m10s
+// left". The line is cleared before the other handlers of the bus print,
+// and redrawn with the next probe.
+type progress struct {
+	w io.Writer
+	// clearOn are the events other handlers print on.
+	clearOn map[events.Type]bool
+
+	total, probed, found int
+	started              time.Time
+	drawnAt              time.Time
+	// drawn is the width of the line on screen, zero if there is none.
+	drawn int
+}
+
+// showProgress draws the progress of the scans published on bus to w,
+// usually stderr so it stays out of piped results. With streaming, devices
+// are printed as they are enriched, and the line is cleared for them too.
+func showProgress(bus *events.Bus, w io.Writer, streaming bool) *progress {
+	p := &progress{w: w, clearOn: map[events.Type]bool{
+		events.ScanStarted:  true,
+		events.ScanSkipped:  true,
+		events.ScanFinished: true,
+	}}
+	if streaming {
+		p.clearOn[events.DeviceEnriched] = true
+	}
+	bus.Subscribe(p.handle)
+	return p
+}
+
+func (p *progress) handle(e events.Event) {
+	switch {
+	case e.Type == events.ScanPlanned:
+		p.total, p.probed, p.found = e.Hosts, 0, 0
+		p.started = e.Time
+	case e.Type == events.HostProbed:
+		p.probed++
+		if e.Device != nil {
+			p.found++
+		}
+		if e.Time.Sub(p.drawnAt) >= progressRedraw {
+			p.draw(e.Time)
+		}
+	case p.clearOn[e.Type]:
+		p.clear()
+	}
+}
+
+func (p *progress) draw(now time.Time) {
+	if p.total == 0 {
+		return
+	}
+	done := min(p.probed, p.total)
+	filled := done * progressBarWidth / p.total
+	line := fmt.Sprintf("[%s%s] %s/%s hosts, %s",
+		strings.Repeat("#", filled), strings.Repeat(".", progressBarWidth-filled),
+		numfmt.Int(done), numfmt.Int(p.total), count(p.found, "response"))
+	if left := p.left(now); left > 0 {
+		line += ", about " + left.String() + " left"
+	}
+	p.write(line)
+	p.drawnAt = now
+}
+
+// left estimates the time the rest of the hosts will take at the pace so
+// far, or returns zero while there is too little to go on.
+func (p *progress) left(now time.Time) time.Duration {
+	elapsed := now.Sub(p.started)
+	if p.probed == 0 || elapsed < time.Second {
+		return 0
+	}
+	rest := time.Duration(p.total-p.probed) * elapsed / time.Duration(p.probed)
+	return rest.Round(time.Second)
+}
+
+// clear removes the progress line, if one is shown.
+func (p *progress) clear() {
+	if p.drawn > 0 {
+		p.write("")
+	}
+}
+
+// write replaces the line on screen with line. Spaces clear what is left
+// of a longer line, as the Windows console may not know the erase escape.
+func (p *progress) write(line string) {
+	pad := max(p.drawn-len(line), 0)
+	fmt.Fprintf(p.w, "\r%s%s\r", line, strings.Repeat(" ", pad))
+	p.drawn = len(line)
+	if line == "" {
+		p.drawn = 0
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"pingdisco.com/pingdisco/internal/localdns"
+	"pingdisco.com/pingdisco/internal/netinfo"
+	"pingdisco.com/pingdisco/internal/netops"
+)
+
+// useReverseZones makes ops look up the names of private addresses at the
+// server holding their reverse zone, found from the system's DNS servers,
+// asking it at most rate times a second. It returns the resolver, or nil
+// when the DNS servers are unknown and nothing was changed.
+func useReverseZones(ops *netops.Ops, rate int) *localdns.ZoneResolver {
+	servers, err := netinfo.Nameservers()
+	if err != nil || len(servers) == 0 {
+		return nil
+	}
+	zr := &localdns.ZoneResolver{Fallback: ops.Resolver, Resolvers: servers, Rate: rate}
+	ops.Resolver = zr
+	return zr
+}
+
+// reverseZones returns the reverse zones of the private subnets of the
+// interfaces that have a server to ask, one line each, e.g.
+// "1.168.192.in-addr.arpa at dc01.corp.example (192.168.1.10)".
+func reverseZones(zr *localdns.ZoneResolver, interfaces []NetworkInterface) []string {
+	var lines []string
+	seen := make(map[string]bool)
+	for _, iface := range interfaces {
+		z, err := zr.Zone(context.Background(), iface.IP)
+		if err != nil || seen[z.Name] {
+			continue
+		}
+		seen[z.Name] = true
+		lines = append(lines, fmt.Sprintf("%s at %s (%s)", z.Name, z.Primary, z.Server))
+	}
+	return lines
+}
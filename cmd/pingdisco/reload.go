@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// configFiles remembers the contents of the files a long-running command
+// was started with, so edits can be applied without a restart.
+type configFiles struct {
+	sums map[string][sha256.Size]byte
+}
+
+func newConfigFiles(paths ...string) *configFiles {
+	c := &configFiles{sums: make(map[string][sha256.Size]byte)}
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		data, _ := os.ReadFile(path)
+		c.sums[path] = sha256.Sum256(data)
+	}
+	return c
+}
+
+// changed returns the files whose contents differ from the last call. A
+// file that cannot be read, say while an editor replaces it, counts as
+// unchanged until it can.
+func (c *configFiles) changed() []string {
+	var paths []string
+	for path, sum := range c.sums {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		if s := sha256.Sum256(data); s != sum {
+			c.sums[path] = s
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// watchConfigFiles calls reload with the changed files on SIGHUP and,
+// unless every is 0, whenever a poll finds one edited. It returns when
+// ctx is done.
+func watchConfigFiles(ctx context.Context, files *configFiles, every time.Duration, reload func(paths []string)) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var tick <-chan time.Time
+	if every > 0 {
+		ticker := time.NewTicker(every)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			paths := files.changed()
+			if len(paths) == 0 {
+				log.Printf("SIGHUP: configuration unchanged")
+				continue
+			}
+			reload(paths)
+		case <-tick:
+			if paths := files.changed(); len(paths) > 0 {
+				reload(paths)
+			}
+		}
+	}
+}
@@ -0,0 +1,407 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"pingdisco.com/pingdisco/internal/device"
+	"pingdisco.com/pingdisco/internal/inventory"
+	"pingdisco.com/pingdisco/internal/netinfo"
+	"pingdisco.com/pingdisco/internal/netops"
+	"pingdisco.com/pingdisco/internal/scanner"
+	"pingdisco.com/pingdisco/internal/store"
+	"pingdisco.com/pingdisco/internal/targets"
+)
+
+// Remote scan modes.
+const (
+	// remoteAgent copies a pingdisco binary to a temporary file on the
+	// remote host, runs a scan with it and deletes it again.
+	remoteAgent = "agent"
+	// remoteShell pings from a shell script using the remote's own ping,
+	// typically busybox, and reads its ARP table.
+	remoteShell = "shell"
+)
+
+// remoteParallel is the number of pings the shell mode runs at once.
+const remoteParallel = 16
+
+// remoteResult is what a remote scan sends back.
+type remoteResult struct {
+	Host    string           `json:"host"`
+	Targets []string         `json:"targets"`
+	Devices []*device.Device `json:"devices"`
+}
+
+// remoteOptions are the flags of remote.
+type remoteOptions struct {
+	target   *string
+	sshOpts  *[]string
+	mode     *string
+	binary   *string
+	cidrs    *string
+	storeURL *string
+	note     *string
+}
+
+// remoteFlags declares the flags of remote.
+func remoteFlags(fs *flag.FlagSet) remoteOptions {
+	sshOpts := new([]string)
+	fs.Func("ssh-option", "option passed to ssh -o, e.g. Port=2222 (repeatable)", func(s string) error {
+		*sshOpts = append(*sshOpts, "-o", s)
+		return nil
+	})
+	return remoteOptions{
+		target:   fs.String("ssh", "", "host to scan from, as [user@]host"),
+		sshOpts:  sshOpts,
+		mode:     fs.String("mode", "auto", "agent (copy pingdisco over), shell (remote ping and ARP table) or auto"),
+		binary:   fs.String("binary", "", "pingdisco binary built for the remote host, for agent mode (default: this one if the platform matches)"),
+		cidrs:    fs.String("targets", "", "comma-separated CIDRs or addresses to scan (default: the remote host's subnets)"),
+		storeURL: fs.String("store", os.Getenv("PINGDISCO_STORE"), "save the scan to this store"),
+		note:     fs.String("note", "", "note saved with the scan (with --store)"),
+	}
+}
+
+func runRemote(args []string) {
+	fs := newFlagSet("remote")
+	opts := remoteFlags(fs)
+	fs.Parse(args)
+
+	if *opts.target == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	r := &remote{target: *opts.target, opts: *opts.sshOpts}
+	started := time.Now()
+
+	if *opts.mode == "auto" {
+		*opts.mode = remoteShell
+		if *opts.binary != "" {
+			*opts.mode = remoteAgent
+		} else if platform, err := r.platform(); err != nil {
+			fmt.Printf("Error connecting to %s: %v\n", *opts.target, err)
+			os.Exit(1)
+		} else if platform == runtime.GOOS+"/"+runtime.GOARCH {
+			*opts.mode = remoteAgent
+		}
+	}
+
+	var result *remoteResult
+	var err error
+	switch *opts.mode {
+	case remoteAgent:
+		path := *opts.binary
+		if path == "" {
+			path, err = os.Executable()
+			if err != nil {
+				fmt.Printf("Error locating this binary: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		result, err = r.agentScan(path, splitList(*opts.cidrs))
+	case remoteShell:
+		result, err = r.shellScan(splitList(*opts.cidrs))
+	default:
+		fmt.Printf("Error: unknown mode %q\n", *opts.mode)
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Printf("Error scanning from %s: %v\n", *opts.target, err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Scanned from %s (%s mode)\n", result.Host, *opts.mode)
+	fmt.Printf("Targets: %s\n", strings.Join(result.Targets, ", "))
+	displayDevices(result.Devices)
+
+	if *opts.storeURL != "" {
+		st, err := store.Open(*opts.storeURL)
+		if err != nil {
+			fmt.Printf("Error opening store: %v\n", err)
+			os.Exit(1)
+		}
+		defer st.Close()
+
+		var scanned []string
+		for _, t := range result.Targets {
+			scanned = append(scanned, t+" via "+result.Host)
+		}
+		id, err := st.SaveScan(context.Background(), store.Scan{StartedAt: started, FinishedAt: time.Now(), Targets: scanned, Note: *opts.note, Devices: result.Devices})
+		if err != nil {
+			fmt.Printf("Error saving scan: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("\nSaved as scan %d in %s\n", id, *opts.storeURL)
+	}
+}
+
+// remote runs commands on another host with the system ssh client, so
+// existing keys, agents and ~/.ssh/config apply.
+type remote struct {
+	target string
+	opts   []string
+}
+
+func (r *remote) command(script string) *exec.Cmd {
+	args := append([]string{"-T"}, r.opts...)
+	args = append(args, r.target, script)
+	cmd := exec.Command("ssh", args...)
+	cmd.Stderr = os.Stderr
+	return cmd
+}
+
+// platform returns the remote GOOS/GOARCH as far as uname tells.
+func (r *remote) platform() (string, error) {
+	out, err := r.command("uname -sm").Output()
+	if err != nil {
+		return "", err
+	}
+
+	fields := strings.Fields(string(out))
+	if len(fields) != 2 {
+		return "", fmt.Errorf("unexpected uname output %q", out)
+	}
+
+	goos := strings.ToLower(fields[0])
+	goarch := map[string]string{
+		"x86_64":  "amd64",
+		"amd64":   "amd64",
+		"aarch64": "arm64",
+		"arm64":   "arm64",
+		"i386":    "386",
+		"i686":    "386",
+		// mips and mipsel both report "mips"; those need --binary.
+	}[fields[1]]
+	if strings.HasPrefix(fields[1], "armv") {
+		goarch = "arm"
+	}
+	return goos + "/" + goarch, nil
+}
+
+// agentScan streams the binary at path to a temporary file on the remote
+// host, runs a scan with it there and removes it, all in one session. Host
+// names among cidrs are resolved on the remote host.
+func (r *remote) agentScan(path string, cidrs []string) (*remoteResult, error) {
+	if err := targets.CIDRs(cidrs).Validate(); err != nil {
+		return nil, err
+	}
+
+	bin, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer bin.Close()
+
+	scan := `"$f" __remote-scan`
+	if len(cidrs) > 0 {
+		scan += " --targets " + shellQuote(strings.Join(cidrs, ","))
+	}
+	script := `f=$(mktemp /tmp/pingdisco.XXXXXX) || exit 1; trap 'rm -f "$f"' EXIT; cat > "$f" && chmod 700 "$f" && ` + scan
+
+	cmd := r.command(script)
+	cmd.Stdin = bin
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+
+	var result remoteResult
+	if err := json.Unmarshal(out, &result); err != nil {
+		return nil, fmt.Errorf("unexpected output from the remote scan: %w", err)
+	}
+	return &result, nil
+}
+
+// shellQuote quotes s as a single word for a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// shellScan pings the targets with the remote host's ping command and
+// builds devices from the replies and its ARP table. Hostnames are looked
+// up locally.
+func (r *remote) shellScan(cidrs []string) (*remoteResult, error) {
+	if len(cidrs) == 0 {
+		out, err := r.command("ip -4 -o addr show scope global").Output()
+		if err != nil {
+			return nil, fmt.Errorf("listing remote subnets: %w", err)
+		}
+		cidrs = parseIPAddrShow(out)
+		if len(cidrs) == 0 {
+			return nil, fmt.Errorf("no IPv4 subnets on the remote host")
+		}
+	}
+
+	groups, err := targets.CIDRs(cidrs).Groups(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	var addrs []string
+	for _, g := range groups {
+		for _, ip := range g.Addresses() {
+			addrs = append(addrs, ip.String())
+		}
+	}
+
+	var script strings.Builder
+	script.WriteString("hostname; n=0\nfor ip in \\\n")
+	for _, a := range addrs {
+		script.WriteString("  " + a + " \\\n")
+	}
+	fmt.Fprintf(&script, `; do
+  (ping -c 1 -W 1 "$ip" >/dev/null 2>&1 && echo "up $ip") </dev/null &
+  n=$((n+1)); if [ $n -ge %d ]; then wait; n=0; fi
+done
+wait
+echo arp
+cat /proc/net/arp
+`, remoteParallel)
+
+	cmd := r.command("sh -s")
+	cmd.Stdin = strings.NewReader(script.String())
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := parseShellScan(out, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	result.Targets = cidrs
+
+	resolver := netops.System().Resolver
+	for _, d := range result.Devices {
+		d.AddName(scanner.ResolveHostname(context.Background(), resolver, d.IP().String()), device.SourceRDNS)
+	}
+	return result, nil
+}
+
+// parseIPAddrShow returns the subnets in the output of ip -4 -o addr show.
+func parseIPAddrShow(out []byte) []string {
+	var cidrs []string
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		for i, f := range fields {
+			if f != "inet" || i+1 >= len(fields) {
+				continue
+			}
+			ip, subnet, err := net.ParseCIDR(fields[i+1])
+			if err == nil && !ip.IsLoopback() {
+				cidrs = append(cidrs, subnet.String())
+			}
+		}
+	}
+	return cidrs
+}
+
+// parseShellScan parses the output of the shell mode script: the remote
+// hostname, "up <ip>" lines, then "arp" and the remote /proc/net/arp.
+func parseShellScan(out []byte, seen time.Time) (*remoteResult, error) {
+	result := &remoteResult{}
+	byIP := make(map[string]*device.Device)
+
+	lines := bufio.NewScanner(bytes.NewReader(out))
+	if lines.Scan() {
+		result.Host = strings.TrimSpace(lines.Text())
+	}
+	var arp bytes.Buffer
+	inARP := false
+	for lines.Scan() {
+		line := lines.Text()
+		switch {
+		case inARP:
+			arp.WriteString(line + "\n")
+		case line == "arp":
+			inARP = true
+		case strings.HasPrefix(line, "up "):
+			ip := net.ParseIP(strings.TrimPrefix(line, "up "))
+			if ip == nil {
+				continue
+			}
+			d := device.New(ip, device.SourcePing, seen)
+			byIP[ip.String()] = d
+			result.Devices = append(result.Devices, d)
+		}
+	}
+	if err := lines.Err(); err != nil {
+		return nil, err
+	}
+
+	neighbors, err := netinfo.ParseProcARP(&arp)
+	if err != nil {
+		return nil, err
+	}
+	for _, n := range neighbors {
+		if d := byIP[n.IP.String()]; d != nil && n.Complete {
+			scanner.SetMAC(d, n.MAC)
+		}
+	}
+
+	sort.Slice(result.Devices, func(i, j int) bool {
+		return bytes.Compare(result.Devices[i].IP(), result.Devices[j].IP()) < 0
+	})
+	return result, nil
+}
+
+// runRemoteScan is the scan run on the remote host in agent mode. It
+// prints a remoteResult as JSON and nothing else.
+func runRemoteScan(args []string) {
+	fs := newFlagSet("__remote-scan")
+	cidrs := fs.String("targets", "", "comma-separated CIDRs or addresses to scan")
+	fs.Parse(args)
+
+	sc := &scanner.Scanner{Probe: scanner.DefaultProbe, Inventory: inventory.New(), Ops: netops.System(), Workers: lowMemoryWorkers}
+
+	var source targets.Source = targets.CIDRs(splitList(*cidrs))
+	if *cidrs == "" {
+		interfaces, err := getNetworkInterfaces()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error getting network interfaces: %v\n", err)
+			os.Exit(1)
+		}
+		source = interfaceSource(interfaces)
+	}
+
+	groups, err := source.Groups(context.Background())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	result := remoteResult{}
+	result.Host, _ = os.Hostname()
+	for _, g := range groups {
+		if g.Subnet != nil {
+			result.Targets = append(result.Targets, g.Subnet.String())
+		} else {
+			for _, h := range g.Hosts {
+				result.Targets = append(result.Targets, h.String())
+			}
+		}
+	}
+
+	result.Devices, err = sc.Run(context.Background(), targets.SourceFunc(func(context.Context) ([]targets.Group, error) {
+		return groups, nil
+	}))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error scanning: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := json.NewEncoder(os.Stdout).Encode(result); err != nil {
+		os.Exit(1)
+	}
+}
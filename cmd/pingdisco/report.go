@@ -0,0 +1,103 @@
+package main
+
+import (
+	"html/template"
+	"io"
+	"strings"
+
+	"pingdisco.com/pingdisco/internal/device"
+	"pingdisco.com/pingdisco/internal/icon"
+	"pingdisco.com/pingdisco/internal/numfmt"
+	"pingdisco.com/pingdisco/internal/store"
+	"pingdisco.com/pingdisco/internal/timefmt"
+)
+
+var reportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Scan {{.ID}} - pingdisco</title>
+<style>
+body { font-family: system-ui, sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; }
+th, td { padding: .4em .9em; text-align: left; border-bottom: 1px solid #ddd; vertical-align: middle; }
+th { font-weight: 600; }
+td.icon { color: #2a6db0; }
+td.addr, td.mac { font-family: ui-monospace, monospace; }
+td.rtt { text-align: right; }
+.weak { color: #888; }
+.note { border-left: 4px solid #2a6db0; padding: .3em .8em; background: #f3f7fb; }
+</style>
+</head>
+<body>
+<h1>Network scan {{.ID}}</h1>
+<p>{{.Started}}, {{.Count}} devices online. Targets: {{.Targets}}</p>
+{{- if .Note}}
+<p class="note">Note: {{.Note}}</p>
+{{- end}}
+<table>
+<tr><th></th><th>Device</th><th>Address</th><th>MAC</th><th>RTT</th><th>Vendor</th><th>OS</th></tr>
+{{- range .Devices}}
+<tr>
+<td class="icon" title="{{.Icon.Name}}">{{.Icon.SVG}}</td>
+<td>{{if .Name}}{{.Name}}{{else}}<span class="weak">unnamed</span>{{end}}<br><span class="weak">{{.Icon.Name}}</span></td>
+<td class="addr">{{.IP}}</td>
+<td class="mac">{{.MAC}}</td>
+<td class="rtt">{{.RTT}}</td>
+<td{{if .Vendor.Weak}} class="weak" title="guessed from {{.Vendor.Source}}"{{end}}>{{.Vendor.Value}}</td>
+<td{{if .OS.Weak}} class="weak" title="guessed from {{.OS.Source}}"{{end}}>{{.OS.Value}}</td>
+</tr>
+{{- end}}
+</table>
+</body>
+</html>
+`))
+
+type reportField struct {
+	Value, Source string
+	Weak          bool
+}
+
+type reportDevice struct {
+	Icon struct {
+		Name string
+		SVG  template.HTML
+	}
+	Name, IP, MAC, RTT string
+	Vendor, OS         reportField
+}
+
+// writeReport writes scan as a self-contained HTML page, each device with
+// an icon of its type. Guesses of low confidence are greyed out. Times and
+// numbers are shown in the display zone, unit and locale.
+func writeReport(w io.Writer, scan store.Scan) error {
+	data := struct {
+		ID      int64
+		Started string
+		Count   string
+		Targets string
+		Note    string
+		Devices []reportDevice
+	}{ID: scan.ID, Started: timefmt.Format(scan.StartedAt), Count: numfmt.Int(len(scan.Devices)), Targets: strings.Join(scan.Targets, ", "), Note: scan.Note}
+
+	for _, d := range scan.Devices {
+		i := icon.For(d)
+		r := reportDevice{Name: d.Hostname(), IP: d.IP().String(), Vendor: reportGuess(d, device.FieldVendor), OS: reportGuess(d, device.FieldOS)}
+		// The icons are constants of this program, not scan data.
+		r.Icon.Name, r.Icon.SVG = i.Name, template.HTML(i.SVG)
+		if d.MAC != nil {
+			r.MAC = d.MAC.String()
+		}
+		if rtt := duration(d, device.AttrRTT); rtt > 0 {
+			r.RTT = numfmt.RTT(rtt)
+		}
+		data.Devices = append(data.Devices, r)
+	}
+
+	return reportTemplate.Execute(w, data)
+}
+
+func reportGuess(d *device.Device, field string) reportField {
+	g := d.Identification(field)
+	return reportField{Value: g.Value, Source: g.Source, Weak: g.Value != "" && g.Confidence <= device.Low}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"net"
+
+	"pingdisco.com/pingdisco/internal/device"
+	"pingdisco.com/pingdisco/internal/dhcp"
+)
+
+// printReservations compares the devices found with the DHCP reservations
+// for the scanned subnets.
+func printReservations(res []dhcp.Reservation, devices []*device.Device, subnets []*net.IPNet) {
+	report := dhcp.Compare(res, devices, subnets)
+
+	fmt.Println("\nDHCP reservations:")
+	fmt.Println("------------------")
+	if len(report.Unreserved)+len(report.Unused)+len(report.Moved)+len(report.Conflicts) == 0 {
+		fmt.Printf("  All %d reservations match the devices online\n", len(res))
+		return
+	}
+
+	for _, m := range report.Conflicts {
+		fmt.Printf("  Conflict: %s is reserved for %s but answered from %s\n", m.Reservation.IP, m.Reservation.MAC, describeMAC(m.Device))
+	}
+	for _, m := range report.Moved {
+		fmt.Printf("  Not using its reservation: %s is at %s instead of %s\n", m.Device.MAC, m.Device.IP(), m.Reservation.IP)
+	}
+	for _, d := range report.Unreserved {
+		name := d.Hostname()
+		if name == "" {
+			name = "(no hostname)"
+		}
+		fmt.Printf("  No reservation: %s (%s), %s\n", d.IP(), describeMAC(d), name)
+	}
+	for _, r := range report.Unused {
+		fmt.Printf("  No device online: %s\n", r)
+	}
+}
+
+func describeMAC(d *device.Device) string {
+	if d.MAC == nil {
+		return "an unknown MAC"
+	}
+	return d.MAC.String()
+}
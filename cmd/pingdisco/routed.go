@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"pingdisco.com/pingdisco/internal/netinfo"
+	"pingdisco.com/pingdisco/internal/targets"
+)
+
+// minRoutedPrefix bounds the size of routed subnets scanned with --routed;
+// larger prefixes are summaries rather than VLANs and are only listed.
+const minRoutedPrefix = 20
+
+// routedSubnets returns the private subnets in the routing table that are
+// not the prefix of a local interface, e.g. a second VLAN behind the same
+// gateway.
+func routedSubnets(interfaces []NetworkInterface) []netinfo.Route {
+	routes, err := netinfo.Routes()
+	if err != nil {
+		return nil
+	}
+
+	var result []netinfo.Route
+	seen := make(map[string]bool)
+	for _, r := range routes {
+		ones, _ := r.Destination.Mask.Size()
+		if r.Default() || ones == 32 || !r.Destination.IP.IsPrivate() || seen[r.Destination.String()] {
+			continue
+		}
+		if overlapsInterface(r.Destination, interfaces) {
+			continue
+		}
+		seen[r.Destination.String()] = true
+		result = append(result, r)
+	}
+
+	return result
+}
+
+func overlapsInterface(subnet *net.IPNet, interfaces []NetworkInterface) bool {
+	for _, iface := range interfaces {
+		if subnet.Contains(iface.IPNet.IP) || iface.IPNet.Contains(subnet.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+func describeRoute(r netinfo.Route) string {
+	via := "directly connected"
+	if r.Gateway != nil {
+		via = "via " + r.Gateway.String()
+	}
+	return fmt.Sprintf("%s %s (%s)", r.Destination, via, r.Interface)
+}
+
+// listRoutes prints the routed subnets that are not scanned.
+func listRoutes(routes []netinfo.Route) {
+	if len(routes) == 0 {
+		return
+	}
+
+	fmt.Println("\nOther private subnets in the routing table:")
+	for _, r := range routes {
+		fmt.Println("  " + describeRoute(r))
+	}
+	fmt.Println("Run with --routed to scan them as well.")
+}
+
+// routeSource yields the routed subnets, skipping those larger than
+// minRoutedPrefix.
+func routeSource(routes []netinfo.Route) targets.Source {
+	return targets.SourceFunc(func(context.Context) ([]targets.Group, error) {
+		var groups []targets.Group
+		for _, r := range routes {
+			g := targets.Group{Name: "Routed subnet: " + describeRoute(r), Subnet: r.Destination}
+			if ones, _ := r.Destination.Mask.Size(); ones < minRoutedPrefix {
+				g.Skip = fmt.Sprintf("larger than /%d", minRoutedPrefix)
+			}
+			groups = append(groups, g)
+		}
+		return groups, nil
+	})
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+
+	"pingdisco.com/pingdisco/internal/overlay"
+	"pingdisco.com/pingdisco/internal/probelog"
+	"pingdisco.com/pingdisco/internal/scanner"
+	"pingdisco.com/pingdisco/internal/targets"
+)
+
+// offlineFlags adds the flags deciding when a host that does not answer is
+// offline, starting from scanner.DefaultOfflinePolicy.
+func offlineFlags(fs *flag.FlagSet) *scanner.OfflinePolicy {
+	p := scanner.DefaultOfflinePolicy
+	fs.Func("confidence", "`percent` certainty required before a host that does not answer is called offline (default 99)", func(s string) error {
+		v, err := parsePercent(s)
+		p.Confidence = v
+		return err
+	})
+	fs.Func("assumed-loss", "`percent` of probes an online host is assumed to miss, e.g. 30 on busy Wi-Fi (default 10)", func(s string) error {
+		v, err := parsePercent(s)
+		p.Loss = v
+		return err
+	})
+	fs.Func("retries", fmt.Sprintf("`n`umber of times to probe a host that does not answer again before calling it offline, up to %d, instead of as many as --confidence and --assumed-loss call for", scanner.MaxSamples-1), func(s string) error {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 || n >= scanner.MaxSamples {
+			return fmt.Errorf("want a number from 0 to %d", scanner.MaxSamples-1)
+		}
+		p.Attempts = n + 1
+		return nil
+	})
+	fs.DurationVar(&p.Spacing, "probe-interval", p.Spacing, "time between the probes of a host that does not answer")
+	fs.DurationVar(&p.Spacing, "sample-spacing", p.Spacing, "same as --probe-interval")
+	return &p
+}
+
+// probeLogOptions are the flags of the probe log shared by scan and watch.
+type probeLogOptions struct {
+	dir  *string
+	keep *int
+}
+
+func probeLogFlags(fs *flag.FlagSet) probeLogOptions {
+	return probeLogOptions{
+		dir:  fs.String("probe-log", "", "directory to record every probe and its outcome in, as compressed daily files, for later review"),
+		keep: fs.Int("probe-log-days", probelog.DefaultKeep, "days of --probe-log files to keep"),
+	}
+}
+
+// open opens the probe log the flags ask for, or returns nil if they ask
+// for none.
+func (o probeLogOptions) open() (*probelog.Log, error) {
+	if *o.dir == "" {
+		return nil, nil
+	}
+	l, err := probelog.Open(*o.dir, *o.keep)
+	if err != nil {
+		return nil, err
+	}
+	l.OnError = func(err error) { log.Printf("%v; no longer recording probes", err) }
+	return l, nil
+}
+
+// parsePercent reads a percentage below 100, with or without a % sign, as
+// a fraction.
+func parsePercent(s string) (float64, error) {
+	v, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(s), "%"), 64)
+	if err != nil || v < 0 || v >= 100 {
+		return 0, errors.New("want a percentage from 0 to below 100")
+	}
+	return v / 100, nil
+}
+
+// interfaceSource yields the subnet of each local interface.
+func interfaceSource(interfaces []NetworkInterface) targets.Source {
+	return targets.SourceFunc(func(context.Context) ([]targets.Group, error) {
+		var groups []targets.Group
+		for _, iface := range interfaces {
+			groups = append(groups, targets.Group{
+				Name:      fmt.Sprintf("Interface: %s (%s)\nNetwork: %s", iface.Name, iface.IP, iface.IPNet),
+				Subnet:    &net.IPNet{IP: iface.IP.Mask(iface.IPNet.Mask), Mask: iface.IPNet.Mask},
+				Interface: iface.Name,
+				Local:     iface.IP,
+			})
+		}
+		return groups, nil
+	})
+}
+
+// tailscaleSource probes the peers of the tailnet, whose addresses are
+// not on the subnet of any interface.
+func tailscaleSource(d *overlay.Directory) targets.Source {
+	return targets.SourceFunc(func(context.Context) ([]targets.Group, error) {
+		name := "Tailscale peers"
+		if d.Tailnet != "" {
+			name += " of " + d.Tailnet
+		}
+		return []targets.Group{{Name: name, Hosts: d.TailscaleHosts()}}, nil
+	})
+}
+
+// liveInterfaceSource is interfaceSource listing the interfaces afresh each
+// time it is scanned, for scans repeated while interfaces come and go.
+func liveInterfaceSource() targets.Source {
+	return targets.SourceFunc(func(ctx context.Context) ([]targets.Group, error) {
+		interfaces, err := getNetworkInterfaces()
+		if err != nil {
+			return nil, err
+		}
+		return interfaceSource(interfaces).Groups(ctx)
+	})
+}
@@ -0,0 +1,568 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"pingdisco.com/pingdisco/internal/device"
+	"pingdisco.com/pingdisco/internal/events"
+	"pingdisco.com/pingdisco/internal/netinfo"
+	"pingdisco.com/pingdisco/internal/numfmt"
+	"pingdisco.com/pingdisco/internal/scanner"
+	"pingdisco.com/pingdisco/internal/store"
+	"pingdisco.com/pingdisco/internal/timefmt"
+	"pingdisco.com/pingdisco/internal/timeline"
+)
+
+// recordScan subscribes to sc's events and returns a function that saves
+// everything scanned so far to the store at url, with note and the Wi-Fi
+// network wifi points to at that time.
+func recordScan(sc *scanner.Scanner, url, note string, wifi *netinfo.WiFi) func() {
+	scan := store.Scan{StartedAt: time.Now(), Note: note}
+	sc.Bus.On(events.ScanFinished, func(e events.Event) {
+		target := e.Group.Name
+		if e.Group.Subnet != nil {
+			target = e.Group.Subnet.String()
+		}
+		scan.Targets = append(scan.Targets, target)
+		scan.Devices = append(scan.Devices, e.Devices...)
+	})
+
+	return func() {
+		scan.FinishedAt = time.Now()
+		scan.SSID, scan.BSSID = wifi.SSID, wifi.BSSID
+
+		prev, err := previousScan(url, scan.SSID)
+		if err != nil {
+			fmt.Printf("Warning: loading the previous scan: %v\n", err)
+		}
+		id, err := saveScan(url, scan)
+		if err != nil {
+			fmt.Printf("Error saving scan: %v\n", err)
+			os.Exit(1)
+		}
+		if prev.ID != 0 {
+			printMoved(prev, scan)
+		}
+		fmt.Printf("\nSaved as scan %d in %s\n", id, url)
+	}
+}
+
+// previousScan returns the latest scan in the store at url taken on the
+// Wi-Fi network ssid, or a zero Scan if there is none.
+func previousScan(url, ssid string) (store.Scan, error) {
+	st, err := store.Open(url)
+	if err != nil {
+		return store.Scan{}, err
+	}
+	defer st.Close()
+
+	ctx := context.Background()
+	list, err := st.Scans(ctx, 0)
+	if err != nil {
+		return store.Scan{}, err
+	}
+	for _, s := range list {
+		if s.SSID == ssid {
+			return st.Scan(ctx, s.ID)
+		}
+	}
+	return store.Scan{}, nil
+}
+
+// printMoved lists the devices of scan found at another address than in
+// prev, matched by MAC address or else hostname, so a renewed DHCP lease
+// does not read as one device leaving and another appearing.
+func printMoved(prev, scan store.Scan) {
+	var t timeline.Tracker
+	t.Add(prev)
+	var moved []timeline.Change
+	for _, c := range t.Add(scan).Changes {
+		if c.Kind == timeline.Moved {
+			moved = append(moved, c)
+		}
+	}
+	if len(moved) == 0 {
+		return
+	}
+	fmt.Printf("\nChanged address since scan %d, %s:\n", prev.ID, timefmt.Format(prev.StartedAt))
+	for _, c := range moved {
+		fmt.Printf("  %s\n", formatChange(c))
+	}
+}
+
+// saveScan saves scan to the store at url and returns its ID.
+func saveScan(url string, scan store.Scan) (int64, error) {
+	st, err := store.Open(url)
+	if err != nil {
+		return 0, err
+	}
+	defer st.Close()
+	return st.SaveScan(context.Background(), scan)
+}
+
+// defaultStore returns the store scans are saved to and read from unless
+// --store says otherwise: $PINGDISCO_STORE, or else the history database
+// in the state directory, so every scan is kept.
+func defaultStore() string {
+	if url := os.Getenv("PINGDISCO_STORE"); url != "" {
+		return url
+	}
+	return defaultStatePath("history.db")
+}
+
+// historyOptions are the flags of history.
+type historyOptions struct {
+	url     *string
+	limit   *int
+	note    *string
+	network *string
+}
+
+// historyFlags declares the flags of history.
+func historyFlags(fs *flag.FlagSet) historyOptions {
+	displayFlags(fs)
+	iconsFlag(fs)
+	return historyOptions{
+		url:     fs.String("store", defaultStore(), "store holding saved scans, e.g. sqlite:scans.db or bolt:scans.bolt"),
+		limit:   fs.Int("limit", 20, "number of scans to list (0 for all)"),
+		note:    fs.String("note", "", "attach this note to the given scan, replacing any earlier one (\"\" removes it)"),
+		network: networkFlag(fs),
+	}
+}
+
+func runScans(args []string) {
+	if len(args) > 0 && args[0] == "export" {
+		runHistoryExport(args[1:])
+		return
+	}
+
+	fs := newFlagSet("history")
+	opts := historyFlags(fs)
+	fs.Parse(args)
+
+	if *opts.url == "" {
+		fmt.Println("Error: --store is required")
+		os.Exit(1)
+	}
+
+	st, err := store.Open(*opts.url)
+	if err != nil {
+		fmt.Printf("Error opening store: %v\n", err)
+		os.Exit(1)
+	}
+	defer st.Close()
+
+	ctx := context.Background()
+
+	setNote := false
+	fs.Visit(func(f *flag.Flag) { setNote = setNote || f.Name == "note" })
+	if setNote {
+		if fs.NArg() != 1 {
+			fmt.Println("Error: --note needs the ID of the scan to annotate")
+			os.Exit(2)
+		}
+		id, err := strconv.ParseInt(fs.Arg(0), 10, 64)
+		if err != nil {
+			fmt.Printf("Error: invalid scan ID %q\n", fs.Arg(0))
+			os.Exit(1)
+		}
+		if err := st.SetNote(ctx, id, *opts.note); err != nil {
+			fmt.Printf("Error annotating scan %d: %v\n", id, err)
+			os.Exit(1)
+		}
+		if *opts.note == "" {
+			fmt.Printf("Note removed from scan %d\n", id)
+		} else {
+			fmt.Printf("Note saved with scan %d\n", id)
+		}
+		return
+	}
+
+	if fs.NArg() == 1 {
+		if _, err := strconv.ParseInt(fs.Arg(0), 10, 64); err != nil {
+			if err := printDeviceHistory(ctx, st, fs.Arg(0), *opts.network); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
+	if fs.NArg() == 1 || fs.NArg() == 2 {
+		id, err := strconv.ParseInt(fs.Arg(0), 10, 64)
+		if err != nil {
+			fmt.Printf("Error: invalid scan ID %q\n", fs.Arg(0))
+			os.Exit(1)
+		}
+		scan, err := st.Scan(ctx, id)
+		if err != nil {
+			fmt.Printf("Error loading scan %d: %v\n", id, err)
+			os.Exit(1)
+		}
+
+		if fs.NArg() == 2 {
+			d := findDevice(scan.Devices, fs.Arg(1))
+			if d == nil {
+				fmt.Printf("Error: %s is not in scan %d\n", fs.Arg(1), id)
+				os.Exit(1)
+			}
+			printDeviceDetails(d)
+			return
+		}
+
+		fmt.Printf("Scan %d, %s (%s)\n", scan.ID, timefmt.Format(scan.StartedAt), scan.FinishedAt.Sub(scan.StartedAt).Round(time.Second))
+		fmt.Printf("Targets: %v\n", scan.Targets)
+		if scan.SSID != "" {
+			fmt.Printf("Wi-Fi: %s\n", describeWiFi(scan.SSID, scan.BSSID))
+		}
+		if scan.Note != "" {
+			fmt.Printf("Note: %s\n", scan.Note)
+		}
+		displayDevices(scan.Devices)
+		return
+	}
+
+	n := *opts.limit
+	if *opts.network != "" {
+		n = 0
+	}
+	scans, err := st.Scans(ctx, n)
+	if err != nil {
+		fmt.Printf("Error listing scans: %v\n", err)
+		os.Exit(1)
+	}
+	scans = onNetwork(scans, *opts.network)
+	if *opts.limit > 0 && len(scans) > *opts.limit {
+		scans = scans[:*opts.limit]
+	}
+	if len(scans) == 0 && *opts.network != "" {
+		fmt.Printf("No scans saved on %s\n", *opts.network)
+		return
+	}
+	if len(scans) == 0 {
+		fmt.Println("No scans saved")
+		return
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tSTARTED\tDURATION\tNETWORK\tTARGETS\tNOTE")
+	for _, s := range scans {
+		ssid := s.SSID
+		if ssid == "" {
+			ssid = "-"
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%v\t%s\n", s.ID, timefmt.Format(s.StartedAt), s.FinishedAt.Sub(s.StartedAt).Round(time.Second), ssid, s.Targets, s.Note)
+	}
+	tw.Flush()
+}
+
+// printDeviceHistory shows when the device matching key was first and
+// last seen in the saved scans, the share of scans since that found it,
+// and at which hours of the day it is usually online.
+func printDeviceHistory(ctx context.Context, st store.Store, key, network string) error {
+	scans, err := loadTimeline(ctx, st, 0, network)
+	if err != nil {
+		return err
+	}
+	if len(scans) == 0 {
+		return errors.New("no scans saved")
+	}
+	frames := timeline.Build(scans)
+	history := timeline.History(frames, key)
+	if len(history) == 0 {
+		return fmt.Errorf("%s is in none of the %s", key, count(len(frames), "saved scan"))
+	}
+	first, last := history[0], history[len(history)-1]
+
+	fmt.Println(key)
+	fmt.Printf("  First seen  %s (scan %d)\n", timefmt.Format(first.From), first.FirstID)
+	fmt.Printf("  Last seen   %s (scan %d) at %s\n", timefmt.Format(last.To), last.LastID, last.Addresses[len(last.Addresses)-1])
+	hours := timeline.Pattern(frames, key, timefmt.Zone())
+	scanned := 0
+	for _, n := range hours.Scans {
+		scanned += n
+	}
+	fmt.Printf("  Uptime      %s%% of the %s looking for it since\n", numfmt.Float(100*hours.Uptime(), 0), count(scanned, "scan"))
+	if first.FirstID == frames[0].ID {
+		fmt.Println("  (first seen in the oldest saved scan; it may have been around before)")
+	}
+
+	fmt.Println("\nOnline by hour of day:")
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "  HOUR\tONLINE\tSCANS")
+	for hour, n := range hours.Scans {
+		if n == 0 {
+			continue
+		}
+		fmt.Fprintf(tw, "  %02d:00\t%s%%\t%d\n", hour, numfmt.Float(100*float64(hours.Online[hour])/float64(n), 0), n)
+	}
+	return tw.Flush()
+}
+
+// historyExportOptions are the flags of history export.
+type historyExportOptions struct {
+	url     *string
+	since   *time.Duration
+	key     *string
+	format  *string
+	network *string
+}
+
+// historyExportFlags declares the flags of history export.
+func historyExportFlags(fs *flag.FlagSet) historyExportOptions {
+	displayFlags(fs)
+	return historyExportOptions{
+		url:     fs.String("store", defaultStore(), "store holding saved scans, e.g. sqlite:scans.db or bolt:scans.bolt"),
+		since:   sinceFlag(fs, "only export scans started within this `duration`, e.g. 7d or 12h (default: all)"),
+		key:     fs.String("device", "", "only export this device (IP address, MAC address or name)"),
+		format:  fs.String("format", outputCSV, "output format: csv, one row per device and scan, or json"),
+		network: networkFlag(fs),
+	}
+}
+
+// runHistoryExport writes every device of every saved scan, so presence
+// and latency can be analyzed over time in other tools.
+func runHistoryExport(args []string) {
+	fs := newFlagSet("history export")
+	opts := historyExportFlags(fs)
+	fs.Parse(args)
+
+	if *opts.format != outputCSV && *opts.format != outputJSON {
+		fmt.Printf("Error: unknown format %q; use csv or json\n", *opts.format)
+		os.Exit(2)
+	}
+	if fs.NArg() > 0 {
+		fmt.Println("Error: history export takes no arguments")
+		os.Exit(2)
+	}
+	if *opts.url == "" {
+		fmt.Println("Error: --store is required")
+		os.Exit(1)
+	}
+
+	st, err := store.Open(*opts.url)
+	if err != nil {
+		fmt.Printf("Error opening store: %v\n", err)
+		os.Exit(1)
+	}
+	defer st.Close()
+
+	if err := exportHistory(context.Background(), os.Stdout, st, *opts.format, *opts.since, *opts.network, *opts.key); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// exportHistory writes the scans of st started within since, or all of
+// them for zero, oldest first. With network, only scans taken on that
+// Wi-Fi network are written, and with key, only the matching device. CSV
+// rows are written as each scan is loaded.
+func exportHistory(ctx context.Context, w io.Writer, st store.Store, format string, since time.Duration, network, key string) error {
+	list, err := st.Scans(ctx, 0)
+	if err != nil {
+		return fmt.Errorf("listing scans: %w", err)
+	}
+	list = onNetwork(list, network)
+
+	cw := csv.NewWriter(w)
+	if format == outputCSV {
+		cw.Write(append([]string{"scan_id"}, csvHeader...))
+	}
+	scans := []scanOutput{}
+	for i := len(list) - 1; i >= 0; i-- {
+		if since > 0 && time.Since(list[i].StartedAt) > since {
+			continue
+		}
+		scan, err := st.Scan(ctx, list[i].ID)
+		if err != nil {
+			return fmt.Errorf("loading scan %d: %w", list[i].ID, err)
+		}
+
+		devices := scan.Devices
+		if key != "" {
+			devices = nil
+			if d := findDevice(scan.Devices, key); d != nil {
+				devices = []*device.Device{d}
+			}
+		}
+
+		if format == outputCSV {
+			id := strconv.FormatInt(scan.ID, 10)
+			for _, d := range devices {
+				cw.Write(append([]string{id}, csvRow(d, scan.StartedAt)...))
+			}
+			cw.Flush()
+			if err := cw.Error(); err != nil {
+				return err
+			}
+			continue
+		}
+
+		out := newScanOutput(scan.StartedAt, scan.FinishedAt, scan.Targets, devices)
+		out.ID, out.Note = scan.ID, scan.Note
+		out.SSID, out.BSSID = scan.SSID, scan.BSSID
+		scans = append(scans, out)
+	}
+
+	if format == outputCSV {
+		cw.Flush()
+		return cw.Error()
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(scans)
+}
+
+// networkFlag adds --network, which limits history to the scans taken on
+// one Wi-Fi network.
+func networkFlag(fs *flag.FlagSet) *string {
+	return fs.String("network", "", "only include scans taken on the Wi-Fi network with this SSID")
+}
+
+// onNetwork returns the scans of list taken on the Wi-Fi network ssid, or
+// all of them for "".
+func onNetwork(list []store.Scan, ssid string) []store.Scan {
+	if ssid == "" {
+		return list
+	}
+	var scans []store.Scan
+	for _, s := range list {
+		if s.SSID == ssid {
+			scans = append(scans, s)
+		}
+	}
+	return scans
+}
+
+// sinceFlag adds --since, how far back to look: a duration such as 12h, or
+// a number of days such as 7d. Zero, the default, means no limit.
+func sinceFlag(fs *flag.FlagSet, usage string) *time.Duration {
+	since := new(time.Duration)
+	fs.Func("since", usage, func(s string) error {
+		d, err := parseAge(s)
+		*since = d
+		return err
+	})
+	return since
+}
+
+func parseAge(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid number of days %q", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid duration %q; use e.g. 12h or 7d", s)
+	}
+	return d, nil
+}
+
+// exportOptions are the flags of export.
+type exportOptions struct {
+	url    *string
+	format *string
+}
+
+// exportFlags declares the flags of export.
+func exportFlags(fs *flag.FlagSet) exportOptions {
+	displayFlags(fs)
+	return exportOptions{
+		url:    fs.String("store", defaultStore(), "store holding saved scans, e.g. sqlite:scans.db or bolt:scans.bolt"),
+		format: fs.String("format", "json", "output format: json, or html for a report with device icons"),
+	}
+}
+
+func runExport(args []string) {
+	fs := newFlagSet("export")
+	opts := exportFlags(fs)
+	fs.Parse(args)
+
+	if *opts.format != "json" && *opts.format != "html" {
+		fmt.Printf("Error: unknown format %q\n", *opts.format)
+		os.Exit(2)
+	}
+
+	if *opts.url == "" {
+		fmt.Println("Error: --store is required")
+		os.Exit(1)
+	}
+
+	st, err := store.Open(*opts.url)
+	if err != nil {
+		fmt.Printf("Error opening store: %v\n", err)
+		os.Exit(1)
+	}
+	defer st.Close()
+
+	id := ""
+	if fs.NArg() == 1 {
+		id = fs.Arg(0)
+	}
+	scan, err := loadScan(context.Background(), st, id)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *opts.format == "html" {
+		err = writeReport(os.Stdout, scan)
+	} else {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(scan)
+	}
+	if err != nil {
+		fmt.Printf("Error writing scan: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// findDevice returns the device with the given address, MAC address or
+// name, or nil.
+func findDevice(devices []*device.Device, key string) *device.Device {
+	for _, d := range devices {
+		if d.Matches(key) {
+			return d
+		}
+	}
+	return nil
+}
+
+// loadScan returns the scan with the given ID, or the latest one for "".
+func loadScan(ctx context.Context, st store.Store, id string) (store.Scan, error) {
+	if id == "" {
+		latest, err := st.Scans(ctx, 1)
+		if err != nil {
+			return store.Scan{}, fmt.Errorf("listing scans: %w", err)
+		}
+		if len(latest) == 0 {
+			return store.Scan{}, errors.New("no scans saved")
+		}
+		id = strconv.FormatInt(latest[0].ID, 10)
+	}
+
+	n, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return store.Scan{}, fmt.Errorf("invalid scan ID %q", id)
+	}
+	scan, err := st.Scan(ctx, n)
+	if err != nil {
+		return store.Scan{}, fmt.Errorf("loading scan %d: %w", n, err)
+	}
+	return scan, nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"pingdisco.com/pingdisco/internal/update"
+)
+
+// updatePublicKey is the base64 Ed25519 key release feeds are signed with,
+// set at build time with -ldflags "-X main.updatePublicKey=...".
+var updatePublicKey = ""
+
+// selfUpdateOptions are the flags of self-update.
+type selfUpdateOptions struct {
+	feed      *string
+	publicKey *string
+	check     *bool
+	force     *bool
+}
+
+// selfUpdateFlags declares the flags of self-update.
+func selfUpdateFlags(fs *flag.FlagSet) selfUpdateOptions {
+	return selfUpdateOptions{
+		feed:      fs.String("feed", envOr("PINGDISCO_UPDATE_FEED", update.DefaultFeedURL), "URL of the signed release feed"),
+		publicKey: fs.String("public-key", updatePublicKey, "base64 Ed25519 key the feed must be signed with"),
+		check:     fs.Bool("check", false, "only report whether an update is available"),
+		force:     fs.Bool("force", false, "install the release even if it is not newer than this build"),
+	}
+}
+
+func runSelfUpdate(args []string) {
+	fs := newFlagSet("self-update")
+	opts := selfUpdateFlags(fs)
+	fs.Parse(args)
+
+	if *opts.publicKey == "" {
+		fmt.Println("Error: this build has no release key; pass --public-key")
+		os.Exit(1)
+	}
+	key, err := update.ParsePublicKey(*opts.publicKey)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	u := &update.Updater{FeedURL: *opts.feed, PublicKey: key}
+	ctx := context.Background()
+
+	release, err := u.Latest(ctx)
+	if err != nil {
+		fmt.Printf("Error checking for updates: %v\n", err)
+		os.Exit(1)
+	}
+
+	current := buildVersion()
+	if !update.Newer(release.Version, current) && !*opts.force {
+		fmt.Printf("pingdisco %s is up to date (latest release %s)\n", current, release.Version)
+		return
+	}
+	fmt.Printf("Update available: %s -> %s\n", current, release.Version)
+	if release.Notes != "" {
+		fmt.Println(release.Notes)
+	}
+	if *opts.check {
+		return
+	}
+
+	asset, err := release.Asset(runtime.GOOS, runtime.GOARCH)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	exe, err := os.Executable()
+	if err == nil {
+		exe, err = filepath.EvalSymlinks(exe)
+	}
+	if err != nil {
+		fmt.Printf("Error locating this binary: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := u.Install(ctx, asset, exe); err != nil {
+		fmt.Printf("Error installing %s: %v\n", release.Version, err)
+		if errors.Is(err, os.ErrPermission) {
+			fmt.Printf("%s is not writable; run self-update as its owner\n", exe)
+		}
+		os.Exit(1)
+	}
+	fmt.Printf("Updated %s to %s\n", exe, release.Version)
+}
@@ -0,0 +1,136 @@
+//go:build !minimal
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"pingdisco.com/pingdisco/internal/agent"
+)
+
+// serveOptions are the flags of serve.
+type serveOptions struct {
+	listen      *string
+	joinToken   *string
+	adminToken  *string
+	state       *string
+	tlsDir      *string
+	adminListen *string
+}
+
+// serveFlags declares the flags of serve.
+func serveFlags(fs *flag.FlagSet) serveOptions {
+	return serveOptions{
+		listen:      fs.String("listen", ":7450", "address to listen on"),
+		joinToken:   fs.String("join-token", os.Getenv("PINGDISCO_JOIN_TOKEN"), "token agents must present to register"),
+		adminToken:  fs.String("admin-token", os.Getenv("PINGDISCO_ADMIN_TOKEN"), "token the agents, agents config, devices and asymmetry commands and the admin listener must present; must differ from the join token"),
+		state:       fs.String("state", defaultStatePath("server.json"), "file holding the agent registry"),
+		tlsDir:      fs.String("tls-dir", "", "directory created by 'server tls-init'; enables mutual TLS"),
+		adminListen: fs.String("admin-listen", "", "address for pprof and runtime stats, e.g. 127.0.0.1:7451 (disabled by default)"),
+	}
+}
+
+func runServer(args []string) {
+	if len(args) > 0 && args[0] == "tls-init" {
+		runServerTLSInit(args[1:])
+		return
+	}
+
+	fs := newFlagSet("serve")
+	opts := serveFlags(fs)
+	fs.Parse(args)
+
+	srv, err := agent.NewServer(*opts.joinToken, *opts.adminToken, *opts.state)
+	if err != nil {
+		fmt.Printf("Error starting server: %v\n", err)
+		os.Exit(1)
+	}
+
+	var tlsConfig *tls.Config
+	if *opts.tlsDir != "" {
+		tlsConfig, err = srv.EnableTLS(*opts.tlsDir)
+		if err != nil {
+			fmt.Printf("Error enabling TLS: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	httpServer := &http.Server{Addr: *opts.listen, Handler: srv.Handler(), TLSConfig: tlsConfig}
+
+	// The admin listener is plain HTTP and kept apart from the agent API,
+	// so it can be bound to loopback or a management network only.
+	var adminServer *http.Server
+	if *opts.adminListen != "" {
+		adminServer = &http.Server{Addr: *opts.adminListen, Handler: srv.DebugHandler()}
+		go func() {
+			log.Printf("admin endpoints listening on %s", *opts.adminListen)
+			if err := adminServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Printf("admin listener: %v", err)
+			}
+		}()
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if adminServer != nil {
+			adminServer.Shutdown(shutdownCtx)
+		}
+		httpServer.Shutdown(shutdownCtx)
+	}()
+
+	log.Printf("pingdisco server %s listening on %s", version, *opts.listen)
+	if tlsConfig != nil {
+		err = httpServer.ListenAndServeTLS("", "")
+	} else {
+		err = httpServer.ListenAndServe()
+	}
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// serveTLSInitOptions are the flags of serve tls-init.
+type serveTLSInitOptions struct {
+	dir       *string
+	hostnames *string
+}
+
+// serveTLSInitFlags declares the flags of serve tls-init.
+func serveTLSInitFlags(fs *flag.FlagSet) serveTLSInitOptions {
+	return serveTLSInitOptions{
+		dir:       fs.String("dir", defaultStatePath("tls"), "directory for the CA and server certificate"),
+		hostnames: fs.String("hostname", "localhost,127.0.0.1", "comma-separated names and addresses agents use to reach the server"),
+	}
+}
+
+func runServerTLSInit(args []string) {
+	fs := newFlagSet("serve tls-init")
+	opts := serveTLSInitFlags(fs)
+	fs.Parse(args)
+
+	fingerprint, err := agent.InitTLS(*opts.dir, splitList(*opts.hostnames))
+	if err != nil {
+		fmt.Printf("Error initialising TLS: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Server certificate written to %s\n", *opts.dir)
+	fmt.Printf("CA fingerprint: %s\n", fingerprint)
+	fmt.Println("Enroll agents with: pingdisco agent enroll --server https://<host>:7450 --join-token <token> --ca-fingerprint " + fingerprint)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"pingdisco.com/pingdisco/internal/netinfo"
+	"pingdisco.com/pingdisco/internal/snmp"
+	"pingdisco.com/pingdisco/internal/targets"
+)
+
+// snmpSeed is what a router told us over SNMP: the hosts in its ARP cache
+// and the subnets it routes.
+type snmpSeed struct {
+	router  string
+	hosts   []snmp.ARPEntry
+	subnets []*net.IPNet
+}
+
+// snmpCredentials are the SNMP settings shared by --snmp-router and
+// --snmp: a SNMPv2c community, or a SNMPv3 user when one is given.
+type snmpCredentials struct {
+	community string
+	user      string
+	// auth and priv are PROTOCOL:PASSWORD.
+	auth string
+	priv string
+}
+
+func snmpFlags(fs *flag.FlagSet) *snmpCredentials {
+	var c snmpCredentials
+	fs.StringVar(&c.community, "snmp-community", envOr("PINGDISCO_SNMP_COMMUNITY", "public"), "SNMPv2c community of --snmp-router and --snmp")
+	fs.StringVar(&c.user, "snmp-user", os.Getenv("PINGDISCO_SNMP_USER"), "query over SNMPv3 as this user instead of over SNMPv2c")
+	fs.StringVar(&c.auth, "snmp-auth", os.Getenv("PINGDISCO_SNMP_AUTH"), "SNMPv3 authentication as PROTOCOL:PASSWORD, protocol md5 or sha (default $PINGDISCO_SNMP_AUTH)")
+	fs.StringVar(&c.priv, "snmp-priv", os.Getenv("PINGDISCO_SNMP_PRIV"), "SNMPv3 privacy as aes:PASSWORD, with --snmp-auth (default $PINGDISCO_SNMP_PRIV)")
+	return &c
+}
+
+// client returns a client for target with the credentials, or an error
+// if the SNMPv3 settings are invalid.
+func (c *snmpCredentials) client(target string) (*snmp.Client, error) {
+	if c.user == "" {
+		if c.auth != "" || c.priv != "" {
+			return nil, fmt.Errorf("--snmp-auth and --snmp-priv need --snmp-user")
+		}
+		return &snmp.Client{Target: target, Community: c.community}, nil
+	}
+	u := &snmp.USM{User: c.user}
+	if c.auth != "" {
+		u.AuthProtocol, u.AuthPassword, _ = strings.Cut(c.auth, ":")
+		u.AuthProtocol = strings.ToLower(u.AuthProtocol)
+	}
+	if c.priv != "" {
+		u.PrivProtocol, u.PrivPassword, _ = strings.Cut(c.priv, ":")
+		u.PrivProtocol = strings.ToLower(u.PrivProtocol)
+	}
+	if err := u.Validate(); err != nil {
+		return nil, err
+	}
+	return &snmp.Client{Target: target, V3: u}, nil
+}
+
+func loadSNMPSeed(router string, creds *snmpCredentials) (*snmpSeed, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	c, err := creds.client(router)
+	if err != nil {
+		return nil, err
+	}
+	c.Retries = 1
+
+	hosts, err := c.ARPTable(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("reading ARP table from %s: %w", router, err)
+	}
+	subnets, err := c.Subnets(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("reading routes from %s: %w", router, err)
+	}
+
+	return &snmpSeed{router: router, hosts: hosts, subnets: subnets}, nil
+}
+
+// routes adds the seeded private subnets not already in routes.
+func (s *snmpSeed) routes(routes []netinfo.Route, interfaces []NetworkInterface) []netinfo.Route {
+	known := make(map[string]bool)
+	for _, r := range routes {
+		known[r.Destination.String()] = true
+	}
+
+	gw := net.ParseIP(s.router)
+	for _, subnet := range s.subnets {
+		if known[subnet.String()] || !subnet.IP.IsPrivate() || overlapsInterface(subnet, interfaces) {
+			continue
+		}
+		known[subnet.String()] = true
+		routes = append(routes, netinfo.Route{Destination: subnet, Gateway: gw, Interface: "snmp"})
+	}
+
+	return routes
+}
+
+// hostSource yields the hosts in the router's ARP cache. Those inside
+// subnets scanned before are not probed again.
+func (s *snmpSeed) hostSource() targets.Source {
+	return targets.SourceFunc(func(context.Context) ([]targets.Group, error) {
+		g := targets.Group{Name: "Hosts from the ARP table of " + s.router}
+		for _, h := range s.hosts {
+			g.Hosts = append(g.Hosts, h.IP)
+		}
+		return []targets.Group{g}, nil
+	})
+}
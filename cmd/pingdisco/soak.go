@@ -0,0 +1,308 @@
+//go:build soak
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"pingdisco.com/pingdisco/internal/agent"
+	"pingdisco.com/pingdisco/internal/device"
+	"pingdisco.com/pingdisco/internal/hysteresis"
+	"pingdisco.com/pingdisco/internal/inventory"
+	"pingdisco.com/pingdisco/internal/netinfo"
+	"pingdisco.com/pingdisco/internal/netops/netopstest"
+	"pingdisco.com/pingdisco/internal/numfmt"
+	"pingdisco.com/pingdisco/internal/scanner"
+	"pingdisco.com/pingdisco/internal/store"
+	"pingdisco.com/pingdisco/internal/targets"
+)
+
+func soakCommands() []*command {
+	return []*command{{name: "__soak", run: runSoak, hidden: true}}
+}
+
+// soakDevice is a device of the simulated network.
+type soakDevice struct {
+	ip    string
+	mac   net.HardwareAddr
+	name  string
+	flaky bool
+
+	// present is whether the device is on the network at all; a flaky
+	// device that is present still misses some replies.
+	present bool
+	// misses counts the consecutive replies a flaky device has missed.
+	misses int
+
+	// answered and missed count the consecutive scans the device was or
+	// was not found in, and down is the state alerts should report once
+	// the first scan has established it.
+	answered, missed int
+	down, tracked    bool
+}
+
+// runSoak runs weeks of simulated scan cycles against the fake network
+// backend in netopstest, as fast as the scanner allows, and checks what
+// only shows over a long run: that memory stays flat, the store grows
+// linearly, every state change is alerted exactly once and agent deltas
+// keep the server's copy of the inventory in step.
+func runSoak(args []string) {
+	fs := newFlagSet("__soak")
+	days := fs.Int("days", 21, "simulated days to run")
+	interval := fs.Duration("interval", 5*time.Minute, "simulated time between scans")
+	count := fs.Int("devices", 120, "devices in the simulated /24")
+	churn := fs.Float64("churn", 0.2, "share of devices joining or leaving per simulated day")
+	flaky := fs.Float64("flaky", 0.1, "share of devices that miss single replies")
+	downAfter := fs.Int("down-after", 3, "consecutive missed scans before a device is alerted as offline")
+	upAfter := fs.Int("up-after", 1, "consecutive answered scans before a device is alerted as online again")
+	storeURL := fs.String("store", "", "store to save every scan to (default: a new database in a temporary directory)")
+	maxHeapGrowth := fs.Int("max-heap-growth", 8<<20, "bytes the live heap may grow after the first simulated day")
+	seed := fs.Int64("seed", 1, "random seed, to reproduce a run")
+	fs.Parse(args)
+
+	if *count < 1 || *count > 253 {
+		fmt.Println("Error: --devices must be between 1 and 253")
+		os.Exit(2)
+	}
+
+	dbPath := ""
+	if *storeURL == "" {
+		dir, err := os.MkdirTemp("", "pingdisco-soak-")
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		defer os.RemoveAll(dir)
+		dbPath = filepath.Join(dir, "soak.db")
+		*storeURL = dbPath
+	} else if _, location, ok := strings.Cut(*storeURL, ":"); ok && location != "" {
+		dbPath = location
+	}
+
+	st, err := store.Open(*storeURL)
+	if err != nil {
+		fmt.Printf("Error opening store: %v\n", err)
+		os.Exit(1)
+	}
+	defer st.Close()
+
+	rng := rand.New(rand.NewSource(*seed))
+	ops, pinger, resolver, neighbors, _ := netopstest.New()
+
+	_, subnet, _ := net.ParseCIDR("10.99.0.0/24")
+	world := make([]*soakDevice, *count)
+	for i := range world {
+		d := &soakDevice{
+			ip:      fmt.Sprintf("10.99.0.%d", i+2),
+			mac:     net.HardwareAddr{0x02, 0x50, 0x44, 0, 0, byte(i + 2)},
+			name:    fmt.Sprintf("host-%d.soak.test", i+2),
+			flaky:   rng.Float64() < *flaky,
+			present: true,
+		}
+		resolver.Set(d.ip, d.name+".")
+		world[i] = d
+	}
+
+	sc := &scanner.Scanner{Probe: scanner.DefaultProbe, Inventory: inventory.New(), Ops: ops}
+	source := targets.SourceFunc(func(context.Context) ([]targets.Group, error) {
+		return []targets.Group{{Name: "soak", Subnet: subnet, Interface: "soak0"}}, nil
+	})
+
+	cyclesPerDay := int(24 * time.Hour / *interval)
+	toggle := *churn / float64(cyclesPerDay)
+	tracker := hysteresis.Tracker{UpAfter: *upAfter, DownAfter: *downAfter}
+	mirror := make(map[string]agent.Device)
+	prev := make(map[string]agent.Device)
+
+	var (
+		problems            []string
+		alerts, scans, rows int
+		heap, dbSize        []uint64
+		clock               = time.Date(2026, 1, 5, 0, 0, 0, 0, time.UTC)
+		started             = time.Now()
+	)
+	fail := func(format string, args ...any) {
+		if len(problems) < 20 {
+			problems = append(problems, fmt.Sprintf("%s: ", clock.Format(time.RFC3339))+fmt.Sprintf(format, args...))
+		}
+	}
+
+	fmt.Printf("Simulating %d days of scans every %s of %d devices\n", *days, *interval, *count)
+
+	for day := 1; day <= *days; day++ {
+		for cycle := 0; cycle < cyclesPerDay; cycle++ {
+			clock = clock.Add(*interval)
+
+			// Move the world on: devices join and leave, flaky ones miss
+			// replies, but never enough in a row to count as offline.
+			answering := make(map[string]bool)
+			var table []netinfo.Neighbor
+			for _, d := range world {
+				if rng.Float64() < toggle {
+					d.present = !d.present
+				}
+				answers := d.present
+				if d.present && d.flaky && d.misses < *downAfter-1 && rng.Float64() < 0.2 {
+					answers = false
+				}
+				if answers || !d.present {
+					d.misses = 0
+				}
+				if !answers && d.present {
+					d.misses++
+				}
+				if answers {
+					answering[d.ip] = true
+					table = append(table, netinfo.Neighbor{IP: net.ParseIP(d.ip), MAC: d.mac, Interface: "soak0", Complete: true})
+				}
+			}
+			pinger.Up, pinger.Calls = answering, nil
+			neighbors.Table = table
+			sc.Reset()
+
+			found, err := sc.Run(context.Background(), source)
+			if err != nil {
+				fail("scan: %v", err)
+				continue
+			}
+
+			// The scan must see exactly the devices that answered.
+			byIP := make(map[string]*device.Device, len(found))
+			for _, d := range found {
+				byIP[d.IP().String()] = d
+			}
+			if len(found) != len(answering) {
+				fail("scan found %d devices, %d answered", len(found), len(answering))
+			}
+
+			for _, w := range world {
+				d := byIP[w.ip]
+				if d != nil && (d.MAC.String() != w.mac.String() || d.Hostname() != w.name) {
+					fail("%s found as %s %s, want %s %s", w.ip, d.MAC, d.Hostname(), w.mac, w.name)
+				}
+
+				// Alerts, checked against plain counts of the scans the
+				// device was and was not found in.
+				seen := d != nil
+				if seen {
+					w.answered, w.missed = w.answered+1, 0
+				} else {
+					w.answered, w.missed = 0, w.missed+1
+				}
+				up, changed := tracker.Observe(w.ip, seen)
+				want := w.tracked && ((!w.down && w.missed == *downAfter) || (w.down && w.answered == *upAfter))
+				if !w.tracked {
+					w.down, w.tracked = !seen, true
+				}
+				switch {
+				case changed && !want:
+					fail("unexpected %s alert for %s", upDown(up), w.ip)
+				case !changed && want:
+					fail("missing %s alert for %s", upDown(!w.down), w.ip)
+				}
+				if want {
+					w.down = !w.down
+				}
+				if changed {
+					alerts++
+					if w.flaky && w.present && !up {
+						fail("flaky device %s alerted offline while present", w.ip)
+					}
+				}
+			}
+
+			// Agent sync: the server's copy must match after each delta.
+			current := make([]agent.Device, 0, len(found))
+			for _, d := range found {
+				current = append(current, agent.Device{IP: d.IP().String(), Hostname: d.Hostname(), Online: true})
+			}
+			agent.Diff(prev, current).Apply(mirror)
+			clear(prev)
+			for _, d := range current {
+				prev[d.IP] = d
+			}
+			if len(mirror) != len(current) {
+				fail("server inventory has %d devices after sync, agent has %d", len(mirror), len(current))
+			}
+			for _, d := range current {
+				if mirror[d.IP] != d {
+					fail("server inventory out of step for %s", d.IP)
+				}
+			}
+
+			if _, err := st.SaveScan(context.Background(), store.Scan{StartedAt: clock, FinishedAt: clock.Add(time.Second), Targets: []string{subnet.String()}, Devices: found}); err != nil {
+				fail("saving scan: %v", err)
+			}
+			scans++
+			rows += len(found)
+		}
+
+		runtime.GC()
+		var m runtime.MemStats
+		runtime.ReadMemStats(&m)
+		heap = append(heap, m.HeapAlloc)
+		dbSize = append(dbSize, fileSize(dbPath))
+		fmt.Printf("  day %2d: %5s scans, %6s alerts, heap %9s, store %10s\n",
+			day, numfmt.Int(scans), numfmt.Int(alerts), numfmt.Bytes(int64(m.HeapAlloc)), numfmt.Bytes(int64(dbSize[day-1])))
+	}
+
+	// Memory must level off after the first day.
+	if len(heap) > 1 {
+		peak := heap[1]
+		for _, h := range heap[1:] {
+			peak = max(peak, h)
+		}
+		if peak > heap[0]+uint64(*maxHeapGrowth) {
+			fail("heap grew from %d to %d bytes", heap[0], peak)
+		}
+	}
+
+	// The store must grow with the rows written, not faster.
+	if dbPath != "" && len(dbSize) > 2 && rows > 0 {
+		first := dbSize[1] - dbSize[0]
+		last := dbSize[len(dbSize)-1] - dbSize[len(dbSize)-2]
+		if first > 0 && float64(last) > 1.5*float64(first) {
+			fail("store grew by %d bytes on the last day but %d on the second", last, first)
+		}
+		fmt.Printf("\nStore: %d bytes for %d scans, %.0f bytes per device row\n", dbSize[len(dbSize)-1], scans, float64(dbSize[len(dbSize)-1])/float64(rows))
+	}
+
+	fmt.Printf("Ran %d scans and %d alerts in %s\n", scans, alerts, time.Since(started).Round(time.Second))
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		fmt.Println("\nFAIL")
+		for _, p := range problems {
+			fmt.Println("  " + p)
+		}
+		os.Exit(1)
+	}
+	fmt.Println("PASS")
+}
+
+func upDown(up bool) string {
+	if up {
+		return "online"
+	}
+	return "offline"
+}
+
+// fileSize returns the size of path and of an SQLite write-ahead log next
+// to it.
+func fileSize(path string) uint64 {
+	var size uint64
+	for _, p := range []string{path, path + "-wal"} {
+		if info, err := os.Stat(p); err == nil {
+			size += uint64(info.Size())
+		}
+	}
+	return size
+}
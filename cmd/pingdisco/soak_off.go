@@ -0,0 +1,8 @@
+//go:build !soak
+
+package main
+
+// soakCommands is empty unless built with -tags soak.
+func soakCommands() []*command {
+	return nil
+}
@@ -0,0 +1,371 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"pingdisco.com/pingdisco/internal/device"
+	"pingdisco.com/pingdisco/internal/icon"
+	"pingdisco.com/pingdisco/internal/store"
+	"pingdisco.com/pingdisco/internal/timefmt"
+	"pingdisco.com/pingdisco/internal/timeline"
+)
+
+// timelineOptions are the flags of timeline.
+type timelineOptions struct {
+	url     *string
+	since   *time.Duration
+	key     *string
+	format  *string
+	churn   *bool
+	network *string
+}
+
+// timelineFlags declares the flags of timeline.
+func timelineFlags(fs *flag.FlagSet) timelineOptions {
+	displayFlags(fs)
+	iconsFlag(fs)
+	return timelineOptions{
+		url:     fs.String("store", defaultStore(), "store holding saved scans, e.g. sqlite:scans.db or bolt:scans.bolt"),
+		since:   sinceFlag(fs, "only play back scans started within this `duration`, e.g. 14d or 12h (default: all)"),
+		key:     fs.String("device", "", "show when this device (IP address, MAC address or name) was online instead of every change"),
+		format:  fs.String("format", "text", "output format: text, or html for a page with a slider over the snapshots"),
+		churn:   fs.Bool("churn", false, "sum up which devices changed address and how long addresses were kept instead of every change, to spot short DHCP leases"),
+		network: networkFlag(fs),
+	}
+}
+
+func runTimeline(args []string) {
+	fs := newFlagSet("timeline")
+	opts := timelineFlags(fs)
+	fs.Parse(args)
+
+	if *opts.format != "text" && *opts.format != "html" {
+		fmt.Printf("Error: unknown format %q\n", *opts.format)
+		os.Exit(2)
+	}
+	if *opts.churn && (*opts.key != "" || *opts.format != "text") {
+		fmt.Println("Error: --churn is not available with --device or --format")
+		os.Exit(2)
+	}
+	if *opts.url == "" {
+		fmt.Println("Error: --store is required")
+		os.Exit(1)
+	}
+
+	st, err := store.Open(*opts.url)
+	if err != nil {
+		fmt.Printf("Error opening store: %v\n", err)
+		os.Exit(1)
+	}
+	defer st.Close()
+
+	scans, err := loadTimeline(context.Background(), st, *opts.since, *opts.network)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if len(scans) == 0 {
+		fmt.Println("No scans saved")
+		return
+	}
+	frames := timeline.Build(scans)
+
+	switch {
+	case *opts.format == "html":
+		err = writeTimeline(os.Stdout, frames)
+	case *opts.key != "":
+		err = printDeviceTimeline(frames, *opts.key)
+	case *opts.churn:
+		printChurn(frames)
+	default:
+		printTimeline(frames)
+	}
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// loadTimeline returns the scans started within since, or all of them for
+// zero, taken on the Wi-Fi network with SSID network, or on any for "",
+// oldest first and with their devices.
+func loadTimeline(ctx context.Context, st store.Store, since time.Duration, network string) ([]store.Scan, error) {
+	list, err := st.Scans(ctx, 0)
+	if err != nil {
+		return nil, fmt.Errorf("listing scans: %w", err)
+	}
+	list = onNetwork(list, network)
+
+	var scans []store.Scan
+	for i := len(list) - 1; i >= 0; i-- {
+		if since > 0 && time.Since(list[i].StartedAt) > since {
+			continue
+		}
+		scan, err := st.Scan(ctx, list[i].ID)
+		if err != nil {
+			return nil, fmt.Errorf("loading scan %d: %w", list[i].ID, err)
+		}
+		scans = append(scans, scan)
+	}
+	return scans, nil
+}
+
+// printTimeline lists the changes of each snapshot. Runs of snapshots of
+// one network without changes or notes are collapsed into one line.
+func printTimeline(frames []timeline.Frame) {
+	quiet := 0
+	flush := func() {
+		if quiet > 0 {
+			fmt.Printf("  ... %s without changes\n", count(quiet, "snapshot"))
+			quiet = 0
+		}
+	}
+
+	scanned := make(map[string]bool)
+	for i, f := range frames {
+		first := !scanned[f.SSID]
+		scanned[f.SSID] = true
+		if !first && frames[i-1].SSID == f.SSID && len(f.Changes) == 0 && f.Note == "" {
+			quiet++
+			continue
+		}
+		flush()
+
+		fmt.Printf("Scan %d, %s: %s", f.ID, timefmt.Format(f.At), count(len(f.Devices), "device"))
+		if f.SSID != "" {
+			fmt.Printf(" on %s", f.SSID)
+		}
+		if first {
+			fmt.Print(" (first snapshot)")
+		}
+		fmt.Println()
+		if f.Note != "" {
+			fmt.Printf("  Note: %s\n", f.Note)
+		}
+		for _, c := range f.Changes {
+			fmt.Printf("  %s\n", formatChange(c))
+		}
+	}
+	flush()
+
+	first, last := frames[0], frames[len(frames)-1]
+	fmt.Printf("\n%s from %s to %s\n", count(len(frames), "snapshot"), timefmt.Format(first.At), timefmt.Format(last.At))
+}
+
+// formatChange returns the line of c in lists of changes.
+func formatChange(c timeline.Change) string {
+	line := strings.TrimLeft(formatDevice(c.Device), " ")
+	switch c.Kind {
+	case timeline.Appeared:
+		return "+ " + line + "  (new)"
+	case timeline.Returned:
+		return "+ " + line + "  (back)"
+	case timeline.Left:
+		return "- " + line
+	case timeline.Moved:
+		return fmt.Sprintf("> %s  (moved from %s)", line, c.From)
+	case timeline.Renamed:
+		return fmt.Sprintf("~ %s  (was %s)", line, c.FromName)
+	case timeline.Replaced:
+		return fmt.Sprintf("! %s  (was %s)", line, c.FromMAC)
+	}
+	return line
+}
+
+// printDeviceTimeline shows when the device matching key was online.
+func printDeviceTimeline(frames []timeline.Frame, key string) error {
+	history := timeline.History(frames, key)
+	if len(history) == 0 {
+		return fmt.Errorf("%s is in none of the %s", key, count(len(frames), "snapshot"))
+	}
+
+	first := history[0]
+	fmt.Printf("%s first seen in scan %d, %s\n", key, first.FirstID, timefmt.Format(first.From))
+	if first.FirstID == frames[0].ID {
+		fmt.Println("  (the first snapshot played back; it may have been around before)")
+	}
+	fmt.Println()
+
+	for _, p := range history {
+		fmt.Printf("  %s to %s  %s  %s\n", timefmt.Format(p.From), timefmt.Format(p.To), count(p.Snapshots, "snapshot"), strings.Join(p.Addresses, ", "))
+	}
+	return nil
+}
+
+// printChurn lists the devices that changed address in frames and how
+// long addresses were kept.
+func printChurn(frames []timeline.Frame) {
+	c := timeline.ChurnOf(frames)
+	first, last := frames[0], frames[len(frames)-1]
+	fmt.Printf("%s from %s to %s\n", count(len(frames), "snapshot"), timefmt.Format(first.At), timefmt.Format(last.At))
+	if c.Moves == 0 {
+		fmt.Printf("No address changes among %s\n", count(c.Tracked, "device"))
+		return
+	}
+
+	fmt.Println()
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "DEVICE\tMOVES\tSHORTEST\tADDRESSES")
+	for _, d := range c.Devices {
+		shortest := "-"
+		if d.Shortest > 0 {
+			shortest = d.Shortest.Round(time.Minute).String()
+		}
+		addrs := d.Addresses
+		if len(addrs) > 5 {
+			addrs = append([]string{"..."}, addrs[len(addrs)-4:]...)
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\n", strings.TrimLeft(formatDevice(d.Device), " "), d.Moves, shortest, strings.Join(addrs, " > "))
+	}
+	tw.Flush()
+
+	fmt.Printf("\n%s by %d of %s", count(c.Moves, "address change"), len(c.Devices), count(c.Tracked, "device"))
+	if c.Held > 0 {
+		fmt.Printf("; addresses were kept for %s before changing (median)", c.Held.Round(time.Minute))
+	}
+	fmt.Println()
+	if c.Held > 0 && c.Held < 24*time.Hour {
+		fmt.Println("\nNote: addresses changing within a day point to a short DHCP lease time; lengthen it or reserve addresses for these devices.")
+	}
+}
+
+// count returns n and noun, in the plural unless n is 1.
+func count(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+var timelineTemplate = template.Must(template.New("timeline").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Network timeline - pingdisco</title>
+<style>
+body { font-family: system-ui, sans-serif; margin: 2em; color: #222; }
+input[type=range] { width: 100%; max-width: 60em; }
+#when { font-weight: 600; }
+.note { border-left: 4px solid #2a6db0; padding: .3em .8em; background: #f3f7fb; }
+table { border-collapse: collapse; margin-top: 1em; }
+td { padding: .3em .9em; border-bottom: 1px solid #ddd; vertical-align: middle; }
+td.icon { color: #2a6db0; }
+td.addr { font-family: ui-monospace, monospace; }
+tr.appeared, tr.returned { background: #e6f4ea; }
+tr.moved, tr.renamed { background: #fff4d6; }
+tr.left { color: #999; text-decoration: line-through; }
+</style>
+</head>
+<body>
+<h1>Network timeline</h1>
+<p>Drag the slider to step through {{len .Frames}} snapshots. New and returning devices are green, moved and renamed ones yellow, departed ones struck out.</p>
+<input type="range" id="slider" min="0" step="1">
+<p><span id="when"></span> <span id="summary"></span></p>
+<p class="note" id="note" hidden></p>
+<table id="devices"></table>
+<script>
+var frames = {{.Frames}};
+var icons = {{.Icons}};
+var slider = document.getElementById("slider");
+slider.max = frames.length - 1;
+slider.value = frames.length - 1;
+
+function cell(row, text, cls) {
+	var td = row.insertCell();
+	td.textContent = text;
+	if (cls) td.className = cls;
+	return td;
+}
+
+function show(i) {
+	var f = frames[i];
+	document.getElementById("when").textContent = "Scan " + f.ID + ", " + f.At + (f.SSID ? " on " + f.SSID : "");
+	document.getElementById("summary").textContent = f.Devices.length + (f.Devices.length === 1 ? " device" : " devices") + " online";
+	var note = document.getElementById("note");
+	note.hidden = !f.Note;
+	note.textContent = "Note: " + f.Note;
+
+	var table = document.getElementById("devices");
+	table.textContent = "";
+	f.Devices.concat(f.Left).forEach(function (d) {
+		var row = table.insertRow();
+		row.className = d.Change;
+		var icon = row.insertCell();
+		icon.className = "icon";
+		icon.innerHTML = icons[d.Icon];
+		icon.title = d.Icon;
+		cell(row, d.IP, "addr");
+		cell(row, d.Name || "unnamed");
+		cell(row, d.Change === "moved" || d.Change === "renamed" ? d.Change + " from " + d.From : d.Change);
+	});
+}
+
+slider.addEventListener("input", function () { show(+slider.value); });
+show(frames.length - 1);
+</script>
+</body>
+</html>
+`))
+
+type timelineDevice struct {
+	IP, Name, Icon, Change, From string
+}
+
+type timelineFrame struct {
+	ID      int64
+	At      string
+	Note    string
+	SSID    string
+	Devices []timelineDevice
+	Left    []timelineDevice
+}
+
+// writeTimeline writes frames as a self-contained HTML page with a slider
+// to step through them.
+func writeTimeline(w io.Writer, frames []timeline.Frame) error {
+	page := struct {
+		Frames []timelineFrame
+		Icons  map[string]template.HTML
+	}{Icons: make(map[string]template.HTML)}
+
+	for _, f := range frames {
+		changes := make(map[string]timeline.Change)
+		tf := timelineFrame{ID: f.ID, At: timefmt.Format(f.At), Note: f.Note, SSID: f.SSID, Devices: []timelineDevice{}, Left: []timelineDevice{}}
+		for _, c := range f.Changes {
+			if c.Kind == timeline.Left {
+				tf.Left = append(tf.Left, timelineEntry(c.Device, c, page.Icons))
+				continue
+			}
+			changes[c.Device.ID()] = c
+		}
+		for _, d := range f.Devices {
+			tf.Devices = append(tf.Devices, timelineEntry(d, changes[d.ID()], page.Icons))
+		}
+		page.Frames = append(page.Frames, tf)
+	}
+
+	return timelineTemplate.Execute(w, page)
+}
+
+// timelineEntry describes d for the page, adding its icon to icons.
+func timelineEntry(d *device.Device, c timeline.Change, icons map[string]template.HTML) timelineDevice {
+	i := icon.For(d)
+	// The icons are constants of this program, not scan data.
+	icons[i.Name] = template.HTML(i.SVG)
+	e := timelineDevice{IP: d.IP().String(), Name: d.Hostname(), Icon: i.Name, Change: c.Kind}
+	if c.From != nil {
+		e.From = c.From.String()
+	}
+	if c.FromName != "" {
+		e.From = c.FromName
+	}
+	return e
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"pingdisco.com/pingdisco/internal/device"
+	"pingdisco.com/pingdisco/internal/topology"
+)
+
+// maxListed is the number of devices listed behind each router; the rest
+// are counted.
+const maxListed = 10
+
+// topologyMap is what traceTopology found: the devices on each local
+// subnet, and the tree of routers the others sit behind.
+type topologyMap struct {
+	direct []directLink
+	tree   *topology.Node
+	// names are the hostnames of the devices found, by address, to name
+	// the routers among them.
+	names map[string]string
+}
+
+// directLink is a local subnet and the number of devices found on it.
+type directLink struct {
+	iface   NetworkInterface
+	devices int
+}
+
+// traceTopology traces the routes to the IPv4 devices outside the subnets
+// of interfaces and records each device's place in the topology in its
+// attributes.
+func traceTopology(ctx context.Context, devices []*device.Device, interfaces []NetworkInterface, maxHops int, timeout time.Duration) *topologyMap {
+	m := &topologyMap{names: make(map[string]string)}
+	direct := make([]int, len(interfaces))
+	var targets []net.IP
+	traced := make(map[string]*device.Device)
+	for _, d := range devices {
+		ip := d.IP().To4()
+		if ip == nil {
+			continue
+		}
+		if name := d.Hostname(); name != "" {
+			m.names[ip.String()] = name
+		}
+		local := false
+		for i, iface := range interfaces {
+			if iface.IPNet.Contains(ip) {
+				direct[i]++
+				local = true
+				break
+			}
+		}
+		if local {
+			d.SetInt(device.AttrTopologyHops, 0)
+			continue
+		}
+		targets = append(targets, ip)
+		traced[ip.String()] = d
+	}
+	for i, n := range direct {
+		if n > 0 {
+			m.direct = append(m.direct, directLink{interfaces[i], n})
+		}
+	}
+
+	tracer := &topology.Tracer{MaxHops: maxHops, Timeout: timeout}
+	defer tracer.Close()
+	if len(targets) > 0 {
+		fmt.Printf("\nTracing the routes to %s beyond the local subnets (%s)...\n", count(len(targets), "device"), tracer.Method())
+	}
+	paths := tracer.Trace(ctx, targets)
+	for _, p := range paths {
+		d := traced[p.Target.String()]
+		if p.Reached {
+			d.SetInt(device.AttrTopologyHops, len(p.Routers))
+		}
+		if gw := p.Gateway(); gw != nil {
+			d.Set(device.AttrTopologyGateway, gw.String())
+		}
+		hops := make([]string, len(p.Routers))
+		for i, ip := range p.Routers {
+			hops[i] = "*"
+			if ip != nil {
+				hops[i] = ip.String()
+			}
+		}
+		d.Set(device.AttrTopologyPath, strings.Join(hops, ","))
+	}
+	m.tree = topology.Build(paths)
+	return m
+}
+
+// printTopology shows the devices on each local subnet and the tree of
+// routers the others sit behind.
+func printTopology(m *topologyMap) {
+	fmt.Println("\nTopology:")
+	fmt.Println("---------")
+	for _, l := range m.direct {
+		subnet := &net.IPNet{IP: l.iface.IPNet.IP.Mask(l.iface.IPNet.Mask), Mask: l.iface.IPNet.Mask}
+		fmt.Printf("  Directly attached on %s (%s): %s\n", l.iface.Name, subnet, count(l.devices, "device"))
+	}
+	if len(m.tree.Routers)+len(m.tree.Paths) == 0 {
+		if len(m.direct) == 0 {
+			fmt.Println("  No IPv4 devices to place")
+		}
+		return
+	}
+
+	// Devices whose route passes no router are on a link of this host
+	// outside the subnets of its interfaces, such as another address of
+	// the gateway, or did not answer.
+	if len(m.tree.Paths) > 0 {
+		fmt.Println("  No router on the way:")
+		m.printDevices(m.tree.Paths, "    ")
+	}
+	for _, n := range m.tree.Routers {
+		m.printRouter(n, "  ")
+	}
+
+	routers, devices, unreached := 0, 0, 0
+	m.tree.Walk(func(n *topology.Node) {
+		if n != m.tree && n.IP != nil {
+			routers++
+		}
+		for _, p := range n.Paths {
+			devices++
+			if !p.Reached {
+				unreached++
+			}
+		}
+	})
+	fmt.Printf("  %s traced through %s", count(devices, "device"), count(routers, "router"))
+	if unreached > 0 {
+		fmt.Printf("; %d did not answer the trace, placed behind the last router that did", unreached)
+	}
+	fmt.Println()
+}
+
+func (m *topologyMap) printRouter(n *topology.Node, indent string) {
+	label := "* (no answer)"
+	if n.IP != nil {
+		label = m.label(n.IP)
+	}
+	if len(n.Paths) > 0 {
+		label += ": " + count(len(n.Paths), "device")
+	}
+	fmt.Printf("%svia %s\n", indent, label)
+	m.printDevices(n.Paths, indent+"  ")
+	for _, c := range n.Routers {
+		m.printRouter(c, indent+"  ")
+	}
+}
+
+func (m *topologyMap) printDevices(paths []topology.Path, indent string) {
+	for i, p := range paths {
+		if i == maxListed {
+			fmt.Printf("%s... and %d more\n", indent, len(paths)-maxListed)
+			break
+		}
+		line := m.label(p.Target)
+		if !p.Reached {
+			line += ", no answer to the trace"
+		}
+		fmt.Println(indent + line)
+	}
+}
+
+// label returns ip with the hostname of the device at it, if known.
+func (m *topologyMap) label(ip net.IP) string {
+	if name := m.names[ip.String()]; name != "" {
+		return fmt.Sprintf("%s (%s)", ip, name)
+	}
+	return ip.String()
+}
@@ -0,0 +1,325 @@
+//go:build tray
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"fyne.io/systray"
+
+	"pingdisco.com/pingdisco/internal/clipboard"
+	"pingdisco.com/pingdisco/internal/device"
+	"pingdisco.com/pingdisco/internal/inventory"
+	"pingdisco.com/pingdisco/internal/netinfo"
+	"pingdisco.com/pingdisco/internal/netops"
+	"pingdisco.com/pingdisco/internal/notify"
+	"pingdisco.com/pingdisco/internal/scanner"
+	"pingdisco.com/pingdisco/internal/shortcut"
+	"pingdisco.com/pingdisco/internal/timefmt"
+)
+
+// trayMaxNotifications is the number of new devices notified one by one;
+// beyond it a single summary is shown.
+const trayMaxNotifications = 3
+
+func trayCommands() []*command {
+	return []*command{
+		{
+			name:    "tray",
+			summary: "scan in the background from a system tray icon",
+			usage:   "[flags]",
+			description: "Shows an icon in the system tray or menu bar, scans the local subnets every --interval and pops up a desktop " +
+				"notification when a device joins that was never seen before. Devices seen so far are remembered in --known; the " +
+				"first scan only records them.",
+			examples: []example{
+				{"", "pingdisco tray"},
+				{"scan every minute", "pingdisco tray --interval 1m"},
+			},
+			flags: func(fs *flag.FlagSet) { trayFlags(fs) },
+			run:   runTray,
+		},
+	}
+}
+
+// trayOptions are the flags of tray.
+type trayOptions struct {
+	interval      *time.Duration
+	inventoryPath *string
+	knownPath     *string
+	prof          *string
+}
+
+// trayFlags declares the flags of tray.
+func trayFlags(fs *flag.FlagSet) trayOptions {
+	interfaceFlags(fs)
+	return trayOptions{
+		interval:      fs.Duration("interval", 5*time.Minute, "time between scans"),
+		inventoryPath: fs.String("inventory", defaultStatePath("inventory.json"), "inventory of known devices and their probe overrides"),
+		knownPath:     fs.String("known", defaultStatePath("known-devices.json"), "file remembering the devices seen so far"),
+		prof:          profileFlag(fs),
+	}
+}
+
+func runTray(args []string) {
+	fs := newFlagSet("tray")
+	opts := trayFlags(fs)
+	fs.Parse(args)
+	profiles := selectProfile(fs, *opts.prof)
+
+	inv, err := inventory.Load(*opts.inventoryPath)
+	if err != nil {
+		fmt.Printf("Error loading inventory: %v\n", err)
+		os.Exit(1)
+	}
+	known, err := loadKnownDevices(*opts.knownPath)
+	if err != nil {
+		fmt.Printf("Error loading known devices: %v\n", err)
+		os.Exit(1)
+	}
+
+	t := &tray{
+		sc:       &scanner.Scanner{Probe: scanner.DefaultProbe, Inventory: inv, Ops: netops.System()},
+		known:    known,
+		notifier: &notify.Desktop{},
+		interval: *opts.interval,
+		profiles: profiles,
+		files:    trayFiles{inventory: opts.inventoryPath, known: opts.knownPath},
+	}
+	systray.Run(t.ready, nil)
+}
+
+type tray struct {
+	sc       *scanner.Scanner
+	known    *knownDevices
+	notifier notify.Notifier
+	interval time.Duration
+	// profiles switches files to the network profile in use before each
+	// scan.
+	profiles *profileSelector
+	files    trayFiles
+
+	status, last *systray.MenuItem
+
+	// opens holds the hidden "Open" item of each known shortcut, shown
+	// when its port answers on the newest device.
+	opens map[string]*systray.MenuItem
+
+	mu     sync.Mutex
+	newest *device.Device
+}
+
+func (t *tray) ready() {
+	systray.SetIcon(trayIcon())
+	systray.SetTooltip("pingdisco")
+
+	t.status = systray.AddMenuItem("Scanning...", "")
+	t.status.Disable()
+	t.last = systray.AddMenuItem("No new devices yet", "")
+	t.last.Disable()
+	t.copyActions()
+	t.openActions()
+	systray.AddSeparator()
+	scanNow := systray.AddMenuItem("Scan now", "Scan the local subnets now")
+	quit := systray.AddMenuItem("Quit", "Stop pingdisco")
+
+	go func() {
+		ticker := time.NewTicker(t.interval)
+		defer ticker.Stop()
+		changed := interfaceChanges(context.Background())
+
+		t.scan()
+		for {
+			select {
+			case <-ticker.C:
+			case <-scanNow.ClickedCh:
+				ticker.Reset(t.interval)
+			case <-changed:
+				ticker.Reset(t.interval)
+			case <-quit.ClickedCh:
+				systray.Quit()
+				return
+			}
+			t.scan()
+		}
+	}()
+}
+
+// scan runs one scan and notifies about the devices that joined since the
+// last one. Errors are logged and shown in the menu; the next scan retries.
+func (t *tray) scan() {
+	t.status.SetTitle("Scanning...")
+
+	if err := t.switchProfile(); err != nil {
+		t.failed(err)
+		return
+	}
+	interfaces, err := getNetworkInterfaces()
+	if err != nil {
+		t.failed(err)
+		return
+	}
+	devices, err := t.sc.Run(context.Background(), interfaceSource(interfaces))
+	if err != nil {
+		t.failed(err)
+		return
+	}
+
+	t.status.SetTitle(fmt.Sprintf("%d devices online · scanned %s", len(devices), time.Now().In(timefmt.Zone()).Format("15:04")))
+	systray.SetTooltip(fmt.Sprintf("pingdisco: %d devices online", len(devices)))
+
+	joined := t.known.add(wifiOf(interfaces).SSID, devices)
+	if err := t.known.save(); err != nil {
+		log.Printf("saving known devices: %v", err)
+	}
+	if len(joined) == 0 {
+		return
+	}
+
+	d := joined[len(joined)-1]
+	title := "Last new device: " + d.IP().String()
+	if name := d.Hostname(); name != "" {
+		title += " (" + name + ")"
+	}
+	t.last.SetTitle(title)
+	t.last.Enable()
+	t.mu.Lock()
+	t.newest = d
+	t.mu.Unlock()
+	t.notify(joined)
+	t.showShortcuts(d)
+}
+
+// trayFiles are the values of the flags naming the files a profile
+// switches.
+type trayFiles struct {
+	inventory, known *string
+}
+
+// switchProfile loads the inventory and known devices of another network
+// profile when the laptop has moved to its network.
+func (t *tray) switchProfile() error {
+	changed, err := t.profiles.apply()
+	if err != nil || !changed {
+		return err
+	}
+	inv, err := inventory.Load(*t.files.inventory)
+	if err != nil {
+		return fmt.Errorf("loading inventory: %w", err)
+	}
+	known, err := loadKnownDevices(*t.files.known)
+	if err != nil {
+		return fmt.Errorf("loading known devices: %w", err)
+	}
+	t.sc.Inventory, t.known = inv, known
+	return nil
+}
+
+// wifiOf returns the network of the first of interfaces on Wi-Fi.
+func wifiOf(interfaces []NetworkInterface) netinfo.WiFi {
+	for _, iface := range interfaces {
+		if w := netinfo.WiFiOf(iface.Name); w.SSID != "" {
+			return w
+		}
+	}
+	return netinfo.WiFi{}
+}
+
+// copyActions adds the items copying details of the newest device to the
+// clipboard below it. Clicks are handled in their own goroutine, since the
+// tray drops clicks nobody is waiting for while a scan runs.
+func (t *tray) copyActions() {
+	labels := []string{"IP address", "MAC address", "SSH command"}
+	clicked := make(chan string)
+	for _, label := range labels {
+		item := t.last.AddSubMenuItem("Copy "+label, "")
+		go func(label string) {
+			for range item.ClickedCh {
+				clicked <- label
+			}
+		}(label)
+	}
+
+	go func() {
+		for label := range clicked {
+			t.mu.Lock()
+			d := t.newest
+			t.mu.Unlock()
+			if d == nil {
+				continue
+			}
+			for _, it := range clipboard.Items(d) {
+				if it.Label != label {
+					continue
+				}
+				if err := clipboard.Write(it.Text); err != nil {
+					log.Printf("copying %s: %v", label, err)
+				}
+			}
+		}
+	}()
+}
+
+// openActions adds an item below the newest device for each known
+// shortcut, hidden until showShortcuts finds its port open.
+func (t *tray) openActions() {
+	t.opens = make(map[string]*systray.MenuItem)
+	for _, s := range shortcut.Known {
+		item := t.last.AddSubMenuItem("Open "+s.Name, "")
+		item.Hide()
+		t.opens[s.Name] = item
+
+		go func(name string) {
+			for range item.ClickedCh {
+				t.mu.Lock()
+				d := t.newest
+				t.mu.Unlock()
+				if d == nil {
+					continue
+				}
+				s, _ := shortcut.For(d.IP(), name)
+				if err := shortcut.Open(s, d.IP()); err != nil {
+					log.Print(err)
+				}
+			}
+		}(s.Name)
+	}
+}
+
+func (t *tray) showShortcuts(d *device.Device) {
+	for _, item := range t.opens {
+		item.Hide()
+	}
+	for _, s := range shortcut.Detect(context.Background(), d.IP(), shortcut.DefaultTimeout) {
+		t.opens[s.Name].SetTitle("Open " + s.URL)
+		t.opens[s.Name].Show()
+	}
+}
+
+func (t *tray) notify(joined []*device.Device) {
+	var messages []string
+	if len(joined) > trayMaxNotifications {
+		messages = append(messages, fmt.Sprintf("%d new devices on the network", len(joined)))
+	} else {
+		for _, d := range joined {
+			messages = append(messages, describeNewDevice(d))
+		}
+	}
+
+	for _, msg := range messages {
+		ev := notify.Event{Type: notify.DeviceNew, Time: time.Now(), Message: msg}
+		if err := t.notifier.Notify(context.Background(), ev); err != nil {
+			log.Printf("notifying: %v", err)
+		}
+	}
+}
+
+func (t *tray) failed(err error) {
+	log.Printf("scanning: %v", err)
+	t.status.SetTitle("Scan failed: " + err.Error())
+}
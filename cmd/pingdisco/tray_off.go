@@ -0,0 +1,8 @@
+//go:build !tray
+
+package main
+
+// trayCommands is empty unless built with -tags tray.
+func trayCommands() []*command {
+	return nil
+}
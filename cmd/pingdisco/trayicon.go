@@ -0,0 +1,45 @@
+//go:build tray
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/png"
+	"runtime"
+)
+
+// trayIcon draws the tray icon: concentric rings, as of a ping spreading
+// out. Windows wants an ICO file, which may simply wrap a PNG.
+func trayIcon() []byte {
+	const size = 32
+	img := image.NewNRGBA(image.Rect(0, 0, size, size))
+	ink := color.NRGBA{R: 0x1e, G: 0x88, B: 0xe5, A: 0xff}
+
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			dx, dy := float64(x)-15.5, float64(y)-15.5
+			r2 := dx*dx + dy*dy
+			switch {
+			case r2 < 4*4, r2 >= 8*8 && r2 < 10*10, r2 >= 13*13 && r2 < 15*15:
+				img.SetNRGBA(x, y, ink)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	png.Encode(&buf, img)
+	if runtime.GOOS != "windows" {
+		return buf.Bytes()
+	}
+
+	var ico bytes.Buffer
+	binary.Write(&ico, binary.LittleEndian, [3]uint16{0, 1, 1}) // reserved, type icon, one image
+	ico.Write([]byte{size, size, 0, 0})                         // width, height, colors, reserved
+	binary.Write(&ico, binary.LittleEndian, [2]uint16{1, 32})   // planes, bits per pixel
+	binary.Write(&ico, binary.LittleEndian, [2]uint32{uint32(buf.Len()), 6 + 16})
+	ico.Write(buf.Bytes())
+	return ico.Bytes()
+}
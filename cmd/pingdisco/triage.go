@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"pingdisco.com/pingdisco/internal/netops"
+	"pingdisco.com/pingdisco/internal/numfmt"
+	"pingdisco.com/pingdisco/internal/scanner"
+	"pingdisco.com/pingdisco/internal/upstream"
+)
+
+// anycastResolvers are pinged to tell "no internet" from "no DNS", and the
+// first one is also queried directly when the configured resolver fails.
+var anycastResolvers = []string{"1.1.1.1", "8.8.8.8", "9.9.9.9"}
+
+type triageStep struct {
+	group   string
+	target  string
+	run     func(ctx context.Context) (string, error)
+	ok      bool
+	detail  string
+	latency time.Duration
+}
+
+// triageOptions are the flags of triage.
+type triageOptions struct {
+	name      *string
+	url       *string
+	portalURL *string
+	timeout   *time.Duration
+}
+
+// triageFlags declares the flags of triage.
+func triageFlags(fs *flag.FlagSet) triageOptions {
+	return triageOptions{
+		name:      fs.String("name", "example.com", "name to resolve"),
+		url:       fs.String("url", "http://example.com/", "URL to fetch"),
+		portalURL: fs.String("captive-portal-url", upstream.DefaultCaptivePortalURL, "URL answering an empty 2xx response over plain HTTP, used to detect captive portals"),
+		timeout:   fs.Duration("timeout", 3*time.Second, "timeout for each step"),
+	}
+}
+
+func runTriage(args []string) {
+	fs := newFlagSet("triage")
+	opts := triageFlags(fs)
+	fs.Parse(args)
+
+	probe := scanner.DefaultProbe
+	probe.Timeout = *opts.timeout
+	ops := netops.System()
+	// On IPv6-only networks the public resolvers are only reachable
+	// through NAT64.
+	directServer := anycastResolvers[0]
+	if prefix := adaptToNAT64(ops); prefix.Valid() {
+		directServer = prefix.Synthesize(net.ParseIP(directServer)).String()
+		fmt.Println()
+	}
+
+	var steps []*triageStep
+	// portal is set by the portal step when one is in the way.
+	var portal upstream.Portal
+	pingStep := func(group, host string) *triageStep {
+		return &triageStep{group: group, target: host, run: func(ctx context.Context) (string, error) {
+			if !scanner.Ping(ctx, ops, host, probe) {
+				return "", fmt.Errorf("no echo reply")
+			}
+			return "echo reply", nil
+		}}
+	}
+
+	gateway := defaultGateway()
+	if gateway != nil {
+		steps = append(steps, pingStep("gateway", gateway.String()))
+	} else {
+		steps = append(steps, &triageStep{group: "gateway", target: "-", run: func(context.Context) (string, error) {
+			return "", fmt.Errorf("no default route")
+		}})
+	}
+	for _, ip := range anycastResolvers {
+		steps = append(steps, pingStep("internet", ip))
+	}
+	steps = append(steps,
+		&triageStep{group: "dns", target: "system resolver", run: func(ctx context.Context) (string, error) {
+			return resolveWith(ctx, net.DefaultResolver, *opts.name)
+		}},
+		&triageStep{group: "dns-direct", target: anycastResolvers[0], run: func(ctx context.Context) (string, error) {
+			return resolveWith(ctx, directResolver(net.JoinHostPort(directServer, "53")), *opts.name)
+		}},
+		&triageStep{group: "http", target: *opts.url, run: func(ctx context.Context) (string, error) {
+			return fetchStatus(ctx, *opts.url)
+		}},
+		&triageStep{group: "portal", target: *opts.portalURL, run: func(ctx context.Context) (string, error) {
+			p, err := upstream.DetectCaptivePortal(ctx, *opts.portalURL)
+			if err != nil {
+				return "", err
+			}
+			if p.Detected {
+				portal = p
+				return "", fmt.Errorf("captive portal: %s", p)
+			}
+			return "no captive portal", nil
+		}},
+	)
+
+	var wg sync.WaitGroup
+	for _, s := range steps {
+		wg.Add(1)
+		go func(s *triageStep) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), *opts.timeout)
+			defer cancel()
+
+			start := time.Now()
+			detail, err := s.run(ctx)
+			s.latency = time.Since(start)
+			s.ok = err == nil
+			s.detail = detail
+			if err != nil {
+				s.detail = err.Error()
+			}
+		}(s)
+	}
+	wg.Wait()
+
+	passed := make(map[string]bool)
+	failed := 0
+	for _, s := range steps {
+		status := "PASS"
+		if s.ok {
+			passed[s.group] = true
+		} else {
+			status = "FAIL"
+			failed++
+		}
+		fmt.Printf("  %-4s %-10s %-20s %9s  %s\n", status, s.group, s.target,
+			numfmt.RTT(s.latency), s.detail)
+	}
+
+	fmt.Printf("\n%s\n", triageVerdict(passed, portal))
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// triageVerdict names the most likely culprit given which groups of steps
+// had at least one success and whether a captive portal was detected.
+func triageVerdict(passed map[string]bool, portal upstream.Portal) string {
+	switch {
+	case !passed["gateway"] && !passed["internet"] && !portal.Detected:
+		return "The gateway does not answer: check the local link (cable, Wi-Fi association, DHCP)."
+	case portal.Detected && portal.LoginURL != "":
+		return "A captive portal holds traffic until you sign in at " + portal.LoginURL + "."
+	case portal.Detected:
+		return "A captive portal holds traffic until you sign in: open any web page in a browser."
+	case !passed["internet"] && !passed["http"]:
+		return "The gateway answers but the internet does not: the problem is the gateway's uplink or the ISP."
+	case !passed["dns"] && passed["dns-direct"]:
+		return "It's DNS: the configured resolver fails while public resolvers work."
+	case !passed["dns"]:
+		return "It's DNS: names do not resolve, although addresses on the internet are reachable."
+	case !passed["http"]:
+		return "Names resolve but the web fetch fails: look for a proxy, firewall or captive portal."
+	case !passed["gateway"]:
+		return "The internet works; the gateway simply does not answer ping."
+	default:
+		return "Connectivity looks healthy."
+	}
+}
+
+func directResolver(server string) *net.Resolver {
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, server)
+		},
+	}
+}
+
+func resolveWith(ctx context.Context, r *net.Resolver, name string) (string, error) {
+	addrs, err := r.LookupHost(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(addrs, ", "), nil
+}
+
+func fetchStatus(ctx context.Context, url string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return "", fmt.Errorf("%s", resp.Status)
+	}
+	return resp.Status, nil
+}
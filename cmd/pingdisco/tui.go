@@ -0,0 +1,790 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"pingdisco.com/pingdisco/internal/clipboard"
+	"pingdisco.com/pingdisco/internal/device"
+	"pingdisco.com/pingdisco/internal/events"
+	"pingdisco.com/pingdisco/internal/netinfo"
+	"pingdisco.com/pingdisco/internal/numfmt"
+	"pingdisco.com/pingdisco/internal/oui"
+	"pingdisco.com/pingdisco/internal/portscan"
+	"pingdisco.com/pingdisco/internal/scanner"
+	"pingdisco.com/pingdisco/internal/shortcut"
+	"pingdisco.com/pingdisco/internal/store"
+	"pingdisco.com/pingdisco/internal/targets"
+	"pingdisco.com/pingdisco/internal/term"
+	"pingdisco.com/pingdisco/internal/timefmt"
+)
+
+// tuiHistory is the number of scans whose round-trip times the sparkline
+// of a row shows.
+const tuiHistory = 20
+
+// tuiTopPorts is the number of most common ports tried when drilling into
+// a host, unless --ports or --top-ports chose the ports of the scan.
+const tuiTopPorts = 100
+
+// Columns of the table, in the order s cycles through them when sorting.
+const (
+	sortStatus = iota
+	sortAddress
+	sortHostname
+	sortVendor
+	sortRTT
+	sortColumns
+)
+
+var sortNames = [sortColumns]string{"status", "address", "hostname", "vendor", "RTT"}
+
+// tuiCopyKeys are the keys of the detail view that copy what
+// clipboard.Items offers, by its label.
+var tuiCopyKeys = map[term.Key]string{"c": "IP address", "m": "MAC address", "y": "SSH command"}
+
+// sparkBlocks draw the sparklines, from the lowest round-trip time of a row
+// to its highest.
+var sparkBlocks = []rune("▁▂▃▄▅▆▇█")
+
+// tuiRow is a device in the table. Devices missing from the latest scan
+// stay, as offline.
+type tuiRow struct {
+	dev    *device.Device
+	online bool
+	// rtts holds the round-trip time of each recent scan, oldest first:
+	// zero when the device answered without one being measured, -1 when
+	// it did not answer.
+	rtts     []time.Duration
+	lastSeen time.Time
+	// ports are the open ports found by drilling into the device, once
+	// portsDone is set.
+	ports        []int
+	portsRunning bool
+	portsDone    bool
+}
+
+func (r *tuiRow) rtt() time.Duration {
+	if len(r.rtts) == 0 {
+		return -1
+	}
+	return r.rtts[len(r.rtts)-1]
+}
+
+// shortcuts returns the ways of reaching the device its open ports offer,
+// once they have been scanned. Shortcut ports outside the ports tried are
+// never offered.
+func (r *tuiRow) shortcuts() []shortcut.Shortcut {
+	var found []shortcut.Shortcut
+	for _, s := range shortcut.Known {
+		if slices.Contains(r.ports, s.Port) {
+			s, _ = shortcut.For(r.dev.IP(), s.Name)
+			found = append(found, s)
+		}
+	}
+	return found
+}
+
+func (r *tuiRow) vendor() string {
+	if v := r.dev.Identification(device.FieldVendor).Value; v != "" {
+		return v
+	}
+	if r.dev.MAC != nil {
+		return oui.Vendor(r.dev.MAC)
+	}
+	return ""
+}
+
+// tuiScan is a completed scan of the table.
+type tuiScan struct {
+	scan store.Scan
+	err  error
+}
+
+// tuiPorts is a completed port scan of a host.
+type tuiPorts struct {
+	id    string
+	ports []int
+}
+
+// tui is the interactive table of scan --tui: the devices found so far,
+// rescanned every interval, sortable and filterable from the keyboard.
+// Its state belongs to the goroutine running runTUI; scans and port scans
+// report back over channels.
+type tui struct {
+	ctx      context.Context
+	sc       *scanner.Scanner
+	sources  []targets.Source
+	interval time.Duration
+	onScan   func(store.Scan)
+	ports    []int
+
+	rows     map[string]*tuiRow
+	sortBy   int
+	reverse  bool
+	filter   string
+	editing  bool
+	selected string
+	top      int
+	detail   *tuiRow
+
+	scanning bool
+	found    atomic.Int64
+	scans    int
+	lastScan time.Time
+	nextScan time.Time
+	status   string
+	ssid     string
+	// scanned and wifi are kept by the handlers of the running scan.
+	scanned   []string
+	wifi      netinfo.WiFi
+	scanDone  chan tuiScan
+	portsDone chan tuiPorts
+	logged    *tuiLog
+	out       *bufio.Writer
+}
+
+// tuiLog keeps the latest line logged while the table is up, to show it
+// in the status line instead of scribbling over the screen.
+type tuiLog struct {
+	mu   sync.Mutex
+	line string
+}
+
+func (l *tuiLog) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.line = strings.TrimSpace(string(p))
+	return len(p), nil
+}
+
+func (l *tuiLog) take() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	line := l.line
+	l.line = ""
+	return line
+}
+
+// runTUI shows the devices sources lead to in a live table, rescanning
+// every interval, until q or Ctrl-C is pressed or ctx is done. Each
+// completed scan is passed to onScan. Drilling into a host scans ports,
+// or the most common ports if ports is empty.
+func runTUI(ctx context.Context, sc *scanner.Scanner, sources []targets.Source, interval time.Duration, ports []int, onScan func(store.Scan)) error {
+	if !term.IsTerminal(os.Stdin) || !term.IsTerminal(os.Stdout) {
+		return errors.New("--tui needs a terminal")
+	}
+	if len(ports) == 0 {
+		ports, _ = portscan.Top(tuiTopPorts)
+	}
+	restore, err := term.MakeRaw(os.Stdin)
+	if err != nil {
+		return err
+	}
+	defer restore()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	t := &tui{
+		ctx:       ctx,
+		sc:        sc,
+		sources:   sources,
+		interval:  interval,
+		onScan:    onScan,
+		ports:     ports,
+		rows:      make(map[string]*tuiRow),
+		scanDone:  make(chan tuiScan, 1),
+		portsDone: make(chan tuiPorts),
+		logged:    &tuiLog{},
+		out:       bufio.NewWriter(os.Stdout),
+	}
+	log.SetOutput(t.logged)
+	defer log.SetOutput(os.Stderr)
+
+	// A bus of its own keeps the progress of the scans off the screen.
+	sc.Bus = events.New()
+	sc.Bus.On(events.ScanStarted, func(e events.Event) {
+		if e.Group.Interface != "" && t.wifi.SSID == "" {
+			t.wifi = netinfo.WiFiOf(e.Group.Interface)
+		}
+	})
+	sc.Bus.On(events.DeviceDiscovered, func(e events.Event) { t.found.Add(1) })
+	sc.Bus.On(events.ScanFinished, func(e events.Event) {
+		if e.Group.Subnet != nil {
+			t.scanned = append(t.scanned, e.Group.Subnet.String())
+		} else {
+			t.scanned = append(t.scanned, e.Group.Name)
+		}
+	})
+
+	t.out.WriteString(term.EnterAltScreen + term.HideCursor)
+	defer func() {
+		t.out.WriteString(term.ShowCursor + term.LeaveAltScreen)
+		t.out.Flush()
+	}()
+
+	keys := term.ReadKeys(os.Stdin)
+	// The table redraws often enough for the count of devices found by a
+	// running scan and a resized terminal to show.
+	redraw := time.NewTicker(250 * time.Millisecond)
+	defer redraw.Stop()
+	t.startScan()
+	for {
+		t.draw()
+		select {
+		case <-ctx.Done():
+			return nil
+		case k, ok := <-keys:
+			if !ok || !t.key(k) {
+				return nil
+			}
+		case res := <-t.scanDone:
+			t.finishScan(res)
+		case p := <-t.portsDone:
+			if r := t.rows[p.id]; r != nil {
+				r.ports, r.portsRunning, r.portsDone = p.ports, false, true
+			}
+		case <-redraw.C:
+			if !t.scanning && !time.Now().Before(t.nextScan) {
+				t.startScan()
+			}
+		}
+	}
+}
+
+// startScan starts a scan in the background unless one is running.
+func (t *tui) startScan() {
+	if t.scanning {
+		return
+	}
+	t.scanning = true
+	t.found.Store(0)
+	t.sc.Reset()
+	t.scanned = nil
+	go func() {
+		started := time.Now()
+		devices, err := t.sc.Run(t.ctx, t.sources...)
+		scan := store.Scan{StartedAt: started, FinishedAt: time.Now(), Targets: t.scanned, SSID: t.wifi.SSID, BSSID: t.wifi.BSSID, Devices: devices}
+		t.scanDone <- tuiScan{scan, err}
+	}()
+}
+
+// finishScan updates the rows with a completed scan.
+func (t *tui) finishScan(res tuiScan) {
+	t.scanning = false
+	t.nextScan = time.Now().Add(t.interval)
+	if t.ctx.Err() != nil {
+		return
+	}
+	if res.err != nil {
+		t.status = "Scan failed: " + res.err.Error()
+		return
+	}
+	t.status = ""
+	if t.onScan != nil {
+		t.onScan(res.scan)
+	}
+
+	answered := make(map[string]bool, len(res.scan.Devices))
+	for _, d := range res.scan.Devices {
+		r := t.rows[d.ID()]
+		if r == nil {
+			r = &tuiRow{}
+			t.rows[d.ID()] = r
+		}
+		r.dev, r.online, r.lastSeen = d, true, res.scan.StartedAt
+		r.rtts = append(r.rtts, duration(d, device.AttrRTT))
+		answered[d.ID()] = true
+	}
+	for id, r := range t.rows {
+		if !answered[id] {
+			r.online = false
+			r.rtts = append(r.rtts, -1)
+		}
+		if len(r.rtts) > tuiHistory {
+			r.rtts = r.rtts[len(r.rtts)-tuiHistory:]
+		}
+	}
+	t.scans++
+	t.lastScan = res.scan.StartedAt
+	t.ssid = res.scan.SSID
+}
+
+// scanPorts starts a port scan of the device of r in the background.
+func (t *tui) scanPorts(r *tuiRow) {
+	if r.portsRunning {
+		return
+	}
+	r.portsRunning = true
+	id, host := r.dev.ID(), r.dev.IP().String()
+	go func() {
+		open := portscan.ScanVia(t.ctx, t.sc.Ops.Dialer, host, t.ports, portscan.DefaultTimeout)
+		select {
+		case t.portsDone <- tuiPorts{id, open}:
+		case <-t.ctx.Done():
+		}
+	}()
+}
+
+// key handles a key press, and reports whether to go on.
+func (t *tui) key(k term.Key) bool {
+	if k == term.KeyCtrlC {
+		return false
+	}
+	if t.editing {
+		switch k {
+		case term.KeyEnter:
+			t.editing = false
+		case term.KeyEscape:
+			t.editing, t.filter = false, ""
+		case term.KeyBackspace:
+			if _, n := utf8.DecodeLastRuneInString(t.filter); n > 0 {
+				t.filter = t.filter[:len(t.filter)-n]
+			}
+		default:
+			if utf8.RuneCountInString(string(k)) == 1 {
+				t.filter += string(k)
+			}
+		}
+		return true
+	}
+	if t.detail != nil {
+		switch k {
+		case "q":
+			return false
+		case term.KeyEscape, term.KeyBackspace, term.KeyLeft:
+			t.detail = nil
+		case "p":
+			t.scanPorts(t.detail)
+		case "r":
+			t.startScan()
+		case "c", "m", "y":
+			t.copyItem(t.detail, tuiCopyKeys[k])
+		case "o":
+			t.openShortcut(t.detail, 0)
+		case "1", "2", "3", "4", "5", "6", "7", "8", "9":
+			t.openShortcut(t.detail, int(k[0]-'1'))
+		}
+		return true
+	}
+
+	rows := t.visible()
+	i := slices.IndexFunc(rows, func(r *tuiRow) bool { return r.dev.ID() == t.selected })
+	switch k {
+	case "q":
+		return false
+	case term.KeyUp, "k":
+		i--
+	case term.KeyDown, "j":
+		i++
+	case term.KeyPageUp:
+		i -= t.pageSize()
+	case term.KeyPageDown:
+		i += t.pageSize()
+	case term.KeyHome, "g":
+		i = 0
+	case term.KeyEnd, "G":
+		i = len(rows) - 1
+	case term.KeyEnter, term.KeyRight:
+		if i >= 0 {
+			t.detail = rows[i]
+			if !t.detail.portsDone {
+				t.scanPorts(t.detail)
+			}
+		}
+	case "/":
+		t.editing = true
+	case term.KeyEscape:
+		t.filter = ""
+	case "s":
+		t.sortBy = (t.sortBy + 1) % sortColumns
+	case "S":
+		t.reverse = !t.reverse
+	case "r":
+		t.startScan()
+	}
+	if len(rows) > 0 {
+		t.selected = rows[min(max(i, 0), len(rows)-1)].dev.ID()
+	}
+	return true
+}
+
+// copyItem puts what clipboard.Items offers under label for the device of
+// r on the clipboard.
+func (t *tui) copyItem(r *tuiRow, label string) {
+	for _, it := range clipboard.Items(r.dev) {
+		if it.Label != label {
+			continue
+		}
+		if err := clipboard.Write(it.Text); err != nil {
+			t.status = "Copy failed: " + err.Error()
+		} else {
+			t.status = "Copied " + it.Text
+		}
+		return
+	}
+	t.status = "No " + label + " to copy"
+}
+
+// openShortcut opens the shortcut numbered i, from 0, of the device of r.
+func (t *tui) openShortcut(r *tuiRow, i int) {
+	shortcuts := r.shortcuts()
+	switch {
+	case !r.portsDone:
+		t.status = "Waiting for the port scan"
+		return
+	case len(shortcuts) == 0:
+		t.status = "No ssh, web or remote desktop port open"
+		return
+	case i >= len(shortcuts):
+		t.status = fmt.Sprintf("No shortcut %d", i+1)
+		return
+	}
+	s := shortcuts[i]
+	if err := shortcut.Open(s, r.dev.IP()); err != nil {
+		t.status = err.Error()
+	} else {
+		t.status = "Opened " + s.URL
+	}
+}
+
+// visible returns the rows matching the filter, sorted.
+func (t *tui) visible() []*tuiRow {
+	filter := strings.ToLower(t.filter)
+	var rows []*tuiRow
+	for _, r := range t.rows {
+		if filter == "" || r.matches(filter) {
+			rows = append(rows, r)
+		}
+	}
+	slices.SortFunc(rows, func(a, b *tuiRow) int {
+		c := compareRows(a, b, t.sortBy)
+		if c == 0 {
+			c = bytes.Compare(a.dev.IP().To16(), b.dev.IP().To16())
+		}
+		if t.reverse {
+			return -c
+		}
+		return c
+	})
+	return rows
+}
+
+// matches reports whether the address, MAC address, hostname or vendor of
+// r contains filter, which is lower case.
+func (r *tuiRow) matches(filter string) bool {
+	fields := []string{r.dev.IP().String(), r.dev.Hostname(), r.vendor()}
+	if r.dev.MAC != nil {
+		fields = append(fields, r.dev.MAC.String())
+	}
+	for _, f := range fields {
+		if strings.Contains(strings.ToLower(f), filter) {
+			return true
+		}
+	}
+	return false
+}
+
+// compareRows orders rows by a column. Online devices come first by
+// status, and empty values and unanswered probes last by the others.
+func compareRows(a, b *tuiRow, column int) int {
+	switch column {
+	case sortStatus:
+		if a.online != b.online {
+			if a.online {
+				return -1
+			}
+			return 1
+		}
+	case sortHostname:
+		return compareText(a.dev.Hostname(), b.dev.Hostname())
+	case sortVendor:
+		return compareText(a.vendor(), b.vendor())
+	case sortRTT:
+		ra, rb := a.rtt(), b.rtt()
+		if (ra <= 0) != (rb <= 0) {
+			if ra <= 0 {
+				return 1
+			}
+			return -1
+		}
+		return cmp.Compare(ra, rb)
+	}
+	return 0
+}
+
+func compareText(a, b string) int {
+	if (a == "") != (b == "") {
+		if a == "" {
+			return 1
+		}
+		return -1
+	}
+	return strings.Compare(strings.ToLower(a), strings.ToLower(b))
+}
+
+// size returns the size of the terminal, or the classic 80x24 if unknown.
+func (t *tui) size() (int, int) {
+	w, h, err := term.Size(os.Stdin)
+	if err != nil || w <= 0 || h <= 0 {
+		return 80, 24
+	}
+	return w, h
+}
+
+// pageSize is the number of rows the table shows at once: the screen less
+// the two status lines, the header and the help line.
+func (t *tui) pageSize() int {
+	_, h := t.size()
+	return max(h-4, 1)
+}
+
+// draw redraws the screen.
+func (t *tui) draw() {
+	w, h := t.size()
+	var lines []string
+	if t.detail != nil {
+		lines = t.drawDetail(w)
+	} else {
+		lines = t.drawTable(w)
+	}
+	help := "↑↓ move  enter ports and details  / filter  s sort  S reverse  r rescan  q quit"
+	if t.detail != nil {
+		help = "esc back  c copy IP  m copy MAC  y copy ssh  o open  p scan ports again  r rescan  q quit"
+	} else if t.editing {
+		help = "type to filter  enter done  esc clear"
+	}
+
+	t.out.WriteString(term.Home)
+	for i, line := range lines {
+		if i >= h-1 {
+			break
+		}
+		t.out.WriteString(line + term.Reset + term.ClearLine + "\r\n")
+	}
+	t.out.WriteString(term.ClearBelow)
+	fmt.Fprintf(t.out, "\x1b[%d;1H%s%s%s", h, term.Dim, fit(help, w), term.Reset)
+	t.out.Flush()
+}
+
+// header returns the status line at the top of the screen.
+func (t *tui) header(w int) string {
+	online := 0
+	for _, r := range t.rows {
+		if r.online {
+			online++
+		}
+	}
+	s := fmt.Sprintf("pingdisco  %s, %d online", count(len(t.rows), "device"), online)
+	switch {
+	case t.scanning:
+		s += fmt.Sprintf("  scanning, %d found", t.found.Load())
+	case !t.nextScan.IsZero():
+		s += fmt.Sprintf("  last scan %s, next in %s", timefmt.Format(t.lastScan), time.Until(t.nextScan).Round(time.Second))
+	}
+	if t.ssid != "" {
+		s += "  Wi-Fi " + t.ssid
+	}
+	return term.Bold + fit(s, w) + term.Reset
+}
+
+func (t *tui) drawTable(w int) []string {
+	lines := []string{t.header(w)}
+
+	order := "ascending"
+	if t.reverse {
+		order = "descending"
+	}
+	sub := fmt.Sprintf("sorted by %s, %s", sortNames[t.sortBy], order)
+	if t.editing || t.filter != "" {
+		sub += "  filter: " + t.filter
+		if t.editing {
+			sub += "_"
+		}
+	}
+	if line := t.logged.take(); line != "" {
+		t.status = line
+	}
+	if t.status != "" {
+		sub += "  " + t.status
+	}
+	lines = append(lines, fit(sub, w))
+
+	// Status and address, hostname and vendor sharing what is left, the
+	// round-trip time and the sparkline.
+	const addrWidth, rttWidth = 15, 10
+	rows := t.visible()
+	addr := addrWidth
+	for _, r := range rows {
+		addr = max(addr, len(r.dev.IP().String()))
+	}
+	rest := max(w-2-addr-rttWidth-tuiHistory-4, 10)
+	hostWidth := rest * 3 / 5
+	vendorWidth := rest - hostWidth
+	row := func(status, ip, host, vendor, rtt, spark string) string {
+		return fmt.Sprintf("%s %s %s %s %s %s", status, fit(ip, addr), fit(host, hostWidth), fit(vendor, vendorWidth), fitRight(rtt, rttWidth), spark)
+	}
+	lines = append(lines, term.Reverse+fit(row(" ", "Address", "Hostname", "Vendor", "RTT", "History"), w))
+
+	if len(rows) == 0 {
+		if t.scanning {
+			return append(lines, "  Scanning...")
+		}
+		return append(lines, "  No devices.")
+	}
+	i := slices.IndexFunc(rows, func(r *tuiRow) bool { return r.dev.ID() == t.selected })
+	if i < 0 {
+		i = 0
+		t.selected = rows[0].dev.ID()
+	}
+	page := t.pageSize()
+	if i < t.top {
+		t.top = i
+	} else if i >= t.top+page {
+		t.top = i - page + 1
+	}
+	t.top = min(t.top, max(len(rows)-page, 0))
+
+	for j := t.top; j < len(rows) && j < t.top+page; j++ {
+		r := rows[j]
+		// Colours would end the highlight of the selected row early.
+		status := "○"
+		if r.online {
+			status = "●"
+		}
+		if j != i {
+			if r.online {
+				status = term.Green + status + term.Reset
+			} else {
+				status = term.Red + status + term.Reset + term.Dim
+			}
+		}
+		rtt := ""
+		if d := r.rtt(); d > 0 {
+			rtt = numfmt.RTT(d)
+		}
+		line := row(status, r.dev.IP().String(), r.dev.Hostname(), r.vendor(), rtt, sparkline(r.rtts))
+		if j == i {
+			line = term.Reverse + line
+		} else if !r.online {
+			line = term.Dim + line
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func (t *tui) drawDetail(w int) []string {
+	r := t.detail
+	d := r.dev
+	if line := t.logged.take(); line != "" {
+		t.status = line
+	}
+	lines := []string{t.header(w), fit(t.status, w)}
+	state := term.Green + "online" + term.Reset
+	if !r.online {
+		state = term.Red + "offline" + term.Reset + ", last seen " + timefmt.Format(r.lastSeen)
+	}
+	name := d.Hostname()
+	if name == "" {
+		name = "(no hostname)"
+	}
+	lines = append(lines, fmt.Sprintf("%s%s  %s%s  %s", term.Bold, d.IP(), name, term.Reset, state))
+	field := func(label, value string) {
+		if value != "" {
+			lines = append(lines, fit(fmt.Sprintf("  %-12s %s", label, value), w))
+		}
+	}
+	if d.MAC != nil {
+		field("MAC", formatMAC(d.MAC))
+	}
+	var others []string
+	for _, ip := range d.Addresses[1:] {
+		others = append(others, ip.String())
+	}
+	field("Also at", strings.Join(others, ", "))
+	field("Sources", strings.Join(d.Sources, ", "))
+	for _, g := range d.Identifications() {
+		if g.Field != device.FieldHostname {
+			field(g.Field, fmt.Sprintf("%s (%s confidence, from %s)", g.Value, g.Confidence, g.Source))
+		}
+	}
+	if rtt := r.rtt(); rtt > 0 {
+		field("RTT", numfmt.RTT(rtt)+"  "+sparkline(r.rtts))
+	}
+	field("Latency", formatLatency(d))
+	field("Quality", d.Get(device.AttrQuality))
+
+	lines = append(lines, "")
+	switch {
+	case r.portsRunning:
+		lines = append(lines, fmt.Sprintf("  Scanning %s...", count(len(t.ports), "port")))
+	case r.portsDone && len(r.ports) == 0:
+		lines = append(lines, fmt.Sprintf("  No open ports among %s.", count(len(t.ports), "port")))
+	case r.portsDone:
+		lines = append(lines, fmt.Sprintf("  Open ports (of %s tried):", count(len(t.ports), "port")))
+		for _, p := range r.ports {
+			lines = append(lines, fmt.Sprintf("    %d/tcp", p))
+		}
+	}
+	if shortcuts := r.shortcuts(); len(shortcuts) > 0 {
+		lines = append(lines, "", "  Open (o opens the first):")
+		for i, s := range shortcuts {
+			lines = append(lines, fit(fmt.Sprintf("    %d  %s", i+1, s.URL), w))
+		}
+	}
+	return lines
+}
+
+// sparkline draws round-trip times as bars scaled to the highest of them,
+// with a gap for each scan the device did not answer and a dot where it
+// answered without a time being measured.
+func sparkline(rtts []time.Duration) string {
+	var highest time.Duration
+	for _, d := range rtts {
+		highest = max(highest, d)
+	}
+	var b strings.Builder
+	for _, d := range rtts {
+		switch {
+		case d < 0:
+			b.WriteRune(' ')
+		case d == 0 || highest == 0:
+			b.WriteRune('·')
+		default:
+			b.WriteRune(sparkBlocks[int(d*time.Duration(len(sparkBlocks)-1)/highest)])
+		}
+	}
+	return b.String()
+}
+
+// fit pads or cuts s to w characters.
+func fit(s string, w int) string {
+	n := utf8.RuneCountInString(s)
+	if n <= w {
+		return s + strings.Repeat(" ", w-n)
+	}
+	if w <= 1 {
+		return string([]rune(s)[:w])
+	}
+	return string([]rune(s)[:w-1]) + "…"
+}
+
+func fitRight(s string, w int) string {
+	if n := utf8.RuneCountInString(s); n < w {
+		return strings.Repeat(" ", w-n) + s
+	}
+	return fit(s, w)
+}
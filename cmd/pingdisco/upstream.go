@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net"
+	"time"
+
+	"pingdisco.com/pingdisco/internal/netinfo"
+	"pingdisco.com/pingdisco/internal/upstream"
+)
+
+func runUpstream(args []string) {
+	fs := newFlagSet("upstream")
+	opts := upstreamFlags(fs)
+	fs.Parse(args)
+
+	fmt.Println("Upstream topology")
+	fmt.Println("-----------------")
+	for _, line := range discoverUpstream(*opts).Lines() {
+		fmt.Println(line)
+	}
+}
+
+func upstreamFlags(fs *flag.FlagSet) *upstream.Options {
+	var opts upstream.Options
+	fs.StringVar(&opts.PublicIPURL, "public-ip-url", upstream.DefaultPublicIPURL, "service that returns this network's public address as plain text")
+	fs.StringVar(&opts.CaptivePortalURL, "captive-portal-url", upstream.DefaultCaptivePortalURL, "URL answering an empty 2xx response over plain HTTP, used to detect captive portals")
+	fs.StringVar(&opts.TraceTarget, "trace-target", upstream.DefaultTraceTarget, "address traced to find the upstream hops")
+	fs.IntVar(&opts.MaxHops, "max-hops", 8, "number of hops to trace")
+	return &opts
+}
+
+func discoverUpstream(opts upstream.Options) upstream.Summary {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	return upstream.Discover(ctx, defaultGateway(), opts)
+}
+
+func defaultGateway() net.IP {
+	routes, err := netinfo.DefaultRoutes()
+	if err != nil || len(routes) == 0 {
+		return nil
+	}
+	return routes[0].Gateway
+}
+
+func printUpstream(opts upstream.Options) {
+	fmt.Println("\nUpstream:")
+	fmt.Println("---------")
+	for _, line := range discoverUpstream(opts).Lines() {
+		fmt.Println("  " + line)
+	}
+}
+
+func printPublicIP(url string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ip, err := upstream.PublicIP(ctx, url)
+	if err != nil {
+		fmt.Printf("Public IP: unavailable (%v)\n", err)
+		return
+	}
+	fmt.Printf("Public IP: %s\n", upstream.LookupISP(ctx, ip))
+}
+
+// checkCaptivePortal warns when a captive portal is in the way. Guest
+// networks that want a sign-in first often drop everything else, which
+// leaves a scan with nothing to show.
+func checkCaptivePortal(url string) upstream.Portal {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	portal, err := upstream.DetectCaptivePortal(ctx, url)
+	if err != nil || !portal.Detected {
+		return upstream.Portal{}
+	}
+	fmt.Printf("\nCaptive portal: %s\n", portal)
+	fmt.Println("Sign in to this network first; until then few or no devices may answer.")
+	return portal
+}
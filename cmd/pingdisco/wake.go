@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"pingdisco.com/pingdisco/internal/device"
+	"pingdisco.com/pingdisco/internal/inventory"
+	"pingdisco.com/pingdisco/internal/netops"
+	"pingdisco.com/pingdisco/internal/scanner"
+	"pingdisco.com/pingdisco/internal/store"
+	"pingdisco.com/pingdisco/internal/timefmt"
+	"pingdisco.com/pingdisco/internal/wol"
+)
+
+// wakeTarget is a host to wake: its MAC address and, if known, the
+// address it was last seen at.
+type wakeTarget struct {
+	mac net.HardwareAddr
+	ip  net.IP
+	// from says where the MAC address was found, "" if it was given.
+	from string
+}
+
+// wakeOptions are the flags of wake.
+type wakeOptions struct {
+	url           *string
+	inventoryPath *string
+	prof          *string
+	broadcast     *string
+	port          *int
+	wait          *time.Duration
+}
+
+// wakeFlags declares the flags of wake.
+func wakeFlags(fs *flag.FlagSet) wakeOptions {
+	return wakeOptions{
+		url:           fs.String("store", defaultStore(), "store holding saved scans, searched for the MAC address of a host given by name or address"),
+		inventoryPath: fs.String("inventory", defaultStatePath("inventory.json"), "inventory of known devices, searched for the MAC address first"),
+		prof:          profileFlag(fs),
+		broadcast:     fs.String("broadcast", "", "send the magic packet to this broadcast address (default: the broadcast address of the local subnet the host was last seen on, else 255.255.255.255)"),
+		port:          fs.Int("port", wol.DefaultPort, "UDP port to send the magic packet to; some network cards listen on 7"),
+		wait:          fs.Duration("wait", 0, "ping the host at its last known address until it answers or this much time has passed, e.g. 2m (0: do not wait)"),
+	}
+}
+
+func runWake(args []string) {
+	fs := newFlagSet("wake")
+	opts := wakeFlags(fs)
+	fs.Parse(args)
+	selectProfile(fs, *opts.prof)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	var bcast net.IP
+	if *opts.broadcast != "" {
+		if bcast = net.ParseIP(*opts.broadcast).To4(); bcast == nil {
+			fmt.Printf("Error: invalid broadcast address %q\n", *opts.broadcast)
+			os.Exit(2)
+		}
+	}
+
+	inv, err := inventory.Load(*opts.inventoryPath)
+	if err != nil {
+		fmt.Printf("Error loading inventory: %v\n", err)
+		os.Exit(1)
+	}
+	var st store.Store
+	if *opts.url != "" {
+		if st, err = store.Open(*opts.url); err != nil {
+			fmt.Printf("Error opening store: %v\n", err)
+			os.Exit(1)
+		}
+		defer st.Close()
+	}
+
+	ctx := context.Background()
+	var targets []wakeTarget
+	for _, key := range fs.Args() {
+		t, err := findWakeTarget(ctx, inv, st, key)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		targets = append(targets, t)
+	}
+
+	interfaces, _ := getNetworkInterfaces()
+	failed := false
+	for i, t := range targets {
+		addr := bcast
+		if addr == nil {
+			addr = broadcastFor(t.ip, interfaces)
+		}
+		if err := wol.Send(t.mac, addr, *opts.port); err != nil {
+			fmt.Printf("Error: waking %s: %v\n", fs.Arg(i), err)
+			failed = true
+			continue
+		}
+		fmt.Printf("Sent magic packet for %s to %s port %d\n", t.mac, addr, *opts.port)
+		if t.from != "" {
+			fmt.Printf("  %s: MAC address from %s\n", fs.Arg(i), t.from)
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+
+	if *opts.wait > 0 {
+		if !waitAwake(ctx, targets, *opts.wait) {
+			os.Exit(1)
+		}
+	}
+}
+
+// findWakeTarget returns the host key stands for: a MAC address as given,
+// else a device of the inventory or, failing that, of the latest saved
+// scan that has one, found by address or name.
+func findWakeTarget(ctx context.Context, inv *inventory.Inventory, st store.Store, key string) (wakeTarget, error) {
+	var t wakeTarget
+	if mac, err := net.ParseMAC(key); err == nil {
+		t.mac = mac
+		// The last address of the host tells which subnet to broadcast
+		// on, and which address to wait for.
+		key = mac.String()
+	}
+
+	if t.mac == nil {
+		for _, d := range inv.Sorted() {
+			if d.MAC == "" || (d.IP != key && !strings.EqualFold(d.Name, key)) {
+				continue
+			}
+			mac, err := net.ParseMAC(d.MAC)
+			if err != nil {
+				return t, fmt.Errorf("%s: invalid MAC address %q in the inventory", key, d.MAC)
+			}
+			t.mac, t.ip, t.from = mac, net.ParseIP(d.IP), "the inventory"
+			break
+		}
+	}
+
+	if st != nil && (t.mac == nil || t.ip == nil) {
+		d, scan, err := lastSeen(ctx, st, key, t.mac)
+		if err != nil {
+			return t, err
+		}
+		if d != nil {
+			if t.mac == nil {
+				t.mac, t.from = d.MAC, fmt.Sprintf("scan %d, %s", scan.ID, timefmt.Format(scan.StartedAt))
+			}
+			if len(d.Addresses) > 0 {
+				t.ip = d.Addresses[0]
+			}
+		}
+	}
+
+	switch {
+	case t.mac != nil:
+		return t, nil
+	case st == nil:
+		return t, fmt.Errorf("no MAC address known for %s; give the MAC address, or scan with --store to learn it", key)
+	default:
+		return t, fmt.Errorf("no MAC address known for %s in the inventory or the saved scans", key)
+	}
+}
+
+// lastSeen returns the device matching key, or with the given MAC address
+// if not nil, from the newest saved scan that has it with its MAC address,
+// and that scan. It returns a nil device if no scan has it.
+func lastSeen(ctx context.Context, st store.Store, key string, mac net.HardwareAddr) (*device.Device, store.Scan, error) {
+	// A name that resolves is also looked for by its address, as hosts
+	// are often saved without a name.
+	var resolved string
+	if mac == nil && net.ParseIP(key) == nil {
+		if ip := resolveHosts([]string{key})[key]; ip != nil {
+			resolved = ip.String()
+		}
+	}
+
+	scans, err := st.Scans(ctx, 0)
+	if err != nil {
+		return nil, store.Scan{}, fmt.Errorf("listing scans: %w", err)
+	}
+	for _, s := range scans {
+		scan, err := st.Scan(ctx, s.ID)
+		if err != nil {
+			return nil, store.Scan{}, fmt.Errorf("loading scan %d: %w", s.ID, err)
+		}
+		for _, d := range scan.Devices {
+			if d.MAC == nil {
+				continue
+			}
+			if d.Matches(key) || (resolved != "" && d.Matches(resolved)) {
+				return d, scan, nil
+			}
+		}
+	}
+	return nil, store.Scan{}, nil
+}
+
+// broadcastFor returns the broadcast address of the local subnet holding
+// ip, or the limited broadcast address if ip is unknown or not local.
+func broadcastFor(ip net.IP, interfaces []NetworkInterface) net.IP {
+	if ip != nil {
+		for _, iface := range interfaces {
+			if iface.IPNet.Contains(ip) {
+				if b := wol.DirectedBroadcast(iface.IPNet); b != nil {
+					return b
+				}
+			}
+		}
+	}
+	return wol.Broadcast
+}
+
+// waitAwake pings the targets at their last known address until each
+// answers or timeout has passed, and reports whether all of them woke.
+func waitAwake(ctx context.Context, targets []wakeTarget, timeout time.Duration) bool {
+	ops := netops.System()
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	start := time.Now()
+	all := true
+	for _, t := range targets {
+		if t.ip == nil {
+			fmt.Printf("Not waiting for %s: no address known\n", t.mac)
+			all = false
+			continue
+		}
+		fmt.Printf("Waiting for %s to answer at %s...\n", t.mac, t.ip)
+		if !pingUntilUp(ctx, ops, t.ip.String()) {
+			fmt.Printf("Error: no answer from %s within %s\n", t.ip, timeout)
+			all = false
+			continue
+		}
+		fmt.Printf("%s is up after %s\n", t.ip, time.Since(start).Round(time.Second))
+	}
+	return all
+}
+
+// pingUntilUp pings host every second until it answers, and reports
+// whether it did before ctx was done.
+func pingUntilUp(ctx context.Context, ops *netops.Ops, host string) bool {
+	probe := scanner.DefaultProbe
+	probe.Count = 1
+	for {
+		if scanner.Ping(ctx, ops, host, probe) {
+			return true
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(time.Second):
+		}
+	}
+}
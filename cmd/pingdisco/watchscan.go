@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"pingdisco.com/pingdisco/internal/device"
+	"pingdisco.com/pingdisco/internal/events"
+	"pingdisco.com/pingdisco/internal/quality"
+	"pingdisco.com/pingdisco/internal/scanner"
+	"pingdisco.com/pingdisco/internal/store"
+	"pingdisco.com/pingdisco/internal/targets"
+	"pingdisco.com/pingdisco/internal/timefmt"
+	"pingdisco.com/pingdisco/internal/timeline"
+)
+
+// watchScan rescans sources with sc every interval, and as soon as an
+// interface comes or goes, until ctx is done. Each scan is compared with
+// the ones before it and only the changes are printed: devices that came
+// online, went offline, moved or changed hostname, and devices whose
+// quality grade over the recent scans changed. first is the scan already
+// shown in full. onScan, if not nil, is called with every scan.
+func watchScan(ctx context.Context, sc *scanner.Scanner, sources []targets.Source, interval time.Duration, first store.Scan, onScan func(store.Scan)) {
+	var t timeline.Tracker
+	t.Add(first)
+	var h quality.History
+	grades := make(map[string]string)
+	gradeRound(&h, grades, first.Devices)
+
+	// A bus of its own keeps the progress of each round from drowning the
+	// changes; it only collects the targets scanned.
+	var scanned []string
+	sc.Bus = events.New()
+	sc.Bus.On(events.ScanFinished, func(e events.Event) {
+		if e.Group.Subnet != nil {
+			scanned = append(scanned, e.Group.Subnet.String())
+		} else {
+			scanned = append(scanned, e.Group.Name)
+		}
+	})
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	changed := interfaceChanges(ctx)
+	fmt.Printf("\nWatching for changes every %s (Ctrl-C to stop)\n", interval)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-changed:
+			ticker.Reset(interval)
+		}
+
+		sc.Reset()
+		scanned = nil
+		started := time.Now()
+		devices, err := sc.Run(ctx, sources...)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			log.Printf("scan: %v", err)
+			continue
+		}
+
+		regraded := gradeRound(&h, grades, devices)
+		scan := store.Scan{StartedAt: started, FinishedAt: time.Now(), Targets: scanned, SSID: first.SSID, BSSID: first.BSSID, Devices: devices}
+		if onScan != nil {
+			onScan(scan)
+		}
+		f := t.Add(scan)
+		for _, c := range f.Changes {
+			fmt.Printf("%s  %s\n", timefmt.Format(f.At), formatChange(c))
+		}
+		for _, r := range regraded {
+			fmt.Printf("%s  ~ %s  (quality was %s)\n", timefmt.Format(f.At), strings.TrimLeft(formatDevice(r.device), " "), r.from)
+		}
+	}
+}
+
+// regrade is a device whose quality grade changed during --watch.
+type regrade struct {
+	device *device.Device
+	from   string
+}
+
+// gradeRound adds the devices of one watch round to h and sets their
+// grade over the recent rounds. It returns the devices whose grade changed
+// since it was last recorded in grades, which it updates.
+func gradeRound(h *quality.History, grades map[string]string, devices []*device.Device) []regrade {
+	summaries := h.Round(devices)
+	var changed []regrade
+	for _, d := range devices {
+		grade := summaries[d.ID()].Grade.String()
+		if grade == "" {
+			// Too few rounds yet; keep the grade of this scan's own
+			// samples, if any.
+			continue
+		}
+		d.Set(device.AttrQuality, grade)
+		if from := grades[d.ID()]; from != "" && from != grade {
+			changed = append(changed, regrade{d, from})
+		}
+		grades[d.ID()] = grade
+	}
+	return changed
+}
@@ -0,0 +1,29 @@
+//go:build minimal
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"pingdisco.com/pingdisco/internal/inventory"
+	"pingdisco.com/pingdisco/internal/store"
+)
+
+// The minimal build serves no web pages: scan --serve, scan
+// --metrics-listen and floorplan render report that they are missing.
+
+var errNoWeb = fmt.Errorf("%w (built with -tags minimal)", errNotInBuild)
+
+func serveDashboard(context.Context, string, string) (func(store.Scan), error) {
+	return nil, errNoWeb
+}
+
+func serveMetrics(context.Context, string) (func(store.Scan), error) {
+	return nil, errNoWeb
+}
+
+func writeFloorPlan(io.Writer, string, *inventory.Inventory, *store.Scan) error {
+	return errNoWeb
+}
@@ -0,0 +1,248 @@
+// Package ad reads the computer accounts of an Active Directory domain over
+// LDAP and reconciles them with the devices a scan found: domain machines
+// that did not answer, and devices online that have no account.
+package ad
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"pingdisco.com/pingdisco/internal/device"
+)
+
+// accountDisabled is the bit of userAccountControl set on disabled
+// accounts.
+const accountDisabled = 0x2
+
+// Config says how to reach and search the directory.
+type Config struct {
+	// URL is a domain controller, e.g. ldaps://dc01.corp.example.
+	URL string
+	// User is the account to bind as, as user@domain or a DN, and
+	// Password its password. Any domain user may read computer accounts.
+	User     string
+	Password string
+	// Base is the DN to search below; "" searches the whole domain, as
+	// announced by the server.
+	Base string
+	// TLS configures ldaps:// connections; nil verifies the server
+	// against the system's certificate authorities.
+	TLS *tls.Config
+}
+
+// Computer is a computer account.
+type Computer struct {
+	// Name is the account's common name, e.g. "WS-042".
+	Name string
+	// DNSName is the name the machine registers in DNS, e.g.
+	// "ws-042.corp.example".
+	DNSName string
+	OS      string
+	// LastLogon is when the machine last logged on to the domain, as
+	// replicated to every domain controller: up to two weeks behind.
+	LastLogon time.Time
+	Disabled  bool
+	// Addresses are what DNSName resolves to, set by Resolve.
+	Addresses []net.IP
+}
+
+// Computers returns the computer accounts of the directory, sorted by
+// name.
+func Computers(ctx context.Context, cfg Config) ([]Computer, error) {
+	if cfg.User == "" || cfg.Password == "" {
+		return nil, errors.New("ad: a user and password are needed; Active Directory does not answer anonymous searches")
+	}
+	c, err := dial(ctx, cfg.URL, cfg.TLS)
+	if err != nil {
+		return nil, fmt.Errorf("ad: %w", err)
+	}
+	defer c.Close()
+	if err := c.bind(cfg.User, cfg.Password); err != nil {
+		return nil, fmt.Errorf("ad: binding as %s: %w", cfg.User, err)
+	}
+
+	base := cfg.Base
+	if base == "" {
+		// The root DSE names the domain the server holds.
+		err := c.search("", scopeBase, presentFilter("objectClass"), []string{"defaultNamingContext"}, func(e entry) {
+			base = e.first("defaultNamingContext")
+		})
+		if err != nil {
+			return nil, fmt.Errorf("ad: reading the root DSE: %w", err)
+		}
+		if base == "" {
+			return nil, errors.New("ad: the server names no default naming context; give the base DN")
+		}
+	}
+
+	var computers []Computer
+	attrs := []string{"cn", "dNSHostName", "operatingSystem", "lastLogonTimestamp", "userAccountControl"}
+	err = c.search(base, scopeSubtree, equalityFilter("objectClass", "computer"), attrs, func(e entry) {
+		computers = append(computers, computerOf(e))
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ad: searching %s: %w", base, err)
+	}
+	sort.Slice(computers, func(i, j int) bool { return computers[i].Name < computers[j].Name })
+	return computers, nil
+}
+
+func computerOf(e entry) Computer {
+	c := Computer{
+		Name:    e.first("cn"),
+		DNSName: strings.ToLower(strings.TrimSuffix(e.first("dNSHostName"), ".")),
+		OS:      e.first("operatingSystem"),
+	}
+	if c.Name == "" {
+		// The DN starts with the common name, e.g. CN=WS-042,OU=...
+		first, _, _ := strings.Cut(e.dn, ",")
+		_, c.Name, _ = strings.Cut(first, "=")
+	}
+	if ts, err := strconv.ParseInt(e.first("lastLogonTimestamp"), 10, 64); err == nil && ts > 0 {
+		c.LastLogon = fileTime(ts)
+	}
+	if uac, err := strconv.ParseInt(e.first("userAccountControl"), 10, 64); err == nil {
+		c.Disabled = uac&accountDisabled != 0
+	}
+	return c
+}
+
+// fileTime converts a Windows file time, in 100 ns since 1601, to a time.
+func fileTime(ts int64) time.Time {
+	const epochDiff = 116444736000000000 // 1601 to 1970 in 100 ns
+	return time.Unix(0, (ts-epochDiff)*100)
+}
+
+// resolveWorkers is the number of names Resolve looks up at once.
+const resolveWorkers = 8
+
+// Resolve looks up the addresses of the computers' DNS names, which the
+// domain's DNS servers know as machines register them.
+func Resolve(ctx context.Context, computers []Computer) {
+	var wg sync.WaitGroup
+	next := make(chan int)
+	for range resolveWorkers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				if ips, err := net.DefaultResolver.LookupIP(ctx, "ip4", computers[i].DNSName); err == nil {
+					computers[i].Addresses = ips
+				}
+			}
+		}()
+	}
+	for i, c := range computers {
+		if c.DNSName != "" && !c.Disabled {
+			next <- i
+		}
+	}
+	close(next)
+	wg.Wait()
+}
+
+// Report is the result of Compare.
+type Report struct {
+	// Online counts the accounts of devices found.
+	Online int
+	// Offline are the enabled accounts of machines expected in the scanned
+	// subnets that no device was found for.
+	Offline []Computer
+	// NoAccount are the devices found that match no account.
+	NoAccount []*device.Device
+	// Elsewhere counts the accounts not found whose address is outside
+	// the scanned subnets, Unresolved those whose name has no address and
+	// Disabled the disabled accounts, none of which are expected online.
+	Elsewhere, Unresolved, Disabled int
+}
+
+// Compare matches computer accounts against devices: by name, the DNS name
+// or the account name against the names of a device, and failing that by
+// address. Only accounts whose address is inside one of subnets, or all of
+// them if subnets is empty, are expected to be seen.
+func Compare(computers []Computer, devices []*device.Device, subnets []*net.IPNet) *Report {
+	byName := make(map[string]*device.Device)
+	byIP := make(map[string]*device.Device)
+	for _, d := range devices {
+		for _, n := range d.Names {
+			name := strings.ToLower(strings.TrimSuffix(n.Name, "."))
+			byName[name] = d
+			short, _, _ := strings.Cut(name, ".")
+			if _, taken := byName[short]; !taken {
+				byName[short] = d
+			}
+		}
+		for _, ip := range d.Addresses {
+			byIP[ip.String()] = d
+		}
+	}
+
+	report := &Report{}
+	matched := make(map[*device.Device]bool)
+	for _, c := range computers {
+		if c.Disabled {
+			report.Disabled++
+			continue
+		}
+		var d *device.Device
+		if c.DNSName != "" {
+			d = byName[c.DNSName]
+		}
+		if d == nil && c.Name != "" {
+			d = byName[strings.ToLower(c.Name)]
+		}
+		for _, ip := range c.Addresses {
+			if d != nil {
+				break
+			}
+			// An address that now belongs to another named machine is
+			// not a match.
+			if at := byIP[ip.String()]; at != nil && len(at.Names) == 0 {
+				d = at
+			}
+		}
+		switch {
+		case d != nil:
+			matched[d] = true
+			report.Online++
+		case len(c.Addresses) == 0:
+			report.Unresolved++
+		case !covered(c.Addresses, subnets):
+			report.Elsewhere++
+		default:
+			report.Offline = append(report.Offline, c)
+		}
+	}
+	for _, d := range devices {
+		if !matched[d] {
+			report.NoAccount = append(report.NoAccount, d)
+		}
+	}
+	sort.SliceStable(report.NoAccount, func(i, j int) bool {
+		return bytes.Compare(report.NoAccount[i].IP().To16(), report.NoAccount[j].IP().To16()) < 0
+	})
+	return report
+}
+
+func covered(ips []net.IP, subnets []*net.IPNet) bool {
+	if len(subnets) == 0 {
+		return true
+	}
+	for _, ip := range ips {
+		for _, s := range subnets {
+			if s.Contains(ip) {
+				return true
+			}
+		}
+	}
+	return false
+}
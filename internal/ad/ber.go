@@ -0,0 +1,25 @@
+package ad
+
+import "errors"
+
+// BER tags of LDAP (RFC 4511) messages; the universal ones are in package
+// ber.
+const (
+	tagBindRequest     = 0x60
+	tagBindResponse    = 0x61
+	tagUnbindRequest   = 0x42
+	tagSearchRequest   = 0x63
+	tagSearchEntry     = 0x64
+	tagSearchDone      = 0x65
+	tagSearchReference = 0x73
+
+	// Context-specific tags: the simple password of a bind request, the
+	// filters used and the controls of a message.
+	tagSimpleAuth  = 0x80
+	tagFilterAnd   = 0xa0
+	tagFilterEqual = 0xa3
+	tagFilterPres  = 0x87
+	tagControls    = 0xa0
+)
+
+var errMalformed = errors.New("ldap: malformed message")
@@ -0,0 +1,357 @@
+package ad
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"pingdisco.com/pingdisco/internal/ber"
+)
+
+// LDAP search scopes.
+const (
+	scopeBase    = 0
+	scopeSubtree = 2
+)
+
+// pagedResultsOID is the control asking for search results a page at a
+// time (RFC 2696), without which AD returns at most 1000 entries.
+const pagedResultsOID = "1.2.840.113556.1.4.319"
+
+// pageSize is the number of entries asked for in each page.
+const pageSize = 500
+
+// LDAP result codes with an explanation of their own.
+var resultCodes = map[int]string{
+	4:  "size limit exceeded",
+	8:  "the server requires a signed or encrypted connection; use ldaps://",
+	32: "no such object; check --ad-base",
+	49: "invalid credentials",
+	50: "insufficient access rights",
+	53: "unwilling to perform",
+}
+
+// ResultError is an operation the server refused, with its LDAP result
+// code and diagnostic message.
+type ResultError struct {
+	Code    int
+	Message string
+}
+
+func (e *ResultError) Error() string {
+	s := fmt.Sprintf("ldap: result code %d", e.Code)
+	if text, ok := resultCodes[e.Code]; ok {
+		s += " (" + text + ")"
+	}
+	if e.Message != "" {
+		s += ": " + e.Message
+	}
+	return s
+}
+
+// entry is a search result: the DN of an object and its attributes, keyed
+// by their lower-case names.
+type entry struct {
+	dn    string
+	attrs map[string][]string
+}
+
+// first returns the first value of attribute name, or "".
+func (e entry) first(name string) string {
+	if v := e.attrs[strings.ToLower(name)]; len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+// conn is a connection to an LDAP server. Operations are made one at a
+// time.
+type conn struct {
+	c  net.Conn
+	r  *bufio.Reader
+	id int64
+}
+
+// dial connects to the server at rawURL, ldap://host[:port] or
+// ldaps://host[:port], the latter over TLS configured by tlsConfig.
+// Closing ctx closes the connection.
+func dial(ctx context.Context, rawURL string, tlsConfig *tls.Config) (*conn, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("ldap: invalid URL %q, want ldaps://host or ldap://host", rawURL)
+	}
+	port := "389"
+	switch u.Scheme {
+	case "ldap":
+	case "ldaps":
+		port = "636"
+	default:
+		return nil, fmt.Errorf("ldap: unsupported scheme %q, want ldaps or ldap", u.Scheme)
+	}
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), port)
+	}
+
+	var d net.Dialer
+	c, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "ldaps" {
+		cfg := &tls.Config{}
+		if tlsConfig != nil {
+			cfg = tlsConfig.Clone()
+		}
+		if cfg.ServerName == "" {
+			cfg.ServerName = u.Hostname()
+		}
+		tc := tls.Client(c, cfg)
+		if err := tc.HandshakeContext(ctx); err != nil {
+			c.Close()
+			return nil, err
+		}
+		c = tc
+	}
+	context.AfterFunc(ctx, func() { c.Close() })
+	return &conn{c: c, r: bufio.NewReader(c)}, nil
+}
+
+// Close unbinds and closes the connection.
+func (c *conn) Close() error {
+	c.id++
+	c.c.Write(ber.TLV(ber.TagSequence, ber.Int(ber.TagInteger, c.id), []byte{tagUnbindRequest, 0}))
+	return c.c.Close()
+}
+
+// send writes the operation op, with controls if not nil, as a new message
+// and returns its ID.
+func (c *conn) send(op, controls []byte) (int64, error) {
+	c.id++
+	msg := ber.TLV(ber.TagSequence, ber.Int(ber.TagInteger, c.id), op, controls)
+	if _, err := c.c.Write(msg); err != nil {
+		return 0, err
+	}
+	return c.id, nil
+}
+
+// receive reads the next message for the operation with the given ID and
+// returns its operation tag and content and its controls, if any.
+func (c *conn) receive(id int64) (byte, []byte, []byte, error) {
+	for {
+		msg, err := ber.ReadElement(c.r)
+		if err != nil {
+			return 0, nil, nil, err
+		}
+		tag, content, _, err := ber.Split(msg)
+		if err != nil || tag != ber.TagSequence {
+			return 0, nil, nil, errMalformed
+		}
+		tag, idBytes, rest, err := ber.Split(content)
+		if err != nil || tag != ber.TagInteger {
+			return 0, nil, nil, errMalformed
+		}
+		opTag, op, rest, err := ber.Split(rest)
+		if err != nil {
+			return 0, nil, nil, err
+		}
+		if ber.ParseInt(idBytes) != id {
+			// An unsolicited notification, such as a notice of
+			// disconnection, which the next read reports.
+			continue
+		}
+		var controls []byte
+		if len(rest) > 0 {
+			if tag, ctl, _, err := ber.Split(rest); err == nil && tag == tagControls {
+				controls = ctl
+			}
+		}
+		return opTag, op, controls, nil
+	}
+}
+
+// result returns the error an LDAPResult reports, or nil for success.
+func result(b []byte) error {
+	tag, code, rest, err := ber.Split(b)
+	if err != nil || tag != ber.TagEnumerated {
+		return errMalformed
+	}
+	// The matched DN comes before the diagnostic message.
+	_, _, rest, err = ber.Split(rest)
+	if err != nil {
+		return errMalformed
+	}
+	_, msg, _, err := ber.Split(rest)
+	if err != nil {
+		return errMalformed
+	}
+	if n := int(ber.ParseInt(code)); n != 0 {
+		return &ResultError{Code: n, Message: strings.TrimRight(string(msg), "\x00\n ")}
+	}
+	return nil
+}
+
+// bind authenticates as user with password over a simple bind. AD accepts
+// user@domain as well as a DN for user.
+func (c *conn) bind(user, password string) error {
+	id, err := c.send(ber.TLV(tagBindRequest, ber.Int(ber.TagInteger, 3), ber.OctetString(user), ber.TLV(tagSimpleAuth, []byte(password))), nil)
+	if err != nil {
+		return err
+	}
+	tag, op, _, err := c.receive(id)
+	if err != nil {
+		return err
+	}
+	if tag != tagBindResponse {
+		return errMalformed
+	}
+	return result(op)
+}
+
+// equalityFilter returns the filter (attr=value).
+func equalityFilter(attr, value string) []byte {
+	return ber.TLV(tagFilterEqual, ber.OctetString(attr), ber.OctetString(value))
+}
+
+// presentFilter returns the filter (attr=*).
+func presentFilter(attr string) []byte {
+	return ber.TLV(tagFilterPres, []byte(attr))
+}
+
+// search calls fn for each object below base, or base itself for
+// scopeBase, matching filter, with the attributes attrs. Subtree searches
+// are paged. Referrals to other servers are not followed.
+func (c *conn) search(base string, scope int, filter []byte, attrs []string, fn func(entry)) error {
+	var attrList [][]byte
+	for _, a := range attrs {
+		attrList = append(attrList, ber.OctetString(a))
+	}
+	req := ber.TLV(tagSearchRequest,
+		ber.OctetString(base),
+		ber.Int(ber.TagEnumerated, int64(scope)),
+		ber.Int(ber.TagEnumerated, 0), // never dereference aliases
+		ber.Int(ber.TagInteger, 0),    // no size limit
+		ber.Int(ber.TagInteger, 0),    // no time limit
+		ber.Bool(false),
+		filter,
+		ber.TLV(ber.TagSequence, attrList...))
+
+	cookie := ""
+	for {
+		var controls []byte
+		if scope != scopeBase {
+			value := ber.TLV(ber.TagSequence, ber.Int(ber.TagInteger, pageSize), ber.OctetString(cookie))
+			controls = ber.TLV(tagControls, ber.TLV(ber.TagSequence, ber.OctetString(pagedResultsOID), ber.OctetString(string(value))))
+		}
+		id, err := c.send(req, controls)
+		if err != nil {
+			return err
+		}
+		for done := false; !done; {
+			tag, op, ctl, err := c.receive(id)
+			if err != nil {
+				return err
+			}
+			switch tag {
+			case tagSearchEntry:
+				e, err := parseEntry(op)
+				if err != nil {
+					return err
+				}
+				fn(e)
+			case tagSearchReference:
+			case tagSearchDone:
+				if err := result(op); err != nil {
+					return err
+				}
+				cookie = pagedCookie(ctl)
+				done = true
+			default:
+				return errMalformed
+			}
+		}
+		if cookie == "" {
+			return nil
+		}
+	}
+}
+
+func parseEntry(b []byte) (entry, error) {
+	_, dn, rest, err := ber.Split(b)
+	if err != nil {
+		return entry{}, err
+	}
+	e := entry{dn: string(dn), attrs: make(map[string][]string)}
+	_, list, _, err := ber.Split(rest)
+	if err != nil {
+		return entry{}, err
+	}
+	for len(list) > 0 {
+		var attr []byte
+		if _, attr, list, err = ber.Split(list); err != nil {
+			return entry{}, err
+		}
+		_, name, vals, err := ber.Split(attr)
+		if err != nil {
+			return entry{}, err
+		}
+		_, set, _, err := ber.Split(vals)
+		if err != nil {
+			return entry{}, err
+		}
+		key := strings.ToLower(string(name))
+		for len(set) > 0 {
+			var v []byte
+			if _, v, set, err = ber.Split(set); err != nil {
+				return entry{}, err
+			}
+			e.attrs[key] = append(e.attrs[key], string(v))
+		}
+	}
+	return e, nil
+}
+
+// pagedCookie returns the cookie of the paged results control among
+// controls, which asks for the next page, or "" after the last page.
+func pagedCookie(controls []byte) string {
+	for len(controls) > 0 {
+		_, ctl, rest, err := ber.Split(controls)
+		if err != nil {
+			return ""
+		}
+		controls = rest
+		_, oid, fields, err := ber.Split(ctl)
+		if err != nil || string(oid) != pagedResultsOID {
+			continue
+		}
+		for len(fields) > 0 {
+			tag, v, more, err := ber.Split(fields)
+			if err != nil {
+				return ""
+			}
+			fields = more
+			if tag != ber.TagOctetString {
+				continue
+			}
+			// The value holds the page size and the cookie.
+			_, seq, _, err := ber.Split(v)
+			if err != nil {
+				return ""
+			}
+			_, _, rest, err := ber.Split(seq)
+			if err != nil {
+				return ""
+			}
+			_, cookie, _, err := ber.Split(rest)
+			if err != nil {
+				return ""
+			}
+			return string(cookie)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,120 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/http"
+	"sort"
+)
+
+const asymmetryPath = "/api/v1/asymmetries"
+
+// Asymmetry is a device that some of the agents covering its address can
+// reach and others cannot, typically because of VLAN ACLs or Wi-Fi client
+// isolation.
+type Asymmetry struct {
+	IP              string   `json:"ip"`
+	Hostname        string   `json:"hostname,omitempty"`
+	ReachableFrom   []string `json:"reachable_from"`
+	UnreachableFrom []string `json:"unreachable_from"`
+}
+
+// Asymmetries compares the inventories of agents with overlapping coverage.
+// An agent covers the targets configured for it, or the subnets it reports
+// when it has none.
+func (s *Server) Asymmetries() []Asymmetry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	type vantage struct {
+		name    string
+		subnets []*net.IPNet
+		devices map[string]Device
+	}
+
+	var vantages []vantage
+	for id, reg := range s.agents {
+		v := vantage{name: reg.Name, devices: map[string]Device{}}
+		if inv := s.inventories[id]; inv != nil {
+			v.devices = inv.Devices
+		}
+
+		cover := s.configForLocked(id).Targets
+		if len(cover) == 0 {
+			cover = reg.Subnets
+		}
+		for _, c := range cover {
+			if _, subnet, err := net.ParseCIDR(c); err == nil {
+				v.subnets = append(v.subnets, subnet)
+			}
+		}
+		vantages = append(vantages, v)
+	}
+	sort.Slice(vantages, func(i, j int) bool { return vantages[i].name < vantages[j].name })
+
+	seen := make(map[string]Device)
+	for _, v := range vantages {
+		for ip, d := range v.devices {
+			if _, ok := seen[ip]; !ok || d.Hostname != "" {
+				seen[ip] = d
+			}
+		}
+	}
+
+	var result []Asymmetry
+	for ip, d := range seen {
+		addr := net.ParseIP(ip)
+		a := Asymmetry{IP: ip, Hostname: d.Hostname}
+
+		for _, v := range vantages {
+			if !covers(v.subnets, addr) {
+				continue
+			}
+			if _, ok := v.devices[ip]; ok {
+				a.ReachableFrom = append(a.ReachableFrom, v.name)
+			} else {
+				a.UnreachableFrom = append(a.UnreachableFrom, v.name)
+			}
+		}
+
+		if len(a.ReachableFrom) > 0 && len(a.UnreachableFrom) > 0 {
+			result = append(result, a)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return bytes.Compare(net.ParseIP(result[i].IP).To16(), net.ParseIP(result[j].IP).To16()) < 0
+	})
+	return result
+}
+
+func covers(subnets []*net.IPNet, ip net.IP) bool {
+	for _, s := range subnets {
+		if s.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) handleAsymmetries(w http.ResponseWriter, r *http.Request) {
+	if !s.checkAdminToken(r) {
+		http.Error(w, "invalid admin token", http.StatusUnauthorized)
+		return
+	}
+
+	result := s.Asymmetries()
+	if result == nil {
+		result = []Asymmetry{}
+	}
+	writeJSON(w, result)
+}
+
+// Asymmetries returns the devices reachable from only some of the agents
+// covering them.
+func (c *Client) Asymmetries(ctx context.Context, adminToken string) ([]Asymmetry, error) {
+	var result []Asymmetry
+	err := c.do(ctx, http.MethodGet, asymmetryPath, adminToken, nil, &result)
+	return result, err
+}
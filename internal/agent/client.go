@@ -0,0 +1,424 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"pingdisco.com/pingdisco/internal/hysteresis"
+)
+
+// Client talks to a pingdisco server.
+type Client struct {
+	BaseURL string
+	HTTP    *http.Client
+}
+
+// NewClient returns a client for the server at baseURL.
+func NewClient(baseURL string) *Client {
+	return &Client{
+		BaseURL: strings.TrimSuffix(baseURL, "/"),
+		HTTP:    &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+// Register announces a new agent using the server's join token.
+func (c *Client) Register(ctx context.Context, joinToken string, req RegisterRequest) (RegisterResponse, error) {
+	var resp RegisterResponse
+	err := c.do(ctx, http.MethodPost, registerPath, joinToken, req, &resp)
+	return resp, err
+}
+
+// Heartbeat reports that the agent identified by id is still alive.
+func (c *Client) Heartbeat(ctx context.Context, id, secret string, hb Heartbeat) (HeartbeatResponse, error) {
+	var resp HeartbeatResponse
+	path := strings.Replace(heartbeatPath, "{id}", id, 1)
+	err := c.do(ctx, http.MethodPost, path, secret, hb, &resp)
+	return resp, err
+}
+
+// ListAgents returns all agents known to the server.
+func (c *Client) ListAgents(ctx context.Context, adminToken string) ([]Info, error) {
+	var agents []Info
+	err := c.do(ctx, http.MethodGet, agentsPath, adminToken, nil, &agents)
+	return agents, err
+}
+
+// GetConfig fetches the configuration of an agent, addressed by ID, name or
+// DefaultConfigKey.
+func (c *Client) GetConfig(ctx context.Context, adminToken, agent string) (Config, error) {
+	var cfg Config
+	path := strings.Replace(configPath, "{id}", url.PathEscape(agent), 1)
+	err := c.do(ctx, http.MethodGet, path, adminToken, nil, &cfg)
+	return cfg, err
+}
+
+// PutConfig replaces the configuration of an agent and returns it with its
+// new version.
+func (c *Client) PutConfig(ctx context.Context, adminToken, agent string, cfg Config) (Config, error) {
+	var saved Config
+	path := strings.Replace(configPath, "{id}", url.PathEscape(agent), 1)
+	err := c.do(ctx, http.MethodPut, path, adminToken, cfg, &saved)
+	return saved, err
+}
+
+// StatusError is returned when the server answers with a non-2xx status.
+type StatusError struct {
+	Code    int
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("server returned %d: %s", e.Code, e.Message)
+}
+
+func (c *Client) do(ctx context.Context, method, path, token string, body, out any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return &StatusError{Code: resp.StatusCode, Message: strings.TrimSpace(string(msg))}
+	}
+
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// State is what an agent keeps between restarts: its registration, the last
+// configuration pushed by the server and the progress of inventory syncs.
+type State struct {
+	Server string    `json:"server"`
+	ID     string    `json:"id"`
+	Secret string    `json:"secret"`
+	Config Config    `json:"config"`
+	Sync   syncState `json:"sync"`
+}
+
+// Device is a host found by an agent scan.
+type Device struct {
+	IP       string `json:"ip"`
+	Hostname string `json:"hostname,omitempty"`
+	Online   bool   `json:"online"`
+}
+
+// Agent registers with a server, keeps sending heartbeats and runs the
+// scans the server configured for it.
+type Agent struct {
+	Client    *Client
+	JoinToken string
+	Name      string
+	Version   string
+	// StatePath is where the agent state is persisted.
+	StatePath string
+	// Subnets reports the subnets this agent currently covers.
+	Subnets func() []string
+	// CAFingerprint pins the server CA on first contact over HTTPS, before
+	// the agent has enrolled and saved a copy of it.
+	CAFingerprint string
+	// Scan runs one scan with the given configuration.
+	Scan func(ctx context.Context, cfg Config) ([]Device, error)
+	// Logf receives progress messages.
+	Logf func(format string, args ...any)
+
+	// mu guards state, which the heartbeat and scan loops share.
+	mu       sync.Mutex
+	state    State
+	cert     atomic.Pointer[tls.Certificate]
+	interval time.Duration
+	configCh chan Config
+	// rescan asks the scan loop to scan now; see Rescan.
+	rescanOnce sync.Once
+	rescan     chan struct{}
+
+	// flaps and lastSeen belong to the scan loop.
+	flaps    *hysteresis.Tracker
+	lastSeen map[string]Device
+}
+
+// Run registers the agent if needed and sends heartbeats until ctx is done.
+// Scheduled scans run in the background as configured by the server.
+func (a *Agent) Run(ctx context.Context) error {
+	if err := a.setupTLS(); err != nil {
+		return err
+	}
+	if err := a.ensureRegistered(ctx); err != nil {
+		return err
+	}
+	if err := a.renewCertIfNeeded(ctx); err != nil {
+		return err
+	}
+
+	a.configCh = make(chan Config, 1)
+	a.configCh <- a.state.Config
+	go a.scanLoop(ctx)
+
+	for {
+		a.mu.Lock()
+		err := a.renewCertIfNeeded(ctx)
+		if err == nil {
+			err = a.heartbeat(ctx)
+		}
+		var se *StatusError
+		if errors.As(err, &se) && se.Code == http.StatusUnauthorized {
+			a.logf("server no longer recognises agent %s, re-registering", a.state.ID)
+			a.state.ID, a.state.Secret = "", ""
+			a.state.Sync = syncState{}
+			a.cert.Store(nil)
+			err = a.ensureRegistered(ctx)
+			a.mu.Unlock()
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		a.mu.Unlock()
+		if err != nil {
+			a.logf("heartbeat failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(a.interval):
+		}
+	}
+}
+
+func (a *Agent) ensureRegistered(ctx context.Context) error {
+	if a.interval == 0 {
+		a.interval = DefaultHeartbeatInterval
+	}
+
+	if a.state.ID == "" && a.state.Server == "" {
+		a.loadState()
+	}
+	if a.state.ID != "" && a.state.Server == a.Client.BaseURL {
+		return nil
+	}
+
+	hostname, _ := os.Hostname()
+	name := a.Name
+	if name == "" {
+		name = hostname
+	}
+
+	resp, err := a.Client.Register(ctx, a.JoinToken, RegisterRequest{
+		Name:     name,
+		Hostname: hostname,
+		Version:  a.Version,
+		Subnets:  a.subnets(),
+	})
+	if err != nil {
+		return fmt.Errorf("registering with %s: %w", a.Client.BaseURL, err)
+	}
+
+	a.state.Server = a.Client.BaseURL
+	a.state.ID = resp.ID
+	a.state.Secret = resp.Secret
+	if resp.HeartbeatInterval > 0 {
+		a.interval = resp.HeartbeatInterval
+	}
+	a.logf("registered with %s as agent %s", a.Client.BaseURL, resp.ID)
+
+	return a.saveState()
+}
+
+func (a *Agent) heartbeat(ctx context.Context) error {
+	resp, err := a.Client.Heartbeat(ctx, a.state.ID, a.state.Secret, Heartbeat{
+		Version:       a.Version,
+		Subnets:       a.subnets(),
+		ConfigVersion: a.state.Config.Version,
+	})
+	if err != nil {
+		return err
+	}
+
+	if resp.HeartbeatInterval > 0 {
+		a.interval = resp.HeartbeatInterval
+	}
+	if resp.Config != nil {
+		a.applyConfig(*resp.Config)
+	}
+	return nil
+}
+
+func (a *Agent) applyConfig(cfg Config) {
+	a.logf("received configuration version %d: scan every %s, targets %v", cfg.Version, cfg.ScanInterval, cfg.Targets)
+
+	a.state.Config = cfg
+	if err := a.saveState(); err != nil {
+		a.logf("saving configuration: %v", err)
+	}
+
+	select {
+	case <-a.configCh:
+	default:
+	}
+	a.configCh <- cfg
+}
+
+// Rescan makes the agent run its next scheduled scan now, if it scans the
+// subnets of its own interfaces: after they changed, the scan should not
+// wait for the interval. It does not block.
+func (a *Agent) Rescan() {
+	select {
+	case a.rescanChan() <- struct{}{}:
+	default:
+	}
+}
+
+func (a *Agent) rescanChan() chan struct{} {
+	a.rescanOnce.Do(func() { a.rescan = make(chan struct{}, 1) })
+	return a.rescan
+}
+
+func (a *Agent) scanLoop(ctx context.Context) {
+	var cfg Config
+	var next <-chan time.Time
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case cfg = <-a.configCh:
+			next = nil
+			if cfg.ScanInterval > 0 && a.Scan != nil {
+				next = time.After(0)
+			}
+		case <-a.rescanChan():
+			if next != nil && len(cfg.Targets) == 0 {
+				a.logf("local subnets changed, scanning now")
+				next = time.After(0)
+			}
+		case <-next:
+			devices, err := a.Scan(ctx, cfg)
+			if err != nil {
+				a.logf("scan failed: %v", err)
+			} else {
+				a.logf("scan finished: %d devices online", countOnline(devices))
+				a.mu.Lock()
+				err = a.sync(ctx, a.debounce(devices, cfg.Probe))
+				a.mu.Unlock()
+				if err != nil {
+					a.logf("sync failed, will retry after the next scan: %v", err)
+				}
+			}
+			next = time.After(cfg.ScanInterval)
+		}
+	}
+}
+
+// debounce turns the devices found by one scan into the inventory to sync,
+// keeping devices that missed fewer than DownAfter scans and holding back
+// returning devices until they answered UpAfter scans. It must be called
+// with a.mu held.
+func (a *Agent) debounce(devices []Device, probe ProbeSettings) []Device {
+	if a.flaps == nil {
+		a.flaps = &hysteresis.Tracker{}
+		a.lastSeen = make(map[string]Device)
+		for ip, dev := range a.state.Sync.Synced {
+			a.flaps.Observe(ip, true)
+			a.lastSeen[ip] = dev
+		}
+	}
+	a.flaps.UpAfter, a.flaps.DownAfter = probe.UpAfter, probe.DownAfter
+
+	seen := make(map[string]bool, len(devices))
+	for _, dev := range devices {
+		if dev.Online {
+			seen[dev.IP] = true
+			a.lastSeen[dev.IP] = dev
+		}
+	}
+
+	var inventory []Device
+	for ip := range a.lastSeen {
+		if up, _ := a.flaps.Observe(ip, seen[ip]); up {
+			inventory = append(inventory, a.lastSeen[ip])
+		}
+	}
+
+	return inventory
+}
+
+func countOnline(devices []Device) int {
+	n := 0
+	for _, d := range devices {
+		if d.Online {
+			n++
+		}
+	}
+	return n
+}
+
+func (a *Agent) subnets() []string {
+	if a.Subnets == nil {
+		return nil
+	}
+	return a.Subnets()
+}
+
+func (a *Agent) loadState() {
+	if a.StatePath == "" {
+		return
+	}
+
+	data, err := os.ReadFile(a.StatePath)
+	if err != nil {
+		return
+	}
+	json.Unmarshal(data, &a.state)
+}
+
+func (a *Agent) saveState() error {
+	if a.StatePath == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(a.state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(a.StatePath, data, 0o600)
+}
+
+func (a *Agent) logf(format string, args ...any) {
+	if a.Logf != nil {
+		a.Logf(format, args...)
+	}
+}
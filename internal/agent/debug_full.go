@@ -0,0 +1,75 @@
+//go:build !minimal
+
+package agent
+
+import (
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"time"
+)
+
+// started is when the process started, for the uptime in runtime stats.
+var started = time.Now()
+
+// RuntimeStats is what /debug/runtime reports.
+type RuntimeStats struct {
+	Uptime      string `json:"uptime"`
+	GoVersion   string `json:"go_version"`
+	Goroutines  int    `json:"goroutines"`
+	HeapAlloc   uint64 `json:"heap_alloc_bytes"`
+	HeapInuse   uint64 `json:"heap_inuse_bytes"`
+	HeapObjects uint64 `json:"heap_objects"`
+	Sys         uint64 `json:"sys_bytes"`
+	NumGC       uint32 `json:"gc_cycles"`
+	PauseTotal  string `json:"gc_pause_total"`
+	Agents      int    `json:"agents"`
+	Devices     int    `json:"devices"`
+}
+
+// DebugHandler serves profiles and runtime statistics for bug reports:
+// the pprof endpoints under /debug/pprof/, expvar at /debug/vars and a
+// summary at /debug/runtime. Like the admin API it requires the admin
+// token, and it is meant for a separate listener that is not exposed to
+// agents.
+func (s *Server) DebugHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+	mux.HandleFunc("/debug/runtime", s.handleRuntime)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.checkAdminToken(r) {
+			http.Error(w, "invalid admin token", http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) handleRuntime(w http.ResponseWriter, r *http.Request) {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+
+	stats := RuntimeStats{
+		Uptime:      time.Since(started).Round(time.Second).String(),
+		GoVersion:   runtime.Version(),
+		Goroutines:  runtime.NumGoroutine(),
+		HeapAlloc:   m.HeapAlloc,
+		HeapInuse:   m.HeapInuse,
+		HeapObjects: m.HeapObjects,
+		Sys:         m.Sys,
+		NumGC:       m.NumGC,
+		PauseTotal:  time.Duration(m.PauseTotalNs).String(),
+	}
+	for _, a := range s.Agents() {
+		stats.Agents++
+		stats.Devices += a.Devices
+	}
+	writeJSON(w, stats)
+}
@@ -0,0 +1,488 @@
+package agent
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	caCertFile     = "ca.pem"
+	caKeyFile      = "ca-key.pem"
+	serverCertFile = "server.pem"
+	serverKeyFile  = "server-key.pem"
+	agentCertFile  = "agent.pem"
+	agentKeyFile   = "agent-key.pem"
+	agentCAFile    = "server-ca.pem"
+)
+
+const (
+	caValidity     = 10 * 365 * 24 * time.Hour
+	serverValidity = 365 * 24 * time.Hour
+	agentValidity  = 90 * 24 * time.Hour
+)
+
+// renewBefore is how long before expiry an agent replaces its certificate.
+const renewBefore = 30 * 24 * time.Hour
+
+// EnrollRequest carries a certificate signing request from an agent.
+type EnrollRequest struct {
+	CSR string `json:"csr"`
+}
+
+// EnrollResponse carries the signed agent certificate and the CA that
+// issued it, both PEM encoded.
+type EnrollResponse struct {
+	Certificate string `json:"certificate"`
+	CA          string `json:"ca"`
+}
+
+// InitTLS creates the server CA in dir if it does not exist yet and issues
+// a fresh server certificate for hosts, replacing any previous one. It
+// returns the SHA-256 fingerprint agents use to pin the CA.
+func InitTLS(dir string, hosts []string) (string, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+
+	ca, caKey, err := loadKeyPair(filepath.Join(dir, caCertFile), filepath.Join(dir, caKeyFile))
+	if errors.Is(err, os.ErrNotExist) {
+		ca, caKey, err = createCA(dir)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return "", err
+	}
+
+	tmpl, err := certTemplate("pingdisco server", serverValidity)
+	if err != nil {
+		return "", err
+	}
+	tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else {
+			tmpl.DNSNames = append(tmpl.DNSNames, h)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca, &key.PublicKey, caKey)
+	if err != nil {
+		return "", err
+	}
+
+	// The CA travels in the chain so agents pinning its fingerprint can
+	// verify the server before they have a copy of it.
+	chain := append(encodePEM("CERTIFICATE", der), encodePEM("CERTIFICATE", ca.Raw)...)
+	if err := writeFileAtomic(filepath.Join(dir, serverCertFile), chain, 0o644); err != nil {
+		return "", err
+	}
+	if err := writeKey(filepath.Join(dir, serverKeyFile), key); err != nil {
+		return "", err
+	}
+
+	return Fingerprint(ca), nil
+}
+
+// Fingerprint returns the hex SHA-256 fingerprint of a certificate.
+func Fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// EnableTLS loads the CA and server certificate created by InitTLS from dir
+// and returns the TLS configuration to serve with. From then on agents must
+// present a certificate issued by the CA for their own ID; enrollment is
+// the only agent endpoint reachable with the agent secret alone.
+func (s *Server) EnableTLS(dir string) (*tls.Config, error) {
+	ca, caKey, err := loadKeyPair(filepath.Join(dir, caCertFile), filepath.Join(dir, caKeyFile))
+	if err != nil {
+		return nil, fmt.Errorf("loading CA (run tls-init first?): %w", err)
+	}
+
+	cert, err := tls.LoadX509KeyPair(filepath.Join(dir, serverCertFile), filepath.Join(dir, serverKeyFile))
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+
+	s.mu.Lock()
+	s.ca, s.caKey = ca, caKey
+	s.mu.Unlock()
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientCAs:    pool,
+		ClientAuth:   tls.VerifyClientCertIfGiven,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+func (s *Server) handleEnroll(w http.ResponseWriter, r *http.Request) {
+	var req EnrollRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "malformed enrollment", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	reg, ok := s.authenticateSecret(r)
+	if !ok {
+		http.Error(w, "unknown agent", http.StatusUnauthorized)
+		return
+	}
+	if s.ca == nil {
+		http.Error(w, "server has no TLS configured", http.StatusNotFound)
+		return
+	}
+
+	block, _ := pem.Decode([]byte(req.CSR))
+	if block == nil || block.Type != "CERTIFICATE REQUEST" {
+		http.Error(w, "malformed certificate request", http.StatusBadRequest)
+		return
+	}
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err == nil {
+		err = csr.CheckSignature()
+	}
+	if err != nil {
+		http.Error(w, "invalid certificate request", http.StatusBadRequest)
+		return
+	}
+
+	tmpl, err := certTemplate(reg.ID, agentValidity)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, s.ca, csr.PublicKey, s.caKey)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, EnrollResponse{
+		Certificate: string(encodePEM("CERTIFICATE", der)),
+		CA:          string(encodePEM("CERTIFICATE", s.ca.Raw)),
+	})
+}
+
+// checkClientCert must be called with s.mu held.
+func (s *Server) checkClientCert(r *http.Request, id string) bool {
+	if s.ca == nil {
+		return true
+	}
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return false
+	}
+	return r.TLS.PeerCertificates[0].Subject.CommonName == id
+}
+
+// TrustCA makes the client verify the server against the PEM encoded CA
+// certificate in path instead of the system roots.
+func (c *Client) TrustCA(path string) error {
+	caPEM, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return fmt.Errorf("%s: no PEM certificates found", path)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	c.HTTP.Transport = transport
+
+	return nil
+}
+
+// Enroll sends a certificate signing request for the agent identified by
+// id and secret.
+func (c *Client) Enroll(ctx context.Context, id, secret string, req EnrollRequest) (EnrollResponse, error) {
+	var resp EnrollResponse
+	path := strings.Replace(enrollPath, "{id}", id, 1)
+	err := c.do(ctx, http.MethodPost, path, secret, req, &resp)
+	return resp, err
+}
+
+// Enroll registers the agent if needed and obtains a new client
+// certificate from the server, replacing any existing one. Agents call it
+// on their own when the certificate nears expiry.
+func (a *Agent) Enroll(ctx context.Context) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if err := a.setupTLS(); err != nil {
+		return err
+	}
+	if err := a.ensureRegistered(ctx); err != nil {
+		return err
+	}
+	return a.enroll(ctx)
+}
+
+func (a *Agent) enroll(ctx context.Context) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: a.state.ID},
+	}, key)
+	if err != nil {
+		return err
+	}
+
+	resp, err := a.Client.Enroll(ctx, a.state.ID, a.state.Secret, EnrollRequest{
+		CSR: string(encodePEM("CERTIFICATE REQUEST", csr)),
+	})
+	if err != nil {
+		return fmt.Errorf("enrolling with %s: %w", a.Client.BaseURL, err)
+	}
+
+	dir := a.tlsDir()
+	if err := writeFileAtomic(filepath.Join(dir, agentCertFile), []byte(resp.Certificate), 0o644); err != nil {
+		return err
+	}
+	if err := writeKey(filepath.Join(dir, agentKeyFile), key); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(filepath.Join(dir, agentCAFile), []byte(resp.CA), 0o644); err != nil {
+		return err
+	}
+
+	if err := a.loadClientCert(); err != nil {
+		return err
+	}
+	a.logf("enrolled certificate valid until %s", a.cert.Load().Leaf.NotAfter.Format(time.RFC3339))
+
+	return a.setupTLS()
+}
+
+// renewCertIfNeeded enrolls again when the client certificate is missing
+// or close to expiry. It must be called with a.mu held.
+func (a *Agent) renewCertIfNeeded(ctx context.Context) error {
+	if !strings.HasPrefix(a.Client.BaseURL, "https://") {
+		return nil
+	}
+	if cert := a.cert.Load(); cert != nil && time.Until(cert.Leaf.NotAfter) > renewBefore {
+		return nil
+	}
+	return a.enroll(ctx)
+}
+
+func (a *Agent) tlsDir() string {
+	if a.StatePath == "" {
+		return "."
+	}
+	return filepath.Dir(a.StatePath)
+}
+
+// setupTLS configures the client to trust the server CA, either from the
+// copy saved at enrollment or, the first time, by the pinned fingerprint,
+// and to present the agent certificate when one has been issued.
+func (a *Agent) setupTLS() error {
+	if !strings.HasPrefix(a.Client.BaseURL, "https://") {
+		return nil
+	}
+
+	if a.cert.Load() == nil {
+		if err := a.loadClientCert(); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	cfg := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			if cert := a.cert.Load(); cert != nil {
+				return cert, nil
+			}
+			return &tls.Certificate{}, nil
+		},
+	}
+
+	caPEM, err := os.ReadFile(filepath.Join(a.tlsDir(), agentCAFile))
+	switch {
+	case err == nil:
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return errors.New("saved server CA is not valid PEM")
+		}
+		cfg.RootCAs = pool
+	case errors.Is(err, os.ErrNotExist) && a.CAFingerprint != "":
+		cfg.InsecureSkipVerify = true
+		cfg.VerifyConnection = pinnedVerifier(a.CAFingerprint)
+	case !errors.Is(err, os.ErrNotExist):
+		return err
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = cfg
+	a.Client.HTTP.Transport = transport
+
+	return nil
+}
+
+func (a *Agent) loadClientCert() error {
+	dir := a.tlsDir()
+	cert, err := tls.LoadX509KeyPair(filepath.Join(dir, agentCertFile), filepath.Join(dir, agentKeyFile))
+	if err != nil {
+		return err
+	}
+	cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return err
+	}
+	a.cert.Store(&cert)
+	return nil
+}
+
+// pinnedVerifier accepts a server whose chain includes a CA with the given
+// fingerprint that signed the server certificate.
+func pinnedVerifier(fingerprint string) func(tls.ConnectionState) error {
+	fingerprint = strings.ToLower(strings.ReplaceAll(fingerprint, ":", ""))
+
+	return func(cs tls.ConnectionState) error {
+		if len(cs.PeerCertificates) == 0 {
+			return errors.New("server presented no certificate")
+		}
+
+		for _, cert := range cs.PeerCertificates[1:] {
+			if Fingerprint(cert) != fingerprint {
+				continue
+			}
+
+			pool := x509.NewCertPool()
+			pool.AddCert(cert)
+			_, err := cs.PeerCertificates[0].Verify(x509.VerifyOptions{
+				Roots:     pool,
+				DNSName:   cs.ServerName,
+				KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+			})
+			return err
+		}
+
+		return errors.New("server CA does not match the pinned fingerprint")
+	}
+}
+
+func createCA(dir string) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tmpl, err := certTemplate("pingdisco CA", caValidity)
+	if err != nil {
+		return nil, nil, err
+	}
+	tmpl.IsCA = true
+	tmpl.BasicConstraintsValid = true
+	tmpl.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := writeFileAtomic(filepath.Join(dir, caCertFile), encodePEM("CERTIFICATE", der), 0o644); err != nil {
+		return nil, nil, err
+	}
+	if err := writeKey(filepath.Join(dir, caKeyFile), key); err != nil {
+		return nil, nil, err
+	}
+
+	return cert, key, nil
+}
+
+func certTemplate(cn string, validity time.Duration) (*x509.Certificate, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	return &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(validity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}, nil
+}
+
+func loadKeyPair(certPath, keyPath string) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	certPEM, err := os.ReadFile(certPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyPEM, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	certBlock, _ := pem.Decode(certPEM)
+	keyBlock, _ := pem.Decode(keyPEM)
+	if certBlock == nil || keyBlock == nil {
+		return nil, nil, fmt.Errorf("%s: not a PEM certificate and key", certPath)
+	}
+
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	key, err := x509.ParseECPrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return cert, key, nil
+}
+
+func writeKey(path string, key *ecdsa.PrivateKey) error {
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, encodePEM("EC PRIVATE KEY", der), 0o600)
+}
+
+func encodePEM(typ string, der []byte) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der})
+}
@@ -0,0 +1,137 @@
+// Package agent implements the protocol spoken between remote pingdisco
+// agents and the central server: registration with a join token, periodic
+// heartbeats, and the server-side registry of known agents.
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"pingdisco.com/pingdisco/internal/inventory"
+)
+
+const (
+	registerPath  = "/api/v1/agents/register"
+	agentsPath    = "/api/v1/agents"
+	heartbeatPath = "/api/v1/agents/{id}/heartbeat"
+	configPath    = "/api/v1/agents/{id}/config"
+	syncPath      = "/api/v1/agents/{id}/sync"
+	devicesPath   = "/api/v1/agents/{id}/devices"
+	enrollPath    = "/api/v1/agents/{id}/enroll"
+)
+
+// DefaultConfigKey addresses the configuration used by agents that have no
+// configuration of their own.
+const DefaultConfigKey = "default"
+
+// DefaultHeartbeatInterval is how often agents check in unless the server
+// asks for something else.
+const DefaultHeartbeatInterval = 30 * time.Second
+
+// RegisterRequest is sent by an agent the first time it contacts a server.
+type RegisterRequest struct {
+	Name     string   `json:"name"`
+	Hostname string   `json:"hostname"`
+	Version  string   `json:"version"`
+	Subnets  []string `json:"subnets"`
+}
+
+// RegisterResponse carries the identity the server assigned to an agent.
+// The secret authenticates all further requests from that agent.
+type RegisterResponse struct {
+	ID                string        `json:"id"`
+	Secret            string        `json:"secret"`
+	HeartbeatInterval time.Duration `json:"heartbeat_interval"`
+}
+
+// Heartbeat is sent periodically by a registered agent.
+type Heartbeat struct {
+	Version       string   `json:"version"`
+	Subnets       []string `json:"subnets"`
+	ConfigVersion int64    `json:"config_version"`
+}
+
+// HeartbeatResponse acknowledges a heartbeat. Config is only set when the
+// agent's configuration is out of date.
+type HeartbeatResponse struct {
+	HeartbeatInterval time.Duration `json:"heartbeat_interval"`
+	Config            *Config       `json:"config,omitempty"`
+}
+
+// Info describes a registered agent as seen by the server.
+type Info struct {
+	ID           string    `json:"id"`
+	Name         string    `json:"name"`
+	Hostname     string    `json:"hostname"`
+	Version      string    `json:"version"`
+	Subnets      []string  `json:"subnets"`
+	Address      string    `json:"address"`
+	RegisteredAt time.Time `json:"registered_at"`
+	LastSeen     time.Time `json:"last_seen"`
+	// ConfigVersion is the configuration version the agent last reported.
+	ConfigVersion int64 `json:"config_version"`
+	// Devices is the number of devices in the agent's synced inventory.
+	Devices int `json:"devices"`
+}
+
+// Online reports whether the agent has checked in recently enough to be
+// considered alive, allowing for a couple of missed heartbeats.
+func (i Info) Online(now time.Time, interval time.Duration) bool {
+	return now.Sub(i.LastSeen) <= 3*interval
+}
+
+// ProbeSettings controls how an agent probes each host. DownAfter and
+// UpAfter are the consecutive scans a device must be missing or present
+// before it is removed from or added back to the inventory.
+type ProbeSettings struct {
+	Timeout   time.Duration `json:"timeout"`
+	Count     int           `json:"count"`
+	DownAfter int           `json:"down_after,omitempty"`
+	UpAfter   int           `json:"up_after,omitempty"`
+	// Spread spreads the probes of each scheduled scan evenly across the
+	// scan interval instead of sending them in a burst.
+	Spread bool `json:"spread,omitempty"`
+}
+
+// Config is the scan configuration the server pushes to agents. A zero
+// ScanInterval disables scheduled scans; empty Targets means the subnets of
+// the agent's own interfaces.
+type Config struct {
+	Version      int64         `json:"version"`
+	ScanInterval time.Duration `json:"scan_interval"`
+	Targets      []string      `json:"targets"`
+	Probe        ProbeSettings `json:"probe"`
+	// Devices carries per-device probe overrides.
+	Devices []inventory.Device `json:"devices,omitempty"`
+	// Experiments names the experimental discovery methods to enable.
+	// Agents ignore names they do not know.
+	Experiments []string `json:"experiments,omitempty"`
+}
+
+// Validate checks that the configuration can be applied by an agent.
+func (c Config) Validate() error {
+	if c.ScanInterval < 0 {
+		return errors.New("scan interval must not be negative")
+	}
+	if c.Probe.Timeout < 0 || c.Probe.Count < 0 || c.Probe.DownAfter < 0 || c.Probe.UpAfter < 0 {
+		return errors.New("probe settings must not be negative")
+	}
+	for _, d := range c.Devices {
+		if net.ParseIP(d.IP) == nil {
+			return fmt.Errorf("invalid device address %q", d.IP)
+		}
+		if d.Probe != nil {
+			if err := d.Probe.Validate(); err != nil {
+				return fmt.Errorf("device %s: %w", d.IP, err)
+			}
+		}
+	}
+	for _, target := range c.Targets {
+		if _, _, err := net.ParseCIDR(target); err != nil {
+			return fmt.Errorf("invalid target %q: %w", target, err)
+		}
+	}
+	return nil
+}
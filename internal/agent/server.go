@@ -0,0 +1,424 @@
+package agent
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type registration struct {
+	Info
+	Secret string `json:"secret"`
+}
+
+// Server keeps the registry of agents and serves the agent API.
+type Server struct {
+	joinToken string
+	// adminToken guards the endpoints that read or change the
+	// configuration and inventory of every agent. It differs from the
+	// join token, which every agent holds.
+	adminToken        string
+	statePath         string
+	heartbeatInterval time.Duration
+
+	mu            sync.Mutex
+	agents        map[string]*registration
+	configs       map[string]Config
+	defaultConfig Config
+	inventories   map[string]*siteInventory
+
+	ca    *x509.Certificate
+	caKey *ecdsa.PrivateKey
+}
+
+type serverState struct {
+	Agents        []*registration           `json:"agents"`
+	Configs       map[string]Config         `json:"configs,omitempty"`
+	DefaultConfig Config                    `json:"default_config"`
+	Inventories   map[string]*siteInventory `json:"inventories,omitempty"`
+}
+
+// NewServer creates a server that accepts agents presenting joinToken and
+// administrators presenting adminToken. If statePath is not empty the
+// registry is loaded from and saved to it so agents survive a server
+// restart.
+func NewServer(joinToken, adminToken, statePath string) (*Server, error) {
+	if joinToken == "" {
+		return nil, errors.New("join token must not be empty")
+	}
+	if adminToken == "" {
+		return nil, errors.New("admin token must not be empty")
+	}
+	if adminToken == joinToken {
+		return nil, errors.New("admin token must differ from the join token, which every agent holds")
+	}
+
+	s := &Server{
+		joinToken:         joinToken,
+		adminToken:        adminToken,
+		statePath:         statePath,
+		heartbeatInterval: DefaultHeartbeatInterval,
+		agents:            make(map[string]*registration),
+		configs:           make(map[string]Config),
+		inventories:       make(map[string]*siteInventory),
+	}
+
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Handler returns the HTTP handler for the agent API.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST "+registerPath, s.handleRegister)
+	mux.HandleFunc("POST "+heartbeatPath, s.handleHeartbeat)
+	mux.HandleFunc("GET "+agentsPath, s.handleList)
+	mux.HandleFunc("GET "+configPath, s.handleGetConfig)
+	mux.HandleFunc("PUT "+configPath, s.handlePutConfig)
+	mux.HandleFunc("POST "+syncPath, s.handleSync)
+	mux.HandleFunc("GET "+devicesPath, s.handleDevices)
+	mux.HandleFunc("POST "+enrollPath, s.handleEnroll)
+	mux.HandleFunc("GET "+asymmetryPath, s.handleAsymmetries)
+	return mux
+}
+
+// Agents returns a snapshot of all registered agents sorted by name.
+func (s *Server) Agents() []Info {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	agents := make([]Info, 0, len(s.agents))
+	for _, reg := range s.agents {
+		info := reg.Info
+		if inv := s.inventories[reg.ID]; inv != nil {
+			info.Devices = len(inv.Devices)
+		}
+		agents = append(agents, info)
+	}
+
+	sort.Slice(agents, func(i, j int) bool {
+		if agents[i].Name != agents[j].Name {
+			return agents[i].Name < agents[j].Name
+		}
+		return agents[i].ID < agents[j].ID
+	})
+
+	return agents
+}
+
+func (s *Server) handleRegister(w http.ResponseWriter, r *http.Request) {
+	if !s.checkJoinToken(r) {
+		http.Error(w, "invalid join token", http.StatusUnauthorized)
+		return
+	}
+
+	var req RegisterRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "malformed registration", http.StatusBadRequest)
+		return
+	}
+
+	id, err := randomHex(8)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	secret, err := randomHex(32)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	if req.Name == "" {
+		req.Name = req.Hostname
+	}
+
+	s.mu.Lock()
+	s.agents[id] = &registration{
+		Info: Info{
+			ID:           id,
+			Name:         req.Name,
+			Hostname:     req.Hostname,
+			Version:      req.Version,
+			Subnets:      req.Subnets,
+			Address:      remoteHost(r),
+			RegisteredAt: now,
+			LastSeen:     now,
+		},
+		Secret: secret,
+	}
+	err = s.saveLocked()
+	s.mu.Unlock()
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, RegisterResponse{ID: id, Secret: secret, HeartbeatInterval: s.heartbeatInterval})
+}
+
+func (s *Server) handleHeartbeat(w http.ResponseWriter, r *http.Request) {
+	var hb Heartbeat
+	if err := json.NewDecoder(r.Body).Decode(&hb); err != nil {
+		http.Error(w, "malformed heartbeat", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	reg, ok := s.authenticate(r)
+	if !ok {
+		s.mu.Unlock()
+		http.Error(w, "unknown agent", http.StatusUnauthorized)
+		return
+	}
+
+	reg.Version = hb.Version
+	reg.Subnets = hb.Subnets
+	reg.Address = remoteHost(r)
+	reg.LastSeen = time.Now()
+	reg.ConfigVersion = hb.ConfigVersion
+
+	resp := HeartbeatResponse{HeartbeatInterval: s.heartbeatInterval}
+	if cfg := s.configForLocked(reg.ID); cfg.Version != hb.ConfigVersion {
+		resp.Config = &cfg
+	}
+	s.mu.Unlock()
+
+	writeJSON(w, resp)
+}
+
+func (s *Server) handleGetConfig(w http.ResponseWriter, r *http.Request) {
+	if !s.checkAdminToken(r) {
+		http.Error(w, "invalid admin token", http.StatusUnauthorized)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := r.PathValue("id")
+	if key == DefaultConfigKey {
+		writeJSON(w, s.defaultConfig)
+		return
+	}
+
+	reg, ok := s.lookupLocked(key)
+	if !ok {
+		http.Error(w, "unknown agent", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, s.configForLocked(reg.ID))
+}
+
+func (s *Server) handlePutConfig(w http.ResponseWriter, r *http.Request) {
+	if !s.checkAdminToken(r) {
+		http.Error(w, "invalid admin token", http.StatusUnauthorized)
+		return
+	}
+
+	var cfg Config
+	if err := json.NewDecoder(r.Body).Decode(&cfg); err != nil {
+		http.Error(w, "malformed config", http.StatusBadRequest)
+		return
+	}
+	if err := cfg.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	cfg.Version = time.Now().UnixNano()
+
+	s.mu.Lock()
+	key := r.PathValue("id")
+	if key == DefaultConfigKey {
+		s.defaultConfig = cfg
+	} else {
+		reg, ok := s.lookupLocked(key)
+		if !ok {
+			s.mu.Unlock()
+			http.Error(w, "unknown agent", http.StatusNotFound)
+			return
+		}
+		s.configs[reg.ID] = cfg
+	}
+	err := s.saveLocked()
+	s.mu.Unlock()
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, cfg)
+}
+
+// configForLocked must be called with s.mu held.
+func (s *Server) configForLocked(id string) Config {
+	if cfg, ok := s.configs[id]; ok {
+		return cfg
+	}
+	return s.defaultConfig
+}
+
+// lookupLocked finds an agent by ID or, failing that, by name. It must be
+// called with s.mu held.
+func (s *Server) lookupLocked(key string) (*registration, bool) {
+	if reg, ok := s.agents[key]; ok {
+		return reg, true
+	}
+	for _, reg := range s.agents {
+		if reg.Name == key {
+			return reg, true
+		}
+	}
+	return nil, false
+}
+
+func (s *Server) handleList(w http.ResponseWriter, r *http.Request) {
+	if !s.checkAdminToken(r) {
+		http.Error(w, "invalid admin token", http.StatusUnauthorized)
+		return
+	}
+
+	writeJSON(w, s.Agents())
+}
+
+// authenticate checks the agent secret and, when TLS is enabled, the agent
+// certificate. It must be called with s.mu held.
+func (s *Server) authenticate(r *http.Request) (*registration, bool) {
+	reg, ok := s.authenticateSecret(r)
+	if !ok || !s.checkClientCert(r, reg.ID) {
+		return nil, false
+	}
+	return reg, true
+}
+
+// authenticateSecret must be called with s.mu held.
+func (s *Server) authenticateSecret(r *http.Request) (*registration, bool) {
+	reg, ok := s.agents[r.PathValue("id")]
+	if !ok {
+		return nil, false
+	}
+	if subtle.ConstantTimeCompare([]byte(bearerToken(r)), []byte(reg.Secret)) != 1 {
+		return nil, false
+	}
+	return reg, true
+}
+
+func (s *Server) checkJoinToken(r *http.Request) bool {
+	return subtle.ConstantTimeCompare([]byte(bearerToken(r)), []byte(s.joinToken)) == 1
+}
+
+func (s *Server) checkAdminToken(r *http.Request) bool {
+	return subtle.ConstantTimeCompare([]byte(bearerToken(r)), []byte(s.adminToken)) == 1
+}
+
+func (s *Server) load() error {
+	if s.statePath == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(s.statePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var state serverState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+	for _, reg := range state.Agents {
+		s.agents[reg.ID] = reg
+	}
+	for id, cfg := range state.Configs {
+		s.configs[id] = cfg
+	}
+	s.defaultConfig = state.DefaultConfig
+	for id, inv := range state.Inventories {
+		s.inventories[id] = inv
+	}
+
+	return nil
+}
+
+// saveLocked must be called with s.mu held. Heartbeats only update
+// volatile fields, so the state is written on registration, configuration
+// changes and inventory syncs only.
+func (s *Server) saveLocked() error {
+	if s.statePath == "" {
+		return nil
+	}
+
+	state := serverState{
+		Agents:        make([]*registration, 0, len(s.agents)),
+		Configs:       s.configs,
+		DefaultConfig: s.defaultConfig,
+		Inventories:   s.inventories,
+	}
+	for _, reg := range s.agents {
+		state.Agents = append(state.Agents, reg)
+	}
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(s.statePath, data, 0o600)
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func bearerToken(r *http.Request) string {
+	return strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+}
+
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, perm); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
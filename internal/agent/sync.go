@@ -0,0 +1,238 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Delta is a batch of inventory changes sent from an agent to the server.
+// Seq numbers batches per agent; the server applies a batch only if it
+// follows the last one it applied, and acknowledges a repeated Seq without
+// applying it again, so agents can retry a batch safely. A Full batch
+// replaces the server's inventory for the agent and is used to resync.
+type Delta struct {
+	Seq     int64    `json:"seq"`
+	Full    bool     `json:"full,omitempty"`
+	Upsert  []Device `json:"upsert,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+}
+
+// Empty reports whether the delta carries no changes.
+func (d Delta) Empty() bool {
+	return !d.Full && len(d.Upsert) == 0 && len(d.Removed) == 0
+}
+
+// SyncResponse reports the last batch the server has applied for an agent.
+type SyncResponse struct {
+	Seq int64 `json:"seq"`
+}
+
+// Diff computes the changes that turn the inventory old into current.
+func Diff(old map[string]Device, current []Device) Delta {
+	var d Delta
+	seen := make(map[string]bool, len(current))
+
+	for _, dev := range current {
+		seen[dev.IP] = true
+		if prev, ok := old[dev.IP]; !ok || prev != dev {
+			d.Upsert = append(d.Upsert, dev)
+		}
+	}
+	for ip := range old {
+		if !seen[ip] {
+			d.Removed = append(d.Removed, ip)
+		}
+	}
+	sort.Strings(d.Removed)
+
+	return d
+}
+
+// Apply applies d to the inventory devices.
+func (d Delta) Apply(devices map[string]Device) {
+	if d.Full {
+		clear(devices)
+	}
+	for _, ip := range d.Removed {
+		delete(devices, ip)
+	}
+	for _, dev := range d.Upsert {
+		devices[dev.IP] = dev
+	}
+}
+
+// ErrResyncRequired is returned by Client.Sync when the server cannot apply
+// a delta because it does not follow the last batch it knows about.
+var ErrResyncRequired = errors.New("server requires a full resync")
+
+// Sync sends a batch of inventory changes to the server.
+func (c *Client) Sync(ctx context.Context, id, secret string, d Delta) (SyncResponse, error) {
+	var resp SyncResponse
+	path := strings.Replace(syncPath, "{id}", id, 1)
+	err := c.do(ctx, http.MethodPost, path, secret, d, &resp)
+
+	var se *StatusError
+	if errors.As(err, &se) && se.Code == http.StatusConflict {
+		return resp, ErrResyncRequired
+	}
+	return resp, err
+}
+
+// Devices returns the inventory the server holds for an agent.
+func (c *Client) Devices(ctx context.Context, adminToken, agent string) ([]Device, error) {
+	var devices []Device
+	path := strings.Replace(devicesPath, "{id}", agent, 1)
+	err := c.do(ctx, http.MethodGet, path, adminToken, nil, &devices)
+	return devices, err
+}
+
+type siteInventory struct {
+	Seq       int64             `json:"seq"`
+	Devices   map[string]Device `json:"devices"`
+	UpdatedAt time.Time         `json:"updated_at"`
+}
+
+func (s *Server) handleSync(w http.ResponseWriter, r *http.Request) {
+	var d Delta
+	if err := json.NewDecoder(r.Body).Decode(&d); err != nil {
+		http.Error(w, "malformed delta", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	reg, ok := s.authenticate(r)
+	if !ok {
+		http.Error(w, "unknown agent", http.StatusUnauthorized)
+		return
+	}
+
+	inv := s.inventories[reg.ID]
+	if inv == nil {
+		inv = &siteInventory{Devices: make(map[string]Device)}
+		s.inventories[reg.ID] = inv
+	}
+
+	switch {
+	case d.Seq == inv.Seq && inv.Seq != 0:
+		// A retry of the batch we already applied.
+	case d.Full || d.Seq == inv.Seq+1:
+		d.Apply(inv.Devices)
+		inv.Seq = d.Seq
+		inv.UpdatedAt = time.Now()
+		if err := s.saveLocked(); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(SyncResponse{Seq: inv.Seq})
+		return
+	}
+
+	writeJSON(w, SyncResponse{Seq: inv.Seq})
+}
+
+func (s *Server) handleDevices(w http.ResponseWriter, r *http.Request) {
+	if !s.checkAdminToken(r) {
+		http.Error(w, "invalid admin token", http.StatusUnauthorized)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	reg, ok := s.lookupLocked(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "unknown agent", http.StatusNotFound)
+		return
+	}
+
+	devices := []Device{}
+	if inv := s.inventories[reg.ID]; inv != nil {
+		for _, dev := range inv.Devices {
+			devices = append(devices, dev)
+		}
+	}
+	sort.Slice(devices, func(i, j int) bool { return devices[i].IP < devices[j].IP })
+
+	writeJSON(w, devices)
+}
+
+// syncState is the agent side of the protocol: the inventory as the server
+// last acknowledged it, and the batch in flight if it has not been
+// acknowledged yet.
+type syncState struct {
+	Seq     int64             `json:"seq"`
+	Synced  map[string]Device `json:"synced"`
+	Pending *Delta            `json:"pending,omitempty"`
+}
+
+// sync uploads the changes between the last acknowledged inventory and
+// devices. A batch that could not be delivered is retried verbatim before
+// a new one is computed.
+func (a *Agent) sync(ctx context.Context, devices []Device) error {
+	st := &a.state.Sync
+	if st.Synced == nil {
+		st.Synced = make(map[string]Device)
+	}
+
+	if st.Pending != nil {
+		if err := a.sendPending(ctx); err != nil {
+			return err
+		}
+	}
+
+	d := Diff(st.Synced, devices)
+	if d.Empty() {
+		return nil
+	}
+	d.Seq = st.Seq + 1
+	st.Pending = &d
+	if err := a.saveState(); err != nil {
+		return err
+	}
+
+	return a.sendPending(ctx)
+}
+
+func (a *Agent) sendPending(ctx context.Context) error {
+	st := &a.state.Sync
+
+	_, err := a.Client.Sync(ctx, a.state.ID, a.state.Secret, *st.Pending)
+	if errors.Is(err, ErrResyncRequired) {
+		full := Delta{Seq: st.Seq + 1, Full: true}
+		inv := make(map[string]Device, len(st.Synced))
+		for ip, dev := range st.Synced {
+			inv[ip] = dev
+		}
+		st.Pending.Apply(inv)
+		for _, dev := range inv {
+			full.Upsert = append(full.Upsert, dev)
+		}
+
+		a.logf("server out of sync, sending full inventory of %d devices", len(full.Upsert))
+		st.Pending = &full
+		if err := a.saveState(); err != nil {
+			return err
+		}
+		_, err = a.Client.Sync(ctx, a.state.ID, a.state.Secret, full)
+	}
+	if err != nil {
+		return err
+	}
+
+	st.Pending.Apply(st.Synced)
+	st.Seq = st.Pending.Seq
+	a.logf("synced batch %d: %d changed, %d removed", st.Seq, len(st.Pending.Upsert), len(st.Pending.Removed))
+	st.Pending = nil
+
+	return a.saveState()
+}
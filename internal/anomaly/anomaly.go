@@ -0,0 +1,277 @@
+// Package anomaly flags unusual presence patterns in repeated sweeps of a
+// network: a device online at an hour it normally is not, a burst of MAC
+// addresses never seen before and a device count far from its usual
+// level. It keeps simple per-hour and rolling statistics, so its findings
+// are advisory rather than proof of anything wrong.
+package anomaly
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"pingdisco.com/pingdisco/internal/device"
+)
+
+// Kinds of anomaly.
+const (
+	OddHour    = "odd_hour"
+	NewDevices = "new_devices"
+	CountSpike = "count_spike"
+)
+
+const (
+	// window is the number of recent sweeps the device count and new MAC
+	// baselines are computed over.
+	window = 288
+	// minSamples is the number of sweeps observed before the baselines
+	// are trusted.
+	minSamples = 12
+	// minHourSweeps is the number of sweeps around an hour of the day, and
+	// minDeviceSweeps the number a device must have been seen in, before
+	// the device is judged for being online at that hour.
+	minHourSweeps   = 12
+	minDeviceSweeps = 24
+	// oddRate is the share of sweeps around an hour below which a device
+	// being online then is unusual.
+	oddRate = 0.05
+)
+
+// Anomaly is an unusual observation.
+type Anomaly struct {
+	Kind string
+	// Device is the device concerned, or nil for the network as a whole.
+	Device  *device.Device
+	At      time.Time
+	Message string
+}
+
+// Detector learns what is usual from every sweep it observes. Hours are
+// taken in the location of the times passed to Observe.
+type Detector struct {
+	// Sweeps counts the sweeps observed in each hour of the day, and
+	// Online those that found each device, by device ID.
+	Sweeps [24]int            `json:"sweeps"`
+	Online map[string][24]int `json:"online"`
+	// MACs holds when each MAC address was first seen.
+	MACs map[string]time.Time `json:"macs"`
+	// Counts and NewMACs are the device count and the number of MAC
+	// addresses seen for the first time of recent sweeps, oldest first.
+	Counts  []int `json:"counts"`
+	NewMACs []int `json:"new_macs"`
+
+	path string
+	// alerted holds the hour each device was last reported for being
+	// online at an odd hour, so it is reported once per hour.
+	alerted map[string]time.Time
+	// spiking is the direction of the device count spike reported last,
+	// "" once the count is back to normal, so a lasting change is reported
+	// once.
+	spiking string
+}
+
+// Load reads the detector state saved at path, or returns a new detector
+// if there is none yet.
+func Load(path string) (*Detector, error) {
+	d := &Detector{path: path}
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, d); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	if d.Online == nil {
+		d.Online = make(map[string][24]int)
+	}
+	if d.MACs == nil {
+		d.MACs = make(map[string]time.Time)
+	}
+	d.alerted = make(map[string]time.Time)
+	return d, nil
+}
+
+// Save writes the detector state back to the file it was loaded from.
+func (d *Detector) Save() error {
+	data, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(d.path), 0o755); err != nil {
+		return err
+	}
+	tmp := d.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, d.path)
+}
+
+// Observe judges the devices found by a sweep at at against what was
+// usual so far, then learns from them.
+func (d *Detector) Observe(at time.Time, devices []*device.Device) []Anomaly {
+	var found []Anomaly
+	hour := at.Hour()
+
+	for _, dev := range devices {
+		if a, ok := d.oddHour(at, dev); ok {
+			found = append(found, a)
+		}
+	}
+
+	var fresh []*device.Device
+	baseline := len(d.MACs) == 0
+	for _, dev := range devices {
+		if dev.MAC == nil {
+			continue
+		}
+		if _, ok := d.MACs[dev.MAC.String()]; !ok {
+			d.MACs[dev.MAC.String()] = at
+			fresh = append(fresh, dev)
+		}
+	}
+	if !baseline {
+		if a, ok := d.surge(at, fresh); ok {
+			found = append(found, a)
+		}
+		d.NewMACs = keep(append(d.NewMACs, len(fresh)))
+	}
+
+	if a, ok := d.spike(at, len(devices)); ok {
+		found = append(found, a)
+	}
+	d.Counts = keep(append(d.Counts, len(devices)))
+
+	d.Sweeps[hour]++
+	for _, dev := range devices {
+		seen := d.Online[dev.ID()]
+		seen[hour]++
+		d.Online[dev.ID()] = seen
+	}
+	return found
+}
+
+// oddHour reports dev if it was rarely online around this hour of the day
+// although the hour has been swept often and dev is otherwise a regular.
+func (d *Detector) oddHour(at time.Time, dev *device.Device) (Anomaly, bool) {
+	seen := d.Online[dev.ID()]
+	total := 0
+	for _, n := range seen {
+		total += n
+	}
+	if total < minDeviceSweeps {
+		return Anomaly{}, false
+	}
+
+	sweeps, online := 0, 0
+	for _, h := range []int{at.Hour() + 23, at.Hour(), at.Hour() + 1} {
+		sweeps += d.Sweeps[h%24]
+		online += seen[h%24]
+	}
+	if sweeps < minHourSweeps || float64(online) >= oddRate*float64(sweeps) {
+		return Anomaly{}, false
+	}
+
+	slot := at.Truncate(time.Hour)
+	if d.alerted[dev.ID()].Equal(slot) {
+		return Anomaly{}, false
+	}
+	d.alerted[dev.ID()] = slot
+
+	return Anomaly{
+		Kind:   OddHour,
+		Device: dev,
+		At:     at,
+		Message: fmt.Sprintf("%s is online at %s, when it is usually offline (seen in %d of %d sweeps around this hour)",
+			label(dev), at.Format("15:04"), online, sweeps),
+	}, true
+}
+
+// surge reports a sweep that found clearly more new MAC addresses than
+// usual.
+func (d *Detector) surge(at time.Time, fresh []*device.Device) (Anomaly, bool) {
+	if len(d.NewMACs) < minSamples || len(fresh) < 3 {
+		return Anomaly{}, false
+	}
+	mean, sd := stats(d.NewMACs)
+	if float64(len(fresh)) <= mean+3*sd {
+		return Anomaly{}, false
+	}
+
+	var labels []string
+	for _, dev := range fresh {
+		labels = append(labels, label(dev))
+	}
+	const shown = 5
+	list := strings.Join(labels[:min(len(labels), shown)], ", ")
+	if len(labels) > shown {
+		list += fmt.Sprintf(" and %d more", len(labels)-shown)
+	}
+	return Anomaly{
+		Kind: NewDevices,
+		At:   at,
+		Message: fmt.Sprintf("%d devices never seen before joined at once (usually %.1f per sweep): %s",
+			len(fresh), mean, list),
+	}, true
+}
+
+// spike reports a device count that moved far from the recent average.
+func (d *Detector) spike(at time.Time, count int) (Anomaly, bool) {
+	if len(d.Counts) < minSamples {
+		return Anomaly{}, false
+	}
+	mean, sd := stats(d.Counts)
+	dev := float64(count) - mean
+	if math.Abs(dev) <= max(3*sd, 3, mean/4) {
+		d.spiking = ""
+		return Anomaly{}, false
+	}
+
+	direction := "high"
+	if dev < 0 {
+		direction = "low"
+	}
+	if d.spiking == direction {
+		return Anomaly{}, false
+	}
+	d.spiking = direction
+	return Anomaly{
+		Kind:    CountSpike,
+		At:      at,
+		Message: fmt.Sprintf("%d devices online is unusually %s (usually %.0f±%.0f)", count, direction, mean, sd),
+	}, true
+}
+
+// keep drops all but the last window values.
+func keep(values []int) []int {
+	if len(values) > window {
+		values = append(values[:0], values[len(values)-window:]...)
+	}
+	return values
+}
+
+// stats returns the mean and standard deviation of values.
+func stats(values []int) (mean, sd float64) {
+	for _, v := range values {
+		mean += float64(v)
+	}
+	mean /= float64(len(values))
+	for _, v := range values {
+		sd += (float64(v) - mean) * (float64(v) - mean)
+	}
+	return mean, math.Sqrt(sd / float64(len(values)))
+}
+
+func label(dev *device.Device) string {
+	if name := dev.Hostname(); name != "" {
+		return name + " (" + dev.IP().String() + ")"
+	}
+	return dev.IP().String()
+}
@@ -0,0 +1,156 @@
+// Package ber encodes and decodes the subset of ASN.1 BER that SNMP and
+// LDAP use: definite lengths, single-byte tags, integers and strings.
+package ber
+
+import (
+	"bufio"
+	"errors"
+	"io"
+)
+
+// Universal tags.
+const (
+	TagBoolean     = 0x01
+	TagInteger     = 0x02
+	TagOctetString = 0x04
+	TagNull        = 0x05
+	TagOID         = 0x06
+	TagEnumerated  = 0x0a
+	TagSequence    = 0x30
+	TagSet         = 0x31
+)
+
+// ErrMalformed is returned for an element whose length does not fit the
+// bytes it came with.
+var ErrMalformed = errors.New("ber: malformed element")
+
+// MaxElement bounds the size of an element ReadElement reads, so a broken
+// peer cannot make the reader allocate without limit.
+const MaxElement = 16 << 20
+
+func encodeLength(n int) []byte {
+	if n < 0x80 {
+		return []byte{byte(n)}
+	}
+	var b []byte
+	for ; n > 0; n >>= 8 {
+		b = append([]byte{byte(n)}, b...)
+	}
+	return append([]byte{0x80 | byte(len(b))}, b...)
+}
+
+// TLV returns an element with the given tag whose content is the
+// concatenation of content.
+func TLV(tag byte, content ...[]byte) []byte {
+	n := 0
+	for _, c := range content {
+		n += len(c)
+	}
+	out := append([]byte{tag}, encodeLength(n)...)
+	for _, c := range content {
+		out = append(out, c...)
+	}
+	return out
+}
+
+// Int returns an integer element, such as TagInteger or TagEnumerated, in
+// the fewest bytes that hold n.
+func Int(tag byte, n int64) []byte {
+	var b []byte
+	for {
+		b = append([]byte{byte(n)}, b...)
+		n >>= 8
+		if (n == 0 && b[0]&0x80 == 0) || (n == -1 && b[0]&0x80 != 0) {
+			break
+		}
+	}
+	return TLV(tag, b)
+}
+
+// OctetString returns an octet string element.
+func OctetString(s string) []byte {
+	return TLV(TagOctetString, []byte(s))
+}
+
+// Bool returns a boolean element.
+func Bool(v bool) []byte {
+	if v {
+		return []byte{TagBoolean, 1, 0xff}
+	}
+	return []byte{TagBoolean, 1, 0}
+}
+
+// ParseInt decodes the content of a signed integer element.
+func ParseInt(b []byte) int64 {
+	var n int64
+	if len(b) > 0 && b[0]&0x80 != 0 {
+		n = -1
+	}
+	for _, c := range b {
+		n = n<<8 | int64(c)
+	}
+	return n
+}
+
+// ParseUint decodes the content of an unsigned integer element, such as
+// an SNMP counter.
+func ParseUint(b []byte) uint64 {
+	var n uint64
+	for _, c := range b {
+		n = n<<8 | uint64(c)
+	}
+	return n
+}
+
+// Split splits the element at the start of b into its tag and content and
+// returns the bytes after it.
+func Split(b []byte) (tag byte, content, rest []byte, err error) {
+	if len(b) < 2 {
+		return 0, nil, nil, ErrMalformed
+	}
+	tag = b[0]
+	length := int(b[1])
+	offset := 2
+	if length&0x80 != 0 {
+		n := length & 0x7f
+		if n == 0 || n > 4 || len(b) < 2+n {
+			return 0, nil, nil, ErrMalformed
+		}
+		length = int(ParseUint(b[2 : 2+n]))
+		offset += n
+	}
+	if length < 0 || len(b) < offset+length {
+		return 0, nil, nil, ErrMalformed
+	}
+	return tag, b[offset : offset+length], b[offset+length:], nil
+}
+
+// ReadElement reads one whole element, such as an LDAP message, from r.
+func ReadElement(r *bufio.Reader) ([]byte, error) {
+	head := make([]byte, 2, 6)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return nil, err
+	}
+	length := int(head[1])
+	if length&0x80 != 0 {
+		n := length & 0x7f
+		if n == 0 || n > 4 {
+			return nil, ErrMalformed
+		}
+		ext := make([]byte, n)
+		if _, err := io.ReadFull(r, ext); err != nil {
+			return nil, err
+		}
+		head = append(head, ext...)
+		length = int(ParseUint(ext))
+	}
+	if length > MaxElement {
+		return nil, ErrMalformed
+	}
+	msg := make([]byte, len(head)+length)
+	copy(msg, head)
+	if _, err := io.ReadFull(r, msg[len(head):]); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
@@ -0,0 +1,200 @@
+// Package checks runs simple service checks against discovered hosts: an
+// HTTP request, a TCP connection or a DNS query answered by the host.
+package checks
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Check types.
+const (
+	HTTP = "http"
+	TCP  = "tcp"
+	DNS  = "dns"
+)
+
+// DefaultTimeout bounds a single check.
+const DefaultTimeout = 5 * time.Second
+
+// Check describes one service check.
+type Check struct {
+	Type string `json:"type"`
+	// URL for HTTP checks. A URL starting with "/" is requested from the
+	// host itself; empty means "/".
+	URL string `json:"url,omitempty"`
+	// Port for TCP checks.
+	Port int `json:"port,omitempty"`
+	// Name is the name DNS checks ask the host to resolve.
+	Name string `json:"name,omitempty"`
+	// Expect is the HTTP status code (default 200) or an address the DNS
+	// answer must contain.
+	Expect string `json:"expect,omitempty"`
+}
+
+// Result is the outcome of running a check.
+type Result struct {
+	Check   Check         `json:"check"`
+	OK      bool          `json:"ok"`
+	Detail  string        `json:"detail"`
+	Latency time.Duration `json:"latency"`
+	At      time.Time     `json:"at"`
+}
+
+// Parse reads a check written as TYPE:ARG, e.g. "http:/health",
+// "tcp:22" or "dns:example.com".
+func Parse(s string) (Check, error) {
+	typ, arg, _ := strings.Cut(s, ":")
+
+	var c Check
+	switch typ {
+	case HTTP:
+		c = Check{Type: HTTP, URL: arg}
+	case TCP:
+		port, err := strconv.Atoi(arg)
+		if err != nil {
+			return Check{}, fmt.Errorf("check %q: invalid port", s)
+		}
+		c = Check{Type: TCP, Port: port}
+	case DNS:
+		c = Check{Type: DNS, Name: arg}
+	default:
+		return Check{}, fmt.Errorf("check %q: want http:URL, tcp:PORT or dns:NAME", s)
+	}
+
+	return c, c.Validate()
+}
+
+// Validate checks that the check is complete.
+func (c Check) Validate() error {
+	switch c.Type {
+	case HTTP:
+	case TCP:
+		if c.Port <= 0 || c.Port > 65535 {
+			return fmt.Errorf("tcp check needs a port between 1 and 65535")
+		}
+	case DNS:
+		if c.Name == "" {
+			return fmt.Errorf("dns check needs a name to resolve")
+		}
+	default:
+		return fmt.Errorf("unknown check type %q", c.Type)
+	}
+	return nil
+}
+
+// String describes the check.
+func (c Check) String() string {
+	switch c.Type {
+	case HTTP:
+		if c.URL == "" {
+			return "http:/"
+		}
+		return "http:" + c.URL
+	case TCP:
+		return "tcp:" + strconv.Itoa(c.Port)
+	default:
+		return c.Type + ":" + c.Name
+	}
+}
+
+// Run executes c against host.
+func Run(ctx context.Context, host string, c Check) Result {
+	ctx, cancel := context.WithTimeout(ctx, DefaultTimeout)
+	defer cancel()
+
+	start := time.Now()
+	var detail string
+	var err error
+
+	switch c.Type {
+	case HTTP:
+		detail, err = runHTTP(ctx, host, c)
+	case TCP:
+		detail, err = runTCP(ctx, host, c)
+	case DNS:
+		detail, err = runDNS(ctx, host, c)
+	default:
+		err = fmt.Errorf("unknown check type %q", c.Type)
+	}
+
+	r := Result{Check: c, OK: err == nil, Detail: detail, Latency: time.Since(start), At: start}
+	if err != nil {
+		r.Detail = err.Error()
+	}
+	return r
+}
+
+func runHTTP(ctx context.Context, host string, c Check) (string, error) {
+	url := c.URL
+	if url == "" || strings.HasPrefix(url, "/") {
+		url = "http://" + net.JoinHostPort(host, "80") + url
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+
+	client := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+
+	want := c.Expect
+	if want == "" {
+		want = "200"
+	}
+	if strconv.Itoa(resp.StatusCode) != want {
+		return "", fmt.Errorf("%s returned %s, want %s", url, resp.Status, want)
+	}
+	return fmt.Sprintf("%s returned %s", url, resp.Status), nil
+}
+
+func runTCP(ctx context.Context, host string, c Check) (string, error) {
+	addr := net.JoinHostPort(host, strconv.Itoa(c.Port))
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return "", err
+	}
+	conn.Close()
+
+	return "connected to " + addr, nil
+}
+
+func runDNS(ctx context.Context, host string, c Check) (string, error) {
+	resolver := &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, net.JoinHostPort(host, "53"))
+		},
+	}
+
+	addrs, err := resolver.LookupHost(ctx, c.Name)
+	if err != nil {
+		return "", err
+	}
+
+	if c.Expect != "" {
+		for _, a := range addrs {
+			if a == c.Expect {
+				return fmt.Sprintf("%s resolved to %s", c.Name, a), nil
+			}
+		}
+		return "", fmt.Errorf("%s resolved to %s, want %s", c.Name, strings.Join(addrs, ", "), c.Expect)
+	}
+
+	return fmt.Sprintf("%s resolved to %s", c.Name, strings.Join(addrs, ", ")), nil
+}
@@ -0,0 +1,87 @@
+// Package clipboard copies device details (an address, a MAC, a ready-made
+// ssh command) to the system clipboard for the interactive front ends.
+package clipboard
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"pingdisco.com/pingdisco/internal/device"
+)
+
+// ErrUnavailable is returned when no clipboard tool is installed.
+var ErrUnavailable = errors.New("no clipboard tool found (install wl-clipboard, xclip or xsel)")
+
+// Item is something about a device that can be copied.
+type Item struct {
+	Label string `json:"label"`
+	Text  string `json:"text"`
+}
+
+// Items returns what can be copied for d: its IP address, its MAC address
+// if known and an ssh command, which uses the hostname when there is one.
+func Items(d *device.Device) []Item {
+	items := []Item{{"IP address", d.IP().String()}}
+	if d.MAC != nil {
+		items = append(items, Item{"MAC address", d.MAC.String()})
+	}
+	return append(items, Item{"SSH command", SSHCommand(d)})
+}
+
+// SSHCommand returns an ssh command line for d.
+func SSHCommand(d *device.Device) string {
+	host := d.IP().String()
+	if name := d.Hostname(); name != "" && isPlainHostname(name) {
+		host = name
+	}
+	return "ssh " + host
+}
+
+// isPlainHostname reports whether name can be pasted into a shell as is.
+// Names come from the network and are not trusted.
+func isPlainHostname(name string) bool {
+	if net.ParseIP(name) != nil {
+		return true
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '.') {
+			return false
+		}
+	}
+	return !strings.HasPrefix(name, "-")
+}
+
+// Write puts text on the system clipboard using the platform's tool:
+// clip on Windows, pbcopy on macOS, and wl-copy, xclip or xsel elsewhere.
+func Write(text string) error {
+	var tools [][]string
+	switch runtime.GOOS {
+	case "windows":
+		tools = [][]string{{"clip"}}
+	case "darwin":
+		tools = [][]string{{"pbcopy"}}
+	default:
+		if os.Getenv("WAYLAND_DISPLAY") != "" {
+			tools = append(tools, []string{"wl-copy"})
+		}
+		tools = append(tools, []string{"xclip", "-selection", "clipboard"}, []string{"xsel", "--clipboard", "--input"})
+	}
+
+	for _, t := range tools {
+		if _, err := exec.LookPath(t[0]); err != nil {
+			continue
+		}
+		cmd := exec.Command(t[0], t[1:]...)
+		cmd.Stdin = strings.NewReader(text)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("%s: %v: %s", t[0], err, strings.TrimSpace(string(out)))
+		}
+		return nil
+	}
+	return ErrUnavailable
+}
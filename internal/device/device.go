@@ -0,0 +1,399 @@
+// Package device is the model of a discovered device shared by the scanner,
+// its enrichers and the exporters. Core identity (addresses, MAC, names)
+// has typed fields; everything else an enricher learns goes into
+// Attributes, so new data can be added without changing the model or
+// breaking exporters that do not know about it.
+package device
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SchemaVersion is the version of the JSON form written by MarshalJSON.
+// Readers accept any version up to this one.
+const SchemaVersion = 1
+
+// Attribute keys set by the scanner and its enrichers. Keys are namespaced
+// by the enricher that sets them.
+const (
+	AttrExpectedHostname = "inventory.expected_hostname"
+	AttrEchoSent         = "echo.sent"
+	AttrEchoReceived     = "echo.received"
+	AttrEchoDuplicates   = "echo.duplicates"
+	AttrEchoLate         = "echo.late"
+	AttrSharedMAC        = "arp.shared_mac"
+	// AttrRTT is the round-trip time of the probe that found the device,
+	// as a Go duration.
+	AttrRTT = "probe.rtt"
+	// AttrRTT6 is the round-trip time of the IPv6 probe that found a
+	// device discovered over IPv4 first, as a Go duration. It is unset if
+	// the IPv6 address did not answer a ping.
+	AttrRTT6 = "probe.rtt6"
+	// AttrLatencySent is the number of echo requests timed after the
+	// device was found, AttrLatencyLoss the percentage left unanswered.
+	// The round-trip times and jitter are Go durations.
+	AttrLatencySent   = "latency.sent"
+	AttrLatencyLoss   = "latency.loss_pct"
+	AttrLatencyMin    = "latency.rtt_min"
+	AttrLatencyAvg    = "latency.rtt_avg"
+	AttrLatencyMax    = "latency.rtt_max"
+	AttrLatencyJitter = "latency.jitter"
+	// AttrOpenPorts lists the TCP ports that accepted a connection, comma
+	// separated in ascending order.
+	AttrOpenPorts = "tcp.open_ports"
+	// UPnP attributes are what a device announced about itself over SSDP
+	// and in its device description.
+	AttrUPnPServer       = "upnp.server"
+	AttrUPnPName         = "upnp.friendly_name"
+	AttrUPnPManufacturer = "upnp.manufacturer"
+	AttrUPnPModel        = "upnp.model"
+	AttrUPnPDeviceType   = "upnp.device_type"
+	// SNMP attributes are what a device's SNMP agent said about it.
+	AttrSNMPName       = "snmp.sys_name"
+	AttrSNMPDescr      = "snmp.sys_descr"
+	AttrSNMPLocation   = "snmp.sys_location"
+	AttrSNMPObjectID   = "snmp.sys_object_id"
+	AttrSNMPInterfaces = "snmp.interfaces"
+	// AttrQuality is the A to F grade of the device's connection, from
+	// its packet loss, round-trip time and jitter.
+	AttrQuality = "quality.grade"
+	// AttrOverlayNetwork names the Tailscale tailnet or ZeroTier network
+	// of a peer, AttrOverlayNode and AttrOverlayVersion the ZeroTier node
+	// ID and client version of a member.
+	AttrOverlayNetwork = "overlay.network"
+	AttrOverlayNode    = "overlay.node"
+	AttrOverlayVersion = "overlay.version"
+	// AttrAuditSignals lists the independent signals that showed the
+	// device alive in an audit, e.g. "icmp,arp"; a single one may be a
+	// middlebox answering on its behalf.
+	AttrAuditSignals = "audit.signals"
+	// AttrTopologyHops is the number of routers between this host and the
+	// device, 0 if it is directly attached; AttrTopologyGateway is the last
+	// of them that answered the trace, and AttrTopologyPath lists them all,
+	// nearest first, e.g. "10.0.0.1,*,10.8.0.1", with "*" for silent hops.
+	AttrTopologyHops    = "topology.hops"
+	AttrTopologyGateway = "topology.gateway"
+	AttrTopologyPath    = "topology.path"
+)
+
+// Sources of device data.
+const (
+	SourcePing = "ping"
+	SourceTCP  = "tcp"
+	SourceRDNS = "rdns"
+	SourceARP  = "arp"
+	SourceNDP  = "ndp"
+	SourceSNMP = "snmp"
+	// SourceMDNS and SourceLLMNR mark names the device gave itself over
+	// multicast DNS and LLMNR.
+	SourceMDNS  = "mdns"
+	SourceLLMNR = "llmnr"
+	// SourceSSDP marks devices that answered an SSDP search and what their
+	// UPnP description says.
+	SourceSSDP = "ssdp"
+	// SourceOUI marks vendors looked up from the MAC address prefix.
+	SourceOUI = "oui"
+	// SourceTailscale and SourceZeroTier mark what the local overlay VPN
+	// clients know about their peers.
+	SourceTailscale = "tailscale"
+	SourceZeroTier  = "zerotier"
+	// SourceInventory marks names given by the user in the inventory.
+	SourceInventory = "inventory"
+	// SourceNamePattern marks guesses from the default hostnames devices
+	// give themselves.
+	SourceNamePattern = "name-pattern"
+)
+
+// Name is a name of the device and where it came from.
+type Name struct {
+	Name   string `json:"name"`
+	Source string `json:"source"`
+}
+
+// Device is a device found on the network.
+type Device struct {
+	// Addresses holds the device's IP addresses, the one it was discovered
+	// at first.
+	Addresses []net.IP
+	MAC       net.HardwareAddr
+	Names     []Name
+	// Attributes holds enrichment data keyed by Attr* constants or other
+	// namespaced keys.
+	Attributes map[string]string
+	// Sources lists the probes and lookups that contributed to the device.
+	Sources   []string
+	Online    bool
+	FirstSeen time.Time
+	LastSeen  time.Time
+}
+
+// New returns an online device discovered at ip by source.
+func New(ip net.IP, source string, now time.Time) *Device {
+	d := &Device{
+		Addresses: []net.IP{append(net.IP(nil), ip...)},
+		Online:    true,
+		FirstSeen: now,
+		LastSeen:  now,
+	}
+	d.AddSource(source)
+	return d
+}
+
+// ID identifies the device: its MAC address when known, its first IP
+// address otherwise.
+func (d *Device) ID() string {
+	if d.MAC != nil {
+		return d.MAC.String()
+	}
+	return d.IP().String()
+}
+
+// IP returns the address the device was discovered at.
+func (d *Device) IP() net.IP {
+	if len(d.Addresses) == 0 {
+		return nil
+	}
+	return d.Addresses[0]
+}
+
+// IPv6 returns the first IPv6 address of the device, or nil.
+func (d *Device) IPv6() net.IP {
+	for _, ip := range d.Addresses {
+		if ip.To4() == nil {
+			return ip
+		}
+	}
+	return nil
+}
+
+// DualStack reports whether the device was found at both an IPv4 and an
+// IPv6 address.
+func (d *Device) DualStack() bool {
+	return d.IP().To4() != nil && d.IPv6() != nil
+}
+
+// Hostname returns the first name of the device, or "".
+func (d *Device) Hostname() string {
+	if len(d.Names) == 0 {
+		return ""
+	}
+	return d.Names[0].Name
+}
+
+// Matches reports whether key is the MAC address of d, one of its IP
+// addresses or one of its names.
+func (d *Device) Matches(key string) bool {
+	if d.MAC != nil && strings.EqualFold(d.MAC.String(), key) {
+		return true
+	}
+	for _, ip := range d.Addresses {
+		if ip.String() == key {
+			return true
+		}
+	}
+	for _, n := range d.Names {
+		if strings.EqualFold(n.Name, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// NetworkName returns the name the network knows the device by: its
+// reverse DNS name, or else the name it answered over mDNS or LLMNR.
+func (d *Device) NetworkName() string {
+	for _, source := range []string{SourceRDNS, SourceMDNS, SourceLLMNR} {
+		if name := d.NameFrom(source); name != "" {
+			return name
+		}
+	}
+	return ""
+}
+
+// NameFrom returns the first name learnt from source, or "".
+func (d *Device) NameFrom(source string) string {
+	for _, n := range d.Names {
+		if n.Source == source {
+			return n.Name
+		}
+	}
+	return ""
+}
+
+// AddName records a name learnt from source, ignoring empty and repeated
+// names.
+func (d *Device) AddName(name, source string) {
+	if name == "" {
+		return
+	}
+	for _, n := range d.Names {
+		if n.Name == name {
+			return
+		}
+	}
+	d.Names = append(d.Names, Name{Name: name, Source: source})
+	d.AddSource(source)
+}
+
+// AddSource records that source contributed to the device.
+func (d *Device) AddSource(source string) {
+	for _, s := range d.Sources {
+		if s == source {
+			return
+		}
+	}
+	d.Sources = append(d.Sources, source)
+}
+
+// Merge folds other, found to be the same device, into d: its addresses,
+// names and sources, and the attributes d does not have yet.
+func (d *Device) Merge(other *Device) {
+	for _, ip := range other.Addresses {
+		known := false
+		for _, have := range d.Addresses {
+			known = known || have.Equal(ip)
+		}
+		if !known {
+			d.Addresses = append(d.Addresses, ip)
+		}
+	}
+	for _, n := range other.Names {
+		d.AddName(n.Name, n.Source)
+	}
+	for _, s := range other.Sources {
+		d.AddSource(s)
+	}
+	for k, v := range other.Attributes {
+		if d.Get(k) == "" {
+			d.Set(k, v)
+		}
+	}
+	if d.MAC == nil {
+		d.MAC = other.MAC
+	}
+	if other.FirstSeen.Before(d.FirstSeen) {
+		d.FirstSeen = other.FirstSeen
+	}
+	if other.LastSeen.After(d.LastSeen) {
+		d.LastSeen = other.LastSeen
+	}
+	d.Online = d.Online || other.Online
+}
+
+// Set sets an attribute; an empty value removes it.
+func (d *Device) Set(key, value string) {
+	if value == "" {
+		delete(d.Attributes, key)
+		return
+	}
+	if d.Attributes == nil {
+		d.Attributes = make(map[string]string)
+	}
+	d.Attributes[key] = value
+}
+
+// Get returns an attribute, or "" if it is not set.
+func (d *Device) Get(key string) string {
+	return d.Attributes[key]
+}
+
+// SetInt sets a numeric attribute.
+func (d *Device) SetInt(key string, v int) {
+	d.Set(key, strconv.Itoa(v))
+}
+
+// Int returns a numeric attribute, or 0 if it is not set.
+func (d *Device) Int(key string) int {
+	v, _ := strconv.Atoi(d.Attributes[key])
+	return v
+}
+
+// Keys returns the attribute keys in order.
+func (d *Device) Keys() []string {
+	keys := make([]string, 0, len(d.Attributes))
+	for k := range d.Attributes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+type jsonDevice struct {
+	SchemaVersion int               `json:"schema_version"`
+	ID            string            `json:"id"`
+	Addresses     []string          `json:"addresses"`
+	MAC           string            `json:"mac,omitempty"`
+	Names         []Name            `json:"names,omitempty"`
+	Attributes    map[string]string `json:"attributes,omitempty"`
+	Sources       []string          `json:"sources,omitempty"`
+	Online        bool              `json:"online"`
+	FirstSeen     time.Time         `json:"first_seen"`
+	LastSeen      time.Time         `json:"last_seen"`
+}
+
+// MarshalJSON implements json.Marshaler.
+func (d *Device) MarshalJSON() ([]byte, error) {
+	j := jsonDevice{
+		SchemaVersion: SchemaVersion,
+		ID:            d.ID(),
+		Names:         d.Names,
+		Attributes:    d.Attributes,
+		Sources:       d.Sources,
+		Online:        d.Online,
+		FirstSeen:     d.FirstSeen,
+		LastSeen:      d.LastSeen,
+	}
+	for _, ip := range d.Addresses {
+		j.Addresses = append(j.Addresses, ip.String())
+	}
+	if d.MAC != nil {
+		j.MAC = d.MAC.String()
+	}
+	return json.Marshal(j)
+}
+
+// UnmarshalJSON implements json.Unmarshaler. Attributes are kept whether
+// or not this version knows them; unknown top-level fields are ignored.
+func (d *Device) UnmarshalJSON(data []byte) error {
+	var j jsonDevice
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+	if j.SchemaVersion > SchemaVersion {
+		return fmt.Errorf("device schema version %d is newer than supported version %d", j.SchemaVersion, SchemaVersion)
+	}
+
+	*d = Device{
+		Names:      j.Names,
+		Attributes: j.Attributes,
+		Sources:    j.Sources,
+		Online:     j.Online,
+		FirstSeen:  j.FirstSeen,
+		LastSeen:   j.LastSeen,
+	}
+	for _, s := range j.Addresses {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return fmt.Errorf("invalid device address %q", s)
+		}
+		if v4 := ip.To4(); v4 != nil {
+			ip = v4
+		}
+		d.Addresses = append(d.Addresses, ip)
+	}
+	if j.MAC != "" {
+		mac, err := net.ParseMAC(j.MAC)
+		if err != nil {
+			return err
+		}
+		d.MAC = mac
+	}
+
+	return nil
+}
@@ -0,0 +1,128 @@
+package device
+
+import "strings"
+
+// Identification fields: what a device is, as far as can be told.
+const (
+	FieldHostname = "hostname"
+	FieldVendor   = "vendor"
+	FieldOS       = "os"
+	FieldType     = "type"
+)
+
+// Fields lists the identification fields in display order.
+var Fields = []string{FieldHostname, FieldVendor, FieldOS, FieldType}
+
+// Confidence is how far an identification can be trusted.
+type Confidence int
+
+const (
+	Unknown Confidence = iota
+	// Low is for heuristics such as naming patterns or TTLs.
+	Low
+	// Medium is for data recorded about the device elsewhere, such as
+	// reverse DNS.
+	Medium
+	// High is for data given by the user or announced by the device
+	// itself, such as over SNMP or mDNS.
+	High
+)
+
+var confidenceNames = []string{"unknown", "low", "medium", "high"}
+
+func (c Confidence) String() string {
+	if c < 0 || int(c) >= len(confidenceNames) {
+		return confidenceNames[Unknown]
+	}
+	return confidenceNames[c]
+}
+
+// ParseConfidence is the inverse of Confidence.String; anything else is
+// Unknown.
+func ParseConfidence(s string) Confidence {
+	for i, name := range confidenceNames {
+		if name == s {
+			return Confidence(i)
+		}
+	}
+	return Unknown
+}
+
+// SourceConfidence is the confidence of data learnt from source.
+func SourceConfidence(source string) Confidence {
+	switch source {
+	case SourceInventory, SourceSNMP, SourceSSDP, SourceTailscale:
+		return High
+	case SourceRDNS, SourceOUI:
+		return Medium
+	default:
+		return Low
+	}
+}
+
+// Guess is the value of an identification field and where it came from.
+type Guess struct {
+	Field      string
+	Value      string
+	Source     string
+	Confidence Confidence
+}
+
+func identKey(field string) string { return "ident." + field }
+
+// Identify records value for an identification field, learnt from source
+// with the given confidence. A value already recorded with higher or equal
+// confidence is kept. The hostname is identified by AddName instead.
+func (d *Device) Identify(field, value, source string, c Confidence) {
+	if value == "" || field == FieldHostname {
+		return
+	}
+	if d.Identification(field).Confidence >= c {
+		return
+	}
+	key := identKey(field)
+	d.Set(key, value)
+	d.Set(key+".source", source)
+	d.Set(key+".confidence", c.String())
+	d.AddSource(source)
+}
+
+// Identification returns the value of an identification field and its
+// provenance; the Value is empty when nothing is known. The hostname is
+// the first name of the device.
+func (d *Device) Identification(field string) Guess {
+	g := Guess{Field: field}
+	if field == FieldHostname {
+		if len(d.Names) > 0 {
+			g.Value, g.Source = d.Names[0].Name, d.Names[0].Source
+			g.Confidence = SourceConfidence(g.Source)
+		}
+		return g
+	}
+
+	key := identKey(field)
+	g.Value = d.Get(key)
+	if g.Value != "" {
+		g.Source = d.Get(key + ".source")
+		g.Confidence = ParseConfidence(d.Get(key + ".confidence"))
+	}
+	return g
+}
+
+// Identifications returns the known identification fields in order.
+func (d *Device) Identifications() []Guess {
+	var guesses []Guess
+	for _, field := range Fields {
+		if g := d.Identification(field); g.Value != "" {
+			guesses = append(guesses, g)
+		}
+	}
+	return guesses
+}
+
+// IsIdentKey reports whether an attribute key belongs to an identification
+// field, so detail views can show it with the field rather than as a raw
+// attribute.
+func IsIdentKey(key string) bool {
+	return strings.HasPrefix(key, "ident.")
+}
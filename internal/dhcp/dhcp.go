@@ -0,0 +1,258 @@
+// Package dhcp reads the static reservations of a DHCP server and compares
+// them with the devices found by a scan.
+package dhcp
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"pingdisco.com/pingdisco/internal/device"
+)
+
+// Reservation ties a MAC address to a fixed IP address.
+type Reservation struct {
+	MAC  net.HardwareAddr
+	IP   net.IP
+	Name string
+}
+
+func (r Reservation) String() string {
+	s := r.IP.String() + " for " + r.MAC.String()
+	if r.Name != "" {
+		s += " (" + r.Name + ")"
+	}
+	return s
+}
+
+// Load reads reservations from a file; see Parse for the formats.
+func Load(path string) ([]Reservation, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	res, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return res, nil
+}
+
+var (
+	dhcpdHost = regexp.MustCompile(`(?s)host\s+("[^"]*"|\S+)\s*\{(.*?)\}`)
+	dhcpdMAC  = regexp.MustCompile(`hardware\s+ethernet\s+([0-9A-Fa-f:]+)`)
+	dhcpdIP   = regexp.MustCompile(`fixed-address\s+([0-9.]+)`)
+	leaseTime = regexp.MustCompile(`^([0-9]+[smhdw]?|infinite)$`)
+)
+
+// Parse reads reservations in the format of ISC dhcpd (host blocks with
+// hardware ethernet and fixed-address), OpenWrt (config host sections in
+// /etc/config/dhcp) or any line-based list with a MAC and an IP address
+// per line: dnsmasq dhcp-host lines, /etc/ethers and CSV exports of router
+// web interfaces. In line-based lists the first other word is taken as the
+// name, and lines without both addresses, such as headers, are ignored.
+func Parse(data []byte) ([]Reservation, error) {
+	var res []Reservation
+	switch {
+	case dhcpdHost.Match(data):
+		res = parseDhcpd(data)
+	case bytes.Contains(data, []byte("config host")):
+		res = parseUCI(data)
+	default:
+		res = parseLines(data)
+	}
+	if len(res) == 0 {
+		return nil, fmt.Errorf("no reservations found")
+	}
+	return res, nil
+}
+
+func parseDhcpd(data []byte) []Reservation {
+	var res []Reservation
+	for _, m := range dhcpdHost.FindAllSubmatch(data, -1) {
+		macm, ipm := dhcpdMAC.FindSubmatch(m[2]), dhcpdIP.FindSubmatch(m[2])
+		if macm == nil || ipm == nil {
+			continue
+		}
+		mac, err := net.ParseMAC(string(macm[1]))
+		ip := net.ParseIP(string(ipm[1]))
+		if err != nil || ip == nil {
+			continue
+		}
+		res = append(res, Reservation{MAC: mac, IP: ip, Name: strings.Trim(string(m[1]), `"`)})
+	}
+	return res
+}
+
+func parseUCI(data []byte) []Reservation {
+	var res []Reservation
+	var cur *Reservation
+	var macs []net.HardwareAddr
+	flush := func() {
+		if cur != nil && cur.IP != nil {
+			for _, mac := range macs {
+				r := *cur
+				r.MAC = mac
+				res = append(res, r)
+			}
+		}
+		cur, macs = nil, nil
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if fields[0] == "config" {
+			flush()
+			if len(fields) > 1 && fields[1] == "host" {
+				cur = &Reservation{}
+			}
+			continue
+		}
+		if cur == nil || len(fields) < 3 || (fields[0] != "option" && fields[0] != "list") {
+			continue
+		}
+
+		value := strings.Trim(strings.Join(fields[2:], " "), `'"`)
+		switch fields[1] {
+		case "mac":
+			for _, s := range strings.Fields(value) {
+				if mac, err := net.ParseMAC(s); err == nil {
+					macs = append(macs, mac)
+				}
+			}
+		case "ip":
+			cur.IP = net.ParseIP(value)
+		case "name":
+			cur.Name = value
+		}
+	}
+	flush()
+	return res
+}
+
+func parseLines(data []byte) []Reservation {
+	var res []Reservation
+	for _, line := range strings.Split(string(data), "\n") {
+		line, _, _ = strings.Cut(line, "#")
+		line = strings.TrimPrefix(strings.TrimSpace(line), "dhcp-host=")
+
+		var r Reservation
+		for _, f := range strings.FieldsFunc(line, func(c rune) bool {
+			return c == ',' || c == ';' || c == ' ' || c == '\t'
+		}) {
+			f = strings.Trim(f, `"'`)
+			if mac, err := net.ParseMAC(f); err == nil && r.MAC == nil {
+				r.MAC = mac
+			} else if ip := net.ParseIP(f); ip != nil && r.IP == nil {
+				r.IP = ip
+			} else if r.Name == "" && f != "" && !strings.Contains(f, ":") && !leaseTime.MatchString(f) {
+				r.Name = f
+			}
+		}
+		if r.MAC != nil && r.IP != nil {
+			res = append(res, r)
+		}
+	}
+	return res
+}
+
+// Mismatch is a device whose address or MAC disagrees with a reservation.
+type Mismatch struct {
+	Reservation Reservation
+	Device      *device.Device
+}
+
+// Report is the outcome of comparing reservations with a scan.
+type Report struct {
+	// Unreserved devices answered but have no reservation.
+	Unreserved []*device.Device
+	// Unused reservations have no device online.
+	Unused []Reservation
+	// Moved devices have a reservation but answered at another address.
+	Moved []Mismatch
+	// Conflicts are reserved addresses answered by another MAC.
+	Conflicts []Mismatch
+}
+
+// Compare matches reservations against devices. Devices are matched by
+// MAC where known and by address otherwise; only reservations inside one
+// of subnets are expected to be seen, or all of them if subnets is empty.
+func Compare(res []Reservation, devices []*device.Device, subnets []*net.IPNet) *Report {
+	byMAC := make(map[string]Reservation)
+	// OpenWrt can reserve one address for several MACs.
+	byIP := make(map[string][]Reservation)
+	for _, r := range res {
+		byMAC[r.MAC.String()] = r
+		byIP[r.IP.String()] = append(byIP[r.IP.String()], r)
+	}
+
+	report := &Report{}
+	seen := make(map[string]bool)
+	for _, d := range devices {
+		ip := d.IP().String()
+		if d.MAC == nil {
+			if _, ok := byIP[ip]; ok {
+				seen[ip] = true
+			} else {
+				report.Unreserved = append(report.Unreserved, d)
+			}
+			continue
+		}
+
+		reserved := byIP[ip]
+		taken := len(reserved) > 0
+		if taken && !reservedFor(reserved, d.MAC) {
+			seen[ip] = true
+			report.Conflicts = append(report.Conflicts, Mismatch{reserved[0], d})
+		}
+
+		r, ok := byMAC[d.MAC.String()]
+		switch {
+		case ok && r.IP.Equal(d.IP()):
+			seen[ip] = true
+		case ok:
+			seen[r.IP.String()] = true
+			report.Moved = append(report.Moved, Mismatch{r, d})
+		case !taken:
+			report.Unreserved = append(report.Unreserved, d)
+		}
+	}
+
+	for _, r := range res {
+		if !seen[r.IP.String()] && covered(r.IP, subnets) {
+			report.Unused = append(report.Unused, r)
+		}
+	}
+	sort.Slice(report.Unused, func(i, j int) bool {
+		return bytes.Compare(report.Unused[i].IP.To16(), report.Unused[j].IP.To16()) < 0
+	})
+	return report
+}
+
+func reservedFor(res []Reservation, mac net.HardwareAddr) bool {
+	for _, r := range res {
+		if bytes.Equal(r.MAC, mac) {
+			return true
+		}
+	}
+	return false
+}
+
+func covered(ip net.IP, subnets []*net.IPNet) bool {
+	if len(subnets) == 0 {
+		return true
+	}
+	for _, n := range subnets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
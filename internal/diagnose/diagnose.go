@@ -0,0 +1,188 @@
+// Package diagnose guesses why a device that was online stopped answering.
+// A few quick checks tell the usual causes apart: whether the device still
+// answers on a TCP port or holds its address at the link layer, whether
+// its MAC address turned up at another address, and whether the network
+// in between is reachable at all. The answer is a hint for the alert, not
+// a verdict.
+package diagnose
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"pingdisco.com/pingdisco/internal/netinfo"
+	"pingdisco.com/pingdisco/internal/netops"
+	"pingdisco.com/pingdisco/internal/portscan"
+)
+
+// Causes a Hint can name.
+const (
+	// Filtered: the device answers on a port but not to ping.
+	Filtered = "ignoring ping"
+	// Asleep: the device still answers ARP for its address.
+	Asleep = "host asleep"
+	// Replaced: another device answers ARP for the address.
+	Replaced = "address taken"
+	// Moved: the device's MAC address answers at another address.
+	Moved = "IP changed"
+	// Unreachable: the gateway towards the device does not answer either.
+	Unreachable = "subnet unreachable"
+	// Off: nothing answers for the address on its own link.
+	Off = "host off or disconnected"
+	// Unknown: the device is behind a router that answers, which is as
+	// far as the checks see.
+	Unknown = "unknown"
+)
+
+// DefaultTimeout bounds each check.
+const DefaultTimeout = time.Second
+
+// Target is a device that stopped answering.
+type Target struct {
+	IP net.IP
+	// MAC is the device's address when it was last online, or nil.
+	MAC net.HardwareAddr
+	// Ports are TCP ports worth trying, such as the one its inventory
+	// entry probes or those found open before.
+	Ports []int
+}
+
+// Hint is the probable cause of a device going offline.
+type Hint struct {
+	Cause string
+	// Detail backs the cause up, e.g. "now at 192.168.1.61".
+	Detail string
+}
+
+func (h Hint) String() string {
+	if h.Detail == "" {
+		return h.Cause
+	}
+	return h.Cause + ": " + h.Detail
+}
+
+// Checker runs the checks.
+type Checker struct {
+	Ops *netops.Ops
+	// Timeout bounds each check; zero means DefaultTimeout.
+	Timeout time.Duration
+}
+
+// Diagnose checks why t stopped answering. The checks take about one
+// Timeout, as those that can run at once do.
+func (c Checker) Diagnose(ctx context.Context, t Target) Hint {
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	ip := t.IP.To4()
+	if ip == nil {
+		ip = t.IP
+	}
+	iface, _ := netops.AttachedInterface(&net.IPNet{IP: ip, Mask: net.CIDRMask(8*len(ip), 8*len(ip))})
+	gateway := gatewayTowards(ip, iface)
+
+	var open []int
+	gatewayUp := false
+	var wg sync.WaitGroup
+	if len(t.Ports) > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			open = portscan.Scan(ctx, ip.String(), t.Ports, timeout)
+		}()
+	}
+	if gateway != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			gatewayUp = c.Ops.Pinger.Ping(ctx, gateway.String(), 1, timeout)
+		}()
+	}
+	wg.Wait()
+
+	if len(open) > 0 {
+		return Hint{Filtered, fmt.Sprintf("TCP port %s still open", portscan.Format(open))}
+	}
+	if iface != "" {
+		if h, ok := c.neighbors(ip, t.MAC); ok {
+			return h
+		}
+	}
+	if gateway != nil && !gatewayUp {
+		return Hint{Unreachable, fmt.Sprintf("gateway %s does not answer either", gateway)}
+	}
+	if iface != "" {
+		return Hint{Off, "no ARP reply on " + iface}
+	}
+	if gateway == nil {
+		return Hint{Unreachable, "no route to " + ip.String()}
+	}
+	return Hint{Unknown, fmt.Sprintf("gateway %s answers", gateway)}
+}
+
+// neighbors looks for the device in the neighbor table of its link, which
+// the failed probes have just refreshed.
+func (c Checker) neighbors(ip net.IP, mac net.HardwareAddr) (Hint, bool) {
+	if c.Ops.Neighbors == nil {
+		return Hint{}, false
+	}
+	table, err := c.Ops.Neighbors.Neighbors()
+	if err != nil {
+		return Hint{}, false
+	}
+	for _, n := range table {
+		if !n.Complete || !n.IP.Equal(ip) {
+			continue
+		}
+		if mac != nil && !bytes.Equal(n.MAC, mac) {
+			return Hint{Replaced, fmt.Sprintf("%s answers ARP for it now, not %s", n.MAC, mac)}, true
+		}
+		return Hint{Asleep, "still answers ARP as " + n.MAC.String()}, true
+	}
+	if mac == nil {
+		return Hint{}, false
+	}
+	for _, n := range table {
+		if n.Complete && bytes.Equal(n.MAC, mac) && !n.IP.Equal(ip) && n.IP.To4() != nil {
+			return Hint{Moved, "now at " + n.IP.String()}, true
+		}
+	}
+	return Hint{}, false
+}
+
+// gatewayTowards returns the router traffic to ip goes through: the
+// gateway of the most specific route to it, or for a directly attached
+// address the default gateway of its interface, which tells whether the
+// link itself is up. It returns nil if there is no route.
+func gatewayTowards(ip net.IP, iface string) net.IP {
+	if iface != "" {
+		return netinfo.GatewayFor(iface)
+	}
+	routes, err := netinfo.Routes()
+	if err != nil {
+		return nil
+	}
+	var best *netinfo.Route
+	for i, r := range routes {
+		if r.Gateway == nil || !r.Destination.Contains(ip) {
+			continue
+		}
+		ones, _ := r.Destination.Mask.Size()
+		if best == nil {
+			best = &routes[i]
+			continue
+		}
+		if bestOnes, _ := best.Destination.Mask.Size(); ones > bestOnes {
+			best = &routes[i]
+		}
+	}
+	if best == nil {
+		return nil
+	}
+	return best.Gateway
+}
@@ -0,0 +1,96 @@
+// Package events is the scanner's event bus. The scanner publishes what it
+// finds as it goes, and output, notification and storage code subscribe to
+// the events they need instead of waiting for the scan to return.
+package events
+
+import (
+	"sync"
+	"time"
+
+	"pingdisco.com/pingdisco/internal/device"
+	"pingdisco.com/pingdisco/internal/targets"
+)
+
+// Type is the kind of an event.
+type Type string
+
+// Event types.
+const (
+	ScanPlanned      Type = "scan_planned"
+	ScanStarted      Type = "scan_started"
+	HostProbed       Type = "host_probed"
+	DeviceDiscovered Type = "device_discovered"
+	DeviceEnriched   Type = "device_enriched"
+	ScanFinished     Type = "scan_finished"
+	ScanSkipped      Type = "scan_skipped"
+)
+
+// Event is published on a Bus.
+type Event struct {
+	Type Type
+	Time time.Time
+	// Group is the target group being scanned.
+	Group targets.Group
+	// Device is set for device events.
+	Device *device.Device
+	// Devices holds the online devices sorted by address on ScanFinished.
+	Devices []*device.Device
+	// Hosts is the number of addresses a run will probe on ScanPlanned,
+	// published once per run before the first group is scanned.
+	// HostProbed follows the probe of each of them, with Device set if
+	// the host answered.
+	Hosts int
+	// Pace is the time between the probes of the group on ScanStarted,
+	// zero if they are not paced, and PaceReason what made them paced.
+	Pace       time.Duration
+	PaceReason string
+}
+
+// Handler receives events.
+type Handler func(Event)
+
+// Bus delivers events to its subscribers, synchronously and in the order
+// they subscribed. Handlers must not publish or subscribe themselves. A nil
+// *Bus discards events.
+type Bus struct {
+	mu       sync.Mutex
+	handlers []Handler
+}
+
+// New returns an empty bus.
+func New() *Bus {
+	return &Bus{}
+}
+
+// Subscribe registers h for all events.
+func (b *Bus) Subscribe(h Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers = append(b.handlers, h)
+}
+
+// On registers h for events of type t only.
+func (b *Bus) On(t Type, h Handler) {
+	b.Subscribe(func(e Event) {
+		if e.Type == t {
+			h(e)
+		}
+	})
+}
+
+// Publish delivers e to every subscriber. Events published concurrently are
+// delivered one at a time, so handlers need no locking of their own.
+func (b *Bus) Publish(e Event) {
+	if b == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, h := range b.handlers {
+		h(e)
+	}
+}
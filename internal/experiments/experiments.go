@@ -0,0 +1,98 @@
+// Package experiments gates discovery methods that are not ready to be on
+// by default. They only run when enabled by name, so trying one out never
+// changes what a default scan does.
+package experiments
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Names of the experiments.
+const (
+	// SilentHosts reports hosts that resolved in the neighbor table during
+	// the ping sweep without answering it, such as machines whose firewall
+	// drops ICMP.
+	SilentHosts = "silent-hosts"
+)
+
+// Experiment describes an experiment.
+type Experiment struct {
+	Name        string
+	Description string
+}
+
+// All lists the experiments this build knows about.
+var All = []Experiment{
+	{SilentHosts, "add hosts that answer ARP or NDP after the ping sweep but not ping itself"},
+}
+
+// Set is the experiments enabled for a run. The zero value enables none.
+type Set map[string]bool
+
+// New enables the named experiments. Names this build does not know are
+// kept but have no effect, so configuration written for a newer version
+// still applies.
+func New(names ...string) Set {
+	s := make(Set, len(names))
+	for _, name := range names {
+		s[name] = true
+	}
+	return s
+}
+
+// Parse reads a comma-separated list of experiment names, or "all".
+// Unknown names are an error.
+func Parse(list string) (Set, error) {
+	s := make(Set)
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		switch {
+		case name == "":
+		case name == "all":
+			for _, e := range All {
+				s[e.Name] = true
+			}
+		case known(name):
+			s[name] = true
+		default:
+			return nil, fmt.Errorf("unknown experiment %q (available: %s)", name, strings.Join(names(), ", "))
+		}
+	}
+	return s, nil
+}
+
+// Enabled reports whether the named experiment is on.
+func (s Set) Enabled(name string) bool {
+	return s[name]
+}
+
+// Names returns the enabled experiments in order.
+func (s Set) Names() []string {
+	var list []string
+	for name, on := range s {
+		if on {
+			list = append(list, name)
+		}
+	}
+	sort.Strings(list)
+	return list
+}
+
+func known(name string) bool {
+	for _, e := range All {
+		if e.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func names() []string {
+	list := make([]string, len(All))
+	for i, e := range All {
+		list[i] = e.Name
+	}
+	return list
+}
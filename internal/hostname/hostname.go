@@ -0,0 +1,91 @@
+// Package hostname turns names from reverse DNS, mDNS and other untrusted
+// sources into text that is safe to print: internationalized (xn--) labels
+// are shown in Unicode and control characters are escaped, so a hostile or
+// broken name cannot inject terminal escape sequences or break an output
+// format.
+package hostname
+
+import (
+	"fmt"
+	"html"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const acePrefix = "xn--"
+
+// Clean returns name without its trailing dot, with IDN labels decoded to
+// Unicode and with control, formatting (such as bidirectional overrides)
+// and invalid UTF-8 characters replaced by \x or \u escapes.
+func Clean(name string) string {
+	name = strings.TrimSuffix(name, ".")
+
+	labels := strings.Split(name, ".")
+	for i, label := range labels {
+		if len(label) > len(acePrefix) && strings.EqualFold(label[:len(acePrefix)], acePrefix) {
+			if decoded, err := decodePunycode(label[len(acePrefix):]); err == nil {
+				label = decoded
+			}
+		}
+		labels[i] = escape(label)
+	}
+
+	return strings.Join(labels, ".")
+}
+
+// ASCII returns the ASCII (punycode) form of name, lower-cased and without
+// its trailing dot, for comparing names written either way.
+func ASCII(name string) string {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+
+	labels := strings.Split(name, ".")
+	for i, label := range labels {
+		if !isASCII(label) {
+			labels[i] = acePrefix + encodePunycode(label)
+		}
+	}
+
+	return strings.Join(labels, ".")
+}
+
+// Equal reports whether a and b are the same name, ignoring case, a
+// trailing dot and whether IDN labels are written in Unicode or punycode.
+func Equal(a, b string) bool {
+	return ASCII(a) == ASCII(b)
+}
+
+// HTML returns the cleaned name escaped for inclusion in HTML.
+func HTML(name string) string {
+	return html.EscapeString(Clean(name))
+}
+
+func escape(s string) string {
+	var b strings.Builder
+	for len(s) > 0 {
+		r, size := utf8.DecodeRuneInString(s)
+		switch {
+		case r == utf8.RuneError && size == 1:
+			fmt.Fprintf(&b, `\x%02x`, s[0])
+		case unicode.IsControl(r) || unicode.Is(unicode.Cf, r) || r == '\\':
+			if r < 0x100 {
+				fmt.Fprintf(&b, `\x%02x`, r)
+			} else {
+				fmt.Fprintf(&b, `\u%04x`, r)
+			}
+		default:
+			b.WriteRune(r)
+		}
+		s = s[size:]
+	}
+	return b.String()
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
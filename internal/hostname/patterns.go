@@ -0,0 +1,55 @@
+package hostname
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Hints is what a hostname suggests about the device behind it. Empty
+// fields are unknown.
+type Hints struct {
+	Vendor string
+	OS     string
+	Type   string
+}
+
+// Default names that devices give themselves, matched against the first
+// label of the hostname. The first matching pattern wins.
+var patterns = []struct {
+	re    *regexp.Regexp
+	hints Hints
+}{
+	{regexp.MustCompile(`iphone`), Hints{"Apple", "iOS", "phone"}},
+	{regexp.MustCompile(`ipad`), Hints{"Apple", "iPadOS", "tablet"}},
+	{regexp.MustCompile(`macbook`), Hints{"Apple", "macOS", "laptop"}},
+	{regexp.MustCompile(`^(imac|mac-?mini|mac-?pro|mac-?studio)`), Hints{"Apple", "macOS", "desktop"}},
+	{regexp.MustCompile(`apple-?tv`), Hints{"Apple", "tvOS", "media player"}},
+	{regexp.MustCompile(`galaxy`), Hints{"Samsung", "Android", "phone"}},
+	{regexp.MustCompile(`^android`), Hints{"", "Android", "phone"}},
+	{regexp.MustCompile(`^desktop-[0-9a-z]{7}$`), Hints{"", "Windows", "desktop"}},
+	{regexp.MustCompile(`^laptop-[0-9a-z]{8}$`), Hints{"", "Windows", "laptop"}},
+	{regexp.MustCompile(`^br[nw][0-9a-f]{12}$`), Hints{"Brother", "", "printer"}},
+	{regexp.MustCompile(`^npi[0-9a-f]{6}$`), Hints{"HP", "", "printer"}},
+	{regexp.MustCompile(`^raspberrypi`), Hints{"Raspberry Pi", "Linux", "single-board computer"}},
+	{regexp.MustCompile(`^(diskstation|synology)`), Hints{"Synology", "DSM", "NAS"}},
+	{regexp.MustCompile(`chromecast`), Hints{"Google", "", "media player"}},
+	{regexp.MustCompile(`^roku`), Hints{"Roku", "", "media player"}},
+	{regexp.MustCompile(`^sonos`), Hints{"Sonos", "", "speaker"}},
+	{regexp.MustCompile(`^fritz`), Hints{"AVM", "", "router"}},
+	{regexp.MustCompile(`printer`), Hints{"", "", "printer"}},
+	{regexp.MustCompile(`^(router|gateway|gw)\b`), Hints{"", "", "router"}},
+	{regexp.MustCompile(`^nas\b`), Hints{"", "", "NAS"}},
+}
+
+// Describe returns what the default naming schemes of common devices
+// suggest about name. It is a guess: anyone can call their laptop
+// "printer".
+func Describe(name string) Hints {
+	label, _, _ := strings.Cut(strings.ToLower(strings.TrimSuffix(name, ".")), ".")
+	for _, p := range patterns {
+		if p.re.MatchString(label) {
+			return p.hints
+		}
+	}
+	return Hints{}
+}
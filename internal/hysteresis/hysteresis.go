@@ -0,0 +1,55 @@
+// Package hysteresis suppresses flapping in up/down observations: a key is
+// only declared down after several consecutive misses and up again after
+// several consecutive hits.
+package hysteresis
+
+// Tracker debounces observations per key. The zero value declares every
+// change immediately.
+type Tracker struct {
+	// UpAfter is the number of consecutive hits needed before a down key
+	// is declared up.
+	UpAfter int
+	// DownAfter is the number of consecutive misses needed before an up key
+	// is declared down.
+	DownAfter int
+
+	states map[string]*state
+}
+
+type state struct {
+	up     bool
+	streak int
+}
+
+// Observe records whether key was seen and returns its debounced state and
+// whether that state just changed. The first observation of a key
+// establishes its state immediately and is not reported as a change.
+func (t *Tracker) Observe(key string, seen bool) (up, changed bool) {
+	if t.states == nil {
+		t.states = make(map[string]*state)
+	}
+
+	st, ok := t.states[key]
+	if !ok {
+		t.states[key] = &state{up: seen}
+		return seen, false
+	}
+
+	if seen == st.up {
+		st.streak = 0
+		return st.up, false
+	}
+
+	st.streak++
+	need := t.DownAfter
+	if seen {
+		need = t.UpAfter
+	}
+	if st.streak < max(need, 1) {
+		return st.up, false
+	}
+
+	st.up = seen
+	st.streak = 0
+	return st.up, true
+}
@@ -0,0 +1,92 @@
+// Package icon maps what a device is to a picture of it: a glyph for
+// terminals and a small SVG image for HTML output, so a device list can be
+// read at a glance by people who do not know what BRW0123456789AB means.
+package icon
+
+import (
+	"strings"
+
+	"pingdisco.com/pingdisco/internal/device"
+)
+
+// Icon is the picture of one kind of device.
+type Icon struct {
+	// Name is the kind of device shown, e.g. "printer".
+	Name  string
+	Glyph string
+	// SVG is a 24x24 image drawn in currentColor, safe to embed in HTML.
+	SVG string
+}
+
+const svgOpen = `<svg xmlns="http://www.w3.org/2000/svg" width="24" height="24" viewBox="0 0 24 24" fill="none" stroke="currentColor" stroke-width="1.6" stroke-linecap="round" stroke-linejoin="round" role="img" aria-label="`
+
+func svg(label, body string) string {
+	return svgOpen + label + `">` + body + `</svg>`
+}
+
+// Icons of the kinds of device told apart.
+var (
+	Phone   = Icon{"phone", "📱", svg("phone", `<rect x="7" y="2.5" width="10" height="19" rx="2"/><path d="M11 18.5h2"/>`)}
+	Tablet  = Icon{"tablet", "📱", svg("tablet", `<rect x="4.5" y="2.5" width="15" height="19" rx="2"/><path d="M11 18.5h2"/>`)}
+	Laptop  = Icon{"laptop", "💻", svg("laptop", `<rect x="5" y="5" width="14" height="10" rx="1"/><path d="M2.5 19h19l-2-4h-15z"/>`)}
+	Desktop = Icon{"desktop", "🖥️", svg("desktop", `<rect x="3" y="4" width="18" height="12" rx="1"/><path d="M9 20h6M12 16v4"/>`)}
+	Printer = Icon{"printer", "🖨️", svg("printer", `<path d="M7 9V3h10v6"/><rect x="3" y="9" width="18" height="8" rx="1"/><path d="M7 14h10v7H7z"/>`)}
+	NAS     = Icon{"NAS", "🗄️", svg("NAS", `<rect x="5" y="2.5" width="14" height="19" rx="1.5"/><path d="M8 7h8M8 11h8M8 15h8"/><circle cx="15.5" cy="18.5" r=".5"/>`)}
+	Router  = Icon{"router", "📡", svg("router", `<rect x="3" y="13" width="18" height="7" rx="1.5"/><path d="M7 13l-2-8M17 13l2-8"/><circle cx="7.5" cy="16.5" r=".5"/><circle cx="10.5" cy="16.5" r=".5"/>`)}
+	Media   = Icon{"media player", "📺", svg("media player", `<rect x="2.5" y="5" width="19" height="12" rx="1"/><path d="M8 21h8M9 2.5l3 2.5 3-2.5"/>`)}
+	Speaker = Icon{"speaker", "🔊", svg("speaker", `<rect x="6" y="2.5" width="12" height="19" rx="2"/><circle cx="12" cy="14" r="3.5"/><circle cx="12" cy="6.5" r="1"/>`)}
+	Board   = Icon{"single-board computer", "🔌", svg("single-board computer", `<rect x="3" y="6" width="18" height="12" rx="1"/><rect x="9" y="9" width="6" height="6"/><path d="M6 3v3M10 3v3M14 3v3M18 3v3"/>`)}
+	Camera  = Icon{"camera", "📷", svg("camera", `<path d="M3 8h4l2-3h6l2 3h4v11H3z"/><circle cx="12" cy="13" r="3.5"/>`)}
+	Unknown = Icon{"device", "❔", svg("device", `<circle cx="12" cy="12" r="9"/><path d="M9.5 9.5a2.5 2.5 0 1 1 3.5 2.3c-.6.3-1 .9-1 1.6v.6M12 17.5v.01"/>`)}
+)
+
+// byType maps device types, as identified, to icons.
+var byType = map[string]Icon{
+	"phone":                 Phone,
+	"tablet":                Tablet,
+	"laptop":                Laptop,
+	"desktop":               Desktop,
+	"printer":               Printer,
+	"nas":                   NAS,
+	"router":                Router,
+	"switch":                Router,
+	"media player":          Media,
+	"tv":                    Media,
+	"speaker":               Speaker,
+	"single-board computer": Board,
+	"camera":                Camera,
+}
+
+// byVendor covers devices whose type is unknown but whose vendor makes
+// mostly one kind of device.
+var byVendor = map[string]Icon{
+	"brother":      Printer,
+	"canon":        Printer,
+	"epson":        Printer,
+	"synology":     NAS,
+	"qnap":         NAS,
+	"sonos":        Speaker,
+	"roku":         Media,
+	"raspberry pi": Board,
+	"avm":          Router,
+	"ubiquiti":     Router,
+	"axis":         Camera,
+	"hikvision":    Camera,
+}
+
+// For returns the icon of d: by its type, or else by its vendor, or else
+// Unknown.
+func For(d *device.Device) Icon {
+	if i, ok := byType[strings.ToLower(d.Identification(device.FieldType).Value)]; ok {
+		return i
+	}
+	// Vendor names from the MAC address registry are longer, such as
+	// "Brother Industries".
+	vendor := strings.ToLower(d.Identification(device.FieldVendor).Value)
+	for name, i := range byVendor {
+		if vendor == name || strings.HasPrefix(vendor, name+" ") {
+			return i
+		}
+	}
+	return Unknown
+}
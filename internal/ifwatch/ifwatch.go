@@ -0,0 +1,113 @@
+// Package ifwatch notices the subnets of local interfaces coming and going
+// while a long-running command runs: docking stations, USB network
+// adapters, VPN tunnels and Wi-Fi joining another network. It polls, which
+// costs little and works the same on every platform.
+package ifwatch
+
+import (
+	"context"
+	"net"
+	"sort"
+	"time"
+)
+
+// Subnet is a subnet of a local interface.
+type Subnet struct {
+	Interface string
+	Network   *net.IPNet
+}
+
+func (s Subnet) key() string {
+	return s.Interface + " " + s.Network.String()
+}
+
+// Change lists the subnets that appeared and disappeared.
+type Change struct {
+	Added, Removed []Subnet
+}
+
+// settle is the number of consecutive polls a subnet must have been up or
+// gone before it is reported, so a VPN reconnecting or a DHCP renewal does
+// not count as a change.
+const settle = 2
+
+// Watch calls list every interval until ctx is done and sends a Change on
+// the returned channel whenever subnets have appeared or disappeared. The
+// subnets of the first poll are the baseline and are not reported. Failed
+// polls are skipped. The channel is closed when ctx is done.
+func Watch(ctx context.Context, interval time.Duration, list func() ([]Subnet, error)) <-chan Change {
+	changes := make(chan Change)
+	go func() {
+		defer close(changes)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		var current map[string]Subnet
+		pending := make(map[string]int)
+		for {
+			if subnets, err := list(); err == nil {
+				polled := make(map[string]Subnet, len(subnets))
+				for _, s := range subnets {
+					polled[s.key()] = s
+				}
+				if current == nil {
+					current = polled
+				} else if c := diff(current, polled, pending); len(c.Added)+len(c.Removed) > 0 {
+					select {
+					case changes <- c:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return changes
+}
+
+// diff applies to current the subnets that have differed from it in settle
+// consecutive polls, counted in pending, and returns them.
+func diff(current, polled map[string]Subnet, pending map[string]int) Change {
+	var c Change
+	keys := make(map[string]bool, len(current)+len(polled))
+	for k := range current {
+		keys[k] = true
+	}
+	for k := range polled {
+		keys[k] = true
+	}
+
+	for k := range keys {
+		was, up := current[k]
+		now, seen := polled[k]
+		if up == seen {
+			delete(pending, k)
+			continue
+		}
+		if pending[k]++; pending[k] < settle {
+			continue
+		}
+		delete(pending, k)
+		if seen {
+			current[k] = now
+			c.Added = append(c.Added, now)
+		} else {
+			delete(current, k)
+			c.Removed = append(c.Removed, was)
+		}
+	}
+
+	sortSubnets(c.Added)
+	sortSubnets(c.Removed)
+	return c
+}
+
+func sortSubnets(s []Subnet) {
+	sort.Slice(s, func(i, j int) bool { return s[i].key() < s[j].key() })
+}
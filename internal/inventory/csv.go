@@ -0,0 +1,175 @@
+package inventory
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+)
+
+// csvColumns maps the column headings of common asset lists, lower-cased
+// with _ and - read as spaces, to the field they fill.
+var csvColumns = map[string]string{
+	"ip":                "ip",
+	"ip address":        "ip",
+	"ipv4":              "ip",
+	"ipv4 address":      "ip",
+	"address":           "ip",
+	"mac":               "mac",
+	"mac address":       "mac",
+	"hardware address":  "mac",
+	"name":              "name",
+	"label":             "name",
+	"device":            "name",
+	"device name":       "name",
+	"asset":             "name",
+	"asset name":        "name",
+	"hostname":          "hostname",
+	"host name":         "hostname",
+	"dns name":          "hostname",
+	"expected hostname": "hostname",
+	"owner":             "owner",
+	"user":              "owner",
+	"assigned to":       "owner",
+	"location":          "location",
+	"site":              "location",
+	"room":              "location",
+}
+
+// CSVImport is the result of reading an asset list.
+type CSVImport struct {
+	Devices []*Device
+	// Skipped lists the rows that could not be read.
+	Skipped []*RowError
+	// Ignored lists the columns not matching any field.
+	Ignored []string
+}
+
+// RowError is a row of a CSV file that was skipped.
+type RowError struct {
+	Line int
+	Err  error
+}
+
+func (e *RowError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+// ReadCSV reads known devices from a CSV file whose first row names the
+// columns: an IP address column is required; MAC, name, hostname (the
+// expected reverse DNS name), owner and location are optional. Files
+// separated by semicolons, as spreadsheets write in many locales, are
+// recognized as well. Rows with an invalid address are skipped rather
+// than failing the whole file.
+func ReadCSV(r io.Reader) (*CSVImport, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	text := strings.TrimPrefix(string(data), "\ufeff")
+
+	cr := csv.NewReader(strings.NewReader(text))
+	header, _, _ := strings.Cut(text, "\n")
+	if strings.Count(header, ";") > strings.Count(header, ",") {
+		cr.Comma = ';'
+	}
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	heading, err := cr.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, errors.New("empty file")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := &CSVImport{}
+	fields := make([]string, len(heading))
+	hasIP := false
+	for i, h := range heading {
+		key := strings.ToLower(strings.TrimSpace(h))
+		key = strings.NewReplacer("_", " ", "-", " ").Replace(key)
+		fields[i] = csvColumns[key]
+		switch {
+		case fields[i] == "ip":
+			hasIP = true
+		case fields[i] == "" && strings.TrimSpace(h) != "":
+			result.Ignored = append(result.Ignored, strings.TrimSpace(h))
+		}
+	}
+	if !hasIP {
+		return nil, errors.New("no IP address column in the header row")
+	}
+
+	for {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		line, _ := cr.FieldPos(0)
+		if err != nil {
+			var perr *csv.ParseError
+			if errors.As(err, &perr) {
+				result.Skipped = append(result.Skipped, &RowError{Line: perr.Line, Err: perr.Err})
+				continue
+			}
+			return nil, err
+		}
+
+		d := &Device{}
+		empty := true
+		for i, v := range record {
+			v = strings.TrimSpace(v)
+			if i >= len(fields) || v == "" {
+				continue
+			}
+			empty = false
+			switch fields[i] {
+			case "ip":
+				d.IP = v
+			case "mac":
+				d.MAC = v
+			case "name":
+				d.Name = v
+			case "hostname":
+				d.ExpectedHostname = v
+			case "owner":
+				d.Owner = v
+			case "location":
+				d.Location = v
+			}
+		}
+		if empty {
+			continue
+		}
+
+		if err := checkCSVDevice(d); err != nil {
+			result.Skipped = append(result.Skipped, &RowError{Line: line, Err: err})
+			continue
+		}
+		result.Devices = append(result.Devices, d)
+	}
+	return result, nil
+}
+
+func checkCSVDevice(d *Device) error {
+	if d.IP == "" {
+		return errors.New("no IP address")
+	}
+	ip := net.ParseIP(d.IP)
+	if ip == nil {
+		return fmt.Errorf("invalid IP address %q", d.IP)
+	}
+	d.IP = ip.String()
+	if d.MAC != "" {
+		mac, err := net.ParseMAC(d.MAC)
+		if err != nil {
+			return fmt.Errorf("invalid MAC address %q", d.MAC)
+		}
+		d.MAC = mac.String()
+	}
+	return nil
+}
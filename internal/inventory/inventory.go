@@ -0,0 +1,239 @@
+// Package inventory keeps the list of known devices and their per-device
+// settings, such as how a device should be probed.
+package inventory
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"pingdisco.com/pingdisco/internal/checks"
+	"pingdisco.com/pingdisco/internal/hostname"
+)
+
+// Probe methods.
+const (
+	ProbeICMP = "icmp"
+	ProbeTCP  = "tcp"
+)
+
+// Probe overrides how a single device is probed.
+type Probe struct {
+	// Method is ProbeICMP or ProbeTCP.
+	Method  string   `json:"method,omitempty"`
+	Port    int      `json:"port,omitempty"`
+	Timeout Duration `json:"timeout,omitempty"`
+}
+
+// Device is a known device.
+type Device struct {
+	IP   string `json:"ip"`
+	Name string `json:"name,omitempty"`
+	// MAC, Owner and Location come from asset lists and are shown
+	// alongside the device.
+	MAC      string `json:"mac,omitempty"`
+	Owner    string `json:"owner,omitempty"`
+	Location string `json:"location,omitempty"`
+	// ExpectedHostname is the name reverse DNS should return; a different
+	// answer is reported as a mismatch.
+	ExpectedHostname string `json:"expected_hostname,omitempty"`
+	Probe            *Probe `json:"probe,omitempty"`
+	// Checks are service checks run against the device.
+	Checks []checks.Check `json:"checks,omitempty"`
+	// Pin places the device on the floor plan.
+	Pin *Pin `json:"pin,omitempty"`
+}
+
+// Pin is a position on the floor plan image, in percent of its width and
+// height from the top left corner.
+type Pin struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+// Inventory is a set of known devices keyed by IP address.
+type Inventory struct {
+	Devices map[string]*Device `json:"devices"`
+}
+
+// New returns an empty inventory.
+func New() *Inventory {
+	return &Inventory{Devices: make(map[string]*Device)}
+}
+
+// Load reads an inventory from path. A missing file yields an empty
+// inventory.
+func Load(path string) (*Inventory, error) {
+	inv := New()
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return inv, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, inv); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if inv.Devices == nil {
+		inv.Devices = make(map[string]*Device)
+	}
+	return inv, nil
+}
+
+// Save writes the inventory to path.
+func (inv *Inventory) Save(path string) error {
+	data, err := json.MarshalIndent(inv, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Lookup returns the device with the given address, or nil. It is safe to
+// call on a nil inventory.
+func (inv *Inventory) Lookup(ip string) *Device {
+	if inv == nil {
+		return nil
+	}
+	return inv.Devices[ip]
+}
+
+// Put adds or replaces a device.
+func (inv *Inventory) Put(d *Device) error {
+	ip := net.ParseIP(d.IP)
+	if ip == nil {
+		return fmt.Errorf("invalid IP address %q", d.IP)
+	}
+	if d.MAC != "" {
+		mac, err := net.ParseMAC(d.MAC)
+		if err != nil {
+			return fmt.Errorf("%s: invalid MAC address %q", d.IP, d.MAC)
+		}
+		d.MAC = mac.String()
+	}
+	if d.Probe != nil {
+		if err := d.Probe.Validate(); err != nil {
+			return fmt.Errorf("%s: %w", d.IP, err)
+		}
+	}
+	for _, c := range d.Checks {
+		if err := c.Validate(); err != nil {
+			return fmt.Errorf("%s: %w", d.IP, err)
+		}
+	}
+
+	d.IP = ip.String()
+	inv.Devices[d.IP] = d
+	return nil
+}
+
+// Merge adds d, or updates the known device at its address with the
+// fields d sets, keeping probe overrides and checks. It reports whether
+// the device is new.
+func (inv *Inventory) Merge(d *Device) (bool, error) {
+	ip := net.ParseIP(d.IP)
+	if ip == nil {
+		return false, fmt.Errorf("invalid IP address %q", d.IP)
+	}
+	old := inv.Lookup(ip.String())
+	if old == nil {
+		return true, inv.Put(d)
+	}
+
+	merged := *old
+	for _, f := range []struct {
+		dst *string
+		src string
+	}{
+		{&merged.Name, d.Name},
+		{&merged.MAC, d.MAC},
+		{&merged.Owner, d.Owner},
+		{&merged.Location, d.Location},
+		{&merged.ExpectedHostname, d.ExpectedHostname},
+	} {
+		if f.src != "" {
+			*f.dst = f.src
+		}
+	}
+	return false, inv.Put(&merged)
+}
+
+// Sorted returns the devices ordered by address.
+func (inv *Inventory) Sorted() []*Device {
+	devices := make([]*Device, 0, len(inv.Devices))
+	for _, d := range inv.Devices {
+		devices = append(devices, d)
+	}
+	sort.Slice(devices, func(i, j int) bool {
+		a, b := net.ParseIP(devices[i].IP), net.ParseIP(devices[j].IP)
+		return bytes.Compare(a.To16(), b.To16()) < 0
+	})
+	return devices
+}
+
+// Validate checks that the probe can be carried out.
+func (p *Probe) Validate() error {
+	switch p.Method {
+	case "", ProbeICMP:
+	case ProbeTCP:
+		if p.Port <= 0 || p.Port > 65535 {
+			return fmt.Errorf("tcp probe needs a port between 1 and 65535")
+		}
+	default:
+		return fmt.Errorf("unknown probe method %q", p.Method)
+	}
+	if p.Timeout < 0 {
+		return fmt.Errorf("probe timeout must not be negative")
+	}
+	return nil
+}
+
+// HostnameMatches reports whether name satisfies the device's expected
+// hostname, in either Unicode or punycode form. Devices without an
+// expectation match anything.
+func (d *Device) HostnameMatches(name string) bool {
+	if d == nil || d.ExpectedHostname == "" {
+		return true
+	}
+	return hostname.Equal(name, d.ExpectedHostname)
+}
+
+// Duration is a time.Duration that reads and writes as a string such as
+// "2s" in JSON.
+type Duration time.Duration
+
+// MarshalJSON implements json.Marshaler.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
@@ -0,0 +1,186 @@
+// Package localdns names hosts of the local network that have no reverse
+// DNS entry by asking the hosts themselves: over multicast DNS (RFC 6762),
+// which Apple devices, printers and Linux machines running Avahi answer,
+// and over LLMNR (RFC 4795), which Windows answers. Queries go straight to
+// the host's address instead of the multicast group, so only the host
+// asked answers and no group has to be joined.
+//
+// It also finds the DNS server holding the reverse zone of a private
+// address, on Windows networks a domain controller, to ask it directly.
+package localdns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Protocols a name can come from, as returned by Resolver.LookupLocal.
+const (
+	MDNS  = "mdns"
+	LLMNR = "llmnr"
+)
+
+const (
+	mdnsPort  = 5353
+	llmnrPort = 5355
+)
+
+// DefaultTimeout bounds each query. Hosts on the local link answer within
+// milliseconds or not at all.
+const DefaultTimeout = 300 * time.Millisecond
+
+// servicesName lists the service types a DNS-SD responder offers.
+const servicesName = "_services._dns-sd._udp.local"
+
+// maxServices is the number of service types asked for their instances
+// when a host does not answer reverse queries.
+const maxServices = 3
+
+// LookupMDNS returns the .local name of ip over mDNS: the answer to a
+// reverse query, or else the host named by the first service the host
+// advertises over DNS-SD.
+func LookupMDNS(ctx context.Context, ip net.IP, timeout time.Duration) (string, error) {
+	records, err := exchange(ctx, ip, mdnsPort, reverseName(ip), typePTR, timeout)
+	if err == nil {
+		if name := answer(records, typePTR); name != "" {
+			return name, nil
+		}
+	}
+	if ctx.Err() != nil {
+		return "", ctx.Err()
+	}
+	return serviceHost(ctx, ip, timeout)
+}
+
+// serviceHost enumerates the DNS-SD services of ip and returns the target
+// of the first service record it finds, or the name of the first service
+// instance.
+func serviceHost(ctx context.Context, ip net.IP, timeout time.Duration) (string, error) {
+	records, err := exchange(ctx, ip, mdnsPort, servicesName, typePTR, timeout)
+	if err != nil {
+		return "", err
+	}
+	var types []string
+	for _, r := range records {
+		if r.typ == typePTR && strings.EqualFold(r.name, servicesName) {
+			types = append(types, r.data)
+		}
+	}
+
+	instance := ""
+	for _, typ := range types[:min(len(types), maxServices)] {
+		records, err := exchange(ctx, ip, mdnsPort, typ, typePTR, timeout)
+		if err != nil {
+			continue
+		}
+		if target := answer(records, typeSRV); target != "" {
+			return target, nil
+		}
+		if name := answer(records, typePTR); name != "" && instance == "" {
+			instance = strings.TrimSuffix(name, "."+typ)
+		}
+	}
+	return instance, nil
+}
+
+// LookupLLMNR returns the name of ip from a reverse query over LLMNR.
+func LookupLLMNR(ctx context.Context, ip net.IP, timeout time.Duration) (string, error) {
+	records, err := exchange(ctx, ip, llmnrPort, reverseName(ip), typePTR, timeout)
+	if err != nil {
+		return "", err
+	}
+	return answer(records, typePTR), nil
+}
+
+// answer returns the target of the first record of type typ, or "".
+func answer(records []record, typ uint16) string {
+	for _, r := range records {
+		if r.typ == typ && r.data != "" {
+			return r.data
+		}
+	}
+	return ""
+}
+
+// exchange sends a query for name to ip on port and returns the records of
+// the first response to it.
+func exchange(ctx context.Context, ip net.IP, port int, name string, typ uint16, timeout time.Duration) ([]record, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", net.JoinHostPort(ip.String(), strconv.Itoa(port)))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	id := uint16(rand.Uint32())
+	records, rcode, err := ask(ctx, conn, query(id, name, typ), id, timeout)
+	if err == nil && rcode != 0 {
+		return nil, fmt.Errorf("localdns: response code %d", rcode)
+	}
+	return records, err
+}
+
+// ask sends the query msg with the given id over conn and returns the
+// records and response code of the response to it.
+func ask(ctx context.Context, conn net.Conn, msg []byte, id uint16, timeout time.Duration) ([]record, int, error) {
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	if _, err := conn.Write(msg); err != nil {
+		return nil, 0, err
+	}
+	return readResponse(conn, id)
+}
+
+// readResponse reads from conn until the response to the query with the
+// given id arrives, skipping anything else, and returns its records and
+// response code.
+func readResponse(conn net.Conn, id uint16) ([]record, int, error) {
+	buf := make([]byte, 9000)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, 0, err
+		}
+		records, rcode, err := parse(buf[:n], id)
+		if errors.Is(err, errMalformed) {
+			// Not a response to this query.
+			continue
+		}
+		return records, rcode, err
+	}
+}
+
+// Resolver names hosts over mDNS and, failing that, LLMNR. It implements
+// netops.LocalResolver.
+type Resolver struct {
+	// Timeout bounds each query; zero means DefaultTimeout.
+	Timeout time.Duration
+}
+
+// LookupLocal returns the name of the host at addr and the protocol that
+// gave it, MDNS or LLMNR, or two empty strings if neither did.
+func (r Resolver) LookupLocal(ctx context.Context, addr string) (name, source string) {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return "", ""
+	}
+	timeout := r.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	if name, err := LookupMDNS(ctx, ip, timeout); err == nil && name != "" {
+		return name, MDNS
+	}
+	if name, err := LookupLLMNR(ctx, ip, timeout); err == nil && name != "" {
+		return name, LLMNR
+	}
+	return "", ""
+}
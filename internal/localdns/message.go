@@ -0,0 +1,153 @@
+package localdns
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// DNS record types and class used by the lookups.
+const (
+	typeSOA = 6
+	typePTR = 12
+	typeSRV = 33
+	classIN = 1
+)
+
+// rcodeNXDomain is the response code of a name that does not exist.
+const rcodeNXDomain = 3
+
+var errMalformed = errors.New("localdns: malformed message")
+
+// record is a resource record of a response. Data is the target name of
+// PTR and SRV records, the primary server of SOA records and empty for
+// other types.
+type record struct {
+	name string
+	typ  uint16
+	data string
+}
+
+// query returns a standard query for name of type typ.
+func query(id uint16, name string, typ uint16) []byte {
+	b := make([]byte, 12, 512)
+	binary.BigEndian.PutUint16(b[0:], id)
+	binary.BigEndian.PutUint16(b[4:], 1)
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		b = append(b, byte(len(label)))
+		b = append(b, label...)
+	}
+	b = append(b, 0)
+	b = binary.BigEndian.AppendUint16(b, typ)
+	return binary.BigEndian.AppendUint16(b, classIN)
+}
+
+// parse returns the records of every section of the response to the
+// query with the given id, and its response code: the authority section
+// of a negative answer still names the zone the name would be in.
+func parse(msg []byte, id uint16) ([]record, int, error) {
+	if len(msg) < 12 || binary.BigEndian.Uint16(msg) != id || msg[2]&0x80 == 0 {
+		return nil, 0, errMalformed
+	}
+	rcode := int(msg[3] & 0x0f)
+	questions := int(binary.BigEndian.Uint16(msg[4:]))
+	count := 0
+	for i := 6; i < 12; i += 2 {
+		count += int(binary.BigEndian.Uint16(msg[i:]))
+	}
+
+	off := 12
+	for range questions {
+		_, next, err := readName(msg, off)
+		if err != nil {
+			return nil, 0, err
+		}
+		off = next + 4
+	}
+
+	var records []record
+	for range count {
+		name, next, err := readName(msg, off)
+		if err != nil {
+			return nil, 0, err
+		}
+		if next+10 > len(msg) {
+			return nil, 0, errMalformed
+		}
+		r := record{name: name, typ: binary.BigEndian.Uint16(msg[next:])}
+		start := next + 10
+		end := start + int(binary.BigEndian.Uint16(msg[next+8:]))
+		if end > len(msg) {
+			return nil, 0, errMalformed
+		}
+		switch r.typ {
+		case typePTR, typeSOA:
+			r.data, _, err = readName(msg, start)
+		case typeSRV:
+			// Priority, weight and port come before the target.
+			r.data, _, err = readName(msg, start+6)
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		records = append(records, r)
+		off = end
+	}
+	return records, rcode, nil
+}
+
+// readName reads the possibly compressed name at off and returns it with
+// the offset just past it.
+func readName(msg []byte, off int) (string, int, error) {
+	var labels []string
+	next := -1
+	for jumps := 0; ; {
+		if off >= len(msg) {
+			return "", 0, errMalformed
+		}
+		n := int(msg[off])
+		switch {
+		case n == 0:
+			if next < 0 {
+				next = off + 1
+			}
+			return strings.Join(labels, "."), next, nil
+		case n&0xc0 == 0xc0:
+			if off+1 >= len(msg) || jumps > 16 {
+				return "", 0, errMalformed
+			}
+			if next < 0 {
+				next = off + 2
+			}
+			off = int(binary.BigEndian.Uint16(msg[off:]) & 0x3fff)
+			jumps++
+		case n&0xc0 != 0:
+			return "", 0, errMalformed
+		default:
+			if off+1+n > len(msg) {
+				return "", 0, errMalformed
+			}
+			labels = append(labels, string(msg[off+1:off+1+n]))
+			off += 1 + n
+		}
+	}
+}
+
+// reverseName returns the name a PTR query for ip asks for.
+func reverseName(ip net.IP) string {
+	if v4 := ip.To4(); v4 != nil {
+		return fmt.Sprintf("%d.%d.%d.%d.in-addr.arpa", v4[3], v4[2], v4[1], v4[0])
+	}
+	const hex = "0123456789abcdef"
+	var b strings.Builder
+	for i := len(ip) - 1; i >= 0; i-- {
+		b.WriteByte(hex[ip[i]&0x0f])
+		b.WriteByte('.')
+		b.WriteByte(hex[ip[i]>>4])
+		b.WriteByte('.')
+	}
+	b.WriteString("ip6.arpa")
+	return b.String()
+}
@@ -0,0 +1,323 @@
+package localdns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ZoneTimeout bounds each query to a DNS server, which may be a few hops
+// away, unlike the hosts asked over mDNS and LLMNR.
+const ZoneTimeout = 2 * time.Second
+
+// DefaultRate is the most reverse queries per second a ZoneResolver sends
+// to one server: a sweep of a /16 must not look like an attack to the
+// domain controller it asks.
+const DefaultRate = 50
+
+// zoneConns is the number of sockets a ZoneResolver keeps open to each
+// server, and so the most queries it has outstanding there.
+const zoneConns = 4
+
+// ErrNoZone is returned by FindZone when the resolvers know of no server
+// holding the names of an address.
+var ErrNoZone = errors.New("no reverse zone")
+
+// placeholders are the primary servers named by reverse zones that are
+// served empty, by resolvers themselves (RFC 6303) or by the AS112 project
+// (RFC 7534), to keep the queries for private addresses off the Internet.
+var placeholders = map[string]bool{
+	"localhost":            true,
+	"prisoner.iana.org":    true,
+	"blackhole.as112.arpa": true,
+}
+
+// Zone is a reverse DNS zone and the server it is published by, as named
+// by its SOA record. On Windows networks this is usually a domain
+// controller, which registers the names of the machines of the domain.
+type Zone struct {
+	// Name is the zone, e.g. "1.168.192.in-addr.arpa".
+	Name string
+	// Primary is the name of the primary server, e.g. "dc01.corp.example".
+	Primary string
+	Server  net.IP
+}
+
+// FindZone asks the resolvers in turn for the SOA record of the reverse
+// name of ip, a private IPv4 address, and returns the zone the name is in
+// with the address of its primary server. Zones served empty and the
+// public zones above the private ranges yield ErrNoZone.
+func FindZone(ctx context.Context, resolvers []net.IP, ip net.IP, timeout time.Duration) (Zone, error) {
+	octets := privateOctets(ip)
+	if octets == 0 {
+		return Zone{}, fmt.Errorf("%w: %s is not a private IPv4 address", ErrNoZone, ip)
+	}
+	err := errors.New("no DNS servers")
+	for _, resolver := range resolvers {
+		var z Zone
+		if z, err = askZone(ctx, resolver, ip, octets, timeout); err == nil {
+			return z, nil
+		}
+		if errors.Is(err, ErrNoZone) || ctx.Err() != nil {
+			break
+		}
+	}
+	return Zone{}, err
+}
+
+func askZone(ctx context.Context, resolver, ip net.IP, octets int, timeout time.Duration) (Zone, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", net.JoinHostPort(resolver.String(), "53"))
+	if err != nil {
+		return Zone{}, err
+	}
+	defer conn.Close()
+
+	id := uint16(rand.Uint32())
+	msg := query(id, reverseName(ip), typeSOA)
+	// Recursion desired: the resolver is asked, not the zone's server.
+	msg[2] |= 0x01
+	records, rcode, err := ask(ctx, conn, msg, id, timeout)
+	if err != nil {
+		return Zone{}, err
+	}
+	if rcode != 0 && rcode != rcodeNXDomain {
+		return Zone{}, fmt.Errorf("%s: response code %d", resolver, rcode)
+	}
+	// The SOA is the answer for a zone's own name, and in the authority
+	// section for any other.
+	var soa *record
+	for i := range records {
+		if records[i].typ == typeSOA {
+			soa = &records[i]
+			break
+		}
+	}
+	if soa == nil {
+		return Zone{}, fmt.Errorf("%w: %s returned no SOA record", ErrNoZone, resolver)
+	}
+
+	z := Zone{Name: normalize(soa.name), Primary: normalize(soa.data)}
+	// "in-addr.arpa" and the zones of public /8 blocks hold no names of
+	// the local network.
+	if strings.Count(z.Name, ".")-1 < octets || !strings.HasSuffix(z.Name, ".in-addr.arpa") {
+		return Zone{}, fmt.Errorf("%w: only the public zone %s", ErrNoZone, z.Name)
+	}
+	if placeholders[z.Primary] {
+		return Zone{}, fmt.Errorf("%w: %s is served empty by %s", ErrNoZone, z.Name, z.Primary)
+	}
+	addrs, err := net.DefaultResolver.LookupIP(ctx, "ip", z.Primary)
+	if err != nil {
+		return Zone{}, fmt.Errorf("primary server of %s: %w", z.Name, err)
+	}
+	for _, addr := range addrs {
+		if addr.IsLoopback() {
+			return Zone{}, fmt.Errorf("%w: %s is served by the resolver itself", ErrNoZone, z.Name)
+		}
+		if z.Server == nil || (z.Server.To4() == nil && addr.To4() != nil) {
+			z.Server = addr
+		}
+	}
+	return z, nil
+}
+
+func normalize(name string) string {
+	return strings.ToLower(strings.TrimSuffix(name, "."))
+}
+
+// privateOctets returns the number of leading octets fixed by the private
+// range (RFC 1918) ip is in, or 0 if it is in none.
+func privateOctets(ip net.IP) int {
+	v4 := ip.To4()
+	switch {
+	case v4 == nil:
+		return 0
+	case v4[0] == 10:
+		return 1
+	case v4[0] == 172 && v4[1]&0xf0 == 16, v4[0] == 192 && v4[1] == 168:
+		return 2
+	}
+	return 0
+}
+
+// ZoneResolver looks up the names of private IPv4 addresses at the primary
+// server of their reverse zone, found with FindZone, and those of other
+// addresses, or that the server does not name, with Fallback. Resolvers on
+// home routers often do not forward reverse queries for private ranges to
+// the domain controller that holds them, so Windows machines go unnamed.
+// Queries to each server are paced and sent over a few sockets kept open.
+// It implements netops.Resolver.
+type ZoneResolver struct {
+	Fallback interface {
+		LookupAddr(ctx context.Context, addr string) ([]string, error)
+	}
+	// Resolvers are the DNS servers asked for the zones, usually
+	// netinfo.Nameservers.
+	Resolvers []net.IP
+	// Rate is the most queries per second sent to one server; zero means
+	// DefaultRate.
+	Rate int
+	// Timeout bounds each query; zero means ZoneTimeout.
+	Timeout time.Duration
+
+	mu sync.Mutex
+	// zones holds the zone of each /24, by its first three octets.
+	zones   map[string]*zoneEntry
+	servers map[string]*zoneServer
+}
+
+type zoneEntry struct {
+	once sync.Once
+	zone Zone
+	err  error
+}
+
+// LookupAddr implements netops.Resolver.
+func (r *ZoneResolver) LookupAddr(ctx context.Context, addr string) ([]string, error) {
+	ip := net.ParseIP(addr)
+	if z, err := r.Zone(ctx, ip); err == nil {
+		names, err := r.server(z.Server).lookup(ctx, reverseName(ip), r.timeout())
+		if err == nil && len(names) > 0 {
+			return names, nil
+		}
+	}
+	return r.Fallback.LookupAddr(ctx, addr)
+}
+
+// Zone returns the zone holding the name of ip, found once for each /24.
+func (r *ZoneResolver) Zone(ctx context.Context, ip net.IP) (Zone, error) {
+	if privateOctets(ip) == 0 {
+		return Zone{}, ErrNoZone
+	}
+	v4 := ip.To4()
+	key := string(v4[:3])
+	r.mu.Lock()
+	if r.zones == nil {
+		r.zones = make(map[string]*zoneEntry)
+	}
+	e := r.zones[key]
+	if e == nil {
+		e = &zoneEntry{}
+		r.zones[key] = e
+	}
+	r.mu.Unlock()
+	e.once.Do(func() {
+		// Found for every later lookup too, so not cut short with the
+		// lookup that happened to ask first.
+		e.zone, e.err = FindZone(context.WithoutCancel(ctx), r.Resolvers, ip, r.timeout())
+	})
+	return e.zone, e.err
+}
+
+func (r *ZoneResolver) timeout() time.Duration {
+	if r.Timeout > 0 {
+		return r.Timeout
+	}
+	return ZoneTimeout
+}
+
+func (r *ZoneResolver) server(ip net.IP) *zoneServer {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.servers == nil {
+		r.servers = make(map[string]*zoneServer)
+	}
+	s := r.servers[ip.String()]
+	if s == nil {
+		rate := r.Rate
+		if rate <= 0 {
+			rate = DefaultRate
+		}
+		s = &zoneServer{addr: net.JoinHostPort(ip.String(), "53"), gap: time.Second / time.Duration(rate), conns: make(chan net.Conn, zoneConns)}
+		for range zoneConns {
+			s.conns <- nil
+		}
+		r.servers[ip.String()] = s
+	}
+	return s
+}
+
+// zoneServer is a server reverse queries are sent to directly.
+type zoneServer struct {
+	addr string
+	// gap is the least time between the starts of two queries.
+	gap time.Duration
+	// conns holds the sockets not in use, nil for those not opened yet.
+	conns chan net.Conn
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+// lookup returns the targets of the PTR records of name, or none if the
+// name does not exist.
+func (s *zoneServer) lookup(ctx context.Context, name string, timeout time.Duration) ([]string, error) {
+	if err := s.wait(ctx); err != nil {
+		return nil, err
+	}
+	var conn net.Conn
+	select {
+	case conn = <-s.conns:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if conn == nil {
+		var d net.Dialer
+		c, err := d.DialContext(ctx, "udp", s.addr)
+		if err != nil {
+			s.conns <- nil
+			return nil, err
+		}
+		conn = c
+	}
+
+	id := uint16(rand.Uint32())
+	records, rcode, err := ask(ctx, conn, query(id, name, typePTR), id, timeout)
+	if err != nil {
+		// The socket is replaced rather than kept for a late answer to
+		// turn up on.
+		conn.Close()
+		s.conns <- nil
+		return nil, err
+	}
+	s.conns <- conn
+	switch rcode {
+	case 0:
+	case rcodeNXDomain:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("%s: response code %d", s.addr, rcode)
+	}
+	var names []string
+	for _, r := range records {
+		if r.typ == typePTR && r.data != "" && strings.EqualFold(r.name, name) {
+			names = append(names, r.data+".")
+		}
+	}
+	return names, nil
+}
+
+// wait returns when the next query may be sent.
+func (s *zoneServer) wait(ctx context.Context) error {
+	s.mu.Lock()
+	at := time.Now()
+	if s.next.After(at) {
+		at = s.next
+	}
+	s.next = at.Add(s.gap)
+	s.mu.Unlock()
+
+	t := time.NewTimer(time.Until(at))
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
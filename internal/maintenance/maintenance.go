@@ -0,0 +1,171 @@
+// Package maintenance schedules windows during which availability alerts
+// for chosen devices and subnets are suppressed.
+package maintenance
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"pingdisco.com/pingdisco/internal/timefmt"
+)
+
+// Window is a maintenance window. It is either a one-off window between
+// Start and End, or a recurring one from From to To (HH:MM, local time) on
+// the given Days, or every day when Days is empty.
+type Window struct {
+	Name string `json:"name"`
+	// Targets are IP addresses, CIDR subnets or hostnames.
+	Targets []string `json:"targets"`
+
+	Start time.Time `json:"start,omitempty"`
+	End   time.Time `json:"end,omitempty"`
+
+	Days []string `json:"days,omitempty"`
+	From string   `json:"from,omitempty"`
+	To   string   `json:"to,omitempty"`
+}
+
+// Schedule is a set of maintenance windows.
+type Schedule []Window
+
+// Load reads a JSON array of windows from path.
+func Load(path string) (Schedule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var s Schedule
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for i, w := range s {
+		if err := w.validate(); err != nil {
+			return nil, fmt.Errorf("%s: window %d (%s): %w", path, i+1, w.Name, err)
+		}
+	}
+	return s, nil
+}
+
+// Match returns the first window that is active at t and covers a device
+// with the given address and names, or nil.
+func (s Schedule) Match(ip net.IP, names []string, t time.Time) *Window {
+	for i := range s {
+		if s[i].Active(t) && s[i].Covers(ip, names) {
+			return &s[i]
+		}
+	}
+	return nil
+}
+
+// Active reports whether the window is open at t.
+func (w *Window) Active(t time.Time) bool {
+	if !w.Start.IsZero() || !w.End.IsZero() {
+		return !t.Before(w.Start) && t.Before(w.End)
+	}
+
+	from, _ := timefmt.ParseClock(w.From)
+	to, _ := timefmt.ParseClock(w.To)
+	now := timefmt.ClockOf(t)
+
+	if from <= to {
+		return now >= from && now < to && w.onDay(t.Weekday())
+	}
+	// Wraps around midnight: the early part belongs to the previous day.
+	if now >= from {
+		return w.onDay(t.Weekday())
+	}
+	return now < to && w.onDay(t.AddDate(0, 0, -1).Weekday())
+}
+
+// Covers reports whether the window applies to a device with the given
+// address and names.
+func (w *Window) Covers(ip net.IP, names []string) bool {
+	for _, target := range w.Targets {
+		if _, subnet, err := net.ParseCIDR(target); err == nil {
+			if ip != nil && subnet.Contains(ip) {
+				return true
+			}
+			continue
+		}
+		if t := net.ParseIP(target); t != nil {
+			if ip != nil && t.Equal(ip) {
+				return true
+			}
+			continue
+		}
+		for _, name := range names {
+			if strings.EqualFold(strings.TrimSuffix(name, "."), target) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// String describes when the window is open.
+func (w *Window) String() string {
+	if !w.Start.IsZero() || !w.End.IsZero() {
+		return fmt.Sprintf("%s to %s", timefmt.Format(w.Start), timefmt.Format(w.End))
+	}
+
+	days := "daily"
+	if len(w.Days) > 0 {
+		days = strings.Join(w.Days, ",")
+	}
+	return fmt.Sprintf("%s %s-%s", days, w.From, w.To)
+}
+
+func (w *Window) onDay(day time.Weekday) bool {
+	if len(w.Days) == 0 {
+		return true
+	}
+	for _, d := range w.Days {
+		if len(d) >= 3 && strings.HasPrefix(strings.ToLower(day.String()), strings.ToLower(d)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *Window) validate() error {
+	if len(w.Targets) == 0 {
+		return fmt.Errorf("no targets")
+	}
+
+	if !w.Start.IsZero() || !w.End.IsZero() {
+		if !w.End.After(w.Start) {
+			return fmt.Errorf("end must be after start")
+		}
+		return nil
+	}
+
+	if _, err := timefmt.ParseClock(w.From); err != nil {
+		return fmt.Errorf("from: %w", err)
+	}
+	if _, err := timefmt.ParseClock(w.To); err != nil {
+		return fmt.Errorf("to: %w", err)
+	}
+	for _, d := range w.Days {
+		if !validDay(d) {
+			return fmt.Errorf("unknown day %q", d)
+		}
+	}
+	return nil
+}
+
+func validDay(d string) bool {
+	if len(d) < 3 {
+		return false
+	}
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		if strings.HasPrefix(strings.ToLower(day.String()), strings.ToLower(d)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,166 @@
+// Package nat64 recognises IPv6-only networks that reach IPv4 hosts through
+// NAT64 and DNS64: it finds the translation prefix the way RFC 7050
+// describes and maps IPv4 addresses into it and back (RFC 6052), so hosts
+// given or resolved as IPv4 addresses can still be probed and named.
+package nat64
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"pingdisco.com/pingdisco/internal/netops"
+)
+
+// WellKnown is the prefix most NAT64 gateways translate, 64:ff9b::/96.
+var WellKnown = Prefix{IP: net.ParseIP("64:ff9b::"), Bits: 96}
+
+// probeName has only the A records 192.0.0.170 and 192.0.0.171, so any
+// AAAA record returned for it was synthesized by DNS64.
+const probeName = "ipv4only.arpa"
+
+var probeAddrs = []net.IP{net.IPv4(192, 0, 0, 170), net.IPv4(192, 0, 0, 171)}
+
+// ErrNoDNS64 means the resolver does not synthesize AAAA records.
+var ErrNoDNS64 = errors.New("no DNS64: ipv4only.arpa has no AAAA records")
+
+// lengths are the prefix lengths RFC 6052 allows, longest first.
+var lengths = []int{96, 64, 56, 48, 40, 32}
+
+// positions holds, for each prefix length, the bytes of the IPv6 address
+// that carry the IPv4 address. Byte 8 is always zero.
+var positions = map[int][4]int{
+	32: {4, 5, 6, 7},
+	40: {5, 6, 7, 9},
+	48: {6, 7, 9, 10},
+	56: {7, 9, 10, 11},
+	64: {9, 10, 11, 12},
+	96: {12, 13, 14, 15},
+}
+
+// Prefix is a NAT64 translation prefix.
+type Prefix struct {
+	IP   net.IP
+	Bits int
+}
+
+// Discover asks r for the AAAA records of ipv4only.arpa and works out the
+// prefix DNS64 synthesized them with.
+func Discover(ctx context.Context, r *net.Resolver) (Prefix, error) {
+	ips, err := r.LookupIP(ctx, "ip6", probeName)
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return Prefix{}, ErrNoDNS64
+	}
+	if err != nil {
+		return Prefix{}, err
+	}
+
+	for _, ip := range ips {
+		for _, bits := range lengths {
+			p := Prefix{IP: ip, Bits: bits}
+			v4, ok := p.Extract(ip)
+			if !ok || !isProbeAddr(v4) {
+				continue
+			}
+			p.IP = p.Synthesize(net.IPv4zero)
+			return p, nil
+		}
+	}
+	return Prefix{}, ErrNoDNS64
+}
+
+func isProbeAddr(ip net.IP) bool {
+	for _, a := range probeAddrs {
+		if a.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Valid reports whether p is a prefix at all.
+func (p Prefix) Valid() bool {
+	_, ok := positions[p.Bits]
+	return ok && p.IP.To16() != nil
+}
+
+// Synthesize returns the IPv6 address standing for the IPv4 address v4.
+func (p Prefix) Synthesize(v4 net.IP) net.IP {
+	ip := make(net.IP, net.IPv6len)
+	copy(ip, p.IP.To16()[:p.Bits/8])
+	for i, pos := range positions[p.Bits] {
+		ip[pos] = v4.To4()[i]
+	}
+	return ip
+}
+
+// Extract returns the IPv4 address embedded in ip, if ip is inside p.
+func (p Prefix) Extract(ip net.IP) (net.IP, bool) {
+	ip16 := ip.To16()
+	if !p.Valid() || ip16 == nil || ip.To4() != nil {
+		return nil, false
+	}
+	mask := net.CIDRMask(p.Bits, 128)
+	if !ip16.Mask(mask).Equal(p.IP.To16().Mask(mask)) || (p.Bits < 96 && ip16[8] != 0) {
+		return nil, false
+	}
+	pos := positions[p.Bits]
+	return net.IPv4(ip16[pos[0]], ip16[pos[1]], ip16[pos[2]], ip16[pos[3]]).To4(), true
+}
+
+// String returns p in CIDR notation.
+func (p Prefix) String() string {
+	return fmt.Sprintf("%s/%d", p.IP, p.Bits)
+}
+
+// Pinger pings IPv4 addresses at their synthesized IPv6 addresses, for
+// hosts without an IPv4 route of their own.
+type Pinger struct {
+	netops.Pinger
+	Prefix Prefix
+}
+
+// Ping implements netops.Pinger.
+func (p Pinger) Ping(ctx context.Context, host string, count int, timeout time.Duration) bool {
+	return p.Pinger.Ping(ctx, p.translate(host), count, timeout)
+}
+
+// PingRTT implements netops.RTTPinger.
+func (p Pinger) PingRTT(ctx context.Context, host string, count int, timeout time.Duration) (time.Duration, bool) {
+	return netops.PingRTT(ctx, p.Pinger, p.translate(host), count, timeout)
+}
+
+// PingLink implements netops.LinkPinger; link-local multicast is not
+// translated.
+func (p Pinger) PingLink(ctx context.Context, iface string, local net.IP, timeout time.Duration) ([]netops.Reply, error) {
+	lp, ok := p.Pinger.(netops.LinkPinger)
+	if !ok {
+		return nil, errors.New("multicast ping is not available")
+	}
+	return lp.PingLink(ctx, iface, local, timeout)
+}
+
+func (p Pinger) translate(host string) string {
+	if ip := net.ParseIP(host); ip != nil && ip.To4() != nil {
+		return p.Prefix.Synthesize(ip).String()
+	}
+	return host
+}
+
+// Resolver looks up the names of synthesized addresses under the IPv4
+// address they stand for, which is where their PTR records are.
+type Resolver struct {
+	netops.Resolver
+	Prefix Prefix
+}
+
+// LookupAddr implements netops.Resolver.
+func (r Resolver) LookupAddr(ctx context.Context, addr string) ([]string, error) {
+	if v4, ok := r.Prefix.Extract(net.ParseIP(addr)); ok {
+		addr = v4.String()
+	}
+	return r.Resolver.LookupAddr(ctx, addr)
+}
@@ -0,0 +1,80 @@
+package netinfo
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// Nameservers returns the DNS servers the system resolver asks, from
+// /etc/resolv.conf (ipconfig /all on Windows). A local stub such as
+// systemd-resolved is returned as configured, at 127.0.0.53.
+func Nameservers() ([]net.IP, error) {
+	if runtime.GOOS == "windows" {
+		out, err := exec.Command("ipconfig", "/all").Output()
+		if err != nil {
+			return nil, err
+		}
+		return parseIpconfigDNS(bytes.NewReader(out))
+	}
+	f, err := os.Open("/etc/resolv.conf")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseResolvConf(f)
+}
+
+// ParseResolvConf returns the nameserver addresses of a resolv.conf file.
+func ParseResolvConf(r io.Reader) ([]net.IP, error) {
+	var servers []net.IP
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || fields[0] != "nameserver" {
+			continue
+		}
+		// Link-local IPv6 servers carry a zone, e.g. fe80::1%eth0.
+		addr, _, _ := strings.Cut(fields[1], "%")
+		if ip := net.ParseIP(addr); ip != nil {
+			servers = append(servers, ip)
+		}
+	}
+	return servers, scanner.Err()
+}
+
+// parseIpconfigDNS returns the DNS servers of every adapter listed by
+// ipconfig /all: the address after "DNS Servers" and those on the lines
+// continuing it.
+func parseIpconfigDNS(r io.Reader) ([]net.IP, error) {
+	var servers []net.IP
+	inList := false
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		label, value, found := strings.Cut(line, " : ")
+		switch {
+		case found && strings.HasPrefix(strings.TrimSpace(label), "DNS Servers"):
+			inList = true
+		case found:
+			inList = false
+			continue
+		case inList:
+			value = line
+		default:
+			continue
+		}
+		addr, _, _ := strings.Cut(strings.TrimSpace(value), "%")
+		if ip := net.ParseIP(addr); ip != nil {
+			servers = append(servers, ip)
+		} else {
+			inList = false
+		}
+	}
+	return servers, scanner.Err()
+}
@@ -0,0 +1,215 @@
+// Package netinfo reads what the operating system already knows about the
+// local network: default gateways, the ARP/neighbor table and interface
+// types.
+package netinfo
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Neighbor is an entry of the ARP/neighbor table.
+type Neighbor struct {
+	IP        net.IP
+	MAC       net.HardwareAddr
+	Interface string
+	// Complete is false for entries whose resolution failed or is still
+	// pending, i.e. the address did not answer ARP.
+	Complete bool
+}
+
+// Route is an entry of the IPv4 routing table.
+type Route struct {
+	Destination *net.IPNet
+	Interface   string
+	// Gateway is nil for directly connected destinations.
+	Gateway net.IP
+}
+
+// Link is what the operating system reports about the physical link behind
+// an interface.
+type Link struct {
+	Interface string
+	// Speed is the negotiated link speed in Mbit/s, or zero if unknown.
+	Speed    int
+	Wireless bool
+	// Quality is the Wi-Fi link quality in percent, or -1 if unknown.
+	Quality int
+	// Cellular is set for mobile broadband modems and phones tethered over
+	// USB.
+	Cellular bool
+}
+
+// WiFi is the network a Wi-Fi interface is associated with.
+type WiFi struct {
+	SSID string
+	// BSSID is the MAC address of the access point.
+	BSSID string
+}
+
+// Default reports whether r is a default route.
+func (r Route) Default() bool {
+	ones, _ := r.Destination.Mask.Size()
+	return ones == 0
+}
+
+// DefaultRoutes returns the IPv4 default routes.
+func DefaultRoutes() ([]Route, error) {
+	routes, err := Routes()
+	if err != nil {
+		return nil, err
+	}
+
+	var defaults []Route
+	for _, r := range routes {
+		if r.Default() && r.Gateway != nil {
+			defaults = append(defaults, r)
+		}
+	}
+	return defaults, nil
+}
+
+// GatewayFor returns the default gateway reached through iface, or nil.
+func GatewayFor(iface string) net.IP {
+	routes, err := DefaultRoutes()
+	if err != nil {
+		return nil
+	}
+	for _, r := range routes {
+		if r.Interface == iface {
+			return r.Gateway
+		}
+	}
+	return nil
+}
+
+// InterfaceFor returns the interface the routing table sends traffic for ip
+// out of, or "" if no route covers it.
+func InterfaceFor(ip net.IP) string {
+	routes, err := Routes()
+	if err != nil {
+		return ""
+	}
+	iface, best := "", -1
+	for _, r := range routes {
+		if ones, _ := r.Destination.Mask.Size(); r.Destination.Contains(ip) && ones > best {
+			iface, best = r.Interface, ones
+		}
+	}
+	return iface
+}
+
+// NeighborsOn returns the neighbor table entries inside subnet.
+func NeighborsOn(subnet *net.IPNet) []Neighbor {
+	all, err := Neighbors()
+	if err != nil {
+		return nil
+	}
+
+	var result []Neighbor
+	for _, n := range all {
+		if subnet.Contains(n.IP) {
+			result = append(result, n)
+		}
+	}
+	return result
+}
+
+// parseDestination reads the destination column of BSD netstat -rn, which
+// abbreviates networks: "10.1/16", "192.168.5" and "default".
+func parseDestination(s string, mask net.IPMask) *net.IPNet {
+	if s == "default" {
+		return &net.IPNet{IP: net.IPv4zero.To4(), Mask: net.CIDRMask(0, 32)}
+	}
+
+	addr, bits, hasBits := strings.Cut(s, "/")
+	octets := strings.Split(addr, ".")
+	if len(octets) > 4 {
+		return nil
+	}
+	for len(octets) < 4 {
+		octets = append(octets, "0")
+	}
+	ip := net.ParseIP(strings.Join(octets, ".")).To4()
+	if ip == nil {
+		return nil
+	}
+
+	switch {
+	case hasBits:
+		_, ipnet, err := net.ParseCIDR(ip.String() + "/" + bits)
+		if err != nil {
+			return nil
+		}
+		return ipnet
+	case mask != nil:
+		return &net.IPNet{IP: ip.Mask(mask), Mask: mask}
+	case strings.Count(addr, ".") < 3:
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(8*(strings.Count(addr, ".")+1), 32)}
+	default:
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(32, 32)}
+	}
+}
+
+func parseMAC(s string) net.HardwareAddr {
+	s = strings.TrimSpace(s)
+	// BSD arp prints octets without leading zeros, e.g. 0:1b:2c:3:4:5.
+	parts := strings.FieldsFunc(s, func(r rune) bool { return r == ':' || r == '-' })
+	if len(parts) != 6 {
+		return nil
+	}
+	for i, p := range parts {
+		if len(p) == 1 {
+			parts[i] = "0" + p
+		}
+	}
+
+	mac, err := net.ParseMAC(strings.Join(parts, ":"))
+	if err != nil || isZeroMAC(mac) {
+		return nil
+	}
+	return mac
+}
+
+func isZeroMAC(mac net.HardwareAddr) bool {
+	for _, b := range mac {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseProcARP parses the Linux ARP table in the format of /proc/net/arp,
+// which may come from another machine.
+func ParseProcARP(r io.Reader) ([]Neighbor, error) {
+	var neighbors []Neighbor
+	scanner := bufio.NewScanner(r)
+	scanner.Scan() // header
+	for scanner.Scan() {
+		// IP address, HW type, Flags, HW address, Mask, Device
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 6 {
+			continue
+		}
+
+		ip := net.ParseIP(fields[0])
+		if ip == nil {
+			continue
+		}
+		flags, _ := strconv.ParseUint(strings.TrimPrefix(fields[2], "0x"), 16, 32)
+		mac := parseMAC(fields[3])
+
+		neighbors = append(neighbors, Neighbor{
+			IP:        ip,
+			MAC:       mac,
+			Interface: fields[5],
+			Complete:  flags&0x2 != 0 && mac != nil,
+		})
+	}
+
+	return neighbors, scanner.Err()
+}
@@ -0,0 +1,257 @@
+package netinfo
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Routes reads the IPv4 routing table from /proc/net/route.
+func Routes() ([]Route, error) {
+	f, err := os.Open("/proc/net/route")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var routes []Route
+	scanner := bufio.NewScanner(f)
+	scanner.Scan() // header
+	for scanner.Scan() {
+		// Iface Destination Gateway Flags RefCnt Use Metric Mask ...
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 8 {
+			continue
+		}
+
+		dst, gw, mask := procIP(fields[1]), procIP(fields[2]), procIP(fields[7])
+		if dst == nil || gw == nil || mask == nil {
+			continue
+		}
+
+		r := Route{
+			Destination: &net.IPNet{IP: dst, Mask: net.IPMask(mask)},
+			Interface:   fields[0],
+		}
+		if !gw.Equal(net.IPv4zero) {
+			r.Gateway = gw
+		}
+		routes = append(routes, r)
+	}
+
+	return routes, scanner.Err()
+}
+
+// procIP decodes an address as printed by /proc/net/route: eight hex
+// digits in host (little-endian) byte order.
+func procIP(s string) net.IP {
+	raw, err := hex.DecodeString(s)
+	if err != nil || len(raw) != 4 {
+		return nil
+	}
+	ip := make(net.IP, 4)
+	binary.BigEndian.PutUint32(ip, binary.LittleEndian.Uint32(raw))
+	return ip
+}
+
+// Neighbors reads the IPv4 ARP table from /proc/net/arp.
+func Neighbors() ([]Neighbor, error) {
+	f, err := os.Open("/proc/net/arp")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ParseProcARP(f)
+}
+
+// IsWireless reports whether iface is a Wi-Fi interface.
+func IsWireless(iface string) bool {
+	for _, p := range []string{"wireless", "phy80211"} {
+		if _, err := os.Stat(filepath.Join("/sys/class/net", iface, p)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// tetherDrivers are the drivers of phones tethered over USB and of mobile
+// broadband modems.
+var tetherDrivers = map[string]bool{
+	"rndis_host":     true,
+	"ipheth":         true,
+	"qmi_wwan":       true,
+	"cdc_mbim":       true,
+	"huawei_cdc_ncm": true,
+}
+
+// LinkOf reads the speed of iface from sysfs and, for Wi-Fi, its link
+// quality from /proc/net/wireless.
+func LinkOf(iface string) Link {
+	dir := filepath.Join("/sys/class/net", iface)
+	l := Link{Interface: iface, Wireless: IsWireless(iface), Quality: -1}
+
+	if data, err := os.ReadFile(filepath.Join(dir, "speed")); err == nil {
+		if speed, err := strconv.Atoi(strings.TrimSpace(string(data))); err == nil && speed > 0 {
+			l.Speed = speed
+		}
+	}
+
+	if driver, err := os.Readlink(filepath.Join(dir, "device", "driver")); err == nil && tetherDrivers[filepath.Base(driver)] {
+		l.Cellular = true
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "uevent")); err == nil && strings.Contains(string(data), "DEVTYPE=wwan") {
+		l.Cellular = true
+	}
+	for _, p := range []string{"wwan", "rmnet", "ccmni"} {
+		if strings.HasPrefix(iface, p) {
+			l.Cellular = true
+		}
+	}
+
+	if l.Wireless {
+		if f, err := os.Open("/proc/net/wireless"); err == nil {
+			l.Quality = wirelessQuality(f, iface)
+			f.Close()
+		}
+	}
+	return l
+}
+
+// wirelessQuality returns the link quality of iface in percent from a
+// table in the format of /proc/net/wireless, or -1 if it is not listed.
+// Drivers report the quality out of 70.
+func wirelessQuality(r io.Reader, iface string) int {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		// Interface: status link level noise ...
+		name, rest, ok := strings.Cut(scanner.Text(), ":")
+		if !ok || strings.TrimSpace(name) != iface {
+			continue
+		}
+		fields := strings.Fields(rest)
+		if len(fields) < 2 {
+			return -1
+		}
+		link, err := strconv.ParseFloat(strings.TrimSuffix(fields[1], "."), 64)
+		if err != nil {
+			return -1
+		}
+		return min(int(link*100/70), 100)
+	}
+	return -1
+}
+
+// WiFiOf returns the network iface is associated with, as reported by iw.
+// It is zero for wired interfaces, when not associated and when iw is not
+// installed.
+func WiFiOf(iface string) WiFi {
+	if !IsWireless(iface) {
+		return WiFi{}
+	}
+	out, err := exec.Command("iw", "dev", iface, "link").Output()
+	if err != nil {
+		return WiFi{}
+	}
+	return parseIwLink(out)
+}
+
+// parseIwLink parses the output of iw dev <iface> link:
+//
+//	Connected to aa:bb:cc:dd:ee:ff (on wlan0)
+//		SSID: Home
+func parseIwLink(out []byte) WiFi {
+	var w WiFi
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if v, ok := strings.CutPrefix(line, "Connected to "); ok {
+			w.BSSID, _, _ = strings.Cut(v, " ")
+		}
+		if v, ok := strings.CutPrefix(line, "SSID: "); ok {
+			w.SSID = v
+		}
+	}
+	return w
+}
+
+// Neighbor states of the kernel (NUD_*) in which the link-layer address
+// of a neighbor is known.
+const resolvedStates = 0x02 | 0x04 | 0x08 | 0x10 | 0x80 // reachable, stale, delay, probe, permanent
+
+// Neighbors6 reads the IPv6 neighbor (NDP) table over netlink.
+func Neighbors6() ([]Neighbor, error) {
+	data, err := syscall.NetlinkRIB(syscall.RTM_GETNEIGH, syscall.AF_INET6)
+	if err != nil {
+		return nil, os.NewSyscallError("netlink", err)
+	}
+	msgs, err := syscall.ParseNetlinkMessage(data)
+	if err != nil {
+		return nil, os.NewSyscallError("netlink", err)
+	}
+
+	names := make(map[int]string)
+	if ifaces, err := net.Interfaces(); err == nil {
+		for _, ifi := range ifaces {
+			names[ifi.Index] = ifi.Name
+		}
+	}
+
+	var neighbors []Neighbor
+	for _, m := range msgs {
+		if m.Header.Type != syscall.RTM_NEWNEIGH {
+			continue
+		}
+		if n, ok := parseNeighMsg(m.Data, names); ok {
+			neighbors = append(neighbors, n)
+		}
+	}
+	return neighbors, nil
+}
+
+// parseNeighMsg decodes an RTM_NEWNEIGH message: a struct ndmsg followed
+// by route attributes holding the address and the link-layer address.
+func parseNeighMsg(b []byte, names map[int]string) (Neighbor, bool) {
+	// family, pad, pad, ifindex, state, flags, type
+	const ndmsgLen = 12
+	if len(b) < ndmsgLen || b[0] != syscall.AF_INET6 {
+		return Neighbor{}, false
+	}
+	index := int(int32(binary.NativeEndian.Uint32(b[4:8])))
+	state := binary.NativeEndian.Uint16(b[8:10])
+
+	n := Neighbor{Interface: names[index]}
+	for b = b[ndmsgLen:]; len(b) >= syscall.SizeofRtAttr; {
+		l := int(binary.NativeEndian.Uint16(b[0:2]))
+		typ := binary.NativeEndian.Uint16(b[2:4])
+		if l < syscall.SizeofRtAttr || l > len(b) {
+			break
+		}
+		value := b[syscall.SizeofRtAttr:l]
+		switch typ {
+		case 1: // NDA_DST
+			if len(value) == net.IPv6len {
+				n.IP = append(net.IP(nil), value...)
+			}
+		case 2: // NDA_LLADDR
+			if len(value) == 6 && !isZeroMAC(value) {
+				n.MAC = append(net.HardwareAddr(nil), value...)
+			}
+		}
+		b = b[min((l+3)&^3, len(b)):]
+	}
+	if n.IP == nil {
+		return Neighbor{}, false
+	}
+	n.Complete = state&resolvedStates != 0 && n.MAC != nil
+	return n, true
+}
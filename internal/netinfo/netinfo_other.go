@@ -0,0 +1,307 @@
+//go:build !linux
+
+package netinfo
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"strings"
+)
+
+// Routes parses the IPv4 routing table out of netstat (route print on
+// Windows).
+func Routes() ([]Route, error) {
+	if runtime.GOOS == "windows" {
+		return windowsRoutes()
+	}
+
+	out, err := exec.Command("netstat", "-rn", "-f", "inet").Output()
+	if err != nil {
+		return nil, err
+	}
+
+	var routes []Route
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		// Destination Gateway Flags Netif Expire
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 {
+			continue
+		}
+		dst := parseDestination(fields[0], nil)
+		if dst == nil {
+			continue
+		}
+
+		r := Route{Destination: dst, Interface: fields[3]}
+		if gw := net.ParseIP(fields[1]); gw != nil && strings.Contains(fields[2], "G") {
+			r.Gateway = gw
+		}
+		routes = append(routes, r)
+	}
+
+	return routes, scanner.Err()
+}
+
+func windowsRoutes() ([]Route, error) {
+	out, err := exec.Command("route", "print", "-4").Output()
+	if err != nil {
+		return nil, err
+	}
+
+	ifaces, _ := net.Interfaces()
+
+	var routes []Route
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		// Network Destination, Netmask, Gateway, Interface, Metric
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 {
+			continue
+		}
+		mask := net.ParseIP(fields[1]).To4()
+		local := net.ParseIP(fields[3])
+		if mask == nil || local == nil {
+			continue
+		}
+		dst := parseDestination(fields[0], net.IPMask(mask))
+		if dst == nil {
+			continue
+		}
+
+		r := Route{Destination: dst, Interface: interfaceWithAddr(ifaces, local)}
+		if gw := net.ParseIP(fields[2]); gw != nil {
+			r.Gateway = gw
+		}
+		routes = append(routes, r)
+	}
+
+	return routes, scanner.Err()
+}
+
+func interfaceWithAddr(ifaces []net.Interface, ip net.IP) string {
+	for _, iface := range ifaces {
+		addrs, _ := iface.Addrs()
+		for _, a := range addrs {
+			if ipnet, ok := a.(*net.IPNet); ok && ipnet.IP.Equal(ip) {
+				return iface.Name
+			}
+		}
+	}
+	return ""
+}
+
+var arpLine = regexp.MustCompile(`\(?([0-9.]+)\)?\s+(?:at\s+)?([0-9a-fA-F:-]+|\(incomplete\))(?:.*\son\s+(\S+))?`)
+
+// Neighbors parses the ARP table printed by arp -an (or arp -a on Windows).
+func Neighbors() ([]Neighbor, error) {
+	args := []string{"-an"}
+	if runtime.GOOS == "windows" {
+		args = []string{"-a"}
+	}
+
+	out, err := exec.Command("arp", args...).Output()
+	if err != nil {
+		return nil, err
+	}
+
+	var neighbors []Neighbor
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		m := arpLine.FindStringSubmatch(scanner.Text())
+		if m == nil {
+			continue
+		}
+		ip := net.ParseIP(m[1])
+		if ip == nil {
+			continue
+		}
+		mac := parseMAC(m[2])
+		neighbors = append(neighbors, Neighbor{IP: ip, MAC: mac, Interface: m[3], Complete: mac != nil})
+	}
+
+	return neighbors, scanner.Err()
+}
+
+// IsWireless reports whether iface is a Wi-Fi interface.
+func IsWireless(iface string) bool {
+	switch runtime.GOOS {
+	case "darwin":
+		out, err := exec.Command("networksetup", "-listallhardwareports").Output()
+		if err != nil {
+			return false
+		}
+		// Hardware Port: Wi-Fi
+		// Device: en0
+		var port string
+		scanner := bufio.NewScanner(bytes.NewReader(out))
+		for scanner.Scan() {
+			line := scanner.Text()
+			if v, ok := strings.CutPrefix(line, "Hardware Port: "); ok {
+				port = v
+			}
+			if v, ok := strings.CutPrefix(line, "Device: "); ok && v == iface {
+				return port == "Wi-Fi" || port == "AirPort"
+			}
+		}
+		return false
+	default:
+		lower := strings.ToLower(iface)
+		return strings.HasPrefix(lower, "wl") || strings.Contains(lower, "wi-fi") || strings.Contains(lower, "wireless")
+	}
+}
+
+// LinkOf reports what the interface name reveals about iface: whether it
+// is Wi-Fi or a cellular connection. Speed and quality are unknown.
+func LinkOf(iface string) Link {
+	lower := strings.ToLower(iface)
+	return Link{
+		Interface: iface,
+		Wireless:  IsWireless(iface),
+		Quality:   -1,
+		Cellular:  strings.Contains(lower, "cellular") || strings.Contains(lower, "mobile broadband") || strings.HasPrefix(lower, "wwan"),
+	}
+}
+
+// WiFiOf returns the network iface is associated with, as reported by
+// ipconfig on macOS and netsh on Windows. It is zero for wired interfaces
+// and when not associated.
+func WiFiOf(iface string) WiFi {
+	switch runtime.GOOS {
+	case "darwin":
+		out, err := exec.Command("ipconfig", "getsummary", iface).Output()
+		if err != nil {
+			return WiFi{}
+		}
+		var w WiFi
+		colonFields(out, func(key, value string) {
+			switch key {
+			case "SSID":
+				w.SSID = value
+			case "BSSID":
+				w.BSSID = value
+			}
+		})
+		return w
+	case "windows":
+		out, err := exec.Command("netsh", "wlan", "show", "interfaces").Output()
+		if err != nil {
+			return WiFi{}
+		}
+		return parseNetshWLAN(out, iface)
+	default:
+		return WiFi{}
+	}
+}
+
+// parseNetshWLAN picks the network of iface out of netsh wlan show
+// interfaces, which lists one block per Wi-Fi interface:
+//
+//	Name                   : Wi-Fi
+//	State                  : connected
+//	SSID                   : Home
+//	BSSID                  : aa:bb:cc:dd:ee:ff
+//
+// Recent versions of Windows call the BSSID "AP BSSID".
+func parseNetshWLAN(out []byte, iface string) WiFi {
+	var w WiFi
+	var name string
+	colonFields(out, func(key, value string) {
+		switch key {
+		case "Name":
+			name = value
+		case "SSID":
+			if name == iface {
+				w.SSID = value
+			}
+		case "BSSID", "AP BSSID":
+			if name == iface {
+				w.BSSID = value
+			}
+		}
+	})
+	return w
+}
+
+// colonFields calls fn with the key and value of each "key : value" line
+// of out.
+func colonFields(out []byte, fn func(key, value string)) {
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if ok {
+			fn(strings.TrimSpace(key), strings.TrimSpace(value))
+		}
+	}
+}
+
+var (
+	// fe80::1%en0 0:11:22:33:44:55 en0 23h59m58s S R
+	ndpLine = regexp.MustCompile(`^([0-9a-fA-F:]+)(?:%\S+)?\s+(\S+)\s+(\S+)`)
+	// fe80::1  00-11-22-33-44-55  Reachable (Router)
+	netshLine      = regexp.MustCompile(`^([0-9a-fA-F:]+)(?:%\d+)?\s+([0-9a-fA-F-]{17})\s+(\S+)`)
+	netshInterface = regexp.MustCompile(`^Interface \d+: (.+)$`)
+)
+
+// Neighbors6 parses the IPv6 neighbor (NDP) table printed by ndp -an, or
+// by netsh on Windows.
+func Neighbors6() ([]Neighbor, error) {
+	if runtime.GOOS == "windows" {
+		return windowsNeighbors6()
+	}
+
+	out, err := exec.Command("ndp", "-an").Output()
+	if err != nil {
+		return nil, err
+	}
+
+	var neighbors []Neighbor
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		m := ndpLine.FindStringSubmatch(scanner.Text())
+		if m == nil {
+			continue
+		}
+		ip := net.ParseIP(m[1])
+		if ip == nil {
+			continue
+		}
+		mac := parseMAC(m[2])
+		neighbors = append(neighbors, Neighbor{IP: ip, MAC: mac, Interface: m[3], Complete: mac != nil})
+	}
+	return neighbors, scanner.Err()
+}
+
+func windowsNeighbors6() ([]Neighbor, error) {
+	out, err := exec.Command("netsh", "interface", "ipv6", "show", "neighbors").Output()
+	if err != nil {
+		return nil, err
+	}
+
+	var neighbors []Neighbor
+	var iface string
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if m := netshInterface.FindStringSubmatch(line); m != nil {
+			iface = m[1]
+			continue
+		}
+		m := netshLine.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		ip := net.ParseIP(m[1])
+		if ip == nil {
+			continue
+		}
+		mac := parseMAC(m[2])
+		complete := mac != nil && m[3] != "Unreachable" && m[3] != "Incomplete"
+		neighbors = append(neighbors, Neighbor{IP: ip, MAC: mac, Interface: iface, Complete: complete})
+	}
+	return neighbors, scanner.Err()
+}
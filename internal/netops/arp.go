@@ -0,0 +1,163 @@
+package netops
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"time"
+
+	"pingdisco.com/pingdisco/internal/netinfo"
+)
+
+// ARPScanner asks the hosts of a directly attached network for their MAC
+// addresses. Hosts that drop every ICMP packet still answer ARP, since
+// nothing on the LAN could reach them otherwise.
+type ARPScanner interface {
+	// ARPScan sends an ARP request for each of addrs out of iface, whose
+	// own address on their network is local, and returns the hosts that
+	// answered within timeout.
+	ARPScan(ctx context.Context, iface string, local net.IP, addrs []net.IP, timeout time.Duration) ([]netinfo.Neighbor, error)
+}
+
+// SystemARP sends ARP requests itself over a raw socket where it may open
+// one (Linux with CAP_NET_RAW). Elsewhere it has the kernel do it: sending
+// a datagram to each address makes the OS resolve it over ARP, and the
+// hosts that answered are then read from Neighbors.
+type SystemARP struct {
+	Neighbors NeighborTable
+}
+
+// ARPScan implements ARPScanner.
+func (a SystemARP) ARPScan(ctx context.Context, iface string, local net.IP, addrs []net.IP, timeout time.Duration) ([]netinfo.Neighbor, error) {
+	ifi, err := net.InterfaceByName(iface)
+	if err != nil {
+		return nil, err
+	}
+	if local = local.To4(); local == nil {
+		return nil, errors.New("ARP needs an IPv4 address on " + iface)
+	}
+	if len(ifi.HardwareAddr) == 6 {
+		if found, err := rawARP(ctx, ifi, local, addrs, timeout); err == nil {
+			return found, nil
+		}
+	}
+	return a.nudge(ctx, iface, addrs, timeout)
+}
+
+// arpPace is how many frames or datagrams are sent between short pauses,
+// so a large subnet does not flood the link or the kernel's ARP queue.
+const arpPace = 32
+
+// nudge sends an empty datagram to the discard port of each address, waits
+// timeout for the kernel to resolve them and returns the complete entries
+// of the neighbor table among addrs.
+func (a SystemARP) nudge(ctx context.Context, iface string, addrs []net.IP, timeout time.Duration) ([]netinfo.Neighbor, error) {
+	wanted := make(map[string]bool, len(addrs))
+	for i, ip := range addrs {
+		wanted[ip.String()] = true
+		if conn, err := net.Dial("udp4", net.JoinHostPort(ip.String(), "9")); err == nil {
+			conn.Write(nil)
+			conn.Close()
+		}
+		if i%arpPace == arpPace-1 {
+			if err := sleepCtx(ctx, time.Millisecond); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := sleepCtx(ctx, timeout); err != nil {
+		return nil, err
+	}
+
+	table, err := a.Neighbors.Neighbors()
+	if err != nil {
+		return nil, err
+	}
+	var found []netinfo.Neighbor
+	for _, n := range table {
+		if n.Complete && wanted[n.IP.String()] && (n.Interface == "" || n.Interface == iface) {
+			found = append(found, n)
+		}
+	}
+	return found, nil
+}
+
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// Ethernet and ARP constants for IPv4 over Ethernet.
+const (
+	etherTypeARP = 0x0806
+	arpRequest   = 1
+	arpFrameLen  = 14 + 28
+)
+
+// arpFrame returns a broadcast Ethernet frame asking who has target, sent
+// by the host at mac and ip.
+func arpFrame(mac net.HardwareAddr, ip, target net.IP) []byte {
+	f := make([]byte, arpFrameLen)
+	copy(f[0:6], []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff})
+	copy(f[6:12], mac)
+	binary.BigEndian.PutUint16(f[12:14], etherTypeARP)
+
+	arp := f[14:]
+	binary.BigEndian.PutUint16(arp[0:2], 1)      // Ethernet
+	binary.BigEndian.PutUint16(arp[2:4], 0x0800) // IPv4
+	arp[4], arp[5] = 6, 4
+	binary.BigEndian.PutUint16(arp[6:8], arpRequest)
+	copy(arp[8:14], mac)
+	copy(arp[14:18], ip.To4())
+	copy(arp[24:28], target.To4())
+	return f
+}
+
+// parseARP returns the sender of an ARP packet in an Ethernet frame. Any
+// ARP packet, reply or request, proves its sender is on the link.
+func parseARP(f []byte) (net.IP, net.HardwareAddr, bool) {
+	if len(f) < arpFrameLen || binary.BigEndian.Uint16(f[12:14]) != etherTypeARP {
+		return nil, nil, false
+	}
+	arp := f[14:]
+	if arp[4] != 6 || arp[5] != 4 {
+		return nil, nil, false
+	}
+	mac := net.HardwareAddr(append([]byte(nil), arp[8:14]...))
+	ip := net.IP(append([]byte(nil), arp[14:18]...))
+	if ip.Equal(net.IPv4zero) {
+		return nil, nil, false
+	}
+	return ip, mac, true
+}
+
+// AttachedInterface returns the interface directly attached to subnet and
+// its address there, or "" if no interface is.
+func AttachedInterface(subnet *net.IPNet) (string, net.IP) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return "", nil
+	}
+	for _, ifi := range ifaces {
+		if ifi.Flags&net.FlagUp == 0 || ifi.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, err := ifi.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, a := range addrs {
+			if ipnet, ok := a.(*net.IPNet); ok && ipnet.IP.To4() != nil && ipnet.Contains(subnet.IP) {
+				return ifi.Name, ipnet.IP
+			}
+		}
+	}
+	return "", nil
+}
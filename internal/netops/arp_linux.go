@@ -0,0 +1,119 @@
+package netops
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	"pingdisco.com/pingdisco/internal/netinfo"
+)
+
+// rawARP broadcasts a request for each of addrs on an AF_PACKET socket
+// bound to ifi and collects the answers until timeout after the last one
+// was sent. Each address is asked twice, a pass apart, in case a frame was
+// lost.
+func rawARP(ctx context.Context, ifi *net.Interface, local net.IP, addrs []net.IP, timeout time.Duration) ([]netinfo.Neighbor, error) {
+	proto := htons(etherTypeARP)
+	fd, err := syscall.Socket(syscall.AF_PACKET, syscall.SOCK_RAW, int(proto))
+	if err != nil {
+		return nil, os.NewSyscallError("socket", err)
+	}
+	defer syscall.Close(fd)
+	syscall.CloseOnExec(fd)
+
+	if err := syscall.Bind(fd, &syscall.SockaddrLinklayer{Protocol: proto, Ifindex: ifi.Index}); err != nil {
+		return nil, os.NewSyscallError("bind", err)
+	}
+	// Wake the reader regularly so it notices when to stop.
+	tv := syscall.NsecToTimeval(int64(100 * time.Millisecond))
+	if err := syscall.SetsockoptTimeval(fd, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &tv); err != nil {
+		return nil, os.NewSyscallError("setsockopt", err)
+	}
+
+	wanted := make(map[string]bool, len(addrs))
+	for _, ip := range addrs {
+		wanted[ip.String()] = true
+	}
+
+	var mu sync.Mutex
+	seen := make(map[string]netinfo.Neighbor)
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		buf := make([]byte, 1500)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			n, _, err := syscall.Recvfrom(fd, buf, 0)
+			if err != nil {
+				continue
+			}
+			ip, mac, ok := parseARP(buf[:n])
+			if !ok || !wanted[ip.String()] {
+				continue
+			}
+			mu.Lock()
+			seen[ip.String()] = netinfo.Neighbor{IP: ip, MAC: mac, Interface: ifi.Name, Complete: true}
+			mu.Unlock()
+		}
+	}()
+
+	to := &syscall.SockaddrLinklayer{Protocol: proto, Ifindex: ifi.Index, Halen: 6}
+	copy(to.Addr[:], []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff})
+
+	send := func() error {
+		for i, ip := range addrs {
+			mu.Lock()
+			_, answered := seen[ip.String()]
+			mu.Unlock()
+			if answered {
+				continue
+			}
+			if err := syscall.Sendto(fd, arpFrame(ifi.HardwareAddr, local, ip), 0, to); err != nil {
+				return os.NewSyscallError("sendto", err)
+			}
+			if i%arpPace == arpPace-1 {
+				if err := sleepCtx(ctx, time.Millisecond); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	err = send()
+	if err == nil {
+		err = sleepCtx(ctx, timeout/2)
+	}
+	if err == nil {
+		err = send()
+	}
+	if err == nil {
+		err = sleepCtx(ctx, timeout)
+	}
+	close(stop)
+	<-done
+	if err != nil {
+		return nil, err
+	}
+
+	found := make([]netinfo.Neighbor, 0, len(seen))
+	for _, n := range seen {
+		found = append(found, n)
+	}
+	return found, nil
+}
+
+// htons converts v to network byte order, as AF_PACKET sockets expect
+// their protocol.
+func htons(v uint16) uint16 {
+	return binary.NativeEndian.Uint16(binary.BigEndian.AppendUint16(nil, v))
+}
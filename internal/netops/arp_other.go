@@ -0,0 +1,16 @@
+//go:build !linux
+
+package netops
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	"pingdisco.com/pingdisco/internal/netinfo"
+)
+
+func rawARP(ctx context.Context, ifi *net.Interface, local net.IP, addrs []net.IP, timeout time.Duration) ([]netinfo.Neighbor, error) {
+	return nil, errors.New("raw ARP sockets are not supported on this system")
+}
@@ -0,0 +1,7 @@
+//go:build !windows
+
+package netops
+
+// systemEcho is nil: the ping command of Linux, macOS and busybox marks
+// duplicate replies and prints every reply the same way in any language.
+var systemEcho EchoSender
@@ -0,0 +1,110 @@
+//go:build windows
+
+package netops
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// systemEcho sends echo requests with IcmpSendEcho: ping.exe prints its
+// replies in the language of the system and never reports duplicates.
+var systemEcho EchoSender = icmpSendEcho{}
+
+var (
+	iphlpapi            = syscall.NewLazyDLL("iphlpapi.dll")
+	procIcmpCreateFile  = iphlpapi.NewProc("IcmpCreateFile")
+	procIcmpCloseHandle = iphlpapi.NewProc("IcmpCloseHandle")
+	procIcmpSendEcho    = iphlpapi.NewProc("IcmpSendEcho")
+)
+
+// IP_STATUS codes, which IcmpSendEcho reports through GetLastError when
+// no reply arrived, start at IP_STATUS_BASE; IP_SUCCESS is 0.
+const (
+	ipSuccess    = 0
+	ipStatusBase = 11000
+	ipStatusMax  = 11050
+)
+
+// maxEchoReplies is the number of replies to one request the reply
+// buffer has room for.
+const maxEchoReplies = 8
+
+// echoReplyInfo is ICMP_ECHO_REPLY, laid out as on the platform.
+type echoReplyInfo struct {
+	Address       [4]byte
+	Status        uint32
+	RoundTripTime uint32
+	DataSize      uint16
+	Reserved      uint16
+	Data          uintptr
+	Options       ipOptionInformation
+}
+
+// ipOptionInformation is IP_OPTION_INFORMATION.
+type ipOptionInformation struct {
+	TTL, TOS, Flags, OptionsSize uint8
+	OptionsData                  uintptr
+}
+
+// icmpSendEcho pings IPv4 hosts through the ICMP API of iphlpapi.dll,
+// which needs no privileges. Windows usually hands back only the first
+// reply to a request, so duplicates are counted when it returns more.
+type icmpSendEcho struct{}
+
+// SendEcho implements EchoSender. It cannot be interrupted once sent, and
+// returns within timeout.
+func (icmpSendEcho) SendEcho(ctx context.Context, ip net.IP, timeout time.Duration) ([]time.Duration, error) {
+	ip4 := ip.To4()
+	if ip4 == nil {
+		return nil, errors.New("IcmpSendEcho: only IPv4 hosts are supported")
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	h, _, err := procIcmpCreateFile.Call()
+	if syscall.Handle(h) == syscall.InvalidHandle {
+		return nil, fmt.Errorf("IcmpCreateFile: %w", err)
+	}
+	defer procIcmpCloseHandle.Call(h)
+
+	data := []byte("pingdisco echo  ")
+	// Each reply carries the request's data, and an ICMP error 8 bytes
+	// more; twice the replies leaves room for both.
+	buf := make([]echoReplyInfo, 2*maxEchoReplies)
+	n, _, err := procIcmpSendEcho.Call(
+		h,
+		// IPAddr is the address in network byte order, as it is in
+		// memory on every Windows architecture.
+		uintptr(binary.LittleEndian.Uint32(ip4)),
+		uintptr(unsafe.Pointer(&data[0])),
+		uintptr(len(data)),
+		0,
+		uintptr(unsafe.Pointer(&buf[0])),
+		uintptr(len(buf))*unsafe.Sizeof(buf[0]),
+		uintptr(max(timeout.Milliseconds(), 1)),
+	)
+	if n == 0 {
+		var errno syscall.Errno
+		if errors.As(err, &errno) && errno >= ipStatusBase && errno <= ipStatusMax {
+			// Timed out or unreachable: the host did not answer.
+			return nil, nil
+		}
+		return nil, fmt.Errorf("IcmpSendEcho: %w", err)
+	}
+
+	var rtts []time.Duration
+	for _, r := range buf[:min(int(n), len(buf))] {
+		if r.Status == ipSuccess && net.IP(r.Address[:]).Equal(ip4) {
+			rtts = append(rtts, time.Duration(r.RoundTripTime)*time.Millisecond)
+		}
+	}
+	return rtts, nil
+}
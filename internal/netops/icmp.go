@@ -0,0 +1,301 @@
+package netops
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"runtime"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// ICMP message types used for echo.
+const (
+	icmpEchoReply     = 0
+	icmpEchoRequest   = 8
+	icmpv6EchoRequest = 128
+	icmpv6EchoReply   = 129
+)
+
+// ICMPPinger sends ICMP echo requests itself rather than running the ping
+// command: all hosts share one socket per address family, so sweeping a
+// subnet starts no processes, works without a ping binary and times each
+// reply in process. It uses a raw socket when allowed and an unprivileged
+// datagram socket (Linux with net.ipv4.ping_group_range, macOS) otherwise.
+// Where neither can be opened, such as on Windows, it hands every ping to
+// Fallback. The zero value is ready to use.
+type ICMPPinger struct {
+	// Fallback pings when no ICMP socket can be opened; nil reports every
+	// host as down.
+	Fallback Pinger
+
+	once [2]sync.Once
+	conn [2]*icmpConn
+	err  [2]error
+}
+
+// Ping implements Pinger.
+func (p *ICMPPinger) Ping(ctx context.Context, host string, count int, timeout time.Duration) bool {
+	_, ok := p.PingRTT(ctx, host, count, timeout)
+	return ok
+}
+
+// PingRTT implements RTTPinger.
+func (p *ICMPPinger) PingRTT(ctx context.Context, host string, count int, timeout time.Duration) (time.Duration, bool) {
+	ip := net.ParseIP(host)
+	if ip == nil {
+		addrs, err := net.DefaultResolver.LookupIP(ctx, "ip", host)
+		if err != nil || len(addrs) == 0 {
+			return 0, false
+		}
+		ip = addrs[0]
+	}
+
+	c, err := p.open(ip)
+	if err != nil {
+		if p.Fallback == nil {
+			return 0, false
+		}
+		return PingRTT(ctx, p.Fallback, host, count, timeout)
+	}
+
+	for i := 0; i < max(count, 1); i++ {
+		if rtt, err := c.echo(ctx, ip, timeout); err == nil {
+			return rtt, true
+		}
+		if ctx.Err() != nil {
+			return 0, false
+		}
+	}
+	return 0, false
+}
+
+// Echo sends one echo request to ip and returns the round-trip time of
+// the reply.
+func (p *ICMPPinger) Echo(ctx context.Context, ip net.IP, timeout time.Duration) (time.Duration, error) {
+	c, err := p.open(ip)
+	if err != nil {
+		return 0, err
+	}
+	return c.echo(ctx, ip, timeout)
+}
+
+// Method describes how IPv4 hosts are pinged: "raw socket", "datagram
+// socket", or "" when pings go to Fallback.
+func (p *ICMPPinger) Method() string {
+	c, err := p.open(net.IPv4(127, 0, 0, 1))
+	if err != nil {
+		return ""
+	}
+	if c.datagram {
+		return "datagram socket"
+	}
+	return "raw socket"
+}
+
+// Err returns why IPv4 hosts cannot be pinged natively, or nil.
+func (p *ICMPPinger) Err() error {
+	_, err := p.open(net.IPv4(127, 0, 0, 1))
+	return err
+}
+
+func (p *ICMPPinger) open(ip net.IP) (*icmpConn, error) {
+	family := 0
+	if ip.To4() == nil {
+		family = 1
+	}
+	p.once[family].Do(func() {
+		p.conn[family], p.err[family] = listenICMP(family == 1)
+	})
+	return p.conn[family], p.err[family]
+}
+
+// icmpConn is an ICMP socket and the echo requests waiting for a reply
+// on it.
+type icmpConn struct {
+	conn     net.PacketConn
+	v6       bool
+	datagram bool
+	id       uint16
+
+	mu      sync.Mutex
+	seq     uint16
+	waiting map[echoKey]chan struct{}
+}
+
+type echoKey struct {
+	addr string
+	seq  uint16
+}
+
+func listenICMP(v6 bool) (*icmpConn, error) {
+	if runtime.GOOS == "windows" {
+		return nil, errors.New("native ICMP is not supported on Windows")
+	}
+
+	network, addr := "ip4:icmp", "0.0.0.0"
+	if v6 {
+		network, addr = "ip6:ipv6-icmp", "::"
+	}
+
+	c := &icmpConn{v6: v6, id: uint16(rand.Uint32()), waiting: make(map[echoKey]chan struct{})}
+	conn, err := net.ListenPacket(network, addr)
+	if err != nil {
+		var dgramErr error
+		conn, dgramErr = listenDatagram(v6, nil)
+		if dgramErr != nil {
+			return nil, fmt.Errorf("no raw ICMP socket (%v) and no datagram ICMP socket (%v)", err, dgramErr)
+		}
+		c.datagram = true
+	}
+	c.conn = conn
+
+	go c.read()
+	return c, nil
+}
+
+// echo sends one echo request to ip and waits for the reply.
+func (c *icmpConn) echo(ctx context.Context, ip net.IP, timeout time.Duration) (time.Duration, error) {
+	c.mu.Lock()
+	c.seq++
+	key := echoKey{ip.String(), c.seq}
+	reply := make(chan struct{}, 1)
+	c.waiting[key] = reply
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.waiting, key)
+		c.mu.Unlock()
+	}()
+
+	msg := EchoRequest(c.v6, c.id, key.seq)
+	var dst net.Addr = &net.IPAddr{IP: ip}
+	if c.datagram {
+		dst = &net.UDPAddr{IP: ip}
+	}
+
+	start := time.Now()
+	for {
+		_, err := c.conn.WriteTo(msg, dst)
+		if err == nil {
+			break
+		}
+		// Requests to addresses that are still being resolved hold on to
+		// the socket's send buffer until ARP gives up, which back-to-back
+		// sweeps of a sparse subnet can exhaust; wait for it to drain.
+		if !errors.Is(err, syscall.ENOBUFS) || time.Since(start) >= timeout {
+			return 0, err
+		}
+		select {
+		case <-time.After(10 * time.Millisecond):
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	}
+
+	timer := time.NewTimer(timeout - time.Since(start))
+	defer timer.Stop()
+	select {
+	case <-reply:
+		return time.Since(start), nil
+	case <-timer.C:
+		return 0, fmt.Errorf("no echo reply from %s within %s", ip, timeout)
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+}
+
+// read hands echo replies to the requests waiting for them until the
+// socket is closed.
+func (c *icmpConn) read() {
+	buf := make([]byte, 1500)
+	for {
+		n, from, err := c.conn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+
+		msg := buf[:n]
+		// Datagram sockets on macOS pass the IPv4 header up as well.
+		if !c.v6 && n >= 20 && msg[0]>>4 == 4 {
+			msg = msg[int(msg[0]&0x0f)*4:]
+		}
+		if len(msg) < 8 {
+			continue
+		}
+
+		want := byte(icmpEchoReply)
+		if c.v6 {
+			want = icmpv6EchoReply
+		}
+		// Datagram sockets get their own identifier from the kernel;
+		// replies on them are already ours.
+		if msg[0] != want || (!c.datagram && binary.BigEndian.Uint16(msg[4:]) != c.id) {
+			continue
+		}
+
+		key := echoKey{addrIP(from).String(), binary.BigEndian.Uint16(msg[6:])}
+
+		c.mu.Lock()
+		if ch := c.waiting[key]; ch != nil {
+			select {
+			case ch <- struct{}{}:
+			default:
+			}
+		}
+		c.mu.Unlock()
+	}
+}
+
+// addrIP returns the address of a peer on a raw or datagram ICMP socket.
+func addrIP(a net.Addr) net.IP {
+	switch a := a.(type) {
+	case *net.IPAddr:
+		return a.IP
+	case *net.UDPAddr:
+		return a.IP
+	}
+	return nil
+}
+
+// EchoRequest returns an ICMP or ICMPv6 echo request message with the
+// given identifier and sequence number.
+func EchoRequest(v6 bool, id, seq uint16) []byte {
+	typ := byte(icmpEchoRequest)
+	if v6 {
+		typ = icmpv6EchoRequest
+	}
+	msg := make([]byte, 8+16)
+	msg[0] = typ
+	binary.BigEndian.PutUint16(msg[4:], id)
+	binary.BigEndian.PutUint16(msg[6:], seq)
+	copy(msg[8:], "pingdisco echo  ")
+	if !v6 {
+		// The kernel fills in ICMPv6 checksums, which cover a pseudo
+		// header only it knows.
+		binary.BigEndian.PutUint16(msg[2:], Checksum(msg))
+	}
+	return msg
+}
+
+// Checksum is the Internet checksum of RFC 1071.
+func Checksum(b []byte) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(b); i += 2 {
+		sum += uint32(b[i])<<8 | uint32(b[i+1])
+	}
+	if len(b)%2 == 1 {
+		sum += uint32(b[len(b)-1]) << 8
+	}
+	for sum>>16 != 0 {
+		sum = sum&0xffff + sum>>16
+	}
+	return ^uint16(sum)
+}
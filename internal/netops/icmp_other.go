@@ -0,0 +1,12 @@
+//go:build !linux && !darwin
+
+package netops
+
+import (
+	"errors"
+	"net"
+)
+
+func listenDatagram(v6 bool, local *net.IPAddr) (net.PacketConn, error) {
+	return nil, errors.New("unprivileged ICMP sockets are not supported on this system")
+}
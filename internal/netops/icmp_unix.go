@@ -0,0 +1,46 @@
+//go:build linux || darwin
+
+package netops
+
+import (
+	"net"
+	"os"
+	"syscall"
+)
+
+// listenDatagram opens an unprivileged ICMP socket, which the kernel lets
+// send echo requests and receive their replies only. It is bound to local,
+// or to every address if local is nil.
+func listenDatagram(v6 bool, local *net.IPAddr) (net.PacketConn, error) {
+	family, proto := syscall.AF_INET, syscall.IPPROTO_ICMP
+	var sa syscall.Sockaddr = &syscall.SockaddrInet4{}
+	if v6 {
+		family, proto = syscall.AF_INET6, syscall.IPPROTO_ICMPV6
+		sa6 := &syscall.SockaddrInet6{}
+		if local != nil {
+			copy(sa6.Addr[:], local.IP.To16())
+			if ifi, err := net.InterfaceByName(local.Zone); err == nil {
+				sa6.ZoneId = uint32(ifi.Index)
+			}
+		}
+		sa = sa6
+	} else if local != nil {
+		sa4 := &syscall.SockaddrInet4{}
+		copy(sa4.Addr[:], local.IP.To4())
+		sa = sa4
+	}
+
+	fd, err := syscall.Socket(family, syscall.SOCK_DGRAM, proto)
+	if err != nil {
+		return nil, os.NewSyscallError("socket", err)
+	}
+	syscall.CloseOnExec(fd)
+	if err := syscall.Bind(fd, sa); err != nil {
+		syscall.Close(fd)
+		return nil, os.NewSyscallError("bind", err)
+	}
+
+	f := os.NewFile(uintptr(fd), "icmp")
+	defer f.Close()
+	return net.FilePacketConn(f)
+}
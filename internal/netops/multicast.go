@@ -0,0 +1,77 @@
+package netops
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"os"
+	"runtime"
+	"time"
+)
+
+// allNodes is the link-local multicast address every IPv6 host listens on.
+var allNodes = net.ParseIP("ff02::1")
+
+// PingLink implements LinkPinger. The request goes out on a socket of its
+// own bound to local, so hosts answer from their address on the same
+// prefix: a link-local local finds link-local addresses, a global one
+// global addresses.
+func (p *ICMPPinger) PingLink(ctx context.Context, iface string, local net.IP, timeout time.Duration) ([]Reply, error) {
+	if runtime.GOOS == "windows" {
+		return nil, errors.New("multicast ping is not supported on Windows")
+	}
+
+	bind := &net.IPAddr{IP: local}
+	if local.IsLinkLocalUnicast() {
+		bind.Zone = iface
+	}
+	var dst net.Addr = &net.IPAddr{IP: allNodes, Zone: iface}
+	datagram := false
+	conn, err := net.ListenPacket("ip6:ipv6-icmp", bind.String())
+	if err != nil {
+		var dgramErr error
+		conn, dgramErr = listenDatagram(true, bind)
+		if dgramErr != nil {
+			return nil, fmt.Errorf("no raw ICMPv6 socket (%v) and no datagram ICMPv6 socket (%v)", err, dgramErr)
+		}
+		dst = &net.UDPAddr{IP: allNodes, Zone: iface}
+		datagram = true
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.SetReadDeadline(time.Now()) })
+	defer stop()
+
+	id := uint16(rand.Uint32())
+	start := time.Now()
+	if _, err := conn.WriteTo(EchoRequest(true, id, 1), dst); err != nil {
+		return nil, err
+	}
+	conn.SetReadDeadline(start.Add(timeout))
+
+	var replies []Reply
+	seen := make(map[string]bool)
+	buf := make([]byte, 1500)
+	for {
+		n, from, err := conn.ReadFrom(buf)
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			return replies, ctx.Err()
+		}
+		if err != nil {
+			return replies, err
+		}
+
+		msg := buf[:n]
+		if len(msg) < 8 || msg[0] != icmpv6EchoReply || (!datagram && binary.BigEndian.Uint16(msg[4:]) != id) {
+			continue
+		}
+		ip := addrIP(from)
+		if ip == nil || seen[ip.String()] {
+			continue
+		}
+		seen[ip.String()] = true
+		replies = append(replies, Reply{IP: ip, RTT: time.Since(start)})
+	}
+}
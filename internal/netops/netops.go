@@ -0,0 +1,240 @@
+// Package netops puts what the scanner asks of the network and the
+// operating system (pinging, reverse DNS and local names, the neighbor
+// tables, ARP, link
+// speeds and running commands) behind small interfaces. Production code
+// uses System; tests of scanner logic use the fakes in netopstest instead
+// of a live network.
+package netops
+
+import (
+	"context"
+	"net"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"strconv"
+	"time"
+
+	"pingdisco.com/pingdisco/internal/localdns"
+	"pingdisco.com/pingdisco/internal/netinfo"
+)
+
+// Runner runs external commands.
+type Runner interface {
+	// Run runs name with args and returns its standard output. A non-zero
+	// exit status is reported as an error along with the output.
+	Run(ctx context.Context, name string, args ...string) ([]byte, error)
+}
+
+// Pinger sends ICMP echo requests.
+type Pinger interface {
+	// Ping reports whether host answered any of count echo requests within
+	// timeout each.
+	Ping(ctx context.Context, host string, count int, timeout time.Duration) bool
+}
+
+// RTTPinger is a Pinger that also times the replies.
+type RTTPinger interface {
+	Pinger
+	// PingRTT is Ping that also returns the round-trip time of the reply.
+	PingRTT(ctx context.Context, host string, count int, timeout time.Duration) (time.Duration, bool)
+}
+
+// PingRTT pings host with p and returns the round-trip time of the reply,
+// or zero when p cannot time replies.
+func PingRTT(ctx context.Context, p Pinger, host string, count int, timeout time.Duration) (time.Duration, bool) {
+	if rp, ok := p.(RTTPinger); ok {
+		return rp.PingRTT(ctx, host, count, timeout)
+	}
+	return 0, p.Ping(ctx, host, count, timeout)
+}
+
+// LinkPinger is a Pinger that can also ping every host of an IPv6 link at
+// once, since IPv6 subnets are far too large to sweep address by address.
+type LinkPinger interface {
+	Pinger
+	// PingLink sends an echo request to the all-nodes multicast address
+	// ff02::1 out of iface, from its address local, and returns the hosts
+	// that answered within timeout.
+	PingLink(ctx context.Context, iface string, local net.IP, timeout time.Duration) ([]Reply, error)
+}
+
+// Reply is an echo reply from a host.
+type Reply struct {
+	IP  net.IP
+	RTT time.Duration
+}
+
+// EchoSender sends single echo requests and returns every reply to each,
+// so that duplicate and late replies can be counted without reading the
+// output of the ping command.
+type EchoSender interface {
+	// SendEcho sends one echo request to ip and returns the round-trip
+	// times of the replies that arrived within timeout, none if the host
+	// did not answer.
+	SendEcho(ctx context.Context, ip net.IP, timeout time.Duration) ([]time.Duration, error)
+}
+
+// ReplyTime matches the round-trip time, in milliseconds, in a reply line
+// of ping output on Linux, macOS, busybox and Windows.
+var ReplyTime = regexp.MustCompile(`time[=<]([0-9.]+) ?ms`)
+
+// Resolver does reverse DNS lookups. *net.Resolver implements it.
+type Resolver interface {
+	LookupAddr(ctx context.Context, addr string) ([]string, error)
+}
+
+// LocalResolver names hosts of the local network that have no reverse DNS
+// entry by asking them directly, returning the name and the protocol that
+// gave it. localdns.Resolver implements it over mDNS and LLMNR.
+type LocalResolver interface {
+	LookupLocal(ctx context.Context, addr string) (name, source string)
+}
+
+// NeighborTable reads the ARP/neighbor table.
+type NeighborTable interface {
+	Neighbors() ([]netinfo.Neighbor, error)
+}
+
+// LinkReader reports the physical link behind an interface.
+type LinkReader interface {
+	Link(iface string) netinfo.Link
+}
+
+// Dialer opens TCP connections; *net.Dialer is one, and so are the
+// proxies of package proxy.
+type Dialer interface {
+	DialContext(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// Ops bundles the operations the scanner depends on.
+type Ops struct {
+	Runner    Runner
+	Pinger    Pinger
+	Resolver  Resolver
+	Neighbors NeighborTable
+	// Local names the hosts of directly attached subnets that reverse DNS
+	// does not; nil leaves them unnamed.
+	Local LocalResolver
+	// NDP is the IPv6 neighbor table; nil leaves IPv6 hosts to be found
+	// by multicast ping alone.
+	NDP NeighborTable
+	// ARP sweeps directly attached networks; nil disables ARP discovery.
+	ARP ARPScanner
+	// Links tells the scanner how fast a group's link is, so probes are
+	// paced on slow ones; nil never paces.
+	Links LinkReader
+	// Dialer opens the connections of TCP probes and port scans; nil
+	// connects directly.
+	Dialer Dialer
+	// Echo sends the echo requests of echo statistics where the output of
+	// the ping command cannot be relied on, as on Windows; nil runs ping.
+	Echo EchoSender
+}
+
+// System returns the operations backed by the real network and OS. Hosts
+// are pinged natively where ICMP sockets are available and with the ping
+// command elsewhere.
+func System() *Ops {
+	runner := ExecRunner{}
+	return &Ops{
+		Runner:    runner,
+		Pinger:    &ICMPPinger{Fallback: CommandPinger{Runner: runner}},
+		Resolver:  net.DefaultResolver,
+		Neighbors: SystemNeighbors{},
+		Local:     localdns.Resolver{},
+		NDP:       SystemNDP{},
+		ARP:       SystemARP{Neighbors: SystemNeighbors{}},
+		Links:     SystemLinks{},
+		Echo:      systemEcho,
+	}
+}
+
+// ExecRunner runs commands with os/exec.
+type ExecRunner struct{}
+
+// Run implements Runner.
+func (ExecRunner) Run(ctx context.Context, name string, args ...string) ([]byte, error) {
+	return exec.CommandContext(ctx, name, args...).Output()
+}
+
+// CommandPinger pings by running the system ping command.
+type CommandPinger struct {
+	Runner Runner
+}
+
+// Ping implements Pinger.
+func (p CommandPinger) Ping(ctx context.Context, host string, count int, timeout time.Duration) bool {
+	_, ok := p.PingRTT(ctx, host, count, timeout)
+	return ok
+}
+
+// PingRTT implements RTTPinger, reading the time of the first reply from
+// the command's output.
+func (p CommandPinger) PingRTT(ctx context.Context, host string, count int, timeout time.Duration) (time.Duration, bool) {
+	n := strconv.Itoa(max(count, 1))
+
+	var out []byte
+	var err error
+	if runtime.GOOS == "windows" {
+		ms := strconv.FormatInt(max(timeout.Milliseconds(), 1), 10)
+		out, err = p.Runner.Run(ctx, "ping", "-n", n, "-w", ms, host)
+	} else {
+		secs := strconv.FormatInt(max(int64(timeout.Round(time.Second)/time.Second), 1), 10)
+		out, err = p.Runner.Run(ctx, "ping", "-c", n, "-W", secs, host)
+	}
+	if err != nil {
+		return 0, false
+	}
+
+	var rtt time.Duration
+	if m := ReplyTime.FindSubmatch(out); m != nil {
+		if ms, err := strconv.ParseFloat(string(m[1]), 64); err == nil {
+			rtt = time.Duration(ms * float64(time.Millisecond))
+		}
+	}
+	return rtt, true
+}
+
+// SystemNeighbors reads the operating system's neighbor table.
+type SystemNeighbors struct{}
+
+// Neighbors implements NeighborTable.
+func (SystemNeighbors) Neighbors() ([]netinfo.Neighbor, error) {
+	return netinfo.Neighbors()
+}
+
+// SystemNDP reads the operating system's IPv6 neighbor table.
+type SystemNDP struct{}
+
+// Neighbors implements NeighborTable.
+func (SystemNDP) Neighbors() ([]netinfo.Neighbor, error) {
+	return netinfo.Neighbors6()
+}
+
+// SystemLinks reads links from the operating system.
+type SystemLinks struct{}
+
+// Link implements LinkReader.
+func (SystemLinks) Link(iface string) netinfo.Link {
+	return netinfo.LinkOf(iface)
+}
+
+// NeighborsOn returns the entries of t inside subnet, none if t is nil.
+func NeighborsOn(t NeighborTable, subnet *net.IPNet) []netinfo.Neighbor {
+	if t == nil {
+		return nil
+	}
+	all, err := t.Neighbors()
+	if err != nil {
+		return nil
+	}
+
+	var result []netinfo.Neighbor
+	for _, n := range all {
+		if subnet.Contains(n.IP) {
+			result = append(result, n)
+		}
+	}
+	return result
+}
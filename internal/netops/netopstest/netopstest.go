@@ -0,0 +1,164 @@
+// Package netopstest provides fake network operations for testing code
+// that takes a *netops.Ops.
+package netopstest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"pingdisco.com/pingdisco/internal/netinfo"
+	"pingdisco.com/pingdisco/internal/netops"
+)
+
+// New returns Ops made of empty fakes: no host answers, no name resolves,
+// the neighbor table is empty and every command fails. ARP requests are
+// answered by the complete entries of the neighbor table, which serves as
+// the NDP table too.
+func New() (*netops.Ops, *Pinger, *Resolver, *Neighbors, *Runner) {
+	p, r, n, c := &Pinger{}, &Resolver{}, &Neighbors{}, &Runner{}
+	return &netops.Ops{Runner: c, Pinger: p, Resolver: r, Neighbors: n, NDP: n, ARP: n}, p, r, n, c
+}
+
+// Pinger answers for the hosts in Up and records every host pinged.
+type Pinger struct {
+	mu    sync.Mutex
+	Up    map[string]bool
+	Calls []string
+}
+
+// Ping implements netops.Pinger.
+func (p *Pinger) Ping(_ context.Context, host string, _ int, _ time.Duration) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.Calls = append(p.Calls, host)
+	return p.Up[host]
+}
+
+// PingLink implements netops.LinkPinger, answering for the IPv6 hosts in
+// Up.
+func (p *Pinger) PingLink(_ context.Context, _ string, _ net.IP, _ time.Duration) ([]netops.Reply, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.Calls = append(p.Calls, "ff02::1")
+	var replies []netops.Reply
+	for host, up := range p.Up {
+		if ip := net.ParseIP(host); up && ip != nil && ip.To4() == nil {
+			replies = append(replies, netops.Reply{IP: ip, RTT: time.Millisecond})
+		}
+	}
+	return replies, nil
+}
+
+// SetUp marks hosts as answering.
+func (p *Pinger) SetUp(hosts ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.Up == nil {
+		p.Up = make(map[string]bool)
+	}
+	for _, h := range hosts {
+		p.Up[h] = true
+	}
+}
+
+// Resolver answers reverse lookups from Names, keyed by address.
+type Resolver struct {
+	mu    sync.Mutex
+	Names map[string][]string
+}
+
+// LookupAddr implements netops.Resolver.
+func (r *Resolver) LookupAddr(_ context.Context, addr string) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	names, ok := r.Names[addr]
+	if !ok {
+		return nil, fmt.Errorf("lookup %s: no such host", addr)
+	}
+	return names, nil
+}
+
+// Set adds a reverse DNS entry.
+func (r *Resolver) Set(addr string, names ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.Names == nil {
+		r.Names = make(map[string][]string)
+	}
+	r.Names[addr] = names
+}
+
+// Neighbors returns Table, or Err if set.
+type Neighbors struct {
+	Table []netinfo.Neighbor
+	Err   error
+}
+
+// Neighbors implements netops.NeighborTable.
+func (n *Neighbors) Neighbors() ([]netinfo.Neighbor, error) {
+	return n.Table, n.Err
+}
+
+// ARPScan implements netops.ARPScanner, answering for the complete entries
+// of Table among addrs.
+func (n *Neighbors) ARPScan(_ context.Context, _ string, _ net.IP, addrs []net.IP, _ time.Duration) ([]netinfo.Neighbor, error) {
+	if n.Err != nil {
+		return nil, n.Err
+	}
+	var found []netinfo.Neighbor
+	for _, e := range n.Table {
+		for _, ip := range addrs {
+			if e.Complete && e.IP.Equal(ip) {
+				found = append(found, e)
+			}
+		}
+	}
+	return found, nil
+}
+
+// ErrNoCommand is returned by Runner for commands without a canned result.
+var ErrNoCommand = errors.New("netopstest: no result for command")
+
+// Result is the canned outcome of a command.
+type Result struct {
+	Output []byte
+	Err    error
+}
+
+// Runner returns canned results keyed by the command line, name and
+// arguments joined by spaces, and records every command run.
+type Runner struct {
+	mu      sync.Mutex
+	Results map[string]Result
+	Calls   []string
+}
+
+// Run implements netops.Runner.
+func (r *Runner) Run(_ context.Context, name string, args ...string) ([]byte, error) {
+	line := strings.Join(append([]string{name}, args...), " ")
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Calls = append(r.Calls, line)
+
+	res, ok := r.Results[line]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNoCommand, line)
+	}
+	return res.Output, res.Err
+}
+
+// Set registers the output of a command line.
+func (r *Runner) Set(line string, output string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.Results == nil {
+		r.Results = make(map[string]Result)
+	}
+	r.Results[line] = Result{Output: []byte(output), Err: err}
+}
@@ -0,0 +1,54 @@
+package netops
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// TCPPinger stands in for ping where ICMP cannot reach, such as through a
+// proxy: a host is up if one of Ports accepts or actively refuses a
+// connection made with Dialer. The round-trip time is that of the
+// connection, through the proxy if there is one.
+type TCPPinger struct {
+	Dialer Dialer
+	Ports  []int
+}
+
+// Ping implements Pinger.
+func (p TCPPinger) Ping(ctx context.Context, host string, count int, timeout time.Duration) bool {
+	_, ok := p.PingRTT(ctx, host, count, timeout)
+	return ok
+}
+
+// PingRTT implements RTTPinger. The ports are tried at once; count is
+// ignored, each port being a try of its own.
+func (p TCPPinger) PingRTT(ctx context.Context, host string, count int, timeout time.Duration) (time.Duration, bool) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	type result struct {
+		rtt time.Duration
+		up  bool
+	}
+	results := make(chan result, len(p.Ports))
+	for _, port := range p.Ports {
+		go func(port int) {
+			start := time.Now()
+			conn, err := p.Dialer.DialContext(ctx, "tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+			if err == nil {
+				conn.Close()
+			}
+			results <- result{time.Since(start), err == nil || errors.Is(err, syscall.ECONNREFUSED)}
+		}(port)
+	}
+	for range p.Ports {
+		if r := <-results; r.up {
+			return r.rtt, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,125 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config describes one notifier and its delivery policy, as read from a
+// notifier configuration file.
+type Config struct {
+	// Type is "webhook", "exec" or "desktop".
+	Type    string `json:"type"`
+	URL     string `json:"url,omitempty"`
+	Command string `json:"command,omitempty"`
+	// Format is the message format of a webhook: "json" (the default),
+	// "slack", "discord" or "ntfy".
+	Format string `json:"format,omitempty"`
+
+	// QuietHours such as "22:00-07:00" hold events back overnight.
+	QuietHours string `json:"quiet_hours,omitempty"`
+	// RateLimit such as "10/1h" caps deliveries per period.
+	RateLimit string `json:"rate_limit,omitempty"`
+	// Digest such as "5m" batches events arriving within the window.
+	Digest string `json:"digest,omitempty"`
+}
+
+// LoadConfig reads a JSON array of notifier configurations from path.
+func LoadConfig(path string) ([]Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var cfgs []Config
+	if err := json.Unmarshal(data, &cfgs); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfgs, nil
+}
+
+// Build creates the notifier described by c, wrapped in a Throttle when
+// it has a delivery policy.
+func (c Config) Build(onError func(error)) (Notifier, error) {
+	var n Notifier
+	switch c.Type {
+	case "webhook":
+		if c.URL == "" {
+			return nil, fmt.Errorf("webhook notifier needs a url")
+		}
+		if err := CheckFormat(c.Format); err != nil {
+			return nil, err
+		}
+		n = &Webhook{URL: c.URL, Format: c.Format}
+	case "exec":
+		if c.Command == "" {
+			return nil, fmt.Errorf("exec notifier needs a command")
+		}
+		n = &Command{Command: c.Command}
+	case "desktop":
+		n = &Desktop{}
+	default:
+		return nil, fmt.Errorf("unknown notifier type %q", c.Type)
+	}
+
+	if c.QuietHours == "" && c.RateLimit == "" && c.Digest == "" {
+		return n, nil
+	}
+
+	t := &Throttle{Next: n, OnError: onError}
+
+	if c.QuietHours != "" {
+		q, err := ParseQuietHours(c.QuietHours)
+		if err != nil {
+			return nil, err
+		}
+		t.Quiet = q
+	}
+
+	if c.RateLimit != "" {
+		rate, per, err := parseRate(c.RateLimit)
+		if err != nil {
+			return nil, err
+		}
+		t.Rate, t.Per = rate, per
+	}
+
+	if c.Digest != "" {
+		d, err := time.ParseDuration(c.Digest)
+		if err != nil {
+			return nil, fmt.Errorf("digest %q: %w", c.Digest, err)
+		}
+		t.Digest = d
+	}
+
+	return t, nil
+}
+
+func parseRate(s string) (int, time.Duration, error) {
+	count, period, ok := strings.Cut(s, "/")
+	if !ok {
+		return 0, 0, fmt.Errorf("rate limit %q: want COUNT/PERIOD, e.g. 10/1h", s)
+	}
+
+	n, err := strconv.Atoi(count)
+	if err != nil || n <= 0 {
+		return 0, 0, fmt.Errorf("rate limit %q: invalid count", s)
+	}
+	per, err := time.ParseDuration(period)
+	if err != nil || per <= 0 {
+		return 0, 0, fmt.Errorf("rate limit %q: invalid period", s)
+	}
+
+	return n, per, nil
+}
+
+// Closer is implemented by notifiers that hold events back and need a
+// chance to deliver them before the program exits.
+type Closer interface {
+	Close(ctx context.Context) error
+}
@@ -0,0 +1,64 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// DeviceNew is sent when a device is seen for the first time.
+const DeviceNew = "device_new"
+
+// toastScript shows a Windows toast notification with the text in
+// PINGDISCO_TITLE and PINGDISCO_MESSAGE. Toasts need a registered
+// application ID; PowerShell's own is borrowed.
+const toastScript = `
+[Windows.UI.Notifications.ToastNotificationManager, Windows.UI.Notifications, ContentType = WindowsRuntime] > $null
+$t = [Windows.UI.Notifications.ToastNotificationManager]::GetTemplateContent([Windows.UI.Notifications.ToastTemplateType]::ToastText02)
+$x = $t.GetElementsByTagName('text')
+$x.Item(0).AppendChild($t.CreateTextNode($env:PINGDISCO_TITLE)) > $null
+$x.Item(1).AppendChild($t.CreateTextNode($env:PINGDISCO_MESSAGE)) > $null
+$id = '{1AC14E77-02E7-4E5D-B744-2EB1AE5198B7}\WindowsPowerShell\v1.0\powershell.exe'
+[Windows.UI.Notifications.ToastNotificationManager]::CreateToastNotifier($id).Show([Windows.UI.Notifications.ToastNotification]::new($t))
+`
+
+// Desktop pops up a native notification: a toast on Windows, Notification
+// Center on macOS and notify-send elsewhere. Text is passed as arguments or
+// environment variables, never inside a script, so device names cannot
+// inject commands.
+type Desktop struct {
+	// Title defaults to "pingdisco".
+	Title string
+}
+
+// Notify implements Notifier.
+func (d *Desktop) Notify(ctx context.Context, ev Event) error {
+	title := d.Title
+	if title == "" {
+		title = "pingdisco"
+	}
+
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "windows":
+		cmd = exec.CommandContext(ctx, "powershell", "-NoProfile", "-NonInteractive", "-Command", toastScript)
+		cmd.Env = append(os.Environ(), "PINGDISCO_TITLE="+title, "PINGDISCO_MESSAGE="+ev.Message)
+	case "darwin":
+		cmd = exec.CommandContext(ctx, "osascript",
+			"-e", "on run argv",
+			"-e", "display notification (item 2 of argv) with title (item 1 of argv)",
+			"-e", "end run",
+			title, ev.Message)
+	default:
+		cmd = exec.CommandContext(ctx, "notify-send", "--app-name=pingdisco", title, ev.Message)
+	}
+
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("desktop notification failed: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package notify
+
+import "time"
+
+// ScanChanged is sent once for each scan of scan --watch that differs from
+// the scan before it, with the Diff, so automation can apply the changes
+// instead of reconciling whole snapshots.
+const ScanChanged = "scan_changed"
+
+// Diff is how the devices of one scan differ from those of another.
+type Diff struct {
+	From    DiffScan `json:"from"`
+	To      DiffScan `json:"to"`
+	Changes []Change `json:"changes"`
+}
+
+// DiffScan identifies a scan of a Diff: by its ID when it was saved, and
+// by the time it started.
+type DiffScan struct {
+	ID        int64     `json:"id,omitempty"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+// Change is one device changing between the scans of a Diff.
+type Change struct {
+	// Kind is one of the kinds of change of package timeline:
+	// "appeared", "returned", "left", "moved", "renamed" or "replaced".
+	Kind   string  `json:"kind"`
+	Device *Device `json:"device"`
+	// PreviousIP is the address a moved device had.
+	PreviousIP string `json:"previous_ip,omitempty"`
+	// PreviousHostname is the name a renamed device had.
+	PreviousHostname string `json:"previous_hostname,omitempty"`
+	// PreviousMAC is the MAC address of the device a replaced one
+	// replaced.
+	PreviousMAC string `json:"previous_mac,omitempty"`
+}
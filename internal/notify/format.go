@@ -0,0 +1,108 @@
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Webhook formats.
+const (
+	// FormatJSON posts the Event itself.
+	FormatJSON = "json"
+	// FormatSlack posts a Slack incoming webhook message.
+	FormatSlack = "slack"
+	// FormatDiscord posts a Discord webhook message.
+	FormatDiscord = "discord"
+	// FormatNtfy publishes the message to an ntfy topic, with the event
+	// type as title and tag.
+	FormatNtfy = "ntfy"
+)
+
+// Formats lists the webhook formats, for help and error messages.
+var Formats = []string{FormatJSON, FormatSlack, FormatDiscord, FormatNtfy}
+
+// discordLimit is the most characters a Discord message may hold.
+const discordLimit = 2000
+
+// titles name the event types in chat messages and push notifications.
+var titles = map[string]string{
+	DeviceNew:       "New device",
+	DeviceOnline:    "Device online",
+	DeviceOffline:   "Device offline",
+	AddressConflict: "Address conflict",
+	ScanChanged:     "Network changed",
+	CheckFailed:     "Check failing",
+	CheckPassed:     "Check passing",
+	Anomaly:         "Unusual activity",
+	DigestEvent:     "Digest",
+}
+
+// ntfyTags are the ntfy tags, shown as emoji, of the event types.
+var ntfyTags = map[string]string{
+	DeviceNew:       "new",
+	DeviceOffline:   "red_circle",
+	DeviceOnline:    "green_circle",
+	AddressConflict: "warning",
+	CheckFailed:     "warning",
+	Anomaly:         "eyes",
+}
+
+// urgent event types are pushed at high priority.
+var urgent = map[string]bool{DeviceNew: true, AddressConflict: true}
+
+// CheckFormat returns an error unless format is "" or one of Formats.
+func CheckFormat(format string) error {
+	if format == "" {
+		return nil
+	}
+	for _, f := range Formats {
+		if format == f {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown webhook format %q; use %s", format, strings.Join(Formats, ", "))
+}
+
+// Title names the type of ev, e.g. "Device offline".
+func Title(ev Event) string {
+	if t, ok := titles[ev.Type]; ok {
+		return t
+	}
+	return ev.Type
+}
+
+// encode returns the request body and headers posting ev in format.
+func encode(format string, ev Event) ([]byte, http.Header, error) {
+	header := http.Header{"Content-Type": {"application/json"}}
+	var v any
+	switch format {
+	case "", FormatJSON:
+		v = ev
+	case FormatSlack:
+		v = map[string]string{"text": "*" + Title(ev) + "*\n" + ev.Message}
+	case FormatDiscord:
+		text := "**" + Title(ev) + "**\n" + ev.Message
+		if r := []rune(text); len(r) > discordLimit {
+			text = string(r[:discordLimit-1]) + "…"
+		}
+		v = map[string]string{"username": "pingdisco", "content": text}
+	case FormatNtfy:
+		header = http.Header{
+			"Content-Type": {"text/plain; charset=utf-8"},
+			"Title":        {"pingdisco: " + Title(ev)},
+		}
+		if tag, ok := ntfyTags[ev.Type]; ok {
+			header.Set("Tags", tag)
+		}
+		if urgent[ev.Type] {
+			header.Set("Priority", "high")
+		}
+		return []byte(ev.Message), header, nil
+	default:
+		return nil, nil, CheckFormat(format)
+	}
+	body, err := json.Marshal(v)
+	return body, header, err
+}
@@ -0,0 +1,161 @@
+// Package notify delivers device events to external systems.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"pingdisco.com/pingdisco/internal/timefmt"
+)
+
+// Event types.
+const (
+	DeviceOnline  = "device_online"
+	DeviceOffline = "device_offline"
+	CheckFailed   = "check_failed"
+	CheckPassed   = "check_passed"
+	// Anomaly is an unusual presence pattern found by watch --sweep; Host
+	// is empty when it concerns the network as a whole.
+	Anomaly = "anomaly"
+	// AddressConflict is an address answering from another MAC address
+	// than the device that held it in the scan before.
+	AddressConflict = "address_conflict"
+)
+
+// Event describes something that happened to a device. Digest events
+// carry the events they bundle.
+type Event struct {
+	Type    string    `json:"type"`
+	Host    string    `json:"host,omitempty"`
+	Time    time.Time `json:"time"`
+	Message string    `json:"message"`
+	Events  []Event   `json:"events,omitempty"`
+	// Maintenance names the maintenance window the event happened in.
+	Maintenance string `json:"maintenance,omitempty"`
+	// Device is the device the event is about, when a scan found it.
+	Device *Device `json:"device,omitempty"`
+	// Previous is the device that held the address of an AddressConflict
+	// event.
+	Previous *Device `json:"previous,omitempty"`
+	// Diff holds the changes of a ScanChanged event.
+	Diff *Diff `json:"diff,omitempty"`
+}
+
+// Device identifies a device in an event.
+type Device struct {
+	IP       string `json:"ip"`
+	MAC      string `json:"mac,omitempty"`
+	Hostname string `json:"hostname,omitempty"`
+}
+
+// Notifier delivers events.
+type Notifier interface {
+	Notify(ctx context.Context, ev Event) error
+}
+
+// Webhook POSTs each event to URL, as JSON or in the message format of
+// a chat or push service.
+type Webhook struct {
+	URL string
+	// Format is one of the Format constants; "" is FormatJSON.
+	Format string
+	Client *http.Client
+}
+
+// Notify implements Notifier.
+func (w *Webhook) Notify(ctx context.Context, ev Event) error {
+	body, header, err := encode(w.Format, ev)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	client := w.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook %s returned %s", w.URL, resp.Status)
+	}
+	return nil
+}
+
+// Command runs a shell command for each event, passing the event in
+// PINGDISCO_EVENT, PINGDISCO_HOST, PINGDISCO_TIME and PINGDISCO_MESSAGE.
+type Command struct {
+	Command string
+}
+
+// Notify implements Notifier.
+func (c *Command) Notify(ctx context.Context, ev Event) error {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", c.Command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", c.Command)
+	}
+
+	cmd.Env = append(os.Environ(),
+		"PINGDISCO_EVENT="+ev.Type,
+		"PINGDISCO_HOST="+ev.Host,
+		"PINGDISCO_TIME="+timefmt.Format(ev.Time),
+		"PINGDISCO_MESSAGE="+ev.Message,
+	)
+
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("notify command failed: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// Multi sends every event to all of its notifiers and returns the first
+// error encountered.
+type Multi []Notifier
+
+// Notify implements Notifier.
+func (m Multi) Notify(ctx context.Context, ev Event) error {
+	var first error
+	for _, n := range m {
+		if err := n.Notify(ctx, ev); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// Close implements Closer by closing every notifier that holds events.
+func (m Multi) Close(ctx context.Context) error {
+	var first error
+	for _, n := range m {
+		if c, ok := n.(Closer); ok {
+			if err := c.Close(ctx); err != nil && first == nil {
+				first = err
+			}
+		}
+	}
+	return first
+}
@@ -0,0 +1,195 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"pingdisco.com/pingdisco/internal/timefmt"
+)
+
+// DigestEvent is the type of events that bundle several held-back events.
+const DigestEvent = "digest"
+
+// QuietHours is a daily window, in local time, during which events are
+// held back. The window may wrap around midnight.
+type QuietHours struct {
+	Start, End timefmt.Clock
+}
+
+// ParseQuietHours parses a window such as "22:00-07:00".
+func ParseQuietHours(s string) (*QuietHours, error) {
+	from, to, ok := strings.Cut(s, "-")
+	if !ok {
+		return nil, fmt.Errorf("quiet hours %q: want HH:MM-HH:MM", s)
+	}
+
+	start, err := timefmt.ParseClock(from)
+	if err != nil {
+		return nil, fmt.Errorf("quiet hours %q: %w", s, err)
+	}
+	end, err := timefmt.ParseClock(to)
+	if err != nil {
+		return nil, fmt.Errorf("quiet hours %q: %w", s, err)
+	}
+
+	return &QuietHours{Start: start, End: end}, nil
+}
+
+// Active reports whether t falls inside the window.
+func (q *QuietHours) Active(t time.Time) bool {
+	now := timefmt.ClockOf(t)
+	if q.Start <= q.End {
+		return now >= q.Start && now < q.End
+	}
+	return now >= q.Start || now < q.End
+}
+
+// NextEnd returns the first end of the window after t.
+func (q *QuietHours) NextEnd(t time.Time) time.Time {
+	end := q.End.On(t)
+	if !end.After(t) {
+		end = q.End.On(t.AddDate(0, 0, 1))
+	}
+	return end
+}
+
+// Throttle wraps a notifier with quiet hours, a rate limit and digest
+// batching. Events that cannot be delivered straight away are held and
+// later sent to Next as a single digest event.
+type Throttle struct {
+	Next Notifier
+	// Quiet holds all events back during a daily window.
+	Quiet *QuietHours
+	// Rate is the maximum number of deliveries per Per; zero disables the
+	// limit.
+	Rate int
+	Per  time.Duration
+	// Digest batches all events arriving within this window.
+	Digest time.Duration
+	// OnError receives errors from deliveries made in the background.
+	OnError func(error)
+
+	mu      sync.Mutex
+	pending []Event
+	timer   *time.Timer
+	sent    []time.Time
+}
+
+// Notify implements Notifier.
+func (t *Throttle) Notify(ctx context.Context, ev Event) error {
+	t.mu.Lock()
+
+	now := time.Now()
+	if len(t.pending) > 0 || !t.holdUntilLocked(now).IsZero() || t.Digest > 0 {
+		t.pending = append(t.pending, ev)
+		t.scheduleLocked(now)
+		t.mu.Unlock()
+		return nil
+	}
+
+	t.sent = append(t.sent, now)
+	t.mu.Unlock()
+
+	return t.Next.Notify(ctx, ev)
+}
+
+// Close delivers any held events immediately, ignoring quiet hours and the
+// rate limit.
+func (t *Throttle) Close(ctx context.Context) error {
+	t.mu.Lock()
+	if t.timer != nil {
+		t.timer.Stop()
+		t.timer = nil
+	}
+	events := t.pending
+	t.pending = nil
+	t.mu.Unlock()
+
+	if len(events) == 0 {
+		return nil
+	}
+	return t.Next.Notify(ctx, digest(events))
+}
+
+// holdUntilLocked returns when quiet hours or the rate limit stop blocking
+// deliveries, or the zero time if nothing blocks them now.
+func (t *Throttle) holdUntilLocked(now time.Time) time.Time {
+	if t.Quiet != nil && t.Quiet.Active(now) {
+		return t.Quiet.NextEnd(now)
+	}
+
+	if t.Rate > 0 && t.Per > 0 {
+		cutoff := now.Add(-t.Per)
+		i := 0
+		for i < len(t.sent) && !t.sent[i].After(cutoff) {
+			i++
+		}
+		t.sent = t.sent[i:]
+
+		if len(t.sent) >= t.Rate {
+			return t.sent[0].Add(t.Per)
+		}
+	}
+
+	return time.Time{}
+}
+
+func (t *Throttle) scheduleLocked(now time.Time) {
+	if t.timer != nil {
+		return
+	}
+
+	at := t.holdUntilLocked(now)
+	if at.IsZero() {
+		at = now.Add(t.Digest)
+	}
+	t.timer = time.AfterFunc(at.Sub(now), t.flush)
+}
+
+func (t *Throttle) flush() {
+	t.mu.Lock()
+	t.timer = nil
+
+	now := time.Now()
+	if !t.holdUntilLocked(now).IsZero() {
+		t.scheduleLocked(now)
+		t.mu.Unlock()
+		return
+	}
+
+	events := t.pending
+	t.pending = nil
+	if len(events) > 0 {
+		t.sent = append(t.sent, now)
+	}
+	t.mu.Unlock()
+
+	if len(events) == 0 {
+		return
+	}
+
+	ev := events[0]
+	if len(events) > 1 {
+		ev = digest(events)
+	}
+	if err := t.Next.Notify(context.Background(), ev); err != nil && t.OnError != nil {
+		t.OnError(err)
+	}
+}
+
+func digest(events []Event) Event {
+	lines := make([]string, len(events))
+	for i, ev := range events {
+		lines[i] = timefmt.Format(ev.Time) + " " + ev.Message
+	}
+
+	return Event{
+		Type:    DigestEvent,
+		Time:    time.Now(),
+		Message: fmt.Sprintf("%d events:\n%s", len(events), strings.Join(lines, "\n")),
+		Events:  events,
+	}
+}
@@ -0,0 +1,195 @@
+// Package numfmt formats the numbers pingdisco prints for people:
+// round-trip times in one display unit, and counts, decimals and byte sizes
+// with the digit grouping and decimal mark of one display locale, so that
+// reports read naturally wherever they are shared. Machine-readable output
+// (JSON, CSV and the agent API) is not affected; it always carries plain
+// numbers and milliseconds.
+package numfmt
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Round-trip time units.
+const (
+	Milliseconds = "ms"
+	Microseconds = "µs"
+)
+
+var unit = Milliseconds
+
+// SetRTTUnit sets the unit round-trip times are shown in: "ms" (the
+// default) or "us". It is meant to be called once at startup.
+func SetRTTUnit(name string) error {
+	switch strings.ToLower(name) {
+	case "", "ms":
+		unit = Milliseconds
+	case "us", "µs", "μs":
+		unit = Microseconds
+	default:
+		return fmt.Errorf("unknown RTT unit %q: want ms or us", name)
+	}
+	return nil
+}
+
+// Unit returns the display unit of round-trip times.
+func Unit() string {
+	return unit
+}
+
+// RTT returns d in the display unit, e.g. "1.2 ms" or "1,234 µs".
+func RTT(d time.Duration) string {
+	return RTTValue(d) + " " + unit
+}
+
+// RTTValue is RTT without the unit, for lists of times sharing one.
+func RTTValue(d time.Duration) string {
+	if unit == Microseconds {
+		return Int(d.Microseconds())
+	}
+	return Float(float64(d.Microseconds())/1000, 1)
+}
+
+// separators are the digit group separator and decimal mark of a locale.
+type separators struct {
+	group   string
+	decimal string
+}
+
+// plain groups no digits, so numbers can be copied into other tools.
+var plain = separators{"", "."}
+
+// locales maps languages, and the regions that differ from their
+// language, to their separators.
+var locales = map[string]separators{
+	"en":    {",", "."},
+	"ja":    {",", "."},
+	"zh":    {",", "."},
+	"ko":    {",", "."},
+	"de":    {".", ","},
+	"es":    {".", ","},
+	"it":    {".", ","},
+	"nl":    {".", ","},
+	"pt":    {".", ","},
+	"da":    {".", ","},
+	"id":    {".", ","},
+	"tr":    {".", ","},
+	"fr":    {"\u202f", ","},
+	"sv":    {"\u00a0", ","},
+	"nb":    {"\u00a0", ","},
+	"no":    {"\u00a0", ","},
+	"fi":    {"\u00a0", ","},
+	"cs":    {"\u00a0", ","},
+	"pl":    {"\u00a0", ","},
+	"ru":    {"\u00a0", ","},
+	"uk":    {"\u00a0", ","},
+	"de-ch": {"’", "."},
+	"fr-ch": {"\u202f", "."},
+	"pt-br": {".", ","},
+}
+
+var sep = plain
+
+// SetNumberFormat sets the locale numbers are shown in: "plain" or "" for
+// ungrouped digits and a decimal point (the default), a language with an
+// optional region such as "en", "de" or "de_CH", or "auto" for the locale
+// of the environment (LC_ALL, LC_NUMERIC or LANG). It is meant to be
+// called once at startup.
+func SetNumberFormat(name string) error {
+	switch strings.ToLower(name) {
+	case "", "plain", "c", "posix":
+		sep = plain
+		return nil
+	case "auto":
+		sep = plain
+		for _, v := range []string{"LC_ALL", "LC_NUMERIC", "LANG"} {
+			if env := os.Getenv(v); env != "" {
+				if s, ok := lookup(env); ok {
+					sep = s
+				}
+				break
+			}
+		}
+		return nil
+	}
+
+	s, ok := lookup(name)
+	if !ok {
+		return fmt.Errorf("unknown number format %q: want plain, auto or a language such as en or de_CH", name)
+	}
+	sep = s
+	return nil
+}
+
+// lookup finds the separators of a locale name such as "de_CH.UTF-8".
+func lookup(name string) (separators, bool) {
+	name, _, _ = strings.Cut(name, ".")
+	name, _, _ = strings.Cut(name, "@")
+	name = strings.ToLower(strings.ReplaceAll(name, "_", "-"))
+	if name == "c" || name == "posix" {
+		return plain, true
+	}
+	if s, ok := locales[name]; ok {
+		return s, true
+	}
+	lang, _, _ := strings.Cut(name, "-")
+	s, ok := locales[lang]
+	return s, ok
+}
+
+// Int returns n with its digits grouped.
+func Int[T ~int | ~int64](n T) string {
+	return group(strconv.FormatInt(int64(n), 10))
+}
+
+// Float returns v with prec decimals, its digits grouped.
+func Float(v float64, prec int) string {
+	s := strconv.FormatFloat(v, 'f', prec, 64)
+	whole, frac, ok := strings.Cut(s, ".")
+	whole = group(whole)
+	if !ok {
+		return whole
+	}
+	return whole + sep.decimal + frac
+}
+
+// group inserts the group separator every three digits of the integer s.
+func group(s string) string {
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+	if sep.group == "" || len(s) <= 3 {
+		return sign + s
+	}
+	var b strings.Builder
+	b.WriteString(sign)
+	for i, r := range s {
+		if i > 0 && (len(s)-i)%3 == 0 {
+			b.WriteString(sep.group)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// Bytes returns n in bytes or binary multiples, e.g. "512 B" or
+// "3.2 MiB".
+func Bytes(n int64) string {
+	if n < 1024 && n > -1024 {
+		return Int(n) + " B"
+	}
+	v := float64(n)
+	for _, u := range []string{"KiB", "MiB", "GiB", "TiB"} {
+		v /= 1024
+		if math.Abs(v) < 1024 || u == "TiB" {
+			return Float(v, 1) + " " + u
+		}
+	}
+	return ""
+}
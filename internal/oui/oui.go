@@ -0,0 +1,56 @@
+// Package oui names the vendor of a network interface from the first three
+// bytes of its MAC address, the Organizationally Unique Identifier (OUI)
+// the IEEE assigned to the manufacturer. The embedded table covers the
+// vendors common on home and office networks, not the whole registry.
+package oui
+
+import (
+	"bufio"
+	_ "embed"
+	"encoding/hex"
+	"net"
+	"strings"
+	"sync"
+)
+
+//go:embed oui.txt
+var table string
+
+var (
+	once    sync.Once
+	vendors map[[3]byte]string
+)
+
+func load() {
+	vendors = make(map[[3]byte]string)
+	scanner := bufio.NewScanner(strings.NewReader(table))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		prefix, vendor, ok := strings.Cut(line, " ")
+		raw, err := hex.DecodeString(prefix)
+		if !ok || err != nil || len(raw) != 3 {
+			continue
+		}
+		vendors[[3]byte(raw)] = vendor
+	}
+}
+
+// Vendor returns the vendor that mac was assigned to, or "" if it is not
+// in the table.
+func Vendor(mac net.HardwareAddr) string {
+	if len(mac) < 3 {
+		return ""
+	}
+	once.Do(load)
+	return vendors[[3]byte(mac[:3])]
+}
+
+// Local reports whether mac is locally administered rather than assigned
+// by a vendor: randomized addresses of phones and laptops, virtual
+// machines and containers.
+func Local(mac net.HardwareAddr) bool {
+	return len(mac) > 0 && mac[0]&0x02 != 0
+}
@@ -0,0 +1,387 @@
+// Package overlay names the peers of overlay VPNs, Tailscale and ZeroTier,
+// whose addresses reverse DNS rarely knows. Their local clients are asked
+// through their command line tools: tailscale status lists every peer of
+// the tailnet with its name and OS, and zerotier-cli lists the joined
+// networks, whose members are told apart by the node ID ZeroTier encodes
+// in their MAC addresses.
+package overlay
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"pingdisco.com/pingdisco/internal/device"
+	"pingdisco.com/pingdisco/internal/netops"
+)
+
+// Timeout bounds each query of a local client.
+const Timeout = 3 * time.Second
+
+// Peer is a member of an overlay network.
+type Peer struct {
+	IPs []net.IP
+	// Name is the peer's MagicDNS name, failing that its host name.
+	Name string
+	OS   string
+	// Self is the peer of this machine.
+	Self bool
+}
+
+// Network is a ZeroTier network joined by this machine.
+type Network struct {
+	ID        uint64
+	Name      string
+	Interface string
+	Subnets   []*net.IPNet
+}
+
+// Directory is what the local overlay clients know.
+type Directory struct {
+	// Tailnet names the tailnet, if Tailscale is up.
+	Tailnet string
+	Peers   []Peer
+	// TailscaleInterface is the interface Tailscale traffic goes through,
+	// if known.
+	TailscaleInterface string
+	Networks           []Network
+	// Versions holds the ZeroTier version of the nodes this one has
+	// talked to, by node ID.
+	Versions map[string]string
+
+	byIP map[string]*Peer
+}
+
+// Load asks the local Tailscale and ZeroTier clients for their peers and
+// networks. Clients that are not installed, not running or not
+// permitted are left out; Load returns nil if none answers.
+func Load(ctx context.Context, r netops.Runner) *Directory {
+	d := &Directory{Versions: make(map[string]string)}
+	found := false
+
+	if out, err := run(ctx, r, "tailscale", "status", "--json"); err == nil && d.parseTailscale(out) == nil {
+		found = true
+	}
+	if out, err := run(ctx, r, "zerotier-cli", "-j", "listnetworks"); err == nil && d.parseZeroTierNetworks(out) == nil {
+		found = true
+		if out, err := run(ctx, r, "zerotier-cli", "-j", "listpeers"); err == nil {
+			d.parseZeroTierPeers(out)
+		}
+	}
+	if !found {
+		return nil
+	}
+	d.index()
+	return d
+}
+
+func run(ctx context.Context, r netops.Runner, name string, args ...string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, Timeout)
+	defer cancel()
+	return r.Run(ctx, name, args...)
+}
+
+// Kinds of overlay, as Describe and Kind name them.
+const (
+	Tailscale = "Tailscale"
+	ZeroTier  = "ZeroTier"
+)
+
+// Kind returns the overlay behind the interface named iface, or "".
+func (d *Directory) Kind(iface string) string {
+	if d == nil {
+		return ""
+	}
+	if iface != "" && iface == d.TailscaleInterface {
+		return Tailscale
+	}
+	for _, n := range d.Networks {
+		if n.Interface == iface {
+			return ZeroTier
+		}
+	}
+	return ""
+}
+
+// Describe names the overlay network behind the interface named iface,
+// e.g. "ZeroTier network home-lab", or returns "".
+func (d *Directory) Describe(iface string) string {
+	switch d.Kind(iface) {
+	case Tailscale:
+		if d.Tailnet != "" {
+			return "Tailscale tailnet " + d.Tailnet
+		}
+		return "Tailscale"
+	case ZeroTier:
+		for _, n := range d.Networks {
+			if n.Interface == iface {
+				return "ZeroTier network " + n.describe()
+			}
+		}
+	}
+	return ""
+}
+
+func (n Network) describe() string {
+	if n.Name != "" {
+		return n.Name
+	}
+	return fmt.Sprintf("%016x", n.ID)
+}
+
+// Lookup returns the Tailscale peer with address ip.
+func (d *Directory) Lookup(ip net.IP) (Peer, bool) {
+	if d == nil {
+		return Peer{}, false
+	}
+	p, ok := d.byIP[ip.String()]
+	if !ok {
+		return Peer{}, false
+	}
+	return *p, true
+}
+
+// Annotate adds what the overlay clients know about dev: the name and OS
+// of a Tailscale peer, or the ZeroTier network and node ID of a member
+// found by MAC address. It reports whether it added anything.
+func (d *Directory) Annotate(dev *device.Device) bool {
+	if d == nil {
+		return false
+	}
+	ip := dev.IP()
+	if p, ok := d.Lookup(ip); ok {
+		network := Tailscale
+		if d.Tailnet != "" {
+			network += " " + d.Tailnet
+		}
+		dev.AddName(p.Name, device.SourceTailscale)
+		dev.Set(device.AttrOverlayNetwork, network)
+		dev.Identify(device.FieldOS, p.OS, device.SourceTailscale, device.SourceConfidence(device.SourceTailscale))
+		dev.AddSource(device.SourceTailscale)
+		return true
+	}
+	if dev.MAC == nil {
+		return false
+	}
+	for _, n := range d.Networks {
+		if !n.contains(ip) {
+			continue
+		}
+		node, ok := nodeFromMAC(n.ID, dev.MAC)
+		if !ok {
+			continue
+		}
+		dev.Set(device.AttrOverlayNetwork, ZeroTier+" "+n.describe())
+		dev.Set(device.AttrOverlayNode, node)
+		if v := d.Versions[node]; v != "" {
+			dev.Set(device.AttrOverlayVersion, v)
+		}
+		dev.AddSource(device.SourceZeroTier)
+		return true
+	}
+	return false
+}
+
+// TailscaleHosts returns the IPv4 addresses of the Tailscale peers, other
+// than this machine, to probe.
+func (d *Directory) TailscaleHosts() []net.IP {
+	if d == nil {
+		return nil
+	}
+	var hosts []net.IP
+	for _, p := range d.Peers {
+		if p.Self {
+			continue
+		}
+		for _, ip := range p.IPs {
+			if ip.To4() != nil {
+				hosts = append(hosts, ip)
+			}
+		}
+	}
+	return hosts
+}
+
+func (n Network) contains(ip net.IP) bool {
+	for _, s := range n.Subnets {
+		if s.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *Directory) index() {
+	d.byIP = make(map[string]*Peer)
+	for i := range d.Peers {
+		for _, ip := range d.Peers[i].IPs {
+			d.byIP[ip.String()] = &d.Peers[i]
+		}
+	}
+}
+
+// tailscaleStatus is the part of tailscale status --json read.
+type tailscaleStatus struct {
+	BackendState   string
+	Self           *tailscalePeer
+	Peer           map[string]*tailscalePeer
+	CurrentTailnet *struct {
+		Name string
+	}
+}
+
+type tailscalePeer struct {
+	HostName     string
+	DNSName      string
+	OS           string
+	TailscaleIPs []string
+}
+
+func (d *Directory) parseTailscale(out []byte) error {
+	var st tailscaleStatus
+	if err := json.Unmarshal(out, &st); err != nil {
+		return fmt.Errorf("tailscale status: %w", err)
+	}
+	if st.BackendState != "" && st.BackendState != "Running" {
+		return fmt.Errorf("tailscale is %s", st.BackendState)
+	}
+	if st.CurrentTailnet != nil {
+		d.Tailnet = st.CurrentTailnet.Name
+	}
+	if st.Self != nil {
+		p := st.Self.peer()
+		p.Self = true
+		d.Peers = append(d.Peers, p)
+		d.TailscaleInterface = interfaceWith(p.IPs)
+	}
+	peers := make([]Peer, 0, len(st.Peer))
+	for _, tp := range st.Peer {
+		peers = append(peers, tp.peer())
+	}
+	sort.Slice(peers, func(i, j int) bool { return peers[i].Name < peers[j].Name })
+	d.Peers = append(d.Peers, peers...)
+	return nil
+}
+
+func (tp *tailscalePeer) peer() Peer {
+	p := Peer{Name: strings.TrimSuffix(tp.DNSName, "."), OS: tp.OS}
+	if p.Name == "" {
+		p.Name = tp.HostName
+	}
+	for _, s := range tp.TailscaleIPs {
+		if ip := net.ParseIP(s); ip != nil {
+			p.IPs = append(p.IPs, ip)
+		}
+	}
+	return p
+}
+
+// interfaceWith returns the name of the interface holding one of ips.
+func interfaceWith(ips []net.IP) string {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return ""
+	}
+	for _, iface := range ifaces {
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, a := range addrs {
+			ipnet, ok := a.(*net.IPNet)
+			if !ok {
+				continue
+			}
+			for _, ip := range ips {
+				if ipnet.IP.Equal(ip) {
+					return iface.Name
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// zeroTierNetwork is an entry of zerotier-cli -j listnetworks.
+type zeroTierNetwork struct {
+	ID                string   `json:"id"`
+	Name              string   `json:"name"`
+	PortDeviceName    string   `json:"portDeviceName"`
+	AssignedAddresses []string `json:"assignedAddresses"`
+}
+
+func (d *Directory) parseZeroTierNetworks(out []byte) error {
+	var networks []zeroTierNetwork
+	if err := json.Unmarshal(out, &networks); err != nil {
+		return fmt.Errorf("zerotier-cli listnetworks: %w", err)
+	}
+	for _, zn := range networks {
+		var id uint64
+		if _, err := fmt.Sscanf(zn.ID, "%x", &id); err != nil {
+			continue
+		}
+		n := Network{ID: id, Name: zn.Name, Interface: zn.PortDeviceName}
+		for _, a := range zn.AssignedAddresses {
+			if _, subnet, err := net.ParseCIDR(a); err == nil {
+				n.Subnets = append(n.Subnets, subnet)
+			}
+		}
+		d.Networks = append(d.Networks, n)
+	}
+	return nil
+}
+
+// zeroTierPeer is an entry of zerotier-cli -j listpeers.
+type zeroTierPeer struct {
+	Address string `json:"address"`
+	Role    string `json:"role"`
+	Version string `json:"version"`
+}
+
+func (d *Directory) parseZeroTierPeers(out []byte) {
+	var peers []zeroTierPeer
+	if json.Unmarshal(out, &peers) != nil {
+		return
+	}
+	for _, p := range peers {
+		// Roots relay traffic; only leaves are members.
+		if p.Role == "LEAF" && p.Version != "" && p.Version != "-1.-1.-1" {
+			d.Versions[p.Address] = p.Version
+		}
+	}
+}
+
+// nodeFromMAC returns the ZeroTier node ID that mac stands for on network
+// nwid. ZeroTier derives a member's MAC address from the network ID and
+// its 40-bit node ID, so the node ID can be recovered; a MAC address of
+// another form is rejected.
+func nodeFromMAC(nwid uint64, mac net.HardwareAddr) (string, bool) {
+	if len(mac) != 6 || mac[0] != firstOctet(nwid) {
+		return "", false
+	}
+	var m uint64
+	for _, b := range mac {
+		m = m<<8 | uint64(b)
+	}
+	a := m & 0xffffffffff
+	a ^= ((nwid >> 8) & 0xff) << 32
+	a ^= ((nwid >> 16) & 0xff) << 24
+	a ^= ((nwid >> 24) & 0xff) << 16
+	a ^= ((nwid >> 32) & 0xff) << 8
+	a ^= (nwid >> 40) & 0xff
+	return fmt.Sprintf("%010x", a), true
+}
+
+// firstOctet is the first octet of the MAC addresses of network nwid:
+// locally administered, unicast, and never 0x52, which KVM uses.
+func firstOctet(nwid uint64) byte {
+	b := byte(nwid&0xfe) | 0x02
+	if b == 0x52 {
+		return 0x32
+	}
+	return b
+}
@@ -0,0 +1,155 @@
+// Package portscan finds the open TCP ports of a host with plain connect
+// scans: a port is open when it accepts a connection. No raw sockets are
+// needed, so it works unprivileged on every platform.
+package portscan
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultTimeout bounds the connection attempt to each port.
+const DefaultTimeout = time.Second
+
+// PerHost is the number of ports of one host tried at once, so a long port
+// list does not open hundreds of connections to a single device.
+const PerHost = 32
+
+// top lists the most commonly open TCP ports, most common first, as
+// measured by the nmap project.
+var top = []int{
+	80, 23, 443, 21, 22, 25, 3389, 110, 445, 139,
+	143, 53, 135, 3306, 8080, 1723, 111, 995, 993, 5900,
+	1025, 587, 8888, 199, 1720, 465, 548, 113, 81, 6001,
+	10000, 514, 5060, 179, 1026, 2000, 8443, 8000, 32768, 554,
+	26, 1433, 49152, 2001, 515, 8008, 49154, 1027, 5666, 646,
+	5000, 5631, 631, 49153, 8081, 2049, 88, 79, 5800, 106,
+	2121, 1110, 49155, 6000, 513, 990, 5357, 427, 49156, 543,
+	544, 5101, 144, 7, 389, 8009, 3128, 444, 9999, 5009,
+	7070, 5190, 3000, 5432, 1900, 3986, 13, 1029, 9, 5051,
+	6646, 49157, 1028, 873, 1755, 2717, 4899, 9100, 119, 37,
+}
+
+// Top returns the n most commonly open ports in ascending order.
+func Top(n int) ([]int, error) {
+	if n < 1 || n > len(top) {
+		return nil, fmt.Errorf("top ports: want between 1 and %d", len(top))
+	}
+	ports := slices.Clone(top[:n])
+	slices.Sort(ports)
+	return ports, nil
+}
+
+// Parse reads a comma-separated list of ports and ranges, e.g.
+// "22,80,443,8000-8100", and returns the ports in ascending order without
+// duplicates.
+func Parse(spec string) ([]int, error) {
+	var ports []int
+	for _, field := range strings.Split(spec, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		lo, hi, isRange := strings.Cut(field, "-")
+		first, err := parsePort(lo)
+		if err != nil {
+			return nil, err
+		}
+		last := first
+		if isRange {
+			if last, err = parsePort(hi); err != nil {
+				return nil, err
+			}
+			if last < first {
+				return nil, fmt.Errorf("port range %q: end before start", field)
+			}
+		}
+		for p := first; p <= last; p++ {
+			ports = append(ports, p)
+		}
+	}
+	if len(ports) == 0 {
+		return nil, fmt.Errorf("no ports in %q", spec)
+	}
+	slices.Sort(ports)
+	return slices.Compact(ports), nil
+}
+
+func parsePort(s string) (int, error) {
+	p, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil || p < 1 || p > 65535 {
+		return 0, fmt.Errorf("invalid port %q: want 1-65535", s)
+	}
+	return p, nil
+}
+
+// Dialer opens connections; *net.Dialer is one.
+type Dialer interface {
+	DialContext(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// Scan tries to connect to each of ports on host, PerHost at a time, and
+// returns those that accepted in ascending order. Ports refusing or
+// ignoring the connection are closed or filtered; Scan does not tell them
+// apart.
+func Scan(ctx context.Context, host string, ports []int, timeout time.Duration) []int {
+	return ScanVia(ctx, nil, host, ports, timeout)
+}
+
+// ScanVia is Scan with the connections made by dialer, such as a proxy;
+// nil connects directly.
+func ScanVia(ctx context.Context, dialer Dialer, host string, ports []int, timeout time.Duration) []int {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	if dialer == nil {
+		dialer = &net.Dialer{}
+	}
+
+	var open []int
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, PerHost)
+	for _, port := range ports {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(port int) {
+			defer func() { <-sem; wg.Done() }()
+			dctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			conn, err := dialer.DialContext(dctx, "tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+			if err != nil {
+				return
+			}
+			conn.Close()
+			mu.Lock()
+			open = append(open, port)
+			mu.Unlock()
+		}(port)
+	}
+	wg.Wait()
+
+	slices.Sort(open)
+	return open
+}
+
+// Format writes ports as a comma-separated list, the form Parse reads.
+func Format(ports []int) string {
+	s := make([]string, len(ports))
+	for i, p := range ports {
+		s[i] = strconv.Itoa(p)
+	}
+	return strings.Join(s, ",")
+}
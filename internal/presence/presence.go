@@ -0,0 +1,206 @@
+// Package presence watches a handful of chosen hosts at a high frequency,
+// independently of full subnet sweeps, and reports every state change as
+// soon as it is seen.
+package presence
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"pingdisco.com/pingdisco/internal/checks"
+	"pingdisco.com/pingdisco/internal/hysteresis"
+)
+
+// Change is a host going online or offline.
+type Change struct {
+	Host   string
+	Online bool
+	At     time.Time
+	// Since is when the host entered its previous state; zero for the
+	// first observation.
+	Since time.Time
+	// Hint is the probable cause of a host going offline, if Diagnose
+	// gave one.
+	Hint string
+}
+
+// Monitor probes Hosts every Interval. Hosts and Checks may be changed
+// while it runs with SetHosts and SetChecks.
+type Monitor struct {
+	Hosts    []string
+	Interval time.Duration
+	// DownAfter and UpAfter are the consecutive misses and hits needed
+	// before a host is declared offline or online again.
+	DownAfter int
+	UpAfter   int
+	// Probe reports whether host answered.
+	Probe func(ctx context.Context, host string) bool
+	// OnChange is called for the first observation of each host and for
+	// every later state change. Calls are serialized.
+	OnChange func(Change)
+	// Diagnose, if set, is called when a host that was online goes
+	// offline and returns the probable cause for Change.Hint. It runs
+	// before the change is reported, outside the serialization.
+	Diagnose func(ctx context.Context, host string) string
+
+	// Checks lists service checks to run against each host while it is
+	// online, and OnCheck receives results whenever a check starts or
+	// stops passing. Calls are serialized with OnChange.
+	Checks  map[string][]checks.Check
+	OnCheck func(host string, r checks.Result)
+
+	mu      sync.Mutex // guards Hosts, Checks, ctx and running
+	ctx     context.Context
+	running map[string]context.CancelFunc
+	wg      sync.WaitGroup
+	report  sync.Mutex // serializes OnChange and OnCheck
+}
+
+// Run probes until ctx is done.
+func (m *Monitor) Run(ctx context.Context) {
+	m.mu.Lock()
+	m.ctx = ctx
+	m.running = make(map[string]context.CancelFunc)
+	for _, host := range m.Hosts {
+		m.start(host)
+	}
+	m.mu.Unlock()
+
+	<-ctx.Done()
+
+	m.mu.Lock()
+	m.ctx = nil
+	m.mu.Unlock()
+	m.wg.Wait()
+}
+
+// SetHosts replaces the watched hosts. Hosts watched before and after keep
+// their state; new ones are reported like on the first probe. It returns
+// the hosts added and removed.
+func (m *Monitor) SetHosts(hosts []string) (added, removed []string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	want := make(map[string]bool, len(hosts))
+	for _, host := range hosts {
+		want[host] = true
+	}
+	for _, host := range m.Hosts {
+		if !want[host] {
+			removed = append(removed, host)
+		}
+		delete(want, host)
+	}
+	for _, host := range hosts {
+		if want[host] {
+			added = append(added, host)
+			delete(want, host)
+		}
+	}
+	m.Hosts = hosts
+
+	if m.ctx == nil {
+		return added, removed
+	}
+	for _, host := range removed {
+		if cancel := m.running[host]; cancel != nil {
+			cancel()
+			delete(m.running, host)
+		}
+	}
+	for _, host := range added {
+		m.start(host)
+	}
+	return added, removed
+}
+
+// SetChecks replaces the service checks, from the next probe of each host.
+func (m *Monitor) SetChecks(byHost map[string][]checks.Check) {
+	m.mu.Lock()
+	m.Checks = byHost
+	m.mu.Unlock()
+}
+
+func (m *Monitor) hostChecks(host string) []checks.Check {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.Checks[host]
+}
+
+// start watches host until ctx is done or it is removed. m.mu is held.
+func (m *Monitor) start(host string) {
+	if _, ok := m.running[host]; ok {
+		return
+	}
+	ctx, cancel := context.WithCancel(m.ctx)
+	m.running[host] = cancel
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		defer cancel()
+		m.watch(ctx, host)
+	}()
+}
+
+func (m *Monitor) watch(ctx context.Context, host string) {
+	tracker := hysteresis.Tracker{UpAfter: m.UpAfter, DownAfter: m.DownAfter}
+	checkTracker := hysteresis.Tracker{UpAfter: m.UpAfter, DownAfter: m.DownAfter}
+	checkSeen := make(map[string]bool)
+	var since time.Time
+
+	ticker := time.NewTicker(m.Interval)
+	defer ticker.Stop()
+
+	for {
+		seen := m.Probe(ctx, host)
+		if ctx.Err() != nil {
+			return
+		}
+
+		now := time.Now()
+		online, changed := tracker.Observe(host, seen)
+		if since.IsZero() || changed {
+			change := Change{Host: host, Online: online, At: now, Since: since}
+			if !online && !since.IsZero() && m.Diagnose != nil {
+				change.Hint = m.Diagnose(ctx, host)
+				if ctx.Err() != nil {
+					return
+				}
+			}
+			since = now
+
+			m.report.Lock()
+			m.OnChange(change)
+			m.report.Unlock()
+		}
+
+		if online {
+			for _, c := range m.hostChecks(host) {
+				r := checks.Run(ctx, host, c)
+				if ctx.Err() != nil {
+					return
+				}
+
+				// A check failing from the start is worth reporting; one
+				// passing from the start is not.
+				key := c.String()
+				first := !checkSeen[key]
+				checkSeen[key] = true
+				passing, changed := checkTracker.Observe(key, r.OK)
+				if changed || (first && !passing) {
+					m.report.Lock()
+					m.OnCheck(host, r)
+					m.report.Unlock()
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
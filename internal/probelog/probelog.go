@@ -0,0 +1,231 @@
+// Package probelog keeps a record of every probe sent and what came back,
+// so a disputed result ("it said my NAS was down") can be looked into
+// after the fact. Records are JSON lines in gzip-compressed files, one per
+// day, and files older than the retention period are deleted.
+package probelog
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultKeep is the number of days of files kept unless told otherwise.
+const DefaultKeep = 14
+
+// flushEvery bounds how long records may sit in the compressor: the gzip
+// member being written is finished this often, so the file can be read
+// while probing goes on.
+const flushEvery = time.Minute
+
+// Entry is one probe and its outcome.
+type Entry struct {
+	Time   time.Time
+	Target string
+	// Method is how the host was probed: "icmp", or "tcp" with the port,
+	// e.g. "tcp:443".
+	Method string
+	// Attempt counts the probes of the target in one go, from 1.
+	Attempt int
+	Up      bool
+	// RTT is the round-trip time of an answer, when measured.
+	RTT time.Duration
+	// Timeout is how long the probe waited for an answer.
+	Timeout time.Duration
+}
+
+// line is an Entry as written, with durations in milliseconds.
+type line struct {
+	Time      time.Time `json:"time"`
+	Target    string    `json:"target"`
+	Method    string    `json:"method"`
+	Attempt   int       `json:"attempt"`
+	Up        bool      `json:"up"`
+	RTTMs     float64   `json:"rtt_ms,omitempty"`
+	TimeoutMs float64   `json:"timeout_ms"`
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// Log writes entries to the daily files of a directory. A nil *Log
+// records nothing.
+type Log struct {
+	// OnError, if set, is told of the first error writing the log, after
+	// which recording stops rather than failing every probe.
+	OnError func(error)
+
+	dir  string
+	keep int
+
+	mu      sync.Mutex
+	day     string
+	f       *os.File
+	zw      *gzip.Writer
+	started time.Time
+	// failed is set after a write error.
+	failed bool
+}
+
+// Open returns a log writing to dir, created if missing, and deletes the
+// files of dir older than keep days.
+func Open(dir string, keep int) (*Log, error) {
+	if keep < 1 {
+		return nil, fmt.Errorf("probe log: keep at least one day")
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("probe log: %w", err)
+	}
+	l := &Log{dir: dir, keep: keep}
+	if err := l.prune(time.Now()); err != nil {
+		return nil, fmt.Errorf("probe log: %w", err)
+	}
+	return l, nil
+}
+
+// FileName returns the name of the file holding the entries of the day of
+// t, e.g. "probes-2026-10-16.jsonl.gz". Days are local.
+func FileName(t time.Time) string {
+	return "probes-" + t.Local().Format(time.DateOnly) + ".jsonl.gz"
+}
+
+// Record appends e to the file of its day.
+func (l *Log) Record(e Entry) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.failed {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	if err := l.write(e); err != nil {
+		l.failed = true
+		l.closeFile()
+		if l.OnError != nil {
+			l.OnError(fmt.Errorf("probe log: %w", err))
+		}
+	}
+}
+
+func (l *Log) write(e Entry) error {
+	day := FileName(e.Time)
+	if day != l.day {
+		if err := l.closeFile(); err != nil {
+			return err
+		}
+		if err := l.prune(e.Time); err != nil {
+			return err
+		}
+		f, err := os.OpenFile(filepath.Join(l.dir, day), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+		if err != nil {
+			return err
+		}
+		l.f, l.day = f, day
+	}
+	if l.zw == nil {
+		// Each gzip member is complete on its own; readers take the
+		// concatenation as one stream.
+		l.zw = gzip.NewWriter(l.f)
+		l.started = time.Now()
+	}
+	b, err := json.Marshal(line{e.Time, e.Target, e.Method, e.Attempt, e.Up, milliseconds(e.RTT), milliseconds(e.Timeout)})
+	if err != nil {
+		return err
+	}
+	if _, err := l.zw.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	if time.Since(l.started) >= flushEvery {
+		err := l.zw.Close()
+		l.zw = nil
+		return err
+	}
+	return nil
+}
+
+// Flush finishes the gzip member being written, so every entry recorded
+// so far can be read.
+func (l *Log) Flush() error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.zw == nil {
+		return nil
+	}
+	err := l.zw.Close()
+	l.zw = nil
+	return err
+}
+
+// Close finishes the file being written.
+func (l *Log) Close() error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.closeFile()
+}
+
+func (l *Log) closeFile() error {
+	var err error
+	if l.zw != nil {
+		err = l.zw.Close()
+		l.zw = nil
+	}
+	if l.f != nil {
+		if cerr := l.f.Close(); err == nil {
+			err = cerr
+		}
+		l.f = nil
+	}
+	l.day = ""
+	return err
+}
+
+// prune deletes the files of days more than keep days before now.
+func (l *Log) prune(now time.Time) error {
+	names, err := Files(l.dir)
+	if err != nil {
+		return err
+	}
+	oldest := FileName(now.AddDate(0, 0, -(l.keep - 1)))
+	for _, name := range names {
+		// The dates in the names sort as the days do.
+		if name < oldest {
+			if err := os.Remove(filepath.Join(l.dir, name)); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Files lists the log files of dir, oldest first.
+func Files(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		if name := e.Name(); strings.HasPrefix(name, "probes-") && strings.HasSuffix(name, ".jsonl.gz") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
@@ -0,0 +1,150 @@
+// Package profile keeps per-network profiles, so that a laptop moving
+// between networks uses the labels, known devices and alert settings of
+// the network it is on. A profile is recognised by the SSID of the Wi-Fi
+// network or by the MAC address of the default gateway, which stays the
+// same on wired networks with common private subnets.
+package profile
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Profile is a network profile. It is stored as NAME.json in the profiles
+// directory, and its files are kept in the directory NAME next to it.
+type Profile struct {
+	Name        string   `json:"-"`
+	SSIDs       []string `json:"ssids,omitempty"`
+	GatewayMACs []string `json:"gateway_macs,omitempty"`
+}
+
+// Network identifies the network the machine is on.
+type Network struct {
+	SSIDs       []string
+	GatewayMACs []net.HardwareAddr
+}
+
+// ErrNotFound is returned for profiles that do not exist.
+var ErrNotFound = errors.New("no such profile")
+
+// Load returns the profiles in dir, sorted by name. A missing directory
+// has none.
+func Load(dir string) ([]Profile, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	var profiles []Profile
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		p := Profile{Name: strings.TrimSuffix(filepath.Base(path), ".json")}
+		if err := json.Unmarshal(data, &p); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		profiles = append(profiles, p)
+	}
+	return profiles, nil
+}
+
+// Find returns the profile called name among profiles.
+func Find(profiles []Profile, name string) (*Profile, error) {
+	for i := range profiles {
+		if profiles[i].Name == name {
+			return &profiles[i], nil
+		}
+	}
+	return nil, fmt.Errorf("%w %q", ErrNotFound, name)
+}
+
+// Match returns the first of profiles matching n and why it matches, or
+// nil if none does.
+func Match(profiles []Profile, n Network) (*Profile, string) {
+	for i := range profiles {
+		if why := profiles[i].Matches(n); why != "" {
+			return &profiles[i], why
+		}
+	}
+	return nil, ""
+}
+
+// Matches says why p matches n, or returns "" if it does not.
+func (p Profile) Matches(n Network) string {
+	for _, ssid := range n.SSIDs {
+		for _, s := range p.SSIDs {
+			if s == ssid {
+				return "Wi-Fi network " + ssid
+			}
+		}
+	}
+	for _, mac := range n.GatewayMACs {
+		for _, m := range p.GatewayMACs {
+			if hw, err := net.ParseMAC(m); err == nil && hw.String() == mac.String() {
+				return "gateway " + mac.String()
+			}
+		}
+	}
+	return ""
+}
+
+// Validate checks the name and gateway MAC addresses of p.
+func (p Profile) Validate() error {
+	if p.Name == "" || p.Name == "." || p.Name == ".." || strings.ContainsAny(p.Name, `/\:`) {
+		return fmt.Errorf("invalid profile name %q", p.Name)
+	}
+	if len(p.SSIDs) == 0 && len(p.GatewayMACs) == 0 {
+		return errors.New("a profile needs an SSID or a gateway MAC address to be recognised by")
+	}
+	for _, m := range p.GatewayMACs {
+		if _, err := net.ParseMAC(m); err != nil {
+			return fmt.Errorf("invalid gateway MAC address %q", m)
+		}
+	}
+	return nil
+}
+
+// Dir returns the directory holding the files of p, in the profiles
+// directory dir.
+func (p Profile) Dir(dir string) string {
+	return filepath.Join(dir, p.Name)
+}
+
+// Save writes p to the profiles directory dir and creates its directory.
+func (p Profile) Save(dir string) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(p.Dir(dir), 0o700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, p.Name+".json")
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Remove deletes the profile called name from dir. Its directory is kept,
+// since it holds an inventory that may have taken a while to build.
+func Remove(dir, name string) error {
+	err := os.Remove(filepath.Join(dir, name+".json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%w %q", ErrNotFound, name)
+	}
+	return err
+}
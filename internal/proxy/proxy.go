@@ -0,0 +1,63 @@
+// Package proxy opens TCP connections through a SOCKS5 proxy or an SSH
+// jump host, so TCP probes can reach subnets that the scanning machine
+// cannot ping, such as a remote site behind a bastion host.
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// Dialer opens connections; *net.Dialer is one.
+type Dialer interface {
+	DialContext(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// Open returns a Dialer for the proxy described by rawURL:
+//
+//	socks5://[user:password@]host[:port]  a SOCKS5 proxy, port 1080 by default
+//	ssh://[user@]host[:port]              an SSH jump host, through a dynamic
+//	                                      port forward of the ssh command
+//
+// The SSH forward is started at once and runs until ctx is done. A bare
+// host:port is taken as a SOCKS5 proxy.
+func Open(ctx context.Context, rawURL string) (Dialer, error) {
+	if !strings.Contains(rawURL, "://") {
+		rawURL = "socks5://" + rawURL
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy %q: %w", rawURL, err)
+	}
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("invalid proxy %q: no host", rawURL)
+	}
+
+	switch u.Scheme {
+	case "socks5", "socks5h", "socks":
+		s := &SOCKS5{Addr: u.Host}
+		if u.Port() == "" {
+			s.Addr = net.JoinHostPort(u.Hostname(), "1080")
+		}
+		if u.User != nil {
+			s.User = u.User.Username()
+			s.Password, _ = u.User.Password()
+		}
+		return s, nil
+	case "ssh":
+		return StartSSH(ctx, u.User.Username(), u.Hostname(), u.Port())
+	}
+	return nil, fmt.Errorf("unknown proxy scheme %q; use socks5:// or ssh://", u.Scheme)
+}
+
+// Redacted returns rawURL with its password, if any, masked for display.
+func Redacted(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || !strings.Contains(rawURL, "://") {
+		return rawURL
+	}
+	return u.Redacted()
+}
@@ -0,0 +1,163 @@
+package proxy
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// SOCKS5 connects through a SOCKS5 proxy (RFC 1928), with a user name and
+// password (RFC 1929) if User is set.
+type SOCKS5 struct {
+	Addr     string
+	User     string
+	Password string
+}
+
+// SOCKS5 reply codes that tell a probe the most.
+const (
+	socksSucceeded   = 0x00
+	socksRefused     = 0x05
+	socksUnreachable = 0x04
+)
+
+// DialContext implements Dialer. A target refusing the connection is
+// reported as an error matching syscall.ECONNREFUSED, as a direct
+// connection would be, since it proves the host is up.
+func (s *SOCKS5) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	if network != "tcp" && network != "tcp4" && network != "tcp6" {
+		return nil, fmt.Errorf("socks5: network %s not supported", network)
+	}
+	host, portStr, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port <= 0 || port > 65535 {
+		return nil, fmt.Errorf("socks5: invalid port %q", portStr)
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", s.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("socks5: %w", err)
+	}
+	// The handshake runs under the caller's deadline, and is cut short
+	// when ctx is done.
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Unix(1, 0)) })
+	defer stop()
+
+	if err := s.handshake(conn, host, port); err != nil {
+		conn.Close()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	return conn, nil
+}
+
+func (s *SOCKS5) handshake(conn net.Conn, host string, port int) error {
+	method := byte(0x00)
+	if s.User != "" {
+		method = 0x02
+	}
+	if _, err := conn.Write([]byte{0x05, 1, method}); err != nil {
+		return fmt.Errorf("socks5: %w", err)
+	}
+	var reply [2]byte
+	if _, err := io.ReadFull(conn, reply[:]); err != nil {
+		return fmt.Errorf("socks5: %w", err)
+	}
+	if reply[0] != 0x05 || reply[1] != method {
+		return errors.New("socks5: proxy refused the authentication method")
+	}
+	if method == 0x02 {
+		if err := s.authenticate(conn); err != nil {
+			return err
+		}
+	}
+
+	req := []byte{0x05, 0x01, 0x00}
+	if ip := net.ParseIP(host); ip == nil {
+		if len(host) > 255 {
+			return errors.New("socks5: host name too long")
+		}
+		req = append(req, 0x03, byte(len(host)))
+		req = append(req, host...)
+	} else if ip4 := ip.To4(); ip4 != nil {
+		req = append(append(req, 0x01), ip4...)
+	} else {
+		req = append(append(req, 0x04), ip.To16()...)
+	}
+	req = binary.BigEndian.AppendUint16(req, uint16(port))
+	if _, err := conn.Write(req); err != nil {
+		return fmt.Errorf("socks5: %w", err)
+	}
+
+	var head [4]byte
+	if _, err := io.ReadFull(conn, head[:]); err != nil {
+		return fmt.Errorf("socks5: %w", err)
+	}
+	switch head[1] {
+	case socksSucceeded:
+	case socksRefused:
+		return fmt.Errorf("socks5: %w", syscall.ECONNREFUSED)
+	case socksUnreachable:
+		return fmt.Errorf("socks5: %w", syscall.EHOSTUNREACH)
+	default:
+		return fmt.Errorf("socks5: connect failed with code %d", head[1])
+	}
+
+	// Skip the bound address.
+	n := 0
+	switch head[3] {
+	case 0x01:
+		n = net.IPv4len
+	case 0x04:
+		n = net.IPv6len
+	case 0x03:
+		var l [1]byte
+		if _, err := io.ReadFull(conn, l[:]); err != nil {
+			return fmt.Errorf("socks5: %w", err)
+		}
+		n = int(l[0])
+	default:
+		return fmt.Errorf("socks5: bad address type %d in reply", head[3])
+	}
+	if _, err := io.ReadFull(conn, make([]byte, n+2)); err != nil {
+		return fmt.Errorf("socks5: %w", err)
+	}
+	return nil
+}
+
+func (s *SOCKS5) authenticate(conn net.Conn) error {
+	if len(s.User) > 255 || len(s.Password) > 255 {
+		return errors.New("socks5: user name or password too long")
+	}
+	req := []byte{0x01, byte(len(s.User))}
+	req = append(req, s.User...)
+	req = append(req, byte(len(s.Password)))
+	req = append(req, s.Password...)
+	if _, err := conn.Write(req); err != nil {
+		return fmt.Errorf("socks5: %w", err)
+	}
+	var reply [2]byte
+	if _, err := io.ReadFull(conn, reply[:]); err != nil {
+		return fmt.Errorf("socks5: %w", err)
+	}
+	if reply[1] != 0x00 {
+		return errors.New("socks5: authentication failed")
+	}
+	return nil
+}
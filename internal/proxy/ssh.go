@@ -0,0 +1,70 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// SSHStartTimeout bounds how long StartSSH waits for the forward to come
+// up, including any host key and login prompts ssh has to get through.
+const SSHStartTimeout = 15 * time.Second
+
+// StartSSH starts a dynamic port forward through host with the system ssh
+// client, so existing keys, agents and ~/.ssh/config apply, and returns
+// the SOCKS5 proxy it listens as on the loopback address. user and port
+// may be empty. The forward runs until ctx is done.
+func StartSSH(ctx context.Context, user, host, port string) (*SOCKS5, error) {
+	// Ask the system for a free port; ssh binds it again right after.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	local := l.Addr().String()
+	l.Close()
+
+	target := host
+	if user != "" {
+		target = user + "@" + host
+	}
+	args := []string{"-N", "-D", local, "-o", "ExitOnForwardFailure=yes", "-o", "BatchMode=yes"}
+	if port != "" {
+		args = append(args, "-p", port)
+	}
+	args = append(args, target)
+
+	cmd := exec.CommandContext(ctx, "ssh", args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("ssh: %w", err)
+	}
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+
+	deadline := time.After(SSHStartTimeout)
+	for {
+		if conn, err := net.DialTimeout("tcp", local, 100*time.Millisecond); err == nil {
+			conn.Close()
+			return &SOCKS5{Addr: local}, nil
+		}
+		select {
+		case err := <-exited:
+			msg := strings.TrimSpace(stderr.String())
+			if msg == "" {
+				msg = err.Error()
+			}
+			return nil, fmt.Errorf("ssh to %s: %s", target, msg)
+		case <-deadline:
+			cmd.Process.Kill()
+			return nil, fmt.Errorf("ssh to %s: no forward after %s", target, SSHStartTimeout)
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
@@ -0,0 +1,196 @@
+// Package quality grades how well the connection to a device behaves, from
+// A to F, by its packet loss, round-trip time and jitter. A grade is
+// easier to act on than latency statistics for people who do not read
+// them: a printer graded D on Wi-Fi needs a closer access point, whatever
+// its jitter is in milliseconds.
+package quality
+
+import (
+	"strconv"
+	"time"
+
+	"pingdisco.com/pingdisco/internal/device"
+)
+
+// Grade is a quality grade. The zero Grade means too few samples.
+type Grade int
+
+// Grades from best to worst.
+const (
+	Unknown Grade = iota
+	A
+	B
+	C
+	D
+	F
+)
+
+func (g Grade) String() string {
+	if g <= Unknown || g > F {
+		return ""
+	}
+	return string("ABCDF"[g-A])
+}
+
+// limits are the worst loss (in percent), average round-trip time and
+// jitter each grade allows; anything worse than D is F. They suit local
+// networks, where even Wi-Fi answers within a few milliseconds when
+// healthy.
+var limits = []struct {
+	loss   float64
+	rtt    time.Duration
+	jitter time.Duration
+}{
+	A: {0.5, 10 * time.Millisecond, 2 * time.Millisecond},
+	B: {2, 30 * time.Millisecond, 8 * time.Millisecond},
+	C: {5, 80 * time.Millisecond, 20 * time.Millisecond},
+	D: {10, 200 * time.Millisecond, 50 * time.Millisecond},
+}
+
+// MinSent is the number of echo requests a grade needs.
+const MinSent = 3
+
+// Sample is what one scan measured of a device. A scan that missed a known
+// device is a request sent and not answered.
+type Sample struct {
+	Sent     int
+	Received int
+	// RTT is the average round-trip time of the replies and Jitter their
+	// mean variation, zero if not measured.
+	RTT    time.Duration
+	Jitter time.Duration
+}
+
+// FromDevice returns the sample a scan recorded for d: its latency
+// statistics if the scan timed several echo requests, its one probe
+// otherwise.
+func FromDevice(d *device.Device) Sample {
+	if sent := d.Int(device.AttrLatencySent); sent > 0 {
+		loss, _ := strconv.ParseFloat(d.Get(device.AttrLatencyLoss), 64)
+		s := Sample{Sent: sent, Received: sent - int(loss*float64(sent)/100+0.5)}
+		s.RTT, _ = time.ParseDuration(d.Get(device.AttrLatencyAvg))
+		s.Jitter, _ = time.ParseDuration(d.Get(device.AttrLatencyJitter))
+		return s
+	}
+	s := Sample{Sent: 1, Received: 1}
+	s.RTT, _ = time.ParseDuration(d.Get(device.AttrRTT))
+	return s
+}
+
+// Missed is the sample of a scan that did not find a known device.
+func Missed() Sample {
+	return Sample{Sent: 1}
+}
+
+// Summary is the grade of a series of samples and what it is based on.
+type Summary struct {
+	Grade Grade
+	// Loss is the percentage of requests left unanswered.
+	Loss   float64
+	RTT    time.Duration
+	Jitter time.Duration
+	Sent   int
+}
+
+// Rate grades samples, oldest first. Jitter is the larger of the jitter
+// measured within scans and the variation of the round-trip time from one
+// scan to the next.
+func Rate(samples []Sample) Summary {
+	var s Summary
+	received := 0
+	var rtts []time.Duration
+	var jitter, swing time.Duration
+	jitters := 0
+	for _, x := range samples {
+		s.Sent += x.Sent
+		received += x.Received
+		if x.RTT > 0 {
+			if len(rtts) > 0 {
+				swing += (x.RTT - rtts[len(rtts)-1]).Abs()
+			}
+			rtts = append(rtts, x.RTT)
+		}
+		if x.Jitter > 0 {
+			jitter += x.Jitter
+			jitters++
+		}
+	}
+	if s.Sent < MinSent {
+		return Summary{Sent: s.Sent}
+	}
+	s.Loss = 100 * float64(s.Sent-received) / float64(s.Sent)
+
+	var sum time.Duration
+	for _, rtt := range rtts {
+		sum += rtt
+	}
+	if len(rtts) > 0 {
+		s.RTT = sum / time.Duration(len(rtts))
+	}
+	if jitters > 0 {
+		s.Jitter = jitter / time.Duration(jitters)
+	}
+	if len(rtts) > 1 {
+		s.Jitter = max(s.Jitter, swing/time.Duration(len(rtts)-1))
+	}
+
+	s.Grade = A
+	for g := A; g <= D; g++ {
+		l := limits[g]
+		if s.Loss <= l.loss && s.RTT <= l.rtt && s.Jitter <= l.jitter {
+			break
+		}
+		s.Grade = g + 1
+	}
+	return s
+}
+
+// Annotate records the grade of the latency statistics a scan measured
+// for d, if it timed enough echo requests.
+func Annotate(d *device.Device) {
+	d.Set(device.AttrQuality, Rate([]Sample{FromDevice(d)}).Grade.String())
+}
+
+// DefaultWindow is the number of scans History grades a device by.
+const DefaultWindow = 10
+
+// History grades devices by the samples of their most recent scans, as
+// repeated by scan --watch.
+type History struct {
+	// Window is the number of scans kept per device; zero means
+	// DefaultWindow.
+	Window  int
+	samples map[string][]Sample
+}
+
+// Round adds the devices found by one scan and a missed sample for each
+// device seen before but not by this scan, and returns the summaries of
+// the devices found by their ID.
+func (h *History) Round(devices []*device.Device) map[string]Summary {
+	if h.samples == nil {
+		h.samples = make(map[string][]Sample)
+	}
+	window := h.Window
+	if window <= 0 {
+		window = DefaultWindow
+	}
+	add := func(id string, s Sample) {
+		samples := append(h.samples[id], s)
+		h.samples[id] = samples[max(len(samples)-window, 0):]
+	}
+
+	found := make(map[string]Summary, len(devices))
+	for _, d := range devices {
+		add(d.ID(), FromDevice(d))
+		found[d.ID()] = Summary{}
+	}
+	for id := range h.samples {
+		if _, ok := found[id]; !ok {
+			add(id, Missed())
+		}
+	}
+	for id := range found {
+		found[id] = Rate(h.samples[id])
+	}
+	return found
+}
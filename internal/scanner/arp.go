@@ -0,0 +1,108 @@
+package scanner
+
+import (
+	"context"
+	"net"
+
+	"pingdisco.com/pingdisco/internal/device"
+	"pingdisco.com/pingdisco/internal/events"
+	"pingdisco.com/pingdisco/internal/netinfo"
+	"pingdisco.com/pingdisco/internal/netops"
+	"pingdisco.com/pingdisco/internal/oui"
+	"pingdisco.com/pingdisco/internal/targets"
+)
+
+// sharedMACThreshold is the number of addresses behind one MAC from which
+// the MAC is assumed to belong to a proxy ARP responder, NAT appliance or
+// VPN gateway rather than to separate devices.
+const sharedMACThreshold = 3
+
+// annotateMACs fills in the MAC address of each device from the neighbor
+// table, counts the IPv4 devices sharing it and returns the devices it
+// changed. Several IPv6 addresses behind one MAC are the norm rather than
+// a sign of proxy ARP; correlate6 merges them instead.
+func annotateMACs(neighbors netops.NeighborTable, devices []*device.Device, subnet *net.IPNet) []*device.Device {
+	macs := make(map[string]net.HardwareAddr)
+	for _, n := range netops.NeighborsOn(neighbors, subnet) {
+		if n.Complete {
+			macs[n.IP.String()] = n.MAC
+		}
+	}
+
+	var changed []*device.Device
+	count := make(map[string]int)
+	for _, d := range devices {
+		if mac := macs[d.IP().String()]; mac != nil {
+			changed = append(changed, d)
+			SetMAC(d, mac)
+			count[mac.String()]++
+		}
+	}
+
+	if subnet.IP.To4() == nil {
+		return changed
+	}
+	for _, d := range devices {
+		if d.MAC != nil && count[d.MAC.String()] >= sharedMACThreshold {
+			d.SetInt(device.AttrSharedMAC, count[d.MAC.String()])
+		}
+	}
+
+	return changed
+}
+
+// sweepARP asks every address of g over ARP, if g is a directly attached
+// subnet, and returns the hosts that answered.
+func (s *Scanner) sweepARP(ctx context.Context, g targets.Group, addrs []net.IP) []netinfo.Neighbor {
+	iface, local := g.Interface, g.Local
+	if iface == "" {
+		iface, local = netops.AttachedInterface(g.Subnet)
+	}
+	if iface == "" {
+		return nil
+	}
+
+	_, span := s.Tracer.Start(ctx, "arp")
+	defer span.End()
+	found, err := s.Ops.ARP.ARPScan(ctx, iface, local, addrs, s.Probe.Timeout)
+	span.SetAttr("answered", len(found))
+	span.Fail(err)
+	return found
+}
+
+// mergeARP records the MAC address of the devices that answered ARP and
+// adds those that did not answer a probe, returning the devices found.
+func (s *Scanner) mergeARP(ctx context.Context, answered []netinfo.Neighbor, devices []*device.Device, g targets.Group) []*device.Device {
+	byIP := make(map[string]*device.Device, len(devices))
+	for _, d := range devices {
+		byIP[d.IP().String()] = d
+	}
+
+	for _, n := range answered {
+		ip := n.IP.String()
+		if n.IP.Equal(g.Local) {
+			continue
+		}
+		d := byIP[ip]
+		if d == nil {
+			d = s.discovered(ctx, n.IP, device.SourceARP, s.Inventory.Lookup(ip), g)
+			byIP[ip] = d
+			devices = append(devices, d)
+		}
+		SetMAC(d, n.MAC)
+		s.Bus.Publish(events.Event{Type: events.DeviceEnriched, Group: g, Device: d})
+	}
+	return devices
+}
+
+// SetMAC records the MAC address of d, learnt over ARP or for an IPv6
+// address over NDP, and the vendor its prefix was assigned to.
+func SetMAC(d *device.Device, mac net.HardwareAddr) {
+	d.MAC = mac
+	if d.IP().To4() == nil {
+		d.AddSource(device.SourceNDP)
+	} else {
+		d.AddSource(device.SourceARP)
+	}
+	d.Identify(device.FieldVendor, oui.Vendor(mac), device.SourceOUI, device.SourceConfidence(device.SourceOUI))
+}
@@ -0,0 +1,107 @@
+package scanner
+
+import (
+	"context"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+
+	"pingdisco.com/pingdisco/internal/device"
+	"pingdisco.com/pingdisco/internal/events"
+	"pingdisco.com/pingdisco/internal/netops"
+	"pingdisco.com/pingdisco/internal/targets"
+)
+
+// Liveness signals an audit counts, as listed in device.AttrAuditSignals.
+const (
+	SignalICMP = "icmp"
+	SignalTCP  = "tcp"
+	SignalARP  = "arp"
+	SignalNDP  = "ndp"
+	SignalSSDP = "ssdp"
+)
+
+// AuditPorts are the TCP ports an audit tries on a host that has given
+// only one signal: remote access, web, file sharing and the port iPhones
+// keep open for syncing. A refused connection counts as much as an
+// accepted one.
+var AuditPorts = []int{22, 80, 443, 445, 3389, 8080, 62078}
+
+// audit confirms that each of devices is alive by a second, independent
+// signal and records the signals in device.AttrAuditSignals, "none" if
+// there were none to count. Hosts found
+// by one method are tried with ICMP and then TCP until they have given two;
+// an ARP or NDP reply counts only on a directly attached subnet, and not
+// from a MAC address answering for several hosts, as a proxy ARP router
+// or a middlebox answering on behalf of hosts does.
+func (s *Scanner) audit(ctx context.Context, devices []*device.Device, g targets.Group) {
+	sem := make(chan struct{}, max(s.Workers, DefaultWorkers))
+	var wg sync.WaitGroup
+	for _, d := range devices {
+		signals := signalsOf(d, g)
+		if len(signals) < 2 && ctx.Err() == nil && s.budget.allow(SkipAudit, optionalShare) {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(d *device.Device) {
+				defer func() { <-sem; wg.Done() }()
+				d.Set(device.AttrAuditSignals, joinSignals(s.confirm(ctx, d, signals)))
+				s.Bus.Publish(events.Event{Type: events.DeviceEnriched, Group: g, Device: d})
+			}(d)
+			continue
+		}
+		d.Set(device.AttrAuditSignals, joinSignals(signals))
+	}
+	wg.Wait()
+}
+
+// confirm tries the signals d has not given until it has given two, and
+// returns them all.
+func (s *Scanner) confirm(ctx context.Context, d *device.Device, signals []string) []string {
+	host := d.IP().String()
+	if !slices.Contains(signals, SignalICMP) && s.Ops.Dialer == nil {
+		if s.Ops.Pinger.Ping(ctx, host, 1, s.Probe.Timeout) {
+			signals = append(signals, SignalICMP)
+		}
+	}
+	if len(signals) < 2 && !slices.Contains(signals, SignalTCP) {
+		var dialer netops.Dialer = &net.Dialer{}
+		if s.Ops.Dialer != nil {
+			dialer = s.Ops.Dialer
+		}
+		tcp := netops.TCPPinger{Dialer: dialer, Ports: AuditPorts}
+		if tcp.Ping(ctx, host, 1, s.Probe.Timeout) {
+			signals = append(signals, SignalTCP)
+		}
+	}
+	return signals
+}
+
+// signalsOf lists the independent signals the scan has had from d.
+func signalsOf(d *device.Device, g targets.Group) []string {
+	var signals []string
+	if slices.Contains(d.Sources, device.SourceTCP) || d.Get(device.AttrOpenPorts) != "" {
+		signals = append(signals, SignalTCP)
+	}
+	if slices.Contains(d.Sources, device.SourcePing) {
+		signals = append(signals, SignalICMP)
+	}
+	if d.MAC != nil && g.Local != nil && d.Int(device.AttrSharedMAC) == 0 {
+		if g.IPv6() {
+			signals = append(signals, SignalNDP)
+		} else {
+			signals = append(signals, SignalARP)
+		}
+	}
+	if slices.Contains(d.Sources, device.SourceSSDP) {
+		signals = append(signals, SignalSSDP)
+	}
+	return signals
+}
+
+func joinSignals(signals []string) string {
+	if len(signals) == 0 {
+		return "none"
+	}
+	return strings.Join(signals, ",")
+}
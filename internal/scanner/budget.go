@@ -0,0 +1,99 @@
+package scanner
+
+import (
+	"sync"
+	"time"
+)
+
+// Work a Run short of time leaves out, in the order it is given up.
+const (
+	SkipRetries    = "retries of silent hosts"
+	SkipLatency    = "latency samples"
+	SkipEchoStats  = "echo statistics"
+	SkipPorts      = "port scans"
+	SkipAudit      = "liveness confirmations"
+	SkipSNMP       = "SNMP queries"
+	SkipLocalNames = "mDNS and LLMNR lookups"
+	SkipRDNS       = "reverse DNS lookups"
+	SkipProbes     = "probes"
+)
+
+// skipOrder lists the kinds of skipped work for Skipped.
+var skipOrder = []string{SkipRetries, SkipLatency, SkipEchoStats, SkipPorts, SkipAudit, SkipSNMP, SkipLocalNames, SkipRDNS, SkipProbes}
+
+// Shares of the budget after which work is given up: first what refines
+// the results, then what names the devices. Probing stops when the budget
+// is spent.
+const (
+	optionalShare = 0.5
+	namingShare   = 0.8
+)
+
+// Skip is work a Run left out to keep to its budget, and the number of
+// hosts it was left out for.
+type Skip struct {
+	What  string
+	Hosts int
+}
+
+// budget tracks the time of a Run with a Budget and the work it skipped.
+type budget struct {
+	start    time.Time
+	deadline time.Time
+
+	mu      sync.Mutex
+	skipped map[string]int
+}
+
+func newBudget(d time.Duration) *budget {
+	now := time.Now()
+	return &budget{start: now, deadline: now.Add(d), skipped: make(map[string]int)}
+}
+
+// allow reports whether work may still be done for a host, which it may
+// until share of the budget is spent; otherwise the host is counted as
+// skipped. A nil budget allows everything.
+func (b *budget) allow(work string, share float64) bool {
+	if b == nil {
+		return true
+	}
+	total := b.deadline.Sub(b.start)
+	if time.Since(b.start) < time.Duration(float64(total)*share) {
+		return true
+	}
+	b.skip(work, 1)
+	return false
+}
+
+// skip counts n hosts whose work was left out.
+func (b *budget) skip(work string, n int) {
+	if b == nil || n <= 0 {
+		return
+	}
+	b.mu.Lock()
+	b.skipped[work] += n
+	b.mu.Unlock()
+}
+
+// spent reports whether the budget has run out.
+func (b *budget) spent() bool {
+	return b != nil && !time.Now().Before(b.deadline)
+}
+
+// Skipped returns the work the last Run left out to keep to Budget, in
+// the order it was given up.
+func (s *Scanner) Skipped() []Skip {
+	b := s.budget
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var skips []Skip
+	for _, what := range skipOrder {
+		if n := b.skipped[what]; n > 0 {
+			skips = append(skips, Skip{what, n})
+		}
+	}
+	return skips
+}
@@ -0,0 +1,108 @@
+package scanner
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net"
+	"strconv"
+	"time"
+
+	"pingdisco.com/pingdisco/internal/device"
+	"pingdisco.com/pingdisco/internal/netops"
+)
+
+// echoStats summarises a burst of echo requests. Duplicate replies point at
+// bridging loops or misbehaving NICs; late replies, arriving after the
+// probe timeout, at overloaded links or odd NAT behaviour.
+type echoStats struct {
+	sent       int
+	received   int
+	duplicates int
+	late       int
+}
+
+// annotate records the statistics as attributes of d.
+func (s echoStats) annotate(d *device.Device) {
+	d.SetInt(device.AttrEchoSent, s.sent)
+	d.SetInt(device.AttrEchoReceived, s.received)
+	d.SetInt(device.AttrEchoDuplicates, s.duplicates)
+	d.SetInt(device.AttrEchoLate, s.late)
+}
+
+// measureEcho sends count echo requests to host and classifies the replies,
+// with ops.Echo where it is set and the ping command otherwise. It reports
+// false if host cannot be measured.
+func measureEcho(ctx context.Context, ops *netops.Ops, host string, count int, timeout time.Duration) (echoStats, bool) {
+	if ops.Echo != nil {
+		return sendEcho(ctx, ops.Echo, host, count, timeout)
+	}
+
+	// Wait past the timeout so late replies are still counted.
+	deadline := strconv.FormatInt(int64(2*timeout/time.Second)+int64(count), 10)
+	out, _ := ops.Runner.Run(ctx, "ping", "-c", strconv.Itoa(count), "-i", "0.2", "-w", deadline, host)
+	return parseEchoOutput(out, count, timeout), true
+}
+
+// echoInterval separates the echo requests sendEcho sends, as ping -i 0.2
+// does.
+const echoInterval = 200 * time.Millisecond
+
+// sendEcho sends count echo requests to host one at a time with e, each
+// waiting twice timeout so late replies are still counted.
+func sendEcho(ctx context.Context, e netops.EchoSender, host string, count int, timeout time.Duration) (echoStats, bool) {
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return echoStats{}, false
+	}
+
+	var stats echoStats
+	for ; stats.sent < count; stats.sent++ {
+		if stats.sent > 0 {
+			select {
+			case <-time.After(echoInterval):
+			case <-ctx.Done():
+				return stats, true
+			}
+		}
+		rtts, err := e.SendEcho(ctx, ip, 2*timeout)
+		if err != nil {
+			return echoStats{}, false
+		}
+		if len(rtts) == 0 {
+			continue
+		}
+		stats.received++
+		stats.duplicates += len(rtts) - 1
+		if rtts[0] > timeout {
+			stats.late++
+		}
+	}
+	return stats, true
+}
+
+func parseEchoOutput(out []byte, count int, timeout time.Duration) echoStats {
+	stats := echoStats{sent: count}
+
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		m := netops.ReplyTime.FindSubmatch(line)
+		if m == nil {
+			continue
+		}
+
+		if bytes.Contains(line, []byte("DUP!")) {
+			stats.duplicates++
+			continue
+		}
+		stats.received++
+
+		ms, err := strconv.ParseFloat(string(m[1]), 64)
+		if err == nil && time.Duration(ms*float64(time.Millisecond)) > timeout {
+			stats.late++
+		}
+	}
+
+	return stats
+}
@@ -0,0 +1,94 @@
+package scanner
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"pingdisco.com/pingdisco/internal/device"
+	"pingdisco.com/pingdisco/internal/netops"
+)
+
+// sampleGap is the pause between the echo requests timed for latency
+// statistics, so a burst does not queue behind itself on slow links.
+const sampleGap = 200 * time.Millisecond
+
+// latencyStats summarises the round-trip times of a series of echo
+// requests. Jitter is the mean difference between consecutive replies.
+type latencyStats struct {
+	sent     int
+	received int
+	min      time.Duration
+	avg      time.Duration
+	max      time.Duration
+	jitter   time.Duration
+}
+
+// measureLatency sends count echo requests to host one after another and
+// times the replies.
+func measureLatency(ctx context.Context, p netops.Pinger, host string, count int, timeout time.Duration) latencyStats {
+	var stats latencyStats
+	var rtts []time.Duration
+	for i := 0; i < count && ctx.Err() == nil; i++ {
+		if i > 0 {
+			select {
+			case <-time.After(sampleGap):
+			case <-ctx.Done():
+				return stats
+			}
+		}
+		stats.sent++
+		rtt, ok := netops.PingRTT(ctx, p, host, 1, timeout)
+		if !ok {
+			continue
+		}
+		stats.received++
+		if rtt > 0 {
+			rtts = append(rtts, rtt)
+		}
+	}
+
+	if len(rtts) == 0 {
+		return stats
+	}
+	var sum, diffs time.Duration
+	stats.min, stats.max = rtts[0], rtts[0]
+	for i, rtt := range rtts {
+		sum += rtt
+		stats.min = min(stats.min, rtt)
+		stats.max = max(stats.max, rtt)
+		if i > 0 {
+			diffs += (rtt - rtts[i-1]).Abs()
+		}
+	}
+	stats.avg = sum / time.Duration(len(rtts))
+	if len(rtts) > 1 {
+		stats.jitter = diffs / time.Duration(len(rtts)-1)
+	}
+	return stats
+}
+
+// loss returns the share of echo requests left unanswered, in percent.
+func (s latencyStats) loss() float64 {
+	if s.sent == 0 {
+		return 0
+	}
+	return 100 * float64(s.sent-s.received) / float64(s.sent)
+}
+
+// annotate records the statistics as attributes of d. Times are left out
+// when the pinger could not measure them.
+func (s latencyStats) annotate(d *device.Device) {
+	if s.sent == 0 {
+		return
+	}
+	d.SetInt(device.AttrLatencySent, s.sent)
+	d.Set(device.AttrLatencyLoss, strconv.FormatFloat(s.loss(), 'f', 1, 64))
+	if s.avg == 0 {
+		return
+	}
+	d.Set(device.AttrLatencyMin, s.min.String())
+	d.Set(device.AttrLatencyAvg, s.avg.String())
+	d.Set(device.AttrLatencyMax, s.max.String())
+	d.Set(device.AttrLatencyJitter, s.jitter.String())
+}
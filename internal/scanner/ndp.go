@@ -0,0 +1,166 @@
+package scanner
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"sort"
+	"sync"
+
+	"pingdisco.com/pingdisco/internal/device"
+	"pingdisco.com/pingdisco/internal/events"
+	"pingdisco.com/pingdisco/internal/netops"
+	"pingdisco.com/pingdisco/internal/targets"
+)
+
+// sweepLink6 finds the hosts of an IPv6 subnet on a local link: those that
+// answer an echo request to the all-nodes address, and those the NDP
+// neighbor table has resolved. Subnets that are not on a local link cannot
+// be discovered this way and yield nothing.
+func (s *Scanner) sweepLink6(ctx context.Context, g targets.Group) []*device.Device {
+	if g.Interface == "" {
+		return nil
+	}
+
+	found := make(map[string]netops.Reply)
+	if lp, ok := s.Ops.Pinger.(netops.LinkPinger); ok {
+		_, span := s.Tracer.Start(ctx, "multicast ping")
+		replies, err := lp.PingLink(ctx, g.Interface, g.Local, s.Probe.Timeout)
+		span.SetAttr("answered", len(replies))
+		span.Fail(err)
+		span.End()
+		for _, r := range replies {
+			found[r.IP.String()] = r
+		}
+	}
+
+	for _, n := range netops.NeighborsOn(s.Ops.NDP, g.Subnet) {
+		if _, ok := found[n.IP.String()]; !ok && n.Complete && (n.Interface == "" || n.Interface == g.Interface) {
+			found[n.IP.String()] = netops.Reply{IP: n.IP}
+		}
+	}
+
+	var devices []*device.Device
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	for key, r := range found {
+		if !g.Subnet.Contains(r.IP) || s.probed[key] {
+			continue
+		}
+		s.probed[key] = true
+
+		source := device.SourcePing
+		if r.RTT == 0 {
+			source = device.SourceNDP
+		}
+		wg.Add(1)
+		go func(r netops.Reply) {
+			defer wg.Done()
+			d := s.discovered(ctx, r.IP, source, s.Inventory.Lookup(r.IP.String()), g)
+			if r.RTT > 0 {
+				d.Set(device.AttrRTT, r.RTT.String())
+			}
+			s.Bus.Publish(events.Event{Type: events.DeviceEnriched, Group: g, Device: d})
+			mu.Lock()
+			devices = append(devices, d)
+			mu.Unlock()
+		}(r)
+	}
+	wg.Wait()
+	return devices
+}
+
+// correlate6 folds the addresses of one host into a single device, telling
+// hosts apart by interface and MAC address: a host on an IPv6 link usually
+// answers at a link-local address, a stable address and one or more
+// temporary privacy addresses at once. Addresses of a host already found in
+// an earlier group, over IPv4 or IPv6, are added to the device found there
+// and left out of this group's results. Devices without a MAC address are
+// kept as they are.
+func (s *Scanner) correlate6(g targets.Group, devices []*device.Device) []*device.Device {
+	// Fold into the most telling address: the stable one derived from the
+	// MAC, then other global ones, then link-local ones.
+	sort.SliceStable(devices, func(i, j int) bool {
+		return addressRank(devices[i].IP(), devices[i].MAC) < addressRank(devices[j].IP(), devices[j].MAC)
+	})
+
+	var kept []*device.Device
+	for _, d := range devices {
+		if d.MAC == nil {
+			kept = append(kept, d)
+			continue
+		}
+		key := g.Interface + " " + d.MAC.String()
+		host := s.hosts[key]
+		if host == nil {
+			s.hosts[key] = d
+			kept = append(kept, d)
+			continue
+		}
+		if host.IP().To4() != nil {
+			mergeDualStack(host, d)
+		} else {
+			host.Merge(d)
+		}
+		sort.SliceStable(host.Addresses, func(i, j int) bool {
+			return addressRank(host.Addresses[i], host.MAC) < addressRank(host.Addresses[j], host.MAC)
+		})
+		s.Bus.Publish(events.Event{Type: events.DeviceEnriched, Group: g, Device: host})
+	}
+	return kept
+}
+
+// addressRank orders the IPv6 addresses of a host with the given MAC by
+// how well they identify it. An IPv4 address the host was found at first
+// stays first.
+func addressRank(ip net.IP, mac net.HardwareAddr) int {
+	switch {
+	case ip.To4() != nil:
+		return -1
+	case ip.IsLinkLocalUnicast():
+		return 2
+	case bytes.Equal(ip.To16()[8:], eui64(mac)):
+		return 0
+	default:
+		return 1
+	}
+}
+
+// remember4 records the devices of an IPv4 group by interface and MAC
+// address, so correlate6 can fold their IPv6 addresses into them. A MAC
+// address answering for several addresses belongs to a router or NAT
+// device rather than one host and is left out.
+func (s *Scanner) remember4(g targets.Group, devices []*device.Device) {
+	if g.Interface == "" {
+		return
+	}
+	for _, d := range devices {
+		if d.MAC == nil || d.Int(device.AttrSharedMAC) > 0 {
+			continue
+		}
+		key := g.Interface + " " + d.MAC.String()
+		if s.hosts[key] == nil {
+			s.hosts[key] = d
+		}
+	}
+}
+
+// mergeDualStack folds d, found over IPv6, into host, found over IPv4,
+// keeping the round-trip time of each family apart.
+func mergeDualStack(host, d *device.Device) {
+	rtt4 := host.Get(device.AttrRTT)
+	host.Merge(d)
+	host.Set(device.AttrRTT, rtt4)
+	if host.Get(device.AttrRTT6) == "" {
+		host.Set(device.AttrRTT6, d.Get(device.AttrRTT))
+	}
+}
+
+// eui64 returns the interface identifier SLAAC derives from mac, or nil if
+// mac is not a 48-bit MAC address.
+func eui64(mac net.HardwareAddr) []byte {
+	if len(mac) != 6 {
+		return nil
+	}
+	return []byte{mac[0] ^ 0x02, mac[1], mac[2], 0xff, 0xfe, mac[3], mac[4], mac[5]}
+}
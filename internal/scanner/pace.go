@@ -0,0 +1,76 @@
+package scanner
+
+import (
+	"fmt"
+	"time"
+
+	"pingdisco.com/pingdisco/internal/netinfo"
+	"pingdisco.com/pingdisco/internal/targets"
+)
+
+// Probe rates, in hosts per second, for constrained and slow links. A
+// probe is a few small packets and a reverse DNS lookup, so even the slow
+// rate finishes a /24 in under 15 seconds while leaving a tethered phone
+// or a weak mesh hop usable.
+const (
+	slowRate        = 20
+	constrainedRate = 100
+)
+
+// Pace is how far apart probes are started.
+type Pace struct {
+	// Gap is the time between the starts of two probes; zero is unpaced.
+	Gap time.Duration
+	// Reason says what made the scan paced.
+	Reason string
+}
+
+// slower returns whichever of p and q leaves more time between probes.
+func (p Pace) slower(q Pace) Pace {
+	if q.Gap > p.Gap {
+		return q
+	}
+	return p
+}
+
+func rate(hostsPerSecond int, reason string) Pace {
+	return Pace{time.Second / time.Duration(hostsPerSecond), reason}
+}
+
+// PaceFor returns the pace that keeps a scan from saturating l.
+func PaceFor(l netinfo.Link) Pace {
+	switch {
+	case l.Cellular:
+		return rate(slowRate, fmt.Sprintf("cellular link on %s", l.Interface))
+	case l.Speed > 0 && l.Speed < 10:
+		return rate(slowRate, fmt.Sprintf("%d Mbit/s link on %s", l.Speed, l.Interface))
+	case l.Wireless && l.Quality >= 0 && l.Quality < 40:
+		return rate(slowRate, fmt.Sprintf("weak Wi-Fi signal on %s (%d%% link quality)", l.Interface, l.Quality))
+	case l.Speed > 0 && l.Speed < 100:
+		return rate(constrainedRate, fmt.Sprintf("%d Mbit/s link on %s", l.Speed, l.Interface))
+	case l.Wireless && l.Quality >= 0 && l.Quality < 60:
+		return rate(constrainedRate, fmt.Sprintf("fair Wi-Fi signal on %s (%d%% link quality)", l.Interface, l.Quality))
+	}
+	return Pace{}
+}
+
+// pace returns the slowest of Rate, the spreading of the run over Spread
+// and the pace for the local link g is reached through: its own interface,
+// or for a routed subnet the one its route leaves by.
+func (s *Scanner) pace(g targets.Group) Pace {
+	var pace Pace
+	iface := g.Interface
+	if iface == "" && g.Subnet != nil {
+		iface = netinfo.InterfaceFor(g.Subnet.IP)
+	}
+	if s.Ops.Links != nil && iface != "" {
+		pace = PaceFor(s.Ops.Links.Link(iface))
+	}
+	if s.Rate > 0 {
+		pace = pace.slower(rate(s.Rate, "rate limit"))
+	}
+	if s.spread > 0 {
+		pace = pace.slower(Pace{s.spread, fmt.Sprintf("spread across %s", s.Spread)})
+	}
+	return pace
+}
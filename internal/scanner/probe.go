@@ -0,0 +1,206 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net"
+	"strconv"
+	"syscall"
+	"time"
+
+	"pingdisco.com/pingdisco/internal/hostname"
+	"pingdisco.com/pingdisco/internal/inventory"
+	"pingdisco.com/pingdisco/internal/netops"
+	"pingdisco.com/pingdisco/internal/probelog"
+)
+
+// Probe is how each host is probed.
+type Probe struct {
+	Timeout time.Duration
+	Count   int
+	// EchoStats is the number of echo requests sent to each responding
+	// host to look for duplicate and late replies; zero disables it.
+	EchoStats int
+	// Samples is the number of echo requests timed for each host that
+	// answers a ping, for its round-trip time, jitter and loss; zero
+	// disables it.
+	Samples int
+	// Ports are the TCP ports tried on each host that answers, to list
+	// those open; nil tries none.
+	Ports []int
+	// Offline decides how many probes a host must miss to be offline; the
+	// zero policy gives up after one.
+	Offline OfflinePolicy
+	// Log, if set, records every attempt to find a host up.
+	Log *probelog.Log
+}
+
+// DefaultProbe waits a second for each probe and gives up on a host as
+// DefaultOfflinePolicy says.
+var DefaultProbe = Probe{Timeout: time.Second, Count: 1, Offline: DefaultOfflinePolicy}
+
+// OfflinePolicy is how sure a probe must be before it calls a host offline.
+// One unanswered probe proves little on Wi-Fi, where a share of packets is
+// always lost, so a host is given up on only after missing so many probes,
+// spaced apart, that an online host would have answered one of them with
+// the required confidence.
+type OfflinePolicy struct {
+	// Confidence is the required probability, below 1, that a host that
+	// answered none of the probes is offline rather than unlucky.
+	Confidence float64
+	// Loss is the share of probes an online host is assumed to miss.
+	Loss float64
+	// Spacing separates the probes, so one burst of interference does not
+	// take them all.
+	Spacing time.Duration
+	// Attempts, if positive, is the number of probes a host must miss,
+	// whatever Confidence and Loss would call for.
+	Attempts int
+}
+
+// MaxSamples bounds the probes sent to a host, whatever the policy.
+const MaxSamples = 10
+
+// DefaultOfflinePolicy gives up on a host after two probes: if one probe in
+// ten is lost, an online host misses both once in a hundred scans.
+var DefaultOfflinePolicy = OfflinePolicy{Confidence: 0.99, Loss: 0.1, Spacing: 250 * time.Millisecond}
+
+// Samples returns the number of probes a host must miss to be offline:
+// the fewest whose chance of all being lost, Loss to the power of their
+// number, is within 1 - Confidence, unless Attempts fixes it.
+func (p OfflinePolicy) Samples() int {
+	if p.Attempts > 0 {
+		return min(p.Attempts, MaxSamples)
+	}
+	if p.Loss <= 0 || p.Confidence <= 0 {
+		return 1
+	}
+	if p.Loss >= 1 || p.Confidence >= 1 {
+		return MaxSamples
+	}
+	// The epsilon keeps exact powers, such as 0.1^2 = 0.01, from
+	// rounding up to one more probe.
+	n := int(math.Ceil(math.Log(1-p.Confidence)/math.Log(p.Loss) - 1e-9))
+	return min(max(n, 1), MaxSamples)
+}
+
+// ProbeHost probes host the way its inventory entry asks for, falling back
+// to ping.
+func ProbeHost(ctx context.Context, ops *netops.Ops, host string, probe Probe, known *inventory.Device) bool {
+	_, up := probeHost(ctx, ops, host, probe, known)
+	return up
+}
+
+// probeHost is ProbeHost that also returns the round-trip time of the
+// answer, or zero if it was not measured. It probes until the host answers
+// or has missed as many probes as probe.Offline asks for.
+func probeHost(ctx context.Context, ops *netops.Ops, host string, probe Probe, known *inventory.Device) (time.Duration, bool) {
+	samples := probe.Offline.Samples()
+	for i := 0; i < samples && ctx.Err() == nil; i++ {
+		if i > 0 {
+			select {
+			case <-time.After(probe.Offline.Spacing):
+			case <-ctx.Done():
+				return 0, false
+			}
+		}
+		sent := time.Now()
+		rtt, up := probeOnce(ctx, ops, host, probe, known)
+		if probe.Log != nil && ctx.Err() == nil {
+			probe.Log.Record(probelog.Entry{Time: sent, Target: host, Method: probeMethod(ops, known), Attempt: i + 1, Up: up, RTT: rtt, Timeout: probeTimeout(probe, known)})
+		}
+		if up {
+			return rtt, true
+		}
+	}
+	return 0, false
+}
+
+// probeOnce sends one probe, or probe.Count of them at once, the way the
+// inventory entry of host asks for.
+func probeOnce(ctx context.Context, ops *netops.Ops, host string, probe Probe, known *inventory.Device) (time.Duration, bool) {
+	if known == nil || known.Probe == nil {
+		return netops.PingRTT(ctx, ops.Pinger, host, probe.Count, probe.Timeout)
+	}
+
+	if known.Probe.Timeout > 0 {
+		probe.Timeout = time.Duration(known.Probe.Timeout)
+	}
+
+	switch known.Probe.Method {
+	case inventory.ProbeTCP:
+		return tcpProbe(ctx, ops.Dialer, host, known.Probe.Port, probe)
+	default:
+		return netops.PingRTT(ctx, ops.Pinger, host, probe.Count, probe.Timeout)
+	}
+}
+
+// probeMethod names how probeOnce probes host for the probe log.
+func probeMethod(ops *netops.Ops, known *inventory.Device) string {
+	if known != nil && known.Probe != nil && known.Probe.Method == inventory.ProbeTCP {
+		return "tcp:" + strconv.Itoa(known.Probe.Port)
+	}
+	if _, ok := ops.Pinger.(netops.TCPPinger); ok {
+		return "tcp"
+	}
+	return "icmp"
+}
+
+// probeTimeout is the time probeOnce waits for host to answer.
+func probeTimeout(probe Probe, known *inventory.Device) time.Duration {
+	if known != nil && known.Probe != nil && known.Probe.Timeout > 0 {
+		return time.Duration(known.Probe.Timeout)
+	}
+	return probe.Timeout
+}
+
+// Ping reports whether host answers an echo request.
+func Ping(ctx context.Context, ops *netops.Ops, host string, probe Probe) bool {
+	return ops.Pinger.Ping(ctx, host, probe.Count, probe.Timeout)
+}
+
+// tcpProbe reports a host as up if it accepts or actively refuses a
+// connection to port made with dialer, or directly if it is nil, and how
+// long that took.
+func tcpProbe(ctx context.Context, dialer netops.Dialer, host string, port int, probe Probe) (time.Duration, bool) {
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+	if dialer == nil {
+		dialer = &net.Dialer{}
+	}
+
+	for i := 0; i < max(probe.Count, 1) && ctx.Err() == nil; i++ {
+		start := time.Now()
+		dctx, cancel := context.WithTimeout(ctx, probe.Timeout)
+		conn, err := dialer.DialContext(dctx, "tcp", addr)
+		cancel()
+		if err == nil {
+			conn.Close()
+			return time.Since(start), true
+		}
+		if errors.Is(err, syscall.ECONNREFUSED) {
+			return time.Since(start), true
+		}
+	}
+	return 0, false
+}
+
+// ResolveHostname returns the cleaned reverse DNS name of ip, or "".
+func ResolveHostname(ctx context.Context, r netops.Resolver, ip string) string {
+	names, err := r.LookupAddr(ctx, ip)
+	if err != nil || len(names) == 0 {
+		return ""
+	}
+
+	return hostname.Clean(names[0])
+}
+
+// resolveLocal returns the cleaned name the host at ip gives itself over
+// mDNS or LLMNR and the source it came from, or two empty strings.
+func resolveLocal(ctx context.Context, l netops.LocalResolver, ip string) (string, string) {
+	name, source := l.LookupLocal(ctx, ip)
+	if name == "" {
+		return "", ""
+	}
+	return hostname.Clean(name), source
+}
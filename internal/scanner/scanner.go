@@ -0,0 +1,467 @@
+// Package scanner is the discovery engine behind every command that sweeps
+// the network: it probes target groups, names and enriches the devices
+// that answer and publishes its progress on an event bus. The public
+// pkg/discovery package wraps it for programs outside this module.
+package scanner
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"pingdisco.com/pingdisco/internal/device"
+	"pingdisco.com/pingdisco/internal/events"
+	"pingdisco.com/pingdisco/internal/experiments"
+	"pingdisco.com/pingdisco/internal/hostname"
+	"pingdisco.com/pingdisco/internal/inventory"
+	"pingdisco.com/pingdisco/internal/netinfo"
+	"pingdisco.com/pingdisco/internal/netops"
+	"pingdisco.com/pingdisco/internal/overlay"
+	"pingdisco.com/pingdisco/internal/portscan"
+	"pingdisco.com/pingdisco/internal/quality"
+	"pingdisco.com/pingdisco/internal/snmp"
+	"pingdisco.com/pingdisco/internal/ssdp"
+	"pingdisco.com/pingdisco/internal/targets"
+	"pingdisco.com/pingdisco/internal/telemetry"
+)
+
+// DefaultWorkers is the number of hosts a Scanner probes at once unless
+// told otherwise: enough to sweep a /24 in about a probe timeout, while a
+// /16 never has more than this many probes in flight.
+const DefaultWorkers = 256
+
+// Scanner probes target groups and publishes what it finds on Bus: each
+// device as it answers, again once it has been enriched, and the sorted
+// result when a group finishes. A Scanner without a bus only returns its
+// results. Network operations go through Ops, so tests can run the
+// scanner against the fakes in netopstest; a nil Ops means the real
+// network.
+type Scanner struct {
+	Probe     Probe
+	Inventory *inventory.Inventory
+	Ops       *netops.Ops
+	Bus       *events.Bus
+	// Tracer records a span for each scan phase; nil records nothing.
+	Tracer *telemetry.Tracer
+	// Experiments enables discovery methods that are off by default.
+	Experiments experiments.Set
+	// ARP also sweeps directly attached subnets with ARP requests, finding
+	// the hosts that drop ICMP.
+	ARP bool
+	// SSDP also multicasts an SSDP search on directly attached subnets,
+	// finding UPnP devices such as smart TVs that may ignore ping, and
+	// describes every device that answers.
+	SSDP bool
+	// SNMP, if set, reads the system group of every device found with the
+	// credentials of this client, whose Target is ignored, labelling
+	// switches, routers and other network gear.
+	SNMP *snmp.Client
+	// Audit confirms every device found by a second, independent signal
+	// where it can, and records the signals each gave; see audit.
+	Audit bool
+	// Overlay, if set, names the Tailscale peers and ZeroTier members
+	// found from what their local clients know.
+	Overlay *overlay.Directory
+
+	// Workers is the number of hosts probed at once; zero means
+	// DefaultWorkers.
+	Workers int
+	// Rate limits the hosts probed per second, so a sweep does not look
+	// like an attack to intrusion detection; zero leaves the rate to the
+	// link, see PaceFor.
+	Rate int
+	// Spread paces each Run so its probes are spread evenly across this
+	// long, instead of bursting, for scans repeated on a schedule; zero
+	// probes as fast as allowed.
+	Spread time.Duration
+	// Stream drops the devices of each group once it has been published,
+	// so Run returns nothing.
+	Stream bool
+	// Budget is the time each Run aims to finish in. As it runs short,
+	// retries and enrichment are left out, and probing stops when it is
+	// spent, Run returning the devices found by then; Skipped reports
+	// what was left out. Zero is no limit.
+	Budget time.Duration
+
+	// probed holds the addresses already scanned, so a host covered by
+	// several sources is only probed once.
+	probed map[string]bool
+	// hosts holds the devices found so far by interface and MAC address,
+	// so the IPv6 addresses of one host, and those of a host already found
+	// over IPv4, are merged into one device.
+	hosts map[string]*device.Device
+	// spread is the gap between probes that spreads the current Run
+	// across Spread.
+	spread time.Duration
+	// budget tracks the current Run against Budget.
+	budget *budget
+}
+
+// Run scans the groups of every source in order and returns all devices
+// found. Once ctx is done it stops probing, abandons the probes in flight
+// and returns the devices found so far with the context's error.
+func (s *Scanner) Run(ctx context.Context, sources ...targets.Source) ([]*device.Device, error) {
+	s.budget = nil
+	if s.Budget <= 0 {
+		return s.run(ctx, sources)
+	}
+
+	s.budget = newBudget(s.Budget)
+	budgetCtx, cancel := context.WithDeadline(ctx, s.budget.deadline)
+	defer cancel()
+	devices, err := s.run(budgetCtx, sources)
+	if ctx.Err() == nil && s.budget.spent() {
+		// Running out of budget is not a failure: the caller asked
+		// for what could be found in the time.
+		err = nil
+	}
+	return devices, err
+}
+
+func (s *Scanner) run(ctx context.Context, sources []targets.Source) ([]*device.Device, error) {
+	var groups []targets.Group
+	for _, src := range sources {
+		_, span := s.Tracer.Start(ctx, "targets")
+		g, err := src.Groups(ctx)
+		span.SetAttr("groups", len(g))
+		span.Fail(err)
+		span.End()
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, g...)
+	}
+
+	s.spread = 0
+	if s.Spread > 0 {
+		n := 0
+		for _, g := range groups {
+			if g.Skip == "" {
+				n += g.Size()
+			}
+		}
+		if n > 0 {
+			s.spread = s.Spread / time.Duration(n)
+		}
+	}
+
+	s.Bus.Publish(events.Event{Type: events.ScanPlanned, Hosts: s.planned(groups)})
+
+	var all []*device.Device
+	for i, g := range groups {
+		if ctx.Err() != nil {
+			if s.budget.spent() {
+				for _, g := range groups[i:] {
+					if g.Skip == "" {
+						s.budget.skip(SkipProbes, g.Size())
+					}
+				}
+			}
+			return all, ctx.Err()
+		}
+		if g.Skip != "" {
+			s.Bus.Publish(events.Event{Type: events.ScanSkipped, Group: g})
+			continue
+		}
+		devices := s.scan(ctx, g)
+		if !s.Stream {
+			all = append(all, devices...)
+		}
+	}
+	return all, ctx.Err()
+}
+
+// planned counts the addresses of groups that have not been probed yet, as
+// scan will probe them.
+func (s *Scanner) planned(groups []targets.Group) int {
+	seen := make(map[string]bool)
+	for _, g := range groups {
+		if g.Skip != "" {
+			continue
+		}
+		for _, ip := range g.Addresses() {
+			if key := ip.String(); !s.probed[key] {
+				seen[key] = true
+			}
+		}
+	}
+	return len(seen)
+}
+
+// Reset forgets the addresses scanned so far, so the next Run probes them
+// again.
+func (s *Scanner) Reset() {
+	s.probed = nil
+	s.hosts = nil
+}
+
+func (s *Scanner) scan(ctx context.Context, g targets.Group) []*device.Device {
+	if s.probed == nil {
+		s.probed = make(map[string]bool)
+		s.hosts = make(map[string]*device.Device)
+	}
+	if s.Ops == nil {
+		s.Ops = netops.System()
+	}
+
+	var addrs []net.IP
+	for _, ip := range g.Addresses() {
+		if !s.probed[ip.String()] {
+			s.probed[ip.String()] = true
+			addrs = append(addrs, ip)
+		}
+	}
+	if len(addrs) == 0 && !g.IPv6() {
+		return nil
+	}
+
+	ctx, span := s.Tracer.Start(ctx, "scan group")
+	span.SetAttr("group", g.Name)
+	span.SetAttr("addresses", len(addrs))
+	defer span.End()
+
+	pace := s.pace(g)
+	s.Bus.Publish(events.Event{Type: events.ScanStarted, Group: g, Pace: pace.Gap, PaceReason: pace.Reason})
+
+	_, probing := s.Tracer.Start(ctx, "probe")
+	var devices []*device.Device
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+
+	var swept chan []netinfo.Neighbor
+	if s.ARP && s.Ops.ARP != nil && g.Subnet != nil && !g.IPv6() {
+		swept = make(chan []netinfo.Neighbor, 1)
+		go func() { swept <- s.sweepARP(ctx, g, addrs) }()
+	}
+
+	var upnp chan []ssdp.Response
+	if s.SSDP && g.Interface != "" && g.Local != nil && g.Subnet != nil && !g.IPv6() {
+		upnp = make(chan []ssdp.Response, 1)
+		go func() { upnp <- s.searchSSDP(ctx, g) }()
+	}
+
+	var tick <-chan time.Time
+	if pace.Gap > 0 {
+		t := time.NewTicker(pace.Gap)
+		defer t.Stop()
+		tick = t.C
+	}
+
+	work := make(chan net.IP)
+	workers := s.Workers
+	if workers <= 0 {
+		workers = DefaultWorkers
+	}
+	for range min(workers, len(addrs)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ip := range work {
+				d := s.probeOne(ctx, ip, g)
+				if d != nil {
+					mu.Lock()
+					devices = append(devices, d)
+					mu.Unlock()
+				}
+				s.Bus.Publish(events.Event{Type: events.HostProbed, Group: g, Device: d})
+			}
+		}()
+	}
+
+	fed := 0
+feed:
+	for i, ip := range addrs {
+		if tick != nil && i > 0 {
+			select {
+			case <-tick:
+			case <-ctx.Done():
+				break feed
+			}
+		}
+		select {
+		case work <- ip:
+			fed++
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(work)
+	if ctx.Err() != nil && s.budget.spent() {
+		s.budget.skip(SkipProbes, len(addrs)-fed)
+	}
+
+	wg.Wait()
+	if g.IPv6() {
+		devices = s.sweepLink6(ctx, g)
+	}
+	if swept != nil {
+		devices = s.mergeARP(ctx, <-swept, devices, g)
+	}
+	if upnp != nil {
+		devices = s.mergeSSDP(ctx, <-upnp, devices, g)
+	}
+	if g.Subnet != nil && !g.IPv6() && s.Experiments.Enabled(experiments.SilentHosts) {
+		devices = append(devices, s.silentHosts(ctx, addrs, devices, g)...)
+	}
+	probing.SetAttr("devices", len(devices))
+	probing.End()
+	s.Tracer.Add("pingdisco.hosts.probed", "{host}", int64(len(addrs)))
+	s.Tracer.Add("pingdisco.devices.found", "{device}", int64(len(devices)))
+
+	if g.Subnet != nil {
+		_, enrich := s.Tracer.Start(ctx, "enrich")
+		table := s.Ops.Neighbors
+		if g.IPv6() {
+			table = s.Ops.NDP
+		}
+		for _, d := range annotateMACs(table, devices, g.Subnet) {
+			s.Bus.Publish(events.Event{Type: events.DeviceEnriched, Group: g, Device: d})
+		}
+		if g.IPv6() {
+			devices = s.correlate6(g, devices)
+		} else if !s.Stream {
+			s.remember4(g, devices)
+		}
+		enrich.End()
+	}
+	if s.Audit {
+		s.audit(ctx, devices, g)
+	}
+	if s.Overlay != nil {
+		for _, d := range devices {
+			if s.Overlay.Annotate(d) {
+				s.Bus.Publish(events.Event{Type: events.DeviceEnriched, Group: g, Device: d})
+			}
+		}
+	}
+
+	sort.Slice(devices, func(i, j int) bool {
+		return bytes.Compare(devices[i].IP(), devices[j].IP()) < 0
+	})
+
+	_, output := s.Tracer.Start(ctx, "output")
+	s.Bus.Publish(events.Event{Type: events.ScanFinished, Group: g, Devices: devices})
+	output.End()
+	return devices
+}
+
+// probeOne probes ip and, if it answers, enriches the device with its
+// hostname, inventory expectations, latency, echo statistics and open
+// ports.
+func (s *Scanner) probeOne(ctx context.Context, ip net.IP, g targets.Group) *device.Device {
+	known := s.Inventory.Lookup(ip.String())
+	probe := s.Probe
+	if probe.Offline.Samples() > 1 && !s.budget.allow(SkipRetries, optionalShare) {
+		probe.Offline = OfflinePolicy{}
+	}
+	start := time.Now()
+	rtt, up := probeHost(ctx, s.Ops, ip.String(), probe, known)
+	s.Tracer.Observe("pingdisco.probe.duration", time.Since(start))
+	if !up {
+		return nil
+	}
+
+	source := device.SourcePing
+	if known != nil && known.Probe != nil && known.Probe.Method == inventory.ProbeTCP {
+		source = device.SourceTCP
+	}
+	if _, ok := s.Ops.Pinger.(netops.TCPPinger); ok {
+		source = device.SourceTCP
+	}
+	d := s.discovered(ctx, ip, source, known, g)
+	if rtt > 0 {
+		d.Set(device.AttrRTT, rtt.String())
+	}
+	if s.Probe.Samples > 0 && source == device.SourcePing && s.budget.allow(SkipLatency, optionalShare) {
+		measureLatency(ctx, s.Ops.Pinger, ip.String(), s.Probe.Samples, s.Probe.Timeout).annotate(d)
+		quality.Annotate(d)
+	}
+	if s.Probe.EchoStats > 0 && s.budget.allow(SkipEchoStats, optionalShare) {
+		if stats, ok := measureEcho(ctx, s.Ops, ip.String(), s.Probe.EchoStats, s.Probe.Timeout); ok {
+			stats.annotate(d)
+		}
+	}
+	if len(s.Probe.Ports) > 0 && s.budget.allow(SkipPorts, optionalShare) {
+		d.Set(device.AttrOpenPorts, portscan.Format(portscan.ScanVia(ctx, s.Ops.Dialer, ip.String(), s.Probe.Ports, s.Probe.Timeout)))
+	}
+	if s.SNMP != nil && s.budget.allow(SkipSNMP, optionalShare) {
+		s.querySNMP(ctx, d)
+	}
+	s.Bus.Publish(events.Event{Type: events.DeviceEnriched, Group: g, Device: d})
+
+	return d
+}
+
+// discovered announces a device found at ip and names it from reverse DNS,
+// failing that over mDNS or LLMNR on directly attached subnets, and from
+// the inventory.
+func (s *Scanner) discovered(ctx context.Context, ip net.IP, source string, known *inventory.Device, g targets.Group) *device.Device {
+	d := device.New(ip, source, time.Now())
+	s.Bus.Publish(events.Event{Type: events.DeviceDiscovered, Group: g, Device: d})
+
+	// Short of time, the device is left unnamed, and so cannot be
+	// checked against the name the inventory expects either.
+	hostname := ""
+	named := s.budget.allow(SkipRDNS, namingShare)
+	if named {
+		start := time.Now()
+		hostname = ResolveHostname(ctx, s.Ops.Resolver, ip.String())
+		s.Tracer.Observe("pingdisco.rdns.duration", time.Since(start))
+		d.AddName(hostname, device.SourceRDNS)
+	}
+	if named && hostname == "" && g.Interface != "" && s.Ops.Local != nil && s.budget.allow(SkipLocalNames, optionalShare) {
+		start := time.Now()
+		var from string
+		hostname, from = resolveLocal(ctx, s.Ops.Local, ip.String())
+		s.Tracer.Observe("pingdisco.local_name.duration", time.Since(start))
+		d.AddName(hostname, from)
+	}
+	if known != nil {
+		d.AddName(known.Name, device.SourceInventory)
+	}
+	if named && !known.HostnameMatches(hostname) {
+		d.Set(device.AttrExpectedHostname, known.ExpectedHostname)
+	}
+	identifyFromNames(d)
+	return d
+}
+
+// silentHosts returns devices for the addresses probed without an answer
+// that nonetheless resolved in the neighbor table: a host whose firewall
+// drops ICMP still has to answer ARP to be reachable at all.
+func (s *Scanner) silentHosts(ctx context.Context, addrs []net.IP, found []*device.Device, g targets.Group) []*device.Device {
+	quiet := make(map[string]bool, len(addrs))
+	for _, ip := range addrs {
+		quiet[ip.String()] = true
+	}
+	for _, d := range found {
+		delete(quiet, d.IP().String())
+	}
+
+	var silent []*device.Device
+	for _, n := range netops.NeighborsOn(s.Ops.Neighbors, g.Subnet) {
+		ip := n.IP.String()
+		if !n.Complete || !quiet[ip] || n.IP.Equal(g.Local) {
+			continue
+		}
+		delete(quiet, ip)
+
+		d := s.discovered(ctx, n.IP, device.SourceARP, s.Inventory.Lookup(ip), g)
+		s.Bus.Publish(events.Event{Type: events.DeviceEnriched, Group: g, Device: d})
+		silent = append(silent, d)
+	}
+	return silent
+}
+
+// identifyFromNames guesses the vendor, OS and type of d from its names.
+func identifyFromNames(d *device.Device) {
+	for _, n := range d.Names {
+		hints := hostname.Describe(n.Name)
+		d.Identify(device.FieldVendor, hints.Vendor, device.SourceNamePattern, device.Low)
+		d.Identify(device.FieldOS, hints.OS, device.SourceNamePattern, device.Low)
+		d.Identify(device.FieldType, hints.Type, device.SourceNamePattern, device.Low)
+	}
+}
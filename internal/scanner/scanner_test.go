@@ -0,0 +1,209 @@
+package scanner_test
+
+import (
+	"context"
+	"net"
+	"slices"
+	"testing"
+	"time"
+
+	"pingdisco.com/pingdisco/internal/device"
+	"pingdisco.com/pingdisco/internal/netinfo"
+	"pingdisco.com/pingdisco/internal/netops/netopstest"
+	"pingdisco.com/pingdisco/internal/scanner"
+	"pingdisco.com/pingdisco/internal/targets"
+)
+
+// groups is a source of fixed target groups.
+func groups(gs ...targets.Group) targets.Source {
+	return targets.SourceFunc(func(context.Context) ([]targets.Group, error) {
+		return gs, nil
+	})
+}
+
+func subnet(s string) *net.IPNet {
+	ip, n, err := net.ParseCIDR(s)
+	if err != nil {
+		panic(err)
+	}
+	// Keep the host bits, as an interface address does.
+	n.IP = ip.To4()
+	if n.IP == nil {
+		n.IP = ip
+	}
+	return n
+}
+
+func hosts(ss ...string) []net.IP {
+	ips := make([]net.IP, len(ss))
+	for i, s := range ss {
+		ips[i] = net.ParseIP(s).To4()
+	}
+	return ips
+}
+
+func addresses(devices []*device.Device) []string {
+	var ips []string
+	for _, d := range devices {
+		ips = append(ips, d.IP().String())
+	}
+	return ips
+}
+
+func newScanner() (*scanner.Scanner, *netopstest.Pinger, *netopstest.Neighbors) {
+	ops, pinger, _, neighbors, _ := netopstest.New()
+	s := &scanner.Scanner{
+		Probe: scanner.Probe{Timeout: time.Millisecond, Count: 1},
+		Ops:   ops,
+	}
+	return s, pinger, neighbors
+}
+
+func TestRunSubnetAddresses(t *testing.T) {
+	tests := []struct {
+		name      string
+		subnet    string
+		first     string
+		last      string
+		count     int
+		skipped   []string
+		contained []string
+	}{
+		{
+			name:    "host bits are masked off",
+			subnet:  "192.168.1.77/29",
+			first:   "192.168.1.73",
+			last:    "192.168.1.78",
+			count:   6,
+			skipped: []string{"192.168.1.72", "192.168.1.79"},
+		},
+		{
+			name:      "increment carries into the next octet",
+			subnet:    "10.0.0.1/23",
+			first:     "10.0.0.1",
+			last:      "10.0.1.254",
+			count:     510,
+			skipped:   []string{"10.0.0.0", "10.0.1.255"},
+			contained: []string{"10.0.0.254", "10.0.0.255", "10.0.1.0", "10.0.1.1"},
+		},
+		{
+			name:   "point-to-point link",
+			subnet: "10.0.0.4/31",
+			first:  "10.0.0.4",
+			last:   "10.0.0.5",
+			count:  2,
+		},
+		{
+			name:   "single host",
+			subnet: "10.0.0.255/32",
+			first:  "10.0.0.255",
+			last:   "10.0.0.255",
+			count:  1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, pinger, _ := newScanner()
+			if _, err := s.Run(context.Background(), groups(targets.Group{Subnet: subnet(tt.subnet)})); err != nil {
+				t.Fatal(err)
+			}
+
+			calls := slices.Clone(pinger.Calls)
+			slices.SortFunc(calls, func(a, b string) int {
+				return slices.Compare(net.ParseIP(a).To4(), net.ParseIP(b).To4())
+			})
+			if len(calls) != tt.count {
+				t.Fatalf("probed %d addresses, want %d", len(calls), tt.count)
+			}
+			if calls[0] != tt.first || calls[len(calls)-1] != tt.last {
+				t.Errorf("probed %s to %s, want %s to %s", calls[0], calls[len(calls)-1], tt.first, tt.last)
+			}
+			for _, ip := range tt.skipped {
+				if slices.Contains(calls, ip) {
+					t.Errorf("probed %s", ip)
+				}
+			}
+			for _, ip := range tt.contained {
+				if !slices.Contains(calls, ip) {
+					t.Errorf("did not probe %s", ip)
+				}
+			}
+		})
+	}
+}
+
+func TestRunProbesEachAddressOnce(t *testing.T) {
+	s, pinger, _ := newScanner()
+	pinger.SetUp("10.0.0.2", "10.0.0.9")
+	src := groups(
+		targets.Group{Name: "a", Subnet: subnet("10.0.0.0/29")},
+		targets.Group{Name: "b", Hosts: hosts("10.0.0.2", "10.0.0.9", "10.0.0.9")},
+	)
+
+	devices, err := s.Run(context.Background(), src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := addresses(devices), []string{"10.0.0.2", "10.0.0.9"}; !slices.Equal(got, want) {
+		t.Errorf("found %v, want %v", got, want)
+	}
+	if len(pinger.Calls) != 7 {
+		t.Errorf("made %d probes, want 7: %v", len(pinger.Calls), pinger.Calls)
+	}
+
+	// A second run only probes what the first did not cover, until Reset.
+	pinger.Calls = nil
+	if devices, _ := s.Run(context.Background(), src); len(devices) != 0 || len(pinger.Calls) != 0 {
+		t.Errorf("second run found %v with probes %v, want nothing", addresses(devices), pinger.Calls)
+	}
+	s.Reset()
+	if devices, _ := s.Run(context.Background(), src); len(devices) != 2 || len(pinger.Calls) != 7 {
+		t.Errorf("run after Reset found %v with %d probes, want 2 devices and 7 probes", addresses(devices), len(pinger.Calls))
+	}
+}
+
+func TestRunMergesDualStackHosts(t *testing.T) {
+	s, pinger, neighbors := newScanner()
+	mac, _ := net.ParseMAC("00:11:32:aa:bb:cc")
+	pinger.SetUp("192.168.1.40", "fd00::40")
+	neighbors.Table = []netinfo.Neighbor{
+		{IP: net.ParseIP("192.168.1.40").To4(), MAC: mac, Interface: "eth0", Complete: true},
+		{IP: net.ParseIP("fd00::40"), MAC: mac, Interface: "eth0", Complete: true},
+	}
+	src := groups(
+		targets.Group{Subnet: subnet("192.168.1.1/24"), Interface: "eth0"},
+		targets.Group{Subnet: subnet("fd00::1/64"), Interface: "eth0"},
+	)
+
+	devices, err := s.Run(context.Background(), src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(devices) != 1 {
+		t.Fatalf("found %v, want one device", addresses(devices))
+	}
+	d := devices[0]
+	if got := len(d.Addresses); got != 2 || !d.Addresses[1].Equal(net.ParseIP("fd00::40")) {
+		t.Errorf("device has addresses %v, want 192.168.1.40 and fd00::40", d.Addresses)
+	}
+}
+
+func TestRunSortsDevicesByAddress(t *testing.T) {
+	s, pinger, _ := newScanner()
+	pinger.SetUp("10.0.1.3", "10.0.0.200", "10.0.0.20", "10.0.0.3", "10.0.2.1")
+	src := groups(
+		targets.Group{Subnet: subnet("10.0.0.0/23")},
+		targets.Group{Hosts: hosts("10.0.2.1")},
+	)
+
+	devices, err := s.Run(context.Background(), src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// By address bytes within each group, not as text, and groups in
+	// the order of their source.
+	want := []string{"10.0.0.3", "10.0.0.20", "10.0.0.200", "10.0.1.3", "10.0.2.1"}
+	if got := addresses(devices); !slices.Equal(got, want) {
+		t.Errorf("found %v, want %v", got, want)
+	}
+}
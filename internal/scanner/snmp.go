@@ -0,0 +1,38 @@
+package scanner
+
+import (
+	"context"
+	"strings"
+
+	"pingdisco.com/pingdisco/internal/device"
+	"pingdisco.com/pingdisco/internal/hostname"
+	"pingdisco.com/pingdisco/internal/snmp"
+)
+
+// querySNMP reads the system group of d over SNMP. Most hosts run no
+// agent, so failures are not errors.
+func (s *Scanner) querySNMP(ctx context.Context, d *device.Device) {
+	c := *s.SNMP
+	c.Target = d.IP().String()
+	if sys, err := c.System(ctx); err == nil {
+		annotateSNMP(d, sys)
+	}
+}
+
+// annotateSNMP records what an SNMP agent said about its device. The text
+// is escaped like hostnames, and only the first line of the description
+// kept: switches tend to describe themselves at length.
+func annotateSNMP(d *device.Device, sys snmp.System) {
+	name := hostname.Clean(sys.Name)
+	descr, _, _ := strings.Cut(sys.Description, "\n")
+	d.AddSource(device.SourceSNMP)
+	d.Set(device.AttrSNMPName, name)
+	d.Set(device.AttrSNMPDescr, hostname.Clean(strings.TrimSpace(descr)))
+	d.Set(device.AttrSNMPLocation, hostname.Clean(sys.Location))
+	d.Set(device.AttrSNMPObjectID, sys.ObjectID)
+	if sys.Interfaces > 0 {
+		d.SetInt(device.AttrSNMPInterfaces, sys.Interfaces)
+	}
+	d.AddName(name, device.SourceSNMP)
+	d.Identify(device.FieldType, sys.Type(), device.SourceSNMP, device.SourceConfidence(device.SourceSNMP))
+}
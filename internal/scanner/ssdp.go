@@ -0,0 +1,83 @@
+package scanner
+
+import (
+	"context"
+	"sync"
+
+	"pingdisco.com/pingdisco/internal/device"
+	"pingdisco.com/pingdisco/internal/events"
+	"pingdisco.com/pingdisco/internal/hostname"
+	"pingdisco.com/pingdisco/internal/ssdp"
+	"pingdisco.com/pingdisco/internal/targets"
+)
+
+// searchSSDP multicasts an SSDP search out of the interface of g and
+// returns the UPnP devices on its subnet that answered.
+func (s *Scanner) searchSSDP(ctx context.Context, g targets.Group) []ssdp.Response {
+	_, span := s.Tracer.Start(ctx, "ssdp")
+	defer span.End()
+	found, err := ssdp.Search(ctx, g.Local, ssdp.DefaultTimeout)
+	span.SetAttr("answered", len(found))
+	span.Fail(err)
+
+	var local []ssdp.Response
+	for _, r := range found {
+		if g.Subnet.Contains(r.IP) && !r.IP.Equal(g.Local) {
+			local = append(local, r)
+		}
+	}
+	return local
+}
+
+// mergeSSDP describes the UPnP devices that answered, adding those that
+// did not answer a probe, and returns the devices found.
+func (s *Scanner) mergeSSDP(ctx context.Context, answered []ssdp.Response, devices []*device.Device, g targets.Group) []*device.Device {
+	byIP := make(map[string]*device.Device, len(devices))
+	for _, d := range devices {
+		byIP[d.IP().String()] = d
+	}
+
+	var wg sync.WaitGroup
+	for _, r := range answered {
+		ip := r.IP.String()
+		d := byIP[ip]
+		if d == nil {
+			d = s.discovered(ctx, r.IP, device.SourceSSDP, s.Inventory.Lookup(ip), g)
+			byIP[ip] = d
+			devices = append(devices, d)
+		}
+		wg.Add(1)
+		go func(d *device.Device, r ssdp.Response) {
+			defer wg.Done()
+			// A device whose description cannot be read is still
+			// recorded as announcing itself.
+			desc, _ := ssdp.Describe(ctx, r.Location)
+			annotateUPnP(d, r, desc)
+		}(d, r)
+	}
+	wg.Wait()
+
+	for _, r := range answered {
+		s.Bus.Publish(events.Event{Type: events.DeviceEnriched, Group: g, Device: byIP[r.IP.String()]})
+	}
+	return devices
+}
+
+// annotateUPnP records what a device announced about itself over UPnP.
+// The text is escaped like hostnames, since any device can announce
+// anything.
+func annotateUPnP(d *device.Device, r ssdp.Response, desc ssdp.Description) {
+	name := hostname.Clean(desc.FriendlyName)
+	manufacturer := hostname.Clean(desc.Manufacturer)
+	d.AddSource(device.SourceSSDP)
+	d.Set(device.AttrUPnPServer, hostname.Clean(r.Server))
+	d.Set(device.AttrUPnPName, name)
+	d.Set(device.AttrUPnPManufacturer, manufacturer)
+	d.Set(device.AttrUPnPModel, hostname.Clean(desc.Model()))
+	d.Set(device.AttrUPnPDeviceType, hostname.Clean(desc.DeviceType))
+	d.AddName(name, device.SourceSSDP)
+
+	c := device.SourceConfidence(device.SourceSSDP)
+	d.Identify(device.FieldVendor, manufacturer, device.SourceSSDP, c)
+	d.Identify(device.FieldType, desc.Type(), device.SourceSSDP, c)
+}
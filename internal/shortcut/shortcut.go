@@ -0,0 +1,116 @@
+// Package shortcut turns a discovered device into ways of reaching it: an
+// ssh session, its web interface or a remote desktop, offered only when
+// the matching port answers.
+package shortcut
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultTimeout bounds the connection attempt to each port.
+const DefaultTimeout = 2 * time.Second
+
+// Shortcut is one way of reaching a device.
+type Shortcut struct {
+	Name string `json:"name"`
+	Port int    `json:"port"`
+	URL  string `json:"url"`
+}
+
+// Known lists the shortcuts Detect looks for, in the order they are
+// offered.
+var Known = []Shortcut{
+	{Name: "ssh", Port: 22},
+	{Name: "http", Port: 80},
+	{Name: "https", Port: 443},
+	{Name: "rdp", Port: 3389},
+}
+
+// For returns the shortcut named name for ip, whether or not its port is
+// open.
+func For(ip net.IP, name string) (Shortcut, bool) {
+	for _, s := range Known {
+		if s.Name == name {
+			s.URL = url(s, ip)
+			return s, true
+		}
+	}
+	return Shortcut{}, false
+}
+
+// Detect tries the port of every known shortcut on ip at once and returns
+// those that accept a connection. Only the address is used in URLs, never
+// a hostname learned from the network.
+func Detect(ctx context.Context, ip net.IP, timeout time.Duration) []Shortcut {
+	open := make([]bool, len(Known))
+	var wg sync.WaitGroup
+	for i, s := range Known {
+		wg.Add(1)
+		go func(i int, port int) {
+			defer wg.Done()
+			d := net.Dialer{Timeout: timeout}
+			conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(ip.String(), strconv.Itoa(port)))
+			if err == nil {
+				conn.Close()
+				open[i] = true
+			}
+		}(i, s.Port)
+	}
+	wg.Wait()
+
+	var found []Shortcut
+	for i, s := range Known {
+		if open[i] {
+			s.URL = url(s, ip)
+			found = append(found, s)
+		}
+	}
+	return found
+}
+
+func url(s Shortcut, ip net.IP) string {
+	host := ip.String()
+	if ip.To4() == nil {
+		host = "[" + host + "]"
+	}
+	if s.Name == "rdp" {
+		// The format Microsoft's Remote Desktop clients register.
+		return "rdp://full%20address=s:" + host + ":" + strconv.Itoa(s.Port)
+	}
+	return s.Name + "://" + host
+}
+
+// Open hands the shortcut to the program registered for its scheme. On
+// Windows, where ssh:// and rdp:// usually have none, ssh and mstsc are
+// started directly.
+func Open(s Shortcut, ip net.IP) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "windows":
+		switch s.Name {
+		case "ssh":
+			cmd = exec.Command("cmd", "/c", "start", "", "ssh", ip.String())
+		case "rdp":
+			cmd = exec.Command("mstsc", "/v:"+net.JoinHostPort(ip.String(), strconv.Itoa(s.Port)))
+		default:
+			cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", s.URL)
+		}
+	case "darwin":
+		cmd = exec.Command("open", s.URL)
+	default:
+		cmd = exec.Command("xdg-open", s.URL)
+	}
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("opening %s: %w", s.URL, err)
+	}
+	go cmd.Wait()
+	return nil
+}
@@ -0,0 +1,81 @@
+package snmp
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"pingdisco.com/pingdisco/internal/ber"
+)
+
+// BER tags of SNMP types and PDUs; the universal ones are in package ber.
+const (
+	tagIPAddress = 0x40
+	tagCounter32 = 0x41
+	tagGauge32   = 0x42
+	tagTimeTicks = 0x43
+	tagCounter64 = 0x46
+
+	tagNoSuchObject   = 0x80
+	tagNoSuchInstance = 0x81
+	tagEndOfMibView   = 0x82
+
+	tagGetRequest     = 0xa0
+	tagGetNextRequest = 0xa1
+	tagResponse       = 0xa2
+	tagGetBulkRequest = 0xa5
+	tagReport         = 0xa8
+)
+
+var errMalformed = errors.New("snmp: malformed packet")
+
+func encodeOID(oid string) ([]byte, error) {
+	parts, err := parseOID(oid)
+	if err != nil {
+		return nil, err
+	}
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("snmp: OID %q too short", oid)
+	}
+
+	b := []byte{byte(parts[0]*40 + parts[1])}
+	for _, p := range parts[2:] {
+		var sub []byte
+		sub = append(sub, byte(p&0x7f))
+		for p >>= 7; p > 0; p >>= 7 {
+			sub = append([]byte{byte(p&0x7f) | 0x80}, sub...)
+		}
+		b = append(b, sub...)
+	}
+	return ber.TLV(ber.TagOID, b), nil
+}
+
+func parseOID(oid string) ([]uint32, error) {
+	var parts []uint32
+	for _, s := range strings.Split(strings.TrimPrefix(oid, "."), ".") {
+		n, err := strconv.ParseUint(s, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("snmp: invalid OID %q", oid)
+		}
+		parts = append(parts, uint32(n))
+	}
+	return parts, nil
+}
+
+func decodeOID(b []byte) (string, error) {
+	if len(b) == 0 {
+		return "", errMalformed
+	}
+
+	parts := []string{strconv.Itoa(int(b[0]) / 40), strconv.Itoa(int(b[0]) % 40)}
+	var n uint64
+	for _, c := range b[1:] {
+		n = n<<7 | uint64(c&0x7f)
+		if c&0x80 == 0 {
+			parts = append(parts, strconv.FormatUint(n, 10))
+			n = 0
+		}
+	}
+	return strings.Join(parts, "."), nil
+}
@@ -0,0 +1,89 @@
+package snmp
+
+import (
+	"context"
+	"net"
+	"strings"
+)
+
+// MIB-II tables walked on routers.
+const (
+	oidIPAdEntNetMask          = "1.3.6.1.2.1.4.20.1.3"
+	oidIPRouteMask             = "1.3.6.1.2.1.4.21.1.11"
+	oidIPCidrRouteMask         = "1.3.6.1.2.1.4.24.4.1.2"
+	oidIPNetToMediaPhysAddress = "1.3.6.1.2.1.4.22.1.2"
+)
+
+// ARPEntry is an entry of a router's ARP cache.
+type ARPEntry struct {
+	IP  net.IP
+	MAC net.HardwareAddr
+}
+
+// ARPTable walks ipNetToMediaTable, indexed by ifIndex.a.b.c.d.
+func (c *Client) ARPTable(ctx context.Context) ([]ARPEntry, error) {
+	var entries []ARPEntry
+	err := c.Walk(ctx, oidIPNetToMediaPhysAddress, func(v Variable) error {
+		parts := strings.SplitN(v.Index(oidIPNetToMediaPhysAddress), ".", 2)
+		if len(parts) != 2 || len(v.Value) != 6 {
+			return nil
+		}
+		if ip := net.ParseIP(parts[1]).To4(); ip != nil {
+			entries = append(entries, ARPEntry{IP: ip, MAC: net.HardwareAddr(append([]byte(nil), v.Value...))})
+		}
+		return nil
+	})
+	return entries, err
+}
+
+// Subnets returns the networks a router knows about: those of its own
+// interface addresses and the destinations of its routing table. The
+// default route and host routes are left out.
+func (c *Client) Subnets(ctx context.Context) ([]*net.IPNet, error) {
+	seen := make(map[string]bool)
+	var subnets []*net.IPNet
+	add := func(ip net.IP, mask net.IP) {
+		if ip == nil || mask == nil {
+			return
+		}
+		m := net.IPMask(mask.To4())
+		ones, bits := m.Size()
+		if bits == 0 || ones == 0 || ones == 32 {
+			return
+		}
+		n := &net.IPNet{IP: ip.Mask(m), Mask: m}
+		if !seen[n.String()] {
+			seen[n.String()] = true
+			subnets = append(subnets, n)
+		}
+	}
+
+	// ipAdEntNetMask.a.b.c.d = mask
+	err := c.Walk(ctx, oidIPAdEntNetMask, func(v Variable) error {
+		add(net.ParseIP(v.Index(oidIPAdEntNetMask)).To4(), v.IP())
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// ipCidrRouteMask.dest.mask.tos.nexthop, falling back to the older
+	// ipRouteMask.dest = mask on agents without the CIDR table.
+	routes := 0
+	c.Walk(ctx, oidIPCidrRouteMask, func(v Variable) error {
+		parts := strings.Split(v.Index(oidIPCidrRouteMask), ".")
+		if len(parts) >= 8 {
+			routes++
+			add(net.ParseIP(strings.Join(parts[0:4], ".")).To4(), net.ParseIP(strings.Join(parts[4:8], ".")))
+		}
+		return nil
+	})
+	if routes == 0 {
+		c.Walk(ctx, oidIPRouteMask, func(v Variable) error {
+			add(net.ParseIP(v.Index(oidIPRouteMask)).To4(), v.IP())
+			return nil
+		})
+	}
+
+	return subnets, nil
+}
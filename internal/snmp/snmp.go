@@ -0,0 +1,306 @@
+// Package snmp is a small SNMPv2c and SNMPv3 client, just enough to walk
+// the tables of a router (the ARP cache, the routing table and interface
+// addresses) and to read what network gear says about itself.
+package snmp
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"pingdisco.com/pingdisco/internal/ber"
+)
+
+// Variable is one variable binding returned by an agent.
+type Variable struct {
+	OID   string
+	Type  byte
+	Value []byte
+}
+
+// Exists reports whether the agent has the variable.
+func (v Variable) Exists() bool {
+	return v.Type != tagNoSuchObject && v.Type != tagNoSuchInstance && v.Type != tagEndOfMibView
+}
+
+// IP returns the value of an IpAddress variable.
+func (v Variable) IP() net.IP {
+	if v.Type != tagIPAddress || len(v.Value) != 4 {
+		return nil
+	}
+	return net.IP(append([]byte(nil), v.Value...))
+}
+
+// Bytes returns the raw value of an OCTET STRING variable.
+func (v Variable) Bytes() []byte {
+	return v.Value
+}
+
+// String returns the value of an OCTET STRING variable as text.
+func (v Variable) String() string {
+	return string(v.Value)
+}
+
+// Int returns the value of a numeric variable.
+func (v Variable) Int() int64 {
+	if v.Type == ber.TagInteger {
+		return ber.ParseInt(v.Value)
+	}
+	return int64(ber.ParseUint(v.Value))
+}
+
+// Index returns the part of the OID after root, without the leading dot.
+func (v Variable) Index(root string) string {
+	return strings.TrimPrefix(strings.TrimPrefix(v.OID, strings.TrimPrefix(root, ".")), ".")
+}
+
+// Client queries one SNMP agent.
+type Client struct {
+	// Target is the agent's host or host:port (port 161 by default).
+	Target    string
+	Community string
+	Timeout   time.Duration
+	Retries   int
+	// V3, if set, queries the agent over SNMPv3 as this user instead of
+	// over SNMPv2c with Community.
+	V3 *USM
+
+	// engine is what the SNMPv3 agent told about itself, learnt by the
+	// first request.
+	engine *engine
+}
+
+// ErrNoResponse is returned when the agent does not answer, which for
+// SNMPv2c is also what a wrong community looks like.
+var ErrNoResponse = errors.New("snmp: no response (unreachable agent or wrong community)")
+
+// Get returns the values of oids. Variables the agent does not have are
+// returned with type NoSuchObject or NoSuchInstance.
+func (c *Client) Get(ctx context.Context, oids ...string) ([]Variable, error) {
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	return c.request(ctx, conn, tagGetRequest, oids...)
+}
+
+// Walk calls fn for every variable below root.
+func (c *Client) Walk(ctx context.Context, root string, fn func(Variable) error) error {
+	root = strings.TrimPrefix(root, ".")
+
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	next := root
+	for {
+		vars, err := c.request(ctx, conn, tagGetBulkRequest, next)
+		if err != nil {
+			return err
+		}
+		if len(vars) == 0 {
+			return nil
+		}
+
+		for _, v := range vars {
+			if v.Type == tagEndOfMibView || !strings.HasPrefix(v.OID, root+".") {
+				return nil
+			}
+			if v.OID == next {
+				return fmt.Errorf("snmp: agent returned OID %s out of order", v.OID)
+			}
+			if err := fn(v); err != nil {
+				return err
+			}
+			next = v.OID
+		}
+	}
+}
+
+func (c *Client) dial(ctx context.Context) (net.Conn, error) {
+	target := c.Target
+	if _, _, err := net.SplitHostPort(target); err != nil {
+		target = net.JoinHostPort(target, "161")
+	}
+
+	var d net.Dialer
+	return d.DialContext(ctx, "udp", target)
+}
+
+func (c *Client) request(ctx context.Context, conn net.Conn, pduType byte, oids ...string) ([]Variable, error) {
+	if c.V3 != nil && c.engine == nil {
+		if err := c.discover(ctx, conn); err != nil {
+			return nil, err
+		}
+	}
+
+	requestID := newRequestID()
+	pdu, err := encodePDU(pduType, requestID, oids)
+	if err != nil {
+		return nil, err
+	}
+	if c.V3 != nil {
+		return c.exchange(ctx, conn, c.encodeV3(requestID, pdu, c.V3.flags()|flagReportable), requestID, c.decodeV3)
+	}
+	return c.exchange(ctx, conn, encodeV2c(c.Community, pdu), requestID, decodeResponse)
+}
+
+// newRequestID returns a random request ID. SNMPv3 messages use it as
+// their message ID too.
+func newRequestID() int64 {
+	var b [4]byte
+	rand.Read(b[:])
+	return int64(binary.BigEndian.Uint32(b[:]) & 0x7fffffff)
+}
+
+// exchange sends packet, retrying on timeouts, until the response to
+// requestID arrives, and returns its variables as read by decode.
+func (c *Client) exchange(ctx context.Context, conn net.Conn, packet []byte, requestID int64, decode func([]byte) (int64, []Variable, error)) ([]Variable, error) {
+	timeout := c.Timeout
+	if timeout == 0 {
+		timeout = 2 * time.Second
+	}
+
+	buf := make([]byte, 65535)
+	for attempt := 0; attempt <= c.Retries; attempt++ {
+		if _, err := conn.Write(packet); err != nil {
+			return nil, err
+		}
+
+		deadline := time.Now().Add(timeout)
+		if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+			deadline = d
+		}
+		conn.SetReadDeadline(deadline)
+
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				break
+			}
+			id, vars, err := decode(buf[:n])
+			if err != nil {
+				return nil, err
+			}
+			if id == requestID {
+				return vars, nil
+			}
+		}
+
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+	}
+
+	return nil, ErrNoResponse
+}
+
+// encodePDU encodes a request for oids, their values left null.
+func encodePDU(pduType byte, requestID int64, oids []string) ([]byte, error) {
+	var bindings []byte
+	for _, oid := range oids {
+		name, err := encodeOID(oid)
+		if err != nil {
+			return nil, err
+		}
+		bindings = append(bindings, ber.TLV(ber.TagSequence, append(name, ber.TLV(ber.TagNull, nil)...))...)
+	}
+
+	var pdu []byte
+	pdu = append(pdu, ber.Int(ber.TagInteger, requestID)...)
+	if pduType == tagGetBulkRequest {
+		pdu = append(pdu, ber.Int(ber.TagInteger, 0)...)  // non-repeaters
+		pdu = append(pdu, ber.Int(ber.TagInteger, 25)...) // max-repetitions
+	} else {
+		pdu = append(pdu, ber.Int(ber.TagInteger, 0)...) // error-status
+		pdu = append(pdu, ber.Int(ber.TagInteger, 0)...) // error-index
+	}
+	pdu = append(pdu, ber.TLV(ber.TagSequence, bindings)...)
+	return ber.TLV(pduType, pdu), nil
+}
+
+// encodeV2c wraps pdu in an SNMPv2c message.
+func encodeV2c(community string, pdu []byte) []byte {
+	var msg []byte
+	msg = append(msg, ber.Int(ber.TagInteger, 1)...) // version: SNMPv2c
+	msg = append(msg, ber.TLV(ber.TagOctetString, []byte(community))...)
+	msg = append(msg, pdu...)
+	return ber.TLV(ber.TagSequence, msg)
+}
+
+// decodeResponse reads an SNMPv2c response.
+func decodeResponse(b []byte) (int64, []Variable, error) {
+	tag, msg, _, err := ber.Split(b)
+	if err != nil || tag != ber.TagSequence {
+		return 0, nil, errMalformed
+	}
+
+	// version, community
+	for i := 0; i < 2; i++ {
+		if _, _, msg, err = ber.Split(msg); err != nil {
+			return 0, nil, err
+		}
+	}
+	return decodePDU(msg)
+}
+
+// decodePDU reads the response PDU at the start of b. A report PDU, which
+// SNMPv3 agents send instead of a response when they reject a request, is
+// returned as an error.
+func decodePDU(b []byte) (int64, []Variable, error) {
+	tag, pdu, _, err := ber.Split(b)
+	if err != nil || (tag != tagResponse && tag != tagReport) {
+		return 0, nil, errMalformed
+	}
+
+	var fields [3][]byte
+	for i := range fields {
+		if _, fields[i], pdu, err = ber.Split(pdu); err != nil {
+			return 0, nil, err
+		}
+	}
+	requestID := ber.ParseInt(fields[0])
+	if status := ber.ParseInt(fields[1]); status != 0 {
+		return requestID, nil, fmt.Errorf("snmp: agent returned error status %d", status)
+	}
+
+	_, bindings, _, err := ber.Split(pdu)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var vars []Variable
+	for len(bindings) > 0 {
+		var binding []byte
+		if _, binding, bindings, err = ber.Split(bindings); err != nil {
+			return 0, nil, err
+		}
+
+		_, name, rest, err := ber.Split(binding)
+		if err != nil {
+			return 0, nil, err
+		}
+		oid, err := decodeOID(name)
+		if err != nil {
+			return 0, nil, err
+		}
+		typ, value, _, err := ber.Split(rest)
+		if err != nil {
+			return 0, nil, err
+		}
+		vars = append(vars, Variable{OID: oid, Type: typ, Value: value})
+	}
+
+	if tag == tagReport {
+		return requestID, nil, reportError(vars)
+	}
+	return requestID, vars, nil
+}
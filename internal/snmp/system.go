@@ -0,0 +1,71 @@
+package snmp
+
+import (
+	"context"
+	"strings"
+)
+
+// MIB-II system group and interface count, read from network gear.
+const (
+	oidSysDescr    = "1.3.6.1.2.1.1.1.0"
+	oidSysObjectID = "1.3.6.1.2.1.1.2.0"
+	oidSysName     = "1.3.6.1.2.1.1.5.0"
+	oidSysLocation = "1.3.6.1.2.1.1.6.0"
+	oidSysServices = "1.3.6.1.2.1.1.7.0"
+	oidIfNumber    = "1.3.6.1.2.1.2.1.0"
+)
+
+// System is what an agent says about the device it runs on.
+type System struct {
+	Name        string
+	Description string
+	Location    string
+	ObjectID    string
+	// Services is the sum of 2^(layer-1) of the OSI layers the device
+	// serves, as sysServices has it.
+	Services   int
+	Interfaces int
+}
+
+// System reads the system group and the number of interfaces of the
+// agent.
+func (c *Client) System(ctx context.Context) (System, error) {
+	vars, err := c.Get(ctx, oidSysDescr, oidSysObjectID, oidSysName, oidSysLocation, oidSysServices, oidIfNumber)
+	if err != nil {
+		return System{}, err
+	}
+	var s System
+	for _, v := range vars {
+		if !v.Exists() {
+			continue
+		}
+		switch v.OID {
+		case oidSysDescr:
+			s.Description = strings.TrimSpace(v.String())
+		case oidSysObjectID:
+			s.ObjectID, _ = decodeOID(v.Value)
+		case oidSysName:
+			s.Name = strings.TrimSpace(v.String())
+		case oidSysLocation:
+			s.Location = strings.TrimSpace(v.String())
+		case oidSysServices:
+			s.Services = int(v.Int())
+		case oidIfNumber:
+			s.Interfaces = int(v.Int())
+		}
+	}
+	return s, nil
+}
+
+// Type guesses what kind of device the agent runs on from the layers it
+// serves: one that routes at the network layer is a router, one that only
+// forwards frames a switch.
+func (s System) Type() string {
+	switch {
+	case s.Services&(1<<2) != 0:
+		return "router"
+	case s.Services&(1<<1) != 0:
+		return "switch"
+	}
+	return ""
+}
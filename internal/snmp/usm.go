@@ -0,0 +1,413 @@
+package snmp
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"net"
+	"strings"
+	"time"
+
+	"pingdisco.com/pingdisco/internal/ber"
+)
+
+// Authentication and privacy protocols of the user-based security model
+// (RFC 3414, RFC 3826).
+const (
+	AuthMD5 = "md5"
+	AuthSHA = "sha"
+	PrivAES = "aes"
+)
+
+// USM is an SNMPv3 user of the user-based security model. A user without
+// an authentication protocol sends requests unauthenticated
+// (noAuthNoPriv); a privacy protocol, which needs authentication, also
+// encrypts them (authPriv).
+type USM struct {
+	User         string
+	AuthProtocol string
+	AuthPassword string
+	PrivProtocol string
+	PrivPassword string
+}
+
+// Validate reports settings an agent would reject.
+func (u *USM) Validate() error {
+	if u.User == "" {
+		return errors.New("snmp: SNMPv3 needs a user name")
+	}
+	switch u.AuthProtocol {
+	case "":
+		if u.PrivProtocol != "" {
+			return errors.New("snmp: privacy needs authentication")
+		}
+	case AuthMD5, AuthSHA:
+		if len(u.AuthPassword) < 8 {
+			return errors.New("snmp: authentication password shorter than 8 characters")
+		}
+	default:
+		return fmt.Errorf("snmp: unknown authentication protocol %q: want %s or %s", u.AuthProtocol, AuthMD5, AuthSHA)
+	}
+	switch u.PrivProtocol {
+	case "":
+	case PrivAES:
+		if len(u.PrivPassword) < 8 {
+			return errors.New("snmp: privacy password shorter than 8 characters")
+		}
+	default:
+		return fmt.Errorf("snmp: unknown privacy protocol %q: want %s", u.PrivProtocol, PrivAES)
+	}
+	return nil
+}
+
+// Message flags.
+const (
+	flagAuth       = 0x01
+	flagPriv       = 0x02
+	flagReportable = 0x04
+)
+
+// securityModelUSM is the msgSecurityModel of the user-based model.
+const securityModelUSM = 3
+
+// authParamsLen is the length of the truncated HMAC of HMAC-MD5-96 and
+// HMAC-SHA-96.
+const authParamsLen = 12
+
+func (u *USM) flags() byte {
+	var f byte
+	if u.AuthProtocol != "" {
+		f |= flagAuth
+	}
+	if u.PrivProtocol != "" {
+		f |= flagPriv
+	}
+	return f
+}
+
+func (u *USM) hash() func() hash.Hash {
+	if u.AuthProtocol == AuthMD5 {
+		return md5.New
+	}
+	return sha1.New
+}
+
+// engine is the identity and clock of an SNMPv3 agent, and the keys of the
+// user localized to it.
+type engine struct {
+	id      []byte
+	boots   int64
+	time    int64
+	at      time.Time
+	authKey []byte
+	privKey []byte
+	salt    uint64
+}
+
+// now returns the agent's clock.
+func (e *engine) now() int64 {
+	return e.time + int64(time.Since(e.at)/time.Second)
+}
+
+// discover asks the agent for its engine ID and clock with an empty
+// request, which it answers with a report, and localizes the user's keys
+// to the engine.
+func (c *Client) discover(ctx context.Context, conn net.Conn) error {
+	id := newRequestID()
+	pdu, _ := encodePDU(tagGetRequest, id, nil)
+	packet := encodeV3Message(id, flagReportable, securityParams(nil, 0, 0, "", nil, nil), scopedPDU(nil, pdu))
+
+	var found *engine
+	_, err := c.exchange(ctx, conn, packet, id, func(b []byte) (int64, []Variable, error) {
+		m, err := parseV3(b)
+		if err != nil {
+			return 0, nil, err
+		}
+		if m.msgID == id {
+			found = &engine{id: m.engineID, boots: m.boots, time: m.time, at: time.Now()}
+		}
+		return m.msgID, nil, nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(found.id) == 0 {
+		return errors.New("snmp: agent did not tell its engine ID")
+	}
+
+	if c.V3.AuthProtocol != "" {
+		found.authKey = localizeKey(c.V3.hash(), c.V3.AuthPassword, found.id)
+	}
+	if c.V3.PrivProtocol != "" {
+		found.privKey = localizeKey(c.V3.hash(), c.V3.PrivPassword, found.id)[:16]
+	}
+	var salt [8]byte
+	rand.Read(salt[:])
+	found.salt = binary.BigEndian.Uint64(salt[:])
+	c.engine = found
+	return nil
+}
+
+// localizeKey derives the key of password for the engine engineID as in
+// RFC 3414, appendix A.2: the password stretched to one megabyte is hashed
+// into the user's key, which is hashed again around the engine ID.
+func localizeKey(newHash func() hash.Hash, password string, engineID []byte) []byte {
+	h := newHash()
+	buf := make([]byte, 64)
+	for n := 0; n < 1<<20; n += len(buf) {
+		for i := range buf {
+			buf[i] = password[(n+i)%len(password)]
+		}
+		h.Write(buf)
+	}
+	key := h.Sum(nil)
+
+	h.Reset()
+	h.Write(key)
+	h.Write(engineID)
+	h.Write(key)
+	return h.Sum(nil)
+}
+
+// encodeV3 wraps pdu in an SNMPv3 message from the client's user,
+// encrypted and authenticated as flags ask.
+func (c *Client) encodeV3(msgID int64, pdu []byte, flags byte) []byte {
+	e := c.engine
+	boots, now := e.boots, e.now()
+	data := scopedPDU(e.id, pdu)
+
+	var privParams []byte
+	if flags&flagPriv != 0 {
+		e.salt++
+		privParams = binary.BigEndian.AppendUint64(nil, e.salt)
+		data = ber.TLV(ber.TagOctetString, cryptAES(e.privKey, boots, now, privParams, data, false))
+	}
+	var authParams []byte
+	if flags&flagAuth != 0 {
+		authParams = make([]byte, authParamsLen)
+	}
+
+	msg := encodeV3Message(msgID, flags, securityParams(e.id, boots, now, c.V3.User, authParams, privParams), data)
+	if flags&flagAuth != 0 {
+		// The digest is computed over the message with the digest
+		// itself zeroed, then put in its place.
+		copy(msg[authParamsOffset(msg):], digest(c.V3.hash(), e.authKey, msg))
+	}
+	return msg
+}
+
+// authParamsOffset returns the offset of msgAuthenticationParameters in
+// an SNMPv3 message. parseV3 slices the message, so the offset is the
+// difference in capacity.
+func authParamsOffset(msg []byte) int {
+	m, _ := parseV3(msg)
+	return cap(msg) - cap(m.authParams)
+}
+
+// digest returns the truncated HMAC of msg.
+func digest(newHash func() hash.Hash, key, msg []byte) []byte {
+	mac := hmac.New(newHash, key)
+	mac.Write(msg)
+	return mac.Sum(nil)[:authParamsLen]
+}
+
+// cryptAES encrypts or decrypts data with AES-128 in CFB mode, the IV
+// being the engine's boots and time followed by the salt (RFC 3826).
+func cryptAES(key []byte, boots, now int64, salt, data []byte, decrypt bool) []byte {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil
+	}
+	iv := binary.BigEndian.AppendUint32(nil, uint32(boots))
+	iv = binary.BigEndian.AppendUint32(iv, uint32(now))
+	iv = append(iv, salt...)
+
+	out := make([]byte, len(data))
+	if decrypt {
+		cipher.NewCFBDecrypter(block, iv).XORKeyStream(out, data)
+	} else {
+		cipher.NewCFBEncrypter(block, iv).XORKeyStream(out, data)
+	}
+	return out
+}
+
+func scopedPDU(engineID, pdu []byte) []byte {
+	var b []byte
+	b = append(b, ber.TLV(ber.TagOctetString, engineID)...) // contextEngineID
+	b = append(b, ber.TLV(ber.TagOctetString, nil)...)      // contextName
+	b = append(b, pdu...)
+	return ber.TLV(ber.TagSequence, b)
+}
+
+func securityParams(engineID []byte, boots, now int64, user string, authParams, privParams []byte) []byte {
+	var b []byte
+	b = append(b, ber.TLV(ber.TagOctetString, engineID)...)
+	b = append(b, ber.Int(ber.TagInteger, boots)...)
+	b = append(b, ber.Int(ber.TagInteger, now)...)
+	b = append(b, ber.TLV(ber.TagOctetString, []byte(user))...)
+	b = append(b, ber.TLV(ber.TagOctetString, authParams)...)
+	b = append(b, ber.TLV(ber.TagOctetString, privParams)...)
+	return ber.TLV(ber.TagSequence, b)
+}
+
+func encodeV3Message(msgID int64, flags byte, secParams, data []byte) []byte {
+	var global []byte
+	global = append(global, ber.Int(ber.TagInteger, msgID)...)
+	global = append(global, ber.Int(ber.TagInteger, 65507)...) // msgMaxSize
+	global = append(global, ber.TLV(ber.TagOctetString, []byte{flags})...)
+	global = append(global, ber.Int(ber.TagInteger, securityModelUSM)...)
+
+	var msg []byte
+	msg = append(msg, ber.Int(ber.TagInteger, 3)...) // version: SNMPv3
+	msg = append(msg, ber.TLV(ber.TagSequence, global)...)
+	msg = append(msg, ber.TLV(ber.TagOctetString, secParams)...)
+	msg = append(msg, data...)
+	return ber.TLV(ber.TagSequence, msg)
+}
+
+// v3Message is a decoded SNMPv3 message. Its byte slices point into the
+// message.
+type v3Message struct {
+	msgID       int64
+	flags       byte
+	engineID    []byte
+	boots, time int64
+	user        []byte
+	authParams  []byte
+	privParams  []byte
+	// data is the scoped PDU, or its ciphertext if flagPriv is set.
+	data []byte
+}
+
+func parseV3(b []byte) (v3Message, error) {
+	var m v3Message
+	tag, msg, _, err := ber.Split(b)
+	if err != nil || tag != ber.TagSequence {
+		return m, errMalformed
+	}
+	var version, global, sec []byte
+	if _, version, msg, err = ber.Split(msg); err != nil || ber.ParseInt(version) != 3 {
+		return m, errMalformed
+	}
+	if _, global, msg, err = ber.Split(msg); err != nil {
+		return m, err
+	}
+	if _, sec, msg, err = ber.Split(msg); err != nil {
+		return m, err
+	}
+	tag, data, _, err := ber.Split(msg)
+	if err != nil {
+		return m, err
+	}
+	if tag == ber.TagSequence {
+		// Unencrypted: keep the scoped PDU whole.
+		data = msg
+	}
+	m.data = data
+
+	var fields [4][]byte
+	for i := range fields {
+		if _, fields[i], global, err = ber.Split(global); err != nil {
+			return m, err
+		}
+	}
+	if len(fields[2]) != 1 {
+		return m, errMalformed
+	}
+	m.msgID, m.flags = ber.ParseInt(fields[0]), fields[2][0]
+
+	if _, sec, _, err = ber.Split(sec); err != nil {
+		return m, err
+	}
+	var params [6][]byte
+	for i := range params {
+		if _, params[i], sec, err = ber.Split(sec); err != nil {
+			return m, err
+		}
+	}
+	m.engineID = params[0]
+	m.boots, m.time = ber.ParseInt(params[1]), ber.ParseInt(params[2])
+	m.user, m.authParams, m.privParams = params[3], params[4], params[5]
+	return m, nil
+}
+
+// decodeV3 reads an SNMPv3 response to the client's user, checking its
+// digest and decrypting it as needed. Responses are matched by message ID,
+// which the client sets to the request ID, since agents cannot tell the
+// request ID of requests they failed to decrypt.
+func (c *Client) decodeV3(b []byte) (int64, []Variable, error) {
+	m, err := parseV3(b)
+	if err != nil {
+		return 0, nil, err
+	}
+	e := c.engine
+
+	if m.flags&flagAuth != 0 {
+		if len(m.authParams) != authParamsLen || e.authKey == nil {
+			return m.msgID, nil, errMalformed
+		}
+		zeroed := append([]byte(nil), b...)
+		offset := authParamsOffset(b)
+		clear(zeroed[offset : offset+authParamsLen])
+		if !hmac.Equal(digest(c.V3.hash(), e.authKey, zeroed), m.authParams) {
+			return m.msgID, nil, errors.New("snmp: response failed authentication")
+		}
+	}
+
+	scoped := m.data
+	if m.flags&flagPriv != 0 {
+		if e.privKey == nil || len(m.privParams) != 8 {
+			return m.msgID, nil, errMalformed
+		}
+		scoped = cryptAES(e.privKey, m.boots, m.time, m.privParams, m.data, true)
+	}
+
+	// ScopedPDU: contextEngineID, contextName, PDU
+	tag, pdu, _, err := ber.Split(scoped)
+	if err != nil || tag != ber.TagSequence {
+		return m.msgID, nil, errMalformed
+	}
+	for i := 0; i < 2; i++ {
+		if _, _, pdu, err = ber.Split(pdu); err != nil {
+			return m.msgID, nil, err
+		}
+	}
+	_, vars, err := decodePDU(pdu)
+	return m.msgID, vars, err
+}
+
+// oidUSMStats holds the counters agents report when they reject an SNMPv3
+// request.
+const oidUSMStats = "1.3.6.1.6.3.15.1.1"
+
+// usmStats describes the counters under oidUSMStats.
+var usmStats = map[string]string{
+	"1": "unsupported security level",
+	"2": "clock out of sync",
+	"3": "unknown user name",
+	"4": "unknown engine ID",
+	"5": "wrong authentication password",
+	"6": "wrong privacy password",
+}
+
+// reportError describes the report an agent sent in place of a response.
+func reportError(vars []Variable) error {
+	for _, v := range vars {
+		if !strings.HasPrefix(v.OID, oidUSMStats+".") {
+			continue
+		}
+		counter, _, _ := strings.Cut(v.Index(oidUSMStats), ".")
+		if reason, ok := usmStats[counter]; ok {
+			return errors.New("snmp: request rejected: " + reason)
+		}
+	}
+	return errors.New("snmp: request rejected")
+}
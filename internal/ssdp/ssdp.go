@@ -0,0 +1,192 @@
+// Package ssdp finds UPnP devices with the Simple Service Discovery
+// Protocol and reads their device descriptions: friendly name,
+// manufacturer and model. Smart TVs, media servers, printers and routers
+// announce themselves this way even when they ignore ping.
+package ssdp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Addr is the SSDP multicast group and port.
+const Addr = "239.255.255.250:1900"
+
+// DefaultTimeout is how long Search collects answers. Devices delay their
+// answer by up to the one second the search allows them.
+const DefaultTimeout = 2 * time.Second
+
+// DescribeTimeout bounds fetching one device description.
+const DescribeTimeout = 3 * time.Second
+
+// Response is a device's answer to a search.
+type Response struct {
+	IP net.IP
+	// Location is the URL of the device description.
+	Location string
+	// Server names the operating system and UPnP stack of the device.
+	Server string
+	USN    string
+}
+
+// Search multicasts a search for all UPnP devices from the address local
+// and returns the devices that answer within timeout, one response per
+// address. Answers whose description is not on the answering host are
+// ignored, so a device cannot make pingdisco fetch URLs elsewhere.
+func Search(ctx context.Context, local net.IP, timeout time.Duration) ([]Response, error) {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	conn, err := net.ListenPacket("udp4", net.JoinHostPort(local.String(), "0"))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	dst, err := net.ResolveUDPAddr("udp4", Addr)
+	if err != nil {
+		return nil, err
+	}
+	msg := "M-SEARCH * HTTP/1.1\r\n" +
+		"HOST: " + Addr + "\r\n" +
+		"MAN: \"ssdp:discover\"\r\n" +
+		"MX: 1\r\n" +
+		"ST: ssdp:all\r\n\r\n"
+	// Searches are sent twice, as UDP multicast is easily lost on Wi-Fi.
+	for range 2 {
+		if _, err := conn.WriteTo([]byte(msg), dst); err != nil {
+			return nil, err
+		}
+	}
+
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	seen := make(map[string]bool)
+	var found []Response
+	buf := make([]byte, 4096)
+	for {
+		n, from, err := conn.ReadFrom(buf)
+		if err != nil {
+			break
+		}
+		addr, ok := from.(*net.UDPAddr)
+		if !ok || seen[addr.IP.String()] {
+			continue
+		}
+		r, ok := parseResponse(buf[:n], addr.IP)
+		if !ok {
+			continue
+		}
+		seen[addr.IP.String()] = true
+		found = append(found, r)
+	}
+	return found, ctx.Err()
+}
+
+// parseResponse reads the answer from ip, if it is a search response
+// describing a device on ip itself.
+func parseResponse(b []byte, ip net.IP) (Response, bool) {
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(b)), nil)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		return Response{}, false
+	}
+	resp.Body.Close()
+
+	r := Response{
+		IP:       ip,
+		Location: strings.TrimSpace(resp.Header.Get("Location")),
+		Server:   strings.TrimSpace(resp.Header.Get("Server")),
+		USN:      strings.TrimSpace(resp.Header.Get("Usn")),
+	}
+	u, err := url.Parse(r.Location)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || !ip.Equal(net.ParseIP(u.Hostname())) {
+		return Response{}, false
+	}
+	return r, true
+}
+
+// Description is what a device description says about the root device.
+type Description struct {
+	DeviceType   string `xml:"deviceType"`
+	FriendlyName string `xml:"friendlyName"`
+	Manufacturer string `xml:"manufacturer"`
+	ModelName    string `xml:"modelName"`
+	ModelNumber  string `xml:"modelNumber"`
+}
+
+// Describe fetches the device description at location.
+func Describe(ctx context.Context, location string) (Description, error) {
+	ctx, cancel := context.WithTimeout(ctx, DescribeTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+	if err != nil {
+		return Description{}, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return Description{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return Description{}, fmt.Errorf("device description: %s", resp.Status)
+	}
+
+	var root struct {
+		Device Description `xml:"device"`
+	}
+	if err := xml.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&root); err != nil {
+		return Description{}, fmt.Errorf("reading device description: %w", err)
+	}
+	d := root.Device
+	for _, f := range []*string{&d.DeviceType, &d.FriendlyName, &d.Manufacturer, &d.ModelName, &d.ModelNumber} {
+		*f = strings.TrimSpace(*f)
+	}
+	return d, nil
+}
+
+// Model returns the model name and number, without repeating a number the
+// name already contains.
+func (d Description) Model() string {
+	if d.ModelNumber == "" || strings.Contains(d.ModelName, d.ModelNumber) {
+		return d.ModelName
+	}
+	return strings.TrimSpace(d.ModelName + " " + d.ModelNumber)
+}
+
+// deviceTypes maps the standard UPnP device types, the part of the URN
+// before the version, to device types as pingdisco identifies them.
+var deviceTypes = map[string]string{
+	"InternetGatewayDevice": "router",
+	"WFADevice":             "router",
+	"MediaRenderer":         "media player",
+	"MediaServer":           "media server",
+	"Printer":               "printer",
+	"ZonePlayer":            "speaker",
+	"DigitalSecurityCamera": "camera",
+}
+
+var tvModel = regexp.MustCompile(`(?i)\b(tv|television)\b`)
+
+// Type guesses what kind of device d is from its device type and model.
+func (d Description) Type() string {
+	if tvModel.MatchString(d.ModelName + " " + d.FriendlyName) {
+		return "tv"
+	}
+	// urn:schemas-upnp-org:device:MediaRenderer:1
+	parts := strings.Split(d.DeviceType, ":")
+	if len(parts) >= 2 {
+		return deviceTypes[parts[len(parts)-2]]
+	}
+	return ""
+}
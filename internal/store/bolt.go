@@ -0,0 +1,130 @@
+package store
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func init() {
+	Register("bolt", func(path string) (Store, error) { return OpenBolt(path) })
+}
+
+var scansBucket = []byte("scans")
+
+// Bolt is a Store in a BoltDB file. Each scan is a JSON document keyed by
+// its ID.
+type Bolt struct {
+	db *bolt.DB
+}
+
+// OpenBolt opens or creates the BoltDB file at path.
+func OpenBolt(path string) (*Bolt, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, err
+	}
+
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(scansBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &Bolt{db: db}, nil
+}
+
+// SaveScan implements Store.
+func (b *Bolt) SaveScan(_ context.Context, scan Scan) (int64, error) {
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(scansBucket)
+		seq, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+		scan.ID = int64(seq)
+
+		data, err := json.Marshal(scan)
+		if err != nil {
+			return err
+		}
+		return bucket.Put(boltKey(scan.ID), data)
+	})
+	return scan.ID, err
+}
+
+// Scans implements Store.
+func (b *Bolt) Scans(_ context.Context, limit int) ([]Scan, error) {
+	var scans []Scan
+	err := b.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(scansBucket).Cursor()
+		for k, v := c.Last(); k != nil && (limit <= 0 || len(scans) < limit); k, v = c.Prev() {
+			var s Scan
+			if err := json.Unmarshal(v, &s); err != nil {
+				return err
+			}
+			s.Devices = nil
+			scans = append(scans, s)
+		}
+		return nil
+	})
+	return scans, err
+}
+
+// Scan implements Store.
+func (b *Bolt) Scan(_ context.Context, id int64) (Scan, error) {
+	var s Scan
+	err := b.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(scansBucket).Get(boltKey(id))
+		if v == nil {
+			return ErrNotFound
+		}
+		return json.Unmarshal(v, &s)
+	})
+	return s, err
+}
+
+// SetNote implements Store.
+func (b *Bolt) SetNote(_ context.Context, id int64, note string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(scansBucket)
+		v := bucket.Get(boltKey(id))
+		if v == nil {
+			return ErrNotFound
+		}
+		var s Scan
+		if err := json.Unmarshal(v, &s); err != nil {
+			return err
+		}
+		s.Note = note
+
+		data, err := json.Marshal(s)
+		if err != nil {
+			return err
+		}
+		return bucket.Put(boltKey(id), data)
+	})
+}
+
+// Close implements Store.
+func (b *Bolt) Close() error {
+	return b.db.Close()
+}
+
+func boltKey(id int64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(id))
+	return key
+}
@@ -0,0 +1,74 @@
+package store
+
+import (
+	"context"
+	"sync"
+)
+
+func init() {
+	Register("memory", func(string) (Store, error) { return NewMemory(), nil })
+}
+
+// Memory is a Store that keeps scans in memory, for tests and one-shot
+// runs.
+type Memory struct {
+	mu    sync.Mutex
+	scans []Scan
+}
+
+// NewMemory returns an empty in-memory store.
+func NewMemory() *Memory {
+	return &Memory{}
+}
+
+// SaveScan implements Store.
+func (m *Memory) SaveScan(_ context.Context, scan Scan) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	scan.ID = int64(len(m.scans) + 1)
+	m.scans = append(m.scans, scan)
+	return scan.ID, nil
+}
+
+// Scans implements Store.
+func (m *Memory) Scans(_ context.Context, limit int) ([]Scan, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var scans []Scan
+	for i := len(m.scans) - 1; i >= 0 && (limit <= 0 || len(scans) < limit); i-- {
+		s := m.scans[i]
+		s.Devices = nil
+		scans = append(scans, s)
+	}
+	return scans, nil
+}
+
+// Scan implements Store.
+func (m *Memory) Scan(_ context.Context, id int64) (Scan, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if id < 1 || id > int64(len(m.scans)) {
+		return Scan{}, ErrNotFound
+	}
+	return m.scans[id-1], nil
+}
+
+// SetNote implements Store.
+func (m *Memory) SetNote(_ context.Context, id int64, note string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if id < 1 || id > int64(len(m.scans)) {
+		return ErrNotFound
+	}
+	m.scans[id-1].Note = note
+	return nil
+}
+
+// Close implements Store.
+func (m *Memory) Close() error {
+	return nil
+}
@@ -0,0 +1,228 @@
+//go:build !minimal
+
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	_ "modernc.org/sqlite"
+
+	"pingdisco.com/pingdisco/internal/device"
+)
+
+func init() {
+	Register("sqlite", func(path string) (Store, error) { return OpenSQLite(path) })
+}
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS scans (
+	id          INTEGER PRIMARY KEY AUTOINCREMENT,
+	started_at  TEXT NOT NULL,
+	finished_at TEXT NOT NULL,
+	targets     TEXT NOT NULL,
+	note        TEXT NOT NULL DEFAULT '',
+	ssid        TEXT NOT NULL DEFAULT '',
+	bssid       TEXT NOT NULL DEFAULT ''
+);
+CREATE TABLE IF NOT EXISTS scan_devices (
+	scan_id INTEGER NOT NULL REFERENCES scans(id) ON DELETE CASCADE,
+	ip      TEXT NOT NULL,
+	device  TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS scan_devices_ip ON scan_devices(ip);
+`
+
+// SQLite is a Store in an SQLite database. Devices are kept in their
+// versioned JSON form next to their address, so new device attributes need
+// no schema change.
+type SQLite struct {
+	db *sql.DB
+}
+
+// OpenSQLite opens or creates the SQLite database at path. The path
+// ":memory:" gives a private in-memory database.
+func OpenSQLite(path string) (*SQLite, error) {
+	if path != ":memory:" {
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			return nil, err
+		}
+	}
+
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := migrateSQLite(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &SQLite{db: db}, nil
+}
+
+// SaveScan implements Store.
+func (s *SQLite) SaveScan(ctx context.Context, scan Scan) (int64, error) {
+	targets, err := json.Marshal(scan.Targets)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `INSERT INTO scans (started_at, finished_at, targets, note, ssid, bssid) VALUES (?, ?, ?, ?, ?, ?)`,
+		scan.StartedAt.UTC().Format(time.RFC3339Nano), scan.FinishedAt.UTC().Format(time.RFC3339Nano), string(targets), scan.Note, scan.SSID, scan.BSSID)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	for _, d := range scan.Devices {
+		data, err := json.Marshal(d)
+		if err != nil {
+			return 0, err
+		}
+		if _, err := tx.ExecContext(ctx, `INSERT INTO scan_devices (scan_id, ip, device) VALUES (?, ?, ?)`,
+			id, d.IP().String(), string(data)); err != nil {
+			return 0, err
+		}
+	}
+
+	return id, tx.Commit()
+}
+
+// Scans implements Store.
+func (s *SQLite) Scans(ctx context.Context, limit int) ([]Scan, error) {
+	if limit <= 0 {
+		limit = -1
+	}
+
+	rows, err := s.db.QueryContext(ctx, `SELECT id, started_at, finished_at, targets, note, ssid, bssid FROM scans ORDER BY id DESC LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var scans []Scan
+	for rows.Next() {
+		scan, err := scanRow(rows)
+		if err != nil {
+			return nil, err
+		}
+		scans = append(scans, scan)
+	}
+	return scans, rows.Err()
+}
+
+// Scan implements Store.
+func (s *SQLite) Scan(ctx context.Context, id int64) (Scan, error) {
+	row := s.db.QueryRowContext(ctx, `SELECT id, started_at, finished_at, targets, note, ssid, bssid FROM scans WHERE id = ?`, id)
+	scan, err := scanRow(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Scan{}, ErrNotFound
+	}
+	if err != nil {
+		return Scan{}, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, `SELECT device FROM scan_devices WHERE scan_id = ? ORDER BY rowid`, id)
+	if err != nil {
+		return Scan{}, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return Scan{}, err
+		}
+		d := new(device.Device)
+		if err := json.Unmarshal([]byte(data), d); err != nil {
+			return Scan{}, err
+		}
+		scan.Devices = append(scan.Devices, d)
+	}
+
+	return scan, rows.Err()
+}
+
+// SetNote implements Store.
+func (s *SQLite) SetNote(ctx context.Context, id int64, note string) error {
+	res, err := s.db.ExecContext(ctx, `UPDATE scans SET note = ? WHERE id = ?`, note, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Close implements Store.
+func (s *SQLite) Close() error {
+	return s.db.Close()
+}
+
+func scanRow(row interface{ Scan(...any) error }) (Scan, error) {
+	var scan Scan
+	var started, finished, targets string
+	if err := row.Scan(&scan.ID, &started, &finished, &targets, &scan.Note, &scan.SSID, &scan.BSSID); err != nil {
+		return Scan{}, err
+	}
+
+	scan.StartedAt, _ = time.Parse(time.RFC3339Nano, started)
+	scan.FinishedAt, _ = time.Parse(time.RFC3339Nano, finished)
+	json.Unmarshal([]byte(targets), &scan.Targets)
+
+	return scan, nil
+}
+
+// migrateSQLite brings databases created by older versions up to the
+// current schema.
+func migrateSQLite(db *sql.DB) error {
+	rows, err := db.Query(`SELECT name FROM pragma_table_info('scans')`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	columns := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		columns[name] = true
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, column := range []string{"note", "ssid", "bssid"} {
+		if columns[column] {
+			continue
+		}
+		if _, err := db.Exec(`ALTER TABLE scans ADD COLUMN ` + column + ` TEXT NOT NULL DEFAULT ''`); err != nil {
+			return err
+		}
+	}
+	return nil
+}
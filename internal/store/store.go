@@ -0,0 +1,109 @@
+// Package store persists scan results. Callers work against the Store
+// interface and pick a backend with a URL, so persistence features do not
+// depend on one database.
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"pingdisco.com/pingdisco/internal/device"
+)
+
+// Scan is one finished scan and the devices it found. Note is free text
+// the user attached to it, such as what changed on the network before it.
+// SSID and BSSID identify the Wi-Fi network the scanning machine was on,
+// if any, so scans of different networks can be told apart.
+type Scan struct {
+	ID         int64            `json:"id"`
+	StartedAt  time.Time        `json:"started_at"`
+	FinishedAt time.Time        `json:"finished_at"`
+	Targets    []string         `json:"targets,omitempty"`
+	Note       string           `json:"note,omitempty"`
+	SSID       string           `json:"ssid,omitempty"`
+	BSSID      string           `json:"bssid,omitempty"`
+	Devices    []*device.Device `json:"devices"`
+}
+
+// Store keeps scans.
+type Store interface {
+	// SaveScan stores scan and returns the ID it was given.
+	SaveScan(ctx context.Context, scan Scan) (int64, error)
+	// Scans returns up to limit scans, newest first, without devices. A
+	// limit of zero or less returns all of them.
+	Scans(ctx context.Context, limit int) ([]Scan, error)
+	// Scan returns a scan with its devices.
+	Scan(ctx context.Context, id int64) (Scan, error)
+	// SetNote replaces the note of a scan; an empty note removes it.
+	SetNote(ctx context.Context, id int64, note string) error
+	Close() error
+}
+
+// ErrNotFound is returned for unknown scan IDs.
+var ErrNotFound = errors.New("scan not found")
+
+// Opener opens a store at a backend-specific location.
+type Opener func(location string) (Store, error)
+
+var (
+	mu       sync.Mutex
+	backends = map[string]Opener{}
+)
+
+// Register makes a backend available to Open under scheme.
+func Register(scheme string, open Opener) {
+	mu.Lock()
+	defer mu.Unlock()
+	backends[scheme] = open
+}
+
+// Backends returns the registered schemes.
+func Backends() []string {
+	mu.Lock()
+	defer mu.Unlock()
+
+	schemes := make([]string, 0, len(backends))
+	for s := range backends {
+		schemes = append(schemes, s)
+	}
+	sort.Strings(schemes)
+	return schemes
+}
+
+// Open opens the store described by url, written SCHEME:LOCATION, e.g.
+// "sqlite:/var/lib/pingdisco/scans.db", "bolt:scans.bolt" or "memory:".
+// A plain path picks the backend from its extension: .bolt and .bbolt
+// use BoltDB, anything else SQLite, or BoltDB in builds without SQLite.
+func Open(url string) (Store, error) {
+	mu.Lock()
+	_, haveSQLite := backends["sqlite"]
+	mu.Unlock()
+
+	scheme, location, ok := strings.Cut(url, ":")
+	if !ok || len(scheme) == 1 { // no scheme, or a Windows drive letter
+		scheme, location = "sqlite", url
+		switch filepath.Ext(url) {
+		case ".bolt", ".bbolt":
+			scheme = "bolt"
+		default:
+			if !haveSQLite {
+				scheme = "bolt"
+			}
+		}
+	}
+
+	mu.Lock()
+	open, ok := backends[scheme]
+	mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown store backend %q (available: %s)", scheme, strings.Join(Backends(), ", "))
+	}
+
+	return open(location)
+}
@@ -0,0 +1,327 @@
+// Package targets generates what the scanner probes. A Source yields groups
+// of targets, each a subnet or a list of hosts, and the scan engine treats
+// them the same whichever source they came from, so adding a source does
+// not touch the scan loop.
+package targets
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Group is a batch of targets scanned and reported together.
+type Group struct {
+	// Name labels the group in output.
+	Name string
+	// Subnet is scanned as a whole when set; Hosts are scanned otherwise.
+	Subnet *net.IPNet
+	Hosts  []net.IP
+	// Interface and Local are set for the subnets of local interfaces.
+	Interface string
+	Local     net.IP
+	// Skip, when set, explains why the group is listed but not scanned.
+	Skip string
+}
+
+// Addresses returns the addresses to probe: the hosts of Subnet without
+// its network and broadcast addresses, which /31 and /32 subnets do not
+// have, or Hosts. IPv6 subnets are far too large to probe address by
+// address and have none; the scanner finds their hosts by multicast ping
+// and NDP instead.
+func (g Group) Addresses() []net.IP {
+	if g.Subnet == nil {
+		return g.Hosts
+	}
+	if g.IPv6() {
+		return nil
+	}
+
+	network := g.Subnet.IP.To4().Mask(g.Subnet.Mask)
+	broadcast := make(net.IP, len(network))
+	for i := range network {
+		broadcast[i] = network[i] | ^g.Subnet.Mask[len(g.Subnet.Mask)-len(network)+i]
+	}
+	ones, bits := g.Subnet.Mask.Size()
+	edges := bits-ones > 1
+
+	var addrs []net.IP
+	for ip := append(net.IP(nil), network...); g.Subnet.Contains(ip); Increment(ip) {
+		if edges && (ip.Equal(network) || ip.Equal(broadcast)) {
+			continue
+		}
+		addrs = append(addrs, append(net.IP(nil), ip...))
+		if ip.Equal(broadcast) {
+			break
+		}
+	}
+	return addrs
+}
+
+// Size returns the number of addresses Addresses returns, without
+// building them.
+func (g Group) Size() int {
+	if g.Subnet == nil {
+		return len(g.Hosts)
+	}
+	if g.IPv6() {
+		return 0
+	}
+	ones, bits := g.Subnet.Mask.Size()
+	if bits-ones > 1 {
+		return 1<<(bits-ones) - 2
+	}
+	return 1 << (bits - ones)
+}
+
+// IPv6 reports whether g is an IPv6 subnet.
+func (g Group) IPv6() bool {
+	return g.Subnet != nil && g.Subnet.IP.To4() == nil
+}
+
+// Increment advances ip to the next address in place.
+func Increment(ip net.IP) {
+	for j := len(ip) - 1; j >= 0; j-- {
+		ip[j]++
+		if ip[j] > 0 {
+			break
+		}
+	}
+}
+
+// Source produces target groups.
+type Source interface {
+	Groups(ctx context.Context) ([]Group, error)
+}
+
+// SourceFunc adapts a function to a Source.
+type SourceFunc func(ctx context.Context) ([]Group, error)
+
+// Groups implements Source.
+func (f SourceFunc) Groups(ctx context.Context) ([]Group, error) {
+	return f(ctx)
+}
+
+// MaxAddresses is the most addresses a subnet or range of CIDRs may have
+// unless the caller lifts the limit: a /16. Every address is probed and
+// remembered, so a /8 takes hours and gigabytes of memory, which is more
+// often a typo than the intent.
+const MaxAddresses = 1 << 16
+
+// ErrTooLarge is returned for a subnet or range with more addresses than
+// the limit.
+var ErrTooLarge = errors.New("too many addresses")
+
+// CIDRs is a source of subnets, address ranges, single addresses and host
+// names written as text. Each subnet and range becomes a group of its own;
+// single addresses and the addresses host names resolve to are gathered
+// into one "Hosts" group. Ranges end either in a last octet, as in
+// 192.168.1.10-50, or in a full address.
+type CIDRs []string
+
+// Groups implements Source, refusing subnets and ranges with more than
+// MaxAddresses addresses.
+func (c CIDRs) Groups(ctx context.Context) ([]Group, error) {
+	return c.GroupsUpTo(ctx, MaxAddresses)
+}
+
+// GroupsUpTo is Groups refusing subnets and ranges with more than max
+// addresses instead; zero lifts the limit.
+func (c CIDRs) GroupsUpTo(ctx context.Context, max int) ([]Group, error) {
+	var groups []Group
+	hosts := Group{Name: "Hosts"}
+
+	for _, s := range c {
+		if _, ipnet, err := net.ParseCIDR(s); err == nil {
+			if ipnet.IP.To4() == nil {
+				return nil, fmt.Errorf("%s: only IPv4 subnets can be scanned", s)
+			}
+			ipnet.IP = ipnet.IP.To4()
+			if err := checkSize(s, subnetSize(ipnet), max); err != nil {
+				return nil, err
+			}
+			groups = append(groups, Group{Name: "Network: " + ipnet.String(), Subnet: ipnet})
+			continue
+		}
+
+		if ip := net.ParseIP(s); ip != nil {
+			if ip.To4() == nil {
+				return nil, fmt.Errorf("%s: only IPv4 addresses can be scanned", s)
+			}
+			hosts.Hosts = append(hosts.Hosts, ip.To4())
+			continue
+		}
+
+		if first, last, ok := parseRange(s); ok {
+			if bytes.Compare(first, last) > 0 {
+				return nil, fmt.Errorf("%s: the range ends before it starts", s)
+			}
+			if err := checkSize(s, rangeSize(first, last), max); err != nil {
+				return nil, err
+			}
+			g := Group{Name: "Range: " + first.String() + "-" + last.String()}
+			for ip := first; bytes.Compare(ip, last) <= 0; Increment(ip) {
+				g.Hosts = append(g.Hosts, append(net.IP(nil), ip...))
+				if ip.Equal(net.IPv4bcast) {
+					break
+				}
+			}
+			groups = append(groups, g)
+			continue
+		}
+
+		if !isHostname(s) {
+			return nil, fmt.Errorf("%q is not an IPv4 address, subnet, range or host name", s)
+		}
+		ips, err := net.DefaultResolver.LookupIP(ctx, "ip4", s)
+		if err != nil {
+			return nil, fmt.Errorf("resolving %s: %w", s, err)
+		}
+		for _, ip := range ips {
+			hosts.Hosts = append(hosts.Hosts, ip.To4())
+		}
+	}
+
+	if len(hosts.Hosts) > 0 {
+		groups = append(groups, hosts)
+	}
+	return groups, nil
+}
+
+// Validate checks that each entry is an IPv4 address, subnet, range or
+// host name, without resolving the names, and returns the first error
+// Groups would report for it.
+func (c CIDRs) Validate() error {
+	for _, s := range c {
+		if _, ipnet, err := net.ParseCIDR(s); err == nil {
+			if ipnet.IP.To4() == nil {
+				return fmt.Errorf("%s: only IPv4 subnets can be scanned", s)
+			}
+			if err := checkSize(s, subnetSize(ipnet), MaxAddresses); err != nil {
+				return err
+			}
+			continue
+		}
+		if ip := net.ParseIP(s); ip != nil {
+			if ip.To4() == nil {
+				return fmt.Errorf("%s: only IPv4 addresses can be scanned", s)
+			}
+			continue
+		}
+		if first, last, ok := parseRange(s); ok {
+			if bytes.Compare(first, last) > 0 {
+				return fmt.Errorf("%s: the range ends before it starts", s)
+			}
+			if err := checkSize(s, rangeSize(first, last), MaxAddresses); err != nil {
+				return err
+			}
+			continue
+		}
+		if !isHostname(s) {
+			return fmt.Errorf("%q is not an IPv4 address, subnet, range or host name", s)
+		}
+	}
+	return nil
+}
+
+// checkSize returns ErrTooLarge if size is more than max, unless max is
+// zero.
+func checkSize(s string, size uint64, max int) error {
+	if max > 0 && size > uint64(max) {
+		return fmt.Errorf("%s: %d addresses, more than %d: %w", s, size, max, ErrTooLarge)
+	}
+	return nil
+}
+
+// subnetSize returns the number of addresses of an IPv4 subnet.
+func subnetSize(n *net.IPNet) uint64 {
+	ones, bits := n.Mask.Size()
+	return 1 << (bits - ones)
+}
+
+// rangeSize returns the number of addresses from first to last, both IPv4.
+func rangeSize(first, last net.IP) uint64 {
+	return uint64(binary.BigEndian.Uint32(last.To4())) - uint64(binary.BigEndian.Uint32(first.To4())) + 1
+}
+
+// parseRange parses an IPv4 range such as 192.168.1.10-50 or
+// 192.168.1.10-192.168.2.20.
+func parseRange(s string) (first, last net.IP, ok bool) {
+	from, to, found := strings.Cut(s, "-")
+	if !found {
+		return nil, nil, false
+	}
+	if first = net.ParseIP(from).To4(); first == nil {
+		return nil, nil, false
+	}
+	if last = net.ParseIP(to).To4(); last != nil {
+		return first, last, true
+	}
+	octet, err := strconv.ParseUint(to, 10, 8)
+	if err != nil {
+		return nil, nil, false
+	}
+	last = append(net.IP(nil), first...)
+	last[3] = byte(octet)
+	return first, last, true
+}
+
+// isHostname reports whether s can be a DNS name rather than a mistyped
+// address: letters, digits, hyphens and dots, with at least one letter.
+func isHostname(s string) bool {
+	letter := false
+	for _, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+			letter = true
+		case r >= '0' && r <= '9', r == '-', r == '.':
+		default:
+			return false
+		}
+	}
+	return letter
+}
+
+// File is a source reading CIDRs from a file, one per line. Blank lines and
+// text after '#' are ignored.
+type File string
+
+// Groups implements Source, refusing subnets and ranges with more than
+// MaxAddresses addresses.
+func (f File) Groups(ctx context.Context) ([]Group, error) {
+	return f.GroupsUpTo(ctx, MaxAddresses)
+}
+
+// GroupsUpTo is CIDRs.GroupsUpTo for the entries of the file.
+func (f File) GroupsUpTo(ctx context.Context, max int) ([]Group, error) {
+	file, err := os.Open(string(f))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries CIDRs
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		text, _, _ := strings.Cut(scanner.Text(), "#")
+		if text = strings.TrimSpace(text); text != "" {
+			entries = append(entries, text)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	groups, err := entries.GroupsUpTo(ctx, max)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", f, err)
+	}
+	return groups, nil
+}
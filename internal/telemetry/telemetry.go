@@ -0,0 +1,381 @@
+// Package telemetry records spans and metrics of scans and exports them to
+// an OpenTelemetry collector using OTLP over HTTP with JSON encoding. It
+// implements the small part of OpenTelemetry pingdisco needs, so the
+// binary stays free of the SDK.
+//
+// A nil *Tracer is valid and records nothing, so instrumented code needs
+// no checks when telemetry is off.
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Tracer collects finished spans and metric data points until Flush sends
+// them.
+type Tracer struct {
+	// Endpoint is the base URL of the collector, e.g.
+	// http://localhost:4318; spans go to /v1/traces and metrics to
+	// /v1/metrics below it.
+	Endpoint string
+	// Headers are added to every export request, e.g. for authentication.
+	Headers map[string]string
+	Service string
+	Version string
+	HTTP    *http.Client
+
+	mu      sync.Mutex
+	spans   []*Span
+	sums    map[string]*sum
+	hists   map[string]*histogram
+	started time.Time
+}
+
+// New returns a tracer exporting to endpoint, or nil if endpoint is empty.
+func New(endpoint, service, version string) *Tracer {
+	if endpoint == "" {
+		return nil
+	}
+	return &Tracer{
+		Endpoint: strings.TrimSuffix(endpoint, "/"),
+		Service:  service,
+		Version:  version,
+		started:  time.Now(),
+	}
+}
+
+// FromEnv returns a tracer configured by the standard OpenTelemetry
+// variables OTEL_EXPORTER_OTLP_ENDPOINT and OTEL_EXPORTER_OTLP_HEADERS
+// (key=value pairs separated by commas) with endpoint overriding the
+// former, or nil if no endpoint is set.
+func FromEnv(endpoint, service, version string) *Tracer {
+	if endpoint == "" {
+		endpoint = os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+	}
+	t := New(endpoint, service, version)
+	if t == nil {
+		return nil
+	}
+	if name := os.Getenv("OTEL_SERVICE_NAME"); name != "" {
+		t.Service = name
+	}
+	for _, kv := range strings.Split(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"), ",") {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			if t.Headers == nil {
+				t.Headers = make(map[string]string)
+			}
+			t.Headers[strings.TrimSpace(k)] = strings.TrimSpace(v)
+		}
+	}
+	return t
+}
+
+// Span is a timed operation within a trace.
+type Span struct {
+	tracer   *Tracer
+	name     string
+	traceID  [16]byte
+	spanID   [8]byte
+	parentID [8]byte
+	start    time.Time
+	end      time.Time
+	attrs    map[string]any
+	err      error
+}
+
+type spanKey struct{}
+
+// Start begins a span named name as a child of the span in ctx, if any,
+// and returns a context carrying the new span.
+func (t *Tracer) Start(ctx context.Context, name string) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+
+	s := &Span{tracer: t, name: name, start: time.Now()}
+	rand.Read(s.spanID[:])
+	if parent, ok := ctx.Value(spanKey{}).(*Span); ok && parent != nil {
+		s.traceID = parent.traceID
+		s.parentID = parent.spanID
+	} else {
+		rand.Read(s.traceID[:])
+	}
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// SetAttr records an attribute of the span. Values are strings, integers,
+// floats or booleans.
+func (s *Span) SetAttr(key string, value any) {
+	if s == nil {
+		return
+	}
+	if s.attrs == nil {
+		s.attrs = make(map[string]any)
+	}
+	s.attrs[key] = value
+}
+
+// Fail marks the span as failed with err.
+func (s *Span) Fail(err error) {
+	if s != nil {
+		s.err = err
+	}
+}
+
+// End finishes the span.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.end = time.Now()
+	s.tracer.mu.Lock()
+	s.tracer.spans = append(s.tracer.spans, s)
+	s.tracer.mu.Unlock()
+}
+
+type sum struct {
+	unit  string
+	value int64
+}
+
+type histogram struct {
+	unit   string
+	bounds []float64
+	counts []uint64
+	count  uint64
+	total  float64
+}
+
+// Add adds n to the counter name.
+func (t *Tracer) Add(name, unit string, n int64) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.sums == nil {
+		t.sums = make(map[string]*sum)
+	}
+	if t.sums[name] == nil {
+		t.sums[name] = &sum{unit: unit}
+	}
+	t.sums[name].value += n
+}
+
+// durationBounds are the histogram buckets of Observe, in seconds.
+var durationBounds = []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Observe records d in the duration histogram name.
+func (t *Tracer) Observe(name string, d time.Duration) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.hists == nil {
+		t.hists = make(map[string]*histogram)
+	}
+	h := t.hists[name]
+	if h == nil {
+		h = &histogram{unit: "s", bounds: durationBounds, counts: make([]uint64, len(durationBounds)+1)}
+		t.hists[name] = h
+	}
+	v := d.Seconds()
+	h.counts[sort.SearchFloat64s(h.bounds, v)]++
+	h.count++
+	h.total += v
+}
+
+// Flush exports the spans finished and the metrics recorded so far.
+// Metrics are cumulative since the tracer was created.
+func (t *Tracer) Flush(ctx context.Context) error {
+	if t == nil {
+		return nil
+	}
+
+	t.mu.Lock()
+	spans := t.spans
+	t.spans = nil
+	metrics := t.metricsJSON()
+	t.mu.Unlock()
+
+	if len(spans) > 0 {
+		if err := t.post(ctx, "/v1/traces", map[string]any{
+			"resourceSpans": []any{map[string]any{
+				"resource":   t.resource(),
+				"scopeSpans": []any{map[string]any{"scope": t.scope(), "spans": spansJSON(spans)}},
+			}},
+		}); err != nil {
+			return err
+		}
+	}
+	if len(metrics) > 0 {
+		return t.post(ctx, "/v1/metrics", map[string]any{
+			"resourceMetrics": []any{map[string]any{
+				"resource":     t.resource(),
+				"scopeMetrics": []any{map[string]any{"scope": t.scope(), "metrics": metrics}},
+			}},
+		})
+	}
+	return nil
+}
+
+func (t *Tracer) resource() map[string]any {
+	return map[string]any{"attributes": attrsJSON(map[string]any{
+		"service.name":    t.Service,
+		"service.version": t.Version,
+	})}
+}
+
+func (t *Tracer) scope() map[string]any {
+	return map[string]any{"name": "pingdisco.com/pingdisco", "version": t.Version}
+}
+
+func spansJSON(spans []*Span) []any {
+	out := make([]any, 0, len(spans))
+	for _, s := range spans {
+		j := map[string]any{
+			"traceId":           hex.EncodeToString(s.traceID[:]),
+			"spanId":            hex.EncodeToString(s.spanID[:]),
+			"name":              s.name,
+			"kind":              1, // internal
+			"startTimeUnixNano": nanos(s.start),
+			"endTimeUnixNano":   nanos(s.end),
+			"attributes":        attrsJSON(s.attrs),
+		}
+		if s.parentID != [8]byte{} {
+			j["parentSpanId"] = hex.EncodeToString(s.parentID[:])
+		}
+		if s.err != nil {
+			j["status"] = map[string]any{"code": 2, "message": s.err.Error()}
+		}
+		out = append(out, j)
+	}
+	return out
+}
+
+// metricsJSON must be called with t.mu held.
+func (t *Tracer) metricsJSON() []any {
+	now := nanos(time.Now())
+	start := nanos(t.started)
+
+	var out []any
+	for _, name := range sortedKeys(t.sums) {
+		s := t.sums[name]
+		out = append(out, map[string]any{
+			"name": name,
+			"unit": s.unit,
+			"sum": map[string]any{
+				"aggregationTemporality": 2, // cumulative
+				"isMonotonic":            true,
+				"dataPoints": []any{map[string]any{
+					"asInt":             strconv.FormatInt(s.value, 10),
+					"startTimeUnixNano": start,
+					"timeUnixNano":      now,
+				}},
+			},
+		})
+	}
+	for _, name := range sortedKeys(t.hists) {
+		h := t.hists[name]
+		counts := make([]string, len(h.counts))
+		for i, c := range h.counts {
+			counts[i] = strconv.FormatUint(c, 10)
+		}
+		out = append(out, map[string]any{
+			"name": name,
+			"unit": h.unit,
+			"histogram": map[string]any{
+				"aggregationTemporality": 2,
+				"dataPoints": []any{map[string]any{
+					"count":             strconv.FormatUint(h.count, 10),
+					"sum":               h.total,
+					"bucketCounts":      counts,
+					"explicitBounds":    h.bounds,
+					"startTimeUnixNano": start,
+					"timeUnixNano":      now,
+				}},
+			},
+		})
+	}
+	return out
+}
+
+func attrsJSON(attrs map[string]any) []any {
+	out := make([]any, 0, len(attrs))
+	for _, k := range sortedKeys(attrs) {
+		var v map[string]any
+		switch x := attrs[k].(type) {
+		case bool:
+			v = map[string]any{"boolValue": x}
+		case int:
+			v = map[string]any{"intValue": strconv.Itoa(x)}
+		case int64:
+			v = map[string]any{"intValue": strconv.FormatInt(x, 10)}
+		case float64:
+			v = map[string]any{"doubleValue": x}
+		default:
+			v = map[string]any{"stringValue": fmt.Sprint(x)}
+		}
+		out = append(out, map[string]any{"key": k, "value": v})
+	}
+	return out
+}
+
+func (t *Tracer) post(ctx context.Context, path string, body any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.Endpoint+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range t.Headers {
+		req.Header.Set(k, v)
+	}
+
+	client := t.HTTP
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s%s returned %s", t.Endpoint, path, resp.Status)
+	}
+	return nil
+}
+
+func nanos(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,157 @@
+// Package term drives a text terminal for the interactive table of scan
+// --tui: raw keyboard input, the screen size and the escape sequences
+// that redraw the screen in place. It needs no terminal library; raw mode
+// is set with stty on Unix-like systems.
+package term
+
+import (
+	"io"
+	"os"
+	"unicode/utf8"
+)
+
+// Escape sequences understood by every terminal emulator in use (VT100 and
+// xterm).
+const (
+	EnterAltScreen = "\x1b[?1049h"
+	LeaveAltScreen = "\x1b[?1049l"
+	HideCursor     = "\x1b[?25l"
+	ShowCursor     = "\x1b[?25h"
+	// Home moves the cursor to the top left corner.
+	Home = "\x1b[H"
+	// ClearLine clears from the cursor to the end of the line,
+	// ClearBelow to the end of the screen.
+	ClearLine  = "\x1b[K"
+	ClearBelow = "\x1b[J"
+	Bold       = "\x1b[1m"
+	Dim        = "\x1b[2m"
+	Reverse    = "\x1b[7m"
+	Green      = "\x1b[32m"
+	Red        = "\x1b[31m"
+	Reset      = "\x1b[0m"
+)
+
+// IsTerminal reports whether f is a terminal.
+func IsTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// Key is a key press: a printable character as itself, or one of the
+// named keys below.
+type Key string
+
+// Named keys.
+const (
+	KeyUp        Key = "up"
+	KeyDown      Key = "down"
+	KeyLeft      Key = "left"
+	KeyRight     Key = "right"
+	KeyPageUp    Key = "pgup"
+	KeyPageDown  Key = "pgdn"
+	KeyHome      Key = "home"
+	KeyEnd       Key = "end"
+	KeyEnter     Key = "enter"
+	KeyEscape    Key = "esc"
+	KeyBackspace Key = "backspace"
+	KeyTab       Key = "tab"
+	KeyCtrlC     Key = "ctrl-c"
+)
+
+// csiKeys maps the final byte of the cursor key sequences, ESC [ x or
+// ESC O x, to their keys.
+var csiKeys = map[byte]Key{
+	'A': KeyUp, 'B': KeyDown, 'C': KeyRight, 'D': KeyLeft, 'H': KeyHome, 'F': KeyEnd,
+}
+
+// tildeKeys maps the number of the ESC [ n ~ sequences to their keys.
+var tildeKeys = map[string]Key{
+	"1": KeyHome, "4": KeyEnd, "5": KeyPageUp, "6": KeyPageDown, "7": KeyHome, "8": KeyEnd,
+}
+
+// ReadKeys reads key presses from r, a terminal in raw mode, until it
+// fails, and sends them on the returned channel, which it then closes.
+func ReadKeys(r io.Reader) <-chan Key {
+	keys := make(chan Key, 16)
+	go func() {
+		defer close(keys)
+		buf := make([]byte, 256)
+		for {
+			n, err := r.Read(buf)
+			for _, k := range Decode(buf[:n]) {
+				keys <- k
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return keys
+}
+
+// Decode splits the bytes of one read from a terminal into key presses.
+// An escape sequence is assumed to arrive in one read, as terminals write
+// it; an ESC alone is the Escape key. Unknown sequences are dropped.
+func Decode(b []byte) []Key {
+	var keys []Key
+	for len(b) > 0 {
+		switch c := b[0]; {
+		case c == 0x1b:
+			k, n := decodeEscape(b)
+			if k != "" {
+				keys = append(keys, k)
+			}
+			b = b[n:]
+			continue
+		case c == '\r' || c == '\n':
+			keys = append(keys, KeyEnter)
+		case c == 0x7f || c == 0x08:
+			keys = append(keys, KeyBackspace)
+		case c == '\t':
+			keys = append(keys, KeyTab)
+		case c == 0x03:
+			keys = append(keys, KeyCtrlC)
+		case c < 0x20:
+			// Other control characters.
+		default:
+			r, n := utf8.DecodeRune(b)
+			if r != utf8.RuneError {
+				keys = append(keys, Key(string(r)))
+			}
+			b = b[n:]
+			continue
+		}
+		b = b[1:]
+	}
+	return keys
+}
+
+// decodeEscape decodes the escape sequence b starts with and returns its
+// key, "" if unknown, and its length.
+func decodeEscape(b []byte) (Key, int) {
+	if len(b) < 2 {
+		return KeyEscape, 1
+	}
+	switch b[1] {
+	case 'O':
+		if len(b) < 3 {
+			return "", 2
+		}
+		return csiKeys[b[2]], 3
+	case '[':
+		// Parameters, then a final byte from @ to ~.
+		for i := 2; i < len(b); i++ {
+			if c := b[i]; c >= 0x40 && c <= 0x7e {
+				if c == '~' {
+					return tildeKeys[string(b[2:i])], i + 1
+				}
+				return csiKeys[c], i + 1
+			}
+		}
+		return "", len(b)
+	case 0x1b:
+		return KeyEscape, 1
+	}
+	// Alt with a key; the key alone.
+	return "", 1
+}
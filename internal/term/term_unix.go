@@ -0,0 +1,50 @@
+//go:build !windows
+
+package term
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// MakeRaw puts the terminal f into raw mode, without echo or line editing,
+// and returns a function restoring the mode it had.
+func MakeRaw(f *os.File) (restore func() error, err error) {
+	saved, err := stty(f, "-g")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := stty(f, "raw", "-echo"); err != nil {
+		return nil, err
+	}
+	return func() error {
+		_, err := stty(f, strings.TrimSpace(saved))
+		return err
+	}, nil
+}
+
+// Size returns the width and height of the terminal f in characters.
+func Size(f *os.File) (width, height int, err error) {
+	out, err := stty(f, "size")
+	if err != nil {
+		return 0, 0, err
+	}
+	if _, err := fmt.Sscan(out, &height, &width); err != nil {
+		return 0, 0, fmt.Errorf("stty size: %q", out)
+	}
+	return width, height, nil
+}
+
+// stty runs stty on the terminal f, passed as its standard input, which
+// works with both the GNU and the BSD stty.
+func stty(f *os.File, args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = f
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("stty %s: %w", strings.Join(args, " "), err)
+	}
+	return string(out), nil
+}
@@ -0,0 +1,20 @@
+package term
+
+import (
+	"errors"
+	"os"
+)
+
+// ErrUnsupported is returned on Windows, whose console modes stty cannot
+// set.
+var ErrUnsupported = errors.New("the interactive table is not supported on Windows yet; use --serve for a live view")
+
+// MakeRaw is not supported on Windows.
+func MakeRaw(f *os.File) (restore func() error, err error) {
+	return nil, ErrUnsupported
+}
+
+// Size is not supported on Windows.
+func Size(f *os.File) (width, height int, err error) {
+	return 0, 0, ErrUnsupported
+}
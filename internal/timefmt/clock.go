@@ -0,0 +1,37 @@
+package timefmt
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Clock is a wall-clock time of day, in minutes after midnight. Windows
+// built from clocks compare hours and minutes rather than durations since
+// midnight, so they keep their place on days with a daylight saving change.
+type Clock int
+
+// ParseClock parses a time of day such as "07:30".
+func ParseClock(s string) (Clock, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, err
+	}
+	return ClockOf(t), nil
+}
+
+// ClockOf returns the wall-clock time of day of t, in t's location.
+func ClockOf(t time.Time) Clock {
+	return Clock(t.Hour()*60 + t.Minute())
+}
+
+// On returns the time c on the day of t, in t's location.
+func (c Clock) On(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, int(c)/60, int(c)%60, 0, 0, t.Location())
+}
+
+// String formats c as HH:MM.
+func (c Clock) String() string {
+	return fmt.Sprintf("%02d:%02d", int(c)/60, int(c)%60)
+}
@@ -0,0 +1,63 @@
+// Package timefmt formats the timestamps pingdisco prints: RFC 3339 in one
+// display time zone, so that output from sites in different zones can be
+// compared. Stored and transmitted times are not affected; they are
+// always RFC 3339 with their own offset.
+package timefmt
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+var zone = time.Local
+
+// SetZone sets the display time zone: "local" or "" for the system zone,
+// "UTC", or an IANA name such as "Europe/Berlin". It is meant to be called
+// once at startup.
+func SetZone(name string) error {
+	switch strings.ToLower(name) {
+	case "", "local":
+		zone = time.Local
+		return nil
+	case "utc", "z":
+		zone = time.UTC
+		return nil
+	}
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return fmt.Errorf("unknown time zone %q", name)
+	}
+	zone = loc
+	return nil
+}
+
+// Zone returns the display time zone.
+func Zone() *time.Location {
+	return zone
+}
+
+// Format returns t in RFC 3339 in the display time zone, or "-" for the
+// zero time.
+func Format(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.In(zone).Format(time.RFC3339)
+}
+
+// LogWriter prefixes each write with the current time, for use with
+// log.SetOutput in place of the log package's own timestamps.
+type LogWriter struct {
+	W io.Writer
+}
+
+func (w LogWriter) Write(p []byte) (int, error) {
+	line := append([]byte(Format(time.Now())+" "), p...)
+	if _, err := w.W.Write(line); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,106 @@
+package timeline
+
+import (
+	"sort"
+	"time"
+
+	"pingdisco.com/pingdisco/internal/device"
+)
+
+// Churn sums up the address changes in a run of frames. Devices that move
+// every few hours point to a short DHCP lease time, or to clients that
+// pick a new random address as they reconnect.
+type Churn struct {
+	// Devices are those that moved, those moving most often first.
+	Devices []DeviceChurn
+	Moves   int
+	// Tracked counts the devices seen in the frames.
+	Tracked int
+	// Held is the median time devices kept an address before moving, or
+	// zero if none moved.
+	Held time.Duration
+}
+
+// DeviceChurn is the address changes of one device.
+type DeviceChurn struct {
+	// Device is the device as last seen.
+	Device *device.Device
+	Moves  int
+	// Addresses are those the device was found at, in order.
+	Addresses []string
+	// Shortest is the shortest time it kept an address before moving.
+	Shortest time.Duration
+}
+
+// ChurnOf returns the address changes in frames. The time a device kept
+// an address runs from the first frame finding it there to the frame
+// finding it at the next one, so it is only as precise as the frames are
+// frequent.
+func ChurnOf(frames []Frame) Churn {
+	var c Churn
+	byID := make(map[string]*DeviceChurn)
+	since := make(map[string]time.Time)
+	var held []time.Duration
+
+	for _, f := range frames {
+		for _, ch := range f.Changes {
+			if ch.Kind != Moved {
+				continue
+			}
+			d := ch.Device
+			id := d.ID()
+			// A device told apart by address moved from an ID of its
+			// own.
+			old := id
+			if d.MAC == nil {
+				old = ch.From.String()
+			}
+
+			dc := byID[old]
+			delete(byID, old)
+			if dc == nil {
+				dc = &DeviceChurn{Addresses: []string{ch.From.String()}}
+			}
+			dc.Device = d
+			dc.Moves++
+			dc.Addresses = append(dc.Addresses, d.IP().String())
+			if start, ok := since[old]; ok {
+				h := f.At.Sub(start)
+				held = append(held, h)
+				if dc.Shortest == 0 || h < dc.Shortest {
+					dc.Shortest = h
+				}
+			}
+			delete(since, old)
+			since[id] = f.At
+			byID[id] = dc
+			c.Moves++
+		}
+
+		for _, d := range f.Devices {
+			if _, ok := since[d.ID()]; !ok {
+				since[d.ID()] = f.At
+			}
+			if dc := byID[d.ID()]; dc != nil {
+				dc.Device = d
+			}
+		}
+	}
+	c.Tracked = len(since)
+
+	for _, dc := range byID {
+		c.Devices = append(c.Devices, *dc)
+	}
+	sort.Slice(c.Devices, func(a, b int) bool {
+		if c.Devices[a].Moves != c.Devices[b].Moves {
+			return c.Devices[a].Moves > c.Devices[b].Moves
+		}
+		return c.Devices[a].Device.ID() < c.Devices[b].Device.ID()
+	})
+
+	if len(held) > 0 {
+		sort.Slice(held, func(a, b int) bool { return held[a] < held[b] })
+		c.Held = held[len(held)/2]
+	}
+	return c
+}
@@ -0,0 +1,115 @@
+package timeline
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+
+	"pingdisco.com/pingdisco/internal/device"
+	"pingdisco.com/pingdisco/internal/store"
+)
+
+// Compare returns how the devices of scan differ from those of base, such
+// as a baseline of the devices that belong on a managed network. Unlike
+// consecutive snapshots, the two may be far apart, so devices are matched
+// in turn by ID, by address and by hostname:
+//
+//   - a device at an address base had with another MAC address is
+//     Replaced, which on a managed network may be a rogue device taking a
+//     known one's place;
+//   - a device at another address under the same hostname has Moved;
+//   - one at the same address under another hostname is Renamed;
+//   - devices only in scan have Appeared, and those only in base have Left
+//     if scan covered their address.
+func Compare(base, scan store.Scan) []Change {
+	before := make(map[string]*device.Device, len(base.Devices))
+	for _, d := range base.Devices {
+		before[d.ID()] = d
+	}
+	var changes []Change
+	var unmatched []*device.Device
+	match := func(prev, d *device.Device) {
+		delete(before, prev.ID())
+		switch {
+		case !prev.IP().Equal(d.IP()):
+			changes = append(changes, Change{Kind: Moved, Device: d, From: prev.IP()})
+		case renamed(prev, d):
+			changes = append(changes, Change{Kind: Renamed, Device: d, FromName: prev.Hostname()})
+		}
+	}
+
+	for _, d := range scan.Devices {
+		if prev := before[d.ID()]; prev != nil {
+			match(prev, d)
+			continue
+		}
+		unmatched = append(unmatched, d)
+	}
+
+	// A device whose MAC address one of the scans lacks, as when it was
+	// found by ping alone, is told apart by address there.
+	var rest []*device.Device
+	for _, d := range unmatched {
+		prev := atAddress(before, d)
+		switch {
+		case prev == nil:
+			rest = append(rest, d)
+		case prev.MAC != nil && d.MAC != nil:
+			delete(before, prev.ID())
+			changes = append(changes, Change{Kind: Replaced, Device: d, FromMAC: prev.MAC})
+		default:
+			match(prev, d)
+		}
+	}
+
+	for _, d := range rest {
+		if prev := byHostname(before, d); prev != nil {
+			match(prev, d)
+			continue
+		}
+		changes = append(changes, Change{Kind: Appeared, Device: d})
+	}
+
+	covered := coverage(scan.Targets)
+	for _, prev := range before {
+		if covered(prev.IP()) {
+			changes = append(changes, Change{Kind: Left, Device: prev})
+		}
+	}
+
+	sort.Slice(changes, func(a, b int) bool {
+		return bytes.Compare(changes[a].Device.IP(), changes[b].Device.IP()) < 0
+	})
+	return changes
+}
+
+// atAddress returns the device of devices at d's address, or nil.
+func atAddress(devices map[string]*device.Device, d *device.Device) *device.Device {
+	for _, prev := range devices {
+		if prev.IP().Equal(d.IP()) {
+			return prev
+		}
+	}
+	return nil
+}
+
+// byHostname returns the only device of devices with d's hostname that
+// may be d, or nil. Devices with different MAC addresses are different
+// devices whatever their names.
+func byHostname(devices map[string]*device.Device, d *device.Device) *device.Device {
+	name := d.Hostname()
+	if name == "" {
+		return nil
+	}
+	var found *device.Device
+	for _, prev := range devices {
+		if !strings.EqualFold(prev.Hostname(), name) || (prev.MAC != nil && d.MAC != nil) {
+			continue
+		}
+		if found != nil {
+			return nil
+		}
+		found = prev
+	}
+	return found
+}
@@ -0,0 +1,347 @@
+// Package timeline replays saved scans as a sequence of network snapshots
+// and the changes between them: which devices appeared for the first time,
+// came back, left, moved to another address or changed their name.
+package timeline
+
+import (
+	"bytes"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"pingdisco.com/pingdisco/internal/device"
+	"pingdisco.com/pingdisco/internal/store"
+)
+
+// Kinds of change between two snapshots.
+const (
+	// Appeared is a device seen for the first time.
+	Appeared = "appeared"
+	// Returned is a device seen before that was missing from the previous
+	// snapshot.
+	Returned = "returned"
+	// Left is a device missing from a snapshot that covered its address.
+	Left = "left"
+	// Moved is a device found at another address than before.
+	Moved = "moved"
+	// Renamed is a device at the same address with another hostname.
+	Renamed = "renamed"
+	// Replaced is another device at the address of one, told apart by
+	// MAC address. Only Compare reports it.
+	Replaced = "replaced"
+)
+
+// Change is one device changing between two snapshots.
+type Change struct {
+	Kind   string
+	Device *device.Device
+	// From is the previous address of a Moved device.
+	From net.IP
+	// FromName is the previous hostname of a Renamed device.
+	FromName string
+	// FromMAC is the MAC address of the device a Replaced one replaced.
+	FromMAC net.HardwareAddr
+}
+
+// Frame is one snapshot: a saved scan, the devices online in it and how it
+// differs from the snapshot before.
+type Frame struct {
+	ID      int64
+	At      time.Time
+	Note    string
+	Targets []string
+	// SSID is the Wi-Fi network the scan was taken on, if any.
+	SSID    string
+	Devices []*device.Device
+	Changes []Change
+}
+
+// network is what Build remembers about the scans of one network.
+type network struct {
+	scanned bool
+	seen    map[string]bool
+	// last holds the devices present in the most recent scan covering
+	// them.
+	last map[string]*device.Device
+}
+
+// Build turns scans, oldest first, into frames. Devices are told apart by
+// MAC address when known and by IP address otherwise; a device without a
+// MAC address found at a new address under the hostname of one missing
+// from its old address has moved, not left and appeared. A device missing
+// from a scan whose targets did not include its address, such as a routed
+// subnet scanned only now and then, is not counted as having left. Scans
+// are only compared with earlier scans of the same Wi-Fi network, so a
+// laptop moving between home and office does not see every device leave
+// and come back.
+func Build(scans []store.Scan) []Frame {
+	var t Tracker
+	frames := make([]Frame, 0, len(scans))
+	for _, s := range scans {
+		frames = append(frames, t.Add(s))
+	}
+	return frames
+}
+
+// Tracker builds frames one scan at a time, for scans that are still
+// being taken. The zero value is ready to use.
+type Tracker struct {
+	networks map[string]*network
+}
+
+// Add returns the frame of s, which must be newer than the scans added
+// before, comparing it with them the way Build does. The first scan of
+// each network has no changes.
+func (t *Tracker) Add(s store.Scan) Frame {
+	if t.networks == nil {
+		t.networks = make(map[string]*network)
+	}
+	f := Frame{ID: s.ID, At: s.StartedAt, Note: s.Note, Targets: s.Targets, SSID: s.SSID, Devices: s.Devices}
+	covered := coverage(s.Targets)
+
+	n := t.networks[s.SSID]
+	if n == nil {
+		n = &network{seen: make(map[string]bool), last: make(map[string]*device.Device)}
+		t.networks[s.SSID] = n
+	}
+	first := !n.scanned
+	n.scanned = true
+	seen, last := n.seen, n.last
+
+	now := make(map[string]*device.Device, len(s.Devices))
+	for _, d := range s.Devices {
+		now[d.ID()] = d
+	}
+
+	for id, d := range now {
+		if old, ok := renumbered(last, now, id); ok {
+			f.Changes = append(f.Changes, Change{Kind: Moved, Device: d, From: last[old].IP()})
+			delete(last, old)
+			seen[id] = true
+			last[id] = d
+			continue
+		}
+
+		prev, ok := last[id]
+		switch {
+		case first:
+		case !seen[id]:
+			f.Changes = append(f.Changes, Change{Kind: Appeared, Device: d})
+		case !ok:
+			f.Changes = append(f.Changes, Change{Kind: Returned, Device: d})
+		case !prev.IP().Equal(d.IP()):
+			f.Changes = append(f.Changes, Change{Kind: Moved, Device: d, From: prev.IP()})
+		case renamed(prev, d):
+			f.Changes = append(f.Changes, Change{Kind: Renamed, Device: d, FromName: prev.Hostname()})
+		}
+		seen[id] = true
+		last[id] = d
+	}
+
+	for id, d := range last {
+		if now[id] == nil && covered(d.IP()) {
+			if !first {
+				f.Changes = append(f.Changes, Change{Kind: Left, Device: d})
+			}
+			delete(last, id)
+		}
+	}
+
+	sort.Slice(f.Changes, func(a, b int) bool {
+		return bytes.Compare(f.Changes[a].Device.IP(), f.Changes[b].Device.IP()) < 0
+	})
+	return f
+}
+
+// renumbered returns the ID the device now[id] had before if it has no
+// MAC address, is new at its address, and its hostname belongs to exactly
+// one device without a MAC address missing from last's addresses. Devices
+// seen by MAC address are matched by it already.
+func renumbered(last, now map[string]*device.Device, id string) (string, bool) {
+	d := now[id]
+	name := d.Hostname()
+	if d.MAC != nil || name == "" || last[id] != nil {
+		return "", false
+	}
+	for other, o := range now {
+		if other != id && o.MAC == nil && strings.EqualFold(o.Hostname(), name) {
+			return "", false
+		}
+	}
+
+	old, found := "", 0
+	for prevID, p := range last {
+		if p.MAC == nil && now[prevID] == nil && strings.EqualFold(p.Hostname(), name) {
+			old = prevID
+			found++
+		}
+	}
+	return old, found == 1
+}
+
+// renamed reports whether a device answering under a name before answers
+// under another one now. A name missing from one scan, as when a reverse
+// lookup times out, is not a change.
+func renamed(prev, d *device.Device) bool {
+	return prev.Hostname() != "" && d.Hostname() != "" && prev.Hostname() != d.Hostname()
+}
+
+// Presence is a stretch of consecutive snapshots a device was online in.
+type Presence struct {
+	From, To  time.Time
+	FirstID   int64
+	LastID    int64
+	Snapshots int
+	Addresses []string
+}
+
+// History returns the stretches of frames in which the device matching
+// key (see device.Matches) was online, oldest first.
+func History(frames []Frame, key string) []Presence {
+	var history []Presence
+	var cur *Presence
+	for _, f := range frames {
+		var found *device.Device
+		for _, d := range f.Devices {
+			if d.Matches(key) {
+				found = d
+				break
+			}
+		}
+
+		if found == nil {
+			if cur != nil && leftIn(f, key) {
+				history = append(history, *cur)
+				cur = nil
+			}
+			continue
+		}
+
+		if cur == nil {
+			cur = &Presence{From: f.At, FirstID: f.ID}
+		}
+		cur.To, cur.LastID = f.At, f.ID
+		cur.Snapshots++
+		if ip := found.IP().String(); !contains(cur.Addresses, ip) {
+			cur.Addresses = append(cur.Addresses, ip)
+		}
+	}
+	if cur != nil {
+		history = append(history, *cur)
+	}
+	return history
+}
+
+// Hours is how often a device was online at each hour of the day.
+type Hours struct {
+	// Scans counts the snapshots in each hour that looked for the device,
+	// Online those it was found in.
+	Scans  [24]int
+	Online [24]int
+}
+
+// Uptime returns the share of snapshots that looked for the device it was
+// found in, or -1 if none did.
+func (h Hours) Uptime() float64 {
+	scans, online := 0, 0
+	for i := range h.Scans {
+		scans += h.Scans[i]
+		online += h.Online[i]
+	}
+	if scans == 0 {
+		return -1
+	}
+	return float64(online) / float64(scans)
+}
+
+// Pattern counts, by the hour of day in loc, the snapshots since the
+// device matching key was first seen that covered its latest address on
+// the network it was seen on, and how many of them found it.
+func Pattern(frames []Frame, key string, loc *time.Location) Hours {
+	var h Hours
+	var ip net.IP
+	ssid := ""
+	for _, f := range frames {
+		var found *device.Device
+		for _, d := range f.Devices {
+			if d.Matches(key) {
+				found = d
+				break
+			}
+		}
+
+		hour := f.At.In(loc).Hour()
+		switch {
+		case found != nil:
+			ip, ssid = found.IP(), f.SSID
+			h.Online[hour]++
+		case ip == nil || f.SSID != ssid || !coverage(f.Targets)(ip):
+			continue
+		}
+		h.Scans[hour]++
+	}
+	return h
+}
+
+func leftIn(f Frame, key string) bool {
+	for _, c := range f.Changes {
+		if c.Kind == Left && c.Device.Matches(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// Covers reports whether a scan of targets probed ip, the way Add decides
+// whether a device missing from the scan has left.
+func Covers(targets []string, ip net.IP) bool {
+	return coverage(targets)(ip)
+}
+
+// coverage returns a function reporting whether a scan of targets probed
+// ip. Targets that are not subnets or addresses, such as group names, make
+// it cover everything.
+func coverage(targets []string) func(net.IP) bool {
+	var subnets []*net.IPNet
+	for _, t := range targets {
+		fields := strings.Fields(t)
+		if len(fields) == 0 {
+			continue
+		}
+		if _, n, err := net.ParseCIDR(fields[0]); err == nil {
+			subnets = append(subnets, n)
+			continue
+		}
+		if ip := net.ParseIP(fields[0]); ip != nil {
+			bits := 128
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 32
+			}
+			subnets = append(subnets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		return func(net.IP) bool { return true }
+	}
+	if len(subnets) == 0 {
+		return func(net.IP) bool { return true }
+	}
+
+	return func(ip net.IP) bool {
+		for _, n := range subnets {
+			if n.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,194 @@
+package topology
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"runtime"
+	"sync"
+	"syscall"
+	"time"
+
+	"pingdisco.com/pingdisco/internal/netops"
+)
+
+// ICMP message types read and sent by the probes.
+const (
+	icmpEchoReply    = 0
+	icmpUnreachable  = 3
+	icmpEchoRequest  = 8
+	icmpTimeExceeded = 11
+)
+
+// protocolICMP is the protocol number of ICMP in an IPv4 header, which is
+// at least 20 bytes long.
+const (
+	protocolICMP      = 1
+	minIPv4HeaderSize = 20
+)
+
+// answer is the reply to a probe: the address it came from, and whether
+// it was a Destination Unreachable error.
+type answer struct {
+	from        net.IP
+	unreachable bool
+}
+
+// conn is a raw ICMP socket and the probes waiting for an answer on it.
+// Probes are told apart by their sequence number, which the errors of
+// routers quote along with the header of the probe.
+type conn struct {
+	c  net.PacketConn
+	rc syscall.RawConn
+	id uint16
+
+	// mu serializes setting the TTL and sending, so that each probe
+	// leaves with its own TTL.
+	mu      sync.Mutex
+	seq     uint16
+	waiting map[uint16]chan answer
+}
+
+func listen() (*conn, error) {
+	if runtime.GOOS == "windows" {
+		return nil, errors.New("topology: raw sockets are not supported on Windows")
+	}
+	pc, err := net.ListenPacket("ip4:icmp", "0.0.0.0")
+	if err != nil {
+		return nil, fmt.Errorf("topology: %w", err)
+	}
+	sc, ok := pc.(syscall.Conn)
+	if !ok {
+		pc.Close()
+		return nil, errors.New("topology: cannot set the TTL of the raw socket")
+	}
+	rc, err := sc.SyscallConn()
+	if err != nil {
+		pc.Close()
+		return nil, fmt.Errorf("topology: %w", err)
+	}
+	var ttlErr error
+	if err := rc.Control(func(fd uintptr) { ttlErr = setTTL(fd, 64) }); err != nil || ttlErr != nil {
+		pc.Close()
+		return nil, fmt.Errorf("topology: setting the TTL: %w", errors.Join(err, ttlErr))
+	}
+	c := &conn{c: pc, rc: rc, id: uint16(rand.Uint32()), waiting: make(map[uint16]chan answer)}
+	go c.read()
+	return c, nil
+}
+
+func (c *conn) Close() error {
+	return c.c.Close()
+}
+
+// probe sends an echo request to target with the given TTL and waits for
+// the echo reply of the target or the error of a router on the way.
+func (c *conn) probe(ctx context.Context, target net.IP, ttl int, timeout time.Duration) (answer, bool) {
+	reply := make(chan answer, 1)
+
+	c.mu.Lock()
+	c.seq++
+	seq := c.seq
+	c.waiting[seq] = reply
+	err := c.send(target, ttl, seq)
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.waiting, seq)
+		c.mu.Unlock()
+	}()
+	if err != nil {
+		return answer{}, false
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case a := <-reply:
+		return a, true
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+	return answer{}, false
+}
+
+// send writes one probe; c.mu must be held.
+func (c *conn) send(target net.IP, ttl int, seq uint16) error {
+	var err error
+	cerr := c.rc.Control(func(fd uintptr) {
+		err = setTTL(fd, ttl)
+	})
+	if cerr != nil {
+		return cerr
+	}
+	if err != nil {
+		return err
+	}
+	_, err = c.c.WriteTo(netops.EchoRequest(false, c.id, seq), &net.IPAddr{IP: target})
+	return err
+}
+
+// read hands answers to the probes waiting for them until the socket is
+// closed.
+func (c *conn) read() {
+	buf := make([]byte, 1500)
+	for {
+		n, from, err := c.c.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		seq, a, ok := c.parse(buf[:n])
+		if !ok {
+			continue
+		}
+		if addr, isIP := from.(*net.IPAddr); isIP {
+			a.from = addr.IP
+		}
+
+		c.mu.Lock()
+		if ch := c.waiting[seq]; ch != nil {
+			select {
+			case ch <- a:
+			default:
+			}
+		}
+		c.mu.Unlock()
+	}
+}
+
+// parse returns the sequence number of the probe msg answers: an echo
+// reply to it, or a router's error quoting its IP header and the start of
+// its ICMP message.
+func (c *conn) parse(msg []byte) (uint16, answer, bool) {
+	if len(msg) < 8 {
+		return 0, answer{}, false
+	}
+	switch msg[0] {
+	case icmpEchoReply:
+		if binary.BigEndian.Uint16(msg[4:]) != c.id {
+			return 0, answer{}, false
+		}
+		return binary.BigEndian.Uint16(msg[6:]), answer{}, true
+	case icmpTimeExceeded, icmpUnreachable:
+		quoted := msg[8:]
+		if len(quoted) < minIPv4HeaderSize || quoted[9] != protocolICMP {
+			return 0, answer{}, false
+		}
+		headerSize := int(quoted[0]&0x0f) * 4
+		if len(quoted) < headerSize+8 {
+			return 0, answer{}, false
+		}
+		quoted = quoted[headerSize:]
+		if quoted[0] != icmpEchoRequest || binary.BigEndian.Uint16(quoted[4:]) != c.id {
+			return 0, answer{}, false
+		}
+		return binary.BigEndian.Uint16(quoted[6:]), answer{unreachable: msg[0] == icmpUnreachable}, true
+	}
+	return 0, answer{}, false
+}
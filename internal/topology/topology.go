@@ -0,0 +1,269 @@
+// Package topology traces the routes to devices with TTL-limited probes and
+// builds the tree of routers between this host and them, showing which
+// devices sit behind which gateways.
+package topology
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"pingdisco.com/pingdisco/internal/upstream"
+)
+
+// Defaults for Tracer. Routes inside a site seldom pass more than a few
+// routers; the hop limit only bounds the search for a device that never
+// answers.
+const (
+	DefaultMaxHops = 16
+	DefaultTimeout = time.Second
+	DefaultWorkers = 8
+)
+
+// maxSilent is the number of hops in a row that may not answer before a
+// trace gives up: past a firewall dropping the probes, nothing further
+// answers either.
+const maxSilent = 3
+
+// hopTries is the number of probes sent to a hop before it counts as
+// silent. Routers limit the rate of the errors they send back, which
+// traces of many devices through the same gateway run into.
+const hopTries = 2
+
+// Path is the route to a device.
+type Path struct {
+	Target net.IP
+	// Routers are the hops before Target, nearest first; a router that
+	// did not answer has a nil IP. Silent hops at the end are left out.
+	Routers []net.IP
+	// Reached reports whether Target answered, so that Routers is its
+	// whole route rather than the part up to where the trace gave up.
+	Reached bool
+}
+
+// Gateway returns the last router before the target that answered, or nil
+// if none did.
+func (p Path) Gateway() net.IP {
+	for i := len(p.Routers) - 1; i >= 0; i-- {
+		if p.Routers[i] != nil {
+			return p.Routers[i]
+		}
+	}
+	return nil
+}
+
+// Tracer traces routes. It sends ICMP echo requests with a rising TTL over
+// a raw socket, shared by all traces, and reads the Time Exceeded errors of
+// the routers on the way. Where no raw socket can be opened, as without
+// root or on Windows, it runs the system traceroute for each target
+// instead. The zero value is ready to use.
+type Tracer struct {
+	// MaxHops is the highest TTL tried; 0 means DefaultMaxHops.
+	MaxHops int
+	// Timeout is how long to wait for each hop to answer; 0 means
+	// DefaultTimeout.
+	Timeout time.Duration
+	// Workers is the number of routes traced at once; 0 means
+	// DefaultWorkers.
+	Workers int
+
+	once sync.Once
+	conn *conn
+	err  error
+}
+
+// Method describes how routes are traced: "raw socket" or "traceroute
+// command".
+func (t *Tracer) Method() string {
+	if _, err := t.open(); err != nil {
+		return "traceroute command"
+	}
+	return "raw socket"
+}
+
+func (t *Tracer) open() (*conn, error) {
+	t.once.Do(func() {
+		t.conn, t.err = listen()
+	})
+	return t.conn, t.err
+}
+
+// Close closes the raw socket, if one was opened. The tracer cannot be
+// used afterwards.
+func (t *Tracer) Close() error {
+	// Keeps a socket from being opened after Close.
+	t.once.Do(func() { t.err = net.ErrClosed })
+	if t.conn != nil {
+		return t.conn.Close()
+	}
+	return nil
+}
+
+// Trace traces the routes to the IPv4 targets and returns one path for
+// each, in the order of targets. Routes not traced by the time ctx is done
+// are returned empty.
+func (t *Tracer) Trace(ctx context.Context, targets []net.IP) []Path {
+	workers := t.Workers
+	if workers <= 0 {
+		workers = DefaultWorkers
+	}
+
+	paths := make([]Path, len(targets))
+	var wg sync.WaitGroup
+	next := make(chan int)
+	for range min(workers, len(targets)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				paths[i] = t.trace(ctx, targets[i])
+			}
+		}()
+	}
+	for i, ip := range targets {
+		paths[i].Target = ip
+		if ctx.Err() != nil {
+			continue
+		}
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	return paths
+}
+
+func (t *Tracer) trace(ctx context.Context, target net.IP) Path {
+	maxHops := t.MaxHops
+	if maxHops <= 0 {
+		maxHops = DefaultMaxHops
+	}
+	timeout := t.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	c, err := t.open()
+	if err != nil {
+		return traceCommand(ctx, target, maxHops)
+	}
+
+	p := Path{Target: target}
+	silent := 0
+	for ttl := 1; ttl <= maxHops && silent < maxSilent && ctx.Err() == nil; ttl++ {
+		var a answer
+		var ok bool
+		for try := 0; try < hopTries && !ok && ctx.Err() == nil; try++ {
+			a, ok = c.probe(ctx, target, ttl, timeout)
+		}
+		if !ok {
+			p.Routers = append(p.Routers, nil)
+			silent++
+			continue
+		}
+		silent = 0
+		if a.from.Equal(target) {
+			p.Reached = true
+			break
+		}
+		p.Routers = append(p.Routers, a.from)
+		if a.unreachable {
+			// The router knows no way on to the target.
+			break
+		}
+	}
+	p.Routers = trimSilent(p.Routers)
+	return p
+}
+
+// traceCommand traces the route to target with the system traceroute.
+func traceCommand(ctx context.Context, target net.IP, maxHops int) Path {
+	p := Path{Target: target}
+	hops, err := upstream.Trace(ctx, target.String(), maxHops)
+	if err != nil {
+		return p
+	}
+	for _, h := range hops {
+		if h.IP.Equal(target) {
+			p.Reached = true
+			break
+		}
+		p.Routers = append(p.Routers, h.IP)
+	}
+	p.Routers = trimSilent(p.Routers)
+	return p
+}
+
+func trimSilent(routers []net.IP) []net.IP {
+	for len(routers) > 0 && routers[len(routers)-1] == nil {
+		routers = routers[:len(routers)-1]
+	}
+	return routers
+}
+
+// Node is a router in the tree Build returns, or the root of the tree,
+// which stands for this host.
+type Node struct {
+	// IP is the address of the router; nil for the root and for a hop
+	// that did not answer.
+	IP net.IP
+	// Routers are the next hops behind this one, sorted by address with
+	// silent hops last.
+	Routers []*Node
+	// Paths are the paths to the devices whose route ends at this router,
+	// sorted by target address.
+	Paths []Path
+}
+
+// Build merges paths into a tree of the routers they pass, rooted at this
+// host. Paths share a node for as long as their routes are the same; a
+// silent hop is shared only by routes that agree on the hops before it.
+func Build(paths []Path) *Node {
+	root := &Node{}
+	for _, p := range paths {
+		n := root
+		for _, ip := range p.Routers {
+			n = n.child(ip)
+		}
+		n.Paths = append(n.Paths, p)
+	}
+	root.sort()
+	return root
+}
+
+// Walk calls fn for n and every node below it, parents first.
+func (n *Node) Walk(fn func(*Node)) {
+	fn(n)
+	for _, c := range n.Routers {
+		c.Walk(fn)
+	}
+}
+
+func (n *Node) child(ip net.IP) *Node {
+	for _, c := range n.Routers {
+		if (c.IP == nil && ip == nil) || (c.IP != nil && c.IP.Equal(ip)) {
+			return c
+		}
+	}
+	c := &Node{IP: ip}
+	n.Routers = append(n.Routers, c)
+	return c
+}
+
+func (n *Node) sort() {
+	sort.Slice(n.Routers, func(i, j int) bool {
+		a, b := n.Routers[i].IP, n.Routers[j].IP
+		if a == nil || b == nil {
+			return b == nil && a != nil
+		}
+		return bytes.Compare(a.To16(), b.To16()) < 0
+	})
+	sort.Slice(n.Paths, func(i, j int) bool {
+		return bytes.Compare(n.Paths[i].Target.To16(), n.Paths[j].Target.To16()) < 0
+	})
+	for _, c := range n.Routers {
+		c.sort()
+	}
+}
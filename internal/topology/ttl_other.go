@@ -0,0 +1,9 @@
+//go:build !linux && !darwin
+
+package topology
+
+import "errors"
+
+func setTTL(fd uintptr, ttl int) error {
+	return errors.New("topology: setting the TTL of a raw socket is not supported on this system")
+}
@@ -0,0 +1,10 @@
+//go:build linux || darwin
+
+package topology
+
+import "syscall"
+
+// setTTL sets the TTL of the packets sent on the IPv4 socket fd.
+func setTTL(fd uintptr, ttl int) error {
+	return syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_TTL, ttl)
+}
@@ -0,0 +1,265 @@
+// Package update replaces the running binary with the latest release.
+//
+// Releases are described by a JSON feed signed with Ed25519: the signature
+// of the feed bytes is served next to it with a .sig suffix, base64
+// encoded. The feed lists a SHA-256 checksum for the binary of each
+// platform, so a binary is trusted only if the signed feed vouches for it.
+package update
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultFeedURL is the release feed of the official builds.
+const DefaultFeedURL = "https://pingdisco.com/releases/latest.json"
+
+// maxBinarySize bounds downloads, so a broken mirror cannot fill the disk.
+const maxBinarySize = 256 << 20
+
+// Release is the latest release announced by a feed.
+type Release struct {
+	Version   string    `json:"version"`
+	Published time.Time `json:"published"`
+	Notes     string    `json:"notes,omitempty"`
+	Assets    []Asset   `json:"assets"`
+}
+
+// Asset is the binary of a release for one platform.
+type Asset struct {
+	OS     string `json:"os"`
+	Arch   string `json:"arch"`
+	URL    string `json:"url"`
+	SHA256 string `json:"sha256"`
+}
+
+// ErrNoAsset is returned when a release has no binary for this platform.
+var ErrNoAsset = errors.New("no binary for this platform")
+
+// Asset returns the binary for goos/goarch.
+func (r *Release) Asset(goos, goarch string) (Asset, error) {
+	for _, a := range r.Assets {
+		if a.OS == goos && a.Arch == goarch {
+			return a, nil
+		}
+	}
+	return Asset{}, fmt.Errorf("%s %s/%s: %w", r.Version, goos, goarch, ErrNoAsset)
+}
+
+// Updater checks a feed for releases and installs them.
+type Updater struct {
+	FeedURL string
+	// PublicKey verifies the feed signature.
+	PublicKey ed25519.PublicKey
+	HTTP      *http.Client
+}
+
+// ParsePublicKey decodes a base64 Ed25519 public key.
+func ParsePublicKey(s string) (ed25519.PublicKey, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %w", err)
+	}
+	if len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid public key: %d bytes, want %d", len(key), ed25519.PublicKeySize)
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+func (u *Updater) client() *http.Client {
+	if u.HTTP != nil {
+		return u.HTTP
+	}
+	return &http.Client{Timeout: 5 * time.Minute}
+}
+
+// Latest fetches the feed, verifies its signature and returns the release
+// it announces.
+func (u *Updater) Latest(ctx context.Context) (*Release, error) {
+	if len(u.PublicKey) != ed25519.PublicKeySize {
+		return nil, errors.New("no public key to verify the release feed with")
+	}
+
+	feed, err := u.get(ctx, u.FeedURL, 1<<20)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := u.get(ctx, u.FeedURL+".sig", 1<<10)
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(sig)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid feed signature: %w", err)
+	}
+	if !ed25519.Verify(u.PublicKey, feed, signature) {
+		return nil, errors.New("release feed signature does not match")
+	}
+
+	var r Release
+	if err := json.Unmarshal(feed, &r); err != nil {
+		return nil, fmt.Errorf("invalid release feed: %w", err)
+	}
+	if r.Version == "" {
+		return nil, errors.New("release feed names no version")
+	}
+	return &r, nil
+}
+
+// Install downloads the binary of a for this platform, checks it against
+// the checksum in the feed and replaces the file at path with it.
+func (u *Updater) Install(ctx context.Context, a Asset, path string) error {
+	want, err := hex.DecodeString(a.SHA256)
+	if err != nil || len(want) != sha256.Size {
+		return fmt.Errorf("invalid checksum %q in release feed", a.SHA256)
+	}
+
+	bin, err := u.get(ctx, a.URL, maxBinarySize)
+	if err != nil {
+		return err
+	}
+	if got := sha256.Sum256(bin); !bytes.Equal(got[:], want) {
+		return fmt.Errorf("checksum mismatch for %s: got %x", a.URL, got)
+	}
+
+	return Replace(path, bin)
+}
+
+func (u *Updater) get(ctx context.Context, url string, limit int64) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := u.client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > limit {
+		return nil, fmt.Errorf("%s is larger than %d bytes", url, limit)
+	}
+	return body, nil
+}
+
+// Replace atomically replaces the executable at path with bin, keeping its
+// permissions. On Windows, where a running executable cannot be
+// overwritten, the old binary is moved aside to path.old first.
+func Replace(path string, bin []byte) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".new-*")
+	if err != nil {
+		return fmt.Errorf("cannot write next to %s: %w", path, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(bin); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), info.Mode().Perm()); err != nil {
+		return err
+	}
+
+	if runtime.GOOS == "windows" {
+		old := path + ".old"
+		os.Remove(old)
+		if err := os.Rename(path, old); err != nil {
+			return err
+		}
+		if err := os.Rename(tmp.Name(), path); err != nil {
+			os.Rename(old, path)
+			return err
+		}
+		return nil
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Newer reports whether version a is newer than b. Versions are compared
+// as dotted numbers with an optional leading v; a pre-release suffix
+// (-rc.1) sorts before the release. Anything else, such as "dev", is older
+// than every version.
+func Newer(a, b string) bool {
+	pa, oka := parseVersion(a)
+	pb, okb := parseVersion(b)
+	switch {
+	case !oka:
+		return false
+	case !okb:
+		return true
+	}
+
+	for i := range pa.nums {
+		if pa.nums[i] != pb.nums[i] {
+			return pa.nums[i] > pb.nums[i]
+		}
+	}
+	switch {
+	case pa.pre == pb.pre:
+		return false
+	case pa.pre == "":
+		return true
+	case pb.pre == "":
+		return false
+	}
+	return pa.pre > pb.pre
+}
+
+type version struct {
+	nums [3]int
+	pre  string
+}
+
+func parseVersion(s string) (version, bool) {
+	var v version
+	s = strings.TrimPrefix(s, "v")
+	s, v.pre, _ = strings.Cut(s, "-")
+	s, _, _ = strings.Cut(s, "+")
+
+	parts := strings.Split(s, ".")
+	if len(parts) == 0 || len(parts) > 3 {
+		return v, false
+	}
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return v, false
+		}
+		v.nums[i] = n
+	}
+	return v, true
+}
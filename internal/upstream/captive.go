@@ -0,0 +1,83 @@
+package upstream
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// DefaultCaptivePortalURL answers 204 No Content with an empty body when
+// nothing intercepts plain HTTP.
+const DefaultCaptivePortalURL = "http://connectivitycheck.gstatic.com/generate_204"
+
+// Portal is what a captive portal check found.
+type Portal struct {
+	Detected bool `json:"detected"`
+	// Reason says what gave the portal away.
+	Reason string `json:"reason,omitempty"`
+	// LoginURL is where the portal sends browsers to sign in, if it said.
+	LoginURL string `json:"login_url,omitempty"`
+}
+
+var htmlTitle = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+
+// DetectCaptivePortal fetches url, which must answer with an empty 2xx
+// response, over plain HTTP without following redirects. Captive portals
+// intercept it and answer with a redirect to their login page, a page of
+// their own or 511 Network Authentication Required. An error means the
+// check did not get an answer at all, which says nothing about a portal.
+func DetectCaptivePortal(ctx context.Context, url string) (Portal, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return Portal{}, err
+	}
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Do(req)
+	if err != nil {
+		return Portal{}, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return Portal{}, err
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusNetworkAuthenticationRequired:
+		return Portal{Detected: true, Reason: "the network requires signing in (511 Network Authentication Required)"}, nil
+	case resp.StatusCode >= 300 && resp.StatusCode < 400:
+		p := Portal{Detected: true, Reason: "the connectivity check was redirected"}
+		if loc, err := resp.Location(); err == nil {
+			p.LoginURL = loc.String()
+		}
+		return p, nil
+	case resp.StatusCode >= 200 && resp.StatusCode < 300 && len(strings.TrimSpace(string(body))) == 0:
+		return Portal{}, nil
+	}
+
+	reason := fmt.Sprintf("the connectivity check returned %s with a page of its own", resp.Status)
+	if m := htmlTitle.FindSubmatch(body); m != nil {
+		if title := strings.Join(strings.Fields(html.UnescapeString(string(m[1]))), " "); title != "" {
+			reason += fmt.Sprintf(" (%q)", title)
+		}
+	}
+	return Portal{Detected: true, Reason: reason}, nil
+}
+
+// String describes p in one line.
+func (p Portal) String() string {
+	switch {
+	case !p.Detected:
+		return "none detected"
+	case p.LoginURL != "":
+		return fmt.Sprintf("%s to %s", p.Reason, p.LoginURL)
+	default:
+		return p.Reason
+	}
+}
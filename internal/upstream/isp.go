@@ -0,0 +1,86 @@
+package upstream
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	"pingdisco.com/pingdisco/internal/hostname"
+)
+
+// ISP describes who routes a public address.
+type ISP struct {
+	IP         net.IP `json:"ip"`
+	ReverseDNS string `json:"reverse_dns,omitempty"`
+	ASN        string `json:"asn,omitempty"`
+	ASName     string `json:"as_name,omitempty"`
+	Prefix     string `json:"prefix,omitempty"`
+	Country    string `json:"country,omitempty"`
+}
+
+// LookupISP finds the reverse DNS name and origin AS of ip. The AS comes
+// from Team Cymru's IP-to-ASN DNS service, so no further HTTP service is
+// involved. Fields that could not be resolved are left empty.
+func LookupISP(ctx context.Context, ip net.IP) ISP {
+	isp := ISP{IP: ip}
+
+	if names, err := net.DefaultResolver.LookupAddr(ctx, ip.String()); err == nil && len(names) > 0 {
+		isp.ReverseDNS = hostname.Clean(names[0])
+	}
+
+	v4 := ip.To4()
+	if v4 == nil {
+		return isp
+	}
+
+	// "15169 | 8.8.8.0/24 | US | arin | 1992-12-01"
+	origin := fmt.Sprintf("%d.%d.%d.%d.origin.asn.cymru.com", v4[3], v4[2], v4[1], v4[0])
+	if fields := lookupCymru(ctx, origin); len(fields) >= 3 {
+		isp.ASN = "AS" + strings.Fields(fields[0])[0]
+		isp.Prefix = fields[1]
+		isp.Country = fields[2]
+	}
+	if isp.ASN == "" {
+		return isp
+	}
+
+	// "15169 | US | arin | 2000-03-30 | GOOGLE, US"
+	if fields := lookupCymru(ctx, isp.ASN+".asn.cymru.com"); len(fields) >= 5 {
+		isp.ASName = fields[4]
+	}
+
+	return isp
+}
+
+func lookupCymru(ctx context.Context, name string) []string {
+	txts, err := net.DefaultResolver.LookupTXT(ctx, name)
+	if err != nil || len(txts) == 0 {
+		return nil
+	}
+
+	fields := strings.Split(txts[0], "|")
+	for i := range fields {
+		fields[i] = strings.TrimSpace(fields[i])
+	}
+	if len(fields) == 0 || fields[0] == "" {
+		return nil
+	}
+	return fields
+}
+
+// String renders the ISP on one line, e.g.
+// "203.0.113.9 (host.example.net) AS64500 EXAMPLE-NET, US".
+func (i ISP) String() string {
+	s := i.IP.String()
+	if i.ReverseDNS != "" {
+		s += " (" + i.ReverseDNS + ")"
+	}
+	if i.ASN != "" {
+		s += " " + i.ASN
+		if i.ASName != "" {
+			s += " " + i.ASName
+		}
+	}
+	return s
+}
@@ -0,0 +1,60 @@
+package upstream
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// Trace runs the system traceroute towards target and returns up to
+// maxHops hops. Hops that did not answer have a nil IP.
+func Trace(ctx context.Context, target string, maxHops int) ([]Hop, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "tracert", "-d", "-h", strconv.Itoa(maxHops), "-w", "1000", target)
+	} else {
+		cmd = exec.CommandContext(ctx, "traceroute", "-n", "-q", "1", "-w", "1", "-m", strconv.Itoa(maxHops), target)
+	}
+
+	out, err := cmd.Output()
+	hops := parseTrace(out)
+	if len(hops) == 0 && err != nil {
+		return nil, err
+	}
+	return hops, nil
+}
+
+// parseTrace reads traceroute and tracert output: lines starting with the
+// hop number, followed by timings and the hop address, or "*" for hops
+// that did not answer.
+func parseTrace(out []byte) []Hop {
+	var hops []Hop
+
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		ttl, err := strconv.Atoi(fields[0])
+		if err != nil {
+			continue
+		}
+
+		hop := Hop{TTL: ttl}
+		for _, f := range fields[1:] {
+			if ip := net.ParseIP(strings.Trim(f, "()[]")); ip != nil {
+				hop.IP = ip
+				break
+			}
+		}
+		hops = append(hops, hop)
+	}
+
+	return hops
+}
@@ -0,0 +1,184 @@
+package upstream
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const ssdpAddr = "239.255.255.250:1900"
+
+var wanServices = []string{
+	"urn:schemas-upnp-org:service:WANIPConnection:2",
+	"urn:schemas-upnp-org:service:WANIPConnection:1",
+	"urn:schemas-upnp-org:service:WANPPPConnection:1",
+}
+
+// ErrNoGateway is returned when no UPnP internet gateway answers.
+var ErrNoGateway = errors.New("no UPnP internet gateway found")
+
+// GatewayWAN asks the UPnP internet gateway on the local network for its
+// external address.
+func GatewayWAN(ctx context.Context) (net.IP, error) {
+	location, err := discoverIGD(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	controlURL, service, err := findWANService(ctx, location)
+	if err != nil {
+		return nil, err
+	}
+
+	return externalIPAddress(ctx, controlURL, service)
+}
+
+func discoverIGD(ctx context.Context) (string, error) {
+	conn, err := net.ListenPacket("udp4", ":0")
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	dst, err := net.ResolveUDPAddr("udp4", ssdpAddr)
+	if err != nil {
+		return "", err
+	}
+
+	msg := "M-SEARCH * HTTP/1.1\r\n" +
+		"HOST: " + ssdpAddr + "\r\n" +
+		"MAN: \"ssdp:discover\"\r\n" +
+		"MX: 2\r\n" +
+		"ST: urn:schemas-upnp-org:device:InternetGatewayDevice:1\r\n\r\n"
+	if _, err := conn.WriteTo([]byte(msg), dst); err != nil {
+		return "", err
+	}
+
+	deadline := time.Now().Add(3 * time.Second)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetReadDeadline(deadline)
+
+	buf := make([]byte, 2048)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			return "", ErrNoGateway
+		}
+		for _, line := range strings.Split(string(buf[:n]), "\r\n") {
+			name, value, ok := strings.Cut(line, ":")
+			if ok && strings.EqualFold(strings.TrimSpace(name), "location") {
+				return strings.TrimSpace(value), nil
+			}
+		}
+	}
+}
+
+type upnpDevice struct {
+	Services []struct {
+		Type       string `xml:"serviceType"`
+		ControlURL string `xml:"controlURL"`
+	} `xml:"serviceList>service"`
+	Devices []upnpDevice `xml:"deviceList>device"`
+}
+
+func findWANService(ctx context.Context, location string) (string, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+	if err != nil {
+		return "", "", err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", "", err
+	}
+	defer resp.Body.Close()
+
+	var root struct {
+		URLBase string     `xml:"URLBase"`
+		Device  upnpDevice `xml:"device"`
+	}
+	if err := xml.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&root); err != nil {
+		return "", "", fmt.Errorf("reading gateway description: %w", err)
+	}
+
+	base, err := url.Parse(location)
+	if err != nil {
+		return "", "", err
+	}
+	if root.URLBase != "" {
+		if b, err := url.Parse(root.URLBase); err == nil {
+			base = b
+		}
+	}
+
+	for _, want := range wanServices {
+		if control, ok := findService(root.Device, want); ok {
+			ref, err := url.Parse(control)
+			if err != nil {
+				return "", "", err
+			}
+			return base.ResolveReference(ref).String(), want, nil
+		}
+	}
+
+	return "", "", errors.New("gateway offers no WAN connection service")
+}
+
+func findService(d upnpDevice, serviceType string) (string, bool) {
+	for _, s := range d.Services {
+		if s.Type == serviceType {
+			return s.ControlURL, true
+		}
+	}
+	for _, child := range d.Devices {
+		if control, ok := findService(child, serviceType); ok {
+			return control, true
+		}
+	}
+	return "", false
+}
+
+func externalIPAddress(ctx context.Context, controlURL, service string) (net.IP, error) {
+	body := `<?xml version="1.0"?>` +
+		`<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/">` +
+		`<s:Body><u:GetExternalIPAddress xmlns:u="` + service + `"/></s:Body></s:Envelope>`
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, controlURL, bytes.NewBufferString(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", `text/xml; charset="utf-8"`)
+	req.Header.Set("SOAPAction", `"`+service+`#GetExternalIPAddress"`)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GetExternalIPAddress returned %s", resp.Status)
+	}
+
+	var envelope struct {
+		Address string `xml:"Body>GetExternalIPAddressResponse>NewExternalIPAddress"`
+	}
+	if err := xml.NewDecoder(io.LimitReader(resp.Body, 1<<16)).Decode(&envelope); err != nil {
+		return nil, err
+	}
+
+	ip := net.ParseIP(strings.TrimSpace(envelope.Address))
+	if ip == nil {
+		return nil, errors.New("gateway reported no external address")
+	}
+	return ip, nil
+}
@@ -0,0 +1,223 @@
+// Package upstream works out how this network reaches the internet: the
+// gateway's WAN address as reported over UPnP, the public address seen by
+// an external service and the first hops of a trace. Comparing them shows
+// double NAT and carrier-grade NAT.
+package upstream
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// DefaultTraceTarget is traced to find the hops between the gateway and the
+// public internet.
+const DefaultTraceTarget = "1.1.1.1"
+
+// Hop is one router on the path to DefaultTraceTarget.
+type Hop struct {
+	TTL int    `json:"ttl"`
+	IP  net.IP `json:"ip,omitempty"`
+}
+
+// Summary is the upstream topology of a network.
+type Summary struct {
+	Gateway net.IP `json:"gateway,omitempty"`
+	// GatewayWAN is the external address the gateway reports over UPnP.
+	GatewayWAN net.IP `json:"gateway_wan,omitempty"`
+	// PublicIP is the address external services see.
+	PublicIP net.IP `json:"public_ip,omitempty"`
+	Hops     []Hop  `json:"hops,omitempty"`
+	// NATLayers is the number of address translations detected between
+	// this host and the public internet, or 0 if unknown.
+	NATLayers int  `json:"nat_layers"`
+	DoubleNAT bool `json:"double_nat"`
+	CGNAT     bool `json:"cgnat"`
+	// CaptivePortal is set when a captive portal intercepts web traffic.
+	CaptivePortal *Portal `json:"captive_portal,omitempty"`
+	// Errors lists the lookups that failed.
+	Errors []string `json:"errors,omitempty"`
+}
+
+// Options controls Discover.
+type Options struct {
+	// PublicIPURL returns the caller's address as plain text.
+	PublicIPURL string
+	// CaptivePortalURL answers with an empty 2xx response when no captive
+	// portal is in the way.
+	CaptivePortalURL string
+	TraceTarget      string
+	MaxHops          int
+	Timeout          time.Duration
+}
+
+// Discover gathers the upstream summary for a network whose default gateway
+// is gateway.
+func Discover(ctx context.Context, gateway net.IP, opts Options) Summary {
+	if opts.PublicIPURL == "" {
+		opts.PublicIPURL = DefaultPublicIPURL
+	}
+	if opts.CaptivePortalURL == "" {
+		opts.CaptivePortalURL = DefaultCaptivePortalURL
+	}
+	if opts.TraceTarget == "" {
+		opts.TraceTarget = DefaultTraceTarget
+	}
+	if opts.MaxHops == 0 {
+		opts.MaxHops = 8
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = 5 * time.Second
+	}
+
+	s := Summary{Gateway: gateway}
+
+	wanCtx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	wan, err := GatewayWAN(wanCtx)
+	cancel()
+	if err != nil {
+		s.Errors = append(s.Errors, "UPnP: "+err.Error())
+	}
+	s.GatewayWAN = wan
+
+	portalCtx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	portal, err := DetectCaptivePortal(portalCtx, opts.CaptivePortalURL)
+	cancel()
+	if err != nil {
+		s.Errors = append(s.Errors, "captive portal check: "+err.Error())
+	} else if portal.Detected {
+		s.CaptivePortal = &portal
+	}
+
+	ipCtx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	public, err := PublicIP(ipCtx, opts.PublicIPURL)
+	cancel()
+	if err != nil {
+		s.Errors = append(s.Errors, "public IP: "+err.Error())
+	}
+	s.PublicIP = public
+
+	hops, err := Trace(ctx, opts.TraceTarget, opts.MaxHops)
+	if err != nil {
+		s.Errors = append(s.Errors, "trace: "+err.Error())
+	}
+	s.Hops = hops
+
+	s.classify()
+	return s
+}
+
+// classify counts the NAT layers. Every private hop before the first public
+// one sits behind a translation unless it is the same network as the hop
+// before it; the gateway's WAN address disagreeing with the public address
+// adds a layer the trace may not show.
+func (s *Summary) classify() {
+	layers := 0
+	var prev net.IP
+	for _, h := range s.Hops {
+		if h.IP == nil {
+			continue
+		}
+		if !isPrivate(h.IP) {
+			break
+		}
+		if isCGNAT(h.IP) {
+			s.CGNAT = true
+		}
+		if prev == nil || !sameNetwork(prev, h.IP) {
+			layers++
+		}
+		prev = h.IP
+	}
+
+	if s.GatewayWAN != nil {
+		if isCGNAT(s.GatewayWAN) {
+			s.CGNAT = true
+		}
+		if isPrivate(s.GatewayWAN) || (s.PublicIP != nil && !s.GatewayWAN.Equal(s.PublicIP)) {
+			layers = max(layers, 2)
+		} else {
+			layers = max(layers, 1)
+		}
+	}
+
+	if layers == 0 && s.PublicIP != nil && s.Gateway != nil && isPrivate(s.Gateway) {
+		layers = 1
+	}
+
+	s.NATLayers = layers
+	s.DoubleNAT = layers > 1
+}
+
+// Lines renders the summary for reports.
+func (s Summary) Lines() []string {
+	show := func(ip net.IP) string {
+		if ip == nil {
+			return "unknown"
+		}
+		return ip.String()
+	}
+
+	lines := []string{
+		fmt.Sprintf("Gateway:      %s", show(s.Gateway)),
+		fmt.Sprintf("Gateway WAN:  %s", show(s.GatewayWAN)),
+		fmt.Sprintf("Public IP:    %s", show(s.PublicIP)),
+	}
+
+	var path []string
+	for _, h := range s.Hops {
+		if h.IP == nil {
+			path = append(path, "*")
+			continue
+		}
+		path = append(path, h.IP.String())
+		if !isPrivate(h.IP) {
+			break
+		}
+	}
+	if len(path) > 0 {
+		lines = append(lines, "Path:         "+strings.Join(path, " -> "))
+	}
+
+	switch {
+	case s.NATLayers == 0:
+		lines = append(lines, "NAT:          unknown")
+	case s.DoubleNAT:
+		lines = append(lines, fmt.Sprintf("NAT:          %d layers (double NAT)", s.NATLayers))
+	default:
+		lines = append(lines, "NAT:          single")
+	}
+	if s.CGNAT {
+		lines = append(lines, "              carrier-grade NAT (100.64.0.0/10) upstream")
+	}
+	if s.DoubleNAT {
+		lines = append(lines, "              port forwarding and UPnP on the gateway will not be reachable from the internet")
+	}
+
+	if s.CaptivePortal != nil {
+		lines = append(lines, "Portal:       captive portal, "+s.CaptivePortal.String())
+	}
+
+	for _, e := range s.Errors {
+		lines = append(lines, "Warning:      "+e)
+	}
+
+	return lines
+}
+
+var cgnat = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+func isCGNAT(ip net.IP) bool {
+	return cgnat.Contains(ip)
+}
+
+func isPrivate(ip net.IP) bool {
+	return ip.IsPrivate() || isCGNAT(ip) || ip.IsLinkLocalUnicast()
+}
+
+func sameNetwork(a, b net.IP) bool {
+	mask := net.CIDRMask(24, 32)
+	return a.Mask(mask).Equal(b.Mask(mask))
+}
@@ -0,0 +1,71 @@
+// Package wol wakes sleeping hosts with Wake-on-LAN magic packets: six
+// 0xff bytes followed by the MAC address of the host sixteen times, sent
+// as a UDP broadcast the network card of the host listens for.
+package wol
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+)
+
+// DefaultPort is the discard port, which magic packets are usually sent
+// to; some cards only listen on 7 instead.
+const DefaultPort = 9
+
+// Broadcast is the limited broadcast address, which stays on the link of
+// the interface the packet leaves by.
+var Broadcast = net.IPv4bcast
+
+// MagicPacket returns the magic packet waking the host with the given MAC
+// address.
+func MagicPacket(mac net.HardwareAddr) ([]byte, error) {
+	if len(mac) != 6 {
+		return nil, fmt.Errorf("wol: %s is not a 48-bit MAC address", mac)
+	}
+	p := make([]byte, 6, 6+16*6)
+	for i := range p {
+		p[i] = 0xff
+	}
+	for range 16 {
+		p = append(p, mac...)
+	}
+	return p, nil
+}
+
+// Send broadcasts the magic packet for mac to the broadcast address addr
+// on port.
+func Send(mac net.HardwareAddr, addr net.IP, port int) error {
+	p, err := MagicPacket(mac)
+	if err != nil {
+		return err
+	}
+	if addr == nil {
+		return errors.New("wol: no broadcast address")
+	}
+	conn, err := net.Dial("udp", net.JoinHostPort(addr.String(), strconv.Itoa(port)))
+	if err != nil {
+		return fmt.Errorf("wol: %w", err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write(p); err != nil {
+		return fmt.Errorf("wol: %w", err)
+	}
+	return nil
+}
+
+// DirectedBroadcast returns the broadcast address of subnet, e.g.
+// 192.168.1.255 for 192.168.1.0/24, which routers can be set to forward
+// to a subnet they are attached to.
+func DirectedBroadcast(subnet *net.IPNet) net.IP {
+	ip := subnet.IP.To4()
+	if ip == nil || len(subnet.Mask) != net.IPv4len {
+		return nil
+	}
+	b := make(net.IP, net.IPv4len)
+	for i := range b {
+		b[i] = ip[i] | ^subnet.Mask[i]
+	}
+	return b
+}
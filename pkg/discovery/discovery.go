@@ -0,0 +1,197 @@
+// Package discovery finds the devices on a subnet the way the pingdisco
+// command does, for programs that want subnet scanning without running the
+// CLI:
+//
+//	_, subnet, _ := net.ParseCIDR("192.168.1.0/24")
+//	s := discovery.NewScanner(discovery.ScanOptions{Workers: 64})
+//	devices, err := s.Scan(ctx, subnet)
+//
+// Hosts are pinged over an ICMP socket where the process may open one and
+// with the system ping command otherwise; see the pingdisco README for the
+// permissions each needs. Results carry only what a scan learns; the
+// inventory, scan history and alerting of the CLI are not part of this
+// package.
+package discovery
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"time"
+
+	"pingdisco.com/pingdisco/internal/device"
+	"pingdisco.com/pingdisco/internal/experiments"
+	"pingdisco.com/pingdisco/internal/netops"
+	"pingdisco.com/pingdisco/internal/portscan"
+	"pingdisco.com/pingdisco/internal/scanner"
+	"pingdisco.com/pingdisco/internal/targets"
+)
+
+// ScanOptions configures a Scanner. The zero value scans like pingdisco
+// scan does by default.
+type ScanOptions struct {
+	// Timeout is how long each probe waits for an answer; zero means one
+	// second.
+	Timeout time.Duration
+	// Count is the number of echo requests sent at once in each attempt
+	// to reach a host; zero means one. A host is taken to be down after
+	// missing two attempts a quarter of a second apart, as pingdisco scan
+	// does by default.
+	Count int
+	// Samples is the number of echo requests timed for each device that
+	// answers a ping, filling in its Latency; zero skips them.
+	Samples int
+	// Ports are the TCP ports tried on each device that answers, filling
+	// in its OpenPorts; nil tries none.
+	Ports []int
+	// Workers is the number of hosts probed at once; zero means 256.
+	Workers int
+	// Rate limits the hosts probed per second; zero means as fast as the
+	// link allows. Probes are slowed down on cellular, slow and weak Wi-Fi
+	// links regardless.
+	Rate int
+	// ARP also sends ARP requests on subnets the host is directly attached
+	// to, finding devices that drop ICMP. It is fastest where the process
+	// may open raw sockets (CAP_NET_RAW on Linux).
+	ARP bool
+	// Experiments names experimental discovery methods to enable, as
+	// listed by pingdisco experiments. Unknown names are ignored.
+	Experiments []string
+}
+
+// Device is a device that answered a scan.
+type Device struct {
+	IP  net.IP
+	MAC net.HardwareAddr
+	// Hostname is the reverse DNS name of the device, or the name it gave
+	// itself over mDNS or LLMNR, or "".
+	Hostname string
+	// Vendor, OS and Type are best guesses from the device's names and
+	// addresses, or "" when nothing suggested one.
+	Vendor, OS, Type string
+	// Sources lists how the device was found and named, e.g. "ping",
+	// "arp" and "rdns".
+	Sources []string
+	// RTT is the round-trip time of the probe that found the device, or
+	// zero if it was not measured.
+	RTT time.Duration
+	// Latency is measured when ScanOptions.Samples is set, nil otherwise.
+	Latency *Latency
+	// OpenPorts lists the ScanOptions.Ports that accepted a connection.
+	OpenPorts []int
+	FoundAt   time.Time
+}
+
+// Latency summarises the echo requests timed for a device.
+type Latency struct {
+	Sent int
+	// Loss is the percentage of requests left unanswered.
+	Loss          float64
+	Min, Avg, Max time.Duration
+	// Jitter is the mean difference between consecutive round-trip times.
+	Jitter time.Duration
+}
+
+// Result is the outcome of scanning one subnet.
+type Result struct {
+	Subnet     *net.IPNet
+	Devices    []Device
+	StartedAt  time.Time
+	FinishedAt time.Time
+}
+
+// Scanner scans subnets. It keeps its ICMP sockets open between scans, so
+// a program scanning repeatedly should reuse one Scanner. It is safe for
+// use by one goroutine at a time.
+type Scanner struct {
+	opts ScanOptions
+	ops  *netops.Ops
+}
+
+// NewScanner returns a Scanner probing the real network with opts.
+func NewScanner(opts ScanOptions) *Scanner {
+	return &Scanner{opts: opts, ops: netops.System()}
+}
+
+// Scan probes every address of subnet and returns the devices that
+// answered, in address order.
+func (s *Scanner) Scan(ctx context.Context, subnet *net.IPNet) ([]Device, error) {
+	results, err := s.Run(ctx, subnet)
+	if err != nil {
+		return nil, err
+	}
+	return results[0].Devices, nil
+}
+
+// Run scans each subnet in turn and returns a Result for each. An address
+// in several subnets is only probed, and reported, the first time.
+// Subnets larger than a /16 are refused: each of their addresses would be
+// probed and remembered.
+func (s *Scanner) Run(ctx context.Context, subnets ...*net.IPNet) ([]Result, error) {
+	probe := scanner.DefaultProbe
+	if s.opts.Timeout > 0 {
+		probe.Timeout = s.opts.Timeout
+	}
+	if s.opts.Count > 0 {
+		probe.Count = s.opts.Count
+	}
+	probe.Samples = s.opts.Samples
+	probe.Ports = s.opts.Ports
+	sc := &scanner.Scanner{
+		Probe:       probe,
+		Ops:         s.ops,
+		Workers:     s.opts.Workers,
+		Rate:        s.opts.Rate,
+		ARP:         s.opts.ARP,
+		Experiments: experiments.New(s.opts.Experiments...),
+	}
+
+	var results []Result
+	for _, subnet := range subnets {
+		if subnet == nil {
+			return results, errors.New("discovery: nil subnet")
+		}
+		r := Result{Subnet: subnet, StartedAt: time.Now()}
+		found, err := sc.Run(ctx, targets.CIDRs{subnet.String()})
+		if err != nil {
+			return results, err
+		}
+		r.FinishedAt = time.Now()
+		for _, d := range found {
+			r.Devices = append(r.Devices, fromDevice(d))
+		}
+		results = append(results, r)
+	}
+	return results, nil
+}
+
+func fromDevice(d *device.Device) Device {
+	rtt, _ := time.ParseDuration(d.Get(device.AttrRTT))
+	var latency *Latency
+	if sent := d.Int(device.AttrLatencySent); sent > 0 {
+		latency = &Latency{Sent: sent}
+		latency.Loss, _ = strconv.ParseFloat(d.Get(device.AttrLatencyLoss), 64)
+		latency.Min, _ = time.ParseDuration(d.Get(device.AttrLatencyMin))
+		latency.Avg, _ = time.ParseDuration(d.Get(device.AttrLatencyAvg))
+		latency.Max, _ = time.ParseDuration(d.Get(device.AttrLatencyMax))
+		latency.Jitter, _ = time.ParseDuration(d.Get(device.AttrLatencyJitter))
+	}
+	var open []int
+	if ports := d.Get(device.AttrOpenPorts); ports != "" {
+		open, _ = portscan.Parse(ports)
+	}
+	return Device{
+		IP:        d.IP(),
+		MAC:       d.MAC,
+		Hostname:  d.NetworkName(),
+		Vendor:    d.Identification(device.FieldVendor).Value,
+		OS:        d.Identification(device.FieldOS).Value,
+		Type:      d.Identification(device.FieldType).Value,
+		Sources:   d.Sources,
+		RTT:       rtt,
+		Latency:   latency,
+		OpenPorts: open,
+		FoundAt:   d.FirstSeen,
+	}
+}